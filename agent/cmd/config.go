@@ -1,11 +1,21 @@
 package cmd
 
 import (
+	"agent/internal/admin"
+	"agent/internal/common"
 	"agent/internal/config"
+	"agent/internal/identity"
 	"agent/internal/logger"
+	"agent/internal/manager"
+	"cmp"
+	"errors"
 	"fmt"
+	"maps"
 	"os"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 )
@@ -18,12 +28,41 @@ var configCmd = &cobra.Command{
 	Examples:
 		simob config                    # Show current config
 		simob config api_key=your-key   # Set API key
+		simob config tags.env=prod      # Set a host tag (empty value removes it)
+		simob config metrics_failover_urls=https://a,https://b   # Export failover, in order
+		simob config api_key=your-key --defer-registration      # Machine image, register on first boot
 	`,
 	Run: func(cmd *cobra.Command, args []string) {
 		runConfig(args)
+		if deferRegistration {
+			prepareImage()
+		}
 	},
 }
 
+// deferRegistration prepares the agent to be baked into a machine image
+var deferRegistration bool
+
+func init() {
+	configCmd.Flags().BoolVar(&deferRegistration, "defer-registration", false,
+		"Defer the host identity, key validation and registration to the first boot of the instances of a machine image")
+}
+
+// prepareImage forgets the identity and registration of this machine, the
+// agent starts on the next boot, as an instance of the image
+func prepareImage() {
+	if running, err := common.IsLockAcquired(); err == nil && running {
+		fmt.Fprintf(textOut, "%s[✘]%s The agent is running, stop it before baking the image.\n", ColorRed, ColorReset)
+	}
+	if err := identity.DeferRegistration(); err != nil {
+		exitWithError(fmt.Errorf("failed to defer the registration: %w", err))
+	}
+	if err := manager.ForgetRegistration(); err != nil {
+		exitWithError(fmt.Errorf("failed to defer the registration: %w", err))
+	}
+	fmt.Fprintf(textOut, "%s[✓]%s The agent registers on the first boot of the instances.\n", ColorGreen, ColorReset)
+}
+
 func runConfig(args []string) {
 	// Initialize logger
 	debug := os.Getenv("DEBUG") == "1"
@@ -39,10 +78,12 @@ func runConfig(args []string) {
 	}
 
 	// Parse key=value pairs
+	result := setResult{Set: []string{}, Errors: make(map[string]string)}
 	for _, arg := range args {
 		parts := strings.SplitN(arg, "=", 2)
 		if len(parts) != 2 {
-			fmt.Printf("Invalid format: %s. Use key=value\n", arg)
+			fmt.Fprintf(textOut, "Invalid format: %s. Use key=value\n", arg)
+			result.Errors[arg] = "invalid format, use key=value"
 			continue
 		}
 
@@ -50,24 +91,100 @@ func runConfig(args []string) {
 		value := strings.TrimSpace(parts[1])
 
 		if err := setConfigValue(key, value); err != nil {
-			fmt.Printf("Error setting %s: %v\n", key, err)
+			fmt.Fprintf(textOut, "Error setting %s: %v\n", key, err)
+			result.Errors[key] = err.Error()
 		} else {
-			fmt.Printf("Set new value for %s\n", key)
+			fmt.Fprintf(textOut, "Set new value for %s\n", key)
+			result.Set = append(result.Set, key)
 		}
 	}
+	if len(result.Set) > 0 {
+		reloadRunningAgent()
+	}
+	printResult(result)
+	if len(result.Errors) > 0 {
+		os.Exit(ExitUsage)
+	}
+}
+
+// setResult is printed by simob config key=value --output json
+type setResult struct {
+	Set    []string          `json:"set"`
+	Errors map[string]string `json:"errors,omitempty"`
+}
+
+// reloadRunningAgent asks the running agent, if any, to apply the saved
+// config instead of leaving it running with the previous one.
+func reloadRunningAgent() {
+	running, err := common.IsLockAcquired()
+	if err != nil || !running {
+		return
+	}
+	resp, err := admin.Send(admin.Request{Command: admin.Reload}, 10*time.Second)
+	switch {
+	case errors.Is(err, admin.ErrNotRunning):
+		fmt.Fprintln(textOut, "The running agent can't reload its config, restart it to apply the changes.")
+	case err != nil:
+		fmt.Fprintf(textOut, "Failed to reload the running agent, restart it to apply the changes: %v\n", err)
+	case resp.Restarting:
+		fmt.Fprintln(textOut, "The running agent restarts to apply the changes.")
+	default:
+		fmt.Fprintln(textOut, "The running agent reloaded its config.")
+	}
 }
 func showConfig() {
 	cfg, err := config.Load()
 	if err != nil {
-		fmt.Printf("No existing config found, showing defaults:\n")
+		if !jsonOutput() {
+			fmt.Fprintf(textOut, "No existing config found, showing defaults:\n")
+		}
 		cfg = config.NewConfig("")
 	}
 
-	fmt.Printf("Current configuration:\n")
-	fmt.Printf("  api_key = %s\n", cfg.APIKey)
-	fmt.Printf("  api_url = %s\n", cfg.APIUrl)
-	fmt.Printf("  logs_export_url = %s\n", cfg.LogsExportUrl)
-	fmt.Printf("  metrics_export_url = %s\n", cfg.MetricsExportUrl)
+	values := configValues(cfg)
+	if jsonOutput() {
+		result := make(map[string]any, len(values))
+		for _, v := range values {
+			result[v.key] = v.value
+		}
+		printResult(result)
+		return
+	}
+	fmt.Fprintf(textOut, "Current configuration:\n")
+	for _, v := range values {
+		fmt.Fprintf(textOut, "  %s = %v\n", v.key, v.value)
+	}
+}
+
+// configValue is a setting shown by simob config
+type configValue struct {
+	key   string
+	value any
+}
+
+// configValues returns the settings shown by simob config, in order
+func configValues(cfg *config.Config) []configValue {
+	values := []configValue{
+		{"api_key", cfg.APIKey},
+		{"api_url", cfg.APIUrl},
+		{"logs_export_url", cfg.LogsExportUrl},
+		{"metrics_export_url", cfg.MetricsExportUrl},
+		{"host_id_source", cfg.HostIDSource},
+		{"update_url", cfg.UpdateURL},
+		{"grpc_export_url", cfg.GRPCExportUrl},
+		{"metrics_export_format", cmp.Or(cfg.MetricsExportFormat, config.MetricsFormatJSON)},
+		{"metrics_failover_urls", strings.Join(cfg.ExportFailover.MetricsExportUrls, ",")},
+		{"logs_failover_urls", strings.Join(cfg.ExportFailover.LogsExportUrls, ",")},
+		{"disable_cloud_tags", cfg.DisableCloudTags},
+		{"disable_schedule_offsets", cfg.DisableScheduleOffsets},
+		{"adaptive_collection", cfg.AdaptiveCollection.Enabled},
+		{"otlp_receiver", cfg.OTLPReceiver.Enabled},
+		{"share_config_snapshot", cfg.ShareConfigSnapshot},
+	}
+	for _, k := range slices.Sorted(maps.Keys(cfg.Tags)) {
+		values = append(values, configValue{"tags." + k, cfg.Tags[k]})
+	}
+	return values
 }
 
 func setConfigValue(key, value string) error {
@@ -77,6 +194,14 @@ func setConfigValue(key, value string) error {
 		cfg = config.NewConfig("")
 	}
 
+	if name, ok := strings.CutPrefix(key, "tags."); ok {
+		if name == "" {
+			return fmt.Errorf("empty tag name")
+		}
+		cfg.SetTag(name, value)
+		return cfg.Save()
+	}
+
 	// Set the value based on key
 	switch strings.ToLower(key) {
 	case "api_key":
@@ -87,6 +212,55 @@ func setConfigValue(key, value string) error {
 		cfg.SetLogsExportUrl(value)
 	case "metrics_export_url":
 		cfg.SetMetricsExportUrl(value)
+	case "host_id_source":
+		// Resolved on agent start, resolving here could persist a host ID
+		if err := identity.ValidateSource(value); err != nil {
+			return err
+		}
+		cfg.SetHostIDSource(value)
+	case "update_url":
+		cfg.SetUpdateURL(value)
+	case "grpc_export_url":
+		cfg.SetGRPCExportUrl(value)
+	case "metrics_export_format":
+		if err := config.ValidateMetricsExportFormat(value); err != nil {
+			return err
+		}
+		cfg.SetMetricsExportFormat(value)
+	case "metrics_failover_urls":
+		cfg.SetMetricsFailoverUrls(splitList(value))
+	case "logs_failover_urls":
+		cfg.SetLogsFailoverUrls(splitList(value))
+	case "disable_cloud_tags":
+		disable, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid boolean value: %s", value)
+		}
+		cfg.SetDisableCloudTags(disable)
+	case "disable_schedule_offsets":
+		disable, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid boolean value: %s", value)
+		}
+		cfg.SetDisableScheduleOffsets(disable)
+	case "adaptive_collection":
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid boolean value: %s", value)
+		}
+		cfg.SetAdaptiveCollection(enabled)
+	case "otlp_receiver":
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid boolean value: %s", value)
+		}
+		cfg.SetOTLPReceiver(enabled)
+	case "share_config_snapshot":
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid boolean value: %s", value)
+		}
+		cfg.SetShareConfigSnapshot(enabled)
 	default:
 		return fmt.Errorf("unknown config key: %s", key)
 	}
@@ -94,3 +268,14 @@ func setConfigValue(key, value string) error {
 	// Save the updated config
 	return cfg.Save()
 }
+
+// splitList splits a comma separated value, an empty value clears the list
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
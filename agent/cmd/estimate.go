@@ -0,0 +1,51 @@
+package cmd
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"agent/internal/manager"
+)
+
+var (
+	estimateDuration   time.Duration
+	estimateCollectors []string
+)
+
+var estimateCmd = &cobra.Command{
+	Use:   "estimate",
+	Short: "Estimate the daily ingest volume of this host",
+	Long: `Estimate the daily ingest volume of this host before enabling the collection
+on a fleet. A dry run collects the selected metrics and log sources, nothing is
+sent, and the size of what would have been sent is printed per minute and per
+day. The metrics are counted at their normal collection interval, the log
+volumes are extrapolated from the activity during the dry run.
+
+	Examples:
+		simob estimate                     # All the collectors, for a minute
+		simob estimate --duration 10m      # Logs measured over 10 minutes
+		simob estimate --collectors cpu,nginx
+	`,
+	Args: cobra.NoArgs,
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		if estimateDuration <= 0 {
+			return fmt.Errorf("%w: duration must be positive", errUsage)
+		}
+		return nil
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		dryRun = true
+		dryRunFormat = manager.DryRunEstimate
+		dryRunDuration = estimateDuration
+		dryRunCollectors = estimateCollectors
+		Start()
+	},
+}
+
+func init() {
+	estimateCmd.Flags().DurationVar(&estimateDuration, "duration", time.Minute, "How long the dry run collects, the longer the more representative the log volumes")
+	estimateCmd.Flags().StringSliceVar(&estimateCollectors, "collectors", nil, "Collectors to estimate, all by default")
+	rootCmd.AddCommand(estimateCmd)
+}
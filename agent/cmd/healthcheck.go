@@ -0,0 +1,28 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+
+	"agent/internal/config"
+	"agent/internal/logger"
+	"agent/internal/updater"
+	"agent/internal/version"
+)
+
+var healthCheck bool
+
+// runHealthCheck checks that the binary runs on this host and can read the
+// existing config, then prints its version. The updater runs it on a new
+// binary before restarting the agent on it.
+func runHealthCheck() {
+	logger.Init(os.Getenv("DEBUG") == "1")
+	if _, err := config.Load(); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		fmt.Fprintf(os.Stderr, "failed to load config: %v\n", err)
+		os.Exit(1)
+	}
+	_ = json.NewEncoder(os.Stdout).Encode(updater.HealthReport{Version: version.Version})
+}
@@ -0,0 +1,78 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"agent/internal/admin"
+	"agent/internal/common"
+	"agent/internal/config"
+	"agent/internal/identity"
+	"agent/internal/logger"
+)
+
+var identityCmd = &cobra.Command{
+	Use:   "identity",
+	Short: "Manage the host identity",
+}
+
+var identityResetCmd = &cobra.Command{
+	Use:   "reset",
+	Short: "Forget the host ID and resolve a new one",
+	Long: `Forget the host ID and resolve a new one, e.g. on a VM cloned from another
+one, so that both hosts stop reporting data as the same host. A generated host
+ID is replaced by a new one, a host ID derived from the machine-id or the
+product UUID only changes once the machine's identifier does.
+
+	Examples:
+		simob identity reset
+	`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		logger.Init(os.Getenv("DEBUG") == "1")
+
+		cfg, err := config.Load()
+		if err != nil {
+			return fmt.Errorf("%w: failed to load config: %w", errNoConfig, err)
+		}
+		previous, hostID, err := identity.Reset(cfg.HostIDSource)
+		if err != nil {
+			return err
+		}
+		printResult(map[string]any{"previous_host_id": previous, "host_id": hostID, "changed": previous != hostID})
+		if previous == hostID {
+			fmt.Fprintf(textOut, "%s[✘]%s The host ID %s is derived from the machine and didn't change.\n", ColorRed, ColorReset, hostID)
+			fmt.Fprintf(textOut, "Reset the machine-id of the clone, or run `simob config host_id_source=%s`.\n", identity.SourceGenerated)
+			return nil
+		}
+		fmt.Fprintf(textOut, "%s[✓]%s New host ID: %s (was %s)\n", ColorGreen, ColorReset, hostID, previous)
+		restartRunningAgent()
+		return nil
+	},
+}
+
+// restartRunningAgent restarts the running agent, if any, so that it uses
+// the new host ID
+func restartRunningAgent() {
+	running, err := common.IsLockAcquired()
+	if err != nil || !running {
+		return
+	}
+	_, err = admin.Send(admin.Request{Command: admin.Restart}, 10*time.Second)
+	switch {
+	case errors.Is(err, admin.ErrNotRunning):
+		fmt.Fprintln(textOut, "The running agent can't be restarted, restart it to use the new host ID.")
+	case err != nil:
+		fmt.Fprintf(textOut, "Failed to restart the running agent, restart it to use the new host ID: %v\n", err)
+	default:
+		fmt.Fprintln(textOut, "The running agent restarts with the new host ID.")
+	}
+}
+
+func init() {
+	identityCmd.AddCommand(identityResetCmd)
+	rootCmd.AddCommand(identityCmd)
+}
@@ -3,7 +3,9 @@ package cmd
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io/fs"
 	"os"
 	"os/signal"
 	"syscall"
@@ -11,6 +13,7 @@ import (
 
 	"github.com/spf13/cobra"
 
+	"agent/internal/config"
 	"agent/internal/logger"
 	"agent/internal/logs"
 	logsRegistry "agent/internal/logs/registry"
@@ -30,7 +33,11 @@ var inspectMetricsCmd = &cobra.Command{
 		collectorName := args[0]
 		logger.Init(os.Getenv("DEBUG") == "1")
 
-		metricsCollectors := metricsRegistry.BuildCollectors(nil)
+		cfg, err := loadCollectorConfig()
+		if err != nil {
+			return err
+		}
+		metricsCollectors := metricsRegistry.BuildCollectors(nil, cfg)
 		for _, c := range metricsCollectors {
 			if c.Name() == collectorName {
 				// First collection to init state
@@ -42,7 +49,7 @@ var inspectMetricsCmd = &cobra.Command{
 					return fmt.Errorf("failed to collect metrics: %w", err)
 				}
 				prettyJSON, _ := json.MarshalIndent(data, "", "  ")
-				fmt.Println(string(prettyJSON))
+				fmt.Fprintln(jsonOut, string(prettyJSON))
 				return nil
 			}
 		}
@@ -50,6 +57,19 @@ var inspectMetricsCmd = &cobra.Command{
 	},
 }
 
+// loadCollectorConfig loads the agent config the collectors read their
+// targets from. Without a config file they use their defaults.
+func loadCollectorConfig() (*config.Config, error) {
+	cfg, err := config.Load()
+	if errors.Is(err, fs.ErrNotExist) {
+		return &config.Config{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to load config: %w", errNoConfig, err)
+	}
+	return cfg, nil
+}
+
 var inspectLogsCmd = &cobra.Command{
 	Use:   "logs <collector_name>",
 	Short: "Inspect a specific logs collector and print its output",
@@ -81,7 +101,7 @@ var inspectLogsCmd = &cobra.Command{
 				select {
 				case entry := <-logsChan:
 					prettyJSON, _ := json.MarshalIndent(entry, "", "  ")
-					fmt.Println(string(prettyJSON))
+					fmt.Fprintln(jsonOut, string(prettyJSON))
 					_ = c.Stop()
 					return nil
 				case <-ctx.Done():
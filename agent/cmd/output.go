@@ -0,0 +1,127 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"agent/internal/api"
+	"agent/internal/common"
+	"agent/internal/updater"
+)
+
+// Exit codes of the CLI. They're part of its interface, configuration
+// management tools tell the failures apart with them, so they never change.
+const (
+	ExitOK      = 0
+	ExitFailure = 1
+	// ExitUsage is an invalid flag, argument or config value
+	ExitUsage          = 2
+	ExitAlreadyRunning = 3
+	ExitInvalidKey     = 4
+	// ExitNoConfig is a missing config file or API key
+	ExitNoConfig = 5
+	// ExitLockError is a lock file that couldn't be checked or acquired
+	ExitLockError = 6
+	// ExitUpdateUnavailable is an update that couldn't be found or
+	// downloaded, the agent is left as it is
+	ExitUpdateUnavailable = 7
+)
+
+// Errors mapped to the exit codes, the other errors exit with ExitFailure
+var (
+	errUsage      = errors.New("invalid usage")
+	errInvalidKey = errors.New("API key rejected by the backend")
+	errNoConfig   = errors.New("agent not configured")
+	errLock       = errors.New("lock error")
+)
+
+// errorExitCode returns the exit code of a command failing with err
+func errorExitCode(err error) int {
+	var statusErr *api.StatusError
+	switch {
+	case err == nil:
+		return ExitOK
+	case errors.Is(err, errUsage):
+		return ExitUsage
+	case errors.Is(err, common.ErrAlreadyRunning):
+		return ExitAlreadyRunning
+	case errors.Is(err, errInvalidKey),
+		errors.As(err, &statusErr) && (statusErr.StatusCode == http.StatusUnauthorized || statusErr.StatusCode == http.StatusForbidden):
+		return ExitInvalidKey
+	case errors.Is(err, errNoConfig):
+		return ExitNoConfig
+	case errors.Is(err, errLock):
+		return ExitLockError
+	case errors.Is(err, updater.ErrUnavailable):
+		return ExitUpdateUnavailable
+	}
+	return ExitFailure
+}
+
+// Output formats selected with --output
+const (
+	outputText = "text"
+	outputJSON = "json"
+)
+
+var outputFormat string
+
+// jsonOut receives the JSON documents, the stdout of the command
+var jsonOut io.Writer = os.Stdout
+
+// textOut receives the messages for humans. With --output json it's stderr,
+// so that they don't mix with the JSON documents, e.g. the progress of an
+// update.
+var textOut io.Writer = os.Stdout
+
+func jsonOutput() bool {
+	return outputFormat == outputJSON
+}
+
+func setupOutput(cmd *cobra.Command, args []string) error {
+	switch outputFormat {
+	case outputText:
+		textOut = cmd.OutOrStdout()
+	case outputJSON:
+		textOut = cmd.ErrOrStderr()
+	default:
+		return fmt.Errorf("%w: output must be %s or %s", errUsage, outputText, outputJSON)
+	}
+	jsonOut = cmd.OutOrStdout()
+	updater.SetOutput(textOut)
+	return nil
+}
+
+// printResult writes the result of a command with --output json, it does
+// nothing in text mode
+func printResult(v any) {
+	if !jsonOutput() {
+		return
+	}
+	enc := json.NewEncoder(jsonOut)
+	enc.SetIndent("", "  ")
+	_ = enc.Encode(v)
+}
+
+// errorResult is written on a failure with --output json
+type errorResult struct {
+	Error string `json:"error"`
+	Code  int    `json:"code"`
+}
+
+// exitWithError reports err and exits with its exit code
+func exitWithError(err error) {
+	code := errorExitCode(err)
+	if jsonOutput() {
+		printResult(errorResult{Error: err.Error(), Code: code})
+	} else {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+	}
+	os.Exit(code)
+}
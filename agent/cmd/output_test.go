@@ -0,0 +1,83 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"agent/internal/api"
+	"agent/internal/common"
+	"agent/internal/updater"
+)
+
+func TestErrorExitCode(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		code int
+	}{
+		{"nil", nil, ExitOK},
+		{"other", errors.New("boom"), ExitFailure},
+		{"usage", fmt.Errorf("%w: unknown flag", errUsage), ExitUsage},
+		{"already running", fmt.Errorf("start: %w", common.ErrAlreadyRunning), ExitAlreadyRunning},
+		{"invalid key", errInvalidKey, ExitInvalidKey},
+		{"unauthorized", fmt.Errorf("register: %w", &api.StatusError{StatusCode: http.StatusUnauthorized}), ExitInvalidKey},
+		{"forbidden", &api.StatusError{StatusCode: http.StatusForbidden}, ExitInvalidKey},
+		{"server error", &api.StatusError{StatusCode: http.StatusInternalServerError}, ExitFailure},
+		{"no config", fmt.Errorf("%w: no API key", errNoConfig), ExitNoConfig},
+		{"lock", fmt.Errorf("%w: permission denied", errLock), ExitLockError},
+		{"update unavailable", fmt.Errorf("update failed: %w", updater.ErrUnavailable), ExitUpdateUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.code, errorExitCode(tt.err))
+		})
+	}
+}
+
+func TestSetupOutput(t *testing.T) {
+	defer func() {
+		outputFormat = outputText
+		require.NoError(t, setupOutput(rootCmd, nil))
+	}()
+	var stdout, stderr bytes.Buffer
+	cmd := &cobra.Command{}
+	cmd.SetOut(&stdout)
+	cmd.SetErr(&stderr)
+
+	// The JSON documents go to stdout, the messages for humans to stderr
+	outputFormat = outputJSON
+	require.NoError(t, setupOutput(cmd, nil))
+	fmt.Fprintln(textOut, "Checking the new binary...")
+	printResult(map[string]bool{"updated": true})
+	assert.Equal(t, "Checking the new binary...\n", stderr.String())
+	assert.JSONEq(t, `{"updated": true}`, stdout.String())
+
+	stdout.Reset()
+	stderr.Reset()
+	outputFormat = outputText
+	require.NoError(t, setupOutput(cmd, nil))
+	fmt.Fprintln(textOut, "Checking the new binary...")
+	printResult(map[string]bool{"updated": true})
+	assert.Equal(t, "Checking the new binary...\n", stdout.String())
+	assert.Empty(t, stderr.String())
+
+	outputFormat = "yaml"
+	assert.Equal(t, ExitUsage, errorExitCode(setupOutput(cmd, nil)))
+}
+
+func TestStartOutputFlag(t *testing.T) {
+	// The dry run format doesn't hide the output of the commands
+	require.NoError(t, startCmd.ParseFlags([]string{"--output", "json", "--format", "summary"}))
+	defer func() {
+		outputFormat, dryRunFormat = outputText, "json"
+	}()
+	assert.Equal(t, outputJSON, outputFormat)
+	assert.Equal(t, "summary", dryRunFormat)
+}
@@ -1,17 +1,38 @@
 package cmd
 
-import "github.com/spf13/cobra"
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
 
 var rootCmd = &cobra.Command{
 	Use:   "simob",
 	Short: "SimpleObservability agent CLI",
+	// Errors are reported by Execute, with their exit code
+	SilenceErrors:     true,
+	PersistentPreRunE: setupOutput,
+	Run: func(cmd *cobra.Command, args []string) {
+		if healthCheck {
+			runHealthCheck()
+			return
+		}
+		_ = cmd.Help()
+	},
 }
 
 func Execute() {
-	cobra.CheckErr(rootCmd.Execute())
+	if err := rootCmd.Execute(); err != nil {
+		exitWithError(err)
+	}
 }
 
 func init() {
+	rootCmd.PersistentFlags().StringVar(&outputFormat, "output", outputText, "Output format of the commands: text or json")
+	rootCmd.SetFlagErrorFunc(func(cmd *cobra.Command, err error) error {
+		return fmt.Errorf("%w: %w", errUsage, err)
+	})
+	rootCmd.Flags().BoolVar(&healthCheck, "health-check", false, "Check that the binary runs on this host and print its version")
 	rootCmd.AddCommand(versionCmd)
 	rootCmd.AddCommand(updateCmd)
 	rootCmd.AddCommand(startCmd)
@@ -43,7 +43,7 @@ func runCommandWithExitCode(cmd *cobra.Command, args []string) int {
 	jobKey := args[0]
 	dashdash := cmd.ArgsLenAtDash()
 	if dashdash == -1 || len(args[dashdash:]) == 0 {
-		fmt.Println("Error: No command provided to run. See 'simob run --help' for usage.")
+		fmt.Fprintln(textOut, "Error: No command provided to run. See 'simob run --help' for usage.")
 		return 1
 	}
 	commandToRunArgs := args[dashdash:]
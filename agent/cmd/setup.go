@@ -0,0 +1,274 @@
+package cmd
+
+import (
+	"bufio"
+	"cmp"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/user"
+	"runtime"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"agent/internal/api"
+	"agent/internal/config"
+	"agent/internal/logger"
+	"agent/internal/logs"
+	logsRegistry "agent/internal/logs/registry"
+	"agent/internal/metrics"
+	metricsRegistry "agent/internal/metrics/registry"
+)
+
+var setupCmd = &cobra.Command{
+	Use:   "setup",
+	Short: "Configure, install and start the agent in one step",
+	Long: `Configure, install and start the agent in one step: the API key is asked
+and validated, the available metrics and log sources are discovered and
+listed, then the systemd service is installed and started. Every question
+can be answered with a flag, --yes accepts the defaults of the other ones.
+
+	Examples:
+		simob setup
+		simob setup --api-key your-key --yes
+		simob setup --api-key your-key --yes --no-start
+	`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		logger.Init(os.Getenv("DEBUG") == "1")
+		return runSetup(newPrompter(os.Stdin, setupYes))
+	},
+}
+
+var (
+	setupAPIKey  string
+	setupYes     bool
+	setupService bool
+	setupNoStart bool
+)
+
+func init() {
+	setupCmd.Flags().StringVar(&setupAPIKey, "api-key", "", "API key of the agent, asked when missing")
+	setupCmd.Flags().BoolVar(&setupYes, "yes", false, "Don't ask, accept the defaults")
+	setupCmd.Flags().BoolVar(&setupService, "install-service", true, "Install the systemd service when it's missing")
+	setupCmd.Flags().BoolVar(&setupNoStart, "no-start", false, "Configure and install the agent without starting it")
+	rootCmd.AddCommand(setupCmd)
+}
+
+// Service installed by setup, the same as the one of install.sh
+const (
+	systemdService  = "simob"
+	systemdUser     = "simob-agent"
+	systemdGroup    = "simob-admins"
+	systemdUnitFile = "/etc/systemd/system/" + systemdService + ".service"
+)
+
+// setupResult is printed by simob setup --output json
+type setupResult struct {
+	// KeyChecked is false when the backend couldn't be reached to validate
+	// the key
+	KeyChecked       bool           `json:"key_checked"`
+	Metrics          map[string]int `json:"metrics"`
+	LogSources       []string       `json:"log_sources"`
+	ServiceInstalled bool           `json:"service_installed"`
+	Started          bool           `json:"started"`
+}
+
+func runSetup(p *prompter) error {
+	result := setupResult{Metrics: make(map[string]int), LogSources: []string{}}
+
+	apiKey := setupAPIKey
+	if apiKey == "" {
+		var current string
+		if cfg, err := config.Load(); err == nil {
+			current = cfg.APIKey
+		}
+		question := "API key"
+		if current != "" {
+			// The current key isn't shown
+			question = "API key, empty keeps the current one"
+		}
+		apiKey = cmp.Or(p.ask(question, ""), current)
+	}
+	if apiKey == "" {
+		return fmt.Errorf("%w: an API key is required, pass it with --api-key", errNoConfig)
+	}
+
+	cfg := config.NewConfig(apiKey)
+	cfg.SetAPIKey(apiKey)
+	valid, err := api.NewClient(*cfg, false).CheckAPIKeyValidity()
+	switch {
+	case err != nil:
+		// The agent retries on start, e.g. behind a proxy not configured yet
+		fmt.Fprintf(textOut, "%s[✘]%s The API key couldn't be checked: %v\n", ColorRed, ColorReset, err)
+	case !valid:
+		return errInvalidKey
+	default:
+		result.KeyChecked = true
+		fmt.Fprintf(textOut, "%s[✓]%s API key valid\n", ColorGreen, ColorReset)
+	}
+	if err := cfg.Save(); err != nil {
+		return fmt.Errorf("failed to save config: %w", err)
+	}
+	fmt.Fprintf(textOut, "%s[✓]%s Config saved\n", ColorGreen, ColorReset)
+
+	fmt.Fprintln(textOut, "\nDiscovering what can be collected on this host...")
+	for _, c := range metricsRegistry.BuildCollectors(nil, cfg) {
+		if n := len(metrics.DiscoverAvailableMetrics([]metrics.MetricCollector{c})); n > 0 {
+			result.Metrics[c.Name()] = n
+			fmt.Fprintf(textOut, "  %-16s %d metrics\n", c.Name(), n)
+		}
+	}
+	for _, source := range logs.DiscoverAvailableLogSources(logsRegistry.BuildCollectors(nil)) {
+		result.LogSources = append(result.LogSources, source.Name)
+		if source.Path != "" {
+			fmt.Fprintf(textOut, "  %-16s logs from %s\n", source.Name, source.Path)
+		} else {
+			fmt.Fprintf(textOut, "  %-16s logs\n", source.Name)
+		}
+	}
+	fmt.Fprintln(textOut, "What is collected is selected in the dashboard, `simob estimate` previews its daily volume.")
+	fmt.Fprintln(textOut)
+
+	installed := serviceInstalled()
+	if !installed && setupService && canInstallService() && p.confirm("Install the systemd service?", true) {
+		if err := installService(); err != nil {
+			return fmt.Errorf("failed to install the service: %w", err)
+		}
+		installed, result.ServiceInstalled = true, true
+		fmt.Fprintf(textOut, "%s[✓]%s Service installed\n", ColorGreen, ColorReset)
+	}
+
+	switch {
+	case setupNoStart:
+	case !installed:
+		fmt.Fprintln(textOut, "No service is installed, start the agent with `simob start`.")
+	case p.confirm("Start the agent?", true):
+		// Restarted when it runs, so that it uses the new config
+		if out, err := exec.Command("systemctl", "restart", systemdService).CombinedOutput(); err != nil {
+			return fmt.Errorf("failed to start the service: %w: %s", err, strings.TrimSpace(string(out)))
+		}
+		result.Started = true
+		fmt.Fprintf(textOut, "%s[✓]%s Agent started, check it with `simob status`\n", ColorGreen, ColorReset)
+	}
+	printResult(result)
+	return nil
+}
+
+// serviceInstalled tells whether the systemd service exists
+func serviceInstalled() bool {
+	_, err := os.Stat(systemdUnitFile)
+	return err == nil
+}
+
+// canInstallService tells whether the service can be installed on this
+// host: a Linux host running systemd, and root privileges
+func canInstallService() bool {
+	if runtime.GOOS != "linux" {
+		return false
+	}
+	if _, err := os.Stat("/run/systemd/system"); err != nil {
+		fmt.Fprintln(textOut, "systemd isn't running, the service can't be installed.")
+		return false
+	}
+	if os.Geteuid() != 0 {
+		fmt.Fprintln(textOut, "Run setup as root to install the service.")
+		return false
+	}
+	return true
+}
+
+// installService writes the unit of the agent and enables it. The agent runs
+// as the dedicated user of install.sh when it exists, as root otherwise.
+func installService() error {
+	execPath, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	var account string
+	if _, err := user.Lookup(systemdUser); err == nil {
+		account = fmt.Sprintf("User=%s\nGroup=%s\n", systemdUser, systemdGroup)
+	}
+	unit := fmt.Sprintf(`[Unit]
+Description=%s daemon
+After=network.target
+
+[Service]
+Type=simple
+ExecStart=%s start
+Restart=always
+%s# Prevent gaining any further privileges
+NoNewPrivileges=yes
+# Mount /usr, /boot, /etc read-only
+ProtectSystem=full
+# Isolate /home, /root, /run/user
+ProtectHome=yes
+# Private /tmp and /var/tmp
+PrivateTmp=true
+
+[Install]
+WantedBy=multi-user.target
+`, systemdService, execPath, account)
+	if err := os.WriteFile(systemdUnitFile, []byte(unit), 0644); err != nil {
+		return err
+	}
+	for _, args := range [][]string{{"daemon-reload"}, {"enable", systemdService}} {
+		if out, err := exec.Command("systemctl", args...).CombinedOutput(); err != nil {
+			return fmt.Errorf("systemctl %s: %w: %s", strings.Join(args, " "), err, strings.TrimSpace(string(out)))
+		}
+	}
+	return nil
+}
+
+// prompter asks the questions of setup. The defaults are taken without
+// asking with --yes or when stdin isn't a terminal, e.g. in a provisioning
+// script.
+type prompter struct {
+	in          *bufio.Reader
+	interactive bool
+}
+
+func newPrompter(in *os.File, yes bool) *prompter {
+	interactive := !yes && !jsonOutput()
+	if info, err := in.Stat(); err != nil || info.Mode()&os.ModeCharDevice == 0 {
+		interactive = false
+	}
+	return &prompter{in: bufio.NewReader(in), interactive: interactive}
+}
+
+// ask returns the answer to a question, def when it's left empty
+func (p *prompter) ask(question, def string) string {
+	if !p.interactive {
+		return def
+	}
+	if def != "" {
+		fmt.Fprintf(textOut, "%s [%s]: ", question, def)
+	} else {
+		fmt.Fprintf(textOut, "%s: ", question)
+	}
+	line, err := p.in.ReadString('\n')
+	if err != nil && err != io.EOF {
+		return def
+	}
+	if answer := strings.TrimSpace(line); answer != "" {
+		return answer
+	}
+	return def
+}
+
+// confirm asks a yes/no question
+func (p *prompter) confirm(question string, def bool) bool {
+	choices := "y/N"
+	if def {
+		choices = "Y/n"
+	}
+	switch strings.ToLower(p.ask(question+" ("+choices+")", "")) {
+	case "y", "yes":
+		return true
+	case "n", "no":
+		return false
+	}
+	return def
+}
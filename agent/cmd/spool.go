@@ -0,0 +1,96 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"agent/internal/config"
+	"agent/internal/exporter"
+	"agent/internal/logger"
+)
+
+var (
+	estimateSizeMB      int
+	estimateOutageHours float64
+)
+
+var spoolCmd = &cobra.Command{
+	Use:   "spool",
+	Short: "Manage the spool of payloads waiting to be exported",
+}
+
+var spoolEstimateCmd = &cobra.Command{
+	Use:   "estimate",
+	Short: "Estimate the backend outage the spool can absorb",
+	Long: `Estimate the backend outage the spool can absorb at the rates measured by
+the agent, with the spool settings of the config or the ones given as flags.
+
+	Examples:
+		simob spool estimate                   # Current settings
+		simob spool estimate --size-mb 2048    # Outage absorbed by a 2 GB spool
+	`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		logger.Init(os.Getenv("DEBUG") == "1")
+
+		spoolCfg := config.NewConfig("").Spool
+		if estimateSizeMB > 0 {
+			spoolCfg.MaxSizeMB = estimateSizeMB
+		}
+		if estimateOutageHours > 0 {
+			spoolCfg.OutageHours = estimateOutageHours
+		}
+		estimate, err := exporter.EstimateSpool(spoolCfg)
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(textOut, "Spool size: %s, outage to absorb: %s\n", formatSize(estimate.MaxBytes), formatHours(estimate.Outage))
+		w := tabwriter.NewWriter(textOut, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "STREAM\tRATE\tQUOTA\tBACKLOG\tOUTAGE ABSORBED")
+		for _, s := range estimate.Streams {
+			capacity := "unknown"
+			if s.Capacity > 0 {
+				capacity = formatHours(s.Capacity)
+			}
+			fmt.Fprintf(w, "%s\t%s/h\t%s\t%s\t%s\n", s.Stream, formatSize(int64(s.Rate*3600)), formatSize(s.Quota), formatSize(s.Backlog), capacity)
+		}
+		w.Flush()
+
+		if estimate.Needed > estimate.MaxBytes {
+			fmt.Fprintf(textOut, "%s[✘]%s The spool is too small, %s are needed to absorb %s of outage (spool.max_size_mb).\n",
+				ColorRed, ColorReset, formatSize(estimate.Needed), formatHours(estimate.Outage))
+		} else {
+			fmt.Fprintf(textOut, "%s[✓]%s The spool absorbs %s of outage, %s are needed.\n",
+				ColorGreen, ColorReset, formatHours(estimate.Outage), formatSize(estimate.Needed))
+		}
+		return nil
+	},
+}
+
+func formatSize(bytes int64) string {
+	switch {
+	case bytes >= 1<<30:
+		return fmt.Sprintf("%.1f GB", float64(bytes)/(1<<30))
+	case bytes >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(bytes)/(1<<20))
+	case bytes >= 1<<10:
+		return fmt.Sprintf("%.1f KB", float64(bytes)/(1<<10))
+	default:
+		return fmt.Sprintf("%d B", bytes)
+	}
+}
+
+func formatHours(d time.Duration) string {
+	return fmt.Sprintf("%.1fh", d.Hours())
+}
+
+func init() {
+	spoolEstimateCmd.Flags().IntVar(&estimateSizeMB, "size-mb", 0, "Spool size to estimate instead of spool.max_size_mb")
+	spoolEstimateCmd.Flags().Float64Var(&estimateOutageHours, "outage-hours", 0, "Outage to absorb instead of spool.outage_hours")
+	spoolCmd.AddCommand(spoolEstimateCmd)
+	rootCmd.AddCommand(spoolCmd)
+}
@@ -1,23 +1,64 @@
 package cmd
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/spf13/cobra"
 
+	"agent/internal/api"
 	"agent/internal/common"
 	"agent/internal/config"
+	"agent/internal/hostinfo"
+	"agent/internal/identity"
 	"agent/internal/logger"
 	"agent/internal/manager"
 )
 
-var dryRun bool
+var (
+	dryRun           bool
+	dryRunDuration   time.Duration
+	dryRunInterval   time.Duration
+	dryRunCollectors []string
+	dryRunFormat     string
+	skipSteps        []string
+	noRegister       bool
+	registerOnly     bool
+	hostRoot         string
+)
 
 var startCmd = &cobra.Command{
 	Use:   "start",
 	Short: "Start metrics and logs collection agent",
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		if !slices.Contains(manager.DryRunFormats, dryRunFormat) {
+			return fmt.Errorf("%w: format %q must be one of %s", errUsage, dryRunFormat, strings.Join(manager.DryRunFormats, ", "))
+		}
+		if dryRunDuration <= 0 || dryRunInterval <= 0 {
+			return fmt.Errorf("%w: duration and interval must be positive", errUsage)
+		}
+		if noRegister && registerOnly {
+			return fmt.Errorf("%w: --no-register and --register-only can't be combined", errUsage)
+		}
+		// Before the collectors are created
+		common.SetHostRoot(hostRoot)
+		if noRegister {
+			// E.g. images baked with the agent, the instances register
+			// once started without the flag
+			skipSteps = append(skipSteps, "hostinfo", "discovery")
+		}
+		if err := validateSkipSteps(skipSteps); err != nil {
+			return fmt.Errorf("%w: %w", errUsage, err)
+		}
+		return nil
+	},
 	Run: func(cmd *cobra.Command, args []string) {
 		Start()
 	},
@@ -25,6 +66,14 @@ var startCmd = &cobra.Command{
 
 func init() {
 	startCmd.Flags().BoolVar(&dryRun, "dry-run", false, "Start a short dry run where collected data is redirected to stdout")
+	startCmd.Flags().DurationVar(&dryRunDuration, "duration", 20*time.Second, "How long the dry run collects")
+	startCmd.Flags().DurationVar(&dryRunInterval, "interval", 3*time.Second, "Metrics collection interval of the dry run")
+	startCmd.Flags().StringSliceVar(&dryRunCollectors, "collectors", nil, "Collectors to run during the dry run, all by default")
+	startCmd.Flags().StringVar(&dryRunFormat, "format", manager.DryRunJSON, "Dry run format: json, table, summary or estimate")
+	startCmd.Flags().StringSliceVar(&skipSteps, "skip-step", nil, "Skip an optional start step (identity, hostinfo, discovery)")
+	startCmd.Flags().BoolVar(&noRegister, "no-register", false, "Start without reporting the host info and the available metrics and log sources")
+	startCmd.Flags().BoolVar(&registerOnly, "register-only", false, "Report the host info and the available metrics and log sources, then exit")
+	startCmd.Flags().StringVar(&hostRoot, "host-root", "", "Where the host filesystem is mounted when running in a container, e.g. /host in a Kubernetes DaemonSet")
 }
 
 func Start() {
@@ -34,44 +83,257 @@ func Start() {
 		return
 	}
 
+	if registerOnly {
+		os.Exit(register())
+	}
+
 	// Create and run the agent
 	agent, err := initializeAndLoadAgent()
+	if errors.Is(err, errRegistrationDeferred) {
+		os.Exit(ExitOK)
+	}
 	if err != nil {
-		os.Exit(1)
+		os.Exit(errorExitCode(err))
 	}
-	agent.Run(dryRun)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	code := exitCode(agent.Run(ctx))
+	stop()
+	os.Exit(code)
 }
 
-func initializeAndLoadAgent() (*manager.Agent, error) {
-	// Initialize logger
-	debug := os.Getenv("DEBUG") == "1"
-	logger.Init(debug)
-	logger.Log.Info("Starting agent...")
-	logger.Log.Debug("DEBUG mode is enabled. Expect verbose logging.")
+// exitCode releases the process lock once the agent stopped and returns the
+// exit code for the error returned by Run. This is the only place where the
+// agent exits after having started.
+func exitCode(err error) int {
+	common.ReleaseLock()
+	switch {
+	case err == nil:
+		return ExitOK
+	case errors.Is(err, manager.ErrRestart):
+		logger.Log.Info("Agent stopped for restart. Automatic restart will only happen if running under systemd.")
+		return ExitFailure
+	default:
+		logger.Log.Error("agent stopped", "error", err)
+		return ExitFailure
+	}
+}
 
-	// Attempt to acquire a file lock to ensure only one instance is running.
-	if err := common.AcquireLock(); err != nil {
-		if errors.Is(err, common.ErrAlreadyRunning) {
-			logger.Log.Info("Another instance of agent is already running")
-			return nil, err
+// register runs the steps needed to register the host, without starting the
+// agent, and returns the exit code
+func register() int {
+	state := &startState{}
+	for _, step := range startSteps {
+		if step.run == nil || step.name == "lock" || step.name == "hostinfo" {
+			continue
+		}
+		if err := step.run(state); err != nil {
+			if errors.Is(err, errRegistrationDeferred) {
+				logger.Log.Info("Not registering the machine the image is prepared on")
+				return ExitOK
+			}
+			if step.optional {
+				logger.Log.Warn("start step failed, continuing", "step", step.name, "error", err)
+				continue
+			}
+			logger.Log.Error("failed to register", "step", step.name, "error", err)
+			return errorExitCode(err)
 		}
-		logger.Log.Error("failed to acquire process lock", "error", err)
-		return nil, err
 	}
+	// A rejected key is told apart from a backend refusing the registration
+	valid, err := api.NewClient(*state.cfg, false).CheckAPIKeyValidity()
+	if err == nil && !valid {
+		logger.Log.Error("failed to register", "error", errInvalidKey)
+		return ExitInvalidKey
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if err := manager.Register(ctx, state.cfg); err != nil {
+		logger.Log.Error("failed to register", "error", err)
+		return ExitFailure
+	}
+	logger.Log.Info("Host registered")
+	return ExitOK
+}
 
-	// Load config
-	cfg, err := config.Load()
-	if err != nil {
-		logger.Log.Error("failed to load config", "error", err)
-		return nil, err
+// startState is what the start steps build up
+type startState struct {
+	cfg    *config.Config
+	locked bool
+	// opts are the options of the agent set by the steps
+	opts []manager.Option
+}
+
+// gatherHostInfo is a variable so tests can replace it
+var gatherHostInfo = hostinfo.Gather
+
+// errRegistrationDeferred stops the start on the machine an image is being
+// prepared on
+var errRegistrationDeferred = errors.New("registration deferred to the first boot of the instance")
+
+// startStep is one named step of the agent initialization. Required steps stop
+// the initialization when they fail, optional ones only log a warning and can
+// be skipped with --skip-step. A failed optional step is then handled as
+// skipped. Steps without run are phases of the running agent, turned off by
+// skip.
+type startStep struct {
+	name     string
+	optional bool
+	run      func(*startState) error
+	skip     func(*startState)
+}
+
+var startSteps = []startStep{
+	{name: "logger", run: func(*startState) error {
+		debug := os.Getenv("DEBUG") == "1"
+		logger.Init(debug)
+		logger.Log.Info("Starting agent...")
+		logger.Log.Debug("DEBUG mode is enabled. Expect verbose logging.")
+		return nil
+	}},
+	// Attempt to acquire a file lock to ensure only one instance is running.
+	{name: "lock", run: func(s *startState) error {
+		switch err := common.AcquireLock(); {
+		case errors.Is(err, common.ErrAlreadyRunning):
+			return err
+		case err != nil:
+			return fmt.Errorf("%w: %w", errLock, err)
+		}
+		s.locked = true
+		return nil
+	}},
+	{name: "config", run: func(s *startState) error {
+		cfg, err := config.Load()
+		if err != nil {
+			return fmt.Errorf("%w: failed to load config: %w", errNoConfig, err)
+		}
+		if cfg.APIKey == "" {
+			return fmt.Errorf("%w: missing API key in config", errNoConfig)
+		}
+		s.cfg = cfg
+		return nil
+	}},
+	// An agent baked into a machine image waits for the first boot of the
+	// instance to resolve its identity, validate its key and register.
+	{name: "deferred-registration", run: func(*startState) error {
+		deferred, err := identity.RegistrationDeferred()
+		if err != nil {
+			return fmt.Errorf("failed to check the deferred registration: %w", err)
+		}
+		if deferred {
+			return errRegistrationDeferred
+		}
+		return nil
+	}},
+	// Resolve host identity. The agent still works without it, the backend
+	// then falls back to identifying the host by its API key.
+	{name: "identity", optional: true, run: func(s *startState) error {
+		hostID, err := identity.Resolve(s.cfg.HostIDSource)
+		if err != nil {
+			return fmt.Errorf("failed to resolve host ID from %s: %w", s.cfg.HostIDSource, err)
+		}
+		if hostID, err = identity.CheckClone(hostID); err != nil {
+			logger.Log.Warn("Failed to check whether the host was cloned", "error", err)
+		}
+		s.cfg.HostID = hostID
+		logger.Log.Debug("Resolved host ID", "host_id", hostID)
+		return nil
+	}},
+	// Gather the host info reported to the backend with each discovery.
+	// Without it, the host is only known by its ID.
+	{name: "hostinfo", optional: true, run: func(s *startState) error {
+		info, err := gatherHostInfo()
+		if err != nil {
+			// Unlike a skipped step, the host info is still reported: the
+			// discovery gathers it again
+			logger.Log.Warn("Failed to gather host info, retrying with the discovery", "error", err)
+			return nil
+		}
+		logger.Log.Debug("Gathered host info", "hostname", info.Hostname, "platform", info.Platform)
+		s.opts = append(s.opts, manager.WithHostInfo(info))
+		return nil
+	}, skip: func(s *startState) {
+		s.opts = append(s.opts, manager.WithoutHostInfo())
+	}},
+	// Advertise the available metrics and log sources, the backend keeps
+	// the last ones advertised when skipped.
+	{name: "discovery", optional: true, skip: func(s *startState) {
+		s.opts = append(s.opts, manager.WithoutDiscovery())
+	}},
+}
+
+// validateSkipSteps checks that the steps exist and can be skipped
+func validateSkipSteps(names []string) error {
+	for _, name := range names {
+		i := slices.IndexFunc(startSteps, func(step startStep) bool { return step.name == name })
+		if i < 0 {
+			return fmt.Errorf("unknown start step %q", name)
+		}
+		if !startSteps[i].optional {
+			return fmt.Errorf("start step %q is required and can't be skipped", name)
+		}
 	}
-	if cfg.APIKey == "" {
-		err = fmt.Errorf("missing API key in config")
-		logger.Log.Error("failed to start agent", "error", err)
+	return nil
+}
+
+func initializeAndLoadAgent() (*manager.Agent, error) {
+	state := &startState{}
+	if err := runStartSteps(startSteps, state, skipSteps); err != nil {
 		return nil, err
 	}
 
 	// Create the agent
-	agent := manager.NewAgent(cfg)
+	opts := append([]manager.Option{manager.WithConfig(state.cfg), manager.WithDryRun(dryRun)}, state.opts...)
+	if dryRun {
+		opts = append(opts,
+			manager.WithDryRunDuration(dryRunDuration),
+			manager.WithDryRunInterval(dryRunInterval),
+			manager.WithDryRunOutput(dryRunFormat),
+			manager.WithCollectors(dryRunCollectors...),
+		)
+	}
+	agent := manager.New(opts...)
 	return agent, nil
 }
+
+// runStartSteps runs the steps in order, except the ones named in skip. It
+// stops at the first required step that fails, releasing the lock if it was
+// acquired.
+func runStartSteps(steps []startStep, state *startState, skip []string) error {
+	for _, step := range steps {
+		if slices.Contains(skip, step.name) {
+			logger.Log.Info("Skipping start step", "step", step.name)
+			if step.skip != nil {
+				step.skip(state)
+			}
+			continue
+		}
+		if step.run == nil {
+			continue
+		}
+		err := step.run(state)
+		switch {
+		case err == nil:
+		case step.optional:
+			logger.Log.Warn("start step failed, continuing", "step", step.name, "error", err)
+			if step.skip != nil {
+				step.skip(state)
+			}
+		case errors.Is(err, common.ErrAlreadyRunning):
+			logger.Log.Info("Another instance of agent is already running")
+			return err
+		case errors.Is(err, errRegistrationDeferred):
+			logger.Log.Info("Not starting on the machine the image is prepared on, the agent starts on the next boot")
+			if state.locked {
+				common.ReleaseLock()
+			}
+			return err
+		default:
+			logger.Log.Error("failed to start agent", "step", step.name, "error", err)
+			if state.locked {
+				common.ReleaseLock()
+			}
+			return err
+		}
+	}
+	return nil
+}
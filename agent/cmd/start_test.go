@@ -0,0 +1,84 @@
+package cmd
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"agent/internal/hostinfo"
+	"agent/internal/logger"
+)
+
+func init() {
+	logger.Log = slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+func TestStartStepsOrder(t *testing.T) {
+	var names []string
+	for _, step := range startSteps {
+		names = append(names, step.name)
+	}
+	// The identity is resolved from the config, and the host info is
+	// reported with it
+	assert.Equal(t, []string{"logger", "lock", "config", "deferred-registration", "identity", "hostinfo", "discovery"}, names)
+}
+
+func TestRunStartSteps(t *testing.T) {
+	var ran, skipped []string
+	step := func(name string, optional bool, err error) startStep {
+		return startStep{
+			name:     name,
+			optional: optional,
+			run: func(*startState) error {
+				ran = append(ran, name)
+				return err
+			},
+			skip: func(*startState) { skipped = append(skipped, name) },
+		}
+	}
+	failed := errors.New("failed")
+	steps := []startStep{
+		step("first", false, nil),
+		step("skipped", true, nil),
+		step("optional", true, failed),
+		step("required", false, failed),
+		step("last", false, nil),
+	}
+
+	err := runStartSteps(steps, &startState{}, []string{"skipped"})
+	assert.ErrorIs(t, err, failed)
+	// A failed optional step is handled as skipped, a failed required one
+	// stops the start
+	assert.Equal(t, []string{"first", "optional", "required"}, ran)
+	assert.Equal(t, []string{"skipped", "optional"}, skipped)
+}
+
+func TestHostInfoStep(t *testing.T) {
+	defer func(gather func() (*hostinfo.HostInfo, error)) { gatherHostInfo = gather }(gatherHostInfo)
+	i := slices.IndexFunc(startSteps, func(step startStep) bool { return step.name == "hostinfo" })
+	require.GreaterOrEqual(t, i, 0)
+	steps := startSteps[i : i+1]
+
+	// The gathered host info is passed to the agent
+	gatherHostInfo = func() (*hostinfo.HostInfo, error) { return &hostinfo.HostInfo{Hostname: "web-1"}, nil }
+	state := &startState{}
+	require.NoError(t, runStartSteps(steps, state, nil))
+	assert.Len(t, state.opts, 1)
+
+	// A failure doesn't turn off the host info, the discovery gathers it
+	// again
+	gatherHostInfo = func() (*hostinfo.HostInfo, error) { return nil, errors.New("no uname") }
+	state = &startState{}
+	require.NoError(t, runStartSteps(steps, state, nil))
+	assert.Empty(t, state.opts)
+
+	// Unlike skipping it
+	state = &startState{}
+	require.NoError(t, runStartSteps(steps, state, []string{"hostinfo"}))
+	assert.Len(t, state.opts, 1)
+}
@@ -4,6 +4,7 @@
 package cmd
 
 import (
+	"context"
 	"time"
 
 	"golang.org/x/sys/windows/svc"
@@ -17,6 +18,8 @@ const serviceName = "simob"
 type windowsService struct {
 	agent  *manager.Agent
 	doneCh chan struct{}
+	// exitCode is set when the agent stops, before doneCh is closed
+	exitCode int
 }
 
 func isWindowsService() bool {
@@ -61,21 +64,33 @@ func (ws *windowsService) Execute(args []string, r <-chan svc.ChangeRequest, cha
 	changes <- svc.Status{State: svc.Running, Accepts: cmdsAccepted}
 
 	// Main service loop
-	for c := range r {
-		switch c.Cmd {
-		case svc.Interrogate:
-			changes <- c.CurrentStatus
-		case svc.Stop, svc.Shutdown:
-			changes <- svc.Status{State: svc.StopPending}
-			ws.stopAgent()
+	for {
+		select {
+		case c, ok := <-r:
+			if !ok {
+				// Channel closed, stop the service
+				changes <- svc.Status{State: svc.Stopped}
+				return false, 0
+			}
+			switch c.Cmd {
+			case svc.Interrogate:
+				changes <- c.CurrentStatus
+			case svc.Stop, svc.Shutdown:
+				changes <- svc.Status{State: svc.StopPending}
+				ws.stopAgent()
+				changes <- svc.Status{State: svc.Stopped}
+				return false, 0
+			}
+		case <-ws.doneCh:
+			// The agent stopped by itself, a non zero exit code lets the
+			// service recovery options restart it
 			changes <- svc.Status{State: svc.Stopped}
+			if ws.exitCode != 0 {
+				return true, uint32(ws.exitCode)
+			}
 			return false, 0
 		}
 	}
-
-	// If we exit the loop (channel closed), stop the service
-	changes <- svc.Status{State: svc.Stopped}
-	return false, 0
 }
 
 func (ws *windowsService) startAgent() error {
@@ -89,7 +104,7 @@ func (ws *windowsService) startAgent() error {
 
 	// Run the agent in a goroutine
 	go func() {
-		ws.agent.Run(false)
+		ws.exitCode = exitCode(ws.agent.Run(context.Background()))
 		close(ws.doneCh)
 	}()
 
@@ -100,15 +115,14 @@ func (ws *windowsService) stopAgent() {
 	if ws.agent != nil {
 		logger.Log.Info("Stopping agent...")
 
-		// Trigger graceful shutdown
-		ws.agent.Stop()
-
-		// Wait for agent to finish with timeout
-		select {
-		case <-ws.doneCh:
-			logger.Log.Info("Agent stopped gracefully")
-		case <-time.After(30 * time.Second):
+		// Trigger graceful shutdown and wait for agent to finish with timeout
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if err := ws.agent.Shutdown(ctx); err != nil {
 			logger.Log.Warn("Agent shutdown timed out after 30 seconds")
+			return
 		}
+		<-ws.doneCh
+		logger.Log.Info("Agent stopped gracefully")
 	}
 }
@@ -2,10 +2,14 @@ package cmd
 
 import (
 	"fmt"
+	"text/tabwriter"
+	"time"
 
 	"github.com/spf13/cobra"
 
+	"agent/internal/admin"
 	"agent/internal/common"
+	"agent/internal/exporter"
 )
 
 // ANSI escape codes for colors
@@ -21,14 +25,63 @@ var statusCmd = &cobra.Command{
 	Run: func(cmd *cobra.Command, args []string) {
 		isLocked, err := common.IsLockAcquired()
 		if err != nil {
-			fmt.Printf("Error checking agent status: %v\n", err)
-			return
+			exitWithError(fmt.Errorf("%w: error checking agent status: %w", errLock, err))
 		}
 
+		if jsonOutput() {
+			result := statusResult{Running: isLocked}
+			if isLocked {
+				result.Pipelines = pipelines()
+			}
+			printResult(result)
+			return
+		}
 		if isLocked {
-			fmt.Printf("%s[✓]%s simob is running.\n", ColorGreen, ColorReset)
+			fmt.Fprintf(textOut, "%s[✓]%s simob is running.\n", ColorGreen, ColorReset)
+			printPipelines()
 		} else {
-			fmt.Printf("%s[✘]%s simob is not running.\n", ColorRed, ColorReset)
+			fmt.Fprintf(textOut, "%s[✘]%s simob is not running.\n", ColorRed, ColorReset)
 		}
 	},
 }
+
+// statusResult is printed by simob status --output json
+type statusResult struct {
+	Running   bool                     `json:"running"`
+	Pipelines []exporter.PipelineStats `json:"pipelines,omitempty"`
+}
+
+// pipelines returns the state of the exports of the running agent, nil when
+// the agent can't be asked, e.g. an older version
+func pipelines() []exporter.PipelineStats {
+	resp, err := admin.Send(admin.Request{Command: admin.Status}, 2*time.Second)
+	if err != nil {
+		return nil
+	}
+	return resp.Pipelines
+}
+
+// printPipelines prints the state of the exports of the running agent. It
+// prints nothing when the agent can't be asked, e.g. an older version.
+func printPipelines() {
+	stats := pipelines()
+	if len(stats) == 0 {
+		return
+	}
+	fmt.Fprintln(textOut)
+	w := tabwriter.NewWriter(textOut, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "STREAM\tBACKLOG\tENTRIES\tOLDEST\tLAST BATCH\tFLUSH\tFAILURES\tLAST SUCCESS")
+	for _, p := range stats {
+		lastSuccess := "never"
+		if !p.LastSuccess.IsZero() {
+			lastSuccess = time.Since(p.LastSuccess).Round(time.Second).String() + " ago"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%d\t%s\t%d\t%s\n", p.Stream, formatSize(p.BacklogBytes), p.BacklogEntries,
+			formatSeconds(p.OldestEntryAge), p.LastBatchSize, formatSeconds(p.FlushDuration), p.ConsecutiveFailures, lastSuccess)
+	}
+	w.Flush()
+}
+
+func formatSeconds(seconds float64) string {
+	return time.Duration(seconds * float64(time.Second)).Round(time.Millisecond).String()
+}
@@ -2,21 +2,41 @@ package cmd
 
 import (
 	"fmt"
-	"os"
 
 	"github.com/spf13/cobra"
 
 	"agent/internal/updater"
 )
 
+var (
+	forceUpdate    bool
+	rollbackUpdate bool
+	updateFile     string
+	updateChecksum string
+)
+
 var updateCmd = &cobra.Command{
 	Use:   "update",
 	Short: "Update simob agent",
 	Run: func(cmd *cobra.Command, args []string) {
-		error := updater.Update()
-		if error != nil {
-			fmt.Printf("Update failed: %v\n", error)
-			os.Exit(1)
+		if rollbackUpdate {
+			if err := updater.Rollback(); err != nil {
+				exitWithError(fmt.Errorf("rollback failed: %w", err))
+			}
+			printResult(map[string]bool{"rolled_back": true})
+			return
+		}
+		result, err := updater.Update(updater.Options{Force: forceUpdate, FromFile: updateFile, Checksum: updateChecksum})
+		if err != nil {
+			exitWithError(fmt.Errorf("update failed: %w", err))
 		}
+		printResult(result)
 	},
 }
+
+func init() {
+	updateCmd.Flags().BoolVar(&forceUpdate, "force", false, "Update without waiting for the running agent to flush its spool")
+	updateCmd.Flags().BoolVar(&rollbackUpdate, "rollback", false, "Restore the binary replaced by the last update")
+	updateCmd.Flags().StringVar(&updateFile, "from-file", "", "Install a binary copied to this host instead of downloading it, for air-gapped hosts")
+	updateCmd.Flags().StringVar(&updateChecksum, "checksum", "", "SHA256 of the --from-file binary, read from the checksums file next to it by default")
+}
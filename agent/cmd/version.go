@@ -12,6 +12,10 @@ var versionCmd = &cobra.Command{
 	Use:   "version",
 	Short: "Display simob agent version",
 	Run: func(cmd *cobra.Command, args []string) {
-		fmt.Printf("simob agent version: %s\n", version.Version)
+		if jsonOutput() {
+			printResult(map[string]string{"version": version.Version})
+			return
+		}
+		fmt.Fprintf(textOut, "simob agent version: %s\n", version.Version)
 	},
 }
@@ -0,0 +1,194 @@
+// Package admin is the local control channel of a running agent. The agent
+// listens on a Unix socket in its program directory, so that the CLI (update,
+// config) coordinates with it instead of changing files under its feet. Like
+// the restart file, it's restricted to the users of the program directory
+// group.
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+
+	"agent/internal/common"
+	"agent/internal/exporter"
+	"agent/internal/logger"
+)
+
+const socketFileName = "admin.sock"
+
+// Commands understood by the agent
+const (
+	// Drain stops the collection, flushes the spool and saves the log
+	// positions. The agent stays drained until Resume, Restart or the hold
+	// duration elapses.
+	Drain = "drain"
+	// Resume restarts the collection after a Drain
+	Resume = "resume"
+	// Restart stops the agent to be restarted by the service manager
+	Restart = "restart"
+	// Reload applies the saved config. The agent restarts when the API or
+	// the host identity settings changed.
+	Reload = "reload"
+	// Status returns the state of the export pipelines
+	Status = "status"
+)
+
+// ErrNotRunning is returned by Send when no agent listens on the socket
+var ErrNotRunning = errors.New("agent not running")
+
+// Request is a command sent to the agent, one per connection
+type Request struct {
+	Command string `json:"command"`
+}
+
+// Response is the answer of the agent to a request
+type Response struct {
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+	// BacklogBytes is the size of the spool left after a Drain
+	BacklogBytes int64 `json:"backlog_bytes,omitempty"`
+	// Restarting is set when a Reload needs a restart
+	Restarting bool `json:"restarting,omitempty"`
+	// Pipelines is the state of the exports, answered to Status
+	Pipelines []exporter.PipelineStats `json:"pipelines,omitempty"`
+}
+
+// Handler executes a request. ctx is done when the client gives up.
+type Handler func(ctx context.Context, req Request) Response
+
+// Server accepts the requests of the CLI
+type Server struct {
+	listener net.Listener
+	handler  Handler
+	path     string
+	wg       sync.WaitGroup
+}
+
+// Listen starts serving the requests on the admin socket of the program
+// directory.
+func Listen(handler Handler) (*Server, error) {
+	path, err := socketPath()
+	if err != nil {
+		return nil, err
+	}
+	return listen(path, handler)
+}
+
+func listen(path string, handler Handler) (*Server, error) {
+	// A socket left by a previous run prevents listening, the process lock
+	// guarantees it's not in use
+	if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("failed to remove stale admin socket: %w", err)
+	}
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on admin socket: %w", err)
+	}
+	if err := os.Chmod(path, 0o660); err != nil {
+		logger.Log.Debug("Could not set admin socket permissions", "error", err)
+	}
+	s := &Server{listener: listener, handler: handler, path: path}
+	s.wg.Add(1)
+	go s.serve()
+	return s, nil
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				logger.Log.Error("admin socket stopped accepting connections", "error", err)
+			}
+			return
+		}
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.handle(conn)
+		}()
+	}
+}
+
+func (s *Server) handle(conn net.Conn) {
+	defer conn.Close()
+
+	var req Request
+	if err := json.NewDecoder(conn).Decode(&req); err != nil {
+		logger.Log.Debug("Invalid admin request", "error", err)
+		return
+	}
+	logger.Log.Info("Admin command received", "command", req.Command)
+
+	// The client closing the connection cancels the request
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		_, _ = conn.Read(make([]byte, 1))
+		cancel()
+	}()
+
+	resp := s.handler(ctx, req)
+	if err := json.NewEncoder(conn).Encode(resp); err != nil {
+		logger.Log.Debug("failed to answer admin request", "error", err)
+	}
+}
+
+// Close stops listening and waits for the requests in progress.
+func (s *Server) Close() {
+	_ = s.listener.Close()
+	s.wg.Wait()
+	_ = os.Remove(s.path)
+}
+
+// Send sends a request to the running agent and waits for its response, at
+// most timeout. It returns ErrNotRunning when no agent listens.
+func Send(req Request, timeout time.Duration) (Response, error) {
+	path, err := socketPath()
+	if err != nil {
+		return Response{}, err
+	}
+	return send(path, req, timeout)
+}
+
+func send(path string, req Request, timeout time.Duration) (Response, error) {
+	conn, err := net.DialTimeout("unix", path, timeout)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) || errors.Is(err, syscall.ECONNREFUSED) {
+			return Response{}, ErrNotRunning
+		}
+		return Response{}, fmt.Errorf("failed to connect to the agent: %w", err)
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(timeout))
+
+	if err := json.NewEncoder(conn).Encode(req); err != nil {
+		return Response{}, fmt.Errorf("failed to send %s to the agent: %w", req.Command, err)
+	}
+	var resp Response
+	if err := json.NewDecoder(conn).Decode(&resp); err != nil {
+		return Response{}, fmt.Errorf("no response from the agent to %s: %w", req.Command, err)
+	}
+	if !resp.OK {
+		return resp, fmt.Errorf("agent failed to %s: %s", req.Command, resp.Error)
+	}
+	return resp, nil
+}
+
+func socketPath() (string, error) {
+	programDir, err := common.GetProgramDirectory()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(programDir, socketFileName), nil
+}
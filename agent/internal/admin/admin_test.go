@@ -0,0 +1,60 @@
+package admin
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"agent/internal/logger"
+)
+
+func init() {
+	logger.Log = slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+func TestSendAndServe(t *testing.T) {
+	path := filepath.Join(t.TempDir(), socketFileName)
+
+	_, err := send(path, Request{Command: Drain}, time.Second)
+	assert.ErrorIs(t, err, ErrNotRunning)
+
+	srv, err := listen(path, func(ctx context.Context, req Request) Response {
+		if req.Command == Drain {
+			return Response{OK: true, BacklogBytes: 42}
+		}
+		return Response{Error: "unknown command"}
+	})
+	require.NoError(t, err)
+
+	resp, err := send(path, Request{Command: Drain}, time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, int64(42), resp.BacklogBytes)
+
+	_, err = send(path, Request{Command: "reboot"}, time.Second)
+	assert.ErrorContains(t, err, "unknown command")
+
+	srv.Close()
+	assert.NoFileExists(t, path)
+	_, err = send(path, Request{Command: Drain}, time.Second)
+	assert.ErrorIs(t, err, ErrNotRunning)
+}
+
+func TestSendTimeout(t *testing.T) {
+	path := filepath.Join(t.TempDir(), socketFileName)
+	srv, err := listen(path, func(ctx context.Context, req Request) Response {
+		// Cancelled when the client gives up
+		<-ctx.Done()
+		return Response{}
+	})
+	require.NoError(t, err)
+	defer srv.Close()
+
+	_, err = send(path, Request{Command: Drain}, 50*time.Millisecond)
+	assert.Error(t, err)
+}
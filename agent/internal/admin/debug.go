@@ -0,0 +1,117 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"sync"
+	"time"
+
+	"agent/internal/logger"
+	"agent/internal/version"
+)
+
+// DefaultDebugAddress is where the debug endpoint listens when it's started
+// by a signal without an address in the config
+const DefaultDebugAddress = "127.0.0.1:6060"
+
+// RuntimeStats is the state of the Go runtime served on /debug/runtime
+type RuntimeStats struct {
+	Version        string  `json:"version"`
+	GoVersion      string  `json:"go_version"`
+	Goroutines     int     `json:"goroutines"`
+	GOMAXPROCS     int     `json:"gomaxprocs"`
+	HeapAllocBytes uint64  `json:"heap_alloc_bytes"`
+	HeapInuseBytes uint64  `json:"heap_inuse_bytes"`
+	HeapObjects    uint64  `json:"heap_objects"`
+	SysBytes       uint64  `json:"sys_bytes"`
+	NumGC          uint32  `json:"num_gc"`
+	GCPauseSeconds float64 `json:"gc_pause_total_seconds"`
+}
+
+// DebugServer serves net/http/pprof and the runtime stats on a loopback
+// address, to profile a memory leak or a goroutine pileup on a customer host
+// without a custom build. Unlike the admin socket it's unauthenticated, it
+// never listens on another interface.
+type DebugServer struct {
+	server   *http.Server
+	listener net.Listener
+	wg       sync.WaitGroup
+}
+
+// StartDebug starts serving the debug endpoint on address, which must be a
+// loopback address
+func StartDebug(address string) (*DebugServer, error) {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, fmt.Errorf("invalid debug address %q: %w", address, err)
+	}
+	if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+		return nil, fmt.Errorf("the debug endpoint only listens on a loopback address, not %q", address)
+	}
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen for the debug endpoint on %s: %w", address, err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.HandleFunc("GET /debug/runtime", handleRuntime)
+	s := &DebugServer{
+		server:   &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second},
+		listener: listener,
+	}
+	logger.Log.Info("Debug endpoint listening", "address", listener.Addr().String())
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		if err := s.server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Log.Error("Debug endpoint stopped", "error", err)
+		}
+	}()
+	return s, nil
+}
+
+// Address returns the address the endpoint listens on
+func (s *DebugServer) Address() string {
+	return s.listener.Addr().String()
+}
+
+// Close stops the endpoint. The profiles in progress are cut short.
+func (s *DebugServer) Close() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := s.server.Shutdown(ctx); err != nil {
+		_ = s.server.Close()
+	}
+	s.wg.Wait()
+	logger.Log.Info("Debug endpoint stopped")
+}
+
+func handleRuntime(w http.ResponseWriter, _ *http.Request) {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	stats := RuntimeStats{
+		Version:        version.Version,
+		GoVersion:      runtime.Version(),
+		Goroutines:     runtime.NumGoroutine(),
+		GOMAXPROCS:     runtime.GOMAXPROCS(0),
+		HeapAllocBytes: mem.HeapAlloc,
+		HeapInuseBytes: mem.HeapInuse,
+		HeapObjects:    mem.HeapObjects,
+		SysBytes:       mem.Sys,
+		NumGC:          mem.NumGC,
+		GCPauseSeconds: time.Duration(mem.PauseTotalNs).Seconds(),
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(stats)
+}
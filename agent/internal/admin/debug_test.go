@@ -0,0 +1,40 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDebugServer(t *testing.T) {
+	srv, err := StartDebug("127.0.0.1:0")
+	require.NoError(t, err)
+
+	resp, err := http.Get("http://" + srv.Address() + "/debug/runtime")
+	require.NoError(t, err)
+	var stats RuntimeStats
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&stats))
+	resp.Body.Close()
+	assert.Positive(t, stats.Goroutines)
+	assert.Positive(t, stats.HeapAllocBytes)
+
+	resp, err = http.Get("http://" + srv.Address() + "/debug/pprof/goroutine?debug=1")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	address := srv.Address()
+	srv.Close()
+	_, err = http.Get("http://" + address + "/debug/runtime")
+	assert.Error(t, err)
+}
+
+func TestDebugServerLoopbackOnly(t *testing.T) {
+	_, err := StartDebug("0.0.0.0:0")
+	assert.ErrorContains(t, err, "loopback")
+	_, err = StartDebug("6060")
+	assert.Error(t, err)
+}
@@ -0,0 +1,60 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"agent/internal/version"
+)
+
+// Features lists what the agent supports, reported to the backend in the
+// handshake
+var Features = []string{"gzip", "batch_sequence", "remote_write", "otlp_export", "pattern_bundles"}
+
+// Capabilities is the answer of the backend to the handshake: what it
+// accepts, so the agent doesn't have to assume it
+type Capabilities struct {
+	APIVersion string `json:"api_version"`
+	// Encodings are the Content-Encoding accepted by the export endpoints,
+	// e.g. gzip
+	Encodings []string `json:"encodings,omitempty"`
+	// Endpoints are the export URLs by stream, metrics or logs
+	Endpoints map[string]string `json:"endpoints,omitempty"`
+	Limits    Limits            `json:"limits"`
+}
+
+// Limits of the export endpoints, zero values mean no limit
+type Limits struct {
+	MaxBatchSize         int     `json:"max_batch_size,omitempty"`
+	MaxPayloadsPerSecond float64 `json:"max_payloads_per_second,omitempty"`
+}
+
+// GetCapabilities reports the version and features of the agent and returns
+// the capabilities of the backend. It returns nil without error when the
+// backend predates the handshake.
+func (c *Client) GetCapabilities() (*Capabilities, error) {
+	if c.dryRun {
+		return nil, nil
+	}
+
+	query := url.Values{"version": {version.Version}, "features": {strings.Join(Features, ",")}}
+	res, err := c.get("/capabilities/?" + query.Encode())
+	if err != nil {
+		var statusErr *StatusError
+		if errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	var caps Capabilities
+	if err := json.NewDecoder(res.Body).Decode(&caps); err != nil {
+		return nil, fmt.Errorf("failed to decode capabilities: %w", err)
+	}
+	return &caps, nil
+}
@@ -3,7 +3,9 @@ package api
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"strconv"
 	"time"
@@ -12,11 +14,47 @@ import (
 	"agent/internal/collection"
 	"agent/internal/config"
 	"agent/internal/hostinfo"
+	"agent/internal/identity"
 	"agent/internal/logger"
+	"agent/internal/transport"
 )
 
+// HostIDHeader carries the stable host identifier on every request.
+const HostIDHeader = "X-Host-Id"
+
+// HostIDConflictHeader is set by the backend on its answers when another
+// host reports data with the same host identifier.
+const HostIDConflictHeader = "X-Host-Id-Conflict"
+
+// StatusError is returned when the backend answers with an error status.
+type StatusError struct {
+	Method     string
+	Path       string
+	StatusCode int
+	Body       string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("%s %s failed: %s (status %d)", e.Method, e.Path, e.Body, e.StatusCode)
+}
+
+// IsTransient reports whether a request failing with err may succeed if sent
+// again: network errors, rate limiting and server errors.
+func IsTransient(err error) bool {
+	var throttledErr *ThrottledError
+	if errors.As(err, &throttledErr) {
+		return true
+	}
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode == http.StatusTooManyRequests || statusErr.StatusCode >= 500
+	}
+	return err != nil
+}
+
 type Client struct {
 	apiKey  string
+	hostID  string
 	baseURL string
 	client  *http.Client
 	dryRun  bool
@@ -25,24 +63,34 @@ type Client struct {
 func NewClient(cfg config.Config, dryRun bool) *Client {
 	return &Client{
 		apiKey:  cfg.APIKey,
+		hostID:  cfg.HostID,
 		baseURL: cfg.APIUrl,
 		client: &http.Client{
-			Timeout: 10 * time.Second,
+			Timeout:   10 * time.Second,
+			Transport: transport.Shared(),
 		},
 		dryRun: dryRun,
 	}
 }
 
-// CheckAPIKeyValidity checks if the API key is still valid.
+// CheckAPIKeyValidity checks if the API key is still valid. It returns false
+// with a nil error when the backend rejects the key, and an error when the
+// check couldn't be done, e.g. because the backend is unreachable.
 func (c *Client) CheckAPIKeyValidity() (bool, error) {
 	if c.dryRun {
 		return true, nil
 	}
 
-	_, err := c.post("/check-key/", struct{}{})
+	res, err := c.post("/check-key/", struct{}{})
 	if err != nil {
+		var statusErr *StatusError
+		if errors.As(err, &statusErr) &&
+			(statusErr.StatusCode == http.StatusUnauthorized || statusErr.StatusCode == http.StatusForbidden) {
+			return false, nil
+		}
 		return false, err
 	}
+	res.Body.Close()
 	return true, nil
 }
 
@@ -69,6 +117,22 @@ func (c *Client) GetCollectionConfig() (*collection.CollectionConfig, error) {
 	return &cfg, nil
 }
 
+// GetPatternBundle downloads the signed parsing pattern bundle, verified by
+// the caller
+func (c *Client) GetPatternBundle() ([]byte, error) {
+	res, err := c.get("/patterns/")
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	data, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read pattern bundle: %w", err)
+	}
+	return data, nil
+}
+
 func (c *Client) PostAvailableMetrics(metrics []collection.Metric) error {
 	if c.dryRun {
 		return nil
@@ -97,11 +161,60 @@ func (c *Client) PostAvailableLogSources(log []collection.LogSource) error {
 	return nil
 }
 
+// MetricsDiff lists the metrics that appeared and disappeared since the last
+// discovery.
+type MetricsDiff struct {
+	Added   []collection.Metric `json:"added"`
+	Removed []collection.Metric `json:"removed"`
+}
+
+// PatchAvailableMetrics updates the metrics previously sent with
+// PostAvailableMetrics.
+func (c *Client) PatchAvailableMetrics(diff MetricsDiff) error {
+	if c.dryRun {
+		return nil
+	}
+
+	res, err := c.patch("/metrics/", diff)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	return nil
+}
+
+// LogSourcesDiff lists the log sources that appeared and disappeared since
+// the last discovery.
+type LogSourcesDiff struct {
+	Added   []collection.LogSource `json:"added"`
+	Removed []collection.LogSource `json:"removed"`
+}
+
+// PatchAvailableLogSources updates the log sources previously sent with
+// PostAvailableLogSources.
+func (c *Client) PatchAvailableLogSources(diff LogSourcesDiff) error {
+	if c.dryRun {
+		return nil
+	}
+
+	res, err := c.patch("/logs/", diff)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	return nil
+}
+
 func (c *Client) PostHostInfo(info hostinfo.HostInfo) error {
 	if c.dryRun {
 		return nil
 	}
 
+	if info.HostID == "" {
+		info.HostID = c.hostID
+	}
 	res, err := c.post("/servers/info/", info)
 	if err != nil {
 		return err
@@ -111,13 +224,48 @@ func (c *Client) PostHostInfo(info hostinfo.HostInfo) error {
 	return nil
 }
 
+// ConfigSnapshot describes how the agent is configured on a host. Config is
+// expected to be sanitized by the caller.
+type ConfigSnapshot struct {
+	HostID               string        `json:"host_id,omitempty"`
+	AgentVersion         string        `json:"agent_version"`
+	GoVersion            string        `json:"go_version"`
+	OS                   string        `json:"os"`
+	Arch                 string        `json:"architecture"`
+	Config               config.Config `json:"config"`
+	MetricCollectors     []string      `json:"metric_collectors"`
+	LogCollectors        []string      `json:"log_collectors"`
+	CollectionConfigHash string        `json:"collection_config_hash,omitempty"`
+}
+
+// PostConfigSnapshot sends the agent configuration to the backend, for
+// support purposes.
+func (c *Client) PostConfigSnapshot(snapshot ConfigSnapshot) error {
+	if c.dryRun {
+		return nil
+	}
+
+	if snapshot.HostID == "" {
+		snapshot.HostID = c.hostID
+	}
+	res, err := c.post("/servers/config/", snapshot)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	return nil
+}
+
 func (c *Client) get(path string) (*http.Response, error) {
+	if err := checkThrottle(); err != nil {
+		return nil, err
+	}
 	req, err := http.NewRequest("GET", c.baseURL+path, nil)
 	if err != nil {
 		return nil, err
 	}
-	req.Header.Set("Authorization", "Api-Key "+c.apiKey)
-	req.Header.Set("Content-Type", "application/json")
+	c.setHeaders(req)
 
 	res, err := c.client.Do(req)
 	if err != nil {
@@ -127,17 +275,15 @@ func (c *Client) get(path string) (*http.Response, error) {
 	if res.StatusCode == http.StatusUnauthorized || res.StatusCode == http.StatusForbidden {
 		authguard.Get().HandleUnauthorized()
 	}
+	if res.Header.Get(HostIDConflictHeader) != "" {
+		identity.ReportConflict("reported by the backend")
+	}
+	if res.StatusCode == http.StatusTooManyRequests {
+		HandleTooManyRequests(res.Header)
+	}
 
 	if res.StatusCode < 200 || res.StatusCode >= 300 {
-		var buf [512]byte
-		n, _ := res.Body.Read(buf[:])
-		res.Body.Close()
-		return nil, fmt.Errorf(
-			"GET %s failed: %s (status %d)",
-			path,
-			string(buf[:n]),
-			res.StatusCode,
-		)
+		return nil, statusError(res, "GET", path)
 	}
 
 	logger.Log.Debug("API GET successful", "path", path, "status", res.StatusCode)
@@ -145,17 +291,27 @@ func (c *Client) get(path string) (*http.Response, error) {
 }
 
 func (c *Client) post(path string, payload interface{}) (*http.Response, error) {
+	return c.send("POST", path, payload)
+}
+
+func (c *Client) patch(path string, payload interface{}) (*http.Response, error) {
+	return c.send("PATCH", path, payload)
+}
+
+func (c *Client) send(method, path string, payload interface{}) (*http.Response, error) {
+	if err := checkThrottle(); err != nil {
+		return nil, err
+	}
 	jsonData, err := json.Marshal(payload)
 	if err != nil {
 		return nil, err
 	}
 
-	req, err := http.NewRequest("POST", c.baseURL+path, bytes.NewBuffer(jsonData))
+	req, err := http.NewRequest(method, c.baseURL+path, bytes.NewBuffer(jsonData))
 	if err != nil {
 		return nil, err
 	}
-	req.Header.Set("Authorization", "Api-Key "+c.apiKey)
-	req.Header.Set("Content-Type", "application/json")
+	c.setHeaders(req)
 
 	res, err := c.client.Do(req)
 	if err != nil {
@@ -165,19 +321,33 @@ func (c *Client) post(path string, payload interface{}) (*http.Response, error)
 	if res.StatusCode == http.StatusUnauthorized || res.StatusCode == http.StatusForbidden {
 		authguard.Get().HandleUnauthorized()
 	}
+	if res.Header.Get(HostIDConflictHeader) != "" {
+		identity.ReportConflict("reported by the backend")
+	}
+	if res.StatusCode == http.StatusTooManyRequests {
+		HandleTooManyRequests(res.Header)
+	}
 
 	if res.StatusCode < 200 || res.StatusCode >= 300 {
-		var buf [512]byte
-		n, _ := res.Body.Read(buf[:])
-		res.Body.Close()
-		return nil, fmt.Errorf(
-			"POST %s failed: %s (status %d)",
-			path,
-			string(buf[:n]),
-			res.StatusCode,
-		)
-	}
-
-	logger.Log.Debug("API POST successful", "path", path, "status", res.StatusCode)
+		return nil, statusError(res, method, path)
+	}
+
+	logger.Log.Debug("API request successful", "method", method, "path", path, "status", res.StatusCode)
 	return res, nil
 }
+
+// statusError reads the beginning of the response body and closes it.
+func statusError(res *http.Response, method, path string) *StatusError {
+	var buf [512]byte
+	n, _ := res.Body.Read(buf[:])
+	res.Body.Close()
+	return &StatusError{Method: method, Path: path, StatusCode: res.StatusCode, Body: string(buf[:n])}
+}
+
+func (c *Client) setHeaders(req *http.Request) {
+	req.Header.Set("Authorization", "Api-Key "+c.apiKey)
+	req.Header.Set("Content-Type", "application/json")
+	if c.hostID != "" {
+		req.Header.Set(HostIDHeader, c.hostID)
+	}
+}
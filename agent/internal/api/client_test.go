@@ -0,0 +1,89 @@
+package api
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"agent/internal/config"
+	"agent/internal/logger"
+	"agent/internal/version"
+)
+
+func init() {
+	logger.Log = slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+func TestIsTransient(t *testing.T) {
+	assert.False(t, IsTransient(nil))
+	assert.True(t, IsTransient(errors.New("request failed: connection refused")))
+	assert.True(t, IsTransient(&StatusError{StatusCode: http.StatusServiceUnavailable}))
+	assert.True(t, IsTransient(&StatusError{StatusCode: http.StatusTooManyRequests}))
+	assert.False(t, IsTransient(&StatusError{StatusCode: http.StatusRequestEntityTooLarge}))
+}
+
+func TestCheckAPIKeyValidity(t *testing.T) {
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+	client := NewClient(config.Config{APIUrl: server.URL, APIKey: "test-key"}, false)
+
+	valid, err := client.CheckAPIKeyValidity()
+	assert.True(t, valid)
+	assert.NoError(t, err)
+
+	// Rejected key
+	status = http.StatusUnauthorized
+	valid, err = client.CheckAPIKeyValidity()
+	assert.False(t, valid)
+	assert.NoError(t, err)
+
+	// Backend unavailable, the key may still be valid
+	status = http.StatusServiceUnavailable
+	valid, err = client.CheckAPIKeyValidity()
+	assert.False(t, valid)
+	assert.Error(t, err)
+
+	server.Close()
+	_, err = client.CheckAPIKeyValidity()
+	assert.True(t, IsTransient(err))
+}
+
+func TestGetCapabilities(t *testing.T) {
+	status := http.StatusOK
+	var query url.Values
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.Query()
+		w.WriteHeader(status)
+		if status == http.StatusOK {
+			_, _ = w.Write([]byte(`{"api_version":"2","encodings":["gzip"],"limits":{"max_batch_size":200}}`))
+		}
+	}))
+	defer server.Close()
+	client := NewClient(config.Config{APIUrl: server.URL, APIKey: "test-key"}, false)
+
+	caps, err := client.GetCapabilities()
+	require.NoError(t, err)
+	assert.Equal(t, &Capabilities{APIVersion: "2", Encodings: []string{"gzip"}, Limits: Limits{MaxBatchSize: 200}}, caps)
+	assert.Equal(t, version.Version, query.Get("version"))
+	assert.Contains(t, query.Get("features"), "gzip")
+
+	// Backend without the handshake
+	status = http.StatusNotFound
+	caps, err = client.GetCapabilities()
+	assert.NoError(t, err)
+	assert.Nil(t, caps)
+
+	status = http.StatusServiceUnavailable
+	_, err = client.GetCapabilities()
+	assert.Error(t, err)
+}
@@ -0,0 +1,96 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"agent/internal/logger"
+	"agent/internal/selfstats"
+)
+
+const (
+	// defaultRetryAfter is the back off used when a 429 response doesn't
+	// say how long to wait
+	defaultRetryAfter = 30 * time.Second
+	// maxRetryAfter caps the back off asked by the backend
+	maxRetryAfter = 10 * time.Minute
+)
+
+// The backend throttles the whole host, so a 429 received by the API client
+// or the exporter pauses both until the Retry-After delay elapsed.
+var (
+	throttleMu    sync.Mutex
+	throttleUntil time.Time
+
+	throttledResponses = selfstats.NewCounter("api_throttled_total", map[string]string{"reason": "response"})
+	throttledSkipped   = selfstats.NewCounter("api_throttled_total", map[string]string{"reason": "skipped"})
+)
+
+// ThrottledError is returned instead of sending a request while the backend
+// asked to back off.
+type ThrottledError struct {
+	RetryAfter time.Duration
+}
+
+func (e *ThrottledError) Error() string {
+	return fmt.Sprintf("throttled by the backend, retry in %s", e.RetryAfter.Round(time.Second))
+}
+
+// ThrottledFor returns how long calls to the backend must still be held back,
+// zero when they're not.
+func ThrottledFor() time.Duration {
+	throttleMu.Lock()
+	defer throttleMu.Unlock()
+	return max(time.Until(throttleUntil), 0)
+}
+
+// checkThrottle returns a ThrottledError while calls are held back.
+func checkThrottle() error {
+	if wait := ThrottledFor(); wait > 0 {
+		throttledSkipped.Inc()
+		return &ThrottledError{RetryAfter: wait}
+	}
+	return nil
+}
+
+// HandleTooManyRequests holds back calls to the backend for the delay of the
+// Retry-After header of a 429 response, and returns that delay.
+func HandleTooManyRequests(header http.Header) time.Duration {
+	return Throttle(parseRetryAfter(header.Get("Retry-After"), time.Now()))
+}
+
+// Throttle holds back calls to the backend for d, or the default delay when
+// d is zero. A longer back off already in place is kept.
+func Throttle(d time.Duration) time.Duration {
+	if d <= 0 {
+		d = defaultRetryAfter
+	}
+	d = min(d, maxRetryAfter)
+	throttledResponses.Inc()
+
+	throttleMu.Lock()
+	defer throttleMu.Unlock()
+	if until := time.Now().Add(d); until.After(throttleUntil) {
+		throttleUntil = until
+		logger.Log.Warn("Throttled by the backend, backing off", "delay", d)
+	}
+	return d
+}
+
+// parseRetryAfter parses a Retry-After value, in seconds or as an HTTP date.
+// It returns zero when the value is missing or invalid.
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return date.Sub(now)
+	}
+	return 0
+}
@@ -0,0 +1,58 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"agent/internal/config"
+)
+
+func resetThrottle() {
+	throttleMu.Lock()
+	defer throttleMu.Unlock()
+	throttleUntil = time.Time{}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	assert.Equal(t, 120*time.Second, parseRetryAfter("120", now))
+	assert.Equal(t, 90*time.Second, parseRetryAfter("Mon, 01 Jan 2024 00:01:30 GMT", now))
+	assert.Zero(t, parseRetryAfter("", now))
+	assert.Zero(t, parseRetryAfter("soon", now))
+}
+
+func TestClientHonorsRetryAfter(t *testing.T) {
+	t.Cleanup(resetThrottle)
+
+	var calls int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Retry-After", "60")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+	client := NewClient(config.Config{APIUrl: server.URL, APIKey: "test-key"}, false)
+
+	_, err := client.CheckAPIKeyValidity()
+	require.Error(t, err)
+	assert.True(t, IsTransient(err))
+	assert.InDelta(t, 60, ThrottledFor().Seconds(), 1)
+
+	// Later calls are held back without reaching the backend
+	_, err = client.GetCollectionConfig()
+	var throttledErr *ThrottledError
+	require.ErrorAs(t, err, &throttledErr)
+	assert.InDelta(t, 60, throttledErr.RetryAfter.Seconds(), 1)
+	assert.Equal(t, 1, calls)
+
+	// A shorter delay doesn't shorten the back off, excessive ones are capped
+	Throttle(time.Second)
+	assert.InDelta(t, 60, ThrottledFor().Seconds(), 1)
+	Throttle(24 * time.Hour)
+	assert.InDelta(t, maxRetryAfter.Seconds(), ThrottledFor().Seconds(), 1)
+}
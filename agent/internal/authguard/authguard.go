@@ -2,6 +2,7 @@ package authguard
 
 import (
 	"agent/internal/logger"
+	"agent/internal/selfstats"
 	"sync"
 	"time"
 )
@@ -17,6 +18,9 @@ var (
 	once     sync.Once
 )
 
+// authErrors counts the 401 and 403 responses of the API and export endpoints
+var authErrors = selfstats.NewCounter("agent_auth_errors_total", nil)
+
 // AuthGuard is responsible for monitoring API authentication errors
 // and putting the agent in hibernation mode if the API key is revoked.
 type AuthGuard struct {
@@ -24,6 +28,9 @@ type AuthGuard struct {
 	lastErrorTime time.Time
 	mutex         sync.Mutex
 	keyCheckCh    chan<- bool
+	// suspended is set from the time the error threshold is reached until
+	// the key is known to be valid again
+	suspended bool
 }
 
 // Get returns the singleton instance of the AuthGuard.
@@ -42,6 +49,8 @@ func (ag *AuthGuard) Subscribe(keyCheckCh chan<- bool) {
 // HandleUnauthorized is called when a 401 or 403 status code is received.
 // It increments an error counter and triggers an API key check if the threshold is reached.
 func (ag *AuthGuard) HandleUnauthorized() {
+	authErrors.Inc()
+
 	ag.mutex.Lock()
 	defer ag.mutex.Unlock()
 
@@ -64,5 +73,33 @@ func (ag *AuthGuard) HandleUnauthorized() {
 		}
 		// Reset counter after signaling for a check
 		ag.errorCount = 0
+		ag.suspended = true
+	}
+}
+
+// Suspended reports whether exports should pause, keeping payloads in the
+// spool, because the API key is suspected to be revoked.
+func (ag *AuthGuard) Suspended() bool {
+	ag.mutex.Lock()
+	defer ag.mutex.Unlock()
+	return ag.suspended
+}
+
+// Suspend pauses exports, e.g. when the agent hibernates.
+func (ag *AuthGuard) Suspend() {
+	ag.mutex.Lock()
+	defer ag.mutex.Unlock()
+	ag.suspended = true
+}
+
+// Resume is called once the API key is known to be valid, or can't be
+// checked, to let exports go on.
+func (ag *AuthGuard) Resume() {
+	ag.mutex.Lock()
+	defer ag.mutex.Unlock()
+	if ag.suspended {
+		logger.Log.Info("Resuming exports")
 	}
+	ag.suspended = false
+	ag.errorCount = 0
 }
@@ -0,0 +1,34 @@
+package authguard
+
+import (
+	"io"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"agent/internal/logger"
+)
+
+func init() {
+	logger.Log = slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+func TestAuthGuardThreshold(t *testing.T) {
+	keyCheckCh := make(chan bool, 1)
+	ag := &AuthGuard{}
+	ag.Subscribe(keyCheckCh)
+
+	for range errorThreshold - 1 {
+		ag.HandleUnauthorized()
+	}
+	assert.False(t, ag.Suspended())
+	assert.Empty(t, keyCheckCh)
+
+	ag.HandleUnauthorized()
+	assert.True(t, ag.Suspended())
+	assert.Len(t, keyCheckCh, 1)
+
+	ag.Resume()
+	assert.False(t, ag.Suspended())
+}
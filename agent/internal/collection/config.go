@@ -12,16 +12,48 @@ type Metric struct {
 	Type   string            `json:"type"`
 	Value  float64           `json:"value"`
 	Labels map[string]string `json:"labels"`
+	// LabelKeys is set on templates, metrics advertised once for all their
+	// label sets, e.g. disk_used_ratio{device,mountpoint}. The Labels of a
+	// template hold "*" for every key.
+	LabelKeys []string `json:"label_keys,omitempty"`
+	// LabelValues enumerates the label sets of a template when it was
+	// discovered.
+	LabelValues []map[string]string `json:"label_values,omitempty"`
 }
 
 type LogSource struct {
-	Name string `json:"name"`
-	Path string `json:"path"`
+	Name    string            `json:"name"`
+	Path    string            `json:"path"`
+	Options map[string]string `json:"options,omitempty"`
+	// Stages is the chain of processing steps applied, in order, to the
+	// entries produced by the collector of the source.
+	Stages []Stage `json:"stages,omitempty"`
+}
+
+// Stage is a reusable log processing step (parse, timestamp, severity,
+// redact, filter, labels) and its options.
+type Stage struct {
+	Type    string            `json:"type"`
+	Options map[string]string `json:"options,omitempty"`
+}
+
+// ExportSettings lets the backend tune how the agent exports data. Zero
+// values keep the agent defaults. The agent clamps every value to local caps.
+type ExportSettings struct {
+	FlushIntervalSeconds int     `json:"flush_interval_seconds,omitempty"`
+	MaxBatchSize         int     `json:"max_batch_size,omitempty"`
+	MaxAgeSeconds        int     `json:"max_age_seconds,omitempty"`
+	MaxPayloadsPerSecond float64 `json:"max_payloads_per_second,omitempty"`
+	MaxSendAttempts      int     `json:"max_send_attempts,omitempty"`
 }
 
 type CollectionConfig struct {
-	Metrics    []Metric    `json:"metrics"`
-	LogSources []LogSource `json:"log_sources"`
+	Metrics    []Metric        `json:"metrics"`
+	LogSources []LogSource     `json:"log_sources"`
+	Export     *ExportSettings `json:"export,omitempty"`
+	// PatternsVersion is the version of the latest parsing pattern bundle,
+	// downloaded and loaded without a reload when newer than the loaded one
+	PatternsVersion int `json:"patterns_version,omitempty"`
 }
 
 func (c CollectionConfig) Hash() (string, error) {
@@ -42,7 +74,7 @@ func (c CollectionConfig) Hash() (string, error) {
 		bJ, _ := json.Marshal(logSourcesCopy[j])
 		return string(bI) < string(bJ)
 	})
-	normalized := CollectionConfig{Metrics: metricsCopy, LogSources: logSourcesCopy}
+	normalized := CollectionConfig{Metrics: metricsCopy, LogSources: logSourcesCopy, Export: c.Export}
 
 	data, err := json.Marshal(normalized)
 	if err != nil {
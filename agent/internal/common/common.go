@@ -5,7 +5,20 @@ import (
 	"path/filepath"
 )
 
+// programDirectory overrides the directory of the executable when set
+var programDirectory string
+
+// SetProgramDirectory makes the agent keep its state (config, spool, lock,
+// positions) in dir instead of next to the executable. It must be called
+// before the agent starts.
+func SetProgramDirectory(dir string) {
+	programDirectory = dir
+}
+
 func GetProgramDirectory() (string, error) {
+	if programDirectory != "" {
+		return programDirectory, nil
+	}
 	exePath, err := os.Executable()
 	if err != nil {
 		return "", err
@@ -0,0 +1,55 @@
+package common
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// hostRoot is where the filesystem of the host is mounted when the agent runs
+// in a container, e.g. /host in a Kubernetes DaemonSet
+var hostRoot string
+
+// hostEnv are the variables telling gopsutil where the host directories are
+// mounted
+var hostEnv = map[string]string{
+	"HOST_PROC": "/proc",
+	"HOST_SYS":  "/sys",
+	"HOST_ETC":  "/etc",
+	"HOST_VAR":  "/var",
+	"HOST_RUN":  "/run",
+	"HOST_DEV":  "/dev",
+}
+
+// SetHostRoot makes the collectors read /proc, /sys and the logs of the host
+// mounted at root instead of the ones of the container. It must be called
+// before the collectors are created. An empty root or / reads the ones of the
+// agent.
+func SetHostRoot(root string) {
+	if root == "" || root == "/" {
+		hostRoot = ""
+		return
+	}
+	hostRoot = filepath.Clean(root)
+	os.Setenv("HOST_ROOT", hostRoot)
+	for name, dir := range hostEnv {
+		// An explicit variable, e.g. a /proc mounted elsewhere, wins
+		if os.Getenv(name) == "" {
+			os.Setenv(name, filepath.Join(hostRoot, dir))
+		}
+	}
+}
+
+// HostRoot returns the mount point of the host filesystem, empty when the
+// agent reads its own
+func HostRoot() string {
+	return hostRoot
+}
+
+// HostPath returns where a path of the host is visible to the agent, e.g.
+// /host/proc/vmstat for /proc/vmstat. Glob patterns are prefixed the same way.
+func HostPath(path string) string {
+	if hostRoot == "" {
+		return path
+	}
+	return filepath.Join(hostRoot, path)
+}
@@ -0,0 +1,30 @@
+package common
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHostRoot(t *testing.T) {
+	t.Cleanup(func() { hostRoot = "" })
+	for name := range hostEnv {
+		t.Setenv(name, "")
+	}
+	t.Setenv("HOST_ROOT", "")
+	t.Setenv("HOST_SYS", "/sys-mount")
+
+	assert.Equal(t, "/proc/vmstat", HostPath("/proc/vmstat"))
+
+	SetHostRoot("/host/")
+	assert.Equal(t, "/host", HostRoot())
+	assert.Equal(t, "/host/proc/vmstat", HostPath("/proc/vmstat"))
+	assert.Equal(t, "/host/var/log/nginx/*.log", HostPath("/var/log/nginx/*.log"))
+	assert.Equal(t, "/host/proc", os.Getenv("HOST_PROC"))
+	assert.Equal(t, "/sys-mount", os.Getenv("HOST_SYS"), "explicit variables are kept")
+
+	SetHostRoot("/")
+	assert.Empty(t, HostRoot())
+	assert.Equal(t, "/proc/vmstat", HostPath("/proc/vmstat"))
+}
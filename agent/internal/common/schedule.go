@@ -0,0 +1,43 @@
+package common
+
+import (
+	"context"
+	"hash/fnv"
+	"math/rand/v2"
+	"time"
+)
+
+// PhaseOffset returns an offset in [0, interval) used to shift periodic work
+// of this agent away from the rest of the fleet. Agents deployed at the same
+// time would otherwise collect and export on the same second.
+//
+// The offset is derived from seed (e.g. the host ID) so it stays stable across
+// restarts. An empty seed gives a random offset.
+func PhaseOffset(seed string, interval time.Duration) time.Duration {
+	if interval <= 0 {
+		return 0
+	}
+	if seed == "" {
+		return rand.N(interval)
+	}
+	h := fnv.New64a()
+	h.Write([]byte(seed))
+	h.Write([]byte(interval.String()))
+	return time.Duration(h.Sum64() % uint64(interval))
+}
+
+// SleepContext waits for d or until ctx is cancelled. It returns false when
+// the context was cancelled first.
+func SleepContext(ctx context.Context, d time.Duration) bool {
+	if d <= 0 {
+		return ctx.Err() == nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,42 @@
+package common
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPhaseOffset(t *testing.T) {
+	interval := 60 * time.Second
+
+	a := PhaseOffset("host-a", interval)
+	assert.Equal(t, a, PhaseOffset("host-a", interval), "offset must be stable for a seed")
+	assert.GreaterOrEqual(t, a, time.Duration(0))
+	assert.Less(t, a, interval)
+
+	random := PhaseOffset("", interval)
+	assert.GreaterOrEqual(t, random, time.Duration(0))
+	assert.Less(t, random, interval)
+
+	assert.Zero(t, PhaseOffset("host-a", 0))
+}
+
+func TestPhaseOffsetSpread(t *testing.T) {
+	interval := 60 * time.Second
+	seen := make(map[time.Duration]bool)
+	for _, seed := range []string{"a", "b", "c", "d", "e", "f", "g", "h"} {
+		seen[PhaseOffset(seed, interval)] = true
+	}
+	assert.Greater(t, len(seen), 1, "offsets should differ between hosts")
+}
+
+func TestSleepContext(t *testing.T) {
+	assert.True(t, SleepContext(context.Background(), time.Millisecond))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.False(t, SleepContext(ctx, time.Hour))
+	assert.False(t, SleepContext(ctx, 0))
+}
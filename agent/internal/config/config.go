@@ -1,10 +1,16 @@
 package config
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log/slog"
+	"maps"
+	"net/url"
 	"os"
 	"path/filepath"
+	"slices"
 
 	"agent/internal/common"
 	"agent/internal/logger"
@@ -15,22 +21,404 @@ type Config struct {
 	APIUrl           string `json:"api_url"`
 	LogsExportUrl    string `json:"logs_export_url"`
 	MetricsExportUrl string `json:"metrics_export_url"`
+	HostIDSource     string `json:"host_id_source,omitempty"`
+	// UpdateURL is an internal mirror of the releases used by simob update
+	// instead of the API, for hosts which can't reach it. It holds a
+	// "version" file, the "checksums" manifest and the binaries.
+	UpdateURL string `json:"update_url,omitempty"`
+	// GRPCExportUrl enables the gRPC streaming export transport
+	// (grpcs://host:port). HTTP export stays the fallback.
+	GRPCExportUrl string `json:"grpc_export_url,omitempty"`
+	// MetricsExportFormat is the wire format of the HTTP metrics exports,
+	// MetricsFormatJSON (default) or MetricsFormatRemoteWrite to send to a
+	// Prometheus remote_write endpoint such as Mimir or Thanos.
+	MetricsExportFormat string `json:"metrics_export_format,omitempty"`
+	// OTLPExport sends the metrics and logs to an OpenTelemetry collector
+	// instead of the export URLs.
+	OTLPExport OTLPExportConfig `json:"otlp_export,omitempty"`
+
+	// ExportFailover lists secondary export endpoints, e.g. of another
+	// region, used when the export URLs are unreachable.
+	ExportFailover ExportFailoverConfig `json:"export_failover,omitempty"`
+
+	Network NetworkConfig `json:"network,omitempty"`
+
+	Spool SpoolConfig `json:"spool,omitempty"`
+
+	// Tags are static host tags added to every exported metric and log.
+	// They take precedence over tags found by the automatic providers.
+	Tags             map[string]string `json:"tags,omitempty"`
+	DisableCloudTags bool              `json:"disable_cloud_tags,omitempty"`
+
+	// DisableScheduleOffsets runs collection and export right away on
+	// startup instead of shifting them by a per-agent phase offset.
+	DisableScheduleOffsets bool `json:"disable_schedule_offsets,omitempty"`
+
+	AdaptiveCollection AdaptiveCollectionConfig `json:"adaptive_collection,omitempty"`
+
+	FastPath FastPathConfig `json:"fast_path,omitempty"`
+
+	OTLPReceiver OTLPReceiverConfig `json:"otlp_receiver,omitempty"`
+
+	Discovery DiscoveryConfig `json:"discovery,omitempty"`
+
+	// MetricTransforms rewrite the collected metrics before export, in order.
+	MetricTransforms []MetricTransform `json:"metric_transforms,omitempty"`
+
+	// DerivedMetrics are computed from the collected metrics on every
+	// collection, before the transforms.
+	DerivedMetrics []DerivedMetric `json:"derived_metrics,omitempty"`
+
+	// ScrapeTargets lists the local Prometheus endpoints pulled by the scrape
+	// collector.
+	ScrapeTargets []ScrapeTarget `json:"scrape_targets,omitempty"`
+
+	// JolokiaTargets lists the Java applications read by the jvm collector.
+	JolokiaTargets []JolokiaTarget `json:"jolokia_targets,omitempty"`
+
+	// PerfmonCounters lists the Windows performance counters read by the
+	// perfmon collector.
+	PerfmonCounters []PerfmonCounter `json:"perfmon_counters,omitempty"`
+
+	// SNMPTargets lists the network devices polled by the snmp collector.
+	SNMPTargets []SNMPTarget `json:"snmp_targets,omitempty"`
+
+	// Elasticsearch is the local Elasticsearch or OpenSearch node, defaults
+	// to http://localhost:9200 without credentials.
+	Elasticsearch *ElasticsearchEndpoint `json:"elasticsearch,omitempty"`
+
+	// KafkaClusters lists the Kafka clusters read by the kafka collector.
+	KafkaClusters []KafkaCluster `json:"kafka_clusters,omitempty"`
+
+	// SupervisordURL is the supervisord XML-RPC endpoint, either
+	// unix:///path/to/supervisor.sock or http://[user:pass@]host:9001/RPC2.
+	// The usual socket locations are tried when empty.
+	SupervisordURL string `json:"supervisord_url,omitempty"`
+
+	// Processes selects the processes reported by the process collector
+	Processes ProcessesConfig `json:"processes,omitempty"`
+	// SystemdUnits lists the glob patterns of the units reported by the
+	// systemd collector, e.g. "nginx.service" or "backup-*.timer". All the
+	// services are reported when it's empty.
+	SystemdUnits []string `json:"systemd_units,omitempty"`
+	// TLSCertificates lists the glob patterns of the certificate files read
+	// by the tls collector, PEM or DER, e.g. "/etc/nginx/certs/*.crt". The
+	// certificates issued by certbot are read when it's empty.
+	TLSCertificates []string `json:"tls_certificates,omitempty"`
+
+	// ShareConfigSnapshot sends a sanitized copy of this configuration to the
+	// backend on start and on every collection config change, so that support
+	// can see how the agent is set up. Secrets are masked.
+	ShareConfigSnapshot bool `json:"share_config_snapshot,omitempty"`
+
+	// DebugAddress serves net/http/pprof and the runtime stats on a loopback
+	// address, e.g. 127.0.0.1:6060, to profile the agent. It's off when
+	// empty, SIGUSR2 starts and stops it without a restart.
+	DebugAddress string `json:"debug_address,omitempty"`
+
+	// HostID is the resolved host identifier. It's derived from HostIDSource
+	// at startup and never persisted.
+	HostID string `json:"-"`
+}
+
+// AdaptiveCollectionConfig controls the optional mode where gauges that don't
+// change are exported less often. Zero values fall back to defaults.
+type AdaptiveCollectionConfig struct {
+	Enabled bool `json:"enabled"`
+	// IdleCycles is the number of unchanged collections before backing off.
+	IdleCycles int `json:"idle_cycles,omitempty"`
+	// MaxIntervalSeconds is the ceiling of the backed off export interval.
+	MaxIntervalSeconds int `json:"max_interval_seconds,omitempty"`
+	// Tolerance is the relative change under which a value is considered
+	// unchanged (e.g. 0.01 for 1%).
+	Tolerance float64 `json:"tolerance,omitempty"`
+	// Thresholds lists values per metric name, e.g. {"cpu_usage_ratio":
+	// [0.9]}. A series crossing one of them goes back to full frequency,
+	// even when the change is within the tolerance.
+	Thresholds map[string][]float64 `json:"thresholds,omitempty"`
+}
+
+// FastPathConfig selects metrics collected more often than the others, e.g.
+// heartbeat or nginx_requests_total. The rest of the collector output is
+// dropped on fast collections.
+type FastPathConfig struct {
+	Metrics []string `json:"metrics,omitempty"`
+	// IntervalSeconds defaults to 15, rounded so that it divides the
+	// collection interval.
+	IntervalSeconds int `json:"interval_seconds,omitempty"`
+	// Aggregations lists "min", "max" and "avg". When set, the fast
+	// collections aren't exported: each series is exported on the full
+	// collection with its last value and these aggregates over the
+	// collection interval, as <name>_min, <name>_max and <name>_avg.
+	Aggregations []string `json:"aggregations,omitempty"`
+}
+
+// ProcessesConfig selects the processes reported by the process collector:
+// the top processes by CPU and by memory, plus the ones tracked by name.
+type ProcessesConfig struct {
+	// TopN is the number of processes reported by CPU and by memory,
+	// defaults to 5. A negative value reports tracked processes only.
+	TopN int `json:"top_n,omitempty"`
+	// Track lists regular expressions matched against the process names,
+	// e.g. "postgres" or "^nginx$". The processes matching one are reported
+	// together, whatever their usage.
+	Track []string `json:"track,omitempty"`
+}
+
+// ExportFailoverConfig lists the export URLs tried, in order, after
+// LogsExportUrl and MetricsExportUrl. Zero durations fall back to defaults.
+type ExportFailoverConfig struct {
+	MetricsExportUrls []string `json:"metrics_export_urls,omitempty"`
+	LogsExportUrls    []string `json:"logs_export_urls,omitempty"`
+	// AfterSeconds is how long an endpoint must be unreachable before
+	// failing over to the next one, defaults to 120.
+	AfterSeconds int `json:"after_seconds,omitempty"`
+	// FailbackSeconds is the time between two attempts to return to the
+	// primary endpoint, defaults to 300.
+	FailbackSeconds int `json:"failback_seconds,omitempty"`
+}
+
+// SpoolConfig sizes the spool keeping the payloads until the backend accepts
+// them. Zero values fall back to defaults.
+type SpoolConfig struct {
+	// MaxSizeMB is the disk space of the spool, defaults to 512. It's split
+	// between metrics and logs in proportion to their rates, and the newest
+	// payloads of a stream are dropped once its share is full.
+	MaxSizeMB int `json:"max_size_mb,omitempty"`
+	// OutageHours is the backend outage the spool should absorb, a warning
+	// is logged when MaxSizeMB is too small for it. Defaults to 24.
+	OutageHours float64 `json:"outage_hours,omitempty"`
+	// InMemory lists the streams ("metrics", "logs") kept in memory instead
+	// of the disk while their endpoint is reachable, to save the disk writes
+	// on hosts with a reliable network. They're written to the disk while the
+	// endpoint is unreachable and on shutdown.
+	InMemory []string `json:"in_memory,omitempty"`
+	// MaxAgeHours is how long the payloads of each stream ("metrics",
+	// "logs") wait in the spool before they expire, overriding the max age
+	// of the export settings. Negative never expires the metrics, e.g. to
+	// keep them through a long weekend without network.
+	MaxAgeHours map[string]float64 `json:"max_age_hours,omitempty"`
+	// ReplayOrder is the order the spooled payloads are sent in: "file", the
+	// default, sends them in the order they were spooled. "window" sends
+	// them by timestamp windows of ReplayWindowSeconds, oldest first, for
+	// backends rejecting out-of-order points.
+	ReplayOrder string `json:"replay_order,omitempty"`
+	// ReplayWindowSeconds is the timestamp window of a batch in the window
+	// order, defaults to 60.
+	ReplayWindowSeconds int `json:"replay_window_seconds,omitempty"`
+	// ReplayMaxLagSeconds drops the payloads further behind real time when
+	// they're replayed in the window order, for backends rejecting too old
+	// points, they're reported as expired. Zero keeps them up to the max age
+	// of the export settings.
+	ReplayMaxLagSeconds int `json:"replay_max_lag_seconds,omitempty"`
+}
+
+// NetworkConfig tunes the connections to the backend, for hosts with a slow
+// resolver or a broken IPv6 route. Zero values fall back to defaults.
+type NetworkConfig struct {
+	// DNSCacheSeconds is how long resolved addresses are reused, defaults to
+	// 60. Negative disables the cache.
+	DNSCacheSeconds int `json:"dns_cache_seconds,omitempty"`
+	// DialTimeoutSeconds bounds the connection to an address, defaults to 5.
+	DialTimeoutSeconds int `json:"dial_timeout_seconds,omitempty"`
+	// PreferIPv4 dials the IPv4 addresses first.
+	PreferIPv4 bool `json:"prefer_ipv4,omitempty"`
+	// FallbackDelayMillis is the time given to the preferred address family
+	// before the other one is dialed too, defaults to 300. Negative dials
+	// the families one after the other.
+	FallbackDelayMillis int `json:"fallback_delay_millis,omitempty"`
+}
+
+// OTLPExportConfig points the exports to an OTLP/HTTP endpoint.
+type OTLPExportConfig struct {
+	// Endpoint is the base URL of the collector, e.g.
+	// http://collector:4318. The signals are sent to /v1/metrics and
+	// /v1/logs.
+	Endpoint string `json:"endpoint,omitempty"`
+	// Headers are added to every request, e.g. for authentication.
+	Headers map[string]string `json:"headers,omitempty"`
+}
+
+// OTLPReceiverConfig controls the local OTLP receiver. Empty addresses use the
+// OTLP defaults bound to localhost, "off" disables a protocol.
+type OTLPReceiverConfig struct {
+	Enabled     bool   `json:"enabled"`
+	HTTPAddress string `json:"http_address,omitempty"`
+	GRPCAddress string `json:"grpc_address,omitempty"`
+}
+
+// DiscoveryConfig tunes how the available metrics and log sources are
+// reported to the backend. Zero values fall back to defaults.
+type DiscoveryConfig struct {
+	// ChunkSize is the maximum number of metrics or log sources per request.
+	ChunkSize int `json:"chunk_size,omitempty"`
+	// RequestsPerMinute caps the discovery requests sent to the backend.
+	RequestsPerMinute int `json:"requests_per_minute,omitempty"`
+	// MaxLabelSets is the number of label sets enumerated per metric
+	// template. Negative advertises every label set as a separate metric.
+	MaxLabelSets int `json:"max_label_sets,omitempty"`
+}
+
+// MetricTransform renames, scales, drops or relabels the metrics whose name
+// matches the Match glob pattern (e.g. "disk_*_bytes"). The actions are
+// applied in the order of the fields, and a renamed metric is matched by the
+// following transforms under its new name. Metrics are selected in the
+// collection config by their original name.
+type MetricTransform struct {
+	Match string `json:"match"`
+	// MatchLabels restricts the transform to the metrics having these label
+	// values.
+	MatchLabels map[string]string `json:"match_labels,omitempty"`
+	Drop        bool              `json:"drop,omitempty"`
+	Rename      string            `json:"rename,omitempty"`
+	// Scale multiplies the value (e.g. 9.313225746154785e-10 to convert
+	// bytes to GiB), ignored when zero.
+	Scale        float64           `json:"scale,omitempty"`
+	AddLabels    map[string]string `json:"add_labels,omitempty"`
+	RemoveLabels []string          `json:"remove_labels,omitempty"`
+}
+
+// DerivedMetric is a metric computed from an arithmetic expression over other
+// metrics, e.g. "(mem_used_bytes - mem_cached_bytes) / mem_total_bytes".
+// Expressions support numbers, metric names, + - * / and parentheses. The
+// series of the operands are matched by labels, and a metric without labels
+// is combined with every series of the others.
+type DerivedMetric struct {
+	Name       string `json:"name"`
+	Expression string `json:"expression"`
+}
+
+// ScrapeTarget is a Prometheus /metrics endpoint pulled by the agent.
+type ScrapeTarget struct {
+	// Name is added to every sample as the "job" label.
+	Name string `json:"name"`
+	URL  string `json:"url"`
+	// Include and Exclude are glob patterns matched against metric names.
+	// When Include is empty, every metric is included.
+	Include        []string      `json:"include,omitempty"`
+	Exclude        []string      `json:"exclude,omitempty"`
+	Relabel        []RelabelRule `json:"relabel,omitempty"`
+	TimeoutSeconds int           `json:"timeout_seconds,omitempty"`
+}
+
+// RelabelRule rewrites the labels of scraped samples, following the semantics
+// of Prometheus relabel_configs. Supported actions are replace (default),
+// keep, drop and labeldrop. The metric name is available as "__name__".
+type RelabelRule struct {
+	SourceLabels []string `json:"source_labels,omitempty"`
+	Separator    string   `json:"separator,omitempty"`
+	Regex        string   `json:"regex,omitempty"`
+	TargetLabel  string   `json:"target_label,omitempty"`
+	Replacement  string   `json:"replacement,omitempty"`
+	Action       string   `json:"action,omitempty"`
+}
+
+// JolokiaTarget is a Jolokia agent endpoint exposing the JMX beans of a Java
+// application (e.g. http://localhost:8778/jolokia).
+type JolokiaTarget struct {
+	// Name is added to every metric as the "app" label.
+	Name     string `json:"name"`
+	URL      string `json:"url"`
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+}
+
+// PerfmonCounter is a Windows performance counter path, as shown by PerfMon
+// or typeperf (e.g. `\Processor(*)\% Processor Time`). Wildcard instances
+// are expanded and reported with an "instance" label.
+type PerfmonCounter struct {
+	Path string `json:"path"`
+	// Name overrides the metric name derived from the counter path.
+	Name string `json:"name,omitempty"`
+}
+
+// ElasticsearchEndpoint is the HTTP endpoint of an Elasticsearch or
+// OpenSearch node. APIKey takes precedence over basic authentication.
+type ElasticsearchEndpoint struct {
+	URL                string `json:"url"`
+	Username           string `json:"username,omitempty"`
+	Password           string `json:"password,omitempty"`
+	APIKey             string `json:"api_key,omitempty"`
+	InsecureSkipVerify bool   `json:"insecure_skip_verify,omitempty"`
+}
+
+// KafkaCluster is a Kafka cluster reached through one or more brokers.
+// Consumer lag is reported for ConsumerGroups only.
+type KafkaCluster struct {
+	// Name is added to every metric as the "cluster" label.
+	Name           string   `json:"name"`
+	Brokers        []string `json:"brokers"`
+	ConsumerGroups []string `json:"consumer_groups,omitempty"`
+	// SASLMechanism is PLAIN, SCRAM-SHA-256 or SCRAM-SHA-512, SASL is not
+	// used when empty.
+	SASLMechanism string `json:"sasl_mechanism,omitempty"`
+	Username      string `json:"username,omitempty"`
+	Password      string `json:"password,omitempty"`
+	TLS           bool   `json:"tls,omitempty"`
+}
+
+// SNMPTarget is a network device polled over SNMP v2c or v3.
+type SNMPTarget struct {
+	// Name is added to every metric as the "device" label.
+	Name string `json:"name"`
+	// Address is host[:port], the port defaults to 161.
+	Address string `json:"address"`
+	// Version is "2c" (default) or "3".
+	Version   string `json:"version,omitempty"`
+	Community string `json:"community,omitempty"`
+	// SNMP v3 user based security. Protocols are MD5, SHA, SHA224, SHA256,
+	// SHA384, SHA512 for authentication and DES, AES, AES192, AES256 for
+	// privacy. Leaving a protocol empty disables it.
+	Username     string `json:"username,omitempty"`
+	AuthProtocol string `json:"auth_protocol,omitempty"`
+	AuthPassword string `json:"auth_password,omitempty"`
+	PrivProtocol string `json:"priv_protocol,omitempty"`
+	PrivPassword string `json:"priv_password,omitempty"`
+	// Modules selects the built-in metric sets (system, interfaces, cpu,
+	// sensors). All of them are polled when empty.
+	Modules []string `json:"modules,omitempty"`
+	// Metrics are additional OIDs mapped to metrics.
+	Metrics []SNMPMetric `json:"metrics,omitempty"`
+}
+
+// SNMPMetric maps an OID, or an OID table, to a metric.
+type SNMPMetric struct {
+	// Name is the metric name, prefixed with "snmp_".
+	Name string `json:"name"`
+	OID  string `json:"oid"`
+	// Table walks OID and reports one value per row. Rows are labelled with
+	// the value of LabelOID at the same index, or with the index itself.
+	Table    bool   `json:"table,omitempty"`
+	LabelOID string `json:"label_oid,omitempty"`
+	Label    string `json:"label,omitempty"`
+	// Scale multiplies the raw value, defaults to 1.
+	Scale float64 `json:"scale,omitempty"`
+	// Rate reports the per second rate of a counter instead of its value.
+	Rate bool `json:"rate,omitempty"`
 }
 
 const ConfigFilename = "config.json"
 
-func NewConfig(apiKey string) *Config {
-	// Defaults
-	defaultAPIUrl := "https://api.simpleobservability.com"
-	defaultLogsExportUrl := "https://logs.simpleobservability.com"
-	defaultMetricsExportUrl := "https://metrics.simpleobservability.com"
+// Wire formats of the metrics exports
+const (
+	MetricsFormatJSON        = "json"
+	MetricsFormatRemoteWrite = "remote_write"
+)
+
+// Default endpoints of the backend
+const (
+	DefaultAPIUrl           = "https://api.simpleobservability.com"
+	DefaultLogsExportUrl    = "https://logs.simpleobservability.com"
+	DefaultMetricsExportUrl = "https://metrics.simpleobservability.com"
+)
 
+func NewConfig(apiKey string) *Config {
 	// Start with defaults
 	cfg := &Config{
 		APIKey:           apiKey,
-		APIUrl:           defaultAPIUrl,
-		LogsExportUrl:    defaultLogsExportUrl,
-		MetricsExportUrl: defaultMetricsExportUrl,
+		APIUrl:           DefaultAPIUrl,
+		LogsExportUrl:    DefaultLogsExportUrl,
+		MetricsExportUrl: DefaultMetricsExportUrl,
 	}
 
 	// Try to load existing config file first
@@ -49,6 +437,35 @@ func NewConfig(apiKey string) *Config {
 		if existingCfg.MetricsExportUrl != "" {
 			cfg.MetricsExportUrl = existingCfg.MetricsExportUrl
 		}
+		cfg.HostIDSource = existingCfg.HostIDSource
+		cfg.GRPCExportUrl = existingCfg.GRPCExportUrl
+		cfg.MetricsExportFormat = existingCfg.MetricsExportFormat
+		cfg.OTLPExport = existingCfg.OTLPExport
+		cfg.ExportFailover = existingCfg.ExportFailover
+		cfg.Network = existingCfg.Network
+		cfg.Spool = existingCfg.Spool
+		cfg.Tags = existingCfg.Tags
+		cfg.DisableCloudTags = existingCfg.DisableCloudTags
+		cfg.DisableScheduleOffsets = existingCfg.DisableScheduleOffsets
+		cfg.AdaptiveCollection = existingCfg.AdaptiveCollection
+		cfg.FastPath = existingCfg.FastPath
+		cfg.OTLPReceiver = existingCfg.OTLPReceiver
+		cfg.Discovery = existingCfg.Discovery
+		cfg.MetricTransforms = existingCfg.MetricTransforms
+		cfg.DerivedMetrics = existingCfg.DerivedMetrics
+		cfg.ScrapeTargets = existingCfg.ScrapeTargets
+		cfg.JolokiaTargets = existingCfg.JolokiaTargets
+		cfg.PerfmonCounters = existingCfg.PerfmonCounters
+		cfg.SNMPTargets = existingCfg.SNMPTargets
+		cfg.Elasticsearch = existingCfg.Elasticsearch
+		cfg.KafkaClusters = existingCfg.KafkaClusters
+		cfg.SupervisordURL = existingCfg.SupervisordURL
+		cfg.Processes = existingCfg.Processes
+		cfg.SystemdUnits = existingCfg.SystemdUnits
+		cfg.TLSCertificates = existingCfg.TLSCertificates
+		cfg.UpdateURL = existingCfg.UpdateURL
+		cfg.ShareConfigSnapshot = existingCfg.ShareConfigSnapshot
+		cfg.DebugAddress = existingCfg.DebugAddress
 	} else {
 		logger.Log.Debug("Failed to open existing config file")
 	}
@@ -70,6 +487,29 @@ func (c *Config) SetAPIKey(apiKey string)                     { c.APIKey = apiKe
 func (c *Config) SetAPIUrl(apiUrl string)                     { c.APIUrl = apiUrl }
 func (c *Config) SetLogsExportUrl(logsExportUrl string)       { c.LogsExportUrl = logsExportUrl }
 func (c *Config) SetMetricsExportUrl(metricsExportUrl string) { c.MetricsExportUrl = metricsExportUrl }
+func (c *Config) SetHostIDSource(source string)               { c.HostIDSource = source }
+func (c *Config) SetUpdateURL(updateURL string)               { c.UpdateURL = updateURL }
+func (c *Config) SetGRPCExportUrl(grpcExportUrl string)       { c.GRPCExportUrl = grpcExportUrl }
+func (c *Config) SetMetricsExportFormat(format string)        { c.MetricsExportFormat = format }
+func (c *Config) SetMetricsFailoverUrls(urls []string)        { c.ExportFailover.MetricsExportUrls = urls }
+func (c *Config) SetLogsFailoverUrls(urls []string)           { c.ExportFailover.LogsExportUrls = urls }
+func (c *Config) SetDisableCloudTags(disable bool)            { c.DisableCloudTags = disable }
+func (c *Config) SetDisableScheduleOffsets(disable bool)      { c.DisableScheduleOffsets = disable }
+func (c *Config) SetAdaptiveCollection(enabled bool)          { c.AdaptiveCollection.Enabled = enabled }
+func (c *Config) SetOTLPReceiver(enabled bool)                { c.OTLPReceiver.Enabled = enabled }
+func (c *Config) SetShareConfigSnapshot(enabled bool)         { c.ShareConfigSnapshot = enabled }
+
+// SetTag sets a static host tag, an empty value removes it.
+func (c *Config) SetTag(key, value string) {
+	if value == "" {
+		delete(c.Tags, key)
+		return
+	}
+	if c.Tags == nil {
+		c.Tags = make(map[string]string)
+	}
+	c.Tags[key] = value
+}
 
 func ConfigPath() (string, error) {
 	programDirectory, err := common.GetProgramDirectory()
@@ -87,16 +527,128 @@ func (c *Config) Save() error {
 	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
 		return err
 	}
-	f, err := os.Create(path)
+	// Written aside then renamed, so that a running agent never reads a
+	// partially written config
+	tmpPath := path + ".tmp"
+	f, err := os.Create(tmpPath)
 	if err != nil {
 		return err
 	}
-	defer f.Close()
+	defer os.Remove(tmpPath)
 
 	encoder := json.NewEncoder(f)
 	encoder.SetIndent("", "  ")
 	logger.Log.Debug("Saving config", slog.Any("cfg", c))
-	return encoder.Encode(c)
+	if err := encoder.Encode(c); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
+
+// RequiresRestart reports whether changing from c to other needs the agent
+// to restart, the API client and the host identity being set up at start.
+// The other settings are applied by a reload.
+func (c *Config) RequiresRestart(other *Config) bool {
+	return c.APIKey != other.APIKey || c.APIUrl != other.APIUrl || c.HostIDSource != other.HostIDSource
+}
+
+// Validate checks the settings the agent can't run without, so that a broken
+// edit of the config file is rejected instead of applied.
+func (c *Config) Validate() error {
+	if c.APIKey == "" {
+		return errors.New("missing API key in config")
+	}
+	if err := ValidateMetricsExportFormat(c.MetricsExportFormat); err != nil {
+		return err
+	}
+	if c.OTLPExport.Endpoint != "" && c.MetricsExportFormat == MetricsFormatRemoteWrite {
+		return errors.New("otlp_export and the remote_write metrics_export_format can't be used together")
+	}
+	for key, raw := range map[string]string{
+		"api_url":              c.APIUrl,
+		"logs_export_url":      c.LogsExportUrl,
+		"metrics_export_url":   c.MetricsExportUrl,
+		"otlp_export.endpoint": c.OTLPExport.Endpoint,
+	} {
+		if raw == "" {
+			continue
+		}
+		if !validURL(raw) {
+			return fmt.Errorf("invalid %s %q", key, maskURL(raw))
+		}
+	}
+	for key, urls := range map[string][]string{
+		"export_failover.metrics_export_urls": c.ExportFailover.MetricsExportUrls,
+		"export_failover.logs_export_urls":    c.ExportFailover.LogsExportUrls,
+	} {
+		for _, raw := range urls {
+			if !validURL(raw) {
+				return fmt.Errorf("invalid %s %q", key, maskURL(raw))
+			}
+		}
+	}
+	return nil
+}
+
+// ValidateMetricsExportFormat checks a metrics_export_format value, empty
+// means MetricsFormatJSON
+func ValidateMetricsExportFormat(format string) error {
+	switch format {
+	case "", MetricsFormatJSON, MetricsFormatRemoteWrite:
+		return nil
+	}
+	return fmt.Errorf("invalid metrics_export_format %q, expected %s or %s", format, MetricsFormatJSON, MetricsFormatRemoteWrite)
+}
+
+func validURL(raw string) bool {
+	u, err := url.Parse(raw)
+	return err == nil && u.Scheme != "" && u.Host != ""
+}
+
+// Diff lists the settings changed from c to other as "key: old -> new", with
+// the secrets masked. Settings are compared by their top level JSON key.
+func (c Config) Diff(other Config) []string {
+	before, after := jsonFields(c), jsonFields(other)
+	shownBefore, shownAfter := jsonFields(c.Sanitized()), jsonFields(other.Sanitized())
+
+	keys := slices.Sorted(maps.Keys(before))
+	for key := range after {
+		if _, ok := before[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	slices.Sort(keys)
+
+	var changes []string
+	for _, key := range keys {
+		if bytes.Equal(before[key], after[key]) {
+			continue
+		}
+		changes = append(changes, fmt.Sprintf("%s: %s -> %s", key, shown(shownBefore[key]), shown(shownAfter[key])))
+	}
+	return changes
+}
+
+// jsonFields returns the config encoded as JSON, by top level key
+func jsonFields(c Config) map[string]json.RawMessage {
+	fields := make(map[string]json.RawMessage)
+	data, err := json.Marshal(c)
+	if err != nil {
+		return fields
+	}
+	_ = json.Unmarshal(data, &fields)
+	return fields
+}
+
+func shown(value json.RawMessage) string {
+	if value == nil {
+		return "unset"
+	}
+	return string(value)
 }
 
 func Load() (*Config, error) {
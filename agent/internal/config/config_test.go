@@ -0,0 +1,30 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidate(t *testing.T) {
+	assert.NoError(t, (&Config{APIKey: "key", APIUrl: "https://api.simpleobservability.com"}).Validate())
+	assert.ErrorContains(t, (&Config{APIUrl: "https://api.simpleobservability.com"}).Validate(), "missing API key")
+	assert.ErrorContains(t, (&Config{APIKey: "key", MetricsExportUrl: "metrics.example.com"}).Validate(), "invalid metrics_export_url")
+	failover := ExportFailoverConfig{LogsExportUrls: []string{"https://logs.example.com", "logs"}}
+	assert.ErrorContains(t, (&Config{APIKey: "key", ExportFailover: failover}).Validate(), "invalid export_failover.logs_export_urls")
+	assert.ErrorContains(t, (&Config{APIKey: "key", MetricsExportFormat: "protobuf"}).Validate(), "invalid metrics_export_format")
+	assert.NoError(t, (&Config{APIKey: "key", MetricsExportFormat: MetricsFormatRemoteWrite}).Validate())
+}
+
+func TestDiff(t *testing.T) {
+	before := Config{APIKey: "sk_live_0123456789abcd", APIUrl: "https://api.simpleobservability.com"}
+	after := before
+	assert.Empty(t, before.Diff(after))
+
+	after.APIKey = "sk_live_9999999999abcd"
+	after.Tags = map[string]string{"env": "prod"}
+	assert.Equal(t, []string{
+		`api_key: "********abcd" -> "********abcd"`,
+		`tags: unset -> {"env":"prod"}`,
+	}, before.Diff(after))
+}
@@ -0,0 +1,103 @@
+package config
+
+import (
+	"net/url"
+	"slices"
+)
+
+// secretMask replaces secrets in sanitized configurations
+const secretMask = "********"
+
+// Sanitized returns a copy of the configuration with every secret masked,
+// safe to show outside of the host. The API key keeps its last four
+// characters so that support can tell which key is in use.
+func (c Config) Sanitized() Config {
+	s := c
+	s.APIKey = maskAPIKey(c.APIKey)
+	s.APIUrl = maskURL(c.APIUrl)
+	s.LogsExportUrl = maskURL(c.LogsExportUrl)
+	s.MetricsExportUrl = maskURL(c.MetricsExportUrl)
+	s.GRPCExportUrl = maskURL(c.GRPCExportUrl)
+	s.ExportFailover.MetricsExportUrls = maskURLs(c.ExportFailover.MetricsExportUrls)
+	s.ExportFailover.LogsExportUrls = maskURLs(c.ExportFailover.LogsExportUrls)
+	s.SupervisordURL = maskURL(c.SupervisordURL)
+	s.OTLPExport.Endpoint = maskURL(c.OTLPExport.Endpoint)
+	if c.OTLPExport.Headers != nil {
+		// Typically carry a token
+		s.OTLPExport.Headers = make(map[string]string, len(c.OTLPExport.Headers))
+		for name, value := range c.OTLPExport.Headers {
+			s.OTLPExport.Headers[name] = mask(value)
+		}
+	}
+
+	s.ScrapeTargets = slices.Clone(c.ScrapeTargets)
+	for i := range s.ScrapeTargets {
+		s.ScrapeTargets[i].URL = maskURL(s.ScrapeTargets[i].URL)
+	}
+
+	s.JolokiaTargets = slices.Clone(c.JolokiaTargets)
+	for i := range s.JolokiaTargets {
+		s.JolokiaTargets[i].URL = maskURL(s.JolokiaTargets[i].URL)
+		s.JolokiaTargets[i].Password = mask(s.JolokiaTargets[i].Password)
+	}
+
+	s.SNMPTargets = slices.Clone(c.SNMPTargets)
+	for i := range s.SNMPTargets {
+		s.SNMPTargets[i].Community = mask(s.SNMPTargets[i].Community)
+		s.SNMPTargets[i].AuthPassword = mask(s.SNMPTargets[i].AuthPassword)
+		s.SNMPTargets[i].PrivPassword = mask(s.SNMPTargets[i].PrivPassword)
+	}
+
+	if c.Elasticsearch != nil {
+		es := *c.Elasticsearch
+		es.URL = maskURL(es.URL)
+		es.Password = mask(es.Password)
+		es.APIKey = mask(es.APIKey)
+		s.Elasticsearch = &es
+	}
+
+	s.KafkaClusters = slices.Clone(c.KafkaClusters)
+	for i := range s.KafkaClusters {
+		s.KafkaClusters[i].Password = mask(s.KafkaClusters[i].Password)
+	}
+
+	return s
+}
+
+func mask(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	return secretMask
+}
+
+func maskAPIKey(key string) string {
+	if len(key) <= 8 {
+		return mask(key)
+	}
+	return secretMask + key[len(key)-4:]
+}
+
+// maskURL masks the password embedded in a URL, if any. Strings that don't
+// parse as URLs are masked entirely since they can't be checked.
+func maskURL(raw string) string {
+	if raw == "" {
+		return ""
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return secretMask
+	}
+	return u.Redacted()
+}
+
+func maskURLs(urls []string) []string {
+	if urls == nil {
+		return nil
+	}
+	masked := make([]string, len(urls))
+	for i, raw := range urls {
+		masked[i] = maskURL(raw)
+	}
+	return masked
+}
@@ -0,0 +1,155 @@
+package exporter
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"agent/internal/logger"
+)
+
+// Headers identifying the batches of a stream, so that the backend can drop a
+// batch it already received
+const (
+	batchSequenceHeader = "X-Batch-Sequence"
+	batchAckedHeader    = "X-Batch-Acked"
+)
+
+// batchLog persists the batch being sent on a stream with its sequence. A
+// batch sent again, after a timeout or a crash right after the send, keeps
+// its sequence so the duplicate can be dropped by the backend. The sequences
+// of a stream increase monotonically across restarts.
+type batchLog struct {
+	path  string
+	state batchState
+}
+
+type batchState struct {
+	// Next is the sequence of the next batch, starting at 1
+	Next uint64 `json:"next"`
+	// Acked is the sequence of the last batch accepted by the backend
+	Acked   uint64        `json:"acked"`
+	Pending *pendingBatch `json:"pending,omitempty"`
+}
+
+// pendingBatch is a batch taken from the spool and not acknowledged yet
+type pendingBatch struct {
+	Sequence uint64            `json:"sequence"`
+	Payloads []json.RawMessage `json:"payloads"`
+}
+
+// loadBatchLog reads the batch log of a stream, a missing or corrupted log
+// starts the sequences over
+func loadBatchLog(dir, stream string) *batchLog {
+	l := &batchLog{path: filepath.Join(dir, stream+".batch"), state: batchState{Next: 1}}
+	data, err := os.ReadFile(l.path)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			logger.Log.Warn("failed to read the batch log", "stream", stream, "error", err)
+		}
+		return l
+	}
+	var state batchState
+	if err := json.Unmarshal(data, &state); err != nil || state.Next == 0 {
+		logger.Log.Warn("ignoring corrupted batch log", "stream", stream, "error", err)
+		return l
+	}
+	l.state = state
+	return l
+}
+
+// pending returns the batch left unacknowledged, nil when there's none
+func (l *batchLog) pending(unmarshal func([]byte) (Payload, error)) ([]Payload, uint64) {
+	if l.state.Pending == nil {
+		return nil, 0
+	}
+	payloads := make([]Payload, 0, len(l.state.Pending.Payloads))
+	for _, data := range l.state.Pending.Payloads {
+		p, err := unmarshal(data)
+		if err != nil {
+			logger.Log.Error("failed to unmarshal pending batch entry", "line", string(data), "error", err)
+			continue
+		}
+		payloads = append(payloads, p)
+	}
+	return payloads, l.state.Pending.Sequence
+}
+
+// pendingLen returns the number of payloads of the pending batch
+func (l *batchLog) pendingLen() int64 {
+	if l.state.Pending == nil {
+		return 0
+	}
+	return int64(len(l.state.Pending.Payloads))
+}
+
+// begin assigns the next sequence to a batch and persists it before it's
+// sent
+func (l *batchLog) begin(payloads []Payload) (uint64, error) {
+	raw := make([]json.RawMessage, 0, len(payloads))
+	for _, p := range payloads {
+		data, err := json.Marshal(p)
+		if err != nil {
+			return 0, fmt.Errorf("failed to marshal payload: %w", err)
+		}
+		raw = append(raw, data)
+	}
+	state := l.state
+	state.Pending = &pendingBatch{Sequence: state.Next, Payloads: raw}
+	state.Next++
+	if err := l.save(state); err != nil {
+		return 0, err
+	}
+	return state.Pending.Sequence, nil
+}
+
+// ack records that the pending batch was accepted. It isn't sent again on
+// this run even if the log can't be written, after a restart the backend
+// drops the duplicate.
+func (l *batchLog) ack(sequence uint64) error {
+	state := l.state
+	state.Acked = sequence
+	state.Pending = nil
+	err := l.save(state)
+	l.state = state
+	return err
+}
+
+// drop discards the pending batch without acknowledging it, once it was
+// rejected by the backend or expired
+func (l *batchLog) drop() error {
+	state := l.state
+	state.Pending = nil
+	err := l.save(state)
+	l.state = state
+	return err
+}
+
+// headers returns the headers identifying a batch
+func (l *batchLog) headers(sequence uint64) http.Header {
+	return http.Header{
+		batchSequenceHeader: {strconv.FormatUint(sequence, 10)},
+		batchAckedHeader:    {strconv.FormatUint(l.state.Acked, 10)},
+	}
+}
+
+// save replaces the log atomically, the state is only kept once on disk
+func (l *batchLog) save(state batchState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	tmp := l.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o660); err != nil {
+		return fmt.Errorf("write batch log: %w", err)
+	}
+	if err := os.Rename(tmp, l.path); err != nil {
+		return fmt.Errorf("replace batch log: %w", err)
+	}
+	l.state = state
+	return nil
+}
@@ -0,0 +1,190 @@
+package exporter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"agent/internal/config"
+	"agent/internal/logger"
+	"agent/internal/selfstats"
+)
+
+func TestFlusher_BatchSequences(t *testing.T) {
+	logger.Init(false)
+	var sequences, acked []string
+	status := http.StatusServiceUnavailable
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sequences = append(sequences, r.Header.Get(batchSequenceHeader))
+		acked = append(acked, r.Header.Get(batchAckedHeader))
+		w.WriteHeader(status)
+	}))
+	defer ts.Close()
+
+	dir := t.TempDir()
+	settings := DefaultSettings()
+	settings.MaxSendAttempts = 1
+	newTestFlusher := func() (*spool, *flusher) {
+		s, err := newSpool(withDirectory(dir))
+		require.NoError(t, err)
+		f, err := newFlusher(s, &config.Config{APIKey: "key", MetricsExportUrl: ts.URL}, settings, false)
+		require.NoError(t, err)
+		return s, f
+	}
+	cfg := func(f *flusher) payloadConfig {
+		return payloadConfig{name: metricsQueueName, endpoints: f.metrics, unmarshal: unmarshalMetric}
+	}
+
+	s, f := newTestFlusher()
+	now := strconv.FormatInt(time.Now().UnixMilli(), 10)
+	require.NoError(t, s.append(MetricPayload{Timestamp: now, Name: "m1"}))
+	_, err := f.flushOnce(cfg(f))
+	require.Error(t, err)
+
+	// The failed batch is sent again with its sequence, after a restart
+	s, f = newTestFlusher()
+	require.NoError(t, s.append(MetricPayload{Timestamp: now, Name: "m2"}))
+	status = http.StatusNoContent
+	hasMore, err := f.flushOnce(cfg(f))
+	require.NoError(t, err)
+	assert.True(t, hasMore)
+	_, err = f.flushOnce(cfg(f))
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"1", "1", "2"}, sequences)
+	assert.Equal(t, []string{"0", "0", "1"}, acked)
+	entries, _ := s.queueStats(metricsQueueName, unmarshalMetric)
+	assert.Zero(t, entries)
+}
+
+func TestBatchLog_Reload(t *testing.T) {
+	dir := t.TempDir()
+	l := loadBatchLog(dir, logsQueueName)
+	seq, err := l.begin([]Payload{LogPayload{Message: "hello"}})
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1), seq)
+
+	reloaded := loadBatchLog(dir, logsQueueName)
+	payloads, seq := reloaded.pending(unmarshalLog)
+	assert.Equal(t, uint64(1), seq)
+	require.Len(t, payloads, 1)
+	assert.Equal(t, "hello", payloads[0].(LogPayload).Message)
+
+	require.NoError(t, os.WriteFile(reloaded.path, []byte("{"), 0o660))
+	assert.Equal(t, uint64(1), loadBatchLog(dir, logsQueueName).state.Next)
+}
+
+func TestFlusher_RejectedBatch(t *testing.T) {
+	logger.Init(false)
+	selfstats.Reset()
+	defer selfstats.Reset()
+	var sequences []string
+	status := http.StatusServiceUnavailable
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sequences = append(sequences, r.Header.Get(batchSequenceHeader))
+		w.WriteHeader(status)
+	}))
+	defer ts.Close()
+
+	settings := DefaultSettings()
+	settings.MaxSendAttempts = 1
+	s, err := newSpool(withDirectory(t.TempDir()))
+	require.NoError(t, err)
+	defer s.close()
+	f, err := newFlusher(s, &config.Config{APIKey: "key", MetricsExportUrl: ts.URL}, settings, false)
+	require.NoError(t, err)
+	cfg := payloadConfig{name: metricsQueueName, endpoints: f.metrics, unmarshal: unmarshalMetric}
+
+	now := strconv.FormatInt(time.Now().UnixMilli(), 10)
+	require.NoError(t, s.append(MetricPayload{Timestamp: now, Name: "too_large"}))
+	_, err = f.flushOnce(cfg)
+	require.Error(t, err)
+
+	// The pending batch is dropped instead of wedging the stream
+	status = http.StatusRequestEntityTooLarge
+	_, err = f.flushOnce(cfg)
+	require.NoError(t, err)
+	assert.Zero(t, s.batches[metricsQueueName].pendingLen())
+	assert.Equal(t, float64(1), selfstats.NewCounter("export_rejected_total", map[string]string{"stream": metricsQueueName}).Value())
+
+	status = http.StatusNoContent
+	require.NoError(t, s.append(MetricPayload{Timestamp: now, Name: "next"}))
+	_, err = f.flushOnce(cfg)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"1", "1", "2"}, sequences)
+
+	_, seq := loadBatchLog(filepath.Dir(s.batches[metricsQueueName].path), metricsQueueName).pending(unmarshalMetric)
+	assert.Zero(t, seq)
+}
+
+func TestFlusher_ExpiredPendingBatch(t *testing.T) {
+	logger.Init(false)
+	selfstats.Reset()
+	defer selfstats.Reset()
+	var requests int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer ts.Close()
+
+	// Left pending by a run stopped during a long outage
+	dir := t.TempDir()
+	weekend := strconv.FormatInt(time.Now().Add(-72*time.Hour).UnixMilli(), 10)
+	_, err := loadBatchLog(dir, logsQueueName).begin([]Payload{LogPayload{Timestamp: weekend, Message: "expired"}})
+	require.NoError(t, err)
+
+	s, err := newSpool(withDirectory(dir), withMaxAge(map[string]float64{logsQueueName: 1}))
+	require.NoError(t, err)
+	defer s.close()
+	f, err := newFlusher(s, &config.Config{APIKey: "key", LogsExportUrl: ts.URL}, DefaultSettings(), false)
+	require.NoError(t, err)
+
+	hasMore, err := f.flushOnce(payloadConfig{name: logsQueueName, endpoints: f.logs, unmarshal: unmarshalLog})
+	require.NoError(t, err)
+	assert.True(t, hasMore)
+	assert.Zero(t, requests)
+	assert.Zero(t, s.batches[logsQueueName].pendingLen())
+	assert.Equal(t, float64(1), selfstats.NewCounter("spool_expired_total", map[string]string{"stream": logsQueueName}).Value())
+}
+
+func TestFlusher_UntrackedBatches(t *testing.T) {
+	logger.Init(false)
+	var sequences []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sequences = append(sequences, r.Header.Get(batchSequenceHeader))
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer ts.Close()
+
+	dir := t.TempDir()
+	s, err := newSpool(withDirectory(dir), withInMemory([]string{metricsQueueName}))
+	require.NoError(t, err)
+	defer s.close()
+	f, err := newFlusher(s, &config.Config{APIKey: "key", MetricsExportUrl: ts.URL, LogsExportUrl: ts.URL}, DefaultSettings(), false)
+	require.NoError(t, err)
+
+	now := strconv.FormatInt(time.Now().UnixMilli(), 10)
+	// Kept in memory, the batches aren't written to the disk either
+	require.NoError(t, s.append(MetricPayload{Timestamp: now, Name: "in_memory"}))
+	_, err = f.flushOnce(payloadConfig{name: metricsQueueName, endpoints: f.metrics, unmarshal: unmarshalMetric})
+	require.NoError(t, err)
+	assert.NoFileExists(t, filepath.Join(dir, metricsQueueName+".batch"))
+
+	// Nor while the spool directory can't be written
+	s.memory.activate(&os.PathError{Op: "open", Path: "logs.jsonl", Err: syscall.EROFS})
+	require.NoError(t, s.append(LogPayload{Timestamp: now, Message: "read-only"}))
+	_, err = f.flushOnce(payloadConfig{name: logsQueueName, endpoints: f.logs, unmarshal: unmarshalLog})
+	require.NoError(t, err)
+	assert.NoFileExists(t, filepath.Join(dir, logsQueueName+".batch"))
+
+	assert.Equal(t, []string{"", ""}, sequences)
+}
@@ -0,0 +1,273 @@
+package exporter
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"agent/internal/common"
+	"agent/internal/config"
+	"agent/internal/logger"
+	"agent/internal/selfstats"
+)
+
+const (
+	defaultSpoolSizeMB = 512
+	defaultOutageHours = 24
+	// rateWindow is the time constant of the moving average of the rates
+	rateWindow = 15 * time.Minute
+	// minQuotaShare is the smallest share of the spool given to a stream, so
+	// that a quiet stream still has room when it gets busy
+	minQuotaShare = 0.1
+	// ratesFileName is the file, in the spool directory, where the agent
+	// saves the measured rates for "simob spool estimate"
+	ratesFileName     = "rates.json"
+	ratesSaveInterval = time.Minute
+)
+
+// errSpoolFull is returned when a payload doesn't fit in the quota of its
+// stream. It's dropped, the spool keeps the oldest payloads.
+var errSpoolFull = errors.New("spool quota exceeded")
+
+// spoolBudget splits the disk space of the spool between the streams, in
+// proportion to the rate at which they're spooled, so that both can absorb
+// the same outage of the backend.
+type spoolBudget struct {
+	maxBytes  int64
+	outage    time.Duration
+	ratesPath string
+	now       func() time.Time
+	dropped   map[string]*selfstats.Counter
+
+	mu sync.Mutex
+	// size is the backlog of each stream, measured on each flush and
+	// increased by each append in between
+	size map[string]int64
+	// appended is the number of bytes spooled since the rate was updated
+	appended map[string]int64
+	// rates is the moving average of the spooled bytes per second
+	rates     map[string]float64
+	quota     map[string]int64
+	updated   map[string]time.Time
+	saved     time.Time
+	shortfall bool
+}
+
+func newSpoolBudget(cfg config.SpoolConfig, directory string) *spoolBudget {
+	maxBytes, outage := spoolLimits(cfg)
+	ratesPath := filepath.Join(directory, ratesFileName)
+	rates := loadRates(ratesPath)
+	return &spoolBudget{
+		maxBytes:  maxBytes,
+		outage:    outage,
+		ratesPath: ratesPath,
+		now:       time.Now,
+		size:      make(map[string]int64),
+		appended:  make(map[string]int64),
+		rates:     rates,
+		quota:     quotas(maxBytes, rates),
+		updated:   make(map[string]time.Time),
+		dropped: map[string]*selfstats.Counter{
+			metricsQueueName: selfstats.NewCounter("spool_dropped_total", map[string]string{"stream": metricsQueueName}),
+			logsQueueName:    selfstats.NewCounter("spool_dropped_total", map[string]string{"stream": logsQueueName}),
+		},
+	}
+}
+
+func spoolLimits(cfg config.SpoolConfig) (int64, time.Duration) {
+	sizeMB := cfg.MaxSizeMB
+	if sizeMB <= 0 {
+		sizeMB = defaultSpoolSizeMB
+	}
+	hours := cfg.OutageHours
+	if hours <= 0 {
+		hours = defaultOutageHours
+	}
+	return int64(sizeMB) << 20, time.Duration(hours * float64(time.Hour))
+}
+
+// reserve accounts for n bytes appended to a stream, or returns errSpoolFull
+// when they don't fit in its quota
+func (b *spoolBudget) reserve(stream string, n int) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	// Measured whether spooled or not, the rate is what the host produces
+	b.appended[stream] += int64(n)
+	if b.size[stream]+int64(n) > b.quota[stream] {
+		b.dropped[stream].Inc()
+		return errSpoolFull
+	}
+	b.size[stream] += int64(n)
+	return nil
+}
+
+// update records the backlog of a stream after a flush, updates its rate and
+// reports the outage the spool can still absorb at that rate
+func (b *spoolBudget) update(stream string, backlog int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := b.now()
+	b.size[stream] = backlog
+
+	if last, ok := b.updated[stream]; ok {
+		if elapsed := now.Sub(last); elapsed > 0 {
+			rate := float64(b.appended[stream]) / elapsed.Seconds()
+			alpha := 1 - math.Exp(-elapsed.Seconds()/rateWindow.Seconds())
+			b.rates[stream] += alpha * (rate - b.rates[stream])
+		}
+	}
+	b.updated[stream] = now
+	b.appended[stream] = 0
+	b.quota = quotas(b.maxBytes, b.rates)
+
+	quota := b.quota[stream]
+	labels := map[string]string{"stream": stream}
+	selfstats.NewGauge("spool_quota_bytes", labels).Set(float64(quota))
+	if rate := b.rates[stream]; rate > 0 {
+		selfstats.NewGauge("spool_outage_headroom_hours", labels).Set(float64(max(quota-backlog, 0)) / rate / 3600)
+	}
+	b.checkShortfall()
+
+	if now.Sub(b.saved) >= ratesSaveInterval {
+		b.saved = now
+		if err := saveRates(b.ratesPath, b.rates); err != nil {
+			logger.Log.Debug("failed to save spool rates", "error", err)
+		}
+	}
+}
+
+// checkShortfall logs once when the spool can't absorb the configured outage
+// at the current rates, and once when it can again
+func (b *spoolBudget) checkShortfall() {
+	needed := neededBytes(b.rates, b.outage)
+	shortfall := needed > b.maxBytes
+	if shortfall && !b.shortfall {
+		logger.Log.Warn("Spool too small for the configured outage at the current rates",
+			"outage", b.outage, "size_mb", b.maxBytes>>20, "needed_mb", needed>>20)
+	} else if !shortfall && b.shortfall {
+		logger.Log.Info("Spool large enough for the configured outage again", "outage", b.outage)
+	}
+	b.shortfall = shortfall
+}
+
+// quotas splits maxBytes between the metrics and logs streams in proportion
+// to their rates, each getting at least minQuotaShare
+func quotas(maxBytes int64, rates map[string]float64) map[string]int64 {
+	streams := []string{metricsQueueName, logsQueueName}
+	var total float64
+	for _, stream := range streams {
+		total += rates[stream]
+	}
+	shares := make(map[string]float64, len(streams))
+	var sum float64
+	for _, stream := range streams {
+		share := 1 / float64(len(streams))
+		if total > 0 {
+			share = max(rates[stream]/total, minQuotaShare)
+		}
+		shares[stream] = share
+		sum += share
+	}
+	result := make(map[string]int64, len(streams))
+	for _, stream := range streams {
+		result[stream] = int64(float64(maxBytes) * shares[stream] / sum)
+	}
+	return result
+}
+
+// neededBytes is the spool size absorbing the outage at the rates
+func neededBytes(rates map[string]float64, outage time.Duration) int64 {
+	var needed float64
+	for _, rate := range rates {
+		needed += rate * outage.Seconds()
+	}
+	return int64(needed)
+}
+
+func loadRates(path string) map[string]float64 {
+	rates := make(map[string]float64)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return rates
+	}
+	var saved struct {
+		Rates map[string]float64 `json:"rates"`
+	}
+	if err := json.Unmarshal(data, &saved); err == nil && saved.Rates != nil {
+		rates = saved.Rates
+	}
+	return rates
+}
+
+func saveRates(path string, rates map[string]float64) error {
+	data, err := json.Marshal(struct {
+		Rates   map[string]float64 `json:"rates"`
+		Updated time.Time          `json:"updated"`
+	}{rates, time.Now()})
+	if err != nil {
+		return err
+	}
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0o660); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
+
+// SpoolStreamEstimate is the outage a stream of the spool can absorb
+type SpoolStreamEstimate struct {
+	Stream string
+	// Rate is the number of bytes spooled per second, as measured by the
+	// running agent
+	Rate    float64
+	Quota   int64
+	Backlog int64
+	// Capacity is the outage absorbed by the quota, zero when the rate is
+	// unknown
+	Capacity time.Duration
+}
+
+// SpoolEstimate sizes the spool of the program directory for an outage
+type SpoolEstimate struct {
+	MaxBytes int64
+	Outage   time.Duration
+	// Needed is the spool size absorbing Outage at the measured rates
+	Needed  int64
+	Streams []SpoolStreamEstimate
+}
+
+// EstimateSpool computes the outage the spool can absorb with the config,
+// from the rates last saved by the agent.
+func EstimateSpool(cfg config.SpoolConfig) (SpoolEstimate, error) {
+	programDirectory, err := common.GetProgramDirectory()
+	if err != nil {
+		return SpoolEstimate{}, err
+	}
+	dir := filepath.Join(programDirectory, "spool")
+	rates := loadRates(filepath.Join(dir, ratesFileName))
+	if len(rates) == 0 {
+		return SpoolEstimate{}, fmt.Errorf("no rate measured yet, the agent saves them after running for a minute")
+	}
+
+	maxBytes, outage := spoolLimits(cfg)
+	estimate := SpoolEstimate{MaxBytes: maxBytes, Outage: outage, Needed: neededBytes(rates, outage)}
+	quota := quotas(maxBytes, rates)
+	for _, stream := range []string{metricsQueueName, logsQueueName} {
+		s := SpoolStreamEstimate{
+			Stream:  stream,
+			Rate:    rates[stream],
+			Quota:   quota[stream],
+			Backlog: newJSONLQueue(stream, dir).Size(),
+		}
+		if s.Rate > 0 {
+			s.Capacity = time.Duration(float64(s.Quota) / s.Rate * float64(time.Second))
+		}
+		estimate.Streams = append(estimate.Streams, s)
+	}
+	return estimate, nil
+}
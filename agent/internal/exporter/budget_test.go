@@ -0,0 +1,92 @@
+package exporter
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"agent/internal/common"
+	"agent/internal/config"
+	"agent/internal/logger"
+	"agent/internal/selfstats"
+)
+
+func TestQuotas(t *testing.T) {
+	// Evenly split until the rates are known
+	assert.Equal(t, map[string]int64{metricsQueueName: 500, logsQueueName: 500}, quotas(1000, nil))
+
+	assert.Equal(t, map[string]int64{metricsQueueName: 250, logsQueueName: 750},
+		quotas(1000, map[string]float64{metricsQueueName: 1, logsQueueName: 3}))
+
+	// A quiet stream keeps a minimal share
+	q := quotas(1100, map[string]float64{metricsQueueName: 100})
+	assert.InDelta(t, 1000, q[metricsQueueName], 1)
+	assert.InDelta(t, 100, q[logsQueueName], 1)
+}
+
+func TestSpoolBudget(t *testing.T) {
+	logger.Init(false)
+	selfstats.Reset()
+	defer selfstats.Reset()
+
+	dir := t.TempDir()
+	s, err := newSpool(withDirectory(dir), withBudget(config.SpoolConfig{MaxSizeMB: 1, OutageHours: 1}))
+	require.NoError(t, err)
+	now := time.Now()
+	s.budget.now = func() time.Time { return now }
+	s.budget.update(metricsQueueName, 0)
+
+	// The half of 1 MB given to metrics fills up, the newest payloads are
+	// dropped
+	payload := MetricPayload{Name: "test_metric", Timestamp: "1700000000000", Labels: map[string]string{"padding": strings.Repeat("x", 1000)}}
+	var dropped int
+	for range 1000 {
+		if err := s.append(payload); err != nil {
+			assert.ErrorIs(t, err, errSpoolFull)
+			dropped++
+		}
+	}
+	assert.Positive(t, dropped)
+	assert.LessOrEqual(t, s.backlog(metricsQueueName), int64(1<<19))
+	assert.Equal(t, float64(dropped), selfstats.NewCounter("spool_dropped_total", map[string]string{"stream": metricsQueueName}).Value())
+
+	// Payloads that couldn't be sent go back regardless
+	require.NoError(t, s.putBack(payload))
+
+	// The rate includes the dropped payloads, the spool is too small for an
+	// hour at that rate
+	now = now.Add(time.Minute)
+	s.budget.update(metricsQueueName, s.backlog(metricsQueueName))
+	assert.Positive(t, s.budget.rates[metricsQueueName])
+	assert.True(t, s.budget.shortfall)
+	assert.FileExists(t, filepath.Join(dir, ratesFileName))
+}
+
+func TestEstimateSpool(t *testing.T) {
+	dir := t.TempDir()
+	common.SetProgramDirectory(dir)
+	t.Cleanup(func() { common.SetProgramDirectory("") })
+
+	_, err := EstimateSpool(config.SpoolConfig{})
+	assert.Error(t, err, "no rates saved yet")
+
+	// 1 MB per hour of metrics, 9 of logs
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "spool"), 0o770))
+	require.NoError(t, saveRates(filepath.Join(dir, "spool", ratesFileName), map[string]float64{
+		metricsQueueName: float64(1<<20) / 3600,
+		logsQueueName:    float64(9<<20) / 3600,
+	}))
+
+	estimate, err := EstimateSpool(config.SpoolConfig{MaxSizeMB: 100, OutageHours: 24})
+	require.NoError(t, err)
+	assert.Equal(t, int64(240<<20), estimate.Needed)
+	require.Len(t, estimate.Streams, 2)
+	assert.Equal(t, metricsQueueName, estimate.Streams[0].Stream)
+	assert.InDelta(t, 10, estimate.Streams[0].Capacity.Hours(), 0.01)
+	assert.InDelta(t, 10, estimate.Streams[1].Capacity.Hours(), 0.01)
+}
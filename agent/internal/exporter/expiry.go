@@ -0,0 +1,67 @@
+package exporter
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"agent/internal/logger"
+	"agent/internal/selfstats"
+)
+
+// expiry counts the payloads dropped from the spool because they're older
+// than the max age of their stream. The ones of a flush are summed up in a
+// single event, so that the data lost after a long outage isn't a surprise.
+type expiry struct {
+	mu      sync.Mutex
+	pending map[string]*expired
+}
+
+type expired struct {
+	count          int
+	oldest, newest int64
+}
+
+func newExpiry() *expiry {
+	return &expiry{pending: make(map[string]*expired)}
+}
+
+// add records an expired payload of a stream, timestamp in milliseconds
+func (e *expiry) add(stream string, timestamp int64) {
+	selfstats.NewCounter("spool_expired_total", map[string]string{"stream": stream}).Inc()
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	p := e.pending[stream]
+	if p == nil {
+		p = &expired{oldest: timestamp, newest: timestamp}
+		e.pending[stream] = p
+	}
+	p.count++
+	p.oldest = min(p.oldest, timestamp)
+	p.newest = max(p.newest, timestamp)
+}
+
+// summary returns the event summing up the payloads of a stream expired since
+// the last call, nil when none did
+func (e *expiry) summary(stream string, maxAge time.Duration) *LogPayload {
+	e.mu.Lock()
+	p := e.pending[stream]
+	delete(e.pending, stream)
+	e.mu.Unlock()
+	if p == nil {
+		return nil
+	}
+	oldest, newest := time.UnixMilli(p.oldest), time.UnixMilli(p.newest)
+	logger.Log.Warn("Payloads expired in the spool", "stream", stream, "count", p.count, "max_age", maxAge,
+		"oldest", oldest, "newest", newest)
+	event := AgentEvent("spool_expired",
+		fmt.Sprintf("%d %s payloads older than %s expired in the spool, from %s to %s", p.count, stream, maxAge,
+			oldest.UTC().Format(time.RFC3339), newest.UTC().Format(time.RFC3339)),
+		map[string]string{
+			"stream":          stream,
+			"count":           strconv.Itoa(p.count),
+			"max_age_seconds": strconv.Itoa(int(maxAge.Seconds())),
+		})
+	return &event
+}
@@ -1,10 +1,14 @@
 package exporter
 
 import (
+	"errors"
 	"fmt"
+	"strconv"
+	"time"
 
 	"agent/internal/config"
 	"agent/internal/logger"
+	"agent/internal/tags"
 )
 
 // Payload interface for generic handling
@@ -21,6 +25,9 @@ type MetricPayload struct {
 }
 
 // LogPayload represents the structure required for log data export.
+// Labels are indexed and must have a low cardinality. Metadata holds the
+// other fields of the entry, it is stored but not indexed. Payloads are cut
+// to the Max* limits when exported.
 type LogPayload struct {
 	Timestamp string            `json:"timestamp"` // Unix timestamp in milliseconds as a string
 	Labels    map[string]string `json:"labels"`
@@ -31,25 +38,38 @@ type LogPayload struct {
 func (m MetricPayload) GetTimestamp() string { return m.Timestamp }
 func (l LogPayload) GetTimestamp() string    { return l.Timestamp }
 
+// AgentEvent returns an event of the agent itself, labelled with source=agent
+// and the event name
+func AgentEvent(event, message string, metadata map[string]string) LogPayload {
+	return LogPayload{
+		Timestamp: strconv.FormatInt(time.Now().UnixMilli(), 10),
+		Labels:    map[string]string{"source": "agent", "event": event},
+		Metadata:  metadata,
+		Message:   message,
+	}
+}
+
 // Exporter handles sending metrics and logs to remote storage.
 type Exporter struct {
-	spool   *spool
-	flusher *flusher
+	spool    *spool
+	flusher  *flusher
+	hostTags map[string]string
+	sinks    []Sink
 }
 
 // NewExporter creates a new Exporter instance.
 // It loads configuration and initializes the HTTP client.
-func NewExporter(cfg *config.Config, dryRun bool) (*Exporter, error) {
-	return newExporter(cfg, dryRun, true)
+func NewExporter(cfg *config.Config, settings Settings, dryRun bool) (*Exporter, error) {
+	return newExporter(cfg, settings, dryRun, true, withSettings(settings), withBudget(cfg.Spool), withReplay(cfg.Spool), withMaxAge(cfg.Spool.MaxAgeHours), withInMemory(cfg.Spool.InMemory))
 }
 
 // NewExporterWithoutFlusher creates a new Exporter instance that only spools payloads.
 // Exported payloads are persisted locally until another process flushes the spool.
 func NewExporterWithoutFlusher() (*Exporter, error) {
-	return newExporter(nil, false, false)
+	return newExporter(nil, DefaultSettings(), false, false)
 }
 
-func newExporter(cfg *config.Config, dryRun bool, startFlusher bool, opts ...spoolOption) (*Exporter, error) {
+func newExporter(cfg *config.Config, settings Settings, dryRun bool, startFlusher bool, opts ...spoolOption) (*Exporter, error) {
 	spool, err := newSpool(opts...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create spool instance: %w", err)
@@ -60,7 +80,7 @@ func newExporter(cfg *config.Config, dryRun bool, startFlusher bool, opts ...spo
 		return e, nil
 	}
 
-	flusher, err := newFlusher(spool, cfg, dryRun)
+	flusher, err := newFlusher(spool, cfg, settings, dryRun)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create flusher instance: %w", err)
 	}
@@ -70,15 +90,31 @@ func newExporter(cfg *config.Config, dryRun bool, startFlusher bool, opts ...spo
 	return e, nil
 }
 
+// SetHostTags sets the host tags added to the labels of every exported
+// payload. Labels already set on a payload are never overridden.
+func (e *Exporter) SetHostTags(hostTags map[string]string) {
+	e.hostTags = hostTags
+}
+
 // ExportMetric sends a batch of metrics to the configured metrics endpoint.
 // The metrics should already be in the MetricPayload format.
 func (e *Exporter) ExportMetric(metrics []MetricPayload) error {
 	var failed int
+	exported := make([]MetricPayload, 0, len(metrics))
 	for _, metric := range metrics {
+		metric = limitMetricPayload(metric)
+		metric.Labels = tags.Apply(metric.Labels, e.hostTags)
 		if err := e.spool.append(metric); err != nil {
 			failed++
-			logger.Log.Error("failed to append metric to spool", "error", err)
+			// Drops over the quota are counted in spool_dropped_total
+			if !errors.Is(err, errSpoolFull) {
+				logger.Log.Error("failed to append metric to spool", "error", err)
+			}
 		}
+		exported = append(exported, metric)
+	}
+	for _, sink := range e.sinks {
+		sink.WriteMetrics(exported)
 	}
 	logger.Log.Debug("Appended metrics to spool", "count", len(metrics), "failed", failed)
 	if failed > 0 {
@@ -91,11 +127,21 @@ func (e *Exporter) ExportMetric(metrics []MetricPayload) error {
 // The logs should already be in the LogPayload format.
 func (e *Exporter) ExportLog(logs []LogPayload) error {
 	var failed int
+	exported := make([]LogPayload, 0, len(logs))
 	for _, log := range logs {
+		log = limitLogPayload(log)
+		log.Labels = tags.Apply(log.Labels, e.hostTags)
 		if err := e.spool.append(log); err != nil {
 			failed++
-			logger.Log.Error("failed to append log to spool", "error", err)
+			// Drops over the quota are counted in spool_dropped_total
+			if !errors.Is(err, errSpoolFull) {
+				logger.Log.Error("failed to append log to spool", "error", err)
+			}
 		}
+		exported = append(exported, log)
+	}
+	for _, sink := range e.sinks {
+		sink.WriteLogs(exported)
 	}
 	logger.Log.Debug("Appended logs to spool", "count", len(logs), "failed", failed)
 	if failed > 0 {
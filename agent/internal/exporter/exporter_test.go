@@ -77,7 +77,7 @@ func TestNewExporterWithoutFlusher(t *testing.T) {
 	require.NoError(t, err)
 	defer os.RemoveAll(tempDir)
 
-	e, err := newExporter(nil, false, false, withDirectory(tempDir))
+	e, err := newExporter(nil, DefaultSettings(), false, false, withDirectory(tempDir))
 	require.NoError(t, err)
 	require.NotNil(t, e)
 	assert.Nil(t, e.flusher)
@@ -0,0 +1,126 @@
+package exporter
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"agent/internal/config"
+	"agent/internal/logger"
+	"agent/internal/selfstats"
+)
+
+const (
+	defaultFailoverAfter = 2 * time.Minute
+	defaultFailbackAfter = 5 * time.Minute
+)
+
+// unreachableError is a send failure caused by the endpoint rather than the
+// payload: a network error or a 5xx response. Only these count toward a
+// failover, a rejected key would be rejected by every endpoint.
+type unreachableError struct {
+	err error
+}
+
+func (e *unreachableError) Error() string { return e.err.Error() }
+func (e *unreachableError) Unwrap() error { return e.err }
+
+// endpoints is the list of export URLs of a stream, in priority order. The
+// flusher sends to the active one, which moves to the next URL once it's been
+// unreachable for failoverAfter. While on a secondary, the primary is tried
+// again every failbackAfter and made active as soon as a send succeeds.
+type endpoints struct {
+	stream        string
+	urls          []string
+	failoverAfter time.Duration
+	failbackAfter time.Duration
+	now           func() time.Time
+
+	mu     sync.Mutex
+	active int
+	// activeSince is when the active URL was selected, or the primary last
+	// tried while on a secondary
+	activeSince time.Time
+	// failingSince is the first of the consecutive failures of the active
+	// URL, zero after a success
+	failingSince time.Time
+}
+
+func newEndpoints(stream string, urls []string, failoverAfter, failbackAfter time.Duration) *endpoints {
+	if failoverAfter <= 0 {
+		failoverAfter = defaultFailoverAfter
+	}
+	if failbackAfter <= 0 {
+		failbackAfter = defaultFailbackAfter
+	}
+	return &endpoints{
+		stream:        stream,
+		urls:          urls,
+		failoverAfter: failoverAfter,
+		failbackAfter: failbackAfter,
+		now:           time.Now,
+	}
+}
+
+// streamEndpoints returns the endpoints of a stream from the primary URL and
+// the failover settings of the config
+func streamEndpoints(stream, primary string, secondaries []string, failover config.ExportFailoverConfig) *endpoints {
+	urls := append([]string{primary}, secondaries...)
+	return newEndpoints(stream, urls,
+		time.Duration(failover.AfterSeconds)*time.Second,
+		time.Duration(failover.FailbackSeconds)*time.Second,
+	)
+}
+
+// next returns the URL to send the next batch to
+func (e *endpoints) next() string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.active > 0 && e.now().Sub(e.activeSince) >= e.failbackAfter {
+		return e.urls[0]
+	}
+	return e.urls[e.active]
+}
+
+// report records the outcome of a send to url, as returned by next
+func (e *endpoints) report(url string, err error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	now := e.now()
+
+	// Failback attempt
+	if e.active > 0 && url == e.urls[0] {
+		if err != nil {
+			e.activeSince = now
+			return
+		}
+		logger.Log.Info("Primary export endpoint reachable again, failing back", "stream", e.stream, "url", url)
+		e.activate(0, now)
+		return
+	}
+
+	if err == nil {
+		e.failingSince = time.Time{}
+		return
+	}
+	var unreachable *unreachableError
+	if !errors.As(err, &unreachable) || len(e.urls) < 2 {
+		return
+	}
+	if e.failingSince.IsZero() {
+		e.failingSince = now
+		return
+	}
+	if now.Sub(e.failingSince) >= e.failoverAfter {
+		next := (e.active + 1) % len(e.urls)
+		logger.Log.Warn("Export endpoint unreachable, failing over", "stream", e.stream, "url", url, "since", e.failingSince, "next", e.urls[next])
+		e.activate(next, now)
+	}
+}
+
+func (e *endpoints) activate(i int, now time.Time) {
+	e.active = i
+	e.activeSince = now
+	e.failingSince = time.Time{}
+	selfstats.NewGauge("export_endpoint_index", map[string]string{"stream": e.stream}).Set(float64(i))
+}
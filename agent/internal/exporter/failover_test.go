@@ -0,0 +1,60 @@
+package exporter
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"agent/internal/logger"
+)
+
+func TestEndpointsFailover(t *testing.T) {
+	logger.Init(true)
+	now := time.Now()
+	e := newEndpoints(metricsQueueName, []string{"https://eu", "https://us"}, time.Minute, 5*time.Minute)
+	e.now = func() time.Time { return now }
+	unreachable := &unreachableError{errors.New("connection refused")}
+
+	// Rejected payloads don't count, the other endpoint would reject them too
+	e.report("https://eu", errors.New("status code: 400"))
+	now = now.Add(2 * time.Minute)
+	e.report("https://eu", errors.New("status code: 400"))
+	assert.Equal(t, "https://eu", e.next())
+
+	// A success resets the unreachable period
+	e.report("https://eu", unreachable)
+	now = now.Add(30 * time.Second)
+	e.report("https://eu", nil)
+	now = now.Add(time.Minute)
+	e.report("https://eu", unreachable)
+	assert.Equal(t, "https://eu", e.next())
+
+	now = now.Add(time.Minute)
+	e.report("https://eu", unreachable)
+	assert.Equal(t, "https://us", e.next())
+
+	// The primary is tried again after the failback period, and kept on
+	// the secondary while still unreachable
+	now = now.Add(5 * time.Minute)
+	assert.Equal(t, "https://eu", e.next())
+	e.report("https://eu", unreachable)
+	assert.Equal(t, "https://us", e.next())
+
+	now = now.Add(5 * time.Minute)
+	assert.Equal(t, "https://eu", e.next())
+	e.report("https://eu", nil)
+	assert.Equal(t, "https://eu", e.next())
+}
+
+func TestEndpointsSingleURL(t *testing.T) {
+	now := time.Now()
+	e := newEndpoints(logsQueueName, []string{"https://eu"}, time.Minute, 0)
+	e.now = func() time.Time { return now }
+	for range 3 {
+		e.report("https://eu", &unreachableError{errors.New("timeout")})
+		now = now.Add(time.Minute)
+	}
+	assert.Equal(t, "https://eu", e.next())
+}
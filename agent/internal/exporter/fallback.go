@@ -0,0 +1,173 @@
+package exporter
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+	"syscall"
+	"time"
+
+	"agent/internal/logger"
+	"agent/internal/selfstats"
+)
+
+const (
+	// memoryBufferBytes bounds the payloads of a stream kept in memory while
+	// the spool directory can't be written
+	memoryBufferBytes = 16 << 20
+	// probeInterval is how often the disk is tried again while the payloads
+	// are kept in memory
+	probeInterval = 30 * time.Second
+)
+
+// isUnwritable reports whether a spool write failed because the filesystem
+// is read-only or full, as opposed to an error specific to the payload
+func isUnwritable(err error) bool {
+	return errors.Is(err, syscall.EROFS) || errors.Is(err, syscall.ENOSPC)
+}
+
+// memoryFallback keeps the payloads in memory while the spool directory
+// can't be written, typically when the root filesystem is remounted
+// read-only after an I/O error. Each stream is bounded to memoryBufferBytes,
+// the oldest payloads are dropped first. The payloads are moved back to the
+// disk once a write succeeds again.
+type memoryFallback struct {
+	now func() time.Time
+
+	mu      sync.Mutex
+	active  bool
+	probeAt time.Time
+	entries map[string][][]byte
+	size    map[string]int64
+	dropped map[string]*selfstats.Counter
+}
+
+func newMemoryFallback() *memoryFallback {
+	return &memoryFallback{
+		now:     time.Now,
+		entries: make(map[string][][]byte),
+		size:    make(map[string]int64),
+		dropped: map[string]*selfstats.Counter{
+			metricsQueueName: selfstats.NewCounter("spool_memory_dropped_total", map[string]string{"stream": metricsQueueName}),
+			logsQueueName:    selfstats.NewCounter("spool_memory_dropped_total", map[string]string{"stream": logsQueueName}),
+		},
+	}
+}
+
+// buffering reports whether the payloads go to memory without trying the
+// disk. It returns false when active but a probe of the disk is due.
+func (m *memoryFallback) buffering() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.active {
+		return false
+	}
+	if now := m.now(); !now.Before(m.probeAt) {
+		m.probeAt = now.Add(probeInterval)
+		return false
+	}
+	return true
+}
+
+// activate switches to memory after a write failed with err. Only the first
+// failure is logged and reported as an event, kept in the logs buffer.
+func (m *memoryFallback) activate(err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.probeAt = m.now().Add(probeInterval)
+	if m.active {
+		return
+	}
+	m.active = true
+	logger.Log.Error("Spool directory is not writable, keeping payloads in memory until it is",
+		"error", err, "max_bytes_per_stream", memoryBufferBytes)
+	selfstats.NewGauge("spool_memory_fallback", nil).Set(1)
+	event := AgentEvent("spool_unwritable", "Spool directory is not writable, keeping payloads in memory", map[string]string{
+		"error": err.Error(),
+	})
+	if data, err := json.Marshal(event); err == nil {
+		m.push(logsQueueName, data)
+	}
+}
+
+// add keeps a payload in memory
+func (m *memoryFallback) add(stream string, data []byte) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.push(stream, data)
+}
+
+// push appends an entry, dropping the oldest ones once over the bound.
+// m.mu must be held.
+func (m *memoryFallback) push(stream string, data []byte) {
+	m.entries[stream] = append(m.entries[stream], data)
+	m.size[stream] += int64(len(data))
+	for m.size[stream] > memoryBufferBytes && len(m.entries[stream]) > 1 {
+		m.size[stream] -= int64(len(m.entries[stream][0]))
+		m.entries[stream] = m.entries[stream][1:]
+		m.dropped[stream].Inc()
+	}
+	selfstats.NewGauge("spool_memory_bytes", map[string]string{"stream": stream}).Set(float64(m.size[stream]))
+}
+
+// pop takes up to limit entries of a stream, and reports whether more are
+// left
+func (m *memoryFallback) pop(stream string, limit int) ([][]byte, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	entries := m.entries[stream]
+	n := min(limit, len(entries))
+	batch := entries[:n:n]
+	m.entries[stream] = entries[n:]
+	for _, data := range batch {
+		m.size[stream] -= int64(len(data))
+	}
+	selfstats.NewGauge("spool_memory_bytes", map[string]string{"stream": stream}).Set(float64(m.size[stream]))
+	return batch, len(m.entries[stream]) > 0
+}
+
+// recover is called after a write to the disk succeeded. It moves the
+// entries kept in memory to the disk with write, stopping at the first
+// failure so the remaining entries are tried again on the next probe.
+func (m *memoryFallback) recover(write func(stream string, data []byte) error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.active {
+		return
+	}
+	for _, stream := range []string{metricsQueueName, logsQueueName} {
+		for len(m.entries[stream]) > 0 {
+			data := m.entries[stream][0]
+			if err := write(stream, data); err != nil {
+				logger.Log.Warn("failed to move payloads from memory to the spool", "stream", stream, "error", err)
+				return
+			}
+			m.entries[stream] = m.entries[stream][1:]
+			m.size[stream] -= int64(len(data))
+		}
+		selfstats.NewGauge("spool_memory_bytes", map[string]string{"stream": stream}).Set(0)
+	}
+	m.active = false
+	logger.Log.Info("Spool directory is writable again, payloads kept in memory were moved to it")
+	selfstats.NewGauge("spool_memory_fallback", nil).Set(0)
+	event := AgentEvent("spool_writable", "Spool directory is writable again", nil)
+	if data, err := json.Marshal(event); err == nil {
+		if err := write(logsQueueName, data); err != nil {
+			logger.Log.Debug("failed to spool the recovery event", "error", err)
+		}
+	}
+}
+
+// len returns the number of entries of a stream kept in memory
+func (m *memoryFallback) len(stream string) int64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return int64(len(m.entries[stream]))
+}
+
+// isActive reports whether the payloads are kept in memory
+func (m *memoryFallback) isActive() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.active
+}
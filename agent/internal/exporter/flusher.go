@@ -2,58 +2,153 @@ package exporter
 
 import (
 	"bytes"
+	"compress/gzip"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"math/rand/v2"
 	"net/http"
+	"os"
 	"time"
 
+	"agent/internal/api"
 	"agent/internal/authguard"
+	"agent/internal/common"
 	"agent/internal/config"
 	"agent/internal/logger"
+	"agent/internal/selfstats"
+	"agent/internal/transport"
+
+	"golang.org/x/time/rate"
 )
 
 const (
 	flushInterval = 5 * time.Second
+	// maxRetryBackoff caps the delay between two attempts to send a batch
+	maxRetryBackoff = 10 * time.Second
 )
 
 type flusher struct {
 	apiKey     string
-	metricsURL string
-	logsURL    string
+	hostID     string
+	metrics    *endpoints
+	logs       *endpoints
 	httpClient *http.Client
 	stopChans  []chan struct{}
 	ctx        context.Context
 	cancel     context.CancelFunc
 	spool      *spool
 	dryRun     bool
+	dryRunOut  io.Writer
+	// offset delays the first flush so agents don't all export at once
+	offset   time.Duration
+	interval time.Duration
+	// limiters hold the export rate limiter of each stream, nil when unlimited
+	limiters map[string]*rate.Limiter
+	// grpc is the optional streaming transport, HTTP is used when it's nil
+	// or when it fails
+	grpc *grpcTransport
+	// senders replace the JSON export of a stream, by stream name
+	senders map[string]sender
+	// gzip compresses the JSON exports, when the backend accepts it
+	gzip bool
+	// maxAttempts and retryBackoff are the retry policy of a batch
+	maxAttempts  int
+	retryBackoff time.Duration
+}
+
+// sender sends the batches of a stream to an endpoint that isn't the Simple
+// Observability backend, in the wire format of that endpoint
+type sender interface {
+	send(url string, payload []Payload, headers http.Header) error
 }
 
 type payloadConfig struct {
 	name      string
-	url       string
+	endpoints *endpoints
 	unmarshal func([]byte) (Payload, error)
+	// sender replaces the JSON export, nil for the backend
+	sender sender
+	// headers identify the batch being sent
+	headers http.Header
 }
 
-func newFlusher(spool *spool, cfg *config.Config, dryRun bool) (*flusher, error) {
+func newFlusher(spool *spool, cfg *config.Config, settings Settings, dryRun bool) (*flusher, error) {
 	ctx, cancel := context.WithCancel(context.Background())
+	var offset time.Duration
+	if !dryRun && !cfg.DisableScheduleOffsets {
+		offset = common.PhaseOffset(cfg.HostID, settings.FlushInterval)
+	}
+	var limiters map[string]*rate.Limiter
+	if settings.MaxPayloadsPerSecond > 0 {
+		burst := max(settings.MaxBatchSize, int(settings.MaxPayloadsPerSecond))
+		limiters = map[string]*rate.Limiter{
+			metricsQueueName: rate.NewLimiter(rate.Limit(settings.MaxPayloadsPerSecond), burst),
+			logsQueueName:    rate.NewLimiter(rate.Limit(settings.MaxPayloadsPerSecond), burst),
+		}
+	}
+	var grpcTransport *grpcTransport
+	if cfg.GRPCExportUrl != "" && !dryRun {
+		var err error
+		grpcTransport, err = newGRPCTransport(cfg.GRPCExportUrl, cfg.APIKey, cfg.HostID)
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+	}
+	httpClient := &http.Client{Timeout: 10 * time.Second, Transport: transport.Shared()}
+	metricsURL, logsURL := cfg.MetricsExportUrl, cfg.LogsExportUrl
+	if u := settings.Endpoints[metricsQueueName]; u != "" && metricsURL == config.DefaultMetricsExportUrl {
+		metricsURL = u
+	}
+	if u := settings.Endpoints[logsQueueName]; u != "" && logsURL == config.DefaultLogsExportUrl {
+		logsURL = u
+	}
+	metrics := streamEndpoints(metricsQueueName, metricsURL, cfg.ExportFailover.MetricsExportUrls, cfg.ExportFailover)
+	logs := streamEndpoints(logsQueueName, logsURL, cfg.ExportFailover.LogsExportUrls, cfg.ExportFailover)
+	senders := make(map[string]sender)
+	switch {
+	case cfg.OTLPExport.Endpoint != "":
+		senders = newOTLPSenders(httpClient, cfg.OTLPExport.Headers, cfg.HostID)
+		metrics = newEndpoints(metricsQueueName, []string{otlpSignalURL(cfg.OTLPExport.Endpoint, metricsQueueName)}, 0, 0)
+		logs = newEndpoints(logsQueueName, []string{otlpSignalURL(cfg.OTLPExport.Endpoint, logsQueueName)}, 0, 0)
+	case cfg.MetricsExportFormat == config.MetricsFormatRemoteWrite:
+		senders[metricsQueueName] = &remoteWriteSender{client: httpClient, apiKey: cfg.APIKey, hostID: cfg.HostID}
+	}
+	dryRunOut := settings.DryRunOutput
+	if dryRunOut == nil {
+		dryRunOut = os.Stdout
+	}
 	return &flusher{
 		apiKey:     cfg.APIKey,
-		metricsURL: cfg.MetricsExportUrl,
-		logsURL:    cfg.LogsExportUrl,
-		httpClient: &http.Client{Timeout: 10 * time.Second},
+		hostID:     cfg.HostID,
+		metrics:    metrics,
+		logs:       logs,
+		httpClient: httpClient,
 		ctx:        ctx,
 		cancel:     cancel,
 		spool:      spool,
 		dryRun:     dryRun,
+		dryRunOut:  dryRunOut,
+		offset:     offset,
+		interval:   settings.FlushInterval,
+		limiters:   limiters,
+		grpc:       grpcTransport,
+		senders:    senders,
+		gzip:       settings.Compression == "gzip",
+
+		maxAttempts:  max(settings.MaxSendAttempts, 1),
+		retryBackoff: settings.RetryBackoff,
 	}, nil
 }
 
 // start launches the background flusher goroutines
 func (f *flusher) start() {
 	streams := []payloadConfig{
-		{name: "metrics", url: f.metricsURL, unmarshal: unmarshalMetric},
-		{name: "logs", url: f.logsURL, unmarshal: unmarshalLog},
+		{name: "metrics", endpoints: f.metrics, unmarshal: unmarshalMetric, sender: f.senders[metricsQueueName]},
+		{name: "logs", endpoints: f.logs, unmarshal: unmarshalLog, sender: f.senders[logsQueueName]},
 	}
 	for _, config := range streams {
 		done := make(chan struct{})
@@ -69,6 +164,9 @@ func (f *flusher) stop() {
 		for _, done := range f.stopChans {
 			<-done
 		}
+		if f.grpc != nil {
+			f.grpc.close()
+		}
 		logger.Log.Debug("Exporter shutdown complete")
 	}
 }
@@ -77,7 +175,12 @@ func (f *flusher) stop() {
 func (f *flusher) runFlusherLoop(cfg payloadConfig, done chan struct{}) {
 	defer close(done)
 
-	ticker := time.NewTicker(flushInterval)
+	if !common.SleepContext(f.ctx, f.offset) {
+		f.flushAll(cfg)
+		return
+	}
+
+	ticker := time.NewTicker(f.interval)
 	defer ticker.Stop()
 	for {
 		select {
@@ -92,8 +195,36 @@ func (f *flusher) runFlusherLoop(cfg payloadConfig, done chan struct{}) {
 }
 
 // flushAll processes all entries in the spool, sending them in batches
-// until the file is empty or context is cancelled
+// until the file is empty or context is cancelled. Nothing is sent while
+// exports are suspended by the AuthGuard. The size of what's left is reported
+// as a self-metric and updates the spool budget, the payloads expired on the
+// way are reported in an event.
 func (f *flusher) flushAll(cfg payloadConfig) {
+	start := time.Now()
+	defer func() {
+		labels := map[string]string{"stream": cfg.name}
+		backlog := f.spool.backlog(cfg.name)
+		entries, oldest := f.spool.queueStats(cfg.name, cfg.unmarshal)
+		selfstats.NewGauge("export_backlog_bytes", labels).Set(float64(backlog))
+		selfstats.NewGauge("export_backlog_entries", labels).Set(float64(entries))
+		selfstats.NewGauge("export_oldest_entry_age_seconds", labels).Set(oldest.Seconds())
+		selfstats.NewGauge("export_flush_duration_seconds", labels).Set(time.Since(start).Seconds())
+		if f.spool.budget != nil {
+			f.spool.budget.update(cfg.name, backlog)
+		}
+		f.spool.reportExpired(cfg.name)
+	}()
+
+	// Sending with a key suspected to be revoked would only add to the auth
+	// errors, keep the payloads until it's checked
+	if !f.dryRun && authguard.Get().Suspended() {
+		logger.Log.Debug("Exports suspended, keeping payloads in the spool", "stream", cfg.name)
+		return
+	}
+	if wait := api.ThrottledFor(); !f.dryRun && wait > 0 {
+		logger.Log.Debug("Throttled by the backend, keeping payloads in the spool", "stream", cfg.name, "retry", wait)
+		return
+	}
 	for {
 		select {
 		case <-f.ctx.Done():
@@ -113,29 +244,196 @@ func (f *flusher) flushAll(cfg payloadConfig) {
 	}
 }
 
-// flushOnce processed and sends a batch from the spool file
+// flushOnce processed and sends a batch from the spool file. A batch left
+// unacknowledged by the previous attempt, or run, goes first with the same
+// sequence, without its expired payloads. Batches that can't be tracked in
+// the batch log go back to the spool when they fail. A batch rejected by the
+// endpoint is dropped, it would be rejected again.
 func (f *flusher) flushOnce(cfg payloadConfig) (bool, error) {
-	toSend, hasMore, err := f.spool.getBatch(cfg.name, cfg.unmarshal)
-	if err != nil {
-		return false, fmt.Errorf("failed to get payloads from spool: %w", err)
+	batches := f.spool.batches[cfg.name]
+	toSend, sequence := batches.pending(cfg.unmarshal)
+	hasMore := true
+	if sequence != 0 {
+		if toSend = f.spool.dropExpired(cfg.name, toSend); len(toSend) == 0 {
+			if err := batches.drop(); err != nil {
+				logger.Log.Warn("failed to drop the expired batch from the batch log", "stream", cfg.name, "error", err)
+			}
+			return true, nil
+		}
+	}
+	if sequence == 0 {
+		var err error
+		toSend, hasMore, err = f.spool.getBatch(cfg.name, cfg.unmarshal)
+		if err != nil {
+			return false, fmt.Errorf("failed to get payloads from spool: %w", err)
+		}
+		if len(toSend) > 0 && f.spool.tracksBatches(cfg.name) {
+			if sequence, err = batches.begin(toSend); err != nil {
+				logger.Log.Warn("failed to persist the batch, sending it without sequence", "stream", cfg.name, "error", err)
+			}
+		}
+	}
+	putBack := func() {
+		if sequence != 0 {
+			return
+		}
+		for _, p := range toSend {
+			_ = f.spool.putBack(p)
+		}
 	}
 
 	// Send batch if we have valid entries
 	if len(toSend) > 0 {
-		if err := f.sendPayload(cfg.url, toSend); err != nil {
-			// When sending fails, put back into the spool
-			for _, p := range toSend {
-				_ = f.spool.append(p)
+		if limiter := f.limiters[cfg.name]; limiter != nil {
+			if err := limiter.WaitN(f.ctx, len(toSend)); err != nil {
+				// Shutting down, keep the batch for the next run
+				putBack()
+				return false, nil
+			}
+		}
+		cfg.headers = nil
+		if sequence != 0 {
+			cfg.headers = batches.headers(sequence)
+		}
+		err := f.sendBatch(cfg, toSend)
+		var rejectedErr *rejectedError
+		isRejected := errors.As(err, &rejectedErr)
+		f.spool.setReachable(cfg.name, err == nil || isRejected)
+		reportBatch(cfg.name, len(toSend), err)
+		if isRejected {
+			logger.Log.Error("batch rejected by the endpoint, dropping it", "stream", cfg.name, "count", len(toSend), "error", err)
+			selfstats.NewCounter("export_rejected_total", map[string]string{"stream": cfg.name}).Add(float64(len(toSend)))
+			if sequence != 0 {
+				if err := batches.drop(); err != nil {
+					logger.Log.Warn("failed to drop the rejected batch from the batch log", "stream", cfg.name, "error", err)
+				}
 			}
+			return hasMore, nil
+		}
+		if err != nil {
+			// When sending fails, put back into the spool
+			putBack()
 			return false, fmt.Errorf("failed to send batch: %w", err)
 		}
-		logger.Log.Debug("successfully sent batch", "url", cfg.url, "count", len(toSend))
+		logger.Log.Debug("successfully sent batch", "stream", cfg.name, "count", len(toSend), "sequence", sequence)
+	}
+	if sequence != 0 {
+		if err := batches.ack(sequence); err != nil {
+			// Sent again with the same sequence, dropped by the backend
+			return false, fmt.Errorf("failed to acknowledge batch %d: %w", sequence, err)
+		}
 	}
 	return hasMore, nil
 }
 
+// reportBatch updates the self-metrics of a stream after a batch was sent.
+// Only the flush loop of the stream updates them.
+func reportBatch(stream string, size int, err error) {
+	labels := map[string]string{"stream": stream}
+	selfstats.NewGauge("export_batch_size", labels).Set(float64(size))
+	failures := selfstats.NewGauge("export_consecutive_failures", labels)
+	if err != nil {
+		failures.Set(failures.Value() + 1)
+		return
+	}
+	failures.Set(0)
+	selfstats.NewCounter("export_batches_total", labels).Inc()
+	selfstats.NewGauge("export_last_success_timestamp_seconds", labels).Set(float64(time.Now().Unix()))
+}
+
+// sendBatch sends a batch over gRPC when configured, falling back to HTTP if
+// the gRPC transport fails, unless the backend asked to back off or rejected
+// the key. HTTP batches go to the active endpoint of the stream. A stream
+// with its own sender is never sent over gRPC, the endpoint is not ours.
+func (f *flusher) sendBatch(cfg payloadConfig, payload []Payload) error {
+	if f.grpc != nil && cfg.sender == nil {
+		err := f.grpc.send(f.ctx, cfg.name, payload)
+		if err == nil || !fallsBackToHTTP(err) {
+			return err
+		}
+		logger.Log.Warn("gRPC export failed, falling back to HTTP", "stream", cfg.name, "error", err)
+	}
+	return f.sendWithRetry(cfg, payload)
+}
+
+// sendWithRetry sends a batch over HTTP, retrying after an exponential
+// backoff with jitter while the endpoint is unreachable or throttles. The
+// Retry-After delay of a 429 is honored when it's shorter than the backoff
+// cap, a longer one is left to the flush loop. Other errors aren't retried,
+// the batch would be rejected again.
+func (f *flusher) sendWithRetry(cfg payloadConfig, payload []Payload) error {
+	for attempt := 1; ; attempt++ {
+		url := cfg.endpoints.next()
+		var err error
+		if cfg.sender != nil && !f.dryRun {
+			err = cfg.sender.send(url, payload, cfg.headers)
+		} else {
+			err = f.sendPayload(url, payload, cfg.headers)
+		}
+		cfg.endpoints.report(url, err)
+		if err == nil || attempt >= f.maxAttempts || !retryable(err) {
+			return err
+		}
+
+		delay := retryDelay(f.retryBackoff, attempt)
+		if wait := api.ThrottledFor(); wait > 0 {
+			if wait > maxRetryBackoff {
+				return err
+			}
+			delay = wait
+		}
+		logger.Log.Debug("export failed, retrying", "stream", cfg.name, "attempt", attempt, "delay", delay, "error", err)
+		selfstats.NewCounter("export_retries_total", map[string]string{"stream": cfg.name}).Inc()
+		if !common.SleepContext(f.ctx, delay) {
+			return err
+		}
+	}
+}
+
+// retryable reports whether a failed send may succeed if tried again
+func retryable(err error) bool {
+	var unreachable *unreachableError
+	var throttled *api.ThrottledError
+	return errors.As(err, &unreachable) || errors.As(err, &throttled)
+}
+
+// rejectedError is a batch refused by the endpoint for its content, e.g. a
+// 400 or a 413. It would be refused again on every attempt.
+type rejectedError struct {
+	err error
+}
+
+func (e *rejectedError) Error() string { return e.err.Error() }
+func (e *rejectedError) Unwrap() error { return e.err }
+
+// rejected wraps the error of an export answered with a status code when the
+// batch itself was refused. A rejected key, a timeout or throttling aren't
+// about the batch.
+func rejected(err error, statusCode int) error {
+	switch statusCode {
+	case http.StatusUnauthorized, http.StatusForbidden, http.StatusRequestTimeout, http.StatusTooManyRequests:
+		return err
+	}
+	if statusCode < 400 || statusCode >= 500 {
+		return err
+	}
+	return &rejectedError{err}
+}
+
+// retryDelay returns the delay before the next attempt: the base doubled on
+// each attempt, capped, with a random jitter of up to half of it so that
+// agents failing together don't retry together
+func retryDelay(base time.Duration, attempt int) time.Duration {
+	delay := min(base<<(attempt-1), maxRetryBackoff)
+	if delay <= 0 {
+		return 0
+	}
+	return delay/2 + rand.N(delay/2+1)
+}
+
 // sendPayload is a private helper function to send JSON data to a given URL.
-func (f *flusher) sendPayload(url string, payload []Payload) error {
+// The headers are added to the request.
+func (f *flusher) sendPayload(url string, payload []Payload, headers http.Header) error {
 	// Dry run. Print payload without actually sending the request
 	if f.dryRun {
 		prettyPayload, err := json.MarshalIndent(payload, "", " ")
@@ -143,7 +441,7 @@ func (f *flusher) sendPayload(url string, payload []Payload) error {
 			logger.Log.Error("failed to pretty-print payload for dry-run", "error", err)
 			return nil
 		}
-		fmt.Printf("[dry-run] Would send payload: %v\n", string(prettyPayload))
+		fmt.Fprintf(f.dryRunOut, "[dry-run] Would send payload: %v\n", string(prettyPayload))
 		return nil
 	}
 
@@ -152,26 +450,62 @@ func (f *flusher) sendPayload(url string, payload []Payload) error {
 		return fmt.Errorf("failed to marshal payload: %w", err)
 	}
 
+	if f.gzip {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		if _, err := zw.Write(payloadBytes); err != nil {
+			return fmt.Errorf("failed to compress payload: %w", err)
+		}
+		if err := zw.Close(); err != nil {
+			return fmt.Errorf("failed to compress payload: %w", err)
+		}
+		payloadBytes = buf.Bytes()
+	}
+
 	req, err := http.NewRequest("POST", url, bytes.NewBuffer(payloadBytes))
 	if err != nil {
 		return fmt.Errorf("failed to create request: %w", err)
 	}
 
+	for name, values := range headers {
+		req.Header[name] = values
+	}
 	req.Header.Set("Authorization", f.apiKey)
 	req.Header.Set("Content-Type", "application/json")
+	if f.gzip {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+	if f.hostID != "" {
+		req.Header.Set(api.HostIDHeader, f.hostID)
+	}
 
 	resp, err := f.httpClient.Do(req)
 	if err != nil {
-		return fmt.Errorf("failed to send data to %s: %w", url, err)
+		return &unreachableError{fmt.Errorf("failed to send data to %s: %w", url, err)}
 	}
 	defer resp.Body.Close()
 
+	if err := checkResponse(url, resp); err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusNoContent {
+		return rejected(fmt.Errorf("data export to %s failed with status code: %d", url, resp.StatusCode), resp.StatusCode)
+	}
+	return nil
+}
+
+// checkResponse applies the answer of an export endpoint that applies to all
+// the wire formats: a rejected key suspends the exports, a 429 throttles
+// them, and a server error counts as unreachable for the failover.
+func checkResponse(url string, resp *http.Response) error {
 	if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
 		authguard.Get().HandleUnauthorized()
 	}
-
-	if resp.StatusCode != http.StatusNoContent {
-		return fmt.Errorf("data export to %s failed with status code: %d", url, resp.StatusCode)
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return &api.ThrottledError{RetryAfter: api.HandleTooManyRequests(resp.Header)}
+	}
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return &unreachableError{fmt.Errorf("data export to %s failed with status code: %d", url, resp.StatusCode)}
 	}
 	return nil
 }
@@ -1,6 +1,7 @@
 package exporter
 
 import (
+	"compress/gzip"
 	"encoding/json"
 	"io"
 	"net/http"
@@ -13,15 +14,20 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
+	"agent/internal/api"
+	"agent/internal/authguard"
 	"agent/internal/config"
+	"agent/internal/selfstats"
 )
 
 func TestFlusher_SendPayload(t *testing.T) {
 	var receivedPayload []MetricPayload
 	var receivedAuthHeader string
+	var receivedHostID string
 
 	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		receivedAuthHeader = r.Header.Get("Authorization")
+		receivedHostID = r.Header.Get("X-Host-Id")
 		body, _ := io.ReadAll(r.Body)
 		_ = json.Unmarshal(body, &receivedPayload)
 		w.WriteHeader(http.StatusNoContent)
@@ -31,9 +37,10 @@ func TestFlusher_SendPayload(t *testing.T) {
 	cfg := &config.Config{
 		APIKey:           "test-api-key",
 		MetricsExportUrl: ts.URL,
+		HostID:           "test-host-id",
 	}
 
-	f, err := newFlusher(nil, cfg, false)
+	f, err := newFlusher(nil, cfg, DefaultSettings(), false)
 	require.NoError(t, err)
 
 	payload := []Payload{
@@ -41,15 +48,54 @@ func TestFlusher_SendPayload(t *testing.T) {
 		MetricPayload{Name: "test_m2", Value: 2.0},
 	}
 
-	err = f.sendPayload(ts.URL, payload)
+	err = f.sendPayload(ts.URL, payload, nil)
 	require.NoError(t, err)
 
 	assert.Equal(t, "test-api-key", receivedAuthHeader)
+	assert.Equal(t, "test-host-id", receivedHostID)
 	require.Len(t, receivedPayload, 2)
 	assert.Equal(t, "test_m1", receivedPayload[0].Name)
 	assert.Equal(t, "test_m2", receivedPayload[1].Name)
 }
 
+func TestFlusher_SendPayloadGzip(t *testing.T) {
+	var encoding string
+	var received []MetricPayload
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		encoding = r.Header.Get("Content-Encoding")
+		zr, err := gzip.NewReader(r.Body)
+		require.NoError(t, err)
+		body, _ := io.ReadAll(zr)
+		_ = json.Unmarshal(body, &received)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer ts.Close()
+
+	settings := DefaultSettings().Negotiate(&api.Capabilities{Encodings: []string{"gzip"}})
+	f, err := newFlusher(nil, &config.Config{APIKey: "test-api-key", MetricsExportUrl: ts.URL}, settings, false)
+	require.NoError(t, err)
+
+	err = f.sendPayload(ts.URL, []Payload{MetricPayload{Name: "test_m1", Value: 1.0}}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "gzip", encoding)
+	require.Len(t, received, 1)
+	assert.Equal(t, "test_m1", received[0].Name)
+}
+
+func TestFlusher_NegotiatedEndpoints(t *testing.T) {
+	settings := DefaultSettings().Negotiate(&api.Capabilities{Endpoints: map[string]string{
+		metricsQueueName: "https://eu.metrics.example.com",
+		logsQueueName:    "https://eu.logs.example.com",
+	}})
+	cfg := &config.Config{MetricsExportUrl: config.DefaultMetricsExportUrl, LogsExportUrl: "https://logs.internal"}
+	f, err := newFlusher(nil, cfg, settings, false)
+	require.NoError(t, err)
+
+	// The default URL is replaced, the one set in the config is kept
+	assert.Equal(t, "https://eu.metrics.example.com", f.metrics.urls[0])
+	assert.Equal(t, "https://logs.internal", f.logs.urls[0])
+}
+
 func TestFlusher_FlushOnce(t *testing.T) {
 	tempDir, err := os.MkdirTemp("", "flusher_test")
 	require.NoError(t, err)
@@ -77,14 +123,14 @@ func TestFlusher_FlushOnce(t *testing.T) {
 		MetricsExportUrl: ts.URL,
 	}
 
-	f, err := newFlusher(s, cfg, false)
+	f, err := newFlusher(s, cfg, DefaultSettings(), false)
 	require.NoError(t, err)
 
 	// flushOnce for metrics - with retries in test because diskqueue is async
 	var hasMore bool
 	var flushErr error
 	for i := 0; i < 40; i++ {
-		hasMore, flushErr = f.flushOnce(payloadConfig{name: "metrics", url: ts.URL, unmarshal: unmarshalMetric})
+		hasMore, flushErr = f.flushOnce(payloadConfig{name: "metrics", endpoints: newEndpoints(metricsQueueName, []string{ts.URL}, 0, 0), unmarshal: unmarshalMetric})
 		if flushErr == nil && receivedCount > 0 {
 			break
 		}
@@ -96,7 +142,7 @@ func TestFlusher_FlushOnce(t *testing.T) {
 	assert.Equal(t, 1, receivedCount)
 
 	// flushOnce again - should be empty
-	hasMore, flushErr = f.flushOnce(payloadConfig{name: "metrics", url: ts.URL, unmarshal: unmarshalMetric})
+	hasMore, flushErr = f.flushOnce(payloadConfig{name: "metrics", endpoints: newEndpoints(metricsQueueName, []string{ts.URL}, 0, 0), unmarshal: unmarshalMetric})
 	require.NoError(t, flushErr)
 	assert.False(t, hasMore)
 	assert.Equal(t, 1, receivedCount) // No new request
@@ -108,7 +154,7 @@ func TestFlusher_DryRun(t *testing.T) {
 		MetricsExportUrl: "http://invalid-url",
 	}
 
-	f, err := newFlusher(nil, cfg, true)
+	f, err := newFlusher(nil, cfg, DefaultSettings(), true)
 	// dryRun = true
 	require.NoError(t, err)
 
@@ -117,6 +163,104 @@ func TestFlusher_DryRun(t *testing.T) {
 	}
 
 	// Should not fail even if URL is invalid, because it's a dry run
-	err = f.sendPayload("http://invalid-url", payload)
+	err = f.sendPayload("http://invalid-url", payload, nil)
 	require.NoError(t, err)
 }
+
+func TestFlusher_SuspendedByAuthGuard(t *testing.T) {
+	var receivedCount int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		receivedCount++
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer ts.Close()
+
+	s, err := newSpool(withDirectory(t.TempDir()))
+	require.NoError(t, err)
+	f, err := newFlusher(s, &config.Config{APIKey: "revoked", MetricsExportUrl: ts.URL}, DefaultSettings(), false)
+	require.NoError(t, err)
+	t.Cleanup(authguard.Get().Resume)
+
+	// Auth failures on exports count towards the threshold
+	payload := []Payload{MetricPayload{Name: "m1", Value: 1.0}}
+	for !authguard.Get().Suspended() {
+		require.Error(t, f.sendPayload(ts.URL, payload, nil))
+		require.Less(t, receivedCount, 100)
+	}
+
+	// Nothing is sent, not even read from the spool, while suspended. The
+	// backlog is still reported.
+	require.NoError(t, s.append(MetricPayload{Name: "m1", Value: 1.0}))
+	receivedCount = 0
+	f.flushAll(payloadConfig{name: "metrics", endpoints: newEndpoints(metricsQueueName, []string{ts.URL}, 0, 0), unmarshal: unmarshalMetric})
+	assert.Equal(t, 0, receivedCount)
+	assert.Positive(t, s.backlog(metricsQueueName))
+}
+
+func TestFlusher_RetriesTransientErrors(t *testing.T) {
+	statuses := []int{http.StatusServiceUnavailable, http.StatusBadGateway, http.StatusNoContent}
+	var received int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(statuses[min(received, len(statuses)-1)])
+		received++
+	}))
+	defer ts.Close()
+
+	settings := DefaultSettings()
+	settings.RetryBackoff = time.Millisecond
+	f, err := newFlusher(nil, &config.Config{APIKey: "key", MetricsExportUrl: ts.URL}, settings, false)
+	require.NoError(t, err)
+
+	payload := []Payload{MetricPayload{Name: "m1", Value: 1.0}}
+	require.NoError(t, f.sendBatch(payloadConfig{name: metricsQueueName, endpoints: f.metrics}, payload))
+	assert.Equal(t, 3, received)
+
+	// A rejected batch isn't retried
+	statuses, received = []int{http.StatusBadRequest}, 0
+	require.Error(t, f.sendBatch(payloadConfig{name: metricsQueueName, endpoints: f.metrics}, payload))
+	assert.Equal(t, 1, received)
+}
+
+func TestRetryDelay(t *testing.T) {
+	for attempt := 1; attempt < 10; attempt++ {
+		delay := retryDelay(time.Second, attempt)
+		expected := min(time.Second<<(attempt-1), maxRetryBackoff)
+		assert.GreaterOrEqual(t, delay, expected/2)
+		assert.LessOrEqual(t, delay, expected)
+	}
+}
+
+func TestFlusher_PipelineStats(t *testing.T) {
+	selfstats.Reset()
+	defer selfstats.Reset()
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer ts.Close()
+
+	s, err := newSpool(withDirectory(t.TempDir()), withSettings(Settings{MaxBatchSize: 2, MaxAge: maxAge}))
+	require.NoError(t, err)
+	settings := DefaultSettings()
+	settings.MaxSendAttempts = 1
+	f, err := newFlusher(s, &config.Config{APIKey: "key", MetricsExportUrl: ts.URL}, settings, false)
+	require.NoError(t, err)
+
+	oldest := time.Now().Add(-time.Minute).UnixMilli()
+	for i := range 3 {
+		require.NoError(t, s.append(MetricPayload{Timestamp: strconv.FormatInt(oldest+int64(i), 10), Name: "m"}))
+	}
+	f.flushAll(payloadConfig{name: metricsQueueName, endpoints: f.metrics, unmarshal: unmarshalMetric})
+
+	pipelines := Pipelines()
+	require.Len(t, pipelines, 1)
+	p := pipelines[0]
+	assert.Equal(t, metricsQueueName, p.Stream)
+	// The failed batch waits in the batch log
+	assert.Equal(t, int64(3), p.BacklogEntries)
+	assert.Positive(t, p.BacklogBytes)
+	assert.InDelta(t, 60, p.OldestEntryAge, 5)
+	assert.Equal(t, 2, p.LastBatchSize)
+	assert.Equal(t, 1, p.ConsecutiveFailures)
+	assert.True(t, p.LastSuccess.IsZero())
+}
@@ -0,0 +1,251 @@
+package exporter
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"sync"
+	"time"
+
+	"agent/internal/api"
+	"agent/internal/authguard"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// exportMethod is the bi-directional streaming method used to export batches.
+// Messages are JSON encoded, so the agent doesn't need generated stubs.
+const exportMethod = "/simob.export.v1.ExportService/Export"
+
+const (
+	grpcAckTimeout  = 10 * time.Second
+	grpcOpenTimeout = 10 * time.Second
+)
+
+var exportStreamDesc = &grpc.StreamDesc{
+	StreamName:    "Export",
+	ServerStreams: true,
+	ClientStreams: true,
+}
+
+// exportRequest is a batch sent on the export stream.
+type exportRequest struct {
+	Sequence uint64    `json:"sequence"`
+	Stream   string    `json:"stream"`
+	Payloads []Payload `json:"payloads"`
+}
+
+// exportAck is the server acknowledgement of a batch.
+type exportAck struct {
+	Sequence uint64 `json:"sequence"`
+	Error    string `json:"error,omitempty"`
+	// PauseMs asks the agent to wait before sending the next batch. This is
+	// how the server applies flow control.
+	PauseMs int64 `json:"pause_ms,omitempty"`
+}
+
+// jsonCodec encodes gRPC messages as JSON.
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v any) ([]byte, error)      { return json.Marshal(v) }
+func (jsonCodec) Unmarshal(data []byte, v any) error { return json.Unmarshal(data, v) }
+func (jsonCodec) Name() string                       { return "json" }
+
+// grpcTransport sends batches over one long lived gRPC stream per payload
+// stream (metrics, logs). Each batch waits for the server ack before the next
+// one is sent.
+type grpcTransport struct {
+	conn   *grpc.ClientConn
+	apiKey string
+	hostID string
+
+	mu      sync.Mutex
+	streams map[string]*exportStream
+}
+
+type exportStream struct {
+	stream      grpc.ClientStream
+	cancel      context.CancelFunc
+	sequence    uint64
+	pausedUntil time.Time
+}
+
+// newGRPCTransport creates a transport for target, formatted as
+// grpcs://host:port (TLS) or grpc://host:port (plaintext).
+func newGRPCTransport(target, apiKey, hostID string) (*grpcTransport, error) {
+	u, err := url.Parse(target)
+	if err != nil {
+		return nil, fmt.Errorf("invalid gRPC export url: %w", err)
+	}
+	var creds credentials.TransportCredentials
+	switch u.Scheme {
+	case "grpcs":
+		creds = credentials.NewTLS(&tls.Config{MinVersion: tls.VersionTLS12})
+	case "grpc":
+		creds = insecure.NewCredentials()
+	default:
+		return nil, fmt.Errorf("unsupported gRPC export url scheme: %q", u.Scheme)
+	}
+	conn, err := grpc.NewClient(u.Host, grpc.WithTransportCredentials(creds))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create gRPC client: %w", err)
+	}
+	return &grpcTransport{
+		conn:    conn,
+		apiKey:  apiKey,
+		hostID:  hostID,
+		streams: make(map[string]*exportStream),
+	}, nil
+}
+
+// send sends a batch and waits for its acknowledgement.
+func (t *grpcTransport) send(ctx context.Context, name string, payload []Payload) error {
+	t.mu.Lock()
+	s, ok := t.streams[name]
+	t.mu.Unlock()
+	if !ok {
+		var err error
+		if s, err = t.openStream(ctx); err != nil {
+			return err
+		}
+		t.mu.Lock()
+		t.streams[name] = s
+		t.mu.Unlock()
+	}
+
+	if wait := time.Until(s.pausedUntil); wait > 0 {
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	s.sequence++
+	ack, err := s.exchange(exportRequest{Sequence: s.sequence, Stream: name, Payloads: payload})
+	if err != nil {
+		t.resetStream(name)
+		switch status.Code(err) {
+		case codes.Unauthenticated, codes.PermissionDenied:
+			authguard.Get().HandleUnauthorized()
+		case codes.ResourceExhausted:
+			api.Throttle(0)
+		}
+		return err
+	}
+	if ack.PauseMs > 0 {
+		s.pausedUntil = time.Now().Add(time.Duration(ack.PauseMs) * time.Millisecond)
+	}
+	if ack.Error != "" {
+		return &rejectedError{fmt.Errorf("batch %d rejected: %s", ack.Sequence, ack.Error)}
+	}
+	return nil
+}
+
+// dialError is returned when the export stream can't be opened. No batch
+// was sent on it.
+type dialError struct {
+	err error
+}
+
+func (e *dialError) Error() string { return e.err.Error() }
+func (e *dialError) Unwrap() error { return e.err }
+
+// fallsBackToHTTP reports whether a batch that failed over gRPC may be sent
+// over HTTP instead. It may only when the backend was unreachable: other
+// failures, e.g. an ack timeout, may happen after the batch was stored. It
+// never may when the backend asked the agent to back off or rejected the API
+// key, the batch stays in the spool.
+func fallsBackToHTTP(err error) bool {
+	switch status.Code(err) {
+	case codes.ResourceExhausted, codes.Unauthenticated, codes.PermissionDenied:
+		return false
+	case codes.Unavailable:
+		return true
+	}
+	var dialErr *dialError
+	return errors.As(err, &dialErr)
+}
+
+// openStream opens the export stream of a payload stream. The handshake is
+// bounded by grpcOpenTimeout and ends when ctx is done, the stream itself
+// lives until it's reset so the final flush can still use it.
+func (t *grpcTransport) openStream(ctx context.Context) (*exportStream, error) {
+	streamCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	streamCtx = metadata.AppendToOutgoingContext(streamCtx, "authorization", t.apiKey)
+	if t.hostID != "" {
+		streamCtx = metadata.AppendToOutgoingContext(streamCtx, api.HostIDHeader, t.hostID)
+	}
+	stopOnDone := context.AfterFunc(ctx, cancel)
+	timer := time.AfterFunc(grpcOpenTimeout, cancel)
+	stream, err := t.conn.NewStream(streamCtx, exportStreamDesc, exportMethod, grpc.ForceCodec(jsonCodec{}))
+	interrupted := !stopOnDone()
+	timedOut := !timer.Stop()
+	if err == nil && (interrupted || timedOut) {
+		err = streamCtx.Err()
+	}
+	if err != nil {
+		cancel()
+		return nil, &dialError{fmt.Errorf("failed to open export stream: %w", err)}
+	}
+	return &exportStream{stream: stream, cancel: cancel}, nil
+}
+
+// exchange sends req and waits for the matching ack.
+func (s *exportStream) exchange(req exportRequest) (exportAck, error) {
+	if err := s.stream.SendMsg(&req); err != nil {
+		return exportAck{}, fmt.Errorf("failed to send batch: %w", err)
+	}
+
+	type result struct {
+		ack exportAck
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		var ack exportAck
+		err := s.stream.RecvMsg(&ack)
+		done <- result{ack, err}
+	}()
+
+	select {
+	case r := <-done:
+		if r.err != nil {
+			return exportAck{}, fmt.Errorf("failed to receive ack: %w", r.err)
+		}
+		if r.ack.Sequence != req.Sequence {
+			return exportAck{}, fmt.Errorf("unexpected ack sequence %d, want %d", r.ack.Sequence, req.Sequence)
+		}
+		return r.ack, nil
+	case <-time.After(grpcAckTimeout):
+		return exportAck{}, fmt.Errorf("timed out waiting for ack of batch %d", req.Sequence)
+	}
+}
+
+func (t *grpcTransport) resetStream(name string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if s, ok := t.streams[name]; ok {
+		s.cancel()
+		delete(t.streams, name)
+	}
+}
+
+func (t *grpcTransport) close() {
+	t.mu.Lock()
+	for name, s := range t.streams {
+		_ = s.stream.CloseSend()
+		s.cancel()
+		delete(t.streams, name)
+	}
+	t.mu.Unlock()
+	_ = t.conn.Close()
+}
@@ -0,0 +1,238 @@
+package exporter
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"agent/internal/config"
+)
+
+type receivedBatch struct {
+	Sequence uint64            `json:"sequence"`
+	Stream   string            `json:"stream"`
+	Payloads []json.RawMessage `json:"payloads"`
+}
+
+type fakeExportServer struct {
+	mu       sync.Mutex
+	batches  []receivedBatch
+	metadata metadata.MD
+	ack      func(receivedBatch) exportAck
+}
+
+func (s *fakeExportServer) handle(_ any, stream grpc.ServerStream) error {
+	md, _ := metadata.FromIncomingContext(stream.Context())
+	for {
+		var batch receivedBatch
+		if err := stream.RecvMsg(&batch); err != nil {
+			return nil
+		}
+		s.mu.Lock()
+		s.metadata = md
+		s.batches = append(s.batches, batch)
+		s.mu.Unlock()
+
+		ack := exportAck{Sequence: batch.Sequence}
+		if s.ack != nil {
+			ack = s.ack(batch)
+		}
+		if err := stream.SendMsg(&ack); err != nil {
+			return err
+		}
+	}
+}
+
+func startFakeExportServer(t *testing.T, fake *fakeExportServer) string {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	server := grpc.NewServer(grpc.ForceServerCodec(jsonCodec{}))
+	server.RegisterService(&grpc.ServiceDesc{
+		ServiceName: "simob.export.v1.ExportService",
+		HandlerType: (*any)(nil),
+		Streams: []grpc.StreamDesc{{
+			StreamName:    "Export",
+			Handler:       fake.handle,
+			ServerStreams: true,
+			ClientStreams: true,
+		}},
+	}, nil)
+	go server.Serve(lis)
+	t.Cleanup(server.Stop)
+
+	return "grpc://" + lis.Addr().String()
+}
+
+func TestGRPCTransport_Send(t *testing.T) {
+	fake := &fakeExportServer{}
+	target := startFakeExportServer(t, fake)
+
+	transport, err := newGRPCTransport(target, "test-api-key", "test-host-id")
+	require.NoError(t, err)
+	defer transport.close()
+
+	payload := []Payload{
+		MetricPayload{Name: "test_m1", Value: 1.0},
+		MetricPayload{Name: "test_m2", Value: 2.0},
+	}
+	require.NoError(t, transport.send(context.Background(), metricsQueueName, payload))
+	require.NoError(t, transport.send(context.Background(), metricsQueueName, payload[:1]))
+
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	require.Len(t, fake.batches, 2)
+	assert.Equal(t, uint64(1), fake.batches[0].Sequence)
+	assert.Equal(t, uint64(2), fake.batches[1].Sequence)
+	assert.Equal(t, metricsQueueName, fake.batches[0].Stream)
+	assert.Len(t, fake.batches[0].Payloads, 2)
+	assert.Equal(t, []string{"test-api-key"}, fake.metadata.Get("authorization"))
+	assert.Equal(t, []string{"test-host-id"}, fake.metadata.Get("x-host-id"))
+}
+
+func TestGRPCTransport_RejectedBatch(t *testing.T) {
+	fake := &fakeExportServer{ack: func(b receivedBatch) exportAck {
+		return exportAck{Sequence: b.Sequence, Error: "invalid payload"}
+	}}
+	target := startFakeExportServer(t, fake)
+
+	transport, err := newGRPCTransport(target, "test-api-key", "")
+	require.NoError(t, err)
+	defer transport.close()
+
+	err = transport.send(context.Background(), logsQueueName, []Payload{LogPayload{Message: "hello"}})
+	assert.ErrorContains(t, err, "invalid payload")
+}
+
+func TestGRPCTransport_FlowControl(t *testing.T) {
+	fake := &fakeExportServer{ack: func(b receivedBatch) exportAck {
+		return exportAck{Sequence: b.Sequence, PauseMs: 200}
+	}}
+	target := startFakeExportServer(t, fake)
+
+	transport, err := newGRPCTransport(target, "test-api-key", "")
+	require.NoError(t, err)
+	defer transport.close()
+
+	payload := []Payload{MetricPayload{Name: "test_m"}}
+	require.NoError(t, transport.send(context.Background(), metricsQueueName, payload))
+	start := time.Now()
+	require.NoError(t, transport.send(context.Background(), metricsQueueName, payload))
+	assert.GreaterOrEqual(t, time.Since(start), 150*time.Millisecond)
+}
+
+func TestGRPCTransport_InvalidURL(t *testing.T) {
+	_, err := newGRPCTransport("https://example.com", "key", "")
+	assert.Error(t, err)
+}
+
+func TestFlusher_GRPCFallbackToHTTP(t *testing.T) {
+	var received int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received++
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer ts.Close()
+
+	// Reserve a port and close it so the gRPC endpoint is unreachable
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := lis.Addr().String()
+	lis.Close()
+
+	cfg := &config.Config{
+		APIKey:           "test-api-key",
+		MetricsExportUrl: ts.URL,
+		GRPCExportUrl:    "grpc://" + addr,
+	}
+	f, err := newFlusher(nil, cfg, DefaultSettings(), false)
+	require.NoError(t, err)
+	defer f.grpc.close()
+
+	err = f.sendBatch(payloadConfig{name: metricsQueueName, endpoints: newEndpoints(metricsQueueName, []string{ts.URL}, 0, 0)}, []Payload{MetricPayload{Name: "test_m"}})
+	require.NoError(t, err)
+	assert.Equal(t, 1, received)
+}
+
+func TestFlusher_GRPCNoFallbackWhenThrottled(t *testing.T) {
+	var received int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received++
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer ts.Close()
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	server := grpc.NewServer(grpc.ForceServerCodec(jsonCodec{}))
+	server.RegisterService(&grpc.ServiceDesc{
+		ServiceName: "simob.export.v1.ExportService",
+		HandlerType: (*any)(nil),
+		Streams: []grpc.StreamDesc{{
+			StreamName: "Export",
+			Handler: func(_ any, stream grpc.ServerStream) error {
+				var batch receivedBatch
+				_ = stream.RecvMsg(&batch)
+				return status.Error(codes.ResourceExhausted, "slow down")
+			},
+			ServerStreams: true,
+			ClientStreams: true,
+		}},
+	}, nil)
+	go server.Serve(lis)
+	defer server.Stop()
+
+	cfg := &config.Config{
+		APIKey:           "test-api-key",
+		MetricsExportUrl: ts.URL,
+		GRPCExportUrl:    "grpc://" + lis.Addr().String(),
+	}
+	f, err := newFlusher(nil, cfg, DefaultSettings(), false)
+	require.NoError(t, err)
+	defer f.grpc.close()
+
+	err = f.sendBatch(payloadConfig{name: metricsQueueName, endpoints: newEndpoints(metricsQueueName, []string{ts.URL}, 0, 0)}, []Payload{MetricPayload{Name: "test_m"}})
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+	assert.Equal(t, 0, received)
+}
+
+func TestFallsBackToHTTP(t *testing.T) {
+	assert.True(t, fallsBackToHTTP(&dialError{errors.New("connection refused")}))
+	assert.True(t, fallsBackToHTTP(fmt.Errorf("failed to receive ack: %w", status.Error(codes.Unavailable, "gone"))))
+	// The server may have stored the batch before the ack was lost
+	assert.False(t, fallsBackToHTTP(errors.New("timed out waiting for ack of batch 1")))
+	assert.False(t, fallsBackToHTTP(&dialError{status.Error(codes.Unauthenticated, "bad key")}))
+	assert.False(t, fallsBackToHTTP(status.Error(codes.ResourceExhausted, "slow down")))
+}
+
+func TestGRPCTransport_OpenStreamStopsWithContext(t *testing.T) {
+	// A listener that never completes the HTTP/2 handshake
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer lis.Close()
+
+	transport, err := newGRPCTransport("grpc://"+lis.Addr().String(), "key", "")
+	require.NoError(t, err)
+	defer transport.close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err = transport.send(ctx, metricsQueueName, []Payload{MetricPayload{Name: "test_m"}})
+	require.Error(t, err)
+	assert.Less(t, time.Since(start), 5*time.Second)
+}
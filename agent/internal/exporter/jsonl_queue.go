@@ -2,11 +2,14 @@ package exporter
 
 import (
 	"bufio"
+	"cmp"
 	"errors"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"slices"
+	"sync"
 	"time"
 
 	"agent/internal/logger"
@@ -35,6 +38,12 @@ type jsonlQueue struct {
 	path     string
 	tempPath string
 	lockPath string
+
+	// entries and head are the number of entries and the first one, as
+	// seen by this process. They're exact after each PopBatch.
+	mu      sync.Mutex
+	entries int64
+	head    []byte
 }
 
 // newJSONLQueue builds the file paths for a queue stream.
@@ -68,6 +77,12 @@ func (q *jsonlQueue) Append(data []byte) error {
 	if err := file.Sync(); err != nil {
 		return fmt.Errorf("sync queue %s: %w", q.name, err)
 	}
+	q.mu.Lock()
+	if q.entries == 0 {
+		q.head = data
+	}
+	q.entries++
+	q.mu.Unlock()
 	return nil
 }
 
@@ -80,7 +95,69 @@ func (q *jsonlQueue) PopBatch(limit int) ([][]byte, bool, error) {
 		return nil, false, err
 	}
 	defer unlock()
+	return q.pop(limit, nil)
+}
+
+// PopWindow drains up to limit entries of the oldest timestamp window across
+// the whole queue, sorted by timestamp, and rewrites the others back to disk
+// in their order. timestamp returns the timestamp of an entry, the entries
+// without one go first. Nothing is removed from the file before it's popped,
+// so the entries past the window survive a crash.
+func (q *jsonlQueue) PopWindow(limit int, window int64, timestamp func([]byte) int64) ([][]byte, bool, error) {
+	unlock, err := q.lock()
+	if err != nil {
+		return nil, false, err
+	}
+	defer unlock()
+
+	oldest, found := int64(0), false
+	err = q.scan(func(line []byte) {
+		if w := timestamp(line) / window; !found || w < oldest {
+			oldest, found = w, true
+		}
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	batch, hasMore, err := q.pop(limit, func(line []byte) bool { return timestamp(line)/window == oldest })
+	if err != nil {
+		return nil, false, err
+	}
+	slices.SortStableFunc(batch, func(a, b []byte) int { return cmp.Compare(timestamp(a), timestamp(b)) })
+	return batch, hasMore, nil
+}
 
+// scan calls fn with each entry of the queue, the caller holds the lock
+func (q *jsonlQueue) scan(fn func(line []byte)) error {
+	source, err := os.Open(q.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("open queue file %s: %w", q.name, err)
+	}
+	defer source.Close()
+
+	reader := bufio.NewReader(source)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 && len(line) <= maxLineSize {
+			if line = trimTrailingNewline(line); len(line) > 0 {
+				fn(line)
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("read queue %s: %w", q.name, err)
+		}
+	}
+}
+
+// pop drains up to limit entries accepted by take, all of them when nil, and
+// rewrites the others back to disk. The caller holds the lock.
+func (q *jsonlQueue) pop(limit int, take func(line []byte) bool) ([][]byte, bool, error) {
 	source, err := os.OpenFile(q.path, os.O_CREATE|os.O_RDONLY, 0o660)
 	if err != nil {
 		return nil, false, fmt.Errorf("open queue file %s: %w", q.name, err)
@@ -95,7 +172,8 @@ func (q *jsonlQueue) PopBatch(limit int) ([][]byte, bool, error) {
 	reader := bufio.NewReader(source)
 	var batch [][]byte
 	hasMore := false
-	var leftoverBytes int64
+	var leftoverBytes, leftover int64
+	var head []byte
 	for {
 		line, err := reader.ReadBytes('\n')
 		if len(line) > 0 {
@@ -107,7 +185,7 @@ func (q *jsonlQueue) PopBatch(limit int) ([][]byte, bool, error) {
 			if len(line) == 0 {
 				continue
 			}
-			if len(batch) < limit {
+			if len(batch) < limit && (take == nil || take(line)) {
 				batch = append(batch, append([]byte(nil), line...))
 			} else {
 				written, writeErr := temp.Write(append(line, '\n'))
@@ -117,6 +195,10 @@ func (q *jsonlQueue) PopBatch(limit int) ([][]byte, bool, error) {
 					return nil, false, fmt.Errorf("rewrite queue %s: %w", q.name, writeErr)
 				}
 				leftoverBytes += int64(written)
+				if leftover == 0 {
+					head = append([]byte(nil), line...)
+				}
+				leftover++
 				hasMore = true
 			}
 		}
@@ -141,6 +223,9 @@ func (q *jsonlQueue) PopBatch(limit int) ([][]byte, bool, error) {
 	if err := os.Remove(q.path); err != nil && !errors.Is(err, os.ErrNotExist) {
 		return nil, false, fmt.Errorf("replace queue %s: %w", q.name, err)
 	}
+	q.mu.Lock()
+	q.entries, q.head = leftover, head
+	q.mu.Unlock()
 	if leftoverBytes == 0 {
 		if err := os.Remove(q.tempPath); err != nil && !errors.Is(err, os.ErrNotExist) {
 			return nil, false, fmt.Errorf("cleanup temp queue %s: %w", q.name, err)
@@ -153,6 +238,24 @@ func (q *jsonlQueue) PopBatch(limit int) ([][]byte, bool, error) {
 	return batch, hasMore, nil
 }
 
+// Size returns the size in bytes of the entries waiting in the queue.
+func (q *jsonlQueue) Size() int64 {
+	info, err := os.Stat(q.path)
+	if err != nil {
+		return 0
+	}
+	return info.Size()
+}
+
+// Entries returns the number of entries waiting in the queue and the first
+// one, nil when empty. Entries appended by other processes are only counted
+// after the next PopBatch.
+func (q *jsonlQueue) Entries() (int64, []byte) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.entries, q.head
+}
+
 // Close exists so spool can treat all queue implementations uniformly.
 func (q *jsonlQueue) Close() error {
 	return nil
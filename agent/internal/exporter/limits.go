@@ -0,0 +1,162 @@
+package exporter
+
+import (
+	"maps"
+	"slices"
+	"strconv"
+	"unicode/utf8"
+
+	"agent/internal/selfstats"
+)
+
+// Limits applied to every payload before it is spooled, so that a runaway
+// label or a pathological log line can't produce an entry the backend
+// rejects. Host tags are added after the limits and are not counted.
+const (
+	MaxLabels          = 32
+	MaxLabelValueBytes = 1024
+	MaxMessageBytes    = 256 * 1024
+)
+
+// Limits applied to the metadata of a log payload. Metadata is stored
+// without being indexed, so it can hold high cardinality fields (request
+// ids, user agents...), but it is still bounded to keep payloads small.
+const (
+	MaxMetadataEntries    = 64
+	MaxMetadataKeyBytes   = 128
+	MaxMetadataValueBytes = 8 * 1024
+)
+
+// Markers of the truncated values. The metadata of a truncated log also
+// records what was cut.
+const (
+	valueTruncatedMarker   = "…"
+	messageTruncatedMarker = "… [truncated]"
+	metadataTruncatedKey   = "metadata_truncated"
+	labelsTruncatedKey     = "labels_truncated"
+	messageBytesKey        = "message_bytes"
+)
+
+// truncations counts the payloads cut to fit the limits, by field
+var truncations = map[string]*selfstats.Counter{
+	"labels":   selfstats.NewCounter("export_truncated_total", map[string]string{"field": "labels"}),
+	"message":  selfstats.NewCounter("export_truncated_total", map[string]string{"field": "message"}),
+	"metadata": selfstats.NewCounter("export_truncated_total", map[string]string{"field": "metadata"}),
+}
+
+// limitMetricPayload applies the label limits to a metric
+func limitMetricPayload(metric MetricPayload) MetricPayload {
+	if labels, truncated := limitLabels(metric.Labels); truncated {
+		metric.Labels = labels
+		truncations["labels"].Inc()
+	}
+	return metric
+}
+
+// limitLogPayload applies the label, message and metadata limits to a log
+func limitLogPayload(log LogPayload) LogPayload {
+	var notes map[string]string
+	if labels, truncated := limitLabels(log.Labels); truncated {
+		log.Labels = labels
+		truncations["labels"].Inc()
+		notes = map[string]string{labelsTruncatedKey: "true"}
+	}
+	if len(log.Message) > MaxMessageBytes {
+		if notes == nil {
+			notes = make(map[string]string)
+		}
+		notes[messageBytesKey] = strconv.Itoa(len(log.Message))
+		log.Message = truncateUTF8(log.Message, MaxMessageBytes-len(messageTruncatedMarker)) + messageTruncatedMarker
+		truncations["message"].Inc()
+	}
+	if notes != nil {
+		log.Metadata = maps.Clone(log.Metadata)
+		if log.Metadata == nil {
+			log.Metadata = make(map[string]string)
+		}
+		maps.Copy(log.Metadata, notes)
+	}
+	if exceedsMetadataLimits(log.Metadata) {
+		log.Metadata = limitMetadata(log.Metadata)
+		truncations["metadata"].Inc()
+	}
+	return log
+}
+
+// limitLabels returns the labels within the limits. Keys are kept in lexical
+// order, so the same labels are dropped for every payload. The map is copied
+// only when it has to be changed.
+func limitLabels(labels map[string]string) (map[string]string, bool) {
+	exceeds := len(labels) > MaxLabels
+	for _, v := range labels {
+		if len(v) > MaxLabelValueBytes {
+			exceeds = true
+			break
+		}
+	}
+	if !exceeds {
+		return labels, false
+	}
+
+	limited := make(map[string]string, min(len(labels), MaxLabels))
+	for _, k := range slices.Sorted(maps.Keys(labels)) {
+		if len(limited) == MaxLabels {
+			break
+		}
+		v := labels[k]
+		if len(v) > MaxLabelValueBytes {
+			v = truncateUTF8(v, MaxLabelValueBytes-len(valueTruncatedMarker)) + valueTruncatedMarker
+		}
+		limited[k] = v
+	}
+	return limited, true
+}
+
+// limitMetadata returns the metadata within the limits. Keys are kept in
+// lexical order, so the same entries are dropped for every payload of a
+// source. The map is copied only when it has to be changed.
+func limitMetadata(metadata map[string]string) map[string]string {
+	if !exceedsMetadataLimits(metadata) {
+		return metadata
+	}
+
+	limited := make(map[string]string, MaxMetadataEntries)
+	for _, k := range slices.Sorted(maps.Keys(metadata)) {
+		if len(limited) == MaxMetadataEntries-1 {
+			break
+		}
+		if len(k) > MaxMetadataKeyBytes {
+			continue
+		}
+		v := metadata[k]
+		if len(v) > MaxMetadataValueBytes {
+			v = truncateUTF8(v, MaxMetadataValueBytes-len(valueTruncatedMarker)) + valueTruncatedMarker
+		}
+		limited[k] = v
+	}
+	limited[metadataTruncatedKey] = "true"
+	return limited
+}
+
+func exceedsMetadataLimits(metadata map[string]string) bool {
+	if len(metadata) > MaxMetadataEntries {
+		return true
+	}
+	for k, v := range metadata {
+		if len(k) > MaxMetadataKeyBytes || len(v) > MaxMetadataValueBytes {
+			return true
+		}
+	}
+	return false
+}
+
+// truncateUTF8 cuts s to at most n bytes without splitting a character
+func truncateUTF8(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
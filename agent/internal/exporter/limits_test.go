@@ -0,0 +1,74 @@
+package exporter
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLimitMetadata(t *testing.T) {
+	small := map[string]string{"request_id": "abc"}
+	assert.Equal(t, small, limitMetadata(small))
+	assert.Nil(t, limitMetadata(nil))
+
+	large := map[string]string{
+		"long": strings.Repeat("é", MaxMetadataValueBytes),
+		strings.Repeat("k", MaxMetadataKeyBytes+1): "v",
+	}
+	for i := 0; i < MaxMetadataEntries; i++ {
+		large[fmt.Sprintf("field_%02d", i)] = "v"
+	}
+	limited := limitMetadata(large)
+	assert.Len(t, limited, MaxMetadataEntries)
+	assert.Equal(t, "true", limited["metadata_truncated"])
+	assert.Equal(t, MaxMetadataEntries+2, len(large), "the input is not modified")
+	assert.NotContains(t, limited, "long", "keys are kept in lexical order")
+	assert.Equal(t, "v", limited["field_00"])
+
+	value := limitMetadata(map[string]string{"long": strings.Repeat("é", MaxMetadataValueBytes)})["long"]
+	assert.LessOrEqual(t, len(value), MaxMetadataValueBytes)
+	assert.True(t, strings.HasSuffix(value, "…"))
+	assert.True(t, utf8.ValidString(value))
+}
+
+func TestLimitLabels(t *testing.T) {
+	small := map[string]string{"source": "nginx"}
+	labels, truncated := limitLabels(small)
+	assert.False(t, truncated)
+	assert.Equal(t, small, labels)
+
+	large := map[string]string{"path": strings.Repeat("/a", MaxLabelValueBytes)}
+	for i := 0; i < MaxLabels; i++ {
+		large["k"+strconv.Itoa(100+i)] = "v"
+	}
+	labels, truncated = limitLabels(large)
+	assert.True(t, truncated)
+	assert.Len(t, labels, MaxLabels)
+	assert.NotContains(t, labels, "path")
+
+	labels, truncated = limitLabels(map[string]string{"path": strings.Repeat("/a", MaxLabelValueBytes)})
+	assert.True(t, truncated)
+	assert.Len(t, labels["path"], MaxLabelValueBytes)
+	assert.True(t, strings.HasSuffix(labels["path"], "…"))
+}
+
+func TestLimitLogPayload(t *testing.T) {
+	log := LogPayload{Labels: map[string]string{"source": "socket"}, Message: "short"}
+	assert.Equal(t, log, limitLogPayload(log))
+
+	before := truncations["message"].Value()
+	message := strings.Repeat("x", MaxMessageBytes+10)
+	metadata := map[string]string{"request_id": "b7c1"}
+	limited := limitLogPayload(LogPayload{Message: message, Metadata: metadata})
+	require.Len(t, limited.Message, MaxMessageBytes)
+	assert.True(t, strings.HasSuffix(limited.Message, "… [truncated]"))
+	assert.Equal(t, strconv.Itoa(len(message)), limited.Metadata["message_bytes"])
+	assert.Equal(t, "b7c1", limited.Metadata["request_id"])
+	assert.NotContains(t, metadata, "message_bytes", "the input is not modified")
+	assert.Equal(t, before+1, truncations["message"].Value())
+}
@@ -0,0 +1,86 @@
+package exporter
+
+import (
+	"sync"
+
+	"agent/internal/selfstats"
+)
+
+// memoryQueueBytes bounds the payloads of a stream kept in memory while its
+// endpoint is reachable, the next ones go to the disk
+const memoryQueueBytes = 4 << 20
+
+// memoryQueue keeps the payloads of a stream in memory instead of writing
+// them to the spool, which saves the disk writes on hosts with a reliable
+// network, e.g. edge devices booting from an SD card. The payloads go to the
+// disk while the endpoint is unreachable or once the queue is full.
+type memoryQueue struct {
+	stream string
+
+	mu       sync.Mutex
+	entries  [][]byte
+	size     int64
+	overflow bool
+}
+
+func newMemoryQueue(stream string) *memoryQueue {
+	return &memoryQueue{stream: stream}
+}
+
+// offer keeps a payload in memory, it returns false when the payload must be
+// written to the disk
+func (q *memoryQueue) offer(data []byte) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.overflow || q.size+int64(len(data)) > memoryQueueBytes {
+		return false
+	}
+	q.entries = append(q.entries, data)
+	q.size += int64(len(data))
+	q.report()
+	return true
+}
+
+// pop takes up to limit entries, and reports whether more are left
+func (q *memoryQueue) pop(limit int) ([][]byte, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	n := min(limit, len(q.entries))
+	batch := q.entries[:n:n]
+	q.entries = q.entries[n:]
+	for _, data := range batch {
+		q.size -= int64(len(data))
+	}
+	q.report()
+	return batch, len(q.entries) > 0
+}
+
+// setOverflow sends the next payloads to the disk while the endpoint is
+// unreachable
+func (q *memoryQueue) setOverflow(overflow bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.overflow = overflow
+}
+
+// drain takes all the entries, e.g. to write them to the disk on shutdown
+func (q *memoryQueue) drain() [][]byte {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	entries := q.entries
+	q.entries, q.size = nil, 0
+	q.report()
+	return entries
+}
+
+// len returns the number of entries kept in memory
+func (q *memoryQueue) len() int64 {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return int64(len(q.entries))
+}
+
+// report updates the size gauge. q.mu must be held.
+func (q *memoryQueue) report() {
+	selfstats.NewGauge("spool_in_memory_bytes", map[string]string{"stream": q.stream}).Set(float64(q.size))
+}
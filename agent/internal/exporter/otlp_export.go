@@ -0,0 +1,205 @@
+package exporter
+
+import (
+	"bytes"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"agent/internal/hostinfo"
+	"agent/internal/logger"
+	"agent/internal/version"
+
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+// otlpScope is the instrumentation scope of the exported metrics and logs
+const otlpScope = "simob-agent"
+
+// otlpSender sends a stream to an OpenTelemetry collector over OTLP/HTTP,
+// encoded as protobuf
+type otlpSender struct {
+	client  *http.Client
+	headers map[string]string
+	stream  string
+	// resource describes the host, it's gathered on the first send
+	resource func() *resourcepb.Resource
+}
+
+// otlpSignalURL returns the URL of a stream on an OTLP/HTTP endpoint, e.g.
+// http://collector:4318/v1/metrics
+func otlpSignalURL(endpoint, stream string) string {
+	return strings.TrimSuffix(endpoint, "/") + "/v1/" + stream
+}
+
+// otlpResource returns the resource attributes of the host, following the
+// OpenTelemetry semantic conventions
+func otlpResource(hostID string) *resourcepb.Resource {
+	attrs := map[string]string{
+		"service.name":    otlpScope,
+		"service.version": version.Version,
+		"host.id":         hostID,
+	}
+	info, err := hostinfo.Gather()
+	if err != nil {
+		logger.Log.Warn("failed to gather host info for the OTLP resource", "error", err)
+	} else {
+		attrs["host.name"] = info.Hostname
+		attrs["host.arch"] = info.Arch
+		attrs["os.type"] = info.OS
+		attrs["os.name"] = info.Platform
+		attrs["os.version"] = info.PlatformVersion
+		attrs["container.runtime"] = info.Container
+	}
+	return &resourcepb.Resource{Attributes: otlpAttributes(attrs)}
+}
+
+func (s *otlpSender) send(url string, payload []Payload, headers http.Header) error {
+	var msg proto.Message
+	if s.stream == metricsQueueName {
+		msg = &colmetricspb.ExportMetricsServiceRequest{ResourceMetrics: []*metricspb.ResourceMetrics{{
+			Resource:     s.resource(),
+			ScopeMetrics: []*metricspb.ScopeMetrics{{Scope: &commonpb.InstrumentationScope{Name: otlpScope, Version: version.Version}, Metrics: otlpMetrics(payload)}},
+		}}}
+	} else {
+		msg = &collogspb.ExportLogsServiceRequest{ResourceLogs: []*logspb.ResourceLogs{{
+			Resource:  s.resource(),
+			ScopeLogs: []*logspb.ScopeLogs{{Scope: &commonpb.InstrumentationScope{Name: otlpScope, Version: version.Version}, LogRecords: otlpLogRecords(payload)}},
+		}}}
+	}
+	body, err := proto.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("failed to marshal payload: %w", err)
+	}
+
+	req, err := http.NewRequest("POST", url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	for name, values := range headers {
+		req.Header[name] = values
+	}
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	for name, value := range s.headers {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return &unreachableError{fmt.Errorf("failed to send data to %s: %w", url, err)}
+	}
+	defer resp.Body.Close()
+
+	if err := checkResponse(url, resp); err != nil {
+		return err
+	}
+	if resp.StatusCode/100 != 2 {
+		return rejected(fmt.Errorf("OTLP export to %s failed with status code: %d", url, resp.StatusCode), resp.StatusCode)
+	}
+	return nil
+}
+
+// otlpMetrics groups the metrics by name. Metrics named *_total are
+// cumulative monotonic sums, the other ones gauges.
+func otlpMetrics(payload []Payload) []*metricspb.Metric {
+	var out []*metricspb.Metric
+	points := make(map[string]*[]*metricspb.NumberDataPoint)
+	for _, p := range payload {
+		metric, ok := p.(MetricPayload)
+		if !ok {
+			continue
+		}
+		dataPoints, ok := points[metric.Name]
+		if !ok {
+			m := &metricspb.Metric{Name: metric.Name}
+			if strings.HasSuffix(metric.Name, "_total") {
+				sum := &metricspb.Sum{
+					AggregationTemporality: metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE,
+					IsMonotonic:            true,
+				}
+				m.Data = &metricspb.Metric_Sum{Sum: sum}
+				dataPoints = &sum.DataPoints
+			} else {
+				gauge := &metricspb.Gauge{}
+				m.Data = &metricspb.Metric_Gauge{Gauge: gauge}
+				dataPoints = &gauge.DataPoints
+			}
+			points[metric.Name] = dataPoints
+			out = append(out, m)
+		}
+		*dataPoints = append(*dataPoints, &metricspb.NumberDataPoint{
+			Attributes:   otlpAttributes(metric.Labels),
+			TimeUnixNano: unixNano(metric.Timestamp),
+			Value:        &metricspb.NumberDataPoint_AsDouble{AsDouble: metric.Value},
+		})
+	}
+	return out
+}
+
+// otlpLogRecords converts the logs, the labels and the metadata both become
+// attributes
+func otlpLogRecords(payload []Payload) []*logspb.LogRecord {
+	var out []*logspb.LogRecord
+	for _, p := range payload {
+		log, ok := p.(LogPayload)
+		if !ok {
+			continue
+		}
+		attrs := maps.Clone(log.Metadata)
+		if attrs == nil {
+			attrs = make(map[string]string)
+		}
+		maps.Copy(attrs, log.Labels)
+		out = append(out, &logspb.LogRecord{
+			TimeUnixNano: unixNano(log.Timestamp),
+			SeverityText: log.Labels["level"],
+			Body:         &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: log.Message}},
+			Attributes:   otlpAttributes(attrs),
+		})
+	}
+	return out
+}
+
+// otlpAttributes converts labels to attributes sorted by key, empty values
+// are left out
+func otlpAttributes(labels map[string]string) []*commonpb.KeyValue {
+	var attrs []*commonpb.KeyValue
+	for _, key := range slices.Sorted(maps.Keys(labels)) {
+		if labels[key] == "" {
+			continue
+		}
+		attrs = append(attrs, &commonpb.KeyValue{
+			Key:   key,
+			Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: labels[key]}},
+		})
+	}
+	return attrs
+}
+
+// unixNano converts a payload timestamp in milliseconds
+func unixNano(timestamp string) uint64 {
+	ms, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || ms < 0 {
+		return 0
+	}
+	return uint64(ms) * 1e6
+}
+
+// newOTLPSenders returns the senders of both streams, sharing the resource
+func newOTLPSenders(client *http.Client, headers map[string]string, hostID string) map[string]sender {
+	resource := sync.OnceValue(func() *resourcepb.Resource { return otlpResource(hostID) })
+	return map[string]sender{
+		metricsQueueName: &otlpSender{client: client, headers: headers, stream: metricsQueueName, resource: resource},
+		logsQueueName:    &otlpSender{client: client, headers: headers, stream: logsQueueName, resource: resource},
+	}
+}
@@ -0,0 +1,73 @@
+package exporter
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	"google.golang.org/protobuf/proto"
+
+	"agent/internal/config"
+)
+
+func attribute(attrs []*commonpb.KeyValue, key string) string {
+	for _, kv := range attrs {
+		if kv.GetKey() == key {
+			return kv.GetValue().GetStringValue()
+		}
+	}
+	return ""
+}
+
+func TestFlusher_SendOTLP(t *testing.T) {
+	bodies := map[string][]byte{}
+	var token string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token = r.Header.Get("X-Token")
+		bodies[r.URL.Path], _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+
+	cfg := &config.Config{
+		HostID:     "test-host-id",
+		OTLPExport: config.OTLPExportConfig{Endpoint: ts.URL + "/", Headers: map[string]string{"X-Token": "secret"}},
+	}
+	f, err := newFlusher(nil, cfg, DefaultSettings(), false)
+	require.NoError(t, err)
+
+	metrics := []Payload{
+		MetricPayload{Timestamp: "1000", Name: "requests_total", Value: 3, Labels: map[string]string{"method": "GET"}},
+		MetricPayload{Timestamp: "1000", Name: "cpu_usage_ratio", Value: 0.5},
+		MetricPayload{Timestamp: "2000", Name: "cpu_usage_ratio", Value: 0.75},
+	}
+	require.NoError(t, f.sendBatch(payloadConfig{name: metricsQueueName, endpoints: f.metrics, sender: f.senders[metricsQueueName]}, metrics))
+	logs := []Payload{LogPayload{Timestamp: "1000", Message: "started", Labels: map[string]string{"level": "info"}, Metadata: map[string]string{"pid": "42"}}}
+	require.NoError(t, f.sendBatch(payloadConfig{name: logsQueueName, endpoints: f.logs, sender: f.senders[logsQueueName]}, logs))
+	assert.Equal(t, "secret", token)
+
+	var metricsReq colmetricspb.ExportMetricsServiceRequest
+	require.NoError(t, proto.Unmarshal(bodies["/v1/metrics"], &metricsReq))
+	require.Len(t, metricsReq.ResourceMetrics, 1)
+	assert.Equal(t, "test-host-id", attribute(metricsReq.ResourceMetrics[0].GetResource().GetAttributes(), "host.id"))
+	got := metricsReq.ResourceMetrics[0].ScopeMetrics[0].Metrics
+	require.Len(t, got, 2)
+	assert.Equal(t, "requests_total", got[0].GetName())
+	assert.True(t, got[0].GetSum().GetIsMonotonic())
+	assert.Equal(t, "GET", attribute(got[0].GetSum().GetDataPoints()[0].GetAttributes(), "method"))
+	require.Len(t, got[1].GetGauge().GetDataPoints(), 2)
+	assert.Equal(t, uint64(2e9), got[1].GetGauge().GetDataPoints()[1].GetTimeUnixNano())
+
+	var logsReq collogspb.ExportLogsServiceRequest
+	require.NoError(t, proto.Unmarshal(bodies["/v1/logs"], &logsReq))
+	record := logsReq.ResourceLogs[0].ScopeLogs[0].LogRecords[0]
+	assert.Equal(t, "started", record.GetBody().GetStringValue())
+	assert.Equal(t, "info", record.GetSeverityText())
+	assert.Equal(t, "42", attribute(record.GetAttributes(), "pid"))
+}
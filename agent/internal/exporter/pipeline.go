@@ -0,0 +1,62 @@
+package exporter
+
+import (
+	"strings"
+	"time"
+
+	"agent/internal/selfstats"
+)
+
+// PipelineStats is the state of the export of a stream, as reported by the
+// self-metrics of the flusher
+type PipelineStats struct {
+	Stream              string  `json:"stream"`
+	BacklogEntries      int64   `json:"backlog_entries"`
+	BacklogBytes        int64   `json:"backlog_bytes"`
+	OldestEntryAge      float64 `json:"oldest_entry_age_seconds"`
+	ConsecutiveFailures int     `json:"consecutive_failures"`
+	LastBatchSize       int     `json:"last_batch_size"`
+	FlushDuration       float64 `json:"flush_duration_seconds"`
+	// LastSuccess is zero until a batch was accepted
+	LastSuccess time.Time `json:"last_success,omitzero"`
+}
+
+// Pipelines returns the state of the export of each stream, read from the
+// self-metrics. It's empty until the first flush.
+func Pipelines() []PipelineStats {
+	byStream := make(map[string]*PipelineStats)
+	for _, sample := range selfstats.Snapshot() {
+		stream, ok := sample.Labels["stream"]
+		if !ok || !strings.HasPrefix(sample.Name, "export_") {
+			continue
+		}
+		p := byStream[stream]
+		if p == nil {
+			p = &PipelineStats{Stream: stream}
+			byStream[stream] = p
+		}
+		switch sample.Name {
+		case "export_backlog_entries":
+			p.BacklogEntries = int64(sample.Value)
+		case "export_backlog_bytes":
+			p.BacklogBytes = int64(sample.Value)
+		case "export_oldest_entry_age_seconds":
+			p.OldestEntryAge = sample.Value
+		case "export_consecutive_failures":
+			p.ConsecutiveFailures = int(sample.Value)
+		case "export_batch_size":
+			p.LastBatchSize = int(sample.Value)
+		case "export_flush_duration_seconds":
+			p.FlushDuration = sample.Value
+		case "export_last_success_timestamp_seconds":
+			p.LastSuccess = time.Unix(int64(sample.Value), 0)
+		}
+	}
+	var pipelines []PipelineStats
+	for _, stream := range []string{metricsQueueName, logsQueueName} {
+		if p := byStream[stream]; p != nil {
+			pipelines = append(pipelines, *p)
+		}
+	}
+	return pipelines
+}
@@ -0,0 +1,169 @@
+package exporter
+
+import (
+	"bytes"
+	"cmp"
+	"fmt"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"agent/internal/api"
+
+	"github.com/klauspost/compress/snappy"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// remoteWriteVersion is the version of the Prometheus remote_write protocol
+// implemented by encodeWriteRequest
+const remoteWriteVersion = "0.1.0"
+
+// sample is a value of a remote_write series
+type sample struct {
+	value     float64
+	timestamp int64
+}
+
+// series is a remote_write time series, labels are sorted by name
+type series struct {
+	labels  [][2]string
+	samples []sample
+}
+
+// remoteWriteSender sends metrics to a Prometheus remote_write endpoint, e.g.
+// Mimir or Thanos, as a snappy compressed WriteRequest
+type remoteWriteSender struct {
+	client *http.Client
+	apiKey string
+	hostID string
+}
+
+func (s *remoteWriteSender) send(url string, payload []Payload, headers http.Header) error {
+	body := snappy.Encode(nil, encodeWriteRequest(toSeries(payload)))
+	req, err := http.NewRequest("POST", url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	for name, values := range headers {
+		req.Header[name] = values
+	}
+	req.Header.Set("Authorization", s.apiKey)
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("X-Prometheus-Remote-Write-Version", remoteWriteVersion)
+	if s.hostID != "" {
+		req.Header.Set(api.HostIDHeader, s.hostID)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return &unreachableError{fmt.Errorf("failed to send data to %s: %w", url, err)}
+	}
+	defer resp.Body.Close()
+
+	if err := checkResponse(url, resp); err != nil {
+		return err
+	}
+	// Receivers answer 200 or 204 depending on the implementation
+	if resp.StatusCode/100 != 2 {
+		return rejected(fmt.Errorf("remote write to %s failed with status code: %d", url, resp.StatusCode), resp.StatusCode)
+	}
+	return nil
+}
+
+// toSeries groups the metrics by name and labels. The samples of a series are
+// sorted by timestamp, as required by the receivers.
+func toSeries(payload []Payload) []series {
+	var out []series
+	index := make(map[string]int)
+	for _, p := range payload {
+		metric, ok := p.(MetricPayload)
+		if !ok {
+			continue
+		}
+		ts, err := strconv.ParseInt(metric.Timestamp, 10, 64)
+		if err != nil {
+			continue
+		}
+		labels := make([][2]string, 0, len(metric.Labels)+1)
+		labels = append(labels, [2]string{"__name__", promName(metric.Name)})
+		for name, value := range metric.Labels {
+			labels = append(labels, [2]string{promName(name), value})
+		}
+		slices.SortFunc(labels, func(a, b [2]string) int { return cmp.Compare(a[0], b[0]) })
+
+		var key strings.Builder
+		for _, label := range labels {
+			key.WriteString(label[0])
+			key.WriteByte(0)
+			key.WriteString(label[1])
+			key.WriteByte(0)
+		}
+		i, ok := index[key.String()]
+		if !ok {
+			i = len(out)
+			index[key.String()] = i
+			out = append(out, series{labels: labels})
+		}
+		out[i].samples = append(out[i].samples, sample{value: metric.Value, timestamp: ts})
+	}
+	for _, s := range out {
+		slices.SortStableFunc(s.samples, func(a, b sample) int { return cmp.Compare(a.timestamp, b.timestamp) })
+	}
+	return out
+}
+
+// promName replaces the characters not allowed in Prometheus metric and label
+// names with underscores
+func promName(name string) string {
+	var b strings.Builder
+	for i, r := range name {
+		switch {
+		case r == '_' || r == ':' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z'):
+			b.WriteRune(r)
+		case r >= '0' && r <= '9' && i > 0:
+			b.WriteRune(r)
+		default:
+			b.WriteByte('_')
+		}
+	}
+	return b.String()
+}
+
+// encodeWriteRequest encodes a prometheus.WriteRequest. The message is small
+// enough to be written by hand, so the agent doesn't need generated stubs:
+//
+//	WriteRequest { repeated TimeSeries timeseries = 1; }
+//	TimeSeries   { repeated Label labels = 1; repeated Sample samples = 2; }
+//	Label        { string name = 1; string value = 2; }
+//	Sample       { double value = 1; int64 timestamp = 2; }
+func encodeWriteRequest(all []series) []byte {
+	var out []byte
+	for _, s := range all {
+		var ts []byte
+		for _, label := range s.labels {
+			var l []byte
+			l = protowire.AppendTag(l, 1, protowire.BytesType)
+			l = protowire.AppendString(l, label[0])
+			l = protowire.AppendTag(l, 2, protowire.BytesType)
+			l = protowire.AppendString(l, label[1])
+			ts = protowire.AppendTag(ts, 1, protowire.BytesType)
+			ts = protowire.AppendBytes(ts, l)
+		}
+		for _, smp := range s.samples {
+			var v []byte
+			v = protowire.AppendTag(v, 1, protowire.Fixed64Type)
+			v = protowire.AppendFixed64(v, math.Float64bits(smp.value))
+			v = protowire.AppendTag(v, 2, protowire.VarintType)
+			v = protowire.AppendVarint(v, uint64(smp.timestamp))
+			ts = protowire.AppendTag(ts, 2, protowire.BytesType)
+			ts = protowire.AppendBytes(ts, v)
+		}
+		out = protowire.AppendTag(out, 1, protowire.BytesType)
+		out = protowire.AppendBytes(out, ts)
+	}
+	return out
+}
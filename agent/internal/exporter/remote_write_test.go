@@ -0,0 +1,97 @@
+package exporter
+
+import (
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/klauspost/compress/snappy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"agent/internal/config"
+)
+
+// decodeFields returns the fields of a protobuf message by number, the
+// values of the fixed64 and varint fields are returned as uint64
+func decodeFields(t *testing.T, msg []byte) map[protowire.Number][]any {
+	t.Helper()
+	fields := make(map[protowire.Number][]any)
+	for len(msg) > 0 {
+		num, typ, n := protowire.ConsumeTag(msg)
+		require.GreaterOrEqual(t, n, 0)
+		msg = msg[n:]
+		switch typ {
+		case protowire.BytesType:
+			v, n := protowire.ConsumeBytes(msg)
+			require.GreaterOrEqual(t, n, 0)
+			fields[num] = append(fields[num], v)
+			msg = msg[n:]
+		case protowire.Fixed64Type:
+			v, n := protowire.ConsumeFixed64(msg)
+			require.GreaterOrEqual(t, n, 0)
+			fields[num] = append(fields[num], v)
+			msg = msg[n:]
+		case protowire.VarintType:
+			v, n := protowire.ConsumeVarint(msg)
+			require.GreaterOrEqual(t, n, 0)
+			fields[num] = append(fields[num], v)
+			msg = msg[n:]
+		default:
+			t.Fatalf("unexpected wire type %v", typ)
+		}
+	}
+	return fields
+}
+
+func TestFlusher_SendRemoteWrite(t *testing.T) {
+	var body []byte
+	var headers http.Header
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers = r.Header
+		compressed, _ := io.ReadAll(r.Body)
+		body, _ = snappy.Decode(nil, compressed)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+
+	cfg := &config.Config{
+		APIKey:              "test-api-key",
+		MetricsExportUrl:    ts.URL,
+		MetricsExportFormat: config.MetricsFormatRemoteWrite,
+	}
+	f, err := newFlusher(nil, cfg, DefaultSettings(), false)
+	require.NoError(t, err)
+
+	payload := []Payload{
+		MetricPayload{Timestamp: "2000", Name: "cpu_usage_ratio", Value: 0.5, Labels: map[string]string{"host.name": "web-1"}},
+		MetricPayload{Timestamp: "1000", Name: "cpu_usage_ratio", Value: 0.25, Labels: map[string]string{"host.name": "web-1"}},
+	}
+	err = f.sendBatch(payloadConfig{name: metricsQueueName, endpoints: f.metrics, sender: f.senders[metricsQueueName]}, payload)
+	require.NoError(t, err)
+
+	assert.Equal(t, "snappy", headers.Get("Content-Encoding"))
+	assert.Equal(t, "application/x-protobuf", headers.Get("Content-Type"))
+	assert.Equal(t, remoteWriteVersion, headers.Get("X-Prometheus-Remote-Write-Version"))
+	assert.Equal(t, "test-api-key", headers.Get("Authorization"))
+
+	// Both samples belong to the same series
+	timeseries := decodeFields(t, body)[1]
+	require.Len(t, timeseries, 1)
+	fields := decodeFields(t, timeseries[0].([]byte))
+
+	var labels [][2]string
+	for _, raw := range fields[1] {
+		label := decodeFields(t, raw.([]byte))
+		labels = append(labels, [2]string{string(label[1][0].([]byte)), string(label[2][0].([]byte))})
+	}
+	assert.Equal(t, [][2]string{{"__name__", "cpu_usage_ratio"}, {"host_name", "web-1"}}, labels)
+
+	require.Len(t, fields[2], 2)
+	first := decodeFields(t, fields[2][0].([]byte))
+	assert.Equal(t, 0.25, math.Float64frombits(first[1][0].(uint64)))
+	assert.Equal(t, uint64(1000), first[2][0])
+}
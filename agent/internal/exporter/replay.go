@@ -0,0 +1,70 @@
+package exporter
+
+import (
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"agent/internal/config"
+	"agent/internal/logger"
+)
+
+const defaultReplayWindow = 60 * time.Second
+
+// replayOrder sends the spooled payloads by timestamp windows, oldest first,
+// instead of the order they were spooled in. A batch holds the payloads of
+// the oldest window across the whole spool, sorted by timestamp. The others
+// stay in the spool file until they're sent, like in the file order.
+type replayOrder struct {
+	window time.Duration
+	// maxLag drops the payloads further behind real time, zero keeps them
+	maxLag time.Duration
+}
+
+// newReplayOrder returns the replay order of the config, nil to send the
+// payloads in the order they were spooled
+func newReplayOrder(cfg config.SpoolConfig) *replayOrder {
+	switch cfg.ReplayOrder {
+	case "", "file":
+		return nil
+	case "window":
+	default:
+		logger.Log.Warn("Unknown spool.replay_order, sending the payloads in file order", "order", cfg.ReplayOrder)
+		return nil
+	}
+	r := &replayOrder{
+		window: defaultReplayWindow,
+		maxLag: time.Duration(max(cfg.ReplayMaxLagSeconds, 0)) * time.Second,
+	}
+	if cfg.ReplayWindowSeconds > 0 {
+		r.window = time.Duration(cfg.ReplayWindowSeconds) * time.Second
+	}
+	return r
+}
+
+// pop reads the batch of the oldest window of a queue
+func (r *replayOrder) pop(queue *jsonlQueue, batchSize int) ([][]byte, bool, error) {
+	return queue.PopWindow(batchSize, r.window.Milliseconds(), lineTimestamp)
+}
+
+// cutoff returns the timestamp in milliseconds before which the payloads
+// are dropped, zero when there's no max lag
+func (r *replayOrder) cutoff(now time.Time) int64 {
+	if r == nil || r.maxLag == 0 {
+		return 0
+	}
+	return now.Add(-r.maxLag).UnixMilli()
+}
+
+// lineTimestamp returns the timestamp of a spooled payload in milliseconds,
+// zero when it can't be parsed. Metrics and logs share the field.
+func lineTimestamp(line []byte) int64 {
+	var p struct {
+		Timestamp string `json:"timestamp"`
+	}
+	if err := json.Unmarshal(line, &p); err != nil {
+		return 0
+	}
+	t, _ := strconv.ParseInt(p.Timestamp, 10, 64)
+	return t
+}
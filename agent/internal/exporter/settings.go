@@ -0,0 +1,120 @@
+package exporter
+
+import (
+	"io"
+	"slices"
+	"time"
+
+	"agent/internal/api"
+	"agent/internal/collection"
+)
+
+// Local caps applied to the settings received from the backend. They protect
+// the host from a misconfiguration, e.g. a flush interval so long that the
+// spool grows unbounded or a batch size the HTTP client can't send in time.
+const (
+	minFlushInterval = 1 * time.Second
+	maxFlushInterval = 5 * time.Minute
+	minBatchSize     = 10
+	maxBatchSizeCap  = 1000
+	minMaxAge        = 1 * time.Hour
+	maxMaxAge        = 7 * 24 * time.Hour
+	// minPayloadRate prevents the backend from stalling exports entirely.
+	minPayloadRate = 10
+	// maxSendAttemptsCap bounds the retries so a batch can't hold the flush
+	// loop for long
+	maxSendAttemptsCap = 10
+)
+
+const (
+	defaultSendAttempts = 3
+	defaultRetryBackoff = 500 * time.Millisecond
+)
+
+// Settings controls the spool and the flusher.
+type Settings struct {
+	FlushInterval time.Duration
+	MaxBatchSize  int
+	MaxAge        time.Duration
+	// MaxPayloadsPerSecond limits the export rate of each stream. Zero means
+	// unlimited.
+	MaxPayloadsPerSecond float64
+	// MaxSendAttempts is the number of times a batch is sent before it goes
+	// back to the spool, when the endpoint is unreachable or throttles.
+	MaxSendAttempts int
+	// RetryBackoff is the delay before the first retry, doubled on each
+	// attempt
+	RetryBackoff time.Duration
+	// Compression is the Content-Encoding of the JSON exports, empty to
+	// send them uncompressed
+	Compression string
+	// Endpoints replace the default export URLs, by stream. URLs set in the
+	// config are kept.
+	Endpoints map[string]string
+	// DryRunOutput receives the payloads of a dry run, stdout when nil
+	DryRunOutput io.Writer
+}
+
+// DefaultSettings returns the settings used when the backend doesn't provide any.
+func DefaultSettings() Settings {
+	return Settings{
+		FlushInterval: flushInterval,
+		MaxBatchSize:  maxBatchSize,
+		MaxAge:        maxAge,
+
+		MaxSendAttempts: defaultSendAttempts,
+		RetryBackoff:    defaultRetryBackoff,
+	}
+}
+
+// SettingsFromCollection merges the settings received in the collection
+// config into the defaults, clamping every value to the local caps.
+func SettingsFromCollection(remote *collection.ExportSettings) Settings {
+	s := DefaultSettings()
+	if remote == nil {
+		return s
+	}
+	if remote.FlushIntervalSeconds > 0 {
+		s.FlushInterval = clamp(time.Duration(remote.FlushIntervalSeconds)*time.Second, minFlushInterval, maxFlushInterval)
+	}
+	if remote.MaxBatchSize > 0 {
+		s.MaxBatchSize = clamp(remote.MaxBatchSize, minBatchSize, maxBatchSizeCap)
+	}
+	if remote.MaxAgeSeconds > 0 {
+		s.MaxAge = clamp(time.Duration(remote.MaxAgeSeconds)*time.Second, minMaxAge, maxMaxAge)
+	}
+	if remote.MaxPayloadsPerSecond > 0 {
+		s.MaxPayloadsPerSecond = max(remote.MaxPayloadsPerSecond, minPayloadRate)
+	}
+	if remote.MaxSendAttempts > 0 {
+		s.MaxSendAttempts = min(remote.MaxSendAttempts, maxSendAttemptsCap)
+	}
+	return s
+}
+
+// Negotiate adapts the settings to the capabilities of the backend: the
+// exports are compressed when it accepts gzip, and its limits lower the
+// batch size and export rate. Nil capabilities keep the settings.
+func (s Settings) Negotiate(caps *api.Capabilities) Settings {
+	if caps == nil {
+		return s
+	}
+	if slices.Contains(caps.Encodings, "gzip") {
+		s.Compression = "gzip"
+	}
+	if caps.Limits.MaxBatchSize > 0 {
+		s.MaxBatchSize = min(s.MaxBatchSize, max(caps.Limits.MaxBatchSize, minBatchSize))
+	}
+	if rate := caps.Limits.MaxPayloadsPerSecond; rate > 0 {
+		rate = max(rate, minPayloadRate)
+		if s.MaxPayloadsPerSecond == 0 || rate < s.MaxPayloadsPerSecond {
+			s.MaxPayloadsPerSecond = rate
+		}
+	}
+	s.Endpoints = caps.Endpoints
+	return s
+}
+
+func clamp[T int | time.Duration](v, lo, hi T) T {
+	return min(max(v, lo), hi)
+}
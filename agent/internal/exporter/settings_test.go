@@ -0,0 +1,80 @@
+package exporter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"agent/internal/api"
+	"agent/internal/collection"
+)
+
+func TestSettingsFromCollection_Defaults(t *testing.T) {
+	assert.Equal(t, DefaultSettings(), SettingsFromCollection(nil))
+	assert.Equal(t, DefaultSettings(), SettingsFromCollection(&collection.ExportSettings{}))
+}
+
+func TestSettingsFromCollection_Overrides(t *testing.T) {
+	s := SettingsFromCollection(&collection.ExportSettings{
+		FlushIntervalSeconds: 30,
+		MaxBatchSize:         500,
+		MaxAgeSeconds:        7200,
+		MaxPayloadsPerSecond: 200,
+		MaxSendAttempts:      5,
+	})
+
+	assert.Equal(t, Settings{
+		FlushInterval:        30 * time.Second,
+		MaxBatchSize:         500,
+		MaxAge:               2 * time.Hour,
+		MaxPayloadsPerSecond: 200,
+		MaxSendAttempts:      5,
+		RetryBackoff:         defaultRetryBackoff,
+	}, s)
+}
+
+func TestSettingsFromCollection_Caps(t *testing.T) {
+	low := SettingsFromCollection(&collection.ExportSettings{
+		FlushIntervalSeconds: 1,
+		MaxBatchSize:         1,
+		MaxAgeSeconds:        1,
+		MaxPayloadsPerSecond: 0.5,
+	})
+	assert.Equal(t, Settings{
+		FlushInterval:        minFlushInterval,
+		MaxBatchSize:         minBatchSize,
+		MaxAge:               minMaxAge,
+		MaxPayloadsPerSecond: minPayloadRate,
+		MaxSendAttempts:      defaultSendAttempts,
+		RetryBackoff:         defaultRetryBackoff,
+	}, low)
+
+	high := SettingsFromCollection(&collection.ExportSettings{
+		FlushIntervalSeconds: 86400,
+		MaxBatchSize:         100000,
+		MaxAgeSeconds:        365 * 86400,
+		MaxSendAttempts:      100,
+	})
+	assert.Equal(t, maxFlushInterval, high.FlushInterval)
+	assert.Equal(t, maxBatchSizeCap, high.MaxBatchSize)
+	assert.Equal(t, maxMaxAge, high.MaxAge)
+	assert.Equal(t, maxSendAttemptsCap, high.MaxSendAttempts)
+}
+
+func TestSettingsNegotiate(t *testing.T) {
+	assert.Equal(t, DefaultSettings(), DefaultSettings().Negotiate(nil))
+
+	s := DefaultSettings().Negotiate(&api.Capabilities{
+		Encodings: []string{"zstd", "gzip"},
+		Limits:    api.Limits{MaxBatchSize: 50, MaxPayloadsPerSecond: 1},
+	})
+	assert.Equal(t, "gzip", s.Compression)
+	assert.Equal(t, 50, s.MaxBatchSize)
+	assert.Equal(t, float64(minPayloadRate), s.MaxPayloadsPerSecond)
+
+	// The backend can only lower the batch size
+	s = DefaultSettings().Negotiate(&api.Capabilities{Limits: api.Limits{MaxBatchSize: maxBatchSize * 10}})
+	assert.Equal(t, maxBatchSize, s.MaxBatchSize)
+	assert.Empty(t, s.Compression)
+}
@@ -0,0 +1,15 @@
+package exporter
+
+// Sink receives a copy of the exported payloads, after the limits and host
+// tags are applied. It's meant for embedding the agent, e.g. to inspect what
+// it collects in tests. Sinks are called synchronously and must not block.
+type Sink interface {
+	WriteMetrics(metrics []MetricPayload)
+	WriteLogs(logs []LogPayload)
+}
+
+// AddSink registers a sink receiving the payloads exported from now on. It
+// must not be called concurrently with the Export methods.
+func (e *Exporter) AddSink(sink Sink) {
+	e.sinks = append(e.sinks, sink)
+}
@@ -9,6 +9,7 @@ import (
 	"time"
 
 	"agent/internal/common"
+	"agent/internal/config"
 	"agent/internal/logger"
 )
 
@@ -17,8 +18,18 @@ const (
 	logsQueueName    = "logs"
 	maxBatchSize     = 100
 	maxAge           = 24 * time.Hour
+	// priorityQueueName labels the self-metrics of the priority lane
+	priorityQueueName = "metrics_priority"
 )
 
+// priorityMetrics tell that the agent is up. They're sent before the backlog
+// of the metrics stream, so that after an outage a host doesn't look down
+// while hours of older payloads are sent.
+var priorityMetrics = map[string]bool{
+	"heartbeat":            true,
+	"agent_uptime_seconds": true,
+}
+
 // unmarshalMetric unmarshals a metric payload from JSON
 func unmarshalMetric(data []byte) (Payload, error) {
 	var metric MetricPayload
@@ -40,19 +51,69 @@ func unmarshalLog(data []byte) (Payload, error) {
 type spool struct {
 	metricsQueue *jsonlQueue
 	logsQueue    *jsonlQueue
+	batchSize    int
+	// maxAge is how long the payloads of each stream are kept, by stream
+	// name. Zero never expires them.
+	maxAge map[string]time.Duration
+	expiry *expiry
+	// budget enforces the quota of each stream, nil when unlimited
+	budget *spoolBudget
+	// memory keeps the payloads while the directory can't be written
+	memory *memoryFallback
+	// batches persist the batch being sent on each stream, by stream name
+	batches map[string]*batchLog
+	// inMemory holds the queues of the streams kept in memory while their
+	// endpoint is reachable, by stream name
+	inMemory map[string]*memoryQueue
+	// priority is the lane of the priorityMetrics, kept in memory and sent
+	// first
+	priority *memoryQueue
+	// replay sends the payloads by timestamp windows, nil to send them in
+	// file order
+	replay *replayOrder
 }
 
 type spoolOption func(*spoolParams)
 type spoolParams struct {
 	directory string
+	settings  Settings
+	budget    *config.SpoolConfig
+	inMemory  []string
+	replay    *config.SpoolConfig
+	maxAge    map[string]float64
 }
 
 func withDirectory(dir string) spoolOption {
 	return func(p *spoolParams) { p.directory = dir }
 }
 
+func withSettings(settings Settings) spoolOption {
+	return func(p *spoolParams) { p.settings = settings }
+}
+
+func withBudget(cfg config.SpoolConfig) spoolOption {
+	return func(p *spoolParams) { p.budget = &cfg }
+}
+
+// withInMemory keeps the payloads of the given streams in memory while their
+// endpoint is reachable
+func withInMemory(streams []string) spoolOption {
+	return func(p *spoolParams) { p.inMemory = streams }
+}
+
+// withMaxAge sets the max age of the streams in hours, overriding the
+// settings. Negative never expires the metrics.
+func withMaxAge(hours map[string]float64) spoolOption {
+	return func(p *spoolParams) { p.maxAge = hours }
+}
+
+// withReplay sets the order the payloads are sent in
+func withReplay(cfg config.SpoolConfig) spoolOption {
+	return func(p *spoolParams) { p.replay = &cfg }
+}
+
 func newSpool(opts ...spoolOption) (*spool, error) {
-	params := &spoolParams{}
+	params := &spoolParams{settings: DefaultSettings()}
 
 	for _, opt := range opts {
 		opt(params)
@@ -83,24 +144,120 @@ func newSpool(opts ...spoolOption) (*spool, error) {
 	metricsQueue := newJSONLQueue(metricsQueueName, params.directory)
 	logsQueue := newJSONLQueue(logsQueueName, params.directory)
 
-	return &spool{metricsQueue, logsQueue}, nil
+	s := &spool{
+		metricsQueue: metricsQueue,
+		logsQueue:    logsQueue,
+		batchSize:    params.settings.MaxBatchSize,
+		maxAge: map[string]time.Duration{
+			metricsQueueName: params.settings.MaxAge,
+			logsQueueName:    params.settings.MaxAge,
+		},
+		expiry:   newExpiry(),
+		memory:   newMemoryFallback(),
+		inMemory: make(map[string]*memoryQueue),
+		priority: newMemoryQueue(priorityQueueName),
+		batches: map[string]*batchLog{
+			metricsQueueName: loadBatchLog(params.directory, metricsQueueName),
+			logsQueueName:    loadBatchLog(params.directory, logsQueueName),
+		},
+	}
+	for _, stream := range params.inMemory {
+		if stream != metricsQueueName && stream != logsQueueName {
+			logger.Log.Warn("Unknown stream in spool.in_memory, ignoring it", "stream", stream)
+			continue
+		}
+		s.inMemory[stream] = newMemoryQueue(stream)
+	}
+	for stream, hours := range params.maxAge {
+		switch {
+		case stream != metricsQueueName && stream != logsQueueName:
+			logger.Log.Warn("Unknown stream in spool.max_age_hours, ignoring it", "stream", stream)
+		case hours < 0 && stream == logsQueueName:
+			// The logs would fill the spool quota
+			logger.Log.Warn("The logs can't be kept forever, ignoring spool.max_age_hours", "stream", stream)
+		case hours < 0:
+			s.maxAge[stream] = 0
+		case hours > 0:
+			s.maxAge[stream] = time.Duration(hours * float64(time.Hour))
+		}
+	}
+	if params.replay != nil {
+		s.replay = newReplayOrder(*params.replay)
+	}
+	if params.budget != nil {
+		s.budget = newSpoolBudget(*params.budget, params.directory)
+		s.budget.size[metricsQueueName] = metricsQueue.Size()
+		s.budget.size[logsQueueName] = logsQueue.Size()
+	}
+	return s, nil
 }
 
-// appendToSpool appends a single payload to the specified spool file
+// append appends a single payload to its queue, or returns errSpoolFull when
+// the quota of the queue is used up
 func (s *spool) append(payload Payload) error {
+	return s.write(payload, true)
+}
+
+// putBack appends a payload taken from the spool that couldn't be sent. It
+// was accounted for when first appended, the quota isn't checked.
+func (s *spool) putBack(payload Payload) error {
+	return s.write(payload, false)
+}
+
+func (s *spool) write(payload Payload, checkQuota bool) error {
 	payloadBytes, err := json.Marshal(payload)
 	if err != nil {
 		return fmt.Errorf("failed to marshal payload: %w", err)
 	}
 
+	var queue *jsonlQueue
 	switch payload.(type) {
 	case *MetricPayload, MetricPayload:
-		return s.metricsQueue.Append(payloadBytes)
+		queue = s.metricsQueue
+		// Once the lane is full, the next ones wait in the backlog
+		if isPriority(payload) && s.priority.offer(payloadBytes) {
+			return nil
+		}
 	case *LogPayload, LogPayload:
-		return s.logsQueue.Append(payloadBytes)
+		queue = s.logsQueue
 	default:
 		return fmt.Errorf("unsupported payload type: %T", payload)
 	}
+	// Kept in memory, the disk quota doesn't apply
+	if q := s.inMemory[queue.name]; q != nil && q.offer(payloadBytes) {
+		return nil
+	}
+	if checkQuota && s.budget != nil {
+		if err := s.budget.reserve(queue.name, len(payloadBytes)+1); err != nil {
+			return err
+		}
+	}
+	if s.memory.buffering() {
+		s.memory.add(queue.name, payloadBytes)
+		return nil
+	}
+	err = queue.Append(payloadBytes)
+	if err == nil {
+		s.memory.recover(s.appendTo)
+		return nil
+	}
+	// A read-only or full filesystem would fail every append, keep the
+	// payloads in memory until the disk can be written again
+	if !isUnwritable(err) {
+		return err
+	}
+	s.memory.activate(err)
+	s.memory.add(queue.name, payloadBytes)
+	return nil
+}
+
+// appendTo appends serialized payloads to a queue, bypassing the quota and
+// the memory fallback
+func (s *spool) appendTo(queue string, data []byte) error {
+	if queue == metricsQueueName {
+		return s.metricsQueue.Append(data)
+	}
+	return s.logsQueue.Append(data)
 }
 
 func (s *spool) getBatch(fromQueue string, unmarshal func([]byte) (Payload, error)) ([]Payload, bool, error) {
@@ -109,21 +266,53 @@ func (s *spool) getBatch(fromQueue string, unmarshal func([]byte) (Payload, erro
 		queue = s.metricsQueue
 	}
 
-	lines, hasMore, err := queue.PopBatch(maxBatchSize)
-	if err != nil {
-		return nil, false, err
+	// The priority lane goes first, the backlog is checked on the next batch
+	var lines [][]byte
+	var hasMore bool
+	if fromQueue == metricsQueueName {
+		lines, _ = s.priority.pop(s.batchSize)
+		hasMore = len(lines) > 0
+	}
+	// Then the payloads kept in memory, they're lost on exit
+	if len(lines) == 0 {
+		lines, hasMore = s.memory.pop(fromQueue, s.batchSize)
+	}
+	if q := s.inMemory[fromQueue]; len(lines) == 0 && q != nil {
+		lines, hasMore = q.pop(s.batchSize)
+		hasMore = hasMore || (len(lines) > 0 && queue.Size() > 0)
+	}
+	if len(lines) == 0 {
+		var err error
+		if s.replay != nil {
+			lines, hasMore, err = s.replay.pop(queue, s.batchSize)
+		} else {
+			lines, hasMore, err = queue.PopBatch(s.batchSize)
+		}
+		if err != nil {
+			// Already reported when the fallback was activated
+			if s.memory.isActive() && isUnwritable(err) {
+				return nil, false, nil
+			}
+			return nil, false, err
+		}
 	}
 
 	var toSend []Payload
-	cutoff := time.Now().Add(-maxAge).UnixMilli()
+	now := time.Now()
+	cutoff := s.replay.cutoff(now)
+	var expiresAt int64
+	if maxAge := s.maxAge[fromQueue]; maxAge > 0 {
+		expiresAt = now.Add(-maxAge).UnixMilli()
+	}
 	for _, data := range lines {
 		obj, err := unmarshal(data)
 		if err != nil {
 			logger.Log.Error("failed to unmarshal spool entry", "line", string(data), "error", err)
 			continue
 		}
-		if t, err := strconv.ParseInt(obj.GetTimestamp(), 10, 64); err == nil && t < cutoff {
+		if t, err := strconv.ParseInt(obj.GetTimestamp(), 10, 64); err == nil && (t < expiresAt || t < cutoff) {
 			logger.Log.Debug("skipping stale entry", "timestamp", obj.GetTimestamp())
+			s.expiry.add(fromQueue, t)
 			continue
 		}
 		toSend = append(toSend, obj)
@@ -131,7 +320,137 @@ func (s *spool) getBatch(fromQueue string, unmarshal func([]byte) (Payload, erro
 	return toSend, hasMore, nil
 }
 
+// tracksBatches reports whether the batches of a stream are persisted in its
+// batch log. Writing each batch to the disk would undo a stream kept in
+// memory, and fails while the spool directory can't be written.
+func (s *spool) tracksBatches(stream string) bool {
+	return s.inMemory[stream] == nil && !s.memory.isActive()
+}
+
+// dropExpired removes the payloads older than the max age of a stream, e.g.
+// from a batch left pending by a long outage
+func (s *spool) dropExpired(stream string, payloads []Payload) []Payload {
+	maxAge := s.maxAge[stream]
+	if maxAge <= 0 {
+		return payloads
+	}
+	expiresAt := time.Now().Add(-maxAge).UnixMilli()
+	kept := payloads[:0]
+	for _, p := range payloads {
+		if t, err := strconv.ParseInt(p.GetTimestamp(), 10, 64); err == nil && t < expiresAt {
+			s.expiry.add(stream, t)
+			continue
+		}
+		kept = append(kept, p)
+	}
+	return kept
+}
+
+// expiryAge returns the age past which the payloads of a stream are dropped,
+// the max lag of the replay order when it's shorter than the max age
+func (s *spool) expiryAge(stream string) time.Duration {
+	age := s.maxAge[stream]
+	if s.replay != nil && s.replay.maxLag > 0 && (age <= 0 || s.replay.maxLag < age) {
+		return s.replay.maxLag
+	}
+	return age
+}
+
+// isPriority reports whether a metric goes to the priority lane
+func isPriority(payload Payload) bool {
+	switch m := payload.(type) {
+	case MetricPayload:
+		return priorityMetrics[m.Name]
+	case *MetricPayload:
+		return priorityMetrics[m.Name]
+	}
+	return false
+}
+
+// reportExpired sends the event summing up the payloads of a stream expired
+// since the last call, if any
+func (s *spool) reportExpired(stream string) {
+	event := s.expiry.summary(stream, s.expiryAge(stream))
+	if event == nil {
+		return
+	}
+	if err := s.append(*event); err != nil {
+		logger.Log.Debug("failed to spool the expiry event", "error", err)
+	}
+}
+
+// SpoolBacklog returns the size in bytes of the payloads waiting in the spool
+// of the program directory, whether an agent is running or not.
+func SpoolBacklog() (int64, error) {
+	programDirectory, err := common.GetProgramDirectory()
+	if err != nil {
+		return 0, err
+	}
+	dir := filepath.Join(programDirectory, "spool")
+	return newJSONLQueue(metricsQueueName, dir).Size() + newJSONLQueue(logsQueueName, dir).Size(), nil
+}
+
+// setReachable reports whether the endpoint of a stream accepted the last
+// batch. A stream kept in memory goes to the disk while it's unreachable.
+func (s *spool) setReachable(stream string, reachable bool) {
+	if q := s.inMemory[stream]; q != nil {
+		q.setOverflow(!reachable)
+	}
+}
+
+// backlog returns the size in bytes of the payloads waiting in a queue
+func (s *spool) backlog(queue string) int64 {
+	if queue == metricsQueueName {
+		return s.metricsQueue.Size()
+	}
+	return s.logsQueue.Size()
+}
+
+// queueStats returns the number of entries waiting in a queue, kept in
+// memory or on disk, and the age of the oldest entry on disk
+func (s *spool) queueStats(stream string, unmarshal func([]byte) (Payload, error)) (int64, time.Duration) {
+	queue := s.logsQueue
+	if stream == metricsQueueName {
+		queue = s.metricsQueue
+	}
+	entries, head := queue.Entries()
+	entries += s.memory.len(stream) + s.batches[stream].pendingLen()
+	if stream == metricsQueueName {
+		entries += s.priority.len()
+	}
+	if q := s.inMemory[stream]; q != nil {
+		entries += q.len()
+	}
+	if head == nil {
+		return entries, 0
+	}
+	obj, err := unmarshal(head)
+	if err != nil {
+		return entries, 0
+	}
+	t, err := strconv.ParseInt(obj.GetTimestamp(), 10, 64)
+	if err != nil {
+		return entries, 0
+	}
+	return entries, max(time.Since(time.UnixMilli(t)), 0)
+}
+
 func (s *spool) close() {
+	// Not sent before the shutdown, keep them for the next start
+	for _, data := range s.priority.drain() {
+		if err := s.appendTo(metricsQueueName, data); err != nil {
+			logger.Log.Error("failed to spool priority payloads", "error", err)
+			break
+		}
+	}
+	for stream, q := range s.inMemory {
+		for _, data := range q.drain() {
+			if err := s.appendTo(stream, data); err != nil {
+				logger.Log.Error("failed to spool payloads kept in memory", "stream", stream, "error", err)
+				break
+			}
+		}
+	}
 	if err := s.metricsQueue.Close(); err != nil {
 		logger.Log.Error("failed to close metrics queue", "error", err)
 	}
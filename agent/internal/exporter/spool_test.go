@@ -1,14 +1,19 @@
 package exporter
 
 import (
+	"fmt"
 	"os"
 	"strconv"
 	"sync"
+	"syscall"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+
+	"agent/internal/config"
+	"agent/internal/selfstats"
 )
 
 func TestSpool(t *testing.T) {
@@ -156,3 +161,219 @@ func TestSpoolMultiWriter(t *testing.T) {
 		assert.True(t, seen["writer_b_"+strconv.Itoa(i)])
 	}
 }
+
+func TestMemoryFallback(t *testing.T) {
+	now := time.Now()
+	m := newMemoryFallback()
+	m.now = func() time.Time { return now }
+
+	assert.False(t, m.buffering())
+	m.activate(&os.PathError{Op: "open", Path: "metrics.jsonl", Err: syscall.EROFS})
+	assert.True(t, m.buffering())
+
+	m.add(metricsQueueName, []byte(`{"name":"a"}`))
+	m.add(metricsQueueName, []byte(`{"name":"b"}`))
+	batch, hasMore := m.pop(metricsQueueName, 1)
+	assert.Equal(t, [][]byte{[]byte(`{"name":"a"}`)}, batch)
+	assert.True(t, hasMore)
+
+	// The disk is tried again once per probeInterval
+	now = now.Add(probeInterval)
+	assert.False(t, m.buffering())
+	assert.True(t, m.buffering())
+
+	moved := map[string][]string{}
+	m.recover(func(stream string, data []byte) error {
+		moved[stream] = append(moved[stream], string(data))
+		return nil
+	})
+	assert.False(t, m.isActive())
+	assert.Equal(t, []string{`{"name":"b"}`}, moved[metricsQueueName])
+	// The unwritable and writable events
+	require.Len(t, moved[logsQueueName], 2)
+	assert.Contains(t, moved[logsQueueName][0], "spool_unwritable")
+	assert.Contains(t, moved[logsQueueName][1], "spool_writable")
+}
+
+func TestMemoryFallbackDropsOldest(t *testing.T) {
+	m := newMemoryFallback()
+	entry := make([]byte, memoryBufferBytes/2)
+	m.add(logsQueueName, []byte("first"))
+	m.add(logsQueueName, entry)
+	m.add(logsQueueName, entry)
+
+	batch, hasMore := m.pop(logsQueueName, 10)
+	assert.Len(t, batch, 2)
+	assert.False(t, hasMore)
+	assert.NotEqual(t, "first", string(batch[0]))
+}
+
+func TestIsUnwritable(t *testing.T) {
+	assert.True(t, isUnwritable(fmt.Errorf("append to queue: %w", &os.PathError{Err: syscall.EROFS})))
+	assert.True(t, isUnwritable(&os.PathError{Err: syscall.ENOSPC}))
+	assert.False(t, isUnwritable(&os.PathError{Err: syscall.EACCES}))
+}
+
+func TestSpoolInMemory(t *testing.T) {
+	dir := t.TempDir()
+	s, err := newSpool(withDirectory(dir), withInMemory([]string{metricsQueueName}))
+	require.NoError(t, err)
+
+	now := strconv.FormatInt(time.Now().UnixMilli(), 10)
+	require.NoError(t, s.append(MetricPayload{Timestamp: now, Name: "in_memory"}))
+	require.NoError(t, s.append(LogPayload{Timestamp: now, Message: "on_disk"}))
+	assert.Zero(t, s.backlog(metricsQueueName))
+	assert.NotZero(t, s.backlog(logsQueueName))
+
+	metrics, _, err := s.getBatch(metricsQueueName, unmarshalMetric)
+	require.NoError(t, err)
+	require.Len(t, metrics, 1)
+	assert.Equal(t, "in_memory", metrics[0].(MetricPayload).Name)
+
+	// Unreachable endpoint, the payloads go to the disk
+	s.setReachable(metricsQueueName, false)
+	require.NoError(t, s.append(MetricPayload{Timestamp: now, Name: "overflow"}))
+	assert.NotZero(t, s.backlog(metricsQueueName))
+
+	// Back in memory, and written to the disk on shutdown
+	s.setReachable(metricsQueueName, true)
+	require.NoError(t, s.append(MetricPayload{Timestamp: now, Name: "pending"}))
+	s.close()
+
+	reopened, err := newSpool(withDirectory(dir))
+	require.NoError(t, err)
+	defer reopened.close()
+	metrics, _, err = reopened.getBatch(metricsQueueName, unmarshalMetric)
+	require.NoError(t, err)
+	require.Len(t, metrics, 2)
+	assert.Equal(t, "overflow", metrics[0].(MetricPayload).Name)
+	assert.Equal(t, "pending", metrics[1].(MetricPayload).Name)
+}
+
+func TestSpoolPriority(t *testing.T) {
+	tempDir := t.TempDir()
+	s, err := newSpool(withDirectory(tempDir), withSettings(Settings{MaxBatchSize: 2, MaxAge: maxAge}))
+	require.NoError(t, err)
+
+	ts := strconv.FormatInt(time.Now().UnixMilli(), 10)
+	// The backlog of an outage, then the current heartbeat
+	for i := range 3 {
+		require.NoError(t, s.append(MetricPayload{Timestamp: ts, Name: "cpu_usage_ratio", Value: float64(i)}))
+	}
+	require.NoError(t, s.append(MetricPayload{Timestamp: ts, Name: "heartbeat", Value: 1}))
+
+	batch, hasMore, err := s.getBatch(metricsQueueName, unmarshalMetric)
+	require.NoError(t, err)
+	assert.True(t, hasMore)
+	require.Len(t, batch, 1)
+	assert.Equal(t, "heartbeat", batch[0].(MetricPayload).Name)
+	entries, _ := s.queueStats(metricsQueueName, unmarshalMetric)
+	assert.Equal(t, int64(3), entries)
+
+	batch, _, err = s.getBatch(metricsQueueName, unmarshalMetric)
+	require.NoError(t, err)
+	require.Len(t, batch, 2)
+	assert.Equal(t, "cpu_usage_ratio", batch[0].(MetricPayload).Name)
+
+	// Spooled on shutdown, after the backlog
+	require.NoError(t, s.append(MetricPayload{Timestamp: ts, Name: "heartbeat", Value: 1}))
+	s.close()
+	s, err = newSpool(withDirectory(tempDir), withSettings(Settings{MaxBatchSize: 2, MaxAge: maxAge}))
+	require.NoError(t, err)
+	defer s.close()
+	batch, _, err = s.getBatch(metricsQueueName, unmarshalMetric)
+	require.NoError(t, err)
+	require.Len(t, batch, 2)
+	assert.Equal(t, "cpu_usage_ratio", batch[0].(MetricPayload).Name)
+	assert.Equal(t, "heartbeat", batch[1].(MetricPayload).Name)
+}
+
+func TestSpoolReplayWindow(t *testing.T) {
+	selfstats.Reset()
+	defer selfstats.Reset()
+	tempDir := t.TempDir()
+	replay := withReplay(config.SpoolConfig{ReplayOrder: "window", ReplayWindowSeconds: 60, ReplayMaxLagSeconds: 3600})
+	settings := withSettings(Settings{MaxBatchSize: 2, MaxAge: 24 * time.Hour})
+	s, err := newSpool(withDirectory(tempDir), settings, replay)
+	require.NoError(t, err)
+
+	window := time.Now().Truncate(time.Minute).Add(-10 * time.Minute)
+	at := func(d time.Duration) string { return strconv.FormatInt(window.Add(d).UnixMilli(), 10) }
+	// Spooled out of order across three windows, the oldest one past a
+	// batch, and one behind the max lag
+	require.NoError(t, s.append(MetricPayload{Timestamp: at(70 * time.Second), Name: "second_b"}))
+	require.NoError(t, s.append(MetricPayload{Timestamp: at(65 * time.Second), Name: "second_a"}))
+	require.NoError(t, s.append(MetricPayload{Timestamp: at(-2 * time.Hour), Name: "lagging"}))
+	require.NoError(t, s.append(MetricPayload{Timestamp: at(130 * time.Second), Name: "third"}))
+	require.NoError(t, s.append(MetricPayload{Timestamp: at(30 * time.Second), Name: "first_b"}))
+	require.NoError(t, s.append(MetricPayload{Timestamp: at(10 * time.Second), Name: "first_a"}))
+
+	names := func(batch []Payload) []string {
+		var n []string
+		for _, p := range batch {
+			n = append(n, p.(MetricPayload).Name)
+		}
+		return n
+	}
+	// The oldest window is the lagging payload, dropped as expired
+	batch, hasMore, err := s.getBatch(metricsQueueName, unmarshalMetric)
+	require.NoError(t, err)
+	assert.True(t, hasMore)
+	assert.Empty(t, batch)
+	assert.Equal(t, float64(1), selfstats.NewCounter("spool_expired_total", map[string]string{"stream": metricsQueueName}).Value())
+
+	// Oldest first across the whole spool, not only the entries read
+	batch, hasMore, err = s.getBatch(metricsQueueName, unmarshalMetric)
+	require.NoError(t, err)
+	assert.True(t, hasMore)
+	assert.Equal(t, []string{"first_a", "first_b"}, names(batch))
+	entries, _ := s.queueStats(metricsQueueName, unmarshalMetric)
+	assert.Equal(t, int64(3), entries)
+
+	// The others stay in the spool file, they're kept without a shutdown
+	s, err = newSpool(withDirectory(tempDir), settings, replay)
+	require.NoError(t, err)
+	defer s.close()
+	batch, hasMore, err = s.getBatch(metricsQueueName, unmarshalMetric)
+	require.NoError(t, err)
+	assert.True(t, hasMore)
+	assert.Equal(t, []string{"second_a", "second_b"}, names(batch))
+	batch, hasMore, err = s.getBatch(metricsQueueName, unmarshalMetric)
+	require.NoError(t, err)
+	assert.False(t, hasMore)
+	assert.Equal(t, []string{"third"}, names(batch))
+}
+
+func TestSpoolMaxAge(t *testing.T) {
+	selfstats.Reset()
+	defer selfstats.Reset()
+	s, err := newSpool(withDirectory(t.TempDir()), withMaxAge(map[string]float64{metricsQueueName: -1, logsQueueName: 1}))
+	require.NoError(t, err)
+	defer s.close()
+
+	// Spooled during a long weekend without network
+	weekend := strconv.FormatInt(time.Now().Add(-72*time.Hour).UnixMilli(), 10)
+	require.NoError(t, s.append(MetricPayload{Timestamp: weekend, Name: "cpu_usage_ratio"}))
+	require.NoError(t, s.append(LogPayload{Timestamp: weekend, Message: "expired"}))
+
+	metrics, _, err := s.getBatch(metricsQueueName, unmarshalMetric)
+	require.NoError(t, err)
+	require.Len(t, metrics, 1)
+	s.reportExpired(metricsQueueName)
+
+	logs, _, err := s.getBatch(logsQueueName, unmarshalLog)
+	require.NoError(t, err)
+	assert.Empty(t, logs)
+	assert.Equal(t, float64(1), selfstats.NewCounter("spool_expired_total", map[string]string{"stream": logsQueueName}).Value())
+
+	// Summed up in a single event, once
+	s.reportExpired(logsQueueName)
+	s.reportExpired(logsQueueName)
+	logs, _, err = s.getBatch(logsQueueName, unmarshalLog)
+	require.NoError(t, err)
+	require.Len(t, logs, 1)
+	event := logs[0].(LogPayload)
+	assert.Equal(t, "spool_expired", event.Labels["event"])
+	assert.Equal(t, "1", event.Metadata["count"])
+	assert.Equal(t, "3600", event.Metadata["max_age_seconds"])
+}
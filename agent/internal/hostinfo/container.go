@@ -0,0 +1,53 @@
+package hostinfo
+
+import (
+	"os"
+	"strings"
+
+	"agent/internal/common"
+)
+
+// Paths on the host, read under the host root. They are variables so tests
+// can point them to fixtures.
+var (
+	dockerEnvPath    = "/.dockerenv"
+	containerEnvPath = "/run/.containerenv"
+	cgroupPath       = "/proc/1/cgroup"
+)
+
+// DetectContainer returns the name of the container runtime the agent runs
+// in ("kubernetes", "docker", "podman", "lxc", "containerd"), or an empty
+// string when running directly on the host.
+func DetectContainer() string {
+	if os.Getenv("KUBERNETES_SERVICE_HOST") != "" {
+		return "kubernetes"
+	}
+	if _, err := os.Stat(common.HostPath(containerEnvPath)); err == nil {
+		return "podman"
+	}
+	if _, err := os.Stat(common.HostPath(dockerEnvPath)); err == nil {
+		return "docker"
+	}
+	if env := os.Getenv("container"); env != "" {
+		return env
+	}
+
+	data, err := os.ReadFile(common.HostPath(cgroupPath))
+	if err != nil {
+		return ""
+	}
+	cgroups := string(data)
+	switch {
+	case strings.Contains(cgroups, "kubepods"):
+		return "kubernetes"
+	case strings.Contains(cgroups, "docker"):
+		return "docker"
+	case strings.Contains(cgroups, "libpod"):
+		return "podman"
+	case strings.Contains(cgroups, "lxc"):
+		return "lxc"
+	case strings.Contains(cgroups, "containerd"):
+		return "containerd"
+	}
+	return ""
+}
@@ -7,6 +7,7 @@ import (
 )
 
 type HostInfo struct {
+	HostID          string `json:"host_id,omitempty"`
 	Hostname        string `json:"hostname"`
 	OS              string `json:"os"`
 	Platform        string `json:"platform"`
@@ -15,6 +16,7 @@ type HostInfo struct {
 	KernelVersion   string `json:"kernel_version"`
 	Arch            string `json:"architecture"`
 	AgentVersion    string `json:"agent_version"`
+	Container       string `json:"container,omitempty"`
 }
 
 func Gather() (*HostInfo, error) {
@@ -32,6 +34,7 @@ func Gather() (*HostInfo, error) {
 		KernelVersion:   hInfo.KernelVersion,
 		Arch:            hInfo.KernelArch,
 		AgentVersion:    version.Version,
+		Container:       DetectContainer(),
 	}
 	return info, nil
 }
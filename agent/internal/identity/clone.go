@@ -0,0 +1,166 @@
+package identity
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync/atomic"
+
+	"agent/internal/logger"
+	"agent/internal/selfstats"
+)
+
+// fingerprintFilename records the machine the host ID was resolved on
+const fingerprintFilename = "host_fingerprint.json"
+
+// interfaceMACs is a variable so tests can replace it
+var interfaceMACs = hardwareAddrs
+
+// conflict is 1 once the host ID is known to be shared with another host
+var conflict = selfstats.NewGauge("host_id_conflict", nil)
+
+// conflictReported makes the conflict logged once
+var conflictReported atomic.Bool
+
+// fingerprint describes the machine a host ID belongs to. The same host ID
+// on a machine with another machine-id or other network interfaces means the
+// agent was cloned, e.g. with the disk of a VM.
+type fingerprint struct {
+	HostID    string   `json:"host_id"`
+	MachineID string   `json:"machine_id,omitempty"`
+	MACs      []string `json:"macs,omitempty"`
+}
+
+// currentFingerprint describes this machine
+func currentFingerprint(hostID string) fingerprint {
+	f := fingerprint{HostID: hostID, MACs: interfaceMACs()}
+	f.MachineID, _ = machineID()
+	return f
+}
+
+// sameMachine tells whether two fingerprints describe the same machine. A
+// machine keeping one of its interfaces is the same, so adding a NIC isn't a
+// clone.
+func (f fingerprint) sameMachine(other fingerprint) bool {
+	if f.MachineID != "" && other.MachineID != "" && f.MachineID != other.MachineID {
+		return false
+	}
+	if len(f.MACs) == 0 || len(other.MACs) == 0 {
+		return true
+	}
+	return slices.ContainsFunc(f.MACs, func(mac string) bool { return slices.Contains(other.MACs, mac) })
+}
+
+// CheckClone compares the machine to the one the host ID was first resolved
+// on. A generated host ID copied to another machine is generated again. A
+// host ID derived from the machine can't be, the conflict is reported and
+// the host ID kept until `simob identity reset` or another host ID source.
+//
+// Containers are skipped, their interfaces change on every start.
+func CheckClone(hostID string) (string, error) {
+	if detectContainer() != "" {
+		return hostID, nil
+	}
+	dir, err := storeDirectory()
+	if err != nil {
+		return hostID, fmt.Errorf("failed to get program directory: %w", err)
+	}
+	path := filepath.Join(dir, fingerprintFilename)
+	current := currentFingerprint(hostID)
+
+	stored, err := loadFingerprint(path)
+	if err != nil || stored.HostID != hostID || stored.sameMachine(current) {
+		// First run, or a host ID that changed with its source
+		return hostID, saveFingerprint(path, current)
+	}
+
+	generated, _ := readID(filepath.Join(dir, hostIDFilename))
+	if generated != hostID {
+		ReportConflict("the machine changed since the host ID was resolved")
+		return hostID, nil
+	}
+	if err := os.Remove(filepath.Join(dir, hostIDFilename)); err != nil {
+		return hostID, fmt.Errorf("failed to remove cloned host ID: %w", err)
+	}
+	newID, err := generatedID()
+	if err != nil {
+		return hostID, err
+	}
+	logger.Log.Warn("Host ID copied from another machine, generated a new one", "previous", hostID, "host_id", newID)
+	return newID, saveFingerprint(path, currentFingerprint(newID))
+}
+
+// ReportConflict records that another host uses the same host ID, either
+// detected locally or hinted by the backend. It's logged once.
+func ReportConflict(reason string) {
+	conflict.Set(1)
+	if conflictReported.Swap(true) {
+		return
+	}
+	logger.Log.Error("Another host reports data with the same host ID, run `simob identity reset` on the cloned host",
+		"reason", reason)
+}
+
+// Reset forgets the host ID and resolves it again from source. A generated
+// host ID is replaced by a new one. It returns the previous and the new host
+// ID, the same when it's derived from the machine.
+func Reset(source string) (string, string, error) {
+	dir, err := storeDirectory()
+	if err != nil {
+		return "", "", fmt.Errorf("failed to get program directory: %w", err)
+	}
+	previous, _ := Resolve(source)
+	for _, name := range []string{hostIDFilename, fingerprintFilename} {
+		if err := os.Remove(filepath.Join(dir, name)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return previous, "", fmt.Errorf("failed to remove %s: %w", name, err)
+		}
+	}
+	hostID, err := Resolve(source)
+	if err != nil {
+		return previous, "", err
+	}
+	return previous, hostID, saveFingerprint(filepath.Join(dir, fingerprintFilename), currentFingerprint(hostID))
+}
+
+func loadFingerprint(path string) (fingerprint, error) {
+	var f fingerprint
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return f, err
+	}
+	err = json.Unmarshal(data, &f)
+	return f, err
+}
+
+func saveFingerprint(path string, f fingerprint) error {
+	data, err := json.Marshal(f)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, data, 0o660); err != nil {
+		return fmt.Errorf("failed to save host fingerprint: %w", err)
+	}
+	return nil
+}
+
+// hardwareAddrs returns the sorted MAC addresses of the network interfaces,
+// loopback excluded
+func hardwareAddrs() []string {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil
+	}
+	var macs []string
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagLoopback != 0 || len(iface.HardwareAddr) == 0 {
+			continue
+		}
+		macs = append(macs, iface.HardwareAddr.String())
+	}
+	slices.Sort(macs)
+	return slices.Compact(macs)
+}
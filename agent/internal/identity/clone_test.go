@@ -0,0 +1,75 @@
+package identity
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// setMACs replaces the interfaces of the machine
+func setMACs(t *testing.T, macs ...string) {
+	orig := interfaceMACs
+	t.Cleanup(func() { interfaceMACs = orig })
+	interfaceMACs = func() []string { return macs }
+}
+
+func TestCheckClone_RegeneratesGeneratedID(t *testing.T) {
+	setup(t, "", "", "")
+	setMACs(t, "52:54:00:aa:bb:01")
+
+	id, err := Resolve(SourceAuto)
+	require.NoError(t, err)
+	checked, err := CheckClone(id)
+	require.NoError(t, err)
+	assert.Equal(t, id, checked)
+
+	// A new interface isn't a clone
+	setMACs(t, "52:54:00:aa:bb:01", "52:54:00:aa:bb:02")
+	checked, err = CheckClone(id)
+	require.NoError(t, err)
+	assert.Equal(t, id, checked)
+
+	// Same program directory on another machine
+	setMACs(t, "52:54:00:cc:dd:01")
+	checked, err = CheckClone(id)
+	require.NoError(t, err)
+	assert.NotEqual(t, id, checked)
+	again, err := Resolve(SourceAuto)
+	require.NoError(t, err)
+	assert.Equal(t, checked, again)
+}
+
+func TestCheckClone_ReportsDerivedID(t *testing.T) {
+	setup(t, "abcdef0123", "", "")
+	setMACs(t, "52:54:00:aa:bb:01")
+	conflict.Set(0)
+
+	_, err := CheckClone("abcdef0123")
+	require.NoError(t, err)
+
+	setMACs(t, "52:54:00:cc:dd:01")
+	checked, err := CheckClone("abcdef0123")
+	require.NoError(t, err)
+	assert.Equal(t, "abcdef0123", checked, "a derived host ID is kept")
+	assert.Equal(t, 1.0, conflict.Value())
+}
+
+func TestReset(t *testing.T) {
+	dir := setup(t, "", "", "")
+	setMACs(t, "52:54:00:aa:bb:01")
+
+	id, err := Resolve(SourceGenerated)
+	require.NoError(t, err)
+	previous, hostID, err := Reset(SourceGenerated)
+	require.NoError(t, err)
+	assert.Equal(t, id, previous)
+	assert.NotEqual(t, id, hostID)
+	assert.FileExists(t, filepath.Join(dir, fingerprintFilename))
+
+	stored, err := os.ReadFile(filepath.Join(dir, hostIDFilename))
+	require.NoError(t, err)
+	assert.Equal(t, hostID+"\n", string(stored))
+}
@@ -0,0 +1,84 @@
+package identity
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/shirou/gopsutil/v4/host"
+
+	"agent/internal/common"
+)
+
+// deferredFilename marks an agent baked into a machine image. It holds the
+// boot the image was prepared on, the registration waits for another boot.
+const deferredFilename = "deferred_registration"
+
+// bootIDPath identifies the current boot on Linux. Elsewhere the boot time
+// is used.
+var bootIDPath = "/proc/sys/kernel/random/boot_id"
+
+// bootID is a variable so tests can replace it
+var bootID = func() (string, error) {
+	if id, err := readID(common.HostPath(bootIDPath)); err == nil {
+		return id, nil
+	}
+	bootTime, err := host.BootTime()
+	if err != nil {
+		return "", fmt.Errorf("failed to identify the boot: %w", err)
+	}
+	return strconv.FormatUint(bootTime, 10), nil
+}
+
+// DeferRegistration prepares the agent to be baked into a machine image. The
+// host ID resolved so far is forgotten and the agent doesn't start until the
+// machine boots again, i.e. as an instance of the image, so that instances
+// get their own host ID instead of all registering as the image builder.
+func DeferRegistration() error {
+	dir, err := storeDirectory()
+	if err != nil {
+		return fmt.Errorf("failed to get program directory: %w", err)
+	}
+	for _, name := range []string{hostIDFilename, fingerprintFilename} {
+		if err := os.Remove(filepath.Join(dir, name)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("failed to remove %s: %w", name, err)
+		}
+	}
+	boot, err := bootID()
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, deferredFilename), []byte(boot+"\n"), 0o660)
+}
+
+// RegistrationDeferred tells whether the agent runs on the machine the image
+// is being prepared on. On the first boot of an instance, the mark is removed
+// and the agent starts as usual.
+func RegistrationDeferred() (bool, error) {
+	dir, err := storeDirectory()
+	if err != nil {
+		return false, fmt.Errorf("failed to get program directory: %w", err)
+	}
+	path := filepath.Join(dir, deferredFilename)
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	boot, err := bootID()
+	if err != nil {
+		return false, err
+	}
+	if strings.TrimSpace(string(data)) == boot {
+		return true, nil
+	}
+	if err := os.Remove(path); err != nil {
+		return false, fmt.Errorf("failed to remove the deferred registration mark: %w", err)
+	}
+	return false, nil
+}
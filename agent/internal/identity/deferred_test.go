@@ -0,0 +1,40 @@
+package identity
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeferRegistration(t *testing.T) {
+	dir := setup(t, "", "", "")
+	origBoot := bootID
+	t.Cleanup(func() { bootID = origBoot })
+	boot := "image-build"
+	bootID = func() (string, error) { return boot, nil }
+
+	id, err := Resolve(SourceGenerated)
+	require.NoError(t, err)
+	require.NoError(t, DeferRegistration())
+	assert.NoFileExists(t, filepath.Join(dir, hostIDFilename))
+
+	// Still on the machine preparing the image
+	deferred, err := RegistrationDeferred()
+	require.NoError(t, err)
+	assert.True(t, deferred)
+
+	// First boot of an instance
+	boot = "instance"
+	deferred, err = RegistrationDeferred()
+	require.NoError(t, err)
+	assert.False(t, deferred)
+	_, err = os.Stat(filepath.Join(dir, deferredFilename))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	instanceID, err := Resolve(SourceGenerated)
+	require.NoError(t, err)
+	assert.NotEqual(t, id, instanceID)
+}
@@ -0,0 +1,152 @@
+// Package identity resolves a stable identifier for the host the agent runs
+// on. The identifier survives hostname changes and re-installations so the
+// backend doesn't register the same machine twice.
+package identity
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/shirou/gopsutil/v4/host"
+
+	"agent/internal/common"
+	"agent/internal/hostinfo"
+	"agent/internal/logger"
+)
+
+// Supported identity sources, selected with the host_id_source config key.
+const (
+	SourceAuto        = "auto"
+	SourceMachineID   = "machine-id"
+	SourceProductUUID = "product-uuid"
+	SourceGenerated   = "generated"
+)
+
+// hostIDFilename is the name of the file holding the generated identifier.
+const hostIDFilename = "host_id"
+
+// Paths and lookups are variables so tests can replace them.
+var (
+	machineIDPaths  = []string{"/etc/machine-id", "/var/lib/dbus/machine-id"}
+	productUUIDPath = "/sys/class/dmi/id/product_uuid"
+	platformHostID  = host.HostID
+	detectContainer = hostinfo.DetectContainer
+	storeDirectory  = common.GetProgramDirectory
+)
+
+// ValidateSource returns an error when source isn't one of the supported
+// identity sources. Unlike Resolve, it has no side effect.
+func ValidateSource(source string) error {
+	switch source {
+	case "", SourceAuto, SourceMachineID, SourceProductUUID, SourceGenerated:
+		return nil
+	}
+	return fmt.Errorf("unknown host ID source: %q", source)
+}
+
+// Resolve returns the host identifier for the given source. An empty source
+// is treated as SourceAuto, which tries machine-id, then the hardware product
+// UUID, and finally falls back to a generated identifier persisted next to
+// the agent. Inside containers machine-id and product UUID are skipped since
+// they usually belong to the image or to the underlying node.
+func Resolve(source string) (string, error) {
+	switch source {
+	case "", SourceAuto:
+		if container := detectContainer(); container != "" {
+			logger.Log.Debug("Running in a container, using generated host ID", "container", container)
+			return generatedID()
+		}
+		if id, err := machineID(); err == nil {
+			return id, nil
+		}
+		if id, err := productUUID(); err == nil {
+			return id, nil
+		}
+		return generatedID()
+	case SourceMachineID:
+		return machineID()
+	case SourceProductUUID:
+		return productUUID()
+	case SourceGenerated:
+		return generatedID()
+	default:
+		return "", ValidateSource(source)
+	}
+}
+
+// machineID reads the systemd/dbus machine ID.
+func machineID() (string, error) {
+	for _, path := range machineIDPaths {
+		if id, err := readID(common.HostPath(path)); err == nil {
+			return id, nil
+		}
+	}
+	return "", errors.New("machine-id not available")
+}
+
+// productUUID reads the hardware UUID exposed by the firmware. On non Linux
+// platforms the platform specific identifier is used (MachineGuid on Windows).
+func productUUID() (string, error) {
+	if id, err := readID(common.HostPath(productUUIDPath)); err == nil {
+		return id, nil
+	}
+	id, err := platformHostID()
+	if err != nil {
+		return "", fmt.Errorf("product UUID not available: %w", err)
+	}
+	id = strings.ToLower(strings.TrimSpace(id))
+	if id == "" {
+		return "", errors.New("product UUID not available")
+	}
+	return id, nil
+}
+
+// generatedID returns the persisted random identifier, creating it on first use.
+func generatedID() (string, error) {
+	dir, err := storeDirectory()
+	if err != nil {
+		return "", fmt.Errorf("failed to get program directory: %w", err)
+	}
+	path := filepath.Join(dir, hostIDFilename)
+	if id, err := readID(path); err == nil {
+		return id, nil
+	}
+
+	id, err := newUUID()
+	if err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(path, []byte(id+"\n"), 0o660); err != nil {
+		return "", fmt.Errorf("failed to persist host ID: %w", err)
+	}
+	logger.Log.Info("Generated new host ID", "host_id", id, "path", path)
+	return id, nil
+}
+
+// readID reads an identifier file, rejecting empty content.
+func readID(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	id := strings.ToLower(strings.TrimSpace(string(data)))
+	if id == "" {
+		return "", fmt.Errorf("empty identifier in %s", path)
+	}
+	return id, nil
+}
+
+// newUUID returns a random (version 4) UUID.
+func newUUID() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", fmt.Errorf("failed to generate host ID: %w", err)
+	}
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16]), nil
+}
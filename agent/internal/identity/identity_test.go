@@ -0,0 +1,118 @@
+package identity
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"agent/internal/logger"
+)
+
+func init() {
+	logger.Log = slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+// setup points all identity sources to a temporary directory.
+func setup(t *testing.T, machineID, productUUID, container string) string {
+	dir := t.TempDir()
+
+	machineIDPath := filepath.Join(dir, "machine-id")
+	if machineID != "" {
+		require.NoError(t, os.WriteFile(machineIDPath, []byte(machineID+"\n"), 0o600))
+	}
+	productUUIDFile := filepath.Join(dir, "product_uuid")
+	if productUUID != "" {
+		require.NoError(t, os.WriteFile(productUUIDFile, []byte(productUUID+"\n"), 0o600))
+	}
+
+	origMachine, origProduct, origPlatform := machineIDPaths, productUUIDPath, platformHostID
+	origContainer, origStore := detectContainer, storeDirectory
+	t.Cleanup(func() {
+		machineIDPaths, productUUIDPath, platformHostID = origMachine, origProduct, origPlatform
+		detectContainer, storeDirectory = origContainer, origStore
+	})
+
+	machineIDPaths = []string{machineIDPath}
+	productUUIDPath = productUUIDFile
+	platformHostID = func() (string, error) { return "", errors.New("unsupported") }
+	detectContainer = func() string { return container }
+	storeDirectory = func() (string, error) { return dir, nil }
+	return dir
+}
+
+func TestResolve_AutoPrefersMachineID(t *testing.T) {
+	setup(t, "ABCDEF0123", "4C4C4544-0042", "")
+
+	id, err := Resolve(SourceAuto)
+	require.NoError(t, err)
+	assert.Equal(t, "abcdef0123", id)
+
+	id, err = Resolve("")
+	require.NoError(t, err)
+	assert.Equal(t, "abcdef0123", id)
+}
+
+func TestResolve_AutoFallsBackToProductUUID(t *testing.T) {
+	setup(t, "", "4C4C4544-0042", "")
+
+	id, err := Resolve(SourceAuto)
+	require.NoError(t, err)
+	assert.Equal(t, "4c4c4544-0042", id)
+}
+
+func TestResolve_GeneratedIsPersisted(t *testing.T) {
+	dir := setup(t, "", "", "")
+
+	id, err := Resolve(SourceAuto)
+	require.NoError(t, err)
+	assert.Regexp(t, `^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`, id)
+
+	stored, err := os.ReadFile(filepath.Join(dir, hostIDFilename))
+	require.NoError(t, err)
+	assert.Equal(t, id+"\n", string(stored))
+
+	again, err := Resolve(SourceGenerated)
+	require.NoError(t, err)
+	assert.Equal(t, id, again)
+}
+
+func TestResolve_ContainerUsesGenerated(t *testing.T) {
+	setup(t, "abcdef0123", "", "docker")
+
+	id, err := Resolve(SourceAuto)
+	require.NoError(t, err)
+	assert.NotEqual(t, "abcdef0123", id)
+
+	// Explicit source is still honored
+	id, err = Resolve(SourceMachineID)
+	require.NoError(t, err)
+	assert.Equal(t, "abcdef0123", id)
+}
+
+func TestResolve_Errors(t *testing.T) {
+	setup(t, "", "", "")
+
+	_, err := Resolve(SourceMachineID)
+	assert.Error(t, err)
+	_, err = Resolve(SourceProductUUID)
+	assert.Error(t, err)
+	_, err = Resolve("hostname")
+	assert.Error(t, err)
+}
+
+func TestValidateSource(t *testing.T) {
+	dir := setup(t, "", "", "")
+
+	for _, source := range []string{"", SourceAuto, SourceMachineID, SourceProductUUID, SourceGenerated} {
+		assert.NoError(t, ValidateSource(source))
+	}
+	assert.Error(t, ValidateSource("hostname"))
+	// Nothing is generated by the validation
+	assert.NoFileExists(t, filepath.Join(dir, hostIDFilename))
+}
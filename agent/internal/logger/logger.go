@@ -21,6 +21,6 @@ func Init(debug bool) {
 		handler = slog.NewTextHandler(os.Stdout, opts)
 	}
 
-	Log = slog.New(handler)
+	Log = slog.New(newSamplingHandler(handler))
 	slog.SetDefault(Log)
 }
@@ -0,0 +1,99 @@
+package logger
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// The warnings and errors with the same message are logged at most
+// sampleBurst times per sampleWindow, the following ones are counted and
+// reported once the window elapsed. An export failing every second would
+// otherwise flood the logs, and the logs collected from journald.
+const (
+	sampleBurst  = 10
+	sampleWindow = time.Minute
+)
+
+// samplingHandler rate-limits the warnings and errors of the agent. The
+// debug and info logs aren't sampled.
+type samplingHandler struct {
+	next  slog.Handler
+	state *samplingState
+}
+
+// samplingState is shared by the handlers derived with WithAttrs and
+// WithGroup
+type samplingState struct {
+	mu          sync.Mutex
+	now         func() time.Time
+	windowStart time.Time
+	counts      map[sampleKey]int
+}
+
+type sampleKey struct {
+	level   slog.Level
+	message string
+}
+
+func newSamplingHandler(next slog.Handler) *samplingHandler {
+	return &samplingHandler{next: next, state: &samplingState{now: time.Now, counts: make(map[sampleKey]int)}}
+}
+
+func (h *samplingHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+func (h *samplingHandler) Handle(ctx context.Context, r slog.Record) error {
+	if r.Level < slog.LevelWarn {
+		return h.next.Handle(ctx, r)
+	}
+	allowed, suppressed := h.state.sample(sampleKey{level: r.Level, message: r.Message})
+	for _, s := range suppressed {
+		h.reportSuppressed(ctx, s)
+	}
+	if !allowed {
+		return nil
+	}
+	return h.next.Handle(ctx, r)
+}
+
+// suppressedLogs are the logs of a message dropped during a window
+type suppressedLogs struct {
+	key   sampleKey
+	count int
+}
+
+// sample counts a log and reports whether it's written. It returns the logs
+// suppressed during the previous window when a new one starts.
+func (s *samplingState) sample(key sampleKey) (bool, []suppressedLogs) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var suppressed []suppressedLogs
+	if now := s.now(); now.Sub(s.windowStart) >= sampleWindow {
+		for k, count := range s.counts {
+			if count > sampleBurst {
+				suppressed = append(suppressed, suppressedLogs{key: k, count: count - sampleBurst})
+			}
+		}
+		s.windowStart = now
+		clear(s.counts)
+	}
+	s.counts[key]++
+	return s.counts[key] <= sampleBurst, suppressed
+}
+
+func (h *samplingHandler) reportSuppressed(ctx context.Context, s suppressedLogs) {
+	r := slog.NewRecord(time.Now(), slog.LevelWarn, "Suppressed repeated log messages", 0)
+	r.AddAttrs(slog.String("suppressed_level", s.key.level.String()), slog.String("message", s.key.message), slog.Int("count", s.count))
+	_ = h.next.Handle(ctx, r)
+}
+
+func (h *samplingHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &samplingHandler{next: h.next.WithAttrs(attrs), state: h.state}
+}
+
+func (h *samplingHandler) WithGroup(name string) slog.Handler {
+	return &samplingHandler{next: h.next.WithGroup(name), state: h.state}
+}
@@ -0,0 +1,35 @@
+package logger
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSamplingHandler(t *testing.T) {
+	var out bytes.Buffer
+	h := newSamplingHandler(slog.NewTextHandler(&out, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	now := time.Unix(1700000000, 0)
+	h.state.now = func() time.Time { return now }
+	log := slog.New(h).With("component", "exporter")
+
+	for i := 0; i < sampleBurst+5; i++ {
+		log.Error("failed to export logs payload", "attempt", i)
+		log.Info("Logs collected")
+	}
+	log.Error("failed to export metrics payload")
+	assert.Equal(t, sampleBurst, strings.Count(out.String(), "failed to export logs payload"))
+	assert.Equal(t, sampleBurst+5, strings.Count(out.String(), "Logs collected"), "info logs aren't sampled")
+	assert.Equal(t, 1, strings.Count(out.String(), "failed to export metrics payload"))
+
+	// The suppressed logs are reported in the next window
+	out.Reset()
+	now = now.Add(sampleWindow)
+	log.Error("failed to export logs payload")
+	assert.Contains(t, out.String(), `msg="Suppressed repeated log messages" component=exporter suppressed_level=ERROR message="failed to export logs payload" count=5`)
+	assert.Contains(t, out.String(), `level=ERROR msg="failed to export logs payload"`)
+}
@@ -8,7 +8,9 @@ import (
 	"time"
 
 	"agent/internal/collection"
+	"agent/internal/common"
 	"agent/internal/logs"
+	"agent/internal/logs/patterns"
 )
 
 type ApacheLogCollector struct {
@@ -30,7 +32,7 @@ func (c *ApacheLogCollector) Name() string {
 
 func (c *ApacheLogCollector) Discover() []collection.LogSource {
 	sources := []collection.LogSource{}
-	files, _ := filepath.Glob(c.pattern)
+	files, _ := filepath.Glob(common.HostPath(c.pattern))
 	if len(files) > 0 {
 		sources = append(sources, collection.LogSource{Name: c.name, Path: c.pattern})
 	}
@@ -40,7 +42,7 @@ func (c *ApacheLogCollector) Discover() []collection.LogSource {
 func (c *ApacheLogCollector) Start(ctx context.Context, out chan<- logs.LogEntry) error {
 	// Initialize the runner on the first start
 	if c.runner == nil {
-		runner, err := logs.NewTailRunner(c.pattern, c.processLogLine)
+		runner, err := logs.NewTailRunner(c.name, c.pattern, c.processLogLine)
 		if err != nil {
 			return err
 		}
@@ -63,10 +65,14 @@ func (c *ApacheLogCollector) processLogLine(logLine string) (logs.LogEntry, erro
 		Labels: make(map[string]string),
 	}
 
-	// Match labels
-	regex := `\[(?P<timestamp>\d{2}/\w{3}/\d{4}:\d{2}:\d{2}:\d{2} [+-]\d{4})\]`
-	re := regexp.MustCompile(regex)
-	matches := re.FindStringSubmatch(logLine)
+	// Match labels, with the first pattern variant matching the line
+	var re *regexp.Regexp
+	var matches []string
+	for _, re = range patterns.Source(c.name) {
+		if matches = re.FindStringSubmatch(logLine); matches != nil {
+			break
+		}
+	}
 	if matches == nil {
 		return logs.LogEntry{}, fmt.Errorf("can't match any label in logline")
 	}
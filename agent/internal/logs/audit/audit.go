@@ -0,0 +1,250 @@
+package audit
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"agent/internal/collection"
+	"agent/internal/common"
+	"agent/internal/logs"
+)
+
+// keysOption is the log source option holding the comma separated list of
+// audit rule keys (auditctl -k) to ship. When empty, every record is shipped.
+const keysOption = "keys"
+
+// maxMatchedEvents bounds the serials of the events kept by the key filter.
+// The records of an event are written together, only the latest events can
+// still have records to come.
+const maxMatchedEvents = 256
+
+type AuditLogCollector struct {
+	name    string
+	pattern string
+	keys    map[string]bool
+	runner  *logs.TailRunner
+
+	mu sync.Mutex
+	// matched holds the serials of the events whose key is configured, in
+	// the order they were seen
+	matched []string
+}
+
+func NewAuditLogCollector() *AuditLogCollector {
+	return &AuditLogCollector{
+		name:    "audit",
+		pattern: "/var/log/audit/audit.log",
+	}
+}
+
+func (c *AuditLogCollector) Name() string {
+	return c.name
+}
+
+func (c *AuditLogCollector) Discover() []collection.LogSource {
+	sources := []collection.LogSource{}
+	files, _ := filepath.Glob(common.HostPath(c.pattern))
+	if len(files) > 0 {
+		sources = append(sources, collection.LogSource{Name: c.name, Path: c.pattern})
+	}
+	return sources
+}
+
+// Configure applies the per-source options received in the collection config.
+func (c *AuditLogCollector) Configure(src collection.LogSource) {
+	c.mu.Lock()
+	c.matched = nil
+	c.mu.Unlock()
+	c.keys = nil
+	for _, key := range strings.Split(src.Options[keysOption], ",") {
+		key = strings.TrimSpace(key)
+		if key == "" {
+			continue
+		}
+		if c.keys == nil {
+			c.keys = make(map[string]bool)
+		}
+		c.keys[key] = true
+	}
+}
+
+func (c *AuditLogCollector) Start(ctx context.Context, out chan<- logs.LogEntry) error {
+	// Initialize the runner on the first start
+	if c.runner == nil {
+		runner, err := logs.NewTailRunner(c.name, c.pattern, c.processLogLine)
+		if err != nil {
+			return err
+		}
+		c.runner = runner
+	}
+	return c.runner.Start(ctx, out)
+}
+
+func (c *AuditLogCollector) Stop() error {
+	if c.runner == nil {
+		return nil
+	}
+	return c.runner.Stop()
+}
+
+// processLogLine parses a raw auditd record such as:
+//
+//	type=SYSCALL msg=audit(1364481363.243:24287): arch=c000003e syscall=2 success=no key="access"
+//
+// Every key=value pair is stored in the metadata. Only the SYSCALL record of
+// an event carries the rule key: events whose key is not part of the
+// configured keys are filtered out, the other records of an event (PATH, CWD,
+// EXECVE...) are matched to it by serial.
+func (c *AuditLogCollector) processLogLine(logLine string) (logs.LogEntry, error) {
+	fields := parseFields(logLine)
+
+	recordType, ok := fields["type"]
+	if !ok {
+		return logs.LogEntry{}, fmt.Errorf("can't find record type in audit line")
+	}
+
+	timestamp, serial, err := parseHeader(fields["msg"])
+	if err != nil {
+		return logs.LogEntry{}, err
+	}
+	delete(fields, "msg")
+
+	if c.keys != nil && !c.keep(recordType, serial, fields) {
+		return logs.LogEntry{}, logs.ErrFiltered
+	}
+
+	fields["serial"] = serial
+	return logs.LogEntry{
+		Timestamp: timestamp,
+		Source:    c.name,
+		Text:      logLine,
+		Labels:    map[string]string{"type": recordType},
+		Metadata:  fields,
+	}, nil
+}
+
+// keep reports whether a record belongs to an event matching the configured
+// keys. The event is remembered on the record carrying the key, and
+// forgotten on its end of event record.
+func (c *AuditLogCollector) keep(recordType, serial string, fields map[string]string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if key, ok := fields["key"]; ok {
+		if !c.keys[key] {
+			return false
+		}
+		c.matched = append(c.matched, serial)
+		if len(c.matched) > maxMatchedEvents {
+			c.matched = c.matched[1:]
+		}
+		return true
+	}
+	for i, matched := range c.matched {
+		if matched != serial {
+			continue
+		}
+		if recordType == "EOE" {
+			c.matched = append(c.matched[:i], c.matched[i+1:]...)
+		}
+		return true
+	}
+	return false
+}
+
+// parseHeader extracts the timestamp (in milliseconds) and the event serial
+// from the "audit(<seconds>.<millis>:<serial>):" record header.
+func parseHeader(header string) (int64, string, error) {
+	inner, ok := strings.CutPrefix(header, "audit(")
+	if !ok {
+		return 0, "", fmt.Errorf("can't find audit header in line")
+	}
+	inner = strings.TrimSuffix(strings.TrimSuffix(inner, ":"), ")")
+
+	ts, serial, ok := strings.Cut(inner, ":")
+	if !ok {
+		return 0, "", fmt.Errorf("malformed audit header %q", header)
+	}
+	millis, err := parseTimestamp(ts)
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to parse audit timestamp: %w", err)
+	}
+	return millis, serial, nil
+}
+
+// parseTimestamp converts seconds with a fractional part, e.g. 1700000000.123,
+// to milliseconds. The parts are parsed as integers, a float would be off by
+// one millisecond for some values.
+func parseTimestamp(ts string) (int64, error) {
+	secondsPart, fraction, _ := strings.Cut(ts, ".")
+	seconds, err := strconv.ParseInt(secondsPart, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	// Keep the milliseconds digits, padded when fewer are given
+	fraction = (fraction + "000")[:3]
+	millis, err := strconv.ParseInt(fraction, 10, 64)
+	if err != nil || millis < 0 {
+		return 0, fmt.Errorf("invalid fractional seconds in %q", ts)
+	}
+	return seconds*1000 + millis, nil
+}
+
+// parseFields splits a line into key=value pairs. Values may be wrapped in
+// double quotes, or in single quotes for the nested message of user space
+// records (e.g. msg='op=PAM:session_open acct="root"'), in which case the
+// nested pairs are flattened into the result.
+func parseFields(line string) map[string]string {
+	fields := make(map[string]string)
+	for len(line) > 0 {
+		line = strings.TrimLeft(line, " ")
+		eq := strings.IndexByte(line, '=')
+		if eq <= 0 {
+			break
+		}
+		key := line[:eq]
+		if sp := strings.IndexByte(key, ' '); sp >= 0 {
+			// Token without value, skip it
+			line = line[sp:]
+			continue
+		}
+		line = line[eq+1:]
+
+		var value string
+		switch {
+		case strings.HasPrefix(line, `"`):
+			end := strings.IndexByte(line[1:], '"')
+			if end < 0 {
+				value, line = line[1:], ""
+			} else {
+				value, line = line[1:end+1], line[end+2:]
+			}
+		case strings.HasPrefix(line, "'"):
+			end := strings.IndexByte(line[1:], '\'')
+			var nested string
+			if end < 0 {
+				nested, line = line[1:], ""
+			} else {
+				nested, line = line[1:end+1], line[end+2:]
+			}
+			for k, v := range parseFields(nested) {
+				if _, exists := fields[k]; !exists {
+					fields[k] = v
+				}
+			}
+			continue
+		default:
+			end := strings.IndexByte(line, ' ')
+			if end < 0 {
+				value, line = line, ""
+			} else {
+				value, line = line[:end], line[end:]
+			}
+		}
+		fields[key] = value
+	}
+	return fields
+}
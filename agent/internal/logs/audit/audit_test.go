@@ -0,0 +1,122 @@
+package audit
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"agent/internal/collection"
+	"agent/internal/logs"
+)
+
+const syscallLine = `type=SYSCALL msg=audit(1364481363.243:24287): arch=c000003e syscall=2 success=no exit=-13 comm="cat" exe="/usr/bin/cat" key="sshd_config"`
+
+const userLine = `type=USER_START msg=audit(1364481363.500:24288): pid=1234 uid=0 auid=1000 msg='op=PAM:session_open acct="root" exe="/usr/bin/sudo" res=success'`
+
+func TestAuditLogCollector_ProcessLogLine(t *testing.T) {
+	c := NewAuditLogCollector()
+
+	entry, err := c.processLogLine(syscallLine)
+	require.NoError(t, err)
+	assert.Equal(t, "audit", entry.Source)
+	assert.Equal(t, syscallLine, entry.Text)
+	assert.Equal(t, int64(1364481363243), entry.Timestamp)
+	assert.Equal(t, "SYSCALL", entry.Labels["type"])
+	assert.Equal(t, "24287", entry.Metadata["serial"])
+	assert.Equal(t, "no", entry.Metadata["success"])
+	assert.Equal(t, "/usr/bin/cat", entry.Metadata["exe"])
+	assert.Equal(t, "sshd_config", entry.Metadata["key"])
+	assert.NotContains(t, entry.Metadata, "msg")
+
+	entry, err = c.processLogLine(userLine)
+	require.NoError(t, err)
+	assert.Equal(t, "USER_START", entry.Labels["type"])
+	assert.Equal(t, "PAM:session_open", entry.Metadata["op"])
+	assert.Equal(t, "root", entry.Metadata["acct"])
+	assert.Equal(t, "success", entry.Metadata["res"])
+	assert.Equal(t, "1234", entry.Metadata["pid"])
+}
+
+func TestAuditLogCollector_ProcessLogLineErrors(t *testing.T) {
+	c := NewAuditLogCollector()
+
+	_, err := c.processLogLine("not an audit record")
+	assert.Error(t, err)
+
+	_, err = c.processLogLine("type=SYSCALL msg=garbage")
+	assert.Error(t, err)
+}
+
+func TestAuditLogCollector_KeyFilter(t *testing.T) {
+	c := NewAuditLogCollector()
+	c.Configure(collection.LogSource{
+		Name:    "audit",
+		Options: map[string]string{"keys": "identity, sshd_config"},
+	})
+
+	_, err := c.processLogLine(syscallLine)
+	assert.NoError(t, err)
+
+	_, err = c.processLogLine(userLine)
+	assert.ErrorIs(t, err, logs.ErrFiltered)
+
+	// Removing the option ships everything again
+	c.Configure(collection.LogSource{Name: "audit"})
+	_, err = c.processLogLine(userLine)
+	assert.NoError(t, err)
+}
+
+func TestAuditLogCollector_KeyFilterEvent(t *testing.T) {
+	c := NewAuditLogCollector()
+	c.Configure(collection.LogSource{
+		Name:    "audit",
+		Options: map[string]string{"keys": "sshd_config"},
+	})
+
+	// Two interleaved events, only the first one matches
+	lines := []string{
+		syscallLine,
+		`type=SYSCALL msg=audit(1364481363.244:24290): arch=c000003e syscall=59 success=yes exit=0 comm="ls" exe="/usr/bin/ls" key=(null)`,
+		`type=CWD msg=audit(1364481363.243:24287): cwd="/root"`,
+		`type=PATH msg=audit(1364481363.243:24287): item=0 name="/etc/ssh/sshd_config" inode=409248 nametype=NORMAL`,
+		`type=EXECVE msg=audit(1364481363.244:24290): argc=1 a0="ls"`,
+		`type=PROCTITLE msg=audit(1364481363.243:24287): proctitle=636174002F6574632F7373682F737368645F636F6E666967`,
+		`type=EOE msg=audit(1364481363.243:24287): `,
+		`type=EOE msg=audit(1364481363.244:24290): `,
+	}
+	var kept []string
+	for _, line := range lines {
+		entry, err := c.processLogLine(line)
+		if errors.Is(err, logs.ErrFiltered) {
+			continue
+		}
+		require.NoError(t, err)
+		assert.Equal(t, "24287", entry.Metadata["serial"])
+		kept = append(kept, entry.Labels["type"])
+	}
+	assert.Equal(t, []string{"SYSCALL", "CWD", "PATH", "PROCTITLE", "EOE"}, kept)
+	assert.Empty(t, c.matched)
+
+	// A record arriving after the end of its event isn't matched anymore
+	_, err := c.processLogLine(`type=PATH msg=audit(1364481363.243:24287): item=1 name="/etc/ssh"`)
+	assert.ErrorIs(t, err, logs.ErrFiltered)
+}
+
+func TestParseTimestamp(t *testing.T) {
+	for ts, want := range map[string]int64{
+		"1700000000.123":  1700000000123,
+		"1700000000.001":  1700000000001,
+		"1700000000.5":    1700000000500,
+		"1700000000.9999": 1700000000999,
+		"1700000000":      1700000000000,
+	} {
+		got, err := parseTimestamp(ts)
+		require.NoError(t, err, ts)
+		assert.Equal(t, want, got, ts)
+	}
+
+	_, err := parseTimestamp("1700000000.-5")
+	assert.Error(t, err)
+}
@@ -2,9 +2,11 @@ package logs
 
 import (
 	"context"
+	"errors"
 	"maps"
 	"strconv"
 	"sync"
+	"time"
 
 	"agent/internal/collection"
 	"agent/internal/exporter"
@@ -20,6 +22,10 @@ type LogEntry struct {
 	Metadata  map[string]string // Key-value pairs for metadata
 }
 
+// ErrFiltered is returned by a Processor when a line was parsed successfully
+// but must not be shipped (e.g. it does not match the configured filters).
+var ErrFiltered = errors.New("log line filtered")
+
 // Processor defines the signature for log line processing functions.
 // It takes a raw log line string as input and returns a parsed LogEntry
 // along with an error if the line could not be processed.
@@ -42,10 +48,18 @@ type LogCollector interface {
 	Stop() error
 }
 
+// ConfigurableCollector is implemented by collectors accepting per-source
+// options from the collection config.
+type ConfigurableCollector interface {
+	Configure(src collection.LogSource)
+}
+
 // StartCollection is the orchestrator that launches all collectors,
-// parses raw lines into entries, and exports them.
+// parses raw lines into entries, and exports them. The per-source options of
+// cfg (which may be nil) tune the processing of the entries.
 func StartCollection(
 	collectors []LogCollector,
+	cfg *collection.CollectionConfig,
 	ctx context.Context,
 	wg *sync.WaitGroup,
 	exp *exporter.Exporter,
@@ -63,18 +77,83 @@ func StartCollection(
 		}
 	}
 
+	extractors, defaultExtractor := traceExtractors(cfg)
+	dedup := newDeduplicator(cfg)
+	router := newLabelRouter(cfg)
+	chains := buildChains(cfg)
+
+	// Create the self-metrics of every source so they are reported from the
+	// start, even before the first line
+	stats := make(map[string]*sourceStats)
+	sourceStatsFor := func(source string) *sourceStats {
+		s, ok := stats[source]
+		if !ok {
+			s = statsFor(source)
+			stats[source] = s
+		}
+		return s
+	}
+	for _, c := range collectors {
+		sourceStatsFor(c.Name())
+	}
+
+	ship := func(logEntry LogEntry) {
+		router.route(&logEntry)
+		if extractor, ok := extractors[logEntry.Source]; ok {
+			extractor.Extract(&logEntry)
+		} else {
+			defaultExtractor.Extract(&logEntry)
+		}
+		logPayload := convertLogEntryToPayload(logEntry)
+		logPayloadList := []exporter.LogPayload{logPayload}
+		err := exp.ExportLog(logPayloadList)
+		if err != nil {
+			logger.Log.Error("failed to export logs payload", "error", err)
+			sourceStatsFor(logEntry.Source).linesDropped.Inc()
+		}
+	}
+
 	// Processing loop (parse + export)
 	var processingWg sync.WaitGroup
 	processingWg.Add(1)
 	go func() {
 		defer processingWg.Done()
-		for logEntry := range logsChan {
-			logger.Log.Debug("Logs collected", "source", logEntry.Source)
-			logPayload := convertLogEntryToPayload(logEntry)
-			logPayloadList := []exporter.LogPayload{logPayload}
-			err := exp.ExportLog(logPayloadList)
-			if err != nil {
-				logger.Log.Error("failed to export logs payload", "error", err)
+
+		// Entries held for deduplication are shipped once their window
+		// elapses
+		var flushC <-chan time.Time
+		if dedup.enabled() {
+			ticker := time.NewTicker(time.Second)
+			defer ticker.Stop()
+			flushC = ticker.C
+		}
+
+		for {
+			select {
+			case logEntry, ok := <-logsChan:
+				if !ok {
+					for _, e := range dedup.flush(time.Now(), true) {
+						ship(e)
+					}
+					return
+				}
+				logger.Log.Debug("Logs collected", "source", logEntry.Source)
+				if isSelf(logEntry) {
+					sourceStatsFor(logEntry.Source).selfExcluded.Inc()
+					continue
+				}
+				sourceStatsFor(logEntry.Source).read(logEntry.Text)
+				if chain, ok := chains[logEntry.Source]; ok && !chain.Process(&logEntry) {
+					sourceStatsFor(logEntry.Source).linesDropped.Inc()
+					continue
+				}
+				for _, e := range dedup.add(logEntry, time.Now()) {
+					ship(e)
+				}
+			case now := <-flushC:
+				for _, e := range dedup.flush(now, false) {
+					ship(e)
+				}
 			}
 		}
 	}()
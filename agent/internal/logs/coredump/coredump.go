@@ -0,0 +1,324 @@
+package coredump
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"agent/internal/collection"
+	"agent/internal/common"
+	"agent/internal/logger"
+	"agent/internal/logs"
+)
+
+const (
+	systemdCoredumpDir = "/var/lib/systemd/coredump"
+	apportCrashDir     = "/var/crash"
+	corePatternFile    = "/proc/sys/kernel/core_pattern"
+	// intervalOption is the log source option holding the number of seconds
+	// between two scans of the crash directories.
+	intervalOption  = "interval"
+	defaultInterval = 10 * time.Second
+)
+
+// Crash handlers reported in the "handler" label
+const (
+	handlerSystemd     = "systemd-coredump"
+	handlerApport      = "apport"
+	handlerCorePattern = "core_pattern"
+)
+
+// crash describes a process that dumped core
+type crash struct {
+	Handler    string
+	Path       string
+	Program    string
+	Executable string
+	PID        string
+	UID        string
+	Signal     int
+	Timestamp  int64 // Unix timestamp in milliseconds
+}
+
+// CoredumpCollector reports the processes that dump core on the host. Crashes
+// rarely show up explicitly in application logs, but every handler leaves a
+// file behind: systemd-coredump in /var/lib/systemd/coredump, apport in
+// /var/crash, and the kernel itself in the directory of core_pattern when it
+// is a plain path. These directories are scanned periodically and an entry
+// is emitted for each new file. They're read under the host root, and
+// reported with their path on the host.
+type CoredumpCollector struct {
+	name        string
+	interval    time.Duration
+	systemdDir  string
+	apportDir   string
+	corePattern string
+	cancel      context.CancelFunc
+	wg          sync.WaitGroup
+	mu          sync.Mutex
+
+	// seen holds the crash files already reported, it is only accessed from
+	// the scan loop.
+	seen map[string]bool
+}
+
+func NewCoredumpCollector() *CoredumpCollector {
+	return &CoredumpCollector{
+		name:        "coredump",
+		interval:    defaultInterval,
+		systemdDir:  systemdCoredumpDir,
+		apportDir:   apportCrashDir,
+		corePattern: corePatternFile,
+	}
+}
+
+func (c *CoredumpCollector) Name() string {
+	return c.name
+}
+
+func (c *CoredumpCollector) Discover() []collection.LogSource {
+	if runtime.GOOS != "linux" {
+		return []collection.LogSource{}
+	}
+	return []collection.LogSource{{Name: c.name, Path: strings.Join(c.directories(), ",")}}
+}
+
+// Configure sets the scan interval from the "interval" option.
+func (c *CoredumpCollector) Configure(src collection.LogSource) {
+	c.interval = defaultInterval
+	if raw, ok := src.Options[intervalOption]; ok {
+		if seconds, err := strconv.Atoi(raw); err == nil && seconds > 0 {
+			c.interval = time.Duration(seconds) * time.Second
+		} else {
+			logger.Log.Warn("Invalid coredump interval, using default", "interval", raw)
+		}
+	}
+}
+
+func (c *CoredumpCollector) Start(ctx context.Context, out chan<- logs.LogEntry) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.cancel != nil {
+		return fmt.Errorf("coredump collector already running")
+	}
+
+	// Crashes that happened before the agent started are not reported
+	c.seen = make(map[string]bool)
+	c.scan()
+
+	collectorCtx, cancel := context.WithCancel(ctx)
+	c.cancel = cancel
+
+	c.wg.Add(1)
+	go c.scanLoop(collectorCtx, out)
+
+	return nil
+}
+
+func (c *CoredumpCollector) Stop() error {
+	c.mu.Lock()
+	if c.cancel != nil {
+		c.cancel()
+	}
+	c.mu.Unlock()
+
+	c.wg.Wait()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.cancel = nil
+	return nil
+}
+
+func (c *CoredumpCollector) scanLoop(ctx context.Context, out chan<- logs.LogEntry) {
+	defer c.wg.Done()
+
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		for _, cr := range c.scan() {
+			select {
+			case out <- newEntry(cr):
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+}
+
+// scan returns the crashes found since the previous scan, oldest first.
+func (c *CoredumpCollector) scan() []crash {
+	var crashes []crash
+	pattern := c.readCorePattern()
+
+	found := make(map[string]bool)
+	for _, dir := range c.directories() {
+		entries, err := os.ReadDir(common.HostPath(dir))
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			// Files being written are hidden (e.g. systemd-coredump's .#core*)
+			if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+				continue
+			}
+			path := filepath.Join(dir, entry.Name())
+			found[path] = true
+			if c.seen[path] {
+				continue
+			}
+			c.seen[path] = true
+
+			cr, ok := c.parseCrashFile(dir, entry.Name(), pattern)
+			if !ok {
+				continue
+			}
+			if cr.Timestamp == 0 {
+				if info, err := entry.Info(); err == nil {
+					cr.Timestamp = info.ModTime().UnixMilli()
+				}
+			}
+			crashes = append(crashes, cr)
+		}
+	}
+	// Forget the files that were cleaned up
+	for path := range c.seen {
+		if !found[path] {
+			delete(c.seen, path)
+		}
+	}
+
+	sort.Slice(crashes, func(i, j int) bool { return crashes[i].Timestamp < crashes[j].Timestamp })
+	return crashes
+}
+
+// directories returns the directories where crash files may be written
+func (c *CoredumpCollector) directories() []string {
+	dirs := []string{c.systemdDir, c.apportDir}
+	if dir := c.readCorePattern().dir; dir != "" && dir != c.systemdDir && dir != c.apportDir {
+		dirs = append(dirs, dir)
+	}
+	return dirs
+}
+
+func (c *CoredumpCollector) readCorePattern() corePattern {
+	raw, err := os.ReadFile(common.HostPath(c.corePattern))
+	if err != nil {
+		return corePattern{}
+	}
+	return parseCorePattern(strings.TrimSpace(string(raw)))
+}
+
+// parseCrashFile extracts the crash details from a file found in dir.
+func (c *CoredumpCollector) parseCrashFile(dir, name string, pattern corePattern) (crash, bool) {
+	path := filepath.Join(dir, name)
+	switch {
+	case dir == c.systemdDir:
+		cr, ok := parseSystemdCoredump(name)
+		if !ok {
+			return crash{}, false
+		}
+		cr.Path = path
+		if signal, err := strconv.Atoi(readXattr(common.HostPath(path), "user.coredump.signal")); err == nil {
+			cr.Signal = signal
+		}
+		if exe := readXattr(common.HostPath(path), "user.coredump.exe"); exe != "" {
+			cr.Executable = exe
+		}
+		return cr, true
+	case dir == c.apportDir:
+		if !strings.HasSuffix(name, ".crash") {
+			return crash{}, false
+		}
+		f, err := os.Open(common.HostPath(path))
+		if err != nil {
+			logger.Log.Debug("Failed to read crash report", "path", path, "error", err)
+			return crash{}, false
+		}
+		defer f.Close()
+		cr, ok := parseApportReport(f)
+		cr.Path = path
+		return cr, ok
+	case dir == pattern.dir:
+		cr, ok := pattern.match(name)
+		cr.Path = path
+		return cr, ok
+	}
+	return crash{}, false
+}
+
+func newEntry(cr crash) logs.LogEntry {
+	text := fmt.Sprintf("Process %s", cr.Program)
+	if cr.PID != "" {
+		text += fmt.Sprintf(" (pid %s)", cr.PID)
+	}
+	text += " dumped core"
+	metadata := map[string]string{"path": cr.Path}
+	if cr.Signal > 0 {
+		name := signalName(cr.Signal)
+		text += fmt.Sprintf(" on signal %d (%s)", cr.Signal, name)
+		metadata["signal"] = strconv.Itoa(cr.Signal)
+		metadata["signal_name"] = name
+	}
+	if cr.PID != "" {
+		metadata["pid"] = cr.PID
+	}
+	if cr.UID != "" {
+		metadata["uid"] = cr.UID
+	}
+	if cr.Executable != "" {
+		metadata["executable"] = cr.Executable
+	}
+	timestamp := cr.Timestamp
+	if timestamp == 0 {
+		timestamp = time.Now().UnixMilli()
+	}
+	return logs.LogEntry{
+		Timestamp: timestamp,
+		Source:    "coredump",
+		Text:      text,
+		Labels:    map[string]string{"program": cr.Program, "handler": cr.Handler},
+		Metadata:  metadata,
+	}
+}
+
+// signalName returns the name of the Linux core dumping signals
+func signalName(signal int) string {
+	switch signal {
+	case 3:
+		return "SIGQUIT"
+	case 4:
+		return "SIGILL"
+	case 5:
+		return "SIGTRAP"
+	case 6:
+		return "SIGABRT"
+	case 7:
+		return "SIGBUS"
+	case 8:
+		return "SIGFPE"
+	case 11:
+		return "SIGSEGV"
+	case 24:
+		return "SIGXCPU"
+	case 25:
+		return "SIGXFSZ"
+	case 31:
+		return "SIGSYS"
+	}
+	return "SIG" + strconv.Itoa(signal)
+}
@@ -0,0 +1,169 @@
+package coredump
+
+import (
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"agent/internal/common"
+	"agent/internal/logger"
+)
+
+func init() {
+	logger.Log = slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+const apportReport = `ProblemType: Crash
+Date: Tue Mar  5 10:15:30 2024
+ExecutablePath: /usr/bin/myapp
+ProcStatus:
+ Name:	myapp
+ Pid:	4242
+ Uid:	1000	1000	1000	1000
+Signal: 11
+CoreDump: base64
+ H4sICAAAAAAC/0NvcmVEdW1wAA==
+`
+
+func TestParseSystemdCoredump(t *testing.T) {
+	cr, ok := parseSystemdCoredump(`core.my\x2eapp.1000.4a3f5e6d7c8b9a0f1e2d3c4b5a697887.4242.1709633730123456.zst`)
+	require.True(t, ok)
+	assert.Equal(t, crash{
+		Handler:   handlerSystemd,
+		Program:   "my.app",
+		UID:       "1000",
+		PID:       "4242",
+		Timestamp: 1709633730123,
+	}, cr)
+
+	_, ok = parseSystemdCoredump("core.bash.1000")
+	assert.False(t, ok)
+	_, ok = parseSystemdCoredump("notes.txt")
+	assert.False(t, ok)
+}
+
+func TestParseApportReport(t *testing.T) {
+	cr, ok := parseApportReport(strings.NewReader(apportReport))
+	require.True(t, ok)
+	assert.Equal(t, handlerApport, cr.Handler)
+	assert.Equal(t, "myapp", cr.Program)
+	assert.Equal(t, "/usr/bin/myapp", cr.Executable)
+	assert.Equal(t, "4242", cr.PID)
+	assert.Equal(t, "1000", cr.UID)
+	assert.Equal(t, 11, cr.Signal)
+	expected := time.Date(2024, 3, 5, 10, 15, 30, 0, time.Local).UnixMilli()
+	assert.Equal(t, expected, cr.Timestamp)
+
+	_, ok = parseApportReport(strings.NewReader("ProblemType: KernelOops\nExecutablePath: /usr/bin/x\n"))
+	assert.False(t, ok)
+}
+
+func TestParseCorePattern(t *testing.T) {
+	p := parseCorePattern("/var/cores/core.%e.%p.%s.%t")
+	assert.Equal(t, "/var/cores", p.dir)
+	cr, ok := p.match("core.nginx.1234.6.1709633730")
+	require.True(t, ok)
+	assert.Equal(t, crash{
+		Handler:   handlerCorePattern,
+		Program:   "nginx",
+		PID:       "1234",
+		Signal:    6,
+		Timestamp: 1709633730000,
+	}, cr)
+	_, ok = p.match("other.file")
+	assert.False(t, ok)
+
+	// The pid is appended when core_uses_pid is set
+	p = parseCorePattern("/cores/%E.core")
+	cr, ok = p.match("!usr!bin!app.core.77")
+	require.True(t, ok)
+	assert.Equal(t, "/usr/bin/app", cr.Program)
+	assert.Equal(t, "77", cr.PID)
+
+	assert.Empty(t, parseCorePattern("|/usr/lib/systemd/systemd-coredump %P %u %g %s %t %c %h").dir)
+	assert.Empty(t, parseCorePattern("core").dir)
+	assert.Empty(t, parseCorePattern("/cores/%u/core").dir)
+}
+
+func TestCoredumpCollector_Scan(t *testing.T) {
+	root := t.TempDir()
+	c := NewCoredumpCollector()
+	c.systemdDir = filepath.Join(root, "systemd")
+	c.apportDir = filepath.Join(root, "crash")
+	c.corePattern = filepath.Join(root, "core_pattern")
+	cores := filepath.Join(root, "cores")
+	for _, dir := range []string{c.systemdDir, c.apportDir, cores} {
+		require.NoError(t, os.MkdirAll(dir, 0o755))
+	}
+	require.NoError(t, os.WriteFile(c.corePattern, []byte(cores+"/core.%e.%p\n"), 0o644))
+	assert.Equal(t, []string{c.systemdDir, c.apportDir, cores}, c.directories())
+
+	// Existing files are part of the baseline
+	require.NoError(t, os.WriteFile(filepath.Join(cores, "core.old.1"), nil, 0o644))
+	c.seen = make(map[string]bool)
+	c.scan()
+	assert.Empty(t, c.scan())
+
+	require.NoError(t, os.WriteFile(filepath.Join(c.systemdDir, `core.sshd.0.4a3f5e6d7c8b9a0f1e2d3c4b5a697887.300.1709000000000000.zst`), nil, 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(c.systemdDir, ".#core.partial"), nil, 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(c.apportDir, "_usr_bin_myapp.1000.crash"), []byte(apportReport), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(c.apportDir, "_usr_bin_myapp.1000.upload"), nil, 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(cores, "core.worker.99"), nil, 0o644))
+
+	crashes := c.scan()
+	require.Len(t, crashes, 3)
+	programs := map[string]string{}
+	for _, cr := range crashes {
+		programs[cr.Program] = cr.Handler
+	}
+	assert.Equal(t, map[string]string{"sshd": handlerSystemd, "myapp": handlerApport, "worker": handlerCorePattern}, programs)
+	assert.Empty(t, c.scan())
+
+	entry := newEntry(crashes[0])
+	assert.Equal(t, "coredump", entry.Source)
+	assert.Equal(t, "sshd", entry.Labels["program"])
+	assert.Equal(t, "Process sshd (pid 300) dumped core", entry.Text)
+
+	entry = newEntry(crash{Handler: handlerApport, Program: "myapp", PID: "4242", Signal: 11})
+	assert.Equal(t, "Process myapp (pid 4242) dumped core on signal 11 (SIGSEGV)", entry.Text)
+	assert.Equal(t, "SIGSEGV", entry.Metadata["signal_name"])
+}
+
+func TestCoredumpCollector_HostRoot(t *testing.T) {
+	for _, name := range []string{"HOST_ROOT", "HOST_PROC", "HOST_SYS", "HOST_ETC", "HOST_VAR", "HOST_RUN", "HOST_DEV"} {
+		t.Setenv(name, "")
+	}
+	root := t.TempDir()
+	common.SetHostRoot(root)
+	t.Cleanup(func() { common.SetHostRoot("") })
+
+	// The node filesystem mounted in the container of the agent
+	for _, dir := range []string{"proc/sys/kernel", "var/crash", "cores"} {
+		require.NoError(t, os.MkdirAll(filepath.Join(root, dir), 0o755))
+	}
+	require.NoError(t, os.WriteFile(filepath.Join(root, corePatternFile), []byte("/cores/core.%e.%p\n"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(root, apportCrashDir, "_usr_bin_myapp.1000.crash"), []byte(apportReport), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "cores", "core.worker.99"), nil, 0o644))
+
+	c := NewCoredumpCollector()
+	c.seen = make(map[string]bool)
+	assert.Equal(t, []string{systemdCoredumpDir, apportCrashDir, "/cores"}, c.directories())
+
+	crashes := c.scan()
+	require.Len(t, crashes, 2)
+	paths := map[string]string{}
+	for _, cr := range crashes {
+		paths[cr.Program] = cr.Path
+	}
+	assert.Equal(t, map[string]string{
+		"myapp":  "/var/crash/_usr_bin_myapp.1000.crash",
+		"worker": "/cores/core.worker.99",
+	}, paths)
+}
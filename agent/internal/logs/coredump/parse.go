@@ -0,0 +1,195 @@
+package coredump
+
+import (
+	"bufio"
+	"io"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// parseSystemdCoredump parses the name of a core file written by
+// systemd-coredump: core.<comm>.<uid>.<boot id>.<pid>.<usec>[.<compression>]
+// The dots of the command name are escaped as \x2e.
+func parseSystemdCoredump(name string) (crash, bool) {
+	rest, ok := strings.CutPrefix(name, "core.")
+	if !ok {
+		return crash{}, false
+	}
+	parts := strings.Split(rest, ".")
+	switch parts[len(parts)-1] {
+	case "zst", "lz4", "xz":
+		parts = parts[:len(parts)-1]
+	}
+	if len(parts) < 5 {
+		return crash{}, false
+	}
+	n := len(parts)
+	usec, err := strconv.ParseInt(parts[n-1], 10, 64)
+	if err != nil {
+		return crash{}, false
+	}
+	return crash{
+		Handler:   handlerSystemd,
+		Program:   strings.ReplaceAll(strings.Join(parts[:n-4], "."), `\x2e`, "."),
+		UID:       parts[n-4],
+		PID:       parts[n-2],
+		Timestamp: usec / 1000,
+	}, true
+}
+
+// parseApportReport parses the header of an apport crash report. Reports are
+// made of "Key: value" fields, multi-line values are indented. Reading stops
+// at the core dump, which is by far the largest field.
+func parseApportReport(r io.Reader) (crash, bool) {
+	fields := make(map[string]string)
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	var key string
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, " ") {
+			if key != "" {
+				fields[key] += "\n" + strings.TrimSpace(line)
+			}
+			continue
+		}
+		k, v, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		if k == "CoreDump" {
+			break
+		}
+		key = k
+		fields[key] = strings.TrimSpace(v)
+	}
+
+	if fields["ProblemType"] != "Crash" {
+		return crash{}, false
+	}
+	cr := crash{
+		Handler:    handlerApport,
+		Executable: fields["ExecutablePath"],
+		Program:    filepath.Base(fields["ExecutablePath"]),
+	}
+	if signal, err := strconv.Atoi(fields["Signal"]); err == nil {
+		cr.Signal = signal
+	}
+	if t, err := time.ParseInLocation(time.ANSIC, fields["Date"], time.Local); err == nil {
+		cr.Timestamp = t.UnixMilli()
+	}
+	// ProcStatus is a copy of /proc/<pid>/status
+	for _, line := range strings.Split(fields["ProcStatus"], "\n") {
+		k, v, _ := strings.Cut(line, ":")
+		values := strings.Fields(v)
+		if len(values) == 0 {
+			continue
+		}
+		switch k {
+		case "Pid":
+			cr.PID = values[0]
+		case "Uid":
+			cr.UID = values[0]
+		}
+	}
+	return cr, cr.Executable != ""
+}
+
+// corePattern is the kernel core_pattern when it writes core files directly
+// to a fixed directory.
+type corePattern struct {
+	dir string
+	re  *regexp.Regexp
+}
+
+// parseCorePattern turns the core file name template (e.g.
+// /var/cores/core.%e.%p.%t) into a regular expression. Piped patterns
+// (handled by systemd-coredump or apport), relative patterns (written in the
+// working directory of the process) and directories depending on the process
+// can't be watched and return an empty pattern.
+func parseCorePattern(pattern string) corePattern {
+	if !strings.HasPrefix(pattern, "/") {
+		return corePattern{}
+	}
+	dir, base := filepath.Dir(pattern), filepath.Base(pattern)
+	if strings.Contains(dir, "%") {
+		return corePattern{}
+	}
+
+	groups := map[byte]string{'e': "program", 'E': "program", 'p': "pid", 'P': "pid", 'u': "uid", 's': "signal", 't': "time"}
+	used := make(map[string]bool)
+	var expr strings.Builder
+	expr.WriteString("^")
+	for i := 0; i < len(base); i++ {
+		if base[i] != '%' || i+1 == len(base) {
+			expr.WriteString(regexp.QuoteMeta(base[i : i+1]))
+			continue
+		}
+		i++
+		spec := base[i]
+		var sub string
+		switch spec {
+		case '%':
+			expr.WriteString("%")
+			continue
+		case 'e', 'E', 'h':
+			sub = `[^/]+?`
+		default:
+			sub = `\d+`
+		}
+		if name, ok := groups[spec]; ok && !used[name] {
+			used[name] = true
+			expr.WriteString("(?P<" + name + ">" + sub + ")")
+		} else {
+			expr.WriteString("(?:" + sub + ")")
+		}
+	}
+	// With core_uses_pid, the kernel appends the pid when the pattern doesn't
+	// contain it
+	if !used["pid"] {
+		expr.WriteString(`(?:\.(?P<pid>\d+))?`)
+	}
+	expr.WriteString("$")
+
+	re, err := regexp.Compile(expr.String())
+	if err != nil {
+		return corePattern{}
+	}
+	return corePattern{dir: dir, re: re}
+}
+
+// match extracts the crash details from the name of a core file.
+func (p corePattern) match(name string) (crash, bool) {
+	if p.re == nil {
+		return crash{}, false
+	}
+	m := p.re.FindStringSubmatch(name)
+	if m == nil {
+		return crash{}, false
+	}
+	cr := crash{Handler: handlerCorePattern, Program: "unknown"}
+	for i, group := range p.re.SubexpNames() {
+		if m[i] == "" {
+			continue
+		}
+		switch group {
+		case "program":
+			// %E replaces the slashes of the executable path with '!'
+			cr.Program = strings.ReplaceAll(m[i], "!", "/")
+		case "pid":
+			cr.PID = m[i]
+		case "uid":
+			cr.UID = m[i]
+		case "signal":
+			cr.Signal, _ = strconv.Atoi(m[i])
+		case "time":
+			if seconds, err := strconv.ParseInt(m[i], 10, 64); err == nil {
+				cr.Timestamp = seconds * 1000
+			}
+		}
+	}
+	return cr, true
+}
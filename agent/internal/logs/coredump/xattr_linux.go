@@ -0,0 +1,16 @@
+//go:build linux
+
+package coredump
+
+import "golang.org/x/sys/unix"
+
+// readXattr returns an extended attribute of the file, systemd-coredump
+// stores the crash details (signal, executable...) in them.
+func readXattr(path, name string) string {
+	buf := make([]byte, 1024)
+	n, err := unix.Getxattr(path, name, buf)
+	if err != nil {
+		return ""
+	}
+	return string(buf[:n])
+}
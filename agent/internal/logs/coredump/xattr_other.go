@@ -0,0 +1,8 @@
+//go:build !linux
+// +build !linux
+
+package coredump
+
+func readXattr(path, name string) string {
+	return ""
+}
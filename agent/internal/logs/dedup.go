@@ -0,0 +1,113 @@
+package logs
+
+import (
+	"maps"
+	"strconv"
+	"time"
+
+	"agent/internal/collection"
+	"agent/internal/logger"
+)
+
+// dedupWindowOption is the log source option enabling the deduplication of
+// identical consecutive lines, as the number of seconds they are collapsed
+// over.
+const dedupWindowOption = "dedup_window"
+
+// repeatCountKey is the metadata key holding the number of identical lines
+// collapsed into an entry
+const repeatCountKey = "repeat_count"
+
+// pendingEntry is an entry waiting for its repetitions
+type pendingEntry struct {
+	entry    LogEntry
+	count    int
+	deadline time.Time
+}
+
+// deduplicator collapses identical consecutive entries of a source, the way
+// syslog reports "last message repeated N times". The first entry is held
+// until a different one arrives or the window elapses, and is then shipped
+// with the number of repetitions in the repeat_count metadata.
+type deduplicator struct {
+	windows map[string]time.Duration
+	pending map[string]*pendingEntry
+}
+
+func newDeduplicator(cfg *collection.CollectionConfig) *deduplicator {
+	d := &deduplicator{
+		windows: make(map[string]time.Duration),
+		pending: make(map[string]*pendingEntry),
+	}
+	if cfg == nil {
+		return d
+	}
+	for _, src := range cfg.LogSources {
+		raw, ok := src.Options[dedupWindowOption]
+		if !ok {
+			continue
+		}
+		seconds, err := strconv.Atoi(raw)
+		if err != nil || seconds <= 0 {
+			logger.Log.Warn("Invalid dedup window, deduplication disabled", "source", src.Name, "window", raw)
+			continue
+		}
+		d.windows[src.Name] = time.Duration(seconds) * time.Second
+	}
+	return d
+}
+
+// enabled reports whether any source is deduplicated
+func (d *deduplicator) enabled() bool {
+	return len(d.windows) > 0
+}
+
+// add processes an entry and returns the entries ready to be shipped.
+func (d *deduplicator) add(entry LogEntry, now time.Time) []LogEntry {
+	window, ok := d.windows[entry.Source]
+	if !ok {
+		return []LogEntry{entry}
+	}
+
+	var ready []LogEntry
+	if p, ok := d.pending[entry.Source]; ok {
+		if now.Before(p.deadline) && sameEntry(p.entry, entry) {
+			p.count++
+			return nil
+		}
+		ready = append(ready, p.collapsed())
+	}
+	d.pending[entry.Source] = &pendingEntry{entry: entry, count: 1, deadline: now.Add(window)}
+	return ready
+}
+
+// flush returns the entries whose window elapsed, or every pending entry
+// when all is set.
+func (d *deduplicator) flush(now time.Time, all bool) []LogEntry {
+	var ready []LogEntry
+	for source, p := range d.pending {
+		if all || !now.Before(p.deadline) {
+			ready = append(ready, p.collapsed())
+			delete(d.pending, source)
+		}
+	}
+	return ready
+}
+
+func (p *pendingEntry) collapsed() LogEntry {
+	if p.count == 1 {
+		return p.entry
+	}
+	entry := p.entry
+	entry.Metadata = maps.Clone(entry.Metadata)
+	if entry.Metadata == nil {
+		entry.Metadata = make(map[string]string)
+	}
+	entry.Metadata[repeatCountKey] = strconv.Itoa(p.count)
+	return entry
+}
+
+// sameEntry reports whether two entries only differ by their timestamp
+func sameEntry(a, b LogEntry) bool {
+	return a.Text == b.Text && maps.Equal(a.Labels, b.Labels) && maps.Equal(a.Metadata, b.Metadata)
+}
@@ -0,0 +1,67 @@
+package logs
+
+import (
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"agent/internal/collection"
+	"agent/internal/logger"
+)
+
+func init() {
+	logger.Log = slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+func TestDeduplicator(t *testing.T) {
+	d := newDeduplicator(&collection.CollectionConfig{LogSources: []collection.LogSource{
+		{Name: "socket", Options: map[string]string{"dedup_window": "10"}},
+		{Name: "nginx"},
+	}})
+	require.True(t, d.enabled())
+
+	now := time.Unix(1700000000, 0)
+	retry := LogEntry{Source: "socket", Timestamp: 1, Text: "connection refused, retrying"}
+	other := LogEntry{Source: "socket", Timestamp: 5, Text: "connected"}
+
+	// Sources without window are not held
+	assert.Len(t, d.add(LogEntry{Source: "nginx", Text: "GET /"}, now), 1)
+
+	assert.Empty(t, d.add(retry, now))
+	for i := 0; i < 3; i++ {
+		later := retry
+		later.Timestamp = int64(i + 2)
+		assert.Empty(t, d.add(later, now.Add(time.Second)))
+	}
+
+	// A different line ships the collapsed one
+	ready := d.add(other, now.Add(2*time.Second))
+	require.Len(t, ready, 1)
+	assert.Equal(t, retry.Text, ready[0].Text)
+	assert.Equal(t, int64(1), ready[0].Timestamp)
+	assert.Equal(t, "4", ready[0].Metadata["repeat_count"])
+
+	// A single line is shipped unchanged when its window elapses
+	assert.Empty(t, d.flush(now.Add(5*time.Second), false))
+	ready = d.flush(now.Add(12*time.Second), false)
+	require.Len(t, ready, 1)
+	assert.Equal(t, other, ready[0])
+
+	// Repetitions after the window start a new entry
+	assert.Empty(t, d.add(retry, now))
+	assert.Len(t, d.add(retry, now.Add(11*time.Second)), 1)
+	assert.Len(t, d.flush(now, true), 1)
+}
+
+func TestDeduplicatorDisabled(t *testing.T) {
+	d := newDeduplicator(&collection.CollectionConfig{LogSources: []collection.LogSource{
+		{Name: "socket", Options: map[string]string{"dedup_window": "often"}},
+	}})
+	assert.False(t, d.enabled())
+	assert.Len(t, d.add(LogEntry{Source: "socket"}, time.Now()), 1)
+	assert.False(t, newDeduplicator(nil).enabled())
+}
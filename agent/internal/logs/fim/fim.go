@@ -0,0 +1,355 @@
+package fim
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+
+	"agent/internal/collection"
+	"agent/internal/logger"
+	"agent/internal/logs"
+)
+
+const (
+	// intervalOption is the log source option holding the number of seconds
+	// between two full hash verifications of the watched paths.
+	intervalOption  = "interval"
+	defaultInterval = 5 * time.Minute
+	// maxFiles caps the number of files tracked, so that watching a large
+	// directory by mistake doesn't exhaust memory and inotify watches.
+	maxFiles = 10000
+)
+
+// Change types reported in the "change" label
+const (
+	changeCreate     = "create"
+	changeModify     = "modify"
+	changeDelete     = "delete"
+	changePermission = "permission"
+)
+
+// defaultPaths are the critical files advertised during discovery
+var defaultPaths = []string{
+	"/etc/passwd",
+	"/etc/shadow",
+	"/etc/group",
+	"/etc/sudoers",
+	"/etc/sudoers.d",
+	"/etc/ssh/sshd_config",
+	"/etc/crontab",
+}
+
+// FIMCollector watches files and directories for changes and emits a log
+// entry for each file created, modified, deleted or whose permissions
+// changed. fsnotify reports changes as they happen, and the whole tree is
+// hashed again periodically to catch what the notifications missed (e.g.
+// network filesystems or changes made while the agent was stopped).
+//
+// The log source path is a comma separated list of files and directories.
+// Directories are watched recursively.
+type FIMCollector struct {
+	name     string
+	paths    []string
+	interval time.Duration
+	cancel   context.CancelFunc
+	wg       sync.WaitGroup
+	mu       sync.Mutex
+
+	// baseline is the last known state of every tracked file. It is only
+	// accessed from the watch loop.
+	baseline map[string]fileState
+}
+
+func NewFIMCollector() *FIMCollector {
+	return &FIMCollector{
+		name:     "fim",
+		paths:    defaultPaths,
+		interval: defaultInterval,
+	}
+}
+
+func (c *FIMCollector) Name() string {
+	return c.name
+}
+
+func (c *FIMCollector) Discover() []collection.LogSource {
+	if runtime.GOOS == "windows" {
+		return []collection.LogSource{}
+	}
+	var existing []string
+	for _, path := range defaultPaths {
+		if _, err := os.Lstat(path); err == nil {
+			existing = append(existing, path)
+		}
+	}
+	if len(existing) == 0 {
+		return []collection.LogSource{}
+	}
+	return []collection.LogSource{{Name: c.name, Path: strings.Join(existing, ",")}}
+}
+
+// Configure sets the watched paths from the log source and the verification
+// interval from the "interval" option.
+func (c *FIMCollector) Configure(src collection.LogSource) {
+	c.paths = defaultPaths
+	if paths := splitPaths(src.Path); len(paths) > 0 {
+		c.paths = paths
+	}
+	c.interval = defaultInterval
+	if raw, ok := src.Options[intervalOption]; ok {
+		if seconds, err := strconv.Atoi(raw); err == nil && seconds > 0 {
+			c.interval = time.Duration(seconds) * time.Second
+		} else {
+			logger.Log.Warn("Invalid FIM interval, using default", "interval", raw)
+		}
+	}
+}
+
+func (c *FIMCollector) Start(ctx context.Context, out chan<- logs.LogEntry) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.cancel != nil {
+		return fmt.Errorf("fim collector already running")
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("failed to create file watcher: %w", err)
+	}
+
+	// The first scan is the baseline, nothing is reported for it
+	c.baseline = c.scan()
+	for _, dir := range c.watchedDirs() {
+		if err := watcher.Add(dir); err != nil {
+			logger.Log.Warn("Could not watch directory", "path", dir, "error", err)
+		}
+	}
+	logger.Log.Info("Watching files for changes", "paths", len(c.paths), "files", len(c.baseline))
+
+	collectorCtx, cancel := context.WithCancel(ctx)
+	c.cancel = cancel
+
+	c.wg.Add(1)
+	go c.watchLoop(collectorCtx, watcher, out)
+
+	return nil
+}
+
+func (c *FIMCollector) Stop() error {
+	c.mu.Lock()
+	if c.cancel != nil {
+		c.cancel()
+	}
+	c.mu.Unlock()
+
+	c.wg.Wait()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.cancel = nil
+	return nil
+}
+
+func (c *FIMCollector) watchLoop(ctx context.Context, watcher *fsnotify.Watcher, out chan<- logs.LogEntry) {
+	defer c.wg.Done()
+	defer watcher.Close()
+
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	for {
+		var entries []logs.LogEntry
+		select {
+		case <-ctx.Done():
+			return
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			if !c.isWatched(event.Name) {
+				continue
+			}
+			entries = c.check(event.Name)
+			// Watch the directories created under a watched directory
+			if event.Has(fsnotify.Create) {
+				if info, err := os.Lstat(event.Name); err == nil && info.IsDir() {
+					if err := watcher.Add(event.Name); err != nil {
+						logger.Log.Warn("Could not watch directory", "path", event.Name, "error", err)
+					}
+				}
+			}
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			// Notifications may have been lost, the next verification
+			// catches up with them
+			logger.Log.Warn("File watcher error", "error", err)
+		case <-ticker.C:
+			entries = c.verify()
+		}
+
+		for _, entry := range entries {
+			select {
+			case out <- entry:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+}
+
+// check compares the current state of the files under path with the
+// baseline and returns the changes.
+func (c *FIMCollector) check(path string) []logs.LogEntry {
+	current := make(map[string]fileState)
+	walk(path, current, maxFiles)
+
+	var entries []logs.LogEntry
+	for file, state := range current {
+		entries = append(entries, c.compare(file, state)...)
+	}
+	// Everything under path that vanished was deleted
+	prefix := path + string(filepath.Separator)
+	for file, previous := range c.baseline {
+		if file != path && !strings.HasPrefix(file, prefix) {
+			continue
+		}
+		if _, ok := current[file]; !ok {
+			delete(c.baseline, file)
+			entries = append(entries, newEntry(file, changeDelete, fileState{}, previous))
+		}
+	}
+	return entries
+}
+
+// verify hashes every watched path again and returns the changes.
+func (c *FIMCollector) verify() []logs.LogEntry {
+	var entries []logs.LogEntry
+	for _, path := range c.paths {
+		entries = append(entries, c.check(path)...)
+	}
+	return entries
+}
+
+// compare updates the baseline with the state of file and returns the
+// change, if any.
+func (c *FIMCollector) compare(file string, state fileState) []logs.LogEntry {
+	previous, known := c.baseline[file]
+	if !known {
+		if len(c.baseline) >= maxFiles {
+			return nil
+		}
+		c.baseline[file] = state
+		return []logs.LogEntry{newEntry(file, changeCreate, state, fileState{})}
+	}
+	c.baseline[file] = state
+
+	var entries []logs.LogEntry
+	if state.Hash != previous.Hash || state.Size != previous.Size {
+		entries = append(entries, newEntry(file, changeModify, state, previous))
+	}
+	if state.Mode != previous.Mode || state.Owner != previous.Owner {
+		entries = append(entries, newEntry(file, changePermission, state, previous))
+	}
+	return entries
+}
+
+// scan returns the state of every file under the watched paths.
+func (c *FIMCollector) scan() map[string]fileState {
+	states := make(map[string]fileState)
+	for _, path := range c.paths {
+		walk(path, states, maxFiles)
+	}
+	if len(states) >= maxFiles {
+		logger.Log.Warn("Too many files to watch, some are ignored", "max", maxFiles)
+	}
+	return states
+}
+
+// watchedDirs returns the directories to register with fsnotify. Files are
+// watched through their parent directory so that atomic replacements (write
+// to a temporary file then rename) are still seen.
+func (c *FIMCollector) watchedDirs() []string {
+	seen := make(map[string]bool)
+	var dirs []string
+	add := func(dir string) {
+		if !seen[dir] {
+			seen[dir] = true
+			dirs = append(dirs, dir)
+		}
+	}
+	for _, path := range c.paths {
+		info, err := os.Lstat(path)
+		if err != nil || !info.IsDir() {
+			add(filepath.Dir(path))
+			continue
+		}
+		filepath.WalkDir(path, func(p string, d os.DirEntry, err error) error {
+			if err == nil && d.IsDir() {
+				add(p)
+			}
+			return nil
+		})
+	}
+	return dirs
+}
+
+// isWatched reports whether path is one of the watched paths or is inside a
+// watched directory. Events for the siblings of a watched file are ignored.
+func (c *FIMCollector) isWatched(path string) bool {
+	for _, watched := range c.paths {
+		if path == watched || strings.HasPrefix(path, watched+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+func newEntry(file, change string, state, previous fileState) logs.LogEntry {
+	metadata := map[string]string{"path": file}
+	if change != changeDelete {
+		metadata["sha256"] = state.Hash
+		metadata["size"] = strconv.FormatInt(state.Size, 10)
+		metadata["mode"] = state.Mode.String()
+		if state.Owner != "" {
+			metadata["owner"] = state.Owner
+		}
+	}
+	if change != changeCreate {
+		metadata["previous_sha256"] = previous.Hash
+		if change == changePermission {
+			metadata["previous_mode"] = previous.Mode.String()
+			if previous.Owner != "" {
+				metadata["previous_owner"] = previous.Owner
+			}
+		}
+	}
+	return logs.LogEntry{
+		Timestamp: time.Now().UnixMilli(),
+		Source:    "fim",
+		Text:      fmt.Sprintf("File %s: %s", change, file),
+		Labels:    map[string]string{"change": change},
+		Metadata:  metadata,
+	}
+}
+
+func splitPaths(raw string) []string {
+	var paths []string
+	for _, path := range strings.Split(raw, ",") {
+		path = strings.TrimSpace(path)
+		if path != "" {
+			paths = append(paths, filepath.Clean(path))
+		}
+	}
+	return paths
+}
@@ -0,0 +1,118 @@
+package fim
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"agent/internal/collection"
+	"agent/internal/logger"
+	"agent/internal/logs"
+)
+
+func init() {
+	logger.Log = slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+func changes(entries []logs.LogEntry) map[string]string {
+	result := make(map[string]string)
+	for _, e := range entries {
+		result[e.Metadata["path"]] += e.Labels["change"]
+	}
+	return result
+}
+
+func TestFIMCollector_Verify(t *testing.T) {
+	dir := t.TempDir()
+	conf := filepath.Join(dir, "app.conf")
+	require.NoError(t, os.WriteFile(conf, []byte("a=1\n"), 0o644))
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "conf.d"), 0o755))
+	removed := filepath.Join(dir, "conf.d", "old.conf")
+	require.NoError(t, os.WriteFile(removed, []byte("x"), 0o644))
+
+	c := NewFIMCollector()
+	c.Configure(collection.LogSource{Name: "fim", Path: dir})
+	c.baseline = c.scan()
+	assert.Len(t, c.baseline, 2)
+	assert.Empty(t, c.verify())
+
+	require.NoError(t, os.WriteFile(conf, []byte("a=2\n"), 0o644))
+	require.NoError(t, os.Remove(removed))
+	added := filepath.Join(dir, "conf.d", "new.conf")
+	require.NoError(t, os.WriteFile(added, []byte("y"), 0o644))
+
+	entries := c.verify()
+	assert.Equal(t, map[string]string{
+		conf:    changeModify,
+		removed: changeDelete,
+		added:   changeCreate,
+	}, changes(entries))
+	for _, e := range entries {
+		assert.Equal(t, "fim", e.Source)
+		if e.Metadata["path"] == conf {
+			assert.NotEqual(t, e.Metadata["sha256"], e.Metadata["previous_sha256"])
+		}
+	}
+
+	// Changes are only reported once
+	assert.Empty(t, c.verify())
+
+	require.NoError(t, os.Chmod(conf, 0o600))
+	entries = c.verify()
+	require.Len(t, entries, 1)
+	assert.Equal(t, changePermission, entries[0].Labels["change"])
+	assert.Equal(t, "-rw-------", entries[0].Metadata["mode"])
+	assert.Equal(t, "-rw-r--r--", entries[0].Metadata["previous_mode"])
+}
+
+func TestFIMCollector_IsWatched(t *testing.T) {
+	c := NewFIMCollector()
+	c.Configure(collection.LogSource{Path: "/etc/passwd, /etc/ssh/"})
+	assert.Equal(t, []string{"/etc/passwd", "/etc/ssh"}, c.paths)
+	assert.True(t, c.isWatched("/etc/passwd"))
+	assert.True(t, c.isWatched("/etc/ssh/sshd_config"))
+	assert.False(t, c.isWatched("/etc/passwd-"))
+	assert.False(t, c.isWatched("/etc/sshd"))
+}
+
+func TestFIMCollector_Configure(t *testing.T) {
+	c := NewFIMCollector()
+	c.Configure(collection.LogSource{Options: map[string]string{"interval": "60"}})
+	assert.Equal(t, defaultPaths, c.paths)
+	assert.Equal(t, time.Minute, c.interval)
+
+	c.Configure(collection.LogSource{Options: map[string]string{"interval": "soon"}})
+	assert.Equal(t, defaultInterval, c.interval)
+}
+
+func TestFIMCollector_Watch(t *testing.T) {
+	dir := t.TempDir()
+	watched := filepath.Join(dir, "watched.conf")
+	require.NoError(t, os.WriteFile(watched, []byte("a"), 0o644))
+
+	c := NewFIMCollector()
+	c.Configure(collection.LogSource{Path: watched})
+
+	out := make(chan logs.LogEntry, 10)
+	require.NoError(t, c.Start(context.Background(), out))
+	defer c.Stop()
+
+	// Siblings of a watched file are ignored
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "other.conf"), []byte("b"), 0o644))
+	require.NoError(t, os.WriteFile(watched, []byte("c"), 0o644))
+
+	select {
+	case entry := <-out:
+		assert.Equal(t, changeModify, entry.Labels["change"])
+		assert.Equal(t, watched, entry.Metadata["path"])
+	case <-time.After(5 * time.Second):
+		t.Fatal("no change reported")
+	}
+}
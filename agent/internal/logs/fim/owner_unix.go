@@ -0,0 +1,18 @@
+//go:build !windows
+// +build !windows
+
+package fim
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// fileOwner returns the "uid:gid" owning the file
+func fileOwner(info os.FileInfo) string {
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+		return fmt.Sprintf("%d:%d", stat.Uid, stat.Gid)
+	}
+	return ""
+}
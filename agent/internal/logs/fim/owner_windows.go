@@ -0,0 +1,10 @@
+//go:build windows
+
+package fim
+
+import "os"
+
+// fileOwner is not implemented on Windows, only the mode is compared
+func fileOwner(info os.FileInfo) string {
+	return ""
+}
@@ -0,0 +1,85 @@
+package fim
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// maxHashSize is the size above which files are not hashed, changes to them
+// are only detected through their size.
+const maxHashSize = 64 * 1024 * 1024
+
+// fileState is the recorded state of a file
+type fileState struct {
+	Hash  string
+	Size  int64
+	Mode  os.FileMode
+	Owner string
+}
+
+// walk records the state of path, or of every file under it when it is a
+// directory, into states. Symbolic links are recorded but not followed.
+func walk(path string, states map[string]fileState, limit int) {
+	filepath.WalkDir(path, func(p string, d os.DirEntry, err error) error {
+		if err != nil {
+			// Unreadable entries are skipped, they show up as deleted if
+			// they were known before
+			return nil
+		}
+		if d.IsDir() {
+			return nil
+		}
+		if len(states) >= limit {
+			return filepath.SkipAll
+		}
+		if state, err := readState(p); err == nil {
+			states[p] = state
+		}
+		return nil
+	})
+}
+
+func readState(path string) (fileState, error) {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return fileState{}, err
+	}
+	state := fileState{
+		Size:  info.Size(),
+		Mode:  info.Mode(),
+		Owner: fileOwner(info),
+	}
+	switch {
+	case info.Mode()&os.ModeSymlink != 0:
+		// The target is the content of a link
+		target, err := os.Readlink(path)
+		if err != nil {
+			return fileState{}, err
+		}
+		sum := sha256.Sum256([]byte(target))
+		state.Hash = hex.EncodeToString(sum[:])
+	case info.Mode().IsRegular() && info.Size() <= maxHashSize:
+		hash, err := hashFile(path)
+		if err != nil {
+			return fileState{}, err
+		}
+		state.Hash = hash
+	}
+	return state, nil
+}
+
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,104 @@
+package oom
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"strconv"
+	"sync"
+
+	"agent/internal/collection"
+	"agent/internal/logs"
+	"agent/internal/oomkill"
+)
+
+// OOMLogCollector emits an entry for each process killed by the kernel OOM
+// killer, labeled with the victim process name and memory cgroup.
+type OOMLogCollector struct {
+	name string
+	wg   sync.WaitGroup
+	mu   sync.Mutex
+	sub  *oomkill.Subscription
+}
+
+func NewOOMLogCollector() *OOMLogCollector {
+	return &OOMLogCollector{name: "oom"}
+}
+
+func (c *OOMLogCollector) Name() string {
+	return c.name
+}
+
+func (c *OOMLogCollector) Discover() []collection.LogSource {
+	if runtime.GOOS != "linux" || !oomkill.Available() {
+		return []collection.LogSource{}
+	}
+	return []collection.LogSource{{Name: c.name, Path: ""}}
+}
+
+func (c *OOMLogCollector) Start(ctx context.Context, out chan<- logs.LogEntry) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.sub != nil {
+		return fmt.Errorf("oom collector already running")
+	}
+	sub := oomkill.Subscribe()
+	c.sub = sub
+
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		for kill := range sub.C {
+			select {
+			case out <- newEntry(kill):
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+func (c *OOMLogCollector) Stop() error {
+	c.mu.Lock()
+	if c.sub != nil {
+		c.sub.Close()
+	}
+	c.sub = nil
+	c.mu.Unlock()
+
+	c.wg.Wait()
+	return nil
+}
+
+func newEntry(kill oomkill.Kill) logs.LogEntry {
+	text := fmt.Sprintf("Out of memory: killed process %s (pid %d)", kill.Process, kill.PID)
+	if kill.Cgroup != "" {
+		text += " in cgroup " + kill.Cgroup
+	}
+
+	metadata := map[string]string{"pid": strconv.Itoa(kill.PID)}
+	if kill.UID != "" {
+		metadata["uid"] = kill.UID
+	}
+	if kill.Constraint != "" {
+		metadata["constraint"] = kill.Constraint
+	}
+	if kill.OOMCgroup != "" {
+		metadata["oom_cgroup"] = kill.OOMCgroup
+	}
+	if kill.AnonRSS > 0 {
+		metadata["anon_rss_bytes"] = strconv.FormatInt(kill.AnonRSS, 10)
+	}
+	if kill.TotalVM > 0 {
+		metadata["total_vm_bytes"] = strconv.FormatInt(kill.TotalVM, 10)
+	}
+	return logs.LogEntry{
+		Timestamp: kill.Timestamp,
+		Source:    "oom",
+		Text:      text,
+		Labels:    map[string]string{"process": kill.Process, "cgroup": kill.CgroupLabel()},
+		Metadata:  metadata,
+	}
+}
@@ -0,0 +1,35 @@
+package oom
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"agent/internal/oomkill"
+)
+
+func TestNewEntry(t *testing.T) {
+	entry := newEntry(oomkill.Kill{
+		Timestamp:  1700000000000,
+		Process:    "java",
+		PID:        1234,
+		UID:        "1000",
+		Cgroup:     "/system.slice/app.service",
+		Constraint: "CONSTRAINT_MEMCG",
+		AnonRSS:    2048,
+	})
+	assert.Equal(t, "oom", entry.Source)
+	assert.Equal(t, int64(1700000000000), entry.Timestamp)
+	assert.Equal(t, "Out of memory: killed process java (pid 1234) in cgroup /system.slice/app.service", entry.Text)
+	assert.Equal(t, map[string]string{"process": "java", "cgroup": "/system.slice/app.service"}, entry.Labels)
+	assert.Equal(t, map[string]string{
+		"pid":            "1234",
+		"uid":            "1000",
+		"constraint":     "CONSTRAINT_MEMCG",
+		"anon_rss_bytes": "2048",
+	}, entry.Metadata)
+
+	entry = newEntry(oomkill.Kill{Process: "node", PID: 7})
+	assert.Equal(t, "Out of memory: killed process node (pid 7)", entry.Text)
+	assert.Equal(t, "unknown", entry.Labels["cgroup"])
+}
@@ -0,0 +1,231 @@
+// Package patterns holds the parsing patterns of the log collectors: the
+// regex variants of the access logs, the grok library of the parse stage and
+// the severity spellings. The backend ships updated patterns as a signed
+// bundle, hot-loaded without restarting the agent.
+package patterns
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"regexp"
+	"strings"
+	"sync/atomic"
+)
+
+// PublicKey is the base64 ed25519 key verifying the bundles, set at build
+// time. Bundles are refused when it's empty.
+var PublicKey = ""
+
+// Bundle is a set of patterns shipped by the backend. It extends the
+// built-in patterns: a source or grok pattern of the bundle replaces the
+// built-in one with the same name.
+type Bundle struct {
+	Version int `json:"version"`
+	// Sources lists the regex variants tried in order on the lines of a
+	// collector, e.g. nginx or apache
+	Sources map[string][]string `json:"sources,omitempty"`
+	// Grok maps the names referenced as %{NAME} in the parse stage to their
+	// regex
+	Grok map[string]string `json:"grok,omitempty"`
+	// Severity maps spellings of a level to a severity name, e.g. "eror"
+	// to "error"
+	Severity map[string]string `json:"severity,omitempty"`
+}
+
+// Signed is a bundle as downloaded, its signature covers the raw bundle
+type Signed struct {
+	Bundle    json.RawMessage `json:"bundle"`
+	Signature string          `json:"signature"`
+}
+
+// accessTimestamp matches the timestamp of the common and combined log
+// formats
+const accessTimestamp = `\[(?P<timestamp>\d{2}/\w{3}/\d{4}:\d{2}:\d{2}:\d{2} [+-]\d{4})\]`
+
+// builtin are the patterns compiled in the agent
+var builtin = Bundle{
+	Sources: map[string][]string{
+		"nginx":  {accessTimestamp},
+		"apache": {accessTimestamp},
+	},
+	Grok: map[string]string{
+		"INT":      `[+-]?\d+`,
+		"NUMBER":   `[+-]?\d+(?:\.\d+)?`,
+		"WORD":     `\w+`,
+		"NOTSPACE": `\S+`,
+		"DATA":     `.*?`,
+		"GREEDY":   `.*`,
+		"IP":       `(?:\d{1,3}\.){3}\d{1,3}|[0-9A-Fa-f:]+:[0-9A-Fa-f:.]*`,
+		"HTTPDATE": `\d{2}/\w{3}/\d{4}:\d{2}:\d{2}:\d{2} [+-]\d{4}`,
+		"ISO8601":  `\d{4}-\d{2}-\d{2}[T ]\d{2}:\d{2}:\d{2}(?:\.\d+)?(?:Z|[+-]\d{2}:?\d{2})?`,
+		"LOGLEVEL": `(?i:trace|debug|info|notice|warn(?:ing)?|err(?:or)?|crit(?:ical)?|alert|emerg(?:ency)?|fatal|panic)`,
+	},
+}
+
+// set is a compiled bundle
+type set struct {
+	version  int
+	sources  map[string][]*regexp.Regexp
+	grok     map[string]string
+	severity map[string]string
+}
+
+var current atomic.Pointer[set]
+
+func init() {
+	s, err := compile(Bundle{})
+	if err != nil {
+		panic(err)
+	}
+	current.Store(s)
+}
+
+// Version returns the version of the loaded bundle, 0 for the built-in
+// patterns
+func Version() int {
+	return current.Load().version
+}
+
+// Source returns the regex variants of a collector, tried in order
+func Source(name string) []*regexp.Regexp {
+	return current.Load().sources[name]
+}
+
+// Severity returns the severity name of a spelling added by the bundle
+func Severity(level string) (string, bool) {
+	name, ok := current.Load().severity[strings.ToLower(level)]
+	return name, ok
+}
+
+// grokRef matches %{NAME} and %{NAME:field}
+var grokRef = regexp.MustCompile(`%\{(\w+)(?::(\w+))?\}`)
+
+// Expand replaces the grok references of a regex, %{NAME:field} becomes a
+// group named field
+func Expand(pattern string) (string, error) {
+	return expand(pattern, current.Load().grok)
+}
+
+func expand(pattern string, grok map[string]string) (string, error) {
+	var err error
+	out := grokRef.ReplaceAllStringFunc(pattern, func(ref string) string {
+		m := grokRef.FindStringSubmatch(ref)
+		re, ok := grok[m[1]]
+		if !ok {
+			err = errors.Join(err, fmt.Errorf("unknown grok pattern %q", m[1]))
+			return ref
+		}
+		if m[2] != "" {
+			return "(?P<" + m[2] + ">" + re + ")"
+		}
+		return "(?:" + re + ")"
+	})
+	return out, err
+}
+
+// compile merges a bundle with the built-in patterns. Nothing is loaded when
+// one of the patterns is invalid.
+func compile(b Bundle) (*set, error) {
+	s := &set{
+		version:  b.Version,
+		sources:  make(map[string][]*regexp.Regexp),
+		grok:     maps.Clone(builtin.Grok),
+		severity: make(map[string]string),
+	}
+	maps.Copy(s.grok, b.Grok)
+	for name, re := range s.grok {
+		if _, err := regexp.Compile(re); err != nil {
+			return nil, fmt.Errorf("grok pattern %s: %w", name, err)
+		}
+	}
+
+	sources := maps.Clone(builtin.Sources)
+	maps.Copy(sources, b.Sources)
+	for name, variants := range sources {
+		if len(variants) == 0 {
+			return nil, fmt.Errorf("source %s: no pattern", name)
+		}
+		for i, variant := range variants {
+			re, err := regexp.Compile(variant)
+			if err != nil {
+				return nil, fmt.Errorf("source %s, pattern %d: %w", name, i, err)
+			}
+			s.sources[name] = append(s.sources[name], re)
+		}
+	}
+
+	for spelling, name := range b.Severity {
+		s.severity[strings.ToLower(spelling)] = name
+	}
+	return s, nil
+}
+
+// Verify checks the signature of a downloaded bundle and decodes it
+func Verify(data []byte) (Bundle, error) {
+	if PublicKey == "" {
+		return Bundle{}, errors.New("no public key to verify pattern bundles")
+	}
+	key, err := base64.StdEncoding.DecodeString(PublicKey)
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return Bundle{}, errors.New("invalid pattern bundle public key")
+	}
+
+	var signed Signed
+	if err := json.Unmarshal(data, &signed); err != nil {
+		return Bundle{}, fmt.Errorf("failed to decode pattern bundle: %w", err)
+	}
+	signature, err := base64.StdEncoding.DecodeString(signed.Signature)
+	if err != nil {
+		return Bundle{}, fmt.Errorf("invalid pattern bundle signature: %w", err)
+	}
+	if !ed25519.Verify(key, signed.Bundle, signature) {
+		return Bundle{}, errors.New("pattern bundle signature mismatch")
+	}
+
+	var b Bundle
+	if err := json.Unmarshal(signed.Bundle, &b); err != nil {
+		return Bundle{}, fmt.Errorf("failed to decode pattern bundle: %w", err)
+	}
+	return b, nil
+}
+
+// Load verifies a downloaded bundle and replaces the loaded patterns. A
+// bundle older than the loaded one is refused.
+func Load(data []byte) (int, error) {
+	b, err := Verify(data)
+	if err != nil {
+		return 0, err
+	}
+	if b.Version <= Version() {
+		return 0, fmt.Errorf("pattern bundle version %d isn't newer than %d", b.Version, Version())
+	}
+	s, err := compile(b)
+	if err != nil {
+		return 0, fmt.Errorf("invalid pattern bundle: %w", err)
+	}
+	current.Store(s)
+	return b.Version, nil
+}
+
+// LoadFile loads the bundle saved by a previous run, if any
+func LoadFile(path string) (int, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return Load(data)
+}
+
+// reset restores the built-in patterns
+func reset() {
+	s, _ := compile(Bundle{})
+	current.Store(s)
+}
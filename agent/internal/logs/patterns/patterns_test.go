@@ -0,0 +1,78 @@
+package patterns
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// signedBundle returns a bundle signed with key, as served by the backend
+func signedBundle(t *testing.T, key ed25519.PrivateKey, b Bundle) []byte {
+	t.Helper()
+	raw, err := json.Marshal(b)
+	require.NoError(t, err)
+	data, err := json.Marshal(Signed{Bundle: raw, Signature: base64.StdEncoding.EncodeToString(ed25519.Sign(key, raw))})
+	require.NoError(t, err)
+	return data
+}
+
+func TestLoad(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	PublicKey = base64.StdEncoding.EncodeToString(pub)
+	t.Cleanup(func() { PublicKey = ""; reset() })
+
+	version, err := Load(signedBundle(t, priv, Bundle{
+		Version:  2,
+		Sources:  map[string][]string{"nginx": {`^(?P<timestamp>\d{4}/\d{2}/\d{2} \d{2}:\d{2}:\d{2})`, accessTimestamp}},
+		Grok:     map[string]string{"UPSTREAM": `\d+\.\d+`},
+		Severity: map[string]string{"EROR": "error"},
+	}))
+	require.NoError(t, err)
+	assert.Equal(t, 2, version)
+	assert.Equal(t, 2, Version())
+	assert.Len(t, Source("nginx"), 2)
+	assert.Len(t, Source("apache"), 1, "built-in patterns are kept")
+	name, ok := Severity("eror")
+	assert.True(t, ok)
+	assert.Equal(t, "error", name)
+
+	expanded, err := Expand(`%{IP:client} took %{UPSTREAM}`)
+	require.NoError(t, err)
+	m := regexp.MustCompile(expanded).FindStringSubmatch("10.0.0.1 took 0.25")
+	require.NotNil(t, m)
+	assert.Equal(t, "10.0.0.1", m[1])
+
+	// Same version again, older bundles are refused
+	_, err = Load(signedBundle(t, priv, Bundle{Version: 2}))
+	assert.Error(t, err)
+
+	// Signed with another key
+	_, other, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	_, err = Load(signedBundle(t, other, Bundle{Version: 3}))
+	assert.ErrorContains(t, err, "signature mismatch")
+
+	// Invalid patterns leave the loaded ones
+	_, err = Load(signedBundle(t, priv, Bundle{Version: 3, Sources: map[string][]string{"nginx": {`(`}}}))
+	assert.Error(t, err)
+	assert.Equal(t, 2, Version())
+}
+
+func TestLoadWithoutKey(t *testing.T) {
+	_, priv, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	_, err = Load(signedBundle(t, priv, Bundle{Version: 1}))
+	assert.Error(t, err)
+	assert.Equal(t, 0, Version())
+}
+
+func TestExpandUnknown(t *testing.T) {
+	_, err := Expand(`%{NOPE:field}`)
+	assert.ErrorContains(t, err, "NOPE")
+}
@@ -5,8 +5,13 @@ import (
 	"agent/internal/logger"
 	"agent/internal/logs"
 	"agent/internal/logs/apache"
+	"agent/internal/logs/audit"
+	"agent/internal/logs/coredump"
+	"agent/internal/logs/fim"
 	"agent/internal/logs/journalctl"
 	"agent/internal/logs/nginx"
+	"agent/internal/logs/oom"
+	"agent/internal/logs/socket"
 	"agent/internal/logs/winevent"
 )
 
@@ -14,7 +19,12 @@ func BuildCollectors(cfg *collection.CollectionConfig) []logs.LogCollector {
 	collectorMap := map[string]logs.LogCollector{
 		"journalctl": journalctl.NewJournalCTLCollector(),
 		"apache":     apache.NewApacheLogCollector(),
+		"audit":      audit.NewAuditLogCollector(),
+		"coredump":   coredump.NewCoredumpCollector(),
+		"fim":        fim.NewFIMCollector(),
 		"nginx":      nginx.NewNginxLogCollector(),
+		"oom":        oom.NewOOMLogCollector(),
+		"socket":     socket.NewSocketLogCollector(),
 		"winevent":   winevent.NewWinEventCollector(),
 	}
 
@@ -29,13 +39,16 @@ func BuildCollectors(cfg *collection.CollectionConfig) []logs.LogCollector {
 	}
 
 	// Else, return only enabled ones
-	enabled := make(map[string]bool)
+	enabled := make(map[string]collection.LogSource)
 	for _, src := range cfg.LogSources {
-		enabled[src.Name] = true
+		enabled[src.Name] = src
 	}
 	var selected []logs.LogCollector
 	for name, collector := range collectorMap {
-		if enabled[name] {
+		if src, ok := enabled[name]; ok {
+			if configurable, ok := collector.(logs.ConfigurableCollector); ok {
+				configurable.Configure(src)
+			}
 			selected = append(selected, collector)
 		} else {
 			logger.Log.Debug("Skipping log collector", "name", name)
@@ -0,0 +1,73 @@
+package logs
+
+import (
+	"maps"
+	"slices"
+
+	"agent/internal/collection"
+)
+
+// labelsOption is the log source option listing the label keys to index, as
+// a comma separated list. The other labels set by the collector are moved to
+// the metadata.
+const labelsOption = "labels"
+
+// Without a labels option, a collector label is only indexed while the entry
+// has at most maxLabels labels and its value is short. Longer values are
+// unlikely to be useful for filtering and bloat the index.
+const (
+	maxLabels           = 16
+	maxLabelValueLength = 128
+)
+
+// labelRouter decides which fields of an entry are indexed as labels and
+// which are stored as metadata, to keep the cardinality of labels under
+// control.
+type labelRouter struct {
+	allowed map[string]map[string]bool
+}
+
+func newLabelRouter(cfg *collection.CollectionConfig) *labelRouter {
+	r := &labelRouter{allowed: make(map[string]map[string]bool)}
+	if cfg == nil {
+		return r
+	}
+	for _, src := range cfg.LogSources {
+		keys := splitOption(src.Options[labelsOption])
+		if _, ok := src.Options[labelsOption]; !ok {
+			continue
+		}
+		allowed := make(map[string]bool, len(keys))
+		for _, k := range keys {
+			allowed[k] = true
+		}
+		r.allowed[src.Name] = allowed
+	}
+	return r
+}
+
+// route moves the labels that should not be indexed to the metadata. A label
+// never overwrites a metadata field with the same key. Labels are visited in
+// lexical order so that the same ones are kept for every entry.
+func (r *labelRouter) route(entry *LogEntry) {
+	allowed, configured := r.allowed[entry.Source]
+	indexed := 0
+	for _, k := range slices.Sorted(maps.Keys(entry.Labels)) {
+		v := entry.Labels[k]
+		keep := allowed[k]
+		if !configured {
+			keep = len(v) <= maxLabelValueLength && indexed < maxLabels
+		}
+		if keep {
+			indexed++
+			continue
+		}
+		if entry.Metadata == nil {
+			entry.Metadata = make(map[string]string)
+		}
+		if _, exists := entry.Metadata[k]; !exists {
+			entry.Metadata[k] = v
+		}
+		delete(entry.Labels, k)
+	}
+}
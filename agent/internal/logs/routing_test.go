@@ -0,0 +1,43 @@
+package logs
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"agent/internal/collection"
+)
+
+func TestLabelRouter(t *testing.T) {
+	r := newLabelRouter(&collection.CollectionConfig{LogSources: []collection.LogSource{
+		{Name: "socket", Options: map[string]string{"labels": "level, service"}},
+		{Name: "journalctl", Options: map[string]string{"labels": ""}},
+	}})
+
+	entry := LogEntry{
+		Source:   "socket",
+		Labels:   map[string]string{"level": "info", "service": "api", "request_id": "b7c1", "uid": "1000"},
+		Metadata: map[string]string{"uid": "from-message"},
+	}
+	r.route(&entry)
+	assert.Equal(t, map[string]string{"level": "info", "service": "api"}, entry.Labels)
+	assert.Equal(t, map[string]string{"request_id": "b7c1", "uid": "from-message"}, entry.Metadata)
+
+	// An empty list indexes nothing
+	entry = LogEntry{Source: "journalctl", Labels: map[string]string{"unit": "ssh.service"}}
+	r.route(&entry)
+	assert.Empty(t, entry.Labels)
+	assert.Equal(t, "ssh.service", entry.Metadata["unit"])
+
+	// Without option, long values and labels above the limit are moved
+	entry = LogEntry{Source: "nginx", Labels: map[string]string{"path": strings.Repeat("a", 200)}}
+	for i := 0; i < 20; i++ {
+		entry.Labels["k"+strconv.Itoa(i)] = "v"
+	}
+	r.route(&entry)
+	assert.Len(t, entry.Labels, maxLabels)
+	assert.Len(t, entry.Metadata, 21-maxLabels)
+	assert.Contains(t, entry.Metadata, "path")
+}
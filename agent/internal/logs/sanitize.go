@@ -0,0 +1,41 @@
+package logs
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// binaryControlRatio is the share of control characters above which a line
+// is considered binary content rather than text
+const binaryControlRatio = 0.1
+
+// isBinary reports whether a line read from a file looks like binary data
+// (e.g. a log file overwritten by a core dump, or a sparse file filled with
+// NUL bytes after a truncation).
+func isBinary(line string) bool {
+	if line == "" {
+		return false
+	}
+	var control int
+	for i := 0; i < len(line); i++ {
+		switch c := line[i]; {
+		case c == 0:
+			control++
+		case c < 0x20 && c != '\t' && c != '\r' && c != '\x1b':
+			// Tabs, carriage returns and ANSI colors are common in logs
+			control++
+		}
+	}
+	return float64(control) >= binaryControlRatio*float64(len(line))
+}
+
+// sanitizeLine removes the NUL bytes of a line and replaces its invalid UTF-8
+// sequences with the replacement character, so that it can be encoded and
+// indexed safely.
+func sanitizeLine(line string) string {
+	if utf8.ValidString(line) && strings.IndexByte(line, 0) < 0 {
+		return line
+	}
+	line = strings.ReplaceAll(line, "\x00", "")
+	return strings.ToValidUTF8(line, "�")
+}
@@ -0,0 +1,25 @@
+package logs
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsBinary(t *testing.T) {
+	assert.False(t, isBinary(""))
+	assert.False(t, isBinary("2024-03-05 10:00:00 INFO started"))
+	assert.False(t, isBinary("\x1b[32mINFO\x1b[0m\tstarted\r"))
+	assert.False(t, isBinary("a long enough line with a single stray \x00 byte in it"))
+	assert.True(t, isBinary(strings.Repeat("\x00", 512)))
+	assert.True(t, isBinary("\x7fELF\x02\x01\x01\x00\x00\x00\x00\x00\x00\x00\x00\x00\x03\x00>\x00"))
+}
+
+func TestSanitizeLine(t *testing.T) {
+	assert.Equal(t, "café ok", sanitizeLine("café ok"))
+	assert.Equal(t, "bad � byte", sanitizeLine("bad \xff byte"))
+	assert.Equal(t, "nul", sanitizeLine("n\x00ul"))
+	assert.True(t, utf8.ValidString(sanitizeLine("latin1 caf\xe9")))
+}
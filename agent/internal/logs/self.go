@@ -0,0 +1,37 @@
+package logs
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// selfIdentifier is the syslog identifier of the agent, the name of its
+// binary, e.g. simob
+var selfIdentifier = func() string {
+	if path, err := os.Executable(); err == nil {
+		return filepath.Base(path)
+	}
+	return "simob"
+}()
+
+// selfSyslogPrefix matches the syslog prefix of the lines of the agent in a
+// file, e.g. "web-1 simob[812]: "
+var selfSyslogPrefix = regexp.MustCompile(`(?:^|\s)` + regexp.QuoteMeta(selfIdentifier) + `\[\d+\]: `)
+
+// isSelf reports whether an entry is a log of the agent itself, e.g. read
+// from journald or from /var/log/syslog. Shipping them would loop: a failed
+// export logs an error, which is collected and exported in turn.
+func isSelf(entry LogEntry) bool {
+	if entry.Metadata["identifier"] == selfIdentifier {
+		return true
+	}
+	// The prefix is at the start of the line, a long message quoting the
+	// agent isn't excluded
+	line, _, _ := strings.Cut(entry.Text, "\n")
+	if len(line) > 128 {
+		line = line[:128]
+	}
+	return selfSyslogPrefix.MatchString(line)
+}
@@ -0,0 +1,18 @@
+package logs
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsSelf(t *testing.T) {
+	assert.True(t, isSelf(LogEntry{Metadata: map[string]string{"identifier": selfIdentifier}}))
+	assert.False(t, isSelf(LogEntry{Metadata: map[string]string{"identifier": "sshd"}}))
+
+	assert.True(t, isSelf(LogEntry{Text: "Oct 17 10:00:00 web-1 " + selfIdentifier + "[812]: level=ERROR msg=\"failed to export logs payload\""}))
+	assert.False(t, isSelf(LogEntry{Text: "Oct 17 10:00:00 web-1 sshd[90]: Accepted publickey for root"}))
+	// The syslog prefix is at the start of the line
+	assert.False(t, isSelf(LogEntry{Text: "Oct 17 10:00:00 web-1 app[90]: " + strings.Repeat("x", 200) + " " + selfIdentifier + "[812]: "}))
+}
@@ -0,0 +1,39 @@
+package socket
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sys/unix"
+
+	"agent/internal/common"
+)
+
+// peerLabels identifies the process on the other end of the connection using
+// SO_PEERCRED.
+func peerLabels(conn net.Conn) map[string]string {
+	labels := make(map[string]string)
+	unixConn, ok := conn.(*net.UnixConn)
+	if !ok {
+		return labels
+	}
+	raw, err := unixConn.SyscallConn()
+	if err != nil {
+		return labels
+	}
+	var cred *unix.Ucred
+	_ = raw.Control(func(fd uintptr) {
+		cred, err = unix.GetsockoptUcred(int(fd), unix.SOL_SOCKET, unix.SO_PEERCRED)
+	})
+	if err != nil || cred == nil {
+		return labels
+	}
+
+	labels["uid"] = strconv.FormatUint(uint64(cred.Uid), 10)
+	if comm, err := os.ReadFile(common.HostPath("/proc/" + strconv.Itoa(int(cred.Pid)) + "/comm")); err == nil {
+		labels["process"] = strings.TrimSpace(string(comm))
+	}
+	return labels
+}
@@ -0,0 +1,11 @@
+//go:build !linux
+// +build !linux
+
+package socket
+
+import "net"
+
+// peerLabels is only implemented on Linux.
+func peerLabels(conn net.Conn) map[string]string {
+	return map[string]string{}
+}
@@ -0,0 +1,290 @@
+package socket
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"agent/internal/collection"
+	"agent/internal/logger"
+	"agent/internal/logs"
+)
+
+const (
+	defaultSocketPath = "/run/simob/logs.sock"
+	// maxLineSize is the longest line accepted from a writer.
+	maxLineSize = 256 * 1024
+)
+
+// SocketLogCollector listens on a Unix socket so local applications can write
+// logs directly to the agent. Each line is either a JSON object or plain text.
+//
+// Entries are sent to the output channel synchronously. When the pipeline is
+// slower than the writers, reading stops, the socket buffers fill up and the
+// writers block: the backpressure reaches the applications instead of the
+// agent dropping lines.
+type SocketLogCollector struct {
+	name   string
+	path   string
+	mode   os.FileMode
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+	mu     sync.Mutex
+
+	listener net.Listener
+	conns    map[net.Conn]struct{}
+}
+
+func NewSocketLogCollector() *SocketLogCollector {
+	return &SocketLogCollector{
+		name:  "socket",
+		path:  defaultSocketPath,
+		mode:  0o660,
+		conns: make(map[net.Conn]struct{}),
+	}
+}
+
+func (c *SocketLogCollector) Name() string {
+	return c.name
+}
+
+// Configure sets the socket path from the log source and its file mode from
+// the "mode" option (octal, e.g. "0666").
+func (c *SocketLogCollector) Configure(src collection.LogSource) {
+	if src.Path != "" {
+		c.path = src.Path
+	}
+	if mode, ok := src.Options["mode"]; ok {
+		if m, err := strconv.ParseUint(mode, 8, 32); err == nil {
+			c.mode = os.FileMode(m)
+		} else {
+			logger.Log.Warn("Invalid socket mode, using default", "mode", mode, "error", err)
+		}
+	}
+}
+
+func (c *SocketLogCollector) Discover() []collection.LogSource {
+	if runtime.GOOS == "windows" {
+		return []collection.LogSource{}
+	}
+	return []collection.LogSource{{Name: c.name, Path: c.path}}
+}
+
+func (c *SocketLogCollector) Start(ctx context.Context, out chan<- logs.LogEntry) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.listener != nil {
+		return fmt.Errorf("socket collector already running")
+	}
+
+	if err := removeStaleSocket(c.path); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(c.path), 0o755); err != nil {
+		return fmt.Errorf("failed to create socket directory: %w", err)
+	}
+	listener, err := net.Listen("unix", c.path)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", c.path, err)
+	}
+	if err := os.Chmod(c.path, c.mode); err != nil {
+		logger.Log.Warn("Could not set socket permissions", "path", c.path, "error", err)
+	}
+	logger.Log.Info("Listening for logs", "socket", c.path)
+
+	collectorCtx, cancel := context.WithCancel(ctx)
+	c.cancel = cancel
+	c.listener = listener
+
+	c.wg.Add(1)
+	go c.acceptLoop(collectorCtx, listener, out)
+
+	return nil
+}
+
+func (c *SocketLogCollector) Stop() error {
+	c.mu.Lock()
+	if c.cancel != nil {
+		c.cancel()
+	}
+	if c.listener != nil {
+		c.listener.Close()
+	}
+	for conn := range c.conns {
+		conn.Close()
+	}
+	c.mu.Unlock()
+
+	c.wg.Wait()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.listener != nil {
+		os.Remove(c.path)
+	}
+	c.listener = nil
+	c.cancel = nil
+	return nil
+}
+
+func (c *SocketLogCollector) acceptLoop(ctx context.Context, listener net.Listener, out chan<- logs.LogEntry) {
+	defer c.wg.Done()
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if ctx.Err() != nil || errors.Is(err, net.ErrClosed) {
+				return
+			}
+			logger.Log.Error("failed to accept socket connection", "error", err)
+			time.Sleep(100 * time.Millisecond)
+			continue
+		}
+
+		c.mu.Lock()
+		c.conns[conn] = struct{}{}
+		c.mu.Unlock()
+
+		c.wg.Add(1)
+		go c.handleConn(ctx, conn, out)
+	}
+}
+
+func (c *SocketLogCollector) handleConn(ctx context.Context, conn net.Conn, out chan<- logs.LogEntry) {
+	defer c.wg.Done()
+	defer func() {
+		c.mu.Lock()
+		delete(c.conns, conn)
+		c.mu.Unlock()
+		conn.Close()
+	}()
+
+	labels := peerLabels(conn)
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, 64*1024), maxLineSize)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		entry := c.processLogLine(line, labels)
+		select {
+		case out <- entry:
+		case <-ctx.Done():
+			return
+		}
+	}
+	if err := scanner.Err(); err != nil && ctx.Err() == nil {
+		logger.Log.Warn("socket connection closed with error", "error", err)
+	}
+}
+
+// processLogLine parses a line written by an application. JSON objects may
+// carry "message" (or "msg"), "timestamp" (or "time", "ts"), "level" and a
+// "labels" object; the other fields are kept as metadata. Any other line is
+// shipped as plain text.
+func (c *SocketLogCollector) processLogLine(line string, connLabels map[string]string) logs.LogEntry {
+	entry := logs.LogEntry{
+		Timestamp: time.Now().UnixMilli(),
+		Source:    c.name,
+		Text:      line,
+		Labels:    maps.Clone(connLabels),
+		Metadata:  make(map[string]string),
+	}
+	if entry.Labels == nil {
+		entry.Labels = make(map[string]string)
+	}
+
+	if !strings.HasPrefix(strings.TrimSpace(line), "{") {
+		return entry
+	}
+	var fields map[string]any
+	if err := json.Unmarshal([]byte(line), &fields); err != nil {
+		return entry
+	}
+
+	for _, key := range []string{"message", "msg"} {
+		if msg, ok := fields[key].(string); ok {
+			entry.Text = msg
+			delete(fields, key)
+			break
+		}
+	}
+	for _, key := range []string{"timestamp", "time", "ts"} {
+		if v, ok := fields[key]; ok {
+			if ts, ok := parseTimestamp(v); ok {
+				entry.Timestamp = ts
+				delete(fields, key)
+				break
+			}
+		}
+	}
+	if level, ok := fields["level"].(string); ok {
+		entry.Labels["level"] = strings.ToLower(level)
+		delete(fields, "level")
+	}
+	if labels, ok := fields["labels"].(map[string]any); ok {
+		for k, v := range labels {
+			entry.Labels[k] = fmt.Sprint(v)
+		}
+		delete(fields, "labels")
+	}
+	for k, v := range fields {
+		switch v := v.(type) {
+		case string:
+			entry.Metadata[k] = v
+		case nil:
+		default:
+			if b, err := json.Marshal(v); err == nil {
+				entry.Metadata[k] = string(b)
+			}
+		}
+	}
+	return entry
+}
+
+// parseTimestamp accepts RFC 3339 strings and Unix timestamps in seconds or
+// milliseconds.
+func parseTimestamp(v any) (int64, bool) {
+	switch v := v.(type) {
+	case string:
+		if t, err := time.Parse(time.RFC3339Nano, v); err == nil {
+			return t.UnixMilli(), true
+		}
+	case float64:
+		if v > 1e12 {
+			return int64(v), true
+		}
+		if v > 0 {
+			return int64(v * 1000), true
+		}
+	}
+	return 0, false
+}
+
+// removeStaleSocket removes a socket file left by a previous run. It refuses
+// to remove anything that isn't a socket.
+func removeStaleSocket(path string) error {
+	info, err := os.Lstat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to stat %s: %w", path, err)
+	}
+	if info.Mode()&os.ModeSocket == 0 {
+		return fmt.Errorf("%s exists and is not a socket", path)
+	}
+	return os.Remove(path)
+}
@@ -0,0 +1,125 @@
+//go:build !windows
+// +build !windows
+
+package socket
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"agent/internal/collection"
+	"agent/internal/logger"
+	"agent/internal/logs"
+)
+
+func init() {
+	logger.Log = slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+func TestSocketLogCollector_ProcessPlainText(t *testing.T) {
+	c := NewSocketLogCollector()
+
+	entry := c.processLogLine("service started", map[string]string{"process": "myapp"})
+	assert.Equal(t, "socket", entry.Source)
+	assert.Equal(t, "service started", entry.Text)
+	assert.Equal(t, map[string]string{"process": "myapp"}, entry.Labels)
+	assert.NotZero(t, entry.Timestamp)
+}
+
+func TestSocketLogCollector_ProcessJSON(t *testing.T) {
+	c := NewSocketLogCollector()
+	line := `{"msg":"payment failed","level":"ERROR","ts":1700000000.5,"labels":{"app":"billing"},"order_id":"42","attempt":3}`
+
+	entry := c.processLogLine(line, map[string]string{"uid": "1000"})
+	assert.Equal(t, "payment failed", entry.Text)
+	assert.Equal(t, int64(1700000000500), entry.Timestamp)
+	assert.Equal(t, map[string]string{"uid": "1000", "level": "error", "app": "billing"}, entry.Labels)
+	assert.Equal(t, map[string]string{"order_id": "42", "attempt": "3"}, entry.Metadata)
+}
+
+func TestSocketLogCollector_ProcessJSONTimestamps(t *testing.T) {
+	c := NewSocketLogCollector()
+
+	entry := c.processLogLine(`{"message":"a","timestamp":"2024-01-02T03:04:05.678Z"}`, nil)
+	assert.Equal(t, int64(1704164645678), entry.Timestamp)
+
+	entry = c.processLogLine(`{"message":"b","time":1704164645678}`, nil)
+	assert.Equal(t, int64(1704164645678), entry.Timestamp)
+}
+
+func TestSocketLogCollector_ProcessInvalidJSON(t *testing.T) {
+	c := NewSocketLogCollector()
+
+	line := `{"message": truncated`
+	entry := c.processLogLine(line, nil)
+	assert.Equal(t, line, entry.Text)
+}
+
+func TestSocketLogCollector_Configure(t *testing.T) {
+	c := NewSocketLogCollector()
+	c.Configure(collection.LogSource{Name: "socket", Path: "/tmp/app.sock", Options: map[string]string{"mode": "0666"}})
+
+	assert.Equal(t, "/tmp/app.sock", c.path)
+	assert.Equal(t, os.FileMode(0o666), c.mode)
+}
+
+func TestSocketLogCollector_StartReceivesLines(t *testing.T) {
+	dir, err := os.MkdirTemp("", "simob")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "logs.sock")
+
+	// A stale socket from a previous run must not prevent startup
+	stale, err := net.Listen("unix", path)
+	require.NoError(t, err)
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+
+	c := NewSocketLogCollector()
+	c.Configure(collection.LogSource{Name: "socket", Path: path})
+
+	out := make(chan logs.LogEntry, 10)
+	require.NoError(t, c.Start(context.Background(), out))
+
+	conn, err := net.Dial("unix", path)
+	require.NoError(t, err)
+	_, err = conn.Write([]byte("first\n\n{\"message\":\"second\"}\n"))
+	require.NoError(t, err)
+	conn.Close()
+
+	for _, want := range []string{"first", "second"} {
+		select {
+		case entry := <-out:
+			assert.Equal(t, want, entry.Text)
+			if runtime.GOOS == "linux" {
+				assert.Equal(t, strconv.Itoa(os.Getuid()), entry.Labels["uid"])
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("timed out waiting for %q", want)
+		}
+	}
+
+	require.NoError(t, c.Stop())
+	_, err = os.Stat(path)
+	assert.True(t, os.IsNotExist(err), "socket file should be removed on stop")
+}
+
+func TestSocketLogCollector_RefusesNonSocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "regular")
+	require.NoError(t, os.WriteFile(path, []byte("data"), 0o644))
+
+	c := NewSocketLogCollector()
+	c.Configure(collection.LogSource{Name: "socket", Path: path})
+	assert.Error(t, c.Start(context.Background(), make(chan logs.LogEntry)))
+}
@@ -0,0 +1,491 @@
+package logs
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"agent/internal/collection"
+	"agent/internal/logger"
+	"agent/internal/logs/patterns"
+)
+
+// Stage is a step of the processing chain of a log source. It updates the
+// entry in place and returns false when the entry must be dropped.
+type Stage interface {
+	Process(entry *LogEntry) bool
+}
+
+// StageFunc adapts a function to the Stage interface
+type StageFunc func(entry *LogEntry) bool
+
+func (f StageFunc) Process(entry *LogEntry) bool {
+	return f(entry)
+}
+
+// Chain is the ordered list of stages of a log source
+type Chain []Stage
+
+// Process runs the entry through every stage, and stops at the first one
+// dropping it.
+func (c Chain) Process(entry *LogEntry) bool {
+	for _, stage := range c {
+		if !stage.Process(entry) {
+			return false
+		}
+	}
+	return true
+}
+
+// stageBuilders creates the stages from their options, by type
+var stageBuilders = map[string]func(options map[string]string) (Stage, error){
+	"parse":     newParseStage,
+	"timestamp": newTimestampStage,
+	"severity":  newSeverityStage,
+	"redact":    newRedactStage,
+	"filter":    newFilterStage,
+	"labels":    newLabelsStage,
+}
+
+// NewChain builds the chain described by the stages of a log source
+func NewChain(stages []collection.Stage) (Chain, error) {
+	chain := make(Chain, 0, len(stages))
+	for i, s := range stages {
+		build, ok := stageBuilders[s.Type]
+		if !ok {
+			return nil, fmt.Errorf("stage %d: unknown type %q", i, s.Type)
+		}
+		stage, err := build(s.Options)
+		if err != nil {
+			return nil, fmt.Errorf("stage %d (%s): %w", i, s.Type, err)
+		}
+		chain = append(chain, stage)
+	}
+	return chain, nil
+}
+
+// buildChains returns the chain of every log source defining stages. A
+// source with an invalid chain is shipped unprocessed rather than dropped.
+func buildChains(cfg *collection.CollectionConfig) map[string]Chain {
+	chains := make(map[string]Chain)
+	if cfg == nil {
+		return chains
+	}
+	for _, src := range cfg.LogSources {
+		if len(src.Stages) == 0 {
+			continue
+		}
+		chain, err := NewChain(src.Stages)
+		if err != nil {
+			logger.Log.Warn("Invalid processing stages, entries are shipped unprocessed", "source", src.Name, "error", err)
+			continue
+		}
+		chains[src.Name] = chain
+	}
+	return chains
+}
+
+// parse: extracts the fields of the message into the metadata.
+//
+// Options: format (json, logfmt or regex), pattern (regex with named groups,
+// for the regex format, which may reference the grok library as %{NAME} or
+// %{NAME:field}), message_field (field replacing the message,
+// defaults to message or msg).
+func newParseStage(options map[string]string) (Stage, error) {
+	messageFields := []string{"message", "msg"}
+	if f := options["message_field"]; f != "" {
+		messageFields = []string{f}
+	}
+
+	var parse func(text string) (map[string]string, bool)
+	switch options["format"] {
+	case "json", "":
+		parse = parseJSONFields
+	case "logfmt":
+		parse = parseLogfmt
+	case "regex":
+		pattern, err := patterns.Expand(options["pattern"])
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern: %w", err)
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern: %w", err)
+		}
+		parse = func(text string) (map[string]string, bool) {
+			m := re.FindStringSubmatch(text)
+			if m == nil {
+				return nil, false
+			}
+			fields := make(map[string]string)
+			for i, name := range re.SubexpNames() {
+				if i > 0 && name != "" && m[i] != "" {
+					fields[name] = m[i]
+				}
+			}
+			return fields, true
+		}
+	default:
+		return nil, fmt.Errorf("unknown format %q", options["format"])
+	}
+
+	return StageFunc(func(entry *LogEntry) bool {
+		fields, ok := parse(entry.Text)
+		if !ok {
+			// Unparsed lines are kept as they are
+			return true
+		}
+		for _, f := range messageFields {
+			if msg, ok := fields[f]; ok {
+				entry.Text = msg
+				delete(fields, f)
+				break
+			}
+		}
+		if entry.Metadata == nil {
+			entry.Metadata = make(map[string]string)
+		}
+		maps.Copy(entry.Metadata, fields)
+		return true
+	}), nil
+}
+
+func parseJSONFields(text string) (map[string]string, bool) {
+	if !strings.HasPrefix(strings.TrimSpace(text), "{") {
+		return nil, false
+	}
+	var raw map[string]any
+	if err := json.Unmarshal([]byte(text), &raw); err != nil {
+		return nil, false
+	}
+	fields := make(map[string]string, len(raw))
+	for k, v := range raw {
+		switch v := v.(type) {
+		case string:
+			fields[k] = v
+		case nil:
+		default:
+			if b, err := json.Marshal(v); err == nil {
+				fields[k] = string(b)
+			}
+		}
+	}
+	return fields, true
+}
+
+// parseLogfmt splits a line of key=value pairs, values may be double quoted
+func parseLogfmt(text string) (map[string]string, bool) {
+	fields := make(map[string]string)
+	for len(text) > 0 {
+		text = strings.TrimLeft(text, " ")
+		eq := strings.IndexByte(text, '=')
+		sp := strings.IndexByte(text, ' ')
+		if eq <= 0 || (sp >= 0 && sp < eq) {
+			// Skip a token without value
+			if sp < 0 {
+				break
+			}
+			text = text[sp:]
+			continue
+		}
+		key := text[:eq]
+		text = text[eq+1:]
+		var value string
+		if strings.HasPrefix(text, `"`) {
+			end := 1
+			for end < len(text) && (text[end] != '"' || text[end-1] == '\\') {
+				end++
+			}
+			if unquoted, err := strconv.Unquote(text[:min(end+1, len(text))]); err == nil {
+				value = unquoted
+			} else {
+				value = strings.Trim(text[:min(end+1, len(text))], `"`)
+			}
+			text = text[min(end+1, len(text)):]
+		} else if sp := strings.IndexByte(text, ' '); sp >= 0 {
+			value, text = text[:sp], text[sp:]
+		} else {
+			value, text = text, ""
+		}
+		fields[key] = value
+	}
+	return fields, len(fields) > 0
+}
+
+// timestamp: sets the timestamp of the entry from a metadata field, which is
+// then removed.
+//
+// Options: field (defaults to timestamp, time, ts or @timestamp), layout
+// (rfc3339, unix, unix_ms or a Go time layout, defaults to rfc3339).
+func newTimestampStage(options map[string]string) (Stage, error) {
+	fields := []string{"timestamp", "time", "ts", "@timestamp"}
+	if f := options["field"]; f != "" {
+		fields = []string{f}
+	}
+	layout := options["layout"]
+
+	parse := func(value string) (time.Time, error) {
+		switch layout {
+		case "", "rfc3339":
+			return time.Parse(time.RFC3339Nano, value)
+		case "unix", "unix_ms":
+			n, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return time.Time{}, err
+			}
+			if layout == "unix_ms" {
+				return time.UnixMilli(int64(n)), nil
+			}
+			return time.UnixMilli(int64(n * 1000)), nil
+		default:
+			return time.Parse(layout, value)
+		}
+	}
+
+	return StageFunc(func(entry *LogEntry) bool {
+		for _, f := range fields {
+			value, ok := entry.Metadata[f]
+			if !ok {
+				continue
+			}
+			if t, err := parse(value); err == nil {
+				entry.Timestamp = t.UnixMilli()
+				delete(entry.Metadata, f)
+			}
+			break
+		}
+		return true
+	}), nil
+}
+
+// severityNames maps the usual spellings of a severity to the names used by
+// the journald collector
+var severityNames = map[string]string{
+	"emerg":         "emergency",
+	"emergency":     "emergency",
+	"panic":         "emergency",
+	"alert":         "alert",
+	"crit":          "critical",
+	"critical":      "critical",
+	"fatal":         "critical",
+	"err":           "error",
+	"error":         "error",
+	"warn":          "warning",
+	"warning":       "warning",
+	"notice":        "notice",
+	"info":          "info",
+	"information":   "info",
+	"informational": "info",
+	"debug":         "debug",
+	"trace":         "debug",
+}
+
+// severityRanks orders the severities, the most severe first. Ranks are the
+// syslog priorities.
+var severityRanks = map[string]int{
+	"emergency": 0, "alert": 1, "critical": 2, "error": 3,
+	"warning": 4, "notice": 5, "info": 6, "debug": 7,
+}
+
+// normalizeSeverity returns the severity name of a level, which may be a
+// syslog priority number
+func normalizeSeverity(level string) (string, bool) {
+	level = strings.ToLower(strings.TrimSpace(level))
+	if name, ok := patterns.Severity(level); ok {
+		if _, known := severityRanks[name]; known {
+			return name, true
+		}
+	}
+	if name, ok := severityNames[level]; ok {
+		return name, true
+	}
+	if p, err := strconv.Atoi(level); err == nil {
+		for name, rank := range severityRanks {
+			if rank == p {
+				return name, true
+			}
+		}
+	}
+	return "", false
+}
+
+// severity: sets the normalized level label from a metadata field or label.
+//
+// Options: field (defaults to level, severity or priority), default (level
+// used when none is found).
+func newSeverityStage(options map[string]string) (Stage, error) {
+	fields := []string{"level", "severity", "priority"}
+	if f := options["field"]; f != "" {
+		fields = []string{f}
+	}
+	fallback := ""
+	if d := options["default"]; d != "" {
+		name, ok := normalizeSeverity(d)
+		if !ok {
+			return nil, fmt.Errorf("unknown default level %q", d)
+		}
+		fallback = name
+	}
+
+	return StageFunc(func(entry *LogEntry) bool {
+		level := fallback
+		for _, f := range fields {
+			value, ok := entry.Metadata[f]
+			if !ok {
+				value, ok = entry.Labels[f]
+			}
+			if !ok {
+				continue
+			}
+			if name, ok := normalizeSeverity(value); ok {
+				level = name
+				delete(entry.Metadata, f)
+				break
+			}
+		}
+		if level != "" {
+			if entry.Labels == nil {
+				entry.Labels = make(map[string]string)
+			}
+			entry.Labels["level"] = level
+		}
+		return true
+	}), nil
+}
+
+// builtinRedactions are the redaction patterns available by name
+var builtinRedactions = map[string]struct {
+	re          *regexp.Regexp
+	replacement string
+}{
+	"email":       {regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`), "[REDACTED]"},
+	"ipv4":        {regexp.MustCompile(`\b(?:\d{1,3}\.){3}\d{1,3}\b`), "[REDACTED]"},
+	"credit_card": {regexp.MustCompile(`\b(?:\d[ -]?){12,15}\d\b`), "[REDACTED]"},
+	"bearer":      {regexp.MustCompile(`(?i)\b(bearer\s+)[A-Za-z0-9._~+/-]+=*`), "${1}[REDACTED]"},
+	"secret":      {regexp.MustCompile(`(?i)\b(password|passwd|pwd|secret|token|api_key)([=:]\s*)[^\s,;&"']+`), "${1}${2}[REDACTED]"},
+}
+
+// redact: replaces sensitive values in the message and the metadata.
+//
+// Options: builtin (comma separated list of email, ipv4, credit_card,
+// bearer, secret), pattern (custom regular expression), replacement (for
+// the custom pattern, defaults to [REDACTED]).
+func newRedactStage(options map[string]string) (Stage, error) {
+	type redaction struct {
+		re          *regexp.Regexp
+		replacement string
+	}
+	var redactions []redaction
+	for _, name := range splitOption(options["builtin"]) {
+		b, ok := builtinRedactions[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown builtin redaction %q", name)
+		}
+		redactions = append(redactions, redaction{b.re, b.replacement})
+	}
+	if pattern := options["pattern"]; pattern != "" {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern: %w", err)
+		}
+		replacement := options["replacement"]
+		if replacement == "" {
+			replacement = "[REDACTED]"
+		}
+		redactions = append(redactions, redaction{re, replacement})
+	}
+	if len(redactions) == 0 {
+		return nil, fmt.Errorf("no redaction configured")
+	}
+
+	redact := func(s string) string {
+		for _, r := range redactions {
+			s = r.re.ReplaceAllString(s, r.replacement)
+		}
+		return s
+	}
+	return StageFunc(func(entry *LogEntry) bool {
+		entry.Text = redact(entry.Text)
+		for k, v := range entry.Metadata {
+			entry.Metadata[k] = redact(v)
+		}
+		return true
+	}), nil
+}
+
+// filter: drops the entries not matching the conditions.
+//
+// Options: include (regex the message must match), exclude (regex the
+// message must not match), min_level (least severe level kept, entries
+// without level are kept).
+func newFilterStage(options map[string]string) (Stage, error) {
+	var include, exclude *regexp.Regexp
+	var err error
+	if p := options["include"]; p != "" {
+		if include, err = regexp.Compile(p); err != nil {
+			return nil, fmt.Errorf("invalid include pattern: %w", err)
+		}
+	}
+	if p := options["exclude"]; p != "" {
+		if exclude, err = regexp.Compile(p); err != nil {
+			return nil, fmt.Errorf("invalid exclude pattern: %w", err)
+		}
+	}
+	minRank := -1
+	if l := options["min_level"]; l != "" {
+		name, ok := normalizeSeverity(l)
+		if !ok {
+			return nil, fmt.Errorf("unknown level %q", l)
+		}
+		minRank = severityRanks[name]
+	}
+
+	return StageFunc(func(entry *LogEntry) bool {
+		if include != nil && !include.MatchString(entry.Text) {
+			return false
+		}
+		if exclude != nil && exclude.MatchString(entry.Text) {
+			return false
+		}
+		if minRank >= 0 {
+			if name, ok := normalizeSeverity(entry.Labels["level"]); ok && severityRanks[name] > minRank {
+				return false
+			}
+		}
+		return true
+	}), nil
+}
+
+// labels: promotes metadata fields to labels and adds static labels.
+//
+// Options: keys (comma separated metadata fields to index), static (comma
+// separated key=value pairs).
+func newLabelsStage(options map[string]string) (Stage, error) {
+	keys := splitOption(options["keys"])
+	static := make(map[string]string)
+	for _, pair := range splitOption(options["static"]) {
+		k, v, ok := strings.Cut(pair, "=")
+		if !ok || k == "" {
+			return nil, fmt.Errorf("invalid static label %q", pair)
+		}
+		static[strings.TrimSpace(k)] = strings.TrimSpace(v)
+	}
+
+	return StageFunc(func(entry *LogEntry) bool {
+		if entry.Labels == nil {
+			entry.Labels = make(map[string]string)
+		}
+		for _, k := range keys {
+			if v, ok := entry.Metadata[k]; ok {
+				entry.Labels[k] = v
+				delete(entry.Metadata, k)
+			}
+		}
+		maps.Copy(entry.Labels, static)
+		return true
+	}), nil
+}
@@ -0,0 +1,90 @@
+package logs
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"agent/internal/collection"
+)
+
+func TestChain(t *testing.T) {
+	chain, err := NewChain([]collection.Stage{
+		{Type: "parse", Options: map[string]string{"format": "json"}},
+		{Type: "timestamp"},
+		{Type: "severity"},
+		{Type: "redact", Options: map[string]string{"builtin": "email, secret"}},
+		{Type: "filter", Options: map[string]string{"min_level": "info", "exclude": "healthcheck"}},
+		{Type: "labels", Options: map[string]string{"keys": "service", "static": "team=payments"}},
+	})
+	require.NoError(t, err)
+
+	entry := LogEntry{Source: "socket", Text: `{"ts":"2024-03-05T10:00:00Z","level":"WARN","service":"billing","msg":"invoice sent to jane@example.com","user":"password=hunter2"}`}
+	require.True(t, chain.Process(&entry))
+	assert.Equal(t, "invoice sent to [REDACTED]", entry.Text)
+	assert.Equal(t, time.Date(2024, 3, 5, 10, 0, 0, 0, time.UTC).UnixMilli(), entry.Timestamp)
+	assert.Equal(t, map[string]string{"level": "warning", "service": "billing", "team": "payments"}, entry.Labels)
+	assert.Equal(t, map[string]string{"user": "password=[REDACTED]"}, entry.Metadata)
+
+	debug := LogEntry{Text: `{"level":"debug","msg":"cache miss"}`}
+	assert.False(t, chain.Process(&debug))
+	health := LogEntry{Text: `{"level":"info","msg":"healthcheck ok"}`}
+	assert.False(t, chain.Process(&health))
+}
+
+func TestChainErrors(t *testing.T) {
+	for _, stages := range [][]collection.Stage{
+		{{Type: "unknown"}},
+		{{Type: "parse", Options: map[string]string{"format": "xml"}}},
+		{{Type: "parse", Options: map[string]string{"format": "regex", "pattern": "("}}},
+		{{Type: "redact"}},
+		{{Type: "redact", Options: map[string]string{"builtin": "ssn"}}},
+		{{Type: "filter", Options: map[string]string{"min_level": "loud"}}},
+		{{Type: "labels", Options: map[string]string{"static": "novalue"}}},
+	} {
+		_, err := NewChain(stages)
+		assert.Error(t, err, stages[0].Type)
+	}
+}
+
+func TestParseStageFormats(t *testing.T) {
+	logfmt, err := newParseStage(map[string]string{"format": "logfmt"})
+	require.NoError(t, err)
+	entry := LogEntry{Text: `time=2024-03-05T10:00:00Z level=error msg="disk \"data\" full" path=/var`}
+	logfmt.Process(&entry)
+	assert.Equal(t, `disk "data" full`, entry.Text)
+	assert.Equal(t, map[string]string{"time": "2024-03-05T10:00:00Z", "level": "error", "path": "/var"}, entry.Metadata)
+
+	regex, err := newParseStage(map[string]string{"format": "regex", "pattern": `^(?P<client>\S+) (?P<method>[A-Z]+) (?P<message>.*)$`})
+	require.NoError(t, err)
+	entry = LogEntry{Text: "10.0.0.1 GET /index.html"}
+	regex.Process(&entry)
+	assert.Equal(t, "/index.html", entry.Text)
+	assert.Equal(t, map[string]string{"client": "10.0.0.1", "method": "GET"}, entry.Metadata)
+
+	// Lines not matching the format are kept unchanged
+	entry = LogEntry{Text: "plain text"}
+	assert.True(t, regex.Process(&entry))
+	assert.Equal(t, "plain text", entry.Text)
+	assert.Empty(t, entry.Metadata)
+}
+
+func TestTimestampAndSeverityStages(t *testing.T) {
+	ts, err := newTimestampStage(map[string]string{"field": "when", "layout": "unix_ms"})
+	require.NoError(t, err)
+	entry := LogEntry{Timestamp: 1, Metadata: map[string]string{"when": "1709632800000"}}
+	ts.Process(&entry)
+	assert.Equal(t, int64(1709632800000), entry.Timestamp)
+	assert.NotContains(t, entry.Metadata, "when")
+
+	severity, err := newSeverityStage(map[string]string{"default": "notice"})
+	require.NoError(t, err)
+	entry = LogEntry{Metadata: map[string]string{"priority": "3"}}
+	severity.Process(&entry)
+	assert.Equal(t, "error", entry.Labels["level"])
+	entry = LogEntry{}
+	severity.Process(&entry)
+	assert.Equal(t, "notice", entry.Labels["level"])
+}
@@ -0,0 +1,31 @@
+package logs
+
+import "agent/internal/selfstats"
+
+// sourceStats are the self-metrics kept for each log source, so that users
+// can see which source their log volume comes from.
+type sourceStats struct {
+	linesRead     *selfstats.Counter
+	bytesRead     *selfstats.Counter
+	linesDropped  *selfstats.Counter
+	parseFailures *selfstats.Counter
+	// selfExcluded are the logs of the agent itself, not shipped
+	selfExcluded *selfstats.Counter
+}
+
+func statsFor(source string) *sourceStats {
+	labels := map[string]string{"source": source}
+	return &sourceStats{
+		linesRead:     selfstats.NewCounter("logs_lines_read_total", labels),
+		bytesRead:     selfstats.NewCounter("logs_bytes_read_total", labels),
+		linesDropped:  selfstats.NewCounter("logs_lines_dropped_total", labels),
+		parseFailures: selfstats.NewCounter("logs_parse_failures_total", labels),
+		selfExcluded:  selfstats.NewCounter("logs_self_lines_excluded_total", labels),
+	}
+}
+
+// read accounts for a line read from the source
+func (s *sourceStats) read(line string) {
+	s.linesRead.Inc()
+	s.bytesRead.Add(float64(len(line)))
+}
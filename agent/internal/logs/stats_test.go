@@ -0,0 +1,32 @@
+package logs
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"agent/internal/selfstats"
+)
+
+func TestSourceStats(t *testing.T) {
+	selfstats.Reset()
+	defer selfstats.Reset()
+
+	s := statsFor("nginx")
+	s.read("GET / 200")
+	s.read("GET /favicon.ico 404")
+	s.parseFailures.Inc()
+
+	values := make(map[string]float64)
+	for _, sample := range selfstats.Snapshot() {
+		assert.Equal(t, map[string]string{"source": "nginx"}, sample.Labels)
+		values[sample.Name] = sample.Value
+	}
+	assert.Equal(t, map[string]float64{
+		"logs_lines_read_total":          2,
+		"logs_bytes_read_total":          29,
+		"logs_lines_dropped_total":       0,
+		"logs_parse_failures_total":      1,
+		"logs_self_lines_excluded_total": 0,
+	}, values)
+}
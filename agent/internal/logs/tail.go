@@ -3,6 +3,7 @@ package logs
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -25,6 +26,12 @@ type TailRunner struct {
 	// pattern is the glob pattern used to match files to tail
 	pattern string
 
+	// source is the name of the log source
+	source string
+
+	// stats are the self-metrics of the log source
+	stats *sourceStats
+
 	// out is the channel where the log entries are sent for processing
 	out chan<- LogEntry
 
@@ -46,8 +53,11 @@ type TailRunner struct {
 	positionMutex sync.Mutex
 }
 
-// NewTailRunner creates and configures a new TailRunner.
-func NewTailRunner(pattern string, processor Processor) (*TailRunner, error) {
+// NewTailRunner creates and configures a new TailRunner for the named log
+// source. The pattern is a path of the host, read under the host root when
+// one is set.
+func NewTailRunner(source, pattern string, processor Processor) (*TailRunner, error) {
+	pattern = common.HostPath(pattern)
 	// Check that all files can be opened
 	files, err := filepath.Glob(pattern)
 	if err != nil {
@@ -75,6 +85,8 @@ func NewTailRunner(pattern string, processor Processor) (*TailRunner, error) {
 
 	return &TailRunner{
 		pattern:           pattern,
+		source:            source,
+		stats:             statsFor(source),
 		processor:         processor,
 		positions:         positions,
 		positionsFilePath: positionPath,
@@ -137,6 +149,9 @@ func (r *TailRunner) Start(ctx context.Context, out chan<- LogEntry) error {
 		r.wg.Add(1)
 		go func(t *tail.Tail, processor Processor) {
 			defer r.wg.Done()
+			// binary is set while reading a run of binary lines, only the
+			// first one is reported
+			binary := false
 			for {
 				select {
 				case <-ctx.Done():
@@ -147,9 +162,18 @@ func (r *TailRunner) Start(ctx context.Context, out chan<- LogEntry) error {
 						continue
 					}
 
-					// Process log entry and send it to out channel
-					processedLog, _ := processor(line.Text)
-					out <- processedLog
+					if isBinary(line.Text) {
+						r.stats.read(line.Text)
+						r.stats.linesDropped.Inc()
+						if !binary {
+							binary = true
+							logger.Log.Warn("Skipping binary content in log file", "filename", t.Filename)
+							out <- r.binaryContentEntry(t.Filename)
+						}
+					} else {
+						binary = false
+						r.processLine(sanitizeLine(line.Text), t.Filename, processor, out)
+					}
 
 					// Update position after processing line
 					if offset, err := t.Tell(); err == nil {
@@ -163,6 +187,36 @@ func (r *TailRunner) Start(ctx context.Context, out chan<- LogEntry) error {
 	return nil
 }
 
+// processLine parses a line and sends it to out. Lines that are not shipped
+// are accounted for here, the others once they reach the processing loop.
+func (r *TailRunner) processLine(line, filename string, processor Processor, out chan<- LogEntry) {
+	processedLog, err := processor(line)
+	switch {
+	case err == nil:
+		out <- processedLog
+	case errors.Is(err, ErrFiltered):
+		r.stats.read(line)
+		r.stats.linesDropped.Inc()
+	default:
+		logger.Log.Debug("Failed to parse log line", "filename", filename, "error", err)
+		r.stats.read(line)
+		r.stats.parseFailures.Inc()
+		r.stats.linesDropped.Inc()
+	}
+}
+
+// binaryContentEntry is the event shipped instead of binary content found in
+// a log file.
+func (r *TailRunner) binaryContentEntry(filename string) LogEntry {
+	return LogEntry{
+		Timestamp: time.Now().UnixMilli(),
+		Source:    r.source,
+		Text:      fmt.Sprintf("Skipped binary content in %s", filename),
+		Labels:    map[string]string{"level": "warning"},
+		Metadata:  map[string]string{"file": filename},
+	}
+}
+
 func (r *TailRunner) Stop() error {
 	for _, t := range r.tailers {
 		t.Cleanup()
@@ -0,0 +1,163 @@
+package logs
+
+import (
+	"regexp"
+	"strings"
+
+	"agent/internal/collection"
+)
+
+// Log source options overriding the fields holding the trace context, as
+// comma separated lists of field names.
+const (
+	traceIDFieldsOption = "trace_id_fields"
+	spanIDFieldsOption  = "span_id_fields"
+)
+
+// Metadata keys set from the extracted trace context
+const (
+	traceIDKey    = "trace_id"
+	spanIDKey     = "span_id"
+	traceFlagsKey = "trace_flags"
+)
+
+var (
+	defaultTraceIDFields = []string{"trace_id", "traceId", "traceID", "trace.id", "dd.trace_id"}
+	defaultSpanIDFields  = []string{"span_id", "spanId", "spanID", "span.id", "dd.span_id"}
+
+	// traceparentRe matches a W3C traceparent: version-trace id-parent id-flags
+	traceparentRe = regexp.MustCompile(`\b([0-9a-f]{2})-([0-9a-f]{32})-([0-9a-f]{16})-([0-9a-f]{2})\b`)
+)
+
+// TraceExtractor copies the trace context found in a log entry to the
+// trace_id, span_id and trace_flags metadata, so that the backend can
+// correlate logs with traces. It looks, in order, for:
+//   - a structured field (metadata) named after one of the trace fields
+//   - a W3C traceparent in the metadata or the message
+//   - a key=value or "key":"value" pair in the message
+type TraceExtractor struct {
+	traceIDFields []string
+	spanIDFields  []string
+	traceIDRe     *regexp.Regexp
+	spanIDRe      *regexp.Regexp
+}
+
+// NewTraceExtractor creates an extractor looking for the given fields, the
+// default ones are used when a list is empty.
+func NewTraceExtractor(traceIDFields, spanIDFields []string) *TraceExtractor {
+	if len(traceIDFields) == 0 {
+		traceIDFields = defaultTraceIDFields
+	}
+	if len(spanIDFields) == 0 {
+		spanIDFields = defaultSpanIDFields
+	}
+	return &TraceExtractor{
+		traceIDFields: traceIDFields,
+		spanIDFields:  spanIDFields,
+		traceIDRe:     fieldPairRe(traceIDFields),
+		spanIDRe:      fieldPairRe(spanIDFields),
+	}
+}
+
+// fieldPairRe matches a key=value, key: value or "key":"value" pair for any
+// of the fields and captures the value.
+func fieldPairRe(fields []string) *regexp.Regexp {
+	quoted := make([]string, len(fields))
+	for i, f := range fields {
+		quoted[i] = regexp.QuoteMeta(f)
+	}
+	return regexp.MustCompile(`(?:^|[\s{,;"'\[])"?(?:` + strings.Join(quoted, "|") + `)"?\s*[=:]\s*"?([0-9A-Za-z-]{8,64})`)
+}
+
+// Extract fills the trace metadata of the entry. Existing values are kept.
+func (t *TraceExtractor) Extract(entry *LogEntry) {
+	if entry.Metadata == nil {
+		entry.Metadata = make(map[string]string)
+	}
+	md := entry.Metadata
+	if md[traceIDKey] != "" && md[spanIDKey] != "" {
+		return
+	}
+
+	traceID := firstField(md, t.traceIDFields)
+	spanID := firstField(md, t.spanIDFields)
+	var flags string
+
+	if traceID == "" {
+		for _, candidate := range []string{md["traceparent"], entry.Text} {
+			if m := traceparentRe.FindStringSubmatch(candidate); m != nil && m[1] != "ff" {
+				traceID, flags = m[2], m[4]
+				if spanID == "" {
+					spanID = m[3]
+				}
+				break
+			}
+		}
+	}
+	if traceID == "" {
+		if m := t.traceIDRe.FindStringSubmatch(entry.Text); m != nil {
+			traceID = m[1]
+		}
+	}
+	if traceID == "" {
+		return
+	}
+	if spanID == "" {
+		if m := t.spanIDRe.FindStringSubmatch(entry.Text); m != nil {
+			spanID = m[1]
+		}
+	}
+
+	setDefault(md, traceIDKey, normalizeID(traceID))
+	setDefault(md, spanIDKey, normalizeID(spanID))
+	setDefault(md, traceFlagsKey, flags)
+}
+
+func firstField(md map[string]string, fields []string) string {
+	for _, f := range fields {
+		if v := strings.TrimSpace(md[f]); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+func setDefault(md map[string]string, key, value string) {
+	if value != "" && md[key] == "" {
+		md[key] = value
+	}
+}
+
+// normalizeID lowercases hexadecimal ids and strips the dashes of UUID
+// formatted ones, the way tracing backends store them.
+func normalizeID(id string) string {
+	return strings.ToLower(strings.ReplaceAll(id, "-", ""))
+}
+
+// traceExtractors returns the extractor of each log source. Sources without
+// options share the default extractor.
+func traceExtractors(cfg *collection.CollectionConfig) (map[string]*TraceExtractor, *TraceExtractor) {
+	defaults := NewTraceExtractor(nil, nil)
+	extractors := make(map[string]*TraceExtractor)
+	if cfg == nil {
+		return extractors, defaults
+	}
+	for _, src := range cfg.LogSources {
+		traceFields := splitOption(src.Options[traceIDFieldsOption])
+		spanFields := splitOption(src.Options[spanIDFieldsOption])
+		if len(traceFields) > 0 || len(spanFields) > 0 {
+			extractors[src.Name] = NewTraceExtractor(traceFields, spanFields)
+		}
+	}
+	return extractors, defaults
+}
+
+func splitOption(raw string) []string {
+	var values []string
+	for _, v := range strings.Split(raw, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
@@ -0,0 +1,90 @@
+package logs
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"agent/internal/collection"
+)
+
+func TestTraceExtractor(t *testing.T) {
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	const spanID = "00f067aa0ba902b7"
+
+	tests := []struct {
+		name     string
+		entry    LogEntry
+		expected map[string]string
+	}{
+		{
+			name:     "structured fields",
+			entry:    LogEntry{Text: "request served", Metadata: map[string]string{"traceId": traceID, "spanId": spanID}},
+			expected: map[string]string{"trace_id": traceID, "span_id": spanID},
+		},
+		{
+			name:     "traceparent in message",
+			entry:    LogEntry{Text: "GET /api traceparent=00-" + traceID + "-" + spanID + "-01 200"},
+			expected: map[string]string{"trace_id": traceID, "span_id": spanID, "trace_flags": "01"},
+		},
+		{
+			name:     "traceparent field",
+			entry:    LogEntry{Metadata: map[string]string{"traceparent": "00-" + traceID + "-" + spanID + "-00"}},
+			expected: map[string]string{"trace_id": traceID, "span_id": spanID, "trace_flags": "00"},
+		},
+		{
+			name:     "key value pairs in message",
+			entry:    LogEntry{Text: `level=info trace_id=4BF92F3577B34DA6A3CE929D0E0E4736 span_id=00f067aa0ba902b7 msg="done"`},
+			expected: map[string]string{"trace_id": traceID, "span_id": spanID},
+		},
+		{
+			name:     "json message",
+			entry:    LogEntry{Text: `{"msg":"done","trace_id":"` + traceID + `"}`},
+			expected: map[string]string{"trace_id": traceID},
+		},
+		{
+			name:     "no trace context",
+			entry:    LogEntry{Text: "user_id=12345678 logged in"},
+			expected: map[string]string{},
+		},
+		{
+			name:     "existing values are kept",
+			entry:    LogEntry{Text: "trace_id=" + traceID, Metadata: map[string]string{"trace_id": "abc", "span_id": "def"}},
+			expected: map[string]string{"trace_id": "abc", "span_id": "def"},
+		},
+	}
+
+	extractor := NewTraceExtractor(nil, nil)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entry := tt.entry
+			extractor.Extract(&entry)
+			for k, v := range tt.expected {
+				assert.Equal(t, v, entry.Metadata[k], k)
+			}
+			if len(tt.expected) == 0 {
+				assert.NotContains(t, entry.Metadata, "trace_id")
+			}
+		})
+	}
+}
+
+func TestTraceExtractorsFromConfig(t *testing.T) {
+	cfg := &collection.CollectionConfig{LogSources: []collection.LogSource{
+		{Name: "socket", Options: map[string]string{"trace_id_fields": "x-request-trace, tid"}},
+		{Name: "nginx"},
+	}}
+	extractors, defaults := traceExtractors(cfg)
+	assert.NotNil(t, defaults)
+	assert.NotContains(t, extractors, "nginx")
+	assert.Contains(t, extractors, "socket")
+
+	entry := LogEntry{Text: "tid=0123456789abcdef0123456789abcdef handled"}
+	extractors["socket"].Extract(&entry)
+	assert.Equal(t, "0123456789abcdef0123456789abcdef", entry.Metadata["trace_id"])
+
+	// The default fields are replaced
+	entry = LogEntry{Text: "trace_id=0123456789abcdef0123456789abcdef"}
+	extractors["socket"].Extract(&entry)
+	assert.NotContains(t, entry.Metadata, "trace_id")
+}
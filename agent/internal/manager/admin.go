@@ -0,0 +1,136 @@
+package manager
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"agent/internal/admin"
+	"agent/internal/exporter"
+	"agent/internal/logger"
+	"agent/internal/transport"
+)
+
+// drainHold is how long a drained agent waits for the command that follows,
+// usually a restart once an update is applied, before collecting again
+const drainHold = 5 * time.Minute
+
+// offerTo returns a function forwarding an event to Run, which gives up when
+// Run is returning
+func offerTo(ctrl chan<- ControlEvent, stopped <-chan struct{}) func(ControlEvent) bool {
+	return func(evt ControlEvent) bool {
+		select {
+		case ctrl <- evt:
+			return true
+		case <-stopped:
+			return false
+		}
+	}
+}
+
+// serveAdmin listens on the admin socket and forwards the commands to Run as
+// control events, until stopped is closed. A reloaded config is applied by
+// Run before the services start again.
+func (a *Agent) serveAdmin(offer func(ControlEvent) bool, reload *configReload, stopped <-chan struct{}) *admin.Server {
+	srv, err := admin.Listen(func(ctx context.Context, req admin.Request) admin.Response {
+		switch req.Command {
+		case admin.Reload:
+			return reload.apply("cli")
+		case admin.Drain:
+			// Drop the report of a previous drain the client gave up on
+			select {
+			case <-a.drainedCh:
+			default:
+			}
+			if !offer(Drain) {
+				return admin.Response{Error: "agent stopping"}
+			}
+			select {
+			case backlog := <-a.drainedCh:
+				return admin.Response{OK: true, BacklogBytes: backlog}
+			case <-ctx.Done():
+				return admin.Response{Error: "drain cancelled"}
+			case <-stopped:
+				return admin.Response{Error: "agent stopping"}
+			}
+		case admin.Resume:
+			// Nothing to resume unless drained
+			if a.isDrained.Load() && !offer(Resume) {
+				return admin.Response{Error: "agent stopping"}
+			}
+			return admin.Response{OK: true}
+		case admin.Restart:
+			if !offer(Restart) {
+				return admin.Response{Error: "agent stopping"}
+			}
+			return admin.Response{OK: true}
+		case admin.Status:
+			return admin.Response{OK: true, Pipelines: exporter.Pipelines()}
+		default:
+			return admin.Response{Error: fmt.Sprintf("unknown command %q", req.Command)}
+		}
+	})
+	if err != nil {
+		logger.Log.Warn("admin socket unavailable, the CLI can't coordinate with the agent", "error", err)
+		return nil
+	}
+	return srv
+}
+
+// drain waits, with the services stopped, for the command following a Drain.
+// It returns whether the agent must exit, with ErrRestart for a restart.
+func (a *Agent) drain(ctrl <-chan ControlEvent) (exit bool, err error) {
+	a.isDrained.Store(true)
+	defer a.isDrained.Store(false)
+
+	timer := time.NewTimer(drainHold)
+	defer timer.Stop()
+	for {
+		a.reportDrained()
+		evt, received := nextEvent(timer.C, ctrl)
+		if !received {
+			logger.Log.Info("No command received after drain, resuming collection")
+			return false, nil
+		}
+		switch evt {
+		case Drain:
+			continue
+		case Shutdown:
+			logger.Log.Info("Shutdown received while drained.")
+			return true, nil
+		case Restart:
+			logger.Log.Info("Restart received while drained.")
+			return true, ErrRestart
+		default:
+			logger.Log.Info("Resuming collection after drain")
+			return false, nil
+		}
+	}
+}
+
+// reportDrained answers a Drain with the size of the spool left, which the
+// backend didn't accept
+func (a *Agent) reportDrained() {
+	backlog, err := exporter.SpoolBacklog()
+	if err != nil {
+		logger.Log.Warn("failed to measure the spool backlog", "error", err)
+	}
+	logger.Log.Info("Agent drained", "backlog_bytes", backlog)
+	select {
+	case a.drainedCh <- backlog:
+	default:
+	}
+}
+
+// applyPendingConfig replaces the config by the one saved with the CLI, if
+// any. It's called while the services are stopped.
+func (a *Agent) applyPendingConfig() {
+	cfg := a.pendingConfig.Swap(nil)
+	if cfg == nil {
+		return
+	}
+	cfg.HostID = a.config.HostID
+	a.config = cfg
+	transport.Configure(cfg.Network)
+	logger.Log.Info("Config reloaded")
+}
@@ -2,22 +2,32 @@ package manager
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"io"
 	"os"
-	"os/signal"
+	"strconv"
 	"sync"
-	"syscall"
+	"sync/atomic"
 	"time"
 
 	"agent/internal/api"
 	"agent/internal/authguard"
+	"agent/internal/collection"
 	"agent/internal/common"
 	"agent/internal/config"
 	"agent/internal/exporter"
+	"agent/internal/hostinfo"
 	"agent/internal/logger"
 	"agent/internal/logs"
 	logsRegistry "agent/internal/logs/registry"
 	"agent/internal/metrics"
 	metricsRegistry "agent/internal/metrics/registry"
+	"agent/internal/metrics/status"
+	"agent/internal/otlp"
+	"agent/internal/selfstats"
+	"agent/internal/tags"
+	"agent/internal/transport"
 )
 
 type ControlEvent int
@@ -27,40 +37,120 @@ const (
 	Reload
 	Restart
 	Hibernate
+	// Drain stops the services until Resume, Restart or Shutdown
+	Drain
+	Resume
 )
 
+// defaultCollectionInterval is the metrics collection interval outside of the
+// dry runs
+const defaultCollectionInterval = 60 * time.Second
+
+// hibernating is 1 while the agent hibernates because of a rejected key
+var hibernating = selfstats.NewGauge("agent_hibernating", nil)
+
+// ErrRestart is returned by Run when the agent stopped to be restarted by the
+// service manager.
+var ErrRestart = errors.New("agent stopped for restart")
+
 type Agent struct {
 	config     *config.Config
 	client     *api.Client
 	exporter   *exporter.Exporter
+	receiver   *otlp.Receiver
+	discovery  *Discovery
 	reloadCh   chan bool
 	restartCh  chan bool
 	shutdownCh chan bool
-	wg         *sync.WaitGroup
+	stopOnce   sync.Once
+	// done is closed when Run returns
+	done chan struct{}
+	wg   *sync.WaitGroup
+
+	dryRun         bool
+	dryRunDuration time.Duration
+	dryRunInterval time.Duration
+	dryRunFormat   string
+	// dryRunPrinter prints the table, summary and estimate dry run outputs
+	dryRunPrinter *dryRunPrinter
+	collectors    []string
+	sinks         []exporter.Sink
+	// skipHostInfo and skipDiscovery turn off the phases of the discovery
+	skipHostInfo  bool
+	skipDiscovery bool
+	// hostInfo is gathered before the start, nil to gather it on the first
+	// discovery
+	hostInfo *hostinfo.HostInfo
+
+	// events exports the events of the agent itself
+	events eventQueue
+
+	// drainedCh receives the spool backlog once drained, isDrained is true
+	// until the services start again
+	drainedCh chan int64
+	isDrained atomic.Bool
+	// pendingConfig is the config saved with the CLI or edited locally,
+	// applied on reload
+	pendingConfig atomic.Pointer[config.Config]
+
+	// snapshotHash is the hash of the last configuration snapshot sent
+	snapshotHash string
 }
 
-func NewAgent(cfg *config.Config) *Agent {
-	return &Agent{
-		config:     cfg,
-		reloadCh:   make(chan bool, 1),
-		restartCh:  make(chan bool, 1),
-		shutdownCh: make(chan bool, 1),
-		wg:         &sync.WaitGroup{},
+// New creates an agent. It's run once with Run.
+func New(opts ...Option) *Agent {
+	a := &Agent{
+		config:         &config.Config{},
+		reloadCh:       make(chan bool, 1),
+		restartCh:      make(chan bool, 1),
+		shutdownCh:     make(chan bool, 1),
+		done:           make(chan struct{}),
+		drainedCh:      make(chan int64, 1),
+		wg:             &sync.WaitGroup{},
+		dryRunDuration: defaultDryRunDuration,
+		dryRunInterval: defaultDryRunInterval,
+		dryRunFormat:   DryRunJSON,
+	}
+	for _, opt := range opts {
+		opt(a)
 	}
+	return a
 }
 
-func (a *Agent) Run(dryRun bool) {
+// Run starts the services and runs until ctx is done or the agent is stopped.
+// It returns nil on shutdown, ErrRestart when a restart was requested, or the
+// error that prevented the services from starting. The caller owns the
+// process lock and handles the OS signals.
+func (a *Agent) Run(ctx context.Context) error {
+	defer close(a.done)
+
+	dryRun := a.dryRun
+	if dryRun && a.dryRunFormat != DryRunJSON {
+		a.dryRunPrinter = newDryRunPrinter(os.Stdout, a.dryRunFormat)
+		switch a.dryRunFormat {
+		case DryRunSummary:
+			defer a.dryRunPrinter.printSummary()
+		case DryRunEstimate:
+			defer a.dryRunPrinter.printEstimate()
+		}
+	}
 	ctrl := make(chan ControlEvent, 1)
+	// send forwards an event unless Run already returned
+	send := func(evt ControlEvent) {
+		select {
+		case ctrl <- evt:
+		case <-a.done:
+		}
+	}
 
-	// OS signals -> Shutdown event
+	// Context done -> Shutdown event
 	go func() {
-		s := make(chan os.Signal, 1)
-		signal.Notify(s, syscall.SIGINT, syscall.SIGTERM)
 		select {
-		case <-s:
-			ctrl <- Shutdown
+		case <-ctx.Done():
+			send(Shutdown)
 		case <-a.shutdownCh:
-			ctrl <- Shutdown
+			send(Shutdown)
+		case <-a.done:
 		}
 	}()
 
@@ -70,8 +160,10 @@ func (a *Agent) Run(dryRun bool) {
 			select {
 			case <-a.shutdownCh:
 				return
+			case <-a.done:
+				return
 			case <-a.reloadCh:
-				ctrl <- Reload
+				send(Reload)
 			}
 		}
 	}()
@@ -82,12 +174,44 @@ func (a *Agent) Run(dryRun bool) {
 			select {
 			case <-a.shutdownCh:
 				return
+			case <-a.done:
+				return
 			case <-a.restartCh:
-				ctrl <- Restart
+				send(Restart)
 			}
 		}
 	}()
 
+	// Admin commands and config file edits -> Drain, Resume, Reload and
+	// Restart events. The binary check and the debug endpoint run alongside.
+	if !dryRun {
+		stopped := make(chan struct{})
+		offer := offerTo(ctrl, stopped)
+		reload := a.newConfigReload(offer)
+		if srv := a.serveAdmin(offer, reload, stopped); srv != nil {
+			defer srv.Close()
+		}
+		// Joined before Run returns, after stopped is closed
+		var watchers sync.WaitGroup
+		defer watchers.Wait()
+		watchers.Add(3)
+		go func() {
+			defer watchers.Done()
+			a.watchConfigFile(reload, stopped)
+		}()
+		// The binary is checked while hibernating too
+		go func() {
+			defer watchers.Done()
+			a.watchIntegrity(stopped)
+		}()
+		debugAddress, toggles := a.config.DebugAddress, debugToggles()
+		go func() {
+			defer watchers.Done()
+			serveDebug(debugAddress, toggles, stopped)
+		}()
+		defer close(stopped)
+	}
+
 	// Key check -> Hibernate event
 	keyCheckCh := make(chan bool, 1)
 	authguard.Get().Subscribe(keyCheckCh)
@@ -96,88 +220,162 @@ func (a *Agent) Run(dryRun bool) {
 			select {
 			case <-a.shutdownCh:
 				return
+			case <-a.done:
+				return
 			case <-keyCheckCh:
-				valid, _ := a.client.CheckAPIKeyValidity()
-				if !valid {
-					ctrl <- Hibernate
+				a.events.emit("auth_errors_threshold", "Too many authentication errors, checking the API key", nil)
+				// Only hibernate when the backend rejects the key, not when
+				// it can't be reached
+				if valid, err := a.client.CheckAPIKeyValidity(); err == nil && !valid {
+					send(Hibernate)
+				} else {
+					authguard.Get().Resume()
 				}
 			}
 		}
 	}()
 
 	// Initialize client
+	transport.Configure(a.config.Network)
 	a.client = api.NewClient(*a.config, dryRun)
+	a.discovery = NewDiscovery(a.client, a.wg, a.config)
+	a.discovery.skipHostInfo = a.skipHostInfo
+	a.discovery.hostInfo = a.hostInfo
+	a.discovery.skipAvailable = a.skipDiscovery
+	if !dryRun {
+		a.discovery.persistRegistration(false)
+	}
 
-	// Initial key validation
+	// Resume the hibernation of a previous run, so that restarts don't
+	// hammer the API with a rejected key
+	if loadHibernation().active() {
+		logger.Log.Info("Resuming hibernation")
+		if exit, err := a.hibernate(ctrl); exit {
+			return err
+		}
+	}
+
+	// Initial key validation. When the backend can't be reached, e.g. during
+	// an outage or before the network is up at boot, start anyway in grace
+	// mode and check again in the background.
 	valid, err := a.client.CheckAPIKeyValidity()
-	if !valid || err != nil {
-		logger.Log.Error("failed to check API key validity", "error", err)
-		os.Exit(1)
+	switch {
+	case err != nil:
+		logger.Log.Warn("failed to check API key validity, starting in grace mode", "error", err)
+		go a.verifyKeyInGrace(send)
+	case !valid:
+		logger.Log.Error("API key rejected")
+		if exit, err := a.hibernate(ctrl); exit {
+			return err
+		}
 	}
 
 	for {
-		// Create a context to signal when exit
-		var ctx context.Context
+		// Create a context to signal the services when to exit. It's not
+		// derived from ctx, which is handled as a Shutdown event.
+		var servicesCtx context.Context
 		var cancel context.CancelFunc
 		if dryRun {
 			logger.Log.Info("Running in dry-run mode. Output will be logged to stdout.")
-			ctx, cancel = context.WithTimeout(context.Background(), 20*time.Second)
+			servicesCtx, cancel = context.WithTimeout(context.Background(), a.dryRunDuration)
 		} else {
-			ctx, cancel = context.WithCancel(context.Background())
+			servicesCtx, cancel = context.WithCancel(context.Background())
 		}
 
-		a.startServices(ctx, dryRun)
+		a.applyPendingConfig()
+		if err := a.startServices(servicesCtx, dryRun); err != nil {
+			a.stopServices(cancel)
+			return err
+		}
 
 		select {
 		case evt := <-ctrl:
 			switch evt {
 			case Shutdown:
 				a.stopServices(cancel)
-				common.ReleaseLock()
 				logger.Log.Info("Collectors stopped. Exiting.")
-				return
+				return nil
 			case Restart:
 				a.stopServices(cancel)
-				common.ReleaseLock()
-				logger.Log.Info("Agent stopped for restart. Automatic restart will only happen if running under systemd.")
-				os.Exit(1)
-			case Reload:
+				return ErrRestart
+			case Reload, Resume:
 				a.stopServices(cancel)
 				logger.Log.Info("Reloading collectors")
 				continue
+			case Drain:
+				a.stopServices(cancel)
+				if exit, err := a.drain(ctrl); exit {
+					return err
+				}
+				continue
 			case Hibernate:
 				a.stopServices(cancel)
-				if a.hibernate(ctrl) {
-					return
+				if exit, err := a.hibernate(ctrl); exit {
+					return err
 				}
 				continue
 			}
-		case <-ctx.Done():
+		case <-servicesCtx.Done():
 			if dryRun {
 				a.stopServices(cancel)
-				common.ReleaseLock()
 				logger.Log.Info("Dry run finished. Exiting agent.")
-				return
+				return nil
 			}
 		}
 	}
 }
 
+// Stop asks the agent to shut down without waiting for it. It can be called
+// more than once.
 func (a *Agent) Stop() {
-	close(a.shutdownCh)
+	a.stopOnce.Do(func() { close(a.shutdownCh) })
+}
+
+// Shutdown stops the agent and waits until Run returned, the services being
+// stopped and the exporter flushed, or until ctx is done.
+func (a *Agent) Shutdown(ctx context.Context) error {
+	a.Stop()
+	select {
+	case <-a.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
 
-func (a *Agent) startServices(ctx context.Context, dryRun bool) {
+// startServices starts the collection. On error, the services already started
+// are left running until stopServices is called.
+func (a *Agent) startServices(ctx context.Context, dryRun bool) error {
 	// Start config watcher
 	clcCfg, err := a.client.GetCollectionConfig()
 	if err != nil {
-		logger.Log.Error("exiting due to error when fetching config", "error", err)
-		os.Exit(1)
+		if !api.IsTransient(err) {
+			return fmt.Errorf("failed to fetch collection config: %w", err)
+		}
+		cached, cacheErr := loadCollectionConfig()
+		if cached == nil {
+			// E.g. the first start after an upgrade, before any config was
+			// cached. Start with an empty config, the config watcher reloads
+			// with the real one once the API is back.
+			logger.Log.Warn("failed to fetch collection config and none cached, starting with an empty one",
+				"error", errors.Join(err, cacheErr))
+			cached = &collection.CollectionConfig{}
+		} else {
+			logger.Log.Warn("failed to fetch collection config, using the cached one", "error", err)
+		}
+		clcCfg = cached
+	} else if clcCfg != nil {
+		saveCollectionConfig(clcCfg)
+	}
+	if !dryRun {
+		loadSavedPatterns()
+		syncPatterns(a.client, clcCfg)
 	}
 	if !dryRun && clcCfg != nil {
-		a.wg.Add(1)
 		configWatcher := NewConfigWatcher(a.client, a.reloadCh, a.wg)
-		configWatcher.Start(ctx, clcCfg)
+		if err := configWatcher.Start(ctx, clcCfg); err != nil {
+			return err
+		}
 	}
 
 	// Start restart watcher
@@ -185,53 +383,214 @@ func (a *Agent) startServices(ctx context.Context, dryRun bool) {
 	restartWatcher := NewRestartWatcher(a.restartCh, a.wg)
 	restartWatcher.Start(ctx)
 
-	// Start discovery loop
-	a.wg.Add(1)
-	discovery := NewDiscovery(a.client, a.wg)
-	discovery.Start(ctx)
+	// Start discovery loop, which also reports what changed since the last
+	// run on every reload
+	if !a.skipHostInfo || !a.skipDiscovery {
+		a.wg.Add(1)
+		a.discovery.Start(ctx)
+	}
 
-	a.exporter, err = exporter.NewExporter(a.config, dryRun)
+	exportSettings := exporter.DefaultSettings()
+	if clcCfg != nil {
+		exportSettings = exporter.SettingsFromCollection(clcCfg.Export)
+	}
+	if !dryRun {
+		exportSettings = exportSettings.Negotiate(a.negotiate())
+	}
+	if a.dryRunPrinter != nil {
+		exportSettings.DryRunOutput = io.Discard
+	}
+	a.exporter, err = exporter.NewExporter(a.config, exportSettings, dryRun)
 	if err != nil {
-		logger.Log.Error("cannot initialize exporter", "error", err)
-		os.Exit(1)
+		return fmt.Errorf("cannot initialize exporter: %w", err)
+	}
+	hostTags := tags.Collect(a.config)
+	logger.Log.Info("Host tags resolved", "count", len(hostTags))
+	a.exporter.SetHostTags(hostTags)
+	for _, sink := range a.sinks {
+		a.exporter.AddSink(sink)
+	}
+	a.events.attach(a.exporter)
+	if a.dryRunPrinter != nil {
+		a.exporter.AddSink(a.dryRunPrinter)
+	}
+
+	if a.config.OTLPReceiver.Enabled {
+		a.receiver = otlp.NewReceiver(a.config.OTLPReceiver, a.exporter)
+		if err := a.receiver.Start(); err != nil {
+			logger.Log.Error("failed to start OTLP receiver", "error", err)
+			a.receiver = nil
+		}
 	}
 
-	logsCollectors := logsRegistry.BuildCollectors(clcCfg)
+	configHash := ""
+	if clcCfg != nil {
+		configHash, _ = clcCfg.Hash()
+	}
+	status.SetConfigHash(configHash)
+
+	logsCollectors := keepCollectors(logsRegistry.BuildCollectors(clcCfg), a.collectors)
+	selfstats.NewGauge("agent_collectors_active", map[string]string{"type": "logs"}).Set(float64(len(logsCollectors)))
 	logger.Log.Info("Starting log collectors", "count", len(logsCollectors))
 	a.wg.Add(1)
-	go logs.StartCollection(logsCollectors, ctx, a.wg, a.exporter)
+	go logs.StartCollection(logsCollectors, clcCfg, ctx, a.wg, a.exporter)
 
-	metricsCollectors := metricsRegistry.BuildCollectors(clcCfg)
-	collectionInterval := 60 * time.Second
+	metricsCollectors := keepCollectors(metricsRegistry.BuildCollectors(clcCfg, a.config), a.collectors)
+	if dryRun && clcCfg == nil {
+		// Without collection config nothing is selected, collect everything
+		// available instead
+		for _, c := range metricsCollectors {
+			if discovered, err := c.Discover(); err == nil {
+				c.SetIncludedMetrics(discovered)
+			}
+		}
+	}
+	collectionInterval := defaultCollectionInterval
+	var collectionOffset time.Duration
 	if dryRun {
-		collectionInterval = 3 * time.Second
+		collectionInterval = a.dryRunInterval
+	} else if !a.config.DisableScheduleOffsets {
+		collectionOffset = common.PhaseOffset(a.config.HostID, collectionInterval)
 	}
-	logger.Log.Info("Starting metric collectors", "count", len(metricsCollectors))
+	logger.Log.Info("Starting metric collectors", "count", len(metricsCollectors), "offset", collectionOffset)
+	selfstats.NewGauge("agent_collectors_active", map[string]string{"type": "metrics"}).Set(float64(len(metricsCollectors)))
 	a.wg.Add(1)
-	go metrics.StartCollection(metricsCollectors, collectionInterval, ctx, a.wg, a.exporter)
+	deriver, err := metrics.NewDeriver(a.config.DerivedMetrics)
+	if err != nil {
+		logger.Log.Error("ignoring invalid derived metrics", "error", err)
+	}
+	transformer, err := metrics.NewTransformer(a.config.MetricTransforms)
+	if err != nil {
+		logger.Log.Error("ignoring invalid metric transforms", "error", err)
+	}
+	sampler := metrics.NewAdaptiveSampler(a.config.AdaptiveCollection, collectionInterval)
+	fastPath := metrics.NewFastPath(a.config.FastPath, collectionInterval)
+	go metrics.StartCollection(metricsCollectors, collectionInterval, collectionOffset, deriver, transformer, sampler, fastPath, ctx, a.wg, a.exporter)
+
+	if a.config.ShareConfigSnapshot {
+		a.shareConfigSnapshot(buildConfigSnapshot(a.config, clcCfg, metricsCollectors, logsCollectors))
+	}
+	return nil
+}
+
+// shareConfigSnapshot sends the configuration snapshot to the backend unless
+// it's the same as the last one sent.
+func (a *Agent) shareConfigSnapshot(snapshot api.ConfigSnapshot) {
+	hash, err := snapshotHash(snapshot)
+	if err != nil {
+		logger.Log.Error("failed to hash config snapshot", "error", err)
+		return
+	}
+	if hash == a.snapshotHash {
+		return
+	}
+	if err := a.client.PostConfigSnapshot(snapshot); err != nil {
+		logger.Log.Error("failed to send config snapshot to backend", "error", err)
+		return
+	}
+	a.snapshotHash = hash
+	logger.Log.Info("Config snapshot sent to backend")
 }
 
-func (a *Agent) hibernate(ctrl <-chan ControlEvent) (exit bool) {
-	logger.Log.Warn("Hibernating for 1h")
-	timer := time.NewTimer(1 * time.Hour)
+// hibernate waits until the API key is accepted again or a control event is
+// received. The hibernation is persisted, an hour at first then twice as long
+// every time the key is still rejected. It returns whether the agent must
+// exit, with ErrRestart for a restart.
+func (a *Agent) hibernate(ctrl <-chan ControlEvent) (exit bool, err error) {
+	authguard.Get().Suspend()
+	hibernating.Set(1)
+	state := loadHibernation()
+	if !state.active() {
+		state = a.nextHibernation(state)
+	}
 
+	for {
+		remaining := time.Until(state.Until)
+		logger.Log.Warn("Hibernating", "duration", remaining.Round(time.Second), "consecutive", state.Count)
+		timer := time.NewTimer(remaining)
+
+		evt, received := nextEvent(timer.C, ctrl)
+		if !received {
+			valid, err := a.client.CheckAPIKeyValidity()
+			if err != nil {
+				// Resume, the key is checked again if the backend rejects it
+				logger.Log.Warn("failed to check API key after hibernation, resuming", "error", err)
+				a.endHibernation("key_check_failed")
+				return false, nil
+			}
+			if valid {
+				logger.Log.Info("Hibernation finished.")
+				clearHibernation()
+				a.endHibernation("key_accepted")
+				return false, nil
+			}
+			logger.Log.Warn("API key still rejected after hibernation")
+			state = a.nextHibernation(state)
+			continue
+		}
+		timer.Stop()
+		switch evt {
+		case Shutdown:
+			logger.Log.Info("Shutdown received during hibernation.")
+			return true, nil
+		case Restart:
+			logger.Log.Info("Restart received during hibernation.")
+			return true, ErrRestart
+		case Drain:
+			// Nothing is running
+			a.reportDrained()
+			continue
+		case Resume:
+			continue
+		default:
+			// The reload may come with a new key, resume only once it's accepted
+			logger.Log.Info("Reload received during hibernation, checking the API key.")
+			valid, err := a.client.CheckAPIKeyValidity()
+			if err != nil {
+				logger.Log.Warn("failed to check API key on reload, still hibernating", "error", err)
+				continue
+			}
+			if !valid {
+				logger.Log.Warn("API key still rejected after reload, still hibernating")
+				continue
+			}
+			clearHibernation()
+			a.endHibernation("reload")
+			return false, nil
+		}
+	}
+}
+
+// nextHibernation starts and persists the hibernation period following state
+func (a *Agent) nextHibernation(state hibernationState) hibernationState {
+	state = state.next()
+	if err := saveHibernation(state); err != nil {
+		logger.Log.Warn("hibernation won't survive a restart", "error", err)
+	}
+	a.events.emit("hibernation_started", "API key rejected, hibernating", map[string]string{
+		"until":       state.Until.UTC().Format(time.RFC3339),
+		"consecutive": strconv.Itoa(state.Count),
+	})
+	return state
+}
+
+// endHibernation resumes exports once the agent stops hibernating
+func (a *Agent) endHibernation(reason string) {
+	hibernating.Set(0)
+	authguard.Get().Resume()
+	a.events.emit("hibernation_ended", "Hibernation ended", map[string]string{"reason": reason})
+}
+
+// nextEvent waits for the timer or a control event other than Hibernate. It
+// returns whether an event was received.
+func nextEvent(timer <-chan time.Time, ctrl <-chan ControlEvent) (ControlEvent, bool) {
 	for {
 		select {
-		case <-timer.C:
-			logger.Log.Info("Hibernation finished.")
-			return false
+		case <-timer:
+			return 0, false
 		case evt := <-ctrl:
-			timer.Stop()
-			switch evt {
-			case Shutdown:
-				logger.Log.Info("Shutdown received during hibernation.")
-				return true
-			case Restart:
-				logger.Log.Info("Restart received during hibernation.")
-				os.Exit(1)
-			case Reload:
-				logger.Log.Info("Reload received during hibernation.")
-				return false
+			if evt != Hibernate {
+				return evt, true
 			}
 		}
 	}
@@ -240,5 +599,13 @@ func (a *Agent) hibernate(ctrl <-chan ControlEvent) (exit bool) {
 func (a *Agent) stopServices(cancel context.CancelFunc) {
 	cancel()
 	a.wg.Wait()
-	a.exporter.Close()
+	if a.receiver != nil {
+		a.receiver.Stop()
+		a.receiver = nil
+	}
+	if a.exporter != nil {
+		a.events.detach()
+		a.exporter.Close()
+		a.exporter = nil
+	}
 }
@@ -0,0 +1,272 @@
+package manager
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"agent/internal/admin"
+	"agent/internal/collection"
+	"agent/internal/common"
+	"agent/internal/config"
+	"agent/internal/exporter"
+)
+
+func TestAgentRunReturnsStartupErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/check-key/" {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	// Failing to fetch the collection config stops the agent instead of
+	// exiting the process
+	agent := New(WithConfig(&config.Config{APIUrl: server.URL, APIKey: "test-key"}))
+	err := agent.Run(context.Background())
+	assert.ErrorContains(t, err, "failed to fetch collection config")
+	assert.NoError(t, agent.Shutdown(context.Background()))
+}
+
+func TestAgentShutdownTimeout(t *testing.T) {
+	agent := New()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	// Never started, so never done
+	assert.ErrorIs(t, agent.Shutdown(ctx), context.DeadlineExceeded)
+	// Stopping twice is fine
+	agent.Stop()
+}
+
+type recordingSink struct {
+	mu      sync.Mutex
+	metrics []exporter.MetricPayload
+}
+
+func (s *recordingSink) WriteMetrics(metrics []exporter.MetricPayload) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.metrics = append(s.metrics, metrics...)
+}
+
+func (s *recordingSink) WriteLogs([]exporter.LogPayload) {}
+
+func (s *recordingSink) count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.metrics)
+}
+
+func TestAgentRunEmbedded(t *testing.T) {
+	sink := &recordingSink{}
+	agent := New(
+		WithDryRun(true),
+		WithDataDir(t.TempDir()),
+		WithCollectors("status"),
+		WithSink(sink),
+	)
+	t.Cleanup(func() { common.SetProgramDirectory("") })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errCh := make(chan error, 1)
+	go func() { errCh <- agent.Run(ctx) }()
+
+	require.Eventually(t, func() bool { return sink.count() > 0 }, 15*time.Second, 100*time.Millisecond)
+	// Without collection config, only the status collector reports
+	sink.mu.Lock()
+	assert.Equal(t, "heartbeat", sink.metrics[0].Name)
+	sink.mu.Unlock()
+
+	cancel()
+	select {
+	case err := <-errCh:
+		assert.NoError(t, err)
+	case <-time.After(10 * time.Second):
+		t.Fatal("agent didn't stop")
+	}
+}
+
+func TestAgentRunUsesCachedConfigWhenUnreachable(t *testing.T) {
+	common.SetProgramDirectory(t.TempDir())
+	t.Cleanup(func() { common.SetProgramDirectory("") })
+	saveCollectionConfig(&collection.CollectionConfig{})
+
+	// Neither the key check nor the config fetch succeed, the agent starts in
+	// grace mode with the cached config
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	agent := New(WithConfig(&config.Config{APIUrl: server.URL, APIKey: "test-key"}))
+	errCh := make(chan error, 1)
+	go func() { errCh <- agent.Run(context.Background()) }()
+
+	select {
+	case err := <-errCh:
+		t.Fatalf("agent stopped: %v", err)
+	case <-time.After(200 * time.Millisecond):
+	}
+	require.NoError(t, agent.Shutdown(context.Background()))
+	assert.NoError(t, <-errCh)
+}
+
+func TestAgentRunWithoutCachedConfigWhenUnreachable(t *testing.T) {
+	common.SetProgramDirectory(t.TempDir())
+	t.Cleanup(func() { common.SetProgramDirectory("") })
+
+	// Nothing cached yet, e.g. right after an upgrade: the agent starts with
+	// an empty config instead of exiting
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	agent := New(WithConfig(&config.Config{APIUrl: server.URL, APIKey: "test-key"}))
+	errCh := make(chan error, 1)
+	go func() { errCh <- agent.Run(context.Background()) }()
+
+	select {
+	case err := <-errCh:
+		t.Fatalf("agent stopped: %v", err)
+	case <-time.After(200 * time.Millisecond):
+	}
+	require.NoError(t, agent.Shutdown(context.Background()))
+	assert.NoError(t, <-errCh)
+}
+
+func TestAgentDrainAndRestart(t *testing.T) {
+	common.SetProgramDirectory(t.TempDir())
+	t.Cleanup(func() { common.SetProgramDirectory("") })
+	saveCollectionConfig(&collection.CollectionConfig{})
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	agent := New(WithConfig(&config.Config{APIUrl: server.URL, APIKey: "test-key"}))
+	errCh := make(chan error, 1)
+	go func() { errCh <- agent.Run(context.Background()) }()
+
+	var resp admin.Response
+	require.Eventually(t, func() bool {
+		var err error
+		resp, err = admin.Send(admin.Request{Command: admin.Drain}, 10*time.Second)
+		return err == nil
+	}, 10*time.Second, 50*time.Millisecond)
+	assert.True(t, resp.OK)
+	assert.True(t, agent.isDrained.Load())
+
+	_, err := admin.Send(admin.Request{Command: admin.Restart}, time.Second)
+	require.NoError(t, err)
+	select {
+	case err := <-errCh:
+		assert.ErrorIs(t, err, ErrRestart)
+	case <-time.After(10 * time.Second):
+		t.Fatal("agent didn't restart")
+	}
+}
+
+func TestAgentReloadConfig(t *testing.T) {
+	common.SetProgramDirectory(t.TempDir())
+	t.Cleanup(func() { common.SetProgramDirectory("") })
+	// Only the reloads asked by the CLI are tested
+	configFileDebounce = time.Hour
+	t.Cleanup(func() { configFileDebounce = time.Second })
+	saveCollectionConfig(&collection.CollectionConfig{})
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	cfg := config.Config{APIUrl: server.URL, APIKey: "test-key"}
+	require.NoError(t, cfg.Save())
+	started := cfg
+	agent := New(WithConfig(&started))
+	errCh := make(chan error, 1)
+	go func() { errCh <- agent.Run(context.Background()) }()
+
+	// Tags are applied by a reload
+	cfg.SetTag("env", "prod")
+	require.NoError(t, cfg.Save())
+	var resp admin.Response
+	require.Eventually(t, func() bool {
+		var err error
+		resp, err = admin.Send(admin.Request{Command: admin.Reload}, 10*time.Second)
+		return err == nil
+	}, 10*time.Second, 50*time.Millisecond)
+	assert.False(t, resp.Restarting)
+
+	// A new API key needs a restart
+	cfg.SetAPIKey("new-key")
+	require.NoError(t, cfg.Save())
+	resp, err := admin.Send(admin.Request{Command: admin.Reload}, time.Second)
+	require.NoError(t, err)
+	assert.True(t, resp.Restarting)
+	select {
+	case err := <-errCh:
+		assert.ErrorIs(t, err, ErrRestart)
+	case <-time.After(10 * time.Second):
+		t.Fatal("agent didn't restart")
+	}
+	assert.Equal(t, map[string]string{"env": "prod"}, agent.config.Tags)
+}
+
+func TestAgentWatchesConfigFile(t *testing.T) {
+	dir := t.TempDir()
+	common.SetProgramDirectory(dir)
+	t.Cleanup(func() { common.SetProgramDirectory("") })
+	configFileDebounce = 50 * time.Millisecond
+	t.Cleanup(func() { configFileDebounce = time.Second })
+	saveCollectionConfig(&collection.CollectionConfig{})
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	cfg := config.Config{APIUrl: server.URL, APIKey: "test-key"}
+	require.NoError(t, cfg.Save())
+	started := cfg
+	agent := New(WithConfig(&started))
+	errCh := make(chan error, 1)
+	go func() { errCh <- agent.Run(context.Background()) }()
+	require.Eventually(t, func() bool {
+		_, err := admin.Send(admin.Request{Command: admin.Resume}, time.Second)
+		return err == nil
+	}, 10*time.Second, 50*time.Millisecond)
+
+	// Broken edits are rejected, the agent keeps running
+	path := filepath.Join(dir, config.ConfigFilename)
+	require.NoError(t, os.WriteFile(path, []byte(`{"api_key": `), 0o600))
+	cfg.SetAPIKey("")
+	require.NoError(t, cfg.Save())
+	select {
+	case err := <-errCh:
+		t.Fatalf("agent stopped on an invalid config: %v", err)
+	case <-time.After(500 * time.Millisecond):
+	}
+
+	// A new API key needs a restart
+	cfg.SetAPIKey("new-key")
+	require.NoError(t, cfg.Save())
+	select {
+	case err := <-errCh:
+		assert.ErrorIs(t, err, ErrRestart)
+	case <-time.After(10 * time.Second):
+		t.Fatal("agent didn't restart")
+	}
+}
@@ -0,0 +1,26 @@
+package manager
+
+import (
+	"agent/internal/api"
+	"agent/internal/logger"
+)
+
+// negotiate runs the handshake with the backend. The exports keep the agent
+// defaults when it fails or the backend predates it, nil is returned then.
+func (a *Agent) negotiate() *api.Capabilities {
+	caps, err := a.client.GetCapabilities()
+	if err != nil {
+		logger.Log.Warn("Capabilities handshake failed, using the export defaults", "error", err)
+		return nil
+	}
+	if caps == nil {
+		logger.Log.Debug("Backend doesn't support the capabilities handshake")
+		return nil
+	}
+	logger.Log.Info("Negotiated capabilities with the backend",
+		"api_version", caps.APIVersion,
+		"encodings", caps.Encodings,
+		"max_batch_size", caps.Limits.MaxBatchSize,
+	)
+	return caps
+}
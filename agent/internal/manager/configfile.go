@@ -0,0 +1,126 @@
+package manager
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+
+	"agent/internal/admin"
+	"agent/internal/common"
+	"agent/internal/config"
+	"agent/internal/logger"
+)
+
+// configFileDebounce is the quiet period after a change of the config file
+// before it's read, editors often write a file in several steps
+var configFileDebounce = time.Second
+
+// configReload applies the changes of the config file, whether the CLI asks
+// for it after saving or the file watcher notices a local edit. Each change
+// is applied once even when both report it.
+type configReload struct {
+	agent *Agent
+	offer func(ControlEvent) bool
+
+	mu sync.Mutex
+	// started is the config the agent started with, compared to tell whether
+	// a change needs a restart
+	started config.Config
+	// loaded is the config last applied
+	loaded     config.Config
+	restarting bool
+}
+
+func (a *Agent) newConfigReload(offer func(ControlEvent) bool) *configReload {
+	return &configReload{agent: a, offer: offer, started: *a.config, loaded: *a.config}
+}
+
+// apply reads the config file and forwards it to Run, as a reload or as a
+// restart when the change can't be applied by a reload. An invalid config is
+// rejected and the agent keeps running with the current one.
+func (r *configReload) apply(source string) admin.Response {
+	cfg, err := config.Load()
+	if err != nil {
+		logger.Log.Warn("Rejected config change", "source", source, "error", err)
+		return admin.Response{Error: fmt.Sprintf("failed to load config: %v", err)}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	changes := r.loaded.Diff(*cfg)
+	if len(changes) == 0 {
+		return admin.Response{OK: true, Restarting: r.restarting}
+	}
+	if err := cfg.Validate(); err != nil {
+		logger.Log.Warn("Rejected config change", "source", source, "error", err, "changes", changes)
+		return admin.Response{Error: err.Error()}
+	}
+
+	if r.started.RequiresRestart(cfg) {
+		if !r.offer(Restart) {
+			return admin.Response{Error: "agent stopping"}
+		}
+		logger.Log.Info("Config changed, restarting", "source", source, "changes", changes)
+		r.loaded = *cfg
+		r.restarting = true
+		return admin.Response{OK: true, Restarting: true}
+	}
+	r.agent.pendingConfig.Store(cfg)
+	if !r.offer(Reload) {
+		return admin.Response{Error: "agent stopping"}
+	}
+	logger.Log.Info("Config changed, reloading", "source", source, "changes", changes)
+	r.loaded = *cfg
+	return admin.Response{OK: true}
+}
+
+// watchConfigFile applies the local edits of the config file until stopped is
+// closed. The program directory is watched rather than the file, which is
+// replaced when saved by the CLI.
+func (a *Agent) watchConfigFile(reload *configReload, stopped <-chan struct{}) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		logger.Log.Warn("Could not watch the config file, local edits need a restart", "error", err)
+		return
+	}
+	defer watcher.Close()
+
+	programDirectory, err := common.GetProgramDirectory()
+	if err == nil {
+		err = watcher.Add(programDirectory)
+	}
+	if err != nil {
+		logger.Log.Warn("Could not watch the config file, local edits need a restart", "error", err)
+		return
+	}
+
+	debounce := time.NewTimer(configFileDebounce)
+	debounce.Stop()
+	defer debounce.Stop()
+
+	for {
+		select {
+		case <-stopped:
+			return
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			if filepath.Base(event.Name) != config.ConfigFilename || !event.Has(fsnotify.Write) && !event.Has(fsnotify.Create) {
+				continue
+			}
+			debounce.Reset(configFileDebounce)
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			logger.Log.Warn("Config file watcher error", "error", err)
+		case <-debounce.C:
+			reload.apply("file")
+		}
+	}
+}
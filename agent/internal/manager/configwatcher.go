@@ -2,7 +2,7 @@ package manager
 
 import (
 	"context"
-	"os"
+	"fmt"
 	"sync"
 	"time"
 
@@ -28,18 +28,20 @@ func NewConfigWatcher(client *api.Client, reloadCh chan<- bool, wg *sync.WaitGro
 	}
 }
 
-// Start launches the background goroutine to watch for config changes.
-func (r *ConfigWatcher) Start(ctx context.Context, initialCfg *collection.CollectionConfig) {
+// Start launches the background goroutine to watch for config changes. The
+// wait group is incremented only when the watcher actually starts.
+func (r *ConfigWatcher) Start(ctx context.Context, initialCfg *collection.CollectionConfig) error {
 	hash, err := initialCfg.Hash()
 	if err != nil {
-		// Critical error. Hashing should not fail on valid config
-		logger.Log.Error("Failed to hash initial config, exiting", "error", err)
-		os.Exit(1)
+		// Hashing should not fail on valid config
+		return fmt.Errorf("failed to hash initial config: %w", err)
 	}
 	r.initialHash = hash
 	logger.Log.Debug("Saved initial config hash", "hash", hash)
 
+	r.wg.Add(1)
 	go r.run(ctx, initialCfg)
+	return nil
 }
 
 // Run is the main loop for checking config changes with dynamic intervals.
@@ -103,6 +105,8 @@ func (r *ConfigWatcher) checkConfigForChange() *collection.CollectionConfig {
 		return nil
 	}
 
+	syncPatterns(r.client, newCfg)
+
 	// Hash check
 	newHash, err := newCfg.Hash()
 	if err != nil {
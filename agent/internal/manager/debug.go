@@ -0,0 +1,70 @@
+package manager
+
+import (
+	"os"
+	"os/signal"
+
+	"agent/internal/admin"
+	"agent/internal/logger"
+)
+
+// debugToggles returns the channel receiving the debug signals, nil when the
+// platform has none. They're registered before serveDebug runs, so that an
+// early signal doesn't kill the agent.
+func debugToggles() chan os.Signal {
+	signals := debugSignals()
+	// Notify without signals would relay all of them
+	if len(signals) == 0 {
+		return nil
+	}
+	toggles := make(chan os.Signal, 1)
+	signal.Notify(toggles, signals...)
+	return toggles
+}
+
+// serveDebug serves the debug endpoint until stopped is closed, from the
+// start when the config sets its address. A toggle starts it, on the default
+// address when the config has none, and stops it again.
+func serveDebug(address string, toggles chan os.Signal, stopped <-chan struct{}) {
+	if toggles != nil {
+		defer signal.Stop(toggles)
+	}
+	if address == "" {
+		runDebug(admin.DefaultDebugAddress, false, toggles, stopped)
+		return
+	}
+	runDebug(address, true, toggles, stopped)
+}
+
+// runDebug serves the debug endpoint on address while it's enabled, each
+// toggle enables or disables it
+func runDebug(address string, enabled bool, toggles <-chan os.Signal, stopped <-chan struct{}) {
+	var srv *admin.DebugServer
+	toggle := func() {
+		if srv != nil {
+			srv.Close()
+			srv = nil
+			return
+		}
+		var err error
+		if srv, err = admin.StartDebug(address); err != nil {
+			logger.Log.Warn("failed to start the debug endpoint", "error", err)
+		}
+	}
+	defer func() {
+		if srv != nil {
+			srv.Close()
+		}
+	}()
+	if enabled {
+		toggle()
+	}
+	for {
+		select {
+		case <-stopped:
+			return
+		case <-toggles:
+			toggle()
+		}
+	}
+}
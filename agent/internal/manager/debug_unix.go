@@ -0,0 +1,14 @@
+//go:build !windows
+// +build !windows
+
+package manager
+
+import (
+	"os"
+	"syscall"
+)
+
+// debugSignals toggle the debug endpoint
+func debugSignals() []os.Signal {
+	return []os.Signal{syscall.SIGUSR2}
+}
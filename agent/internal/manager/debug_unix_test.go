@@ -0,0 +1,61 @@
+//go:build !windows
+// +build !windows
+
+package manager
+
+import (
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServeDebugToggle(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	address := lis.Addr().String()
+	lis.Close()
+	up := func() bool {
+		resp, err := http.Get("http://" + address + "/debug/runtime")
+		if err != nil {
+			return false
+		}
+		resp.Body.Close()
+		return resp.StatusCode == http.StatusOK
+	}
+
+	// Enabled in the config
+	stopped := make(chan struct{})
+	done := make(chan struct{})
+	toggles := debugToggles()
+	go func() {
+		serveDebug(address, nil, stopped)
+		close(done)
+	}()
+	require.Eventually(t, up, time.Second, 10*time.Millisecond)
+	close(stopped)
+	<-done
+	assert.False(t, up())
+
+	// Off until SIGUSR2, then off again on the next one
+	stopped = make(chan struct{})
+	done = make(chan struct{})
+	go func() {
+		runDebug(address, false, toggles, stopped)
+		close(done)
+	}()
+	assert.False(t, up())
+	require.NoError(t, syscall.Kill(os.Getpid(), syscall.SIGUSR2))
+	require.Eventually(t, up, time.Second, 10*time.Millisecond)
+	require.NoError(t, syscall.Kill(os.Getpid(), syscall.SIGUSR2))
+	require.Eventually(t, func() bool { return !up() }, time.Second, 10*time.Millisecond)
+	close(stopped)
+	<-done
+	signal.Stop(toggles)
+}
@@ -0,0 +1,12 @@
+//go:build windows
+// +build windows
+
+package manager
+
+import "os"
+
+// debugSignals toggle the debug endpoint. Windows has none, the endpoint is
+// enabled in the config.
+func debugSignals() []os.Signal {
+	return nil
+}
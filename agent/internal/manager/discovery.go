@@ -2,29 +2,100 @@ package manager
 
 import (
 	"context"
+	"errors"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 
 	"agent/internal/api"
+	"agent/internal/collection"
+	"agent/internal/common"
+	"agent/internal/config"
 	"agent/internal/hostinfo"
 	"agent/internal/logger"
 	"agent/internal/logs"
 	logsRegistry "agent/internal/logs/registry"
 	"agent/internal/metrics"
 	metricsRegistry "agent/internal/metrics/registry"
+
+	"golang.org/x/time/rate"
 )
 
 const discoveryInterval = time.Hour
 
+// discoveryRetryDelays are the waits before retrying a request that failed
+// with a transient error. Discovery runs in the background, there's no hurry.
+var discoveryRetryDelays = []time.Duration{2 * time.Second, 10 * time.Second}
+
+// Defaults of the discovery config. Hosts with many disks, interfaces or
+// containers would otherwise exceed the size accepted by the backend or flood
+// it with requests.
+const (
+	defaultDiscoveryChunkSize         = 500
+	defaultDiscoveryRequestsPerMinute = 30
+	defaultDiscoveryMaxLabelSets      = 100
+)
+
+// Discovery periodically reports the host info and the available metrics and
+// log sources to the backend. The complete sets are sent the first time, then
+// only what was added or removed since. Large sets are sent in chunks and
+// failures are retried by the next run, the agent keeps collecting meanwhile.
+// Requests are spread to stay within a per minute budget. Metrics with labels
+// are advertised as templates, so that a new disk or interface doesn't change
+// the set. The label values they enumerate are those of the first discovery.
+//
+// A Discovery outlives reloads, it's started again with every new set of
+// services and is never running twice at the same time.
 type Discovery struct {
 	client *api.Client
 	wg     *sync.WaitGroup
+
+	chunkSize    int
+	limiter      *rate.Limiter
+	maxLabelSets int
+	// skipHostInfo and skipAvailable turn off reporting the host info and
+	// advertising the available metrics and log sources
+	skipHostInfo  bool
+	skipAvailable bool
+	// hostInfo is reported by the next publish instead of gathering it,
+	// nil to gather it
+	hostInfo *hostinfo.HostInfo
+	// config sets up the collectors reading targets from the agent config
+	config *config.Config
+
+	// Last sets accepted by the backend, nil until the first successful post
+	metrics    map[string]collection.Metric
+	logSources map[string]collection.LogSource
+
+	// registered is what the backend accepted, persisted to statePath so
+	// that a restart only posts what changed. Nothing is persisted when
+	// statePath is empty.
+	registered registration
+	statePath  string
 }
 
-func NewDiscovery(client *api.Client, wg *sync.WaitGroup) *Discovery {
+func NewDiscovery(client *api.Client, wg *sync.WaitGroup, agentConfig *config.Config) *Discovery {
+	cfg := agentConfig.Discovery
+	chunkSize := cfg.ChunkSize
+	if chunkSize <= 0 {
+		chunkSize = defaultDiscoveryChunkSize
+	}
+	perMinute := cfg.RequestsPerMinute
+	if perMinute <= 0 {
+		perMinute = defaultDiscoveryRequestsPerMinute
+	}
+	maxLabelSets := cfg.MaxLabelSets
+	if maxLabelSets == 0 {
+		maxLabelSets = defaultDiscoveryMaxLabelSets
+	}
 	return &Discovery{
-		client: client,
-		wg:     wg,
+		client:       client,
+		wg:           wg,
+		chunkSize:    chunkSize,
+		limiter:      rate.NewLimiter(rate.Every(time.Minute/time.Duration(perMinute)), perMinute),
+		maxLabelSets: maxLabelSets,
+		config:       agentConfig,
 	}
 }
 
@@ -35,7 +106,7 @@ func (d *Discovery) Start(ctx context.Context) {
 func (d *Discovery) run(ctx context.Context) {
 	defer d.wg.Done()
 
-	d.publish()
+	d.publish(ctx)
 
 	ticker := time.NewTicker(discoveryInterval)
 	defer ticker.Stop()
@@ -48,30 +119,229 @@ func (d *Discovery) run(ctx context.Context) {
 			logger.Log.Info("Discovery received shutdown signal.")
 			return
 		case <-ticker.C:
-			d.publish()
+			d.publish(ctx)
 		}
 	}
 }
 
-func (d *Discovery) publish() {
-	info, err := hostinfo.Gather()
-	if err != nil {
-		logger.Log.Error("failed to gather host info", "error", err)
-	} else if err := d.client.PostHostInfo(*info); err != nil {
-		logger.Log.Error("failed to send host info to backend", "error", err)
+func (d *Discovery) publish(ctx context.Context) {
+	if !d.skipHostInfo {
+		// Gathered again on the next ones, the host info may change
+		info, err := d.hostInfo, error(nil)
+		d.hostInfo = nil
+		if info == nil {
+			info, err = hostinfo.Gather()
+		}
+		if err != nil {
+			logger.Log.Error("failed to gather host info", "error", err)
+		} else if hash := hashValue(info); hash == d.registered.HostInfo {
+			logger.Log.Debug("Host info unchanged, not sent")
+		} else if err := d.client.PostHostInfo(*info); err != nil {
+			logger.Log.Error("failed to send host info to backend", "error", err)
+		} else {
+			d.registered.HostInfo = hash
+			d.saveRegistration()
+		}
+	}
+	if d.skipAvailable {
+		return
 	}
 
-	metricsCollectors := metricsRegistry.BuildCollectors(nil)
+	metricsCollectors := metricsRegistry.BuildCollectors(nil, d.config)
 	discoveredMetrics := metrics.DiscoverAvailableMetrics(metricsCollectors)
-	logger.Log.Info("Metrics discovered", "count", len(discoveredMetrics))
-	if err := d.client.PostAvailableMetrics(discoveredMetrics); err != nil {
-		logger.Log.Error("failed to send discovered metrics to backend", "error", err)
-	}
+	templated := metrics.TemplateMetrics(discoveredMetrics, d.maxLabelSets)
+	logger.Log.Info("Metrics discovered", "count", len(discoveredMetrics), "advertised", len(templated))
+	d.publishMetrics(ctx, templated)
 
 	logsCollectors := logsRegistry.BuildCollectors(nil)
 	discoveredLogSources := logs.DiscoverAvailableLogSources(logsCollectors)
 	logger.Log.Info("Log sources discovered", "count", len(discoveredLogSources))
-	if err := d.client.PostAvailableLogSources(discoveredLogSources); err != nil {
-		logger.Log.Error("failed to send discovered log sources to backend", "error", err)
+	d.publishLogSources(ctx, discoveredLogSources)
+}
+
+func (d *Discovery) publishMetrics(ctx context.Context, discovered []collection.Metric) {
+	current := make(map[string]collection.Metric, len(discovered))
+	for _, m := range discovered {
+		current[metricKey(m)] = m
+	}
+
+	defer func() { registerSet(d, &d.registered.Metrics, d.metrics) }()
+	if d.metrics == nil && d.registered.Metrics == hashSet(current) {
+		logger.Log.Info("Available metrics unchanged since the last registration")
+		d.metrics = current
+	}
+	if d.metrics == nil {
+		// The first chunk replaces the metrics known by the backend, the
+		// rest is sent as additions
+		first := discovered[:min(len(discovered), d.chunkSize)]
+		err := d.withRetries(ctx, func() error { return d.client.PostAvailableMetrics(first) })
+		if err != nil {
+			logger.Log.Warn("failed to send discovered metrics to backend, will retry with the next discovery", "error", err)
+			return
+		}
+		d.metrics = make(map[string]collection.Metric, len(discovered))
+		for _, m := range first {
+			d.metrics[metricKey(m)] = m
+		}
+	}
+
+	added, removed := diffSets(d.metrics, current)
+	if len(added) == 0 && len(removed) == 0 {
+		return
+	}
+	logger.Log.Info("Available metrics changed", "added", len(added), "removed", len(removed))
+	err := sendInChunks(d.metrics, added, removed, d.chunkSize, metricKey, func(added, removed []collection.Metric) error {
+		return d.withRetries(ctx, func() error {
+			return d.client.PatchAvailableMetrics(api.MetricsDiff{Added: added, Removed: removed})
+		})
+	})
+	if err != nil {
+		// What wasn't accepted is sent again by the next discovery
+		logger.Log.Warn("failed to send metric changes to backend, will retry with the next discovery", "error", err)
+	}
+}
+
+func (d *Discovery) publishLogSources(ctx context.Context, discovered []collection.LogSource) {
+	current := make(map[string]collection.LogSource, len(discovered))
+	for _, src := range discovered {
+		current[logSourceKey(src)] = src
+	}
+
+	defer func() { registerSet(d, &d.registered.LogSources, d.logSources) }()
+	if d.logSources == nil && d.registered.LogSources == hashSet(current) {
+		logger.Log.Info("Available log sources unchanged since the last registration")
+		d.logSources = current
+	}
+	if d.logSources == nil {
+		first := discovered[:min(len(discovered), d.chunkSize)]
+		err := d.withRetries(ctx, func() error { return d.client.PostAvailableLogSources(first) })
+		if err != nil {
+			logger.Log.Warn("failed to send discovered log sources to backend, will retry with the next discovery", "error", err)
+			return
+		}
+		d.logSources = make(map[string]collection.LogSource, len(discovered))
+		for _, src := range first {
+			d.logSources[logSourceKey(src)] = src
+		}
 	}
+
+	added, removed := diffSets(d.logSources, current)
+	if len(added) == 0 && len(removed) == 0 {
+		return
+	}
+	logger.Log.Info("Available log sources changed", "added", len(added), "removed", len(removed))
+	err := sendInChunks(d.logSources, added, removed, d.chunkSize, logSourceKey, func(added, removed []collection.LogSource) error {
+		return d.withRetries(ctx, func() error {
+			return d.client.PatchAvailableLogSources(api.LogSourcesDiff{Added: added, Removed: removed})
+		})
+	})
+	if err != nil {
+		logger.Log.Warn("failed to send log source changes to backend, will retry with the next discovery", "error", err)
+	}
+}
+
+// registerSet records the hash of the set accepted by the backend, nil
+// until it accepted one
+func registerSet[T any](d *Discovery, registered *string, accepted map[string]T) {
+	if accepted == nil {
+		return
+	}
+	if hash := hashSet(accepted); hash != *registered {
+		*registered = hash
+		d.saveRegistration()
+	}
+}
+
+// sendInChunks sends the changes with at most chunkSize values per request
+// and applies each accepted chunk to state, so that only the rest is
+// sent again when a chunk fails.
+func sendInChunks[T any](state map[string]T, added, removed []T, chunkSize int, key func(T) string, send func(added, removed []T) error) error {
+	for len(added) > 0 || len(removed) > 0 {
+		chunkAdded := added[:min(len(added), chunkSize)]
+		chunkRemoved := removed[:min(len(removed), chunkSize-len(chunkAdded))]
+		if err := send(chunkAdded, chunkRemoved); err != nil {
+			return err
+		}
+		for _, v := range chunkAdded {
+			state[key(v)] = v
+		}
+		for _, v := range chunkRemoved {
+			delete(state, key(v))
+		}
+		added, removed = added[len(chunkAdded):], removed[len(chunkRemoved):]
+	}
+	return nil
+}
+
+// withRetries calls send until it succeeds, fails with a permanent error, runs
+// out of retries or ctx is cancelled. Every attempt waits for the request
+// budget.
+func (d *Discovery) withRetries(ctx context.Context, send func() error) error {
+	attempt := func() error {
+		if err := d.limiter.Wait(ctx); err != nil {
+			return err
+		}
+		return send()
+	}
+	err := attempt()
+	for _, delay := range discoveryRetryDelays {
+		if !api.IsTransient(err) {
+			break
+		}
+		// Wait at least as long as the backend asked
+		var throttledErr *api.ThrottledError
+		if errors.As(err, &throttledErr) {
+			delay = max(delay, throttledErr.RetryAfter)
+		}
+		logger.Log.Debug("Discovery request failed, retrying", "error", err, "delay", delay)
+		if !common.SleepContext(ctx, delay) {
+			break
+		}
+		err = attempt()
+	}
+	return err
+}
+
+// diffSets returns the values of current missing from previous and the
+// values of previous missing from current, both sorted by key.
+func diffSets[T any](previous, current map[string]T) (added, removed []T) {
+	added, removed = []T{}, []T{}
+	for _, key := range sortedKeys(current) {
+		if _, ok := previous[key]; !ok {
+			added = append(added, current[key])
+		}
+	}
+	for _, key := range sortedKeys(previous) {
+		if _, ok := current[key]; !ok {
+			removed = append(removed, previous[key])
+		}
+	}
+	return added, removed
+}
+
+func sortedKeys[T any](m map[string]T) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// metricKey identifies a metric by its name and labels. The value reported
+// during discovery is not part of the identity.
+func metricKey(m collection.Metric) string {
+	var b strings.Builder
+	b.WriteString(m.Name)
+	for _, k := range sortedKeys(m.Labels) {
+		b.WriteString("\x00")
+		b.WriteString(k)
+		b.WriteString("=")
+		b.WriteString(m.Labels[k])
+	}
+	return b.String()
+}
+
+func logSourceKey(src collection.LogSource) string {
+	return src.Name + "\x00" + src.Path
 }
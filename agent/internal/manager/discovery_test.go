@@ -0,0 +1,275 @@
+package manager
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"agent/internal/api"
+	"agent/internal/collection"
+	"agent/internal/common"
+	"agent/internal/config"
+	"agent/internal/hostinfo"
+	"agent/internal/metrics"
+)
+
+type recordedRequest struct {
+	method string
+	path   string
+	body   json.RawMessage
+}
+
+func newRecordingServer(t *testing.T, status *int) (*httptest.Server, *[]recordedRequest) {
+	var mu sync.Mutex
+	var requests []recordedRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body json.RawMessage
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		mu.Lock()
+		requests = append(requests, recordedRequest{method: r.Method, path: r.URL.Path, body: body})
+		mu.Unlock()
+		w.WriteHeader(*status)
+	}))
+	t.Cleanup(server.Close)
+	return server, &requests
+}
+
+func TestDiscoveryPublishesMetricChanges(t *testing.T) {
+	status := http.StatusOK
+	server, requests := newRecordingServer(t, &status)
+	d := NewDiscovery(api.NewClient(config.Config{APIUrl: server.URL, APIKey: "test-key"}, false), &sync.WaitGroup{}, &config.Config{})
+
+	cpu := collection.Metric{Name: "cpu_usage_ratio", Type: "gauge", Value: 0.1}
+	nginx := collection.Metric{Name: "nginx_requests_total", Type: "counter", Labels: map[string]string{"server": "localhost"}}
+
+	// The complete set is posted first
+	d.publishMetrics(context.Background(), []collection.Metric{cpu})
+	require.Len(t, *requests, 1)
+	assert.Equal(t, "POST", (*requests)[0].method)
+	assert.Equal(t, "/metrics/", (*requests)[0].path)
+
+	// Nothing is sent while the set doesn't change, whatever the values
+	cpu.Value = 0.5
+	d.publishMetrics(context.Background(), []collection.Metric{cpu})
+	require.Len(t, *requests, 1)
+
+	// Only the changes are sent afterwards
+	d.publishMetrics(context.Background(), []collection.Metric{nginx})
+	require.Len(t, *requests, 2)
+	assert.Equal(t, "PATCH", (*requests)[1].method)
+	var diff api.MetricsDiff
+	require.NoError(t, json.Unmarshal((*requests)[1].body, &diff))
+	require.Len(t, diff.Added, 1)
+	assert.Equal(t, "nginx_requests_total", diff.Added[0].Name)
+	require.Len(t, diff.Removed, 1)
+	assert.Equal(t, "cpu_usage_ratio", diff.Removed[0].Name)
+}
+
+func TestDiscoveryReportsGatheredHostInfo(t *testing.T) {
+	status := http.StatusOK
+	server, requests := newRecordingServer(t, &status)
+	d := NewDiscovery(api.NewClient(config.Config{APIUrl: server.URL, APIKey: "test-key"}, false), &sync.WaitGroup{}, &config.Config{})
+	d.skipAvailable = true
+	d.hostInfo = &hostinfo.HostInfo{Hostname: "gathered-on-start"}
+
+	// The host info of the start is reported once, then gathered again
+	d.publish(context.Background())
+	require.Len(t, *requests, 1)
+	var info hostinfo.HostInfo
+	require.NoError(t, json.Unmarshal((*requests)[0].body, &info))
+	assert.Equal(t, "gathered-on-start", info.Hostname)
+	assert.Nil(t, d.hostInfo)
+}
+
+func TestDiscoveryRetriesFailedLogSourceChanges(t *testing.T) {
+	status := http.StatusOK
+	server, requests := newRecordingServer(t, &status)
+	d := NewDiscovery(api.NewClient(config.Config{APIUrl: server.URL, APIKey: "test-key"}, false), &sync.WaitGroup{}, &config.Config{})
+
+	syslog := collection.LogSource{Name: "syslog", Path: "/var/log/syslog"}
+	nginx := collection.LogSource{Name: "nginx", Path: "/var/log/nginx/access.log"}
+
+	d.publishLogSources(context.Background(), []collection.LogSource{syslog})
+
+	status = http.StatusBadRequest
+	d.publishLogSources(context.Background(), []collection.LogSource{syslog, nginx})
+
+	// The failed change is sent again
+	status = http.StatusOK
+	d.publishLogSources(context.Background(), []collection.LogSource{syslog, nginx})
+	require.Len(t, *requests, 3)
+	for _, req := range (*requests)[1:] {
+		assert.Equal(t, "PATCH", req.method)
+		assert.Equal(t, "/logs/", req.path)
+		var diff api.LogSourcesDiff
+		require.NoError(t, json.Unmarshal(req.body, &diff))
+		assert.Equal(t, []collection.LogSource{nginx}, diff.Added)
+		assert.Empty(t, diff.Removed)
+	}
+
+	d.publishLogSources(context.Background(), []collection.LogSource{syslog, nginx})
+	assert.Len(t, *requests, 3)
+}
+
+func TestDiscoverySendsMetricsInChunks(t *testing.T) {
+	// The third request is rejected
+	var requests []recordedRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body json.RawMessage
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		requests = append(requests, recordedRequest{method: r.Method, path: r.URL.Path, body: body})
+		if len(requests) == 3 {
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	t.Cleanup(server.Close)
+	d := NewDiscovery(api.NewClient(config.Config{APIUrl: server.URL, APIKey: "test-key"}, false), &sync.WaitGroup{}, &config.Config{Discovery: config.DiscoveryConfig{ChunkSize: 2}})
+
+	var discovered []collection.Metric
+	for _, name := range []string{"disk_a", "disk_b", "disk_c", "disk_d", "disk_e", "disk_f"} {
+		discovered = append(discovered, collection.Metric{Name: name, Type: "gauge"})
+	}
+
+	// The chunks accepted before the failure are kept
+	d.publishMetrics(context.Background(), discovered)
+	require.Len(t, requests, 3)
+	assert.Equal(t, "POST", requests[0].method)
+	assert.Equal(t, "PATCH", requests[1].method)
+	assert.Len(t, d.metrics, 4)
+
+	// Only the rejected chunk is sent again
+	d.publishMetrics(context.Background(), discovered)
+	require.Len(t, requests, 4)
+	var diff api.MetricsDiff
+	require.NoError(t, json.Unmarshal(requests[3].body, &diff))
+	assert.Equal(t, discovered[4:], diff.Added)
+	assert.Len(t, d.metrics, 6)
+}
+
+func TestDiscoveryRetriesTransientFailures(t *testing.T) {
+	delays := discoveryRetryDelays
+	discoveryRetryDelays = []time.Duration{time.Millisecond, time.Millisecond}
+	t.Cleanup(func() { discoveryRetryDelays = delays })
+
+	statuses := []int{http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusOK}
+	var calls int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(statuses[calls])
+		calls++
+	}))
+	t.Cleanup(server.Close)
+	d := NewDiscovery(api.NewClient(config.Config{APIUrl: server.URL, APIKey: "test-key"}, false), &sync.WaitGroup{}, &config.Config{})
+
+	d.publishMetrics(context.Background(), []collection.Metric{{Name: "cpu_usage_ratio"}})
+	assert.Equal(t, 3, calls)
+	assert.Len(t, d.metrics, 1)
+
+	// Permanent errors are not retried
+	calls = 0
+	statuses = []int{http.StatusRequestEntityTooLarge}
+	d.publishMetrics(context.Background(), []collection.Metric{{Name: "mem_used_ratio"}})
+	assert.Equal(t, 1, calls)
+}
+
+func TestDiscoveryRequestBudget(t *testing.T) {
+	var requests []recordedRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, recordedRequest{method: r.Method, path: r.URL.Path})
+	}))
+	t.Cleanup(server.Close)
+	d := NewDiscovery(api.NewClient(config.Config{APIUrl: server.URL, APIKey: "test-key"}, false), &sync.WaitGroup{}, &config.Config{Discovery: config.DiscoveryConfig{ChunkSize: 1, RequestsPerMinute: 2}})
+
+	discovered := []collection.Metric{{Name: "disk_a"}, {Name: "disk_b"}, {Name: "disk_c"}}
+
+	// The budget is spent by the first two chunks, the third one waits
+	// until the context is cancelled
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	d.publishMetrics(ctx, discovered)
+	assert.Len(t, requests, 2)
+	assert.Len(t, d.metrics, 2)
+}
+
+func TestDiscoveryTemplatesAbsorbNewDevices(t *testing.T) {
+	status := http.StatusOK
+	server, requests := newRecordingServer(t, &status)
+	d := NewDiscovery(api.NewClient(config.Config{APIUrl: server.URL, APIKey: "test-key"}, false), &sync.WaitGroup{}, &config.Config{})
+
+	disk := func(devices ...string) []collection.Metric {
+		var discovered []collection.Metric
+		for _, device := range devices {
+			discovered = append(discovered, collection.Metric{Name: "disk_used_ratio", Type: "gauge", Labels: map[string]string{"device": device}})
+		}
+		return metrics.TemplateMetrics(discovered, d.maxLabelSets)
+	}
+
+	d.publishMetrics(context.Background(), disk("sda"))
+	require.Len(t, *requests, 1)
+
+	// A new disk matches the registered template
+	d.publishMetrics(context.Background(), disk("sda", "sdb"))
+	assert.Len(t, *requests, 1)
+}
+
+func TestDiscoverySkippedPhases(t *testing.T) {
+	status := http.StatusOK
+	server, requests := newRecordingServer(t, &status)
+	d := NewDiscovery(api.NewClient(config.Config{APIUrl: server.URL, APIKey: "test-key"}, false), &sync.WaitGroup{}, &config.Config{})
+
+	// Only the host info is reported
+	d.skipAvailable = true
+	d.publish(context.Background())
+	require.Len(t, *requests, 1)
+	assert.Equal(t, "/servers/info/", (*requests)[0].path)
+
+	d.skipHostInfo = true
+	d.publish(context.Background())
+	assert.Len(t, *requests, 1)
+}
+
+func TestDiscoveryRegistrationSurvivesRestarts(t *testing.T) {
+	common.SetProgramDirectory(t.TempDir())
+	t.Cleanup(func() { common.SetProgramDirectory("") })
+	status := http.StatusOK
+	server, requests := newRecordingServer(t, &status)
+	client := api.NewClient(config.Config{APIUrl: server.URL, APIKey: "test-key"}, false)
+	cpu := collection.Metric{Name: "cpu_usage_ratio", Type: "gauge", Value: 0.1}
+	nginx := collection.Metric{Name: "nginx_requests_total", Type: "counter"}
+
+	d := NewDiscovery(client, &sync.WaitGroup{}, &config.Config{})
+	d.persistRegistration(false)
+	d.publishMetrics(context.Background(), []collection.Metric{cpu})
+	require.Len(t, *requests, 1)
+
+	// After a restart, the same set isn't posted again
+	d = NewDiscovery(client, &sync.WaitGroup{}, &config.Config{})
+	d.persistRegistration(false)
+	d.publishMetrics(context.Background(), []collection.Metric{cpu})
+	require.Len(t, *requests, 1)
+
+	// Changes are sent as a diff
+	d.publishMetrics(context.Background(), []collection.Metric{cpu, nginx})
+	require.Len(t, *requests, 2)
+	assert.Equal(t, "PATCH", (*requests)[1].method)
+
+	// A forced registration posts the complete set
+	d = NewDiscovery(client, &sync.WaitGroup{}, &config.Config{})
+	d.persistRegistration(true)
+	d.publishMetrics(context.Background(), []collection.Metric{cpu, nginx})
+	require.Len(t, *requests, 3)
+	assert.Equal(t, "POST", (*requests)[2].method)
+
+	// The set changed while the agent was stopped
+	d = NewDiscovery(client, &sync.WaitGroup{}, &config.Config{})
+	d.persistRegistration(false)
+	d.publishMetrics(context.Background(), []collection.Metric{nginx})
+	require.Len(t, *requests, 4)
+	assert.Equal(t, "POST", (*requests)[3].method)
+}
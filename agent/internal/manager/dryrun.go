@@ -0,0 +1,189 @@
+package manager
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"agent/internal/exporter"
+)
+
+// Dry run output formats
+const (
+	// DryRunJSON prints every batch sent by the flusher, as sent
+	DryRunJSON = "json"
+	// DryRunTable prints a line per metric or log
+	DryRunTable = "table"
+	// DryRunSummary prints the number of points per metric at the end
+	DryRunSummary = "summary"
+	// DryRunEstimate prints the estimated ingest volume per metric and log
+	// source at the end
+	DryRunEstimate = "estimate"
+)
+
+// DryRunFormats lists the supported dry run output formats
+var DryRunFormats = []string{DryRunJSON, DryRunTable, DryRunSummary, DryRunEstimate}
+
+const (
+	defaultDryRunDuration = 20 * time.Second
+	defaultDryRunInterval = 3 * time.Second
+)
+
+// dryRunPrinter is the sink printing the payloads of a dry run in the table,
+// summary and estimate formats.
+type dryRunPrinter struct {
+	mu      sync.Mutex
+	out     io.Writer
+	format  string
+	metrics map[string]int
+	logs    map[string]int
+
+	// The estimate format measures the serialized size of the payloads, by
+	// metric and by log source
+	start       time.Time
+	metricBytes map[string]int64
+	// metricTimes are the timestamps of the collections of each metric
+	metricTimes map[string]map[string]bool
+	logBytes    map[string]int64
+}
+
+func newDryRunPrinter(out io.Writer, format string) *dryRunPrinter {
+	return &dryRunPrinter{
+		out:         out,
+		format:      format,
+		metrics:     make(map[string]int),
+		logs:        make(map[string]int),
+		start:       time.Now(),
+		metricBytes: make(map[string]int64),
+		metricTimes: make(map[string]map[string]bool),
+		logBytes:    make(map[string]int64),
+	}
+}
+
+// payloadSize is the size of a payload in an uncompressed JSON export
+func payloadSize(payload any) int64 {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return 0
+	}
+	// The separator in the array
+	return int64(len(data)) + 1
+}
+
+func (p *dryRunPrinter) WriteMetrics(metrics []exporter.MetricPayload) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, m := range metrics {
+		p.metrics[m.Name]++
+		if p.format == DryRunEstimate {
+			p.metricBytes[m.Name] += payloadSize(m)
+			if p.metricTimes[m.Name] == nil {
+				p.metricTimes[m.Name] = make(map[string]bool)
+			}
+			p.metricTimes[m.Name][m.Timestamp] = true
+		}
+		if p.format == DryRunTable {
+			fmt.Fprintf(p.out, "metric  %-48s %16g  %s\n", m.Name, m.Value, formatLabels(m.Labels))
+		}
+	}
+}
+
+func (p *dryRunPrinter) WriteLogs(logs []exporter.LogPayload) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, l := range logs {
+		source := l.Labels["source"]
+		p.logs[source]++
+		if p.format == DryRunEstimate {
+			p.logBytes[source] += payloadSize(l)
+		}
+		if p.format == DryRunTable {
+			message, _, _ := strings.Cut(l.Message, "\n")
+			fmt.Fprintf(p.out, "log     %-48s %s\n", source, message)
+		}
+	}
+}
+
+// printSummary prints the number of points collected per metric and of log
+// entries per source
+func (p *dryRunPrinter) printSummary() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	fmt.Fprintf(p.out, "%d metrics, %d log sources collected\n", len(p.metrics), len(p.logs))
+	for _, name := range slices.Sorted(maps.Keys(p.metrics)) {
+		fmt.Fprintf(p.out, "metric  %-48s %6d points\n", name, p.metrics[name])
+	}
+	for _, source := range slices.Sorted(maps.Keys(p.logs)) {
+		fmt.Fprintf(p.out, "log     %-48s %6d entries\n", source, p.logs[source])
+	}
+}
+
+// volume is the estimated ingest of a metric or a log source
+type volume struct {
+	kind      string
+	name      string
+	perMinute float64
+}
+
+// printEstimate prints the estimated ingest volume per minute and per day.
+// A metric is collected every defaultCollectionInterval outside of the dry
+// run, its volume is the average size of a collection whatever the dry run
+// interval. The log volumes are extrapolated from the duration of the dry
+// run, they're only as representative as the activity during it.
+func (p *dryRunPrinter) printEstimate() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	elapsed := time.Since(p.start)
+	collectionsPerMinute := float64(time.Minute) / float64(defaultCollectionInterval)
+
+	var volumes []volume
+	var total float64
+	for name, bytes := range p.metricBytes {
+		v := volume{kind: "metric", name: name, perMinute: float64(bytes) / float64(len(p.metricTimes[name])) * collectionsPerMinute}
+		volumes = append(volumes, v)
+		total += v.perMinute
+	}
+	for source, bytes := range p.logBytes {
+		v := volume{kind: "log", name: source, perMinute: float64(bytes) / elapsed.Minutes()}
+		volumes = append(volumes, v)
+		total += v.perMinute
+	}
+	slices.SortFunc(volumes, func(a, b volume) int {
+		return cmp.Or(cmp.Compare(b.perMinute, a.perMinute), strings.Compare(a.name, b.name))
+	})
+
+	fmt.Fprintf(p.out, "Estimated ingest, uncompressed, logs measured over %s\n", elapsed.Round(time.Second))
+	for _, v := range volumes {
+		fmt.Fprintf(p.out, "%-6s  %-48s %12s/min %12s/day\n", v.kind, v.name, formatBytes(v.perMinute), formatBytes(v.perMinute*24*60))
+	}
+	fmt.Fprintf(p.out, "%-6s  %-48s %12s/min %12s/day\n", "total", "", formatBytes(total), formatBytes(total*24*60))
+}
+
+// formatBytes returns a size in B, KB, MB or GB
+func formatBytes(bytes float64) string {
+	switch {
+	case bytes >= 1<<30:
+		return fmt.Sprintf("%.1f GB", bytes/(1<<30))
+	case bytes >= 1<<20:
+		return fmt.Sprintf("%.1f MB", bytes/(1<<20))
+	case bytes >= 1<<10:
+		return fmt.Sprintf("%.1f KB", bytes/(1<<10))
+	default:
+		return fmt.Sprintf("%.0f B", bytes)
+	}
+}
+
+// formatLabels returns the labels as sorted k=v pairs
+func formatLabels(labels map[string]string) string {
+	pairs := make([]string, 0, len(labels))
+	for _, k := range slices.Sorted(maps.Keys(labels)) {
+		pairs = append(pairs, k+"="+labels[k])
+	}
+	return strings.Join(pairs, ",")
+}
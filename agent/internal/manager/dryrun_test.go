@@ -0,0 +1,58 @@
+package manager
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"agent/internal/exporter"
+)
+
+func TestDryRunPrinter(t *testing.T) {
+	var out bytes.Buffer
+	p := newDryRunPrinter(&out, DryRunTable)
+	p.WriteMetrics([]exporter.MetricPayload{
+		{Name: "cpu_usage_ratio", Value: 0.25, Labels: map[string]string{"host": "web", "cpu": "0"}},
+	})
+	p.WriteLogs([]exporter.LogPayload{
+		{Labels: map[string]string{"source": "syslog"}, Message: "first line\nsecond line"},
+	})
+	assert.Contains(t, out.String(), "cpu_usage_ratio")
+	assert.Contains(t, out.String(), "0.25  cpu=0,host=web\n")
+	assert.Contains(t, out.String(), "first line\n")
+	assert.NotContains(t, out.String(), "second line")
+
+	out.Reset()
+	p = newDryRunPrinter(&out, DryRunSummary)
+	p.WriteMetrics([]exporter.MetricPayload{{Name: "mem_used_ratio"}, {Name: "mem_used_ratio"}})
+	assert.Empty(t, out.String())
+	p.printSummary()
+	assert.Contains(t, out.String(), "1 metrics, 0 log sources collected\n")
+	assert.Regexp(t, `mem_used_ratio\s+2 points`, out.String())
+}
+
+func TestDryRunPrinterEstimate(t *testing.T) {
+	var out bytes.Buffer
+	p := newDryRunPrinter(&out, DryRunEstimate)
+	p.start = time.Now().Add(-2 * time.Minute)
+	// Two collections of two disks, the volume is the one of a collection
+	for _, ts := range []string{"1000", "4000"} {
+		p.WriteMetrics([]exporter.MetricPayload{
+			{Name: "disk_used_ratio", Timestamp: ts, Value: 0.5, Labels: map[string]string{"disk": "sda"}},
+			{Name: "disk_used_ratio", Timestamp: ts, Value: 0.5, Labels: map[string]string{"disk": "sdb"}},
+		})
+	}
+	p.WriteLogs([]exporter.LogPayload{{Labels: map[string]string{"source": "syslog"}, Message: strings.Repeat("x", 4000)}})
+	p.printEstimate()
+
+	point := payloadSize(exporter.MetricPayload{Name: "disk_used_ratio", Timestamp: "1000", Value: 0.5, Labels: map[string]string{"disk": "sda"}})
+	assert.Contains(t, out.String(), fmt.Sprintf(" %d B/min", 2*point))
+	// 4 KB over 2 minutes
+	assert.Regexp(t, `log\s+syslog\s+2.0 KB/min\s+2.\d MB/day`, out.String())
+	// The log source is the largest
+	assert.Less(t, strings.Index(out.String(), "syslog"), strings.Index(out.String(), "disk_used_ratio"))
+}
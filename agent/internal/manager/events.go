@@ -0,0 +1,53 @@
+package manager
+
+import (
+	"sync"
+
+	"agent/internal/exporter"
+	"agent/internal/logger"
+)
+
+// eventQueue exports the events of the agent itself (auth errors,
+// hibernation). Events emitted while no exporter is running, e.g. during
+// hibernation, are kept until the next one starts.
+type eventQueue struct {
+	mu       sync.Mutex
+	exporter *exporter.Exporter
+	pending  []exporter.LogPayload
+}
+
+// emit exports an event, labelled with source=agent and the event name
+func (q *eventQueue) emit(event, message string, metadata map[string]string) {
+	payload := exporter.AgentEvent(event, message, metadata)
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.pending = append(q.pending, payload)
+	q.flush()
+}
+
+// attach sets the exporter of the running services and exports the pending
+// events
+func (q *eventQueue) attach(e *exporter.Exporter) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.exporter = e
+	q.flush()
+}
+
+// detach is called before the exporter is closed
+func (q *eventQueue) detach() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.exporter = nil
+}
+
+func (q *eventQueue) flush() {
+	if q.exporter == nil || len(q.pending) == 0 {
+		return
+	}
+	if err := q.exporter.ExportLog(q.pending); err != nil {
+		logger.Log.Error("failed to export agent events", "error", err)
+	}
+	q.pending = nil
+}
@@ -0,0 +1,49 @@
+package manager
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"agent/internal/common"
+	"agent/internal/config"
+	"agent/internal/exporter"
+)
+
+type logSink struct {
+	logs []exporter.LogPayload
+}
+
+func (s *logSink) WriteMetrics([]exporter.MetricPayload) {}
+
+func (s *logSink) WriteLogs(logs []exporter.LogPayload) {
+	s.logs = append(s.logs, logs...)
+}
+
+func TestEventQueue(t *testing.T) {
+	common.SetProgramDirectory(t.TempDir())
+	t.Cleanup(func() { common.SetProgramDirectory("") })
+	e, err := exporter.NewExporter(&config.Config{}, exporter.DefaultSettings(), true)
+	require.NoError(t, err)
+	defer e.Close()
+	sink := &logSink{}
+	e.AddSink(sink)
+
+	// Kept until an exporter is attached
+	var q eventQueue
+	q.emit("hibernation_started", "API key rejected, hibernating", map[string]string{"consecutive": "1"})
+	assert.Empty(t, sink.logs)
+
+	q.attach(e)
+	require.Len(t, sink.logs, 1)
+	assert.Equal(t, map[string]string{"source": "agent", "event": "hibernation_started"}, sink.logs[0].Labels)
+	assert.Equal(t, "1", sink.logs[0].Metadata["consecutive"])
+
+	q.emit("hibernation_ended", "Hibernation ended", nil)
+	assert.Len(t, sink.logs, 2)
+
+	q.detach()
+	q.emit("auth_errors_threshold", "Too many authentication errors, checking the API key", nil)
+	assert.Len(t, sink.logs, 2)
+}
@@ -0,0 +1,97 @@
+package manager
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"agent/internal/collection"
+	"agent/internal/common"
+	"agent/internal/logger"
+)
+
+const (
+	// collectionConfigFilename caches the last collection config received,
+	// used when the backend can't be reached at startup
+	collectionConfigFilename = "collection_config.json"
+	// The API key is checked again with an exponential backoff while the
+	// agent runs in grace mode
+	graceRetryMin = 5 * time.Second
+	graceRetryMax = 5 * time.Minute
+)
+
+// verifyKeyInGrace checks the API key until the backend answers. The agent
+// runs in grace mode meanwhile, collecting into the spool. A rejected key
+// sends a Hibernate event.
+func (a *Agent) verifyKeyInGrace(send func(ControlEvent)) {
+	delay := graceRetryMin
+	for {
+		select {
+		case <-time.After(delay):
+		case <-a.shutdownCh:
+			return
+		case <-a.done:
+			return
+		}
+		valid, err := a.client.CheckAPIKeyValidity()
+		if err != nil {
+			delay = min(delay*2, graceRetryMax)
+			logger.Log.Warn("API still unreachable, staying in grace mode", "error", err, "retry", delay)
+			continue
+		}
+		if !valid {
+			logger.Log.Error("API key rejected")
+			send(Hibernate)
+			return
+		}
+		logger.Log.Info("API reachable and key accepted, leaving grace mode")
+		return
+	}
+}
+
+func collectionConfigPath() (string, error) {
+	programDir, err := common.GetProgramDirectory()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(programDir, collectionConfigFilename), nil
+}
+
+// saveCollectionConfig caches the collection config for the next startup
+func saveCollectionConfig(cfg *collection.CollectionConfig) {
+	path, err := collectionConfigPath()
+	if err != nil {
+		return
+	}
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		return
+	}
+	if err := os.WriteFile(path, data, 0o640); err != nil {
+		logger.Log.Warn("failed to cache collection config", "error", err)
+	}
+}
+
+// loadCollectionConfig returns the cached collection config, nil when there
+// is none.
+func loadCollectionConfig() (*collection.CollectionConfig, error) {
+	path, err := collectionConfigPath()
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var cfg collection.CollectionConfig
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
@@ -0,0 +1,108 @@
+package manager
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"agent/internal/common"
+	"agent/internal/logger"
+)
+
+const (
+	// hibernationFilename is the file keeping the hibernation across restarts
+	hibernationFilename = "hibernation.json"
+	// Hibernation lasts baseHibernation, then twice as long every time the
+	// key is still rejected, up to maxHibernation
+	baseHibernation = time.Hour
+	maxHibernation  = 24 * time.Hour
+)
+
+// hibernationState is persisted so that an agent restarted while hibernating
+// resumes hibernation instead of calling the API right away.
+type hibernationState struct {
+	Until time.Time `json:"until"`
+	// Count is the number of consecutive hibernations
+	Count int `json:"count"`
+}
+
+// active reports whether the hibernation isn't over yet
+func (s hibernationState) active() bool {
+	return time.Now().Before(s.Until)
+}
+
+// next starts the next hibernation period
+func (s hibernationState) next() hibernationState {
+	count := s.Count + 1
+	return hibernationState{Until: time.Now().Add(hibernationDuration(count)), Count: count}
+}
+
+// hibernationDuration returns the length of the count-th consecutive
+// hibernation
+func hibernationDuration(count int) time.Duration {
+	d := baseHibernation
+	for i := 1; i < count && d < maxHibernation; i++ {
+		d *= 2
+	}
+	return min(d, maxHibernation)
+}
+
+func hibernationPath() (string, error) {
+	programDir, err := common.GetProgramDirectory()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(programDir, hibernationFilename), nil
+}
+
+// loadHibernation returns the persisted hibernation, the zero state when
+// there's none or it can't be read.
+func loadHibernation() hibernationState {
+	var state hibernationState
+	path, err := hibernationPath()
+	if err != nil {
+		return state
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			logger.Log.Warn("failed to read hibernation state", "error", err)
+		}
+		return state
+	}
+	if err := json.Unmarshal(data, &state); err != nil {
+		logger.Log.Warn("ignoring invalid hibernation state", "error", err)
+		return hibernationState{}
+	}
+	return state
+}
+
+func saveHibernation(state hibernationState) error {
+	path, err := hibernationPath()
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, data, 0o640); err != nil {
+		return fmt.Errorf("failed to save hibernation state: %w", err)
+	}
+	return nil
+}
+
+// clearHibernation removes the persisted hibernation once the key is accepted
+func clearHibernation() {
+	path, err := hibernationPath()
+	if err != nil {
+		return
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		logger.Log.Warn("failed to remove hibernation state", "error", err)
+	}
+}
@@ -0,0 +1,90 @@
+package manager
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"agent/internal/api"
+	"agent/internal/common"
+	"agent/internal/config"
+)
+
+func TestHibernationDuration(t *testing.T) {
+	assert.Equal(t, time.Hour, hibernationDuration(1))
+	assert.Equal(t, 2*time.Hour, hibernationDuration(2))
+	assert.Equal(t, 16*time.Hour, hibernationDuration(5))
+	assert.Equal(t, 24*time.Hour, hibernationDuration(6))
+	assert.Equal(t, 24*time.Hour, hibernationDuration(100))
+}
+
+func TestHibernationPersistence(t *testing.T) {
+	common.SetProgramDirectory(t.TempDir())
+	t.Cleanup(func() { common.SetProgramDirectory("") })
+
+	assert.False(t, loadHibernation().active())
+
+	state := hibernationState{}.next().next()
+	require.NoError(t, saveHibernation(state))
+	loaded := loadHibernation()
+	assert.True(t, loaded.active())
+	assert.Equal(t, 2, loaded.Count)
+	assert.WithinDuration(t, time.Now().Add(2*time.Hour), loaded.Until, time.Minute)
+
+	clearHibernation()
+	assert.Equal(t, hibernationState{}, loadHibernation())
+}
+
+func TestNextEventIgnoresHibernate(t *testing.T) {
+	ctrl := make(chan ControlEvent, 2)
+	ctrl <- Hibernate
+	ctrl <- Shutdown
+	evt, received := nextEvent(nil, ctrl)
+	assert.True(t, received)
+	assert.Equal(t, Shutdown, evt)
+
+	timer := time.NewTimer(time.Millisecond)
+	_, received = nextEvent(timer.C, make(chan ControlEvent))
+	assert.False(t, received)
+}
+
+func TestHibernateReloadChecksKey(t *testing.T) {
+	common.SetProgramDirectory(t.TempDir())
+	t.Cleanup(func() { common.SetProgramDirectory("") })
+
+	var valid atomic.Bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if valid.Load() {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	cfg := &config.Config{APIUrl: server.URL, APIKey: "test-key"}
+	a := New(WithConfig(cfg))
+	a.client = api.NewClient(*cfg, false)
+
+	// Still rejected, the reload doesn't end the hibernation
+	ctrl := make(chan ControlEvent, 2)
+	ctrl <- Reload
+	ctrl <- Shutdown
+	exit, err := a.hibernate(ctrl)
+	assert.True(t, exit)
+	assert.NoError(t, err)
+	assert.True(t, loadHibernation().active())
+
+	// The reload fixed the key, the hibernation is over for good
+	valid.Store(true)
+	ctrl <- Reload
+	exit, err = a.hibernate(ctrl)
+	assert.False(t, exit)
+	assert.NoError(t, err)
+	assert.False(t, loadHibernation().active())
+}
@@ -0,0 +1,52 @@
+package manager
+
+import (
+	"time"
+
+	"agent/internal/logger"
+	"agent/internal/selfstats"
+	"agent/internal/updater"
+)
+
+// integrityCheckInterval is the time between two checks of the agent binary
+const integrityCheckInterval = time.Hour
+
+var binaryModified = selfstats.NewGauge("agent_binary_modified", nil)
+
+// watchIntegrity checks the agent binary against the checksum recorded at
+// install or update until stopped is closed. A binary changed outside the updater,
+// by tampering or a botched manual copy, is reported as an event once per
+// new checksum.
+func (a *Agent) watchIntegrity(stopped <-chan struct{}) {
+	ticker := time.NewTicker(integrityCheckInterval)
+	defer ticker.Stop()
+
+	var reported string
+	for {
+		integrity, err := updater.CheckIntegrity()
+		switch {
+		case err != nil:
+			logger.Log.Warn("failed to check the agent binary integrity", "error", err)
+		case integrity.Modified():
+			binaryModified.Set(1)
+			if integrity.Current != reported {
+				reported = integrity.Current
+				logger.Log.Warn("Agent binary modified outside the updater", "path", integrity.Path, "recorded", integrity.Recorded, "current", integrity.Current)
+				a.events.emit("binary_modified", "The agent binary was modified outside the updater", map[string]string{
+					"path":     integrity.Path,
+					"recorded": integrity.Recorded,
+					"current":  integrity.Current,
+				})
+			}
+		default:
+			binaryModified.Set(0)
+			reported = ""
+		}
+
+		select {
+		case <-stopped:
+			return
+		case <-ticker.C:
+		}
+	}
+}
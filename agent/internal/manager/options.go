@@ -0,0 +1,111 @@
+package manager
+
+import (
+	"slices"
+	"time"
+
+	"agent/internal/common"
+	"agent/internal/config"
+	"agent/internal/exporter"
+	"agent/internal/hostinfo"
+)
+
+// Option configures an Agent created with New.
+type Option func(*Agent)
+
+// WithConfig sets the agent configuration. Without it, the agent starts with
+// an empty configuration.
+func WithConfig(cfg *config.Config) Option {
+	return func(a *Agent) {
+		a.config = cfg
+	}
+}
+
+// WithDryRun makes the agent collect for a short while and print what it
+// collects instead of sending it.
+func WithDryRun(dryRun bool) Option {
+	return func(a *Agent) {
+		a.dryRun = dryRun
+	}
+}
+
+// WithDryRunDuration sets how long a dry run collects, 20s by default.
+func WithDryRunDuration(d time.Duration) Option {
+	return func(a *Agent) {
+		a.dryRunDuration = d
+	}
+}
+
+// WithDryRunInterval sets the metrics collection interval of a dry run, 3s
+// by default.
+func WithDryRunInterval(d time.Duration) Option {
+	return func(a *Agent) {
+		a.dryRunInterval = d
+	}
+}
+
+// WithDryRunOutput sets how a dry run prints what it collects, one of
+// DryRunFormats. Output goes to stdout.
+func WithDryRunOutput(format string) Option {
+	return func(a *Agent) {
+		a.dryRunFormat = format
+	}
+}
+
+// WithDataDir makes the agent keep its state in dir instead of next to the
+// executable. The directory is shared by the whole process.
+func WithDataDir(dir string) Option {
+	return func(a *Agent) {
+		common.SetProgramDirectory(dir)
+	}
+}
+
+// WithCollectors restricts the metric and log collectors started to the ones
+// named, on top of the collection config.
+func WithCollectors(names ...string) Option {
+	return func(a *Agent) {
+		a.collectors = slices.Clone(names)
+	}
+}
+
+// WithSink registers a sink receiving a copy of everything exported.
+func WithSink(sink exporter.Sink) Option {
+	return func(a *Agent) {
+		a.sinks = append(a.sinks, sink)
+	}
+}
+
+// WithHostInfo sets the host info gathered before the start, reported by the
+// first discovery instead of gathering it again.
+func WithHostInfo(info *hostinfo.HostInfo) Option {
+	return func(a *Agent) {
+		a.hostInfo = info
+	}
+}
+
+// WithoutHostInfo stops the agent from reporting the host info to the
+// backend with each discovery.
+func WithoutHostInfo() Option {
+	return func(a *Agent) {
+		a.skipHostInfo = true
+	}
+}
+
+// WithoutDiscovery stops the agent from advertising the available metrics
+// and log sources, the backend keeps the last ones advertised.
+func WithoutDiscovery() Option {
+	return func(a *Agent) {
+		a.skipDiscovery = true
+	}
+}
+
+// keepCollectors returns the collectors named in names, or all of them when
+// names is empty.
+func keepCollectors[T interface{ Name() string }](collectors []T, names []string) []T {
+	if len(names) == 0 {
+		return collectors
+	}
+	return slices.DeleteFunc(collectors, func(c T) bool {
+		return !slices.Contains(names, c.Name())
+	})
+}
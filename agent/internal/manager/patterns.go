@@ -0,0 +1,72 @@
+package manager
+
+import (
+	"os"
+	"path/filepath"
+
+	"agent/internal/api"
+	"agent/internal/collection"
+	"agent/internal/common"
+	"agent/internal/logger"
+	"agent/internal/logs/patterns"
+)
+
+// patternsFilename keeps the last pattern bundle loaded, loaded again on
+// startup
+const patternsFilename = "patterns.json"
+
+func patternsPath() (string, error) {
+	programDir, err := common.GetProgramDirectory()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(programDir, patternsFilename), nil
+}
+
+// loadSavedPatterns loads the bundle saved by a previous run, the built-in
+// patterns are kept when it's missing or invalid
+func loadSavedPatterns() {
+	if patterns.Version() > 0 {
+		return
+	}
+	path, err := patternsPath()
+	if err != nil {
+		return
+	}
+	version, err := patterns.LoadFile(path)
+	if err != nil {
+		logger.Log.Warn("Ignoring saved pattern bundle", "error", err)
+		return
+	}
+	if version > 0 {
+		logger.Log.Info("Loaded saved pattern bundle", "version", version)
+	}
+}
+
+// syncPatterns downloads and loads the pattern bundle when the backend
+// announces a newer one. The collectors use it for the next lines, the
+// parse stages once rebuilt on the next reload.
+func syncPatterns(client *api.Client, cfg *collection.CollectionConfig) {
+	if cfg == nil || cfg.PatternsVersion <= patterns.Version() {
+		return
+	}
+	data, err := client.GetPatternBundle()
+	if err != nil {
+		logger.Log.Warn("Failed to download pattern bundle", "version", cfg.PatternsVersion, "error", err)
+		return
+	}
+	version, err := patterns.Load(data)
+	if err != nil {
+		logger.Log.Error("Rejected pattern bundle", "version", cfg.PatternsVersion, "error", err)
+		return
+	}
+	logger.Log.Info("Loaded pattern bundle", "version", version)
+
+	path, err := patternsPath()
+	if err != nil {
+		return
+	}
+	if err := os.WriteFile(path, data, 0o640); err != nil {
+		logger.Log.Warn("Failed to save pattern bundle", "error", err)
+	}
+}
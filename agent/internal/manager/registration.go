@@ -0,0 +1,115 @@
+package manager
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"agent/internal/api"
+	"agent/internal/common"
+	"agent/internal/config"
+	"agent/internal/logger"
+	"agent/internal/transport"
+)
+
+// registrationFilename keeps the hashes of the host info and of the sets
+// last accepted by the backend, so that a restart doesn't post them again
+const registrationFilename = "registration.json"
+
+// registration holds the hashes of what the backend accepted, empty until it
+// accepted it
+type registration struct {
+	HostInfo   string `json:"host_info,omitempty"`
+	Metrics    string `json:"metrics,omitempty"`
+	LogSources string `json:"log_sources,omitempty"`
+}
+
+func registrationPath() (string, error) {
+	programDir, err := common.GetProgramDirectory()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(programDir, registrationFilename), nil
+}
+
+// persistRegistration makes the discovery skip what the backend accepted
+// before a restart. With force, everything is posted again once.
+func (d *Discovery) persistRegistration(force bool) {
+	path, err := registrationPath()
+	if err != nil {
+		return
+	}
+	d.statePath = path
+	if force {
+		return
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return
+	}
+	if err := json.Unmarshal(data, &d.registered); err != nil {
+		logger.Log.Warn("Ignoring corrupted registration state", "error", err)
+		d.registered = registration{}
+	}
+}
+
+// saveRegistration records what the backend accepted
+func (d *Discovery) saveRegistration() {
+	if d.statePath == "" {
+		return
+	}
+	data, err := json.Marshal(d.registered)
+	if err != nil {
+		return
+	}
+	if err := os.WriteFile(d.statePath, data, 0o640); err != nil {
+		logger.Log.Warn("failed to save registration state", "error", err)
+	}
+}
+
+// hashValue returns the hash of a value marshaled to JSON
+func hashValue(v any) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return ""
+	}
+	return fmt.Sprintf("%x", sha256.Sum256(data))
+}
+
+// hashSet returns the hash of the keys of a set, the values discovered
+// aren't part of the identity of a metric or log source
+func hashSet[T any](set map[string]T) string {
+	return hashValue(sortedKeys(set))
+}
+
+// Register reports the host info and the available metrics and log sources
+// once, whether they changed or not, e.g. to register a host explicitly
+// before the agent starts.
+func Register(ctx context.Context, cfg *config.Config) error {
+	transport.Configure(cfg.Network)
+	d := NewDiscovery(api.NewClient(*cfg, false), &sync.WaitGroup{}, cfg)
+	d.persistRegistration(true)
+	d.publish(ctx)
+	if d.registered.HostInfo == "" || d.registered.Metrics == "" || d.registered.LogSources == "" {
+		return errors.New("the backend didn't accept the registration, see the logs")
+	}
+	return nil
+}
+
+// ForgetRegistration removes the state of the registration, e.g. before the
+// agent is baked into a machine image, so that every instance registers
+func ForgetRegistration() error {
+	path, err := registrationPath()
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to remove registration state: %w", err)
+	}
+	return nil
+}
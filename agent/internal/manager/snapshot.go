@@ -0,0 +1,60 @@
+package manager
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"runtime"
+	"sort"
+
+	"agent/internal/api"
+	"agent/internal/collection"
+	"agent/internal/config"
+	"agent/internal/logs"
+	"agent/internal/metrics"
+	"agent/internal/version"
+)
+
+// buildConfigSnapshot describes the effective configuration of the agent:
+// the local configuration with secrets masked and the collectors enabled by
+// the collection config.
+func buildConfigSnapshot(
+	cfg *config.Config,
+	clcCfg *collection.CollectionConfig,
+	metricsCollectors []metrics.MetricCollector,
+	logsCollectors []logs.LogCollector,
+) api.ConfigSnapshot {
+	snapshot := api.ConfigSnapshot{
+		HostID:           cfg.HostID,
+		AgentVersion:     version.Version,
+		GoVersion:        runtime.Version(),
+		OS:               runtime.GOOS,
+		Arch:             runtime.GOARCH,
+		Config:           cfg.Sanitized(),
+		MetricCollectors: []string{},
+		LogCollectors:    []string{},
+	}
+	for _, c := range metricsCollectors {
+		snapshot.MetricCollectors = append(snapshot.MetricCollectors, c.Name())
+	}
+	for _, c := range logsCollectors {
+		snapshot.LogCollectors = append(snapshot.LogCollectors, c.Name())
+	}
+	sort.Strings(snapshot.MetricCollectors)
+	sort.Strings(snapshot.LogCollectors)
+	if clcCfg != nil {
+		snapshot.CollectionConfigHash, _ = clcCfg.Hash()
+	}
+	return snapshot
+}
+
+// snapshotHash identifies a snapshot, so that an unchanged configuration is
+// not sent again after a reload.
+func snapshotHash(snapshot api.ConfigSnapshot) (string, error) {
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
@@ -0,0 +1,181 @@
+package metrics
+
+import (
+	"math"
+	"slices"
+	"strings"
+	"time"
+
+	"agent/internal/collection"
+	"agent/internal/config"
+)
+
+const (
+	defaultAdaptiveIdleCycles  = 5
+	defaultAdaptiveMaxInterval = 10 * time.Minute
+)
+
+// AdaptiveSampler lowers the export frequency of gauges whose value stays the
+// same. Values are still collected every cycle, so a series goes back to full
+// frequency as soon as its value moves beyond the tolerance or crosses one of
+// the thresholds of the metric, compared to the last exported value.
+//
+// Counters are always exported. The type of a metric is the one advertised
+// by its collector, metrics of unknown type (e.g. derived ones) are counters
+// when their name ends with "_total".
+type AdaptiveSampler struct {
+	idleCycles int
+	maxStep    int
+	tolerance  float64
+	thresholds map[string][]float64
+	types      map[string]string
+	series     map[string]*seriesState
+}
+
+type seriesState struct {
+	// last exported value
+	last float64
+	// number of consecutive collections without change
+	idle int
+	// current backoff step, in number of collection intervals
+	step int
+	// collections left to skip before the next export
+	countdown int
+	seen      bool
+}
+
+// NewAdaptiveSampler returns a sampler for the given collection interval, or
+// nil when adaptive collection is disabled.
+func NewAdaptiveSampler(cfg config.AdaptiveCollectionConfig, interval time.Duration) *AdaptiveSampler {
+	if !cfg.Enabled || interval <= 0 {
+		return nil
+	}
+	idleCycles := cfg.IdleCycles
+	if idleCycles <= 0 {
+		idleCycles = defaultAdaptiveIdleCycles
+	}
+	maxInterval := time.Duration(cfg.MaxIntervalSeconds) * time.Second
+	if maxInterval <= 0 {
+		maxInterval = defaultAdaptiveMaxInterval
+	}
+	maxStep := max(int(maxInterval/interval), 1)
+	return &AdaptiveSampler{
+		idleCycles: idleCycles,
+		maxStep:    maxStep,
+		tolerance:  max(cfg.Tolerance, 0),
+		thresholds: cfg.Thresholds,
+		types:      make(map[string]string),
+		series:     make(map[string]*seriesState),
+	}
+}
+
+// SetMetricTypes records the type of the metrics selected for a collector
+func (s *AdaptiveSampler) SetMetricTypes(metrics []collection.Metric) {
+	if s == nil {
+		return
+	}
+	for _, m := range metrics {
+		if m.Type != "" {
+			s.types[m.Name] = m.Type
+		}
+	}
+}
+
+func (s *AdaptiveSampler) isCounter(name string) bool {
+	if metricType, ok := s.types[name]; ok {
+		return metricType == "counter"
+	}
+	return strings.HasSuffix(name, "_total")
+}
+
+// Filter returns the data points that should be exported for this cycle.
+func (s *AdaptiveSampler) Filter(dps []DataPoint) []DataPoint {
+	if s == nil {
+		return dps
+	}
+	for _, state := range s.series {
+		state.seen = false
+	}
+
+	out := make([]DataPoint, 0, len(dps))
+	for _, dp := range dps {
+		if s.isCounter(dp.Name) {
+			out = append(out, dp)
+			continue
+		}
+		key := seriesKey(dp)
+		state, ok := s.series[key]
+		if !ok {
+			s.series[key] = &seriesState{last: dp.Value, step: 1, seen: true}
+			out = append(out, dp)
+			continue
+		}
+		state.seen = true
+		if s.changed(state.last, dp.Value) || s.crossed(dp.Name, state.last, dp.Value) {
+			state.last = dp.Value
+			state.idle = 0
+			state.step = 1
+			state.countdown = 0
+			out = append(out, dp)
+			continue
+		}
+		state.idle++
+		if state.idle < s.idleCycles {
+			out = append(out, dp)
+			continue
+		}
+		if state.countdown > 0 {
+			state.countdown--
+			continue
+		}
+		state.step = min(state.step*2, s.maxStep)
+		state.countdown = state.step - 1
+		out = append(out, dp)
+	}
+
+	// Forget series that disappeared
+	for key, state := range s.series {
+		if !state.seen {
+			delete(s.series, key)
+		}
+	}
+	return out
+}
+
+func (s *AdaptiveSampler) changed(last, current float64) bool {
+	if math.IsNaN(last) || math.IsNaN(current) {
+		return math.IsNaN(last) != math.IsNaN(current)
+	}
+	if s.tolerance == 0 || last == 0 {
+		return last != current
+	}
+	return math.Abs(current-last) > s.tolerance*math.Abs(last)
+}
+
+// crossed reports whether a threshold of the metric lies between the last
+// exported value and the current one
+func (s *AdaptiveSampler) crossed(name string, last, current float64) bool {
+	for _, threshold := range s.thresholds[name] {
+		if (last < threshold) != (current < threshold) {
+			return true
+		}
+	}
+	return false
+}
+
+func seriesKey(dp DataPoint) string {
+	var b strings.Builder
+	b.WriteString(dp.Name)
+	keys := make([]string, 0, len(dp.Labels))
+	for k := range dp.Labels {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	for _, k := range keys {
+		b.WriteByte(0)
+		b.WriteString(k)
+		b.WriteByte('=')
+		b.WriteString(dp.Labels[k])
+	}
+	return b.String()
+}
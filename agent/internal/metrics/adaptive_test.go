@@ -0,0 +1,108 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"agent/internal/collection"
+	"agent/internal/config"
+)
+
+func runCycles(s *AdaptiveSampler, values []float64, name string) []bool {
+	exported := make([]bool, len(values))
+	for i, v := range values {
+		out := s.Filter([]DataPoint{{Name: name, Value: v, Labels: map[string]string{"mountpoint": "/"}}})
+		exported[i] = len(out) == 1
+	}
+	return exported
+}
+
+func TestAdaptiveSamplerDisabled(t *testing.T) {
+	s := NewAdaptiveSampler(config.AdaptiveCollectionConfig{}, time.Minute)
+	assert.Nil(t, s)
+
+	dps := []DataPoint{{Name: "mem_used_bytes", Value: 1}}
+	assert.Equal(t, dps, s.Filter(dps))
+}
+
+func TestAdaptiveSamplerBacksOff(t *testing.T) {
+	s := NewAdaptiveSampler(config.AdaptiveCollectionConfig{
+		Enabled:            true,
+		IdleCycles:         2,
+		MaxIntervalSeconds: 240,
+	}, time.Minute)
+
+	values := make([]float64, 14)
+	exported := runCycles(s, values, "disk_used_bytes")
+
+	assert.Equal(t, []bool{
+		true, true, // first value, then under idle threshold
+		true,        // step 2
+		false, true, // step 4
+		false, false, false, true, // step 4 (ceiling)
+		false, false, false, true,
+		false,
+	}, exported)
+}
+
+func TestAdaptiveSamplerRestoresOnChange(t *testing.T) {
+	s := NewAdaptiveSampler(config.AdaptiveCollectionConfig{Enabled: true, IdleCycles: 1}, time.Minute)
+
+	exported := runCycles(s, []float64{1, 1, 1, 1, 2, 2}, "disk_used_bytes")
+	assert.Equal(t, []bool{true, true, false, true, true, true}, exported)
+}
+
+func TestAdaptiveSamplerTolerance(t *testing.T) {
+	s := NewAdaptiveSampler(config.AdaptiveCollectionConfig{
+		Enabled:    true,
+		IdleCycles: 1,
+		Tolerance:  0.1,
+	}, time.Minute)
+
+	// Small variations are ignored until the drift crosses the tolerance
+	exported := runCycles(s, []float64{100, 101, 104, 106, 108, 111}, "cpu_usage_ratio")
+	assert.Equal(t, []bool{true, true, false, true, false, true}, exported)
+}
+
+func TestAdaptiveSamplerKeepsCounters(t *testing.T) {
+	s := NewAdaptiveSampler(config.AdaptiveCollectionConfig{Enabled: true, IdleCycles: 1}, time.Minute)
+
+	exported := runCycles(s, []float64{3, 3, 3, 3}, "cron_job_failures_total")
+	assert.Equal(t, []bool{true, true, true, true}, exported)
+}
+
+func TestAdaptiveSamplerForgetsSeries(t *testing.T) {
+	s := NewAdaptiveSampler(config.AdaptiveCollectionConfig{Enabled: true}, time.Minute)
+
+	s.Filter([]DataPoint{{Name: "a"}, {Name: "b"}})
+	s.Filter([]DataPoint{{Name: "a"}})
+	assert.Len(t, s.series, 1)
+}
+
+func TestAdaptiveSamplerUsesMetricTypes(t *testing.T) {
+	s := NewAdaptiveSampler(config.AdaptiveCollectionConfig{Enabled: true, IdleCycles: 1}, time.Minute)
+	s.SetMetricTypes([]collection.Metric{
+		{Name: "net_rx_bytes", Type: "counter"},
+		{Name: "queue_drained_total", Type: "gauge"},
+	})
+
+	exported := runCycles(s, []float64{3, 3, 3, 3}, "net_rx_bytes")
+	assert.Equal(t, []bool{true, true, true, true}, exported)
+	exported = runCycles(s, []float64{3, 3, 3, 3}, "queue_drained_total")
+	assert.Equal(t, []bool{true, true, false, true}, exported)
+}
+
+func TestAdaptiveSamplerRestoresOnThresholdCrossing(t *testing.T) {
+	s := NewAdaptiveSampler(config.AdaptiveCollectionConfig{
+		Enabled:    true,
+		IdleCycles: 1,
+		Tolerance:  0.1,
+		Thresholds: map[string][]float64{"cpu_usage_ratio": {0.9}},
+	}, time.Minute)
+
+	// 0.88 -> 0.91 is within the tolerance but crosses 0.9
+	exported := runCycles(s, []float64{0.88, 0.88, 0.88, 0.91, 0.91}, "cpu_usage_ratio")
+	assert.Equal(t, []bool{true, true, false, true, true}, exported)
+}
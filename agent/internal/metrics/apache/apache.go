@@ -3,7 +3,9 @@ package apache
 import (
 	"bufio"
 	"fmt"
+	"maps"
 	"net/http"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
@@ -66,6 +68,24 @@ type apacheStats struct {
 	ConnectionsWriting    *float64
 	ConnectionsKeepAlive  *float64
 	ConnectionsClosing    *float64
+	// Scoreboard is the number of worker slots by state, nil when the
+	// status page has no scoreboard
+	Scoreboard map[string]float64
+}
+
+// scoreboardStates names the states of the worker slots of the scoreboard
+var scoreboardStates = map[rune]string{
+	'_': "waiting",
+	'S': "starting",
+	'R': "reading",
+	'W': "sending",
+	'K': "keepalive",
+	'D': "dns_lookup",
+	'C': "closing",
+	'L': "logging",
+	'G': "finishing",
+	'I': "idle_cleanup",
+	'.': "open",
 }
 
 // apacheMetrics list the available metrics inside the apache package
@@ -149,6 +169,14 @@ func (c *ApacheCollector) CollectAll() ([]metrics.DataPoint, error) {
 			Labels:    map[string]string{},
 		})
 	}
+	for _, state := range slices.Sorted(maps.Keys(stats.Scoreboard)) {
+		results = append(results, metrics.DataPoint{
+			Name:      "apache_scoreboard_workers",
+			Timestamp: stats.Timestamp,
+			Value:     stats.Scoreboard[state],
+			Labels:    map[string]string{"state": state},
+		})
+	}
 
 	return results, nil
 }
@@ -170,6 +198,13 @@ func (c *ApacheCollector) Discover() ([]collection.Metric, error) {
 			Labels: map[string]string{},
 		})
 	}
+	for _, state := range slices.Sorted(maps.Keys(stats.Scoreboard)) {
+		discovered = append(discovered, collection.Metric{
+			Name:   "apache_scoreboard_workers",
+			Type:   "gauge",
+			Labels: map[string]string{"state": state},
+		})
+	}
 	return discovered, nil
 }
 
@@ -203,6 +238,12 @@ func parseServerStatus(body string) (*apacheStats, error) {
 		key := strings.TrimSpace(parts[0])
 		valueStr := strings.TrimSpace(parts[1])
 
+		if key == "Scoreboard" {
+			stats.Scoreboard = parseScoreboard(valueStr)
+			foundKnownField = true
+			continue
+		}
+
 		val, err := strconv.ParseFloat(valueStr, 64)
 		if err != nil {
 			continue
@@ -252,3 +293,18 @@ func parseServerStatus(body string) (*apacheStats, error) {
 
 	return stats, nil
 }
+
+// parseScoreboard counts the worker slots of each state, every state is
+// reported even when no slot is in it, so that the series don't come and go
+func parseScoreboard(scoreboard string) map[string]float64 {
+	counts := make(map[string]float64, len(scoreboardStates))
+	for _, state := range scoreboardStates {
+		counts[state] = 0
+	}
+	for _, r := range scoreboard {
+		if state, ok := scoreboardStates[r]; ok {
+			counts[state]++
+		}
+	}
+	return counts
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"io"
 	"log/slog"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -57,7 +58,7 @@ func TestApacheCollector(t *testing.T) {
 	dps, err := c.CollectAll()
 	require.NoError(t, err)
 
-	assert.Len(t, dps, 10)
+	assert.Len(t, dps, 10+len(scoreboardStates))
 	assertContainsMetric(t, dps, "apache_requests_total", 129811861.0)
 	assertContainsMetric(t, dps, "apache_requests_rate", 137.87)
 	assertContainsMetric(t, dps, "apache_bytes_total", 5213701865.0*1024.0)
@@ -68,6 +69,18 @@ func TestApacheCollector(t *testing.T) {
 	assertContainsMetric(t, dps, "apache_connections_writing_total", 32.0)
 	assertContainsMetric(t, dps, "apache_connections_keepalive_total", 945.0)
 	assertContainsMetric(t, dps, "apache_connections_closing_total", 205.0)
+
+	_, apacheScoreboard, _ := strings.Cut(apacheStatusBody, "Scoreboard: ")
+	scoreboard := map[string]float64{}
+	for _, dp := range dps {
+		if dp.Name == "apache_scoreboard_workers" {
+			scoreboard[dp.Labels["state"]] = dp.Value
+		}
+	}
+	assert.Equal(t, 0.0, scoreboard["keepalive"])
+	assert.Equal(t, float64(strings.Count(apacheScoreboard, "W")), scoreboard["sending"])
+	assert.Equal(t, float64(strings.Count(apacheScoreboard, "_")), scoreboard["waiting"])
+	assert.Equal(t, float64(strings.Count(apacheScoreboard, ".")), scoreboard["open"])
 }
 
 func TestApacheCollector_Discover(t *testing.T) {
@@ -81,7 +94,7 @@ func TestApacheCollector_Discover(t *testing.T) {
 
 	discovered, err := c.Discover()
 	require.NoError(t, err)
-	require.Len(t, discovered, 10)
+	require.Len(t, discovered, 10+len(scoreboardStates))
 
 	assert.Equal(t, "apache_requests_total", discovered[0].Name)
 	assert.Equal(t, "apache_requests_rate", discovered[1].Name)
@@ -93,6 +106,8 @@ func TestApacheCollector_Discover(t *testing.T) {
 	assert.Equal(t, "apache_connections_writing_total", discovered[7].Name)
 	assert.Equal(t, "apache_connections_keepalive_total", discovered[8].Name)
 	assert.Equal(t, "apache_connections_closing_total", discovered[9].Name)
+	assert.Equal(t, "apache_scoreboard_workers", discovered[10].Name)
+	assert.Equal(t, "closing", discovered[10].Labels["state"])
 }
 
 func TestApacheCollector_Errors(t *testing.T) {
@@ -10,13 +10,18 @@ func (b *BaseCollector) SetIncludedMetrics(metrics []collection.Metric) {
 	b.includedMetrics = metrics
 }
 
+// IncludedMetrics returns the metrics selected in the collection config
+func (b *BaseCollector) IncludedMetrics() []collection.Metric {
+	return b.includedMetrics
+}
+
 // TODO: Use some sort of cache to avoid iterating over all the included metrics
 func (b *BaseCollector) IsIncluded(name string, labels map[string]string) bool {
 	for _, included := range b.includedMetrics {
 		if name != included.Name {
 			continue
 		}
-		if labelsEqual(labels, included.Labels) {
+		if labelsMatch(labels, labelPattern(included)) {
 			return true
 		}
 	}
@@ -34,3 +39,45 @@ func labelsEqual(a, b map[string]string) bool {
 	}
 	return true
 }
+
+// WildcardLabelValue matches any value of a label in the included metrics, a
+// metric advertised with it stands for all its label sets with the same keys.
+const WildcardLabelValue = "*"
+
+// labelsMatch reports whether labels have the same keys as pattern and the
+// same values, except where the pattern value is the wildcard.
+func labelsMatch(labels, pattern map[string]string) bool {
+	if len(labels) != len(pattern) {
+		return false
+	}
+	for k, want := range pattern {
+		got, ok := labels[k]
+		if !ok || (want != WildcardLabelValue && got != want) {
+			return false
+		}
+	}
+	return true
+}
+
+// labelPattern returns the labels an included metric matches. A template may
+// list its label keys only, they then match any value.
+func labelPattern(m collection.Metric) map[string]string {
+	if len(m.Labels) > 0 || len(m.LabelKeys) == 0 {
+		return m.Labels
+	}
+	pattern := make(map[string]string, len(m.LabelKeys))
+	for _, k := range m.LabelKeys {
+		pattern[k] = WildcardLabelValue
+	}
+	return pattern
+}
+
+// isTemplate reports whether the labels hold a wildcard
+func isTemplate(labels map[string]string) bool {
+	for _, v := range labels {
+		if v == WildcardLabelValue {
+			return true
+		}
+	}
+	return false
+}
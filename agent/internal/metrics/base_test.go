@@ -14,6 +14,8 @@ func TestBaseCollector_IsIncluded(t *testing.T) {
 	included := []collection.Metric{
 		{Name: "cpu_user_ratio", Labels: map[string]string{"cpu": "total"}},
 		{Name: "mem_used_bytes", Labels: map[string]string{}},
+		{Name: "net_received_bytes_total", Labels: map[string]string{"interface": "*", "direction": "in"}},
+		{Name: "disk_used_ratio", LabelKeys: []string{"device", "mountpoint"}},
 	}
 	bc.SetIncludedMetrics(included)
 
@@ -47,6 +49,36 @@ func TestBaseCollector_IsIncluded(t *testing.T) {
 			labels:   map[string]string{},
 			expected: false,
 		},
+		{
+			name:     "Wildcard label value",
+			metric:   "net_received_bytes_total",
+			labels:   map[string]string{"interface": "eth1", "direction": "in"},
+			expected: true,
+		},
+		{
+			name:     "Wildcard with other label mismatch",
+			metric:   "net_received_bytes_total",
+			labels:   map[string]string{"interface": "eth1", "direction": "out"},
+			expected: false,
+		},
+		{
+			name:     "Wildcard with missing label",
+			metric:   "net_received_bytes_total",
+			labels:   map[string]string{"direction": "in"},
+			expected: false,
+		},
+		{
+			name:     "Template with label keys only",
+			metric:   "disk_used_ratio",
+			labels:   map[string]string{"device": "sdb", "mountpoint": "/data"},
+			expected: true,
+		},
+		{
+			name:     "Template with other label keys",
+			metric:   "disk_used_ratio",
+			labels:   map[string]string{"device": "sdb"},
+			expected: false,
+		},
 		{
 			name:     "Empty labels vs nil labels",
 			metric:   "mem_used_bytes",
@@ -0,0 +1,137 @@
+package battery
+
+import (
+	"time"
+
+	"agent/internal/collection"
+	"agent/internal/logger"
+	"agent/internal/metrics"
+)
+
+// batteryState is the state of a single battery
+type batteryState struct {
+	Name     string
+	Charge   float64 // Ratio in [0, 1]
+	Charging bool
+	// TimeRemaining is the estimated time to empty when discharging, or to
+	// full when charging. Negative when unknown.
+	TimeRemaining time.Duration
+}
+
+// powerStatus is an internal type used to store the power sources of the host
+type powerStatus struct {
+	Batteries []batteryState
+	// ACOnline is nil when the host does not report its external supply
+	ACOnline *bool
+}
+
+type PowerPS interface {
+	PowerStatus() (*powerStatus, error)
+}
+
+// batteryMetrics list the metrics reported for each battery
+var batteryMetrics = []struct {
+	name   string
+	getVal func(b *batteryState) (float64, bool)
+}{
+	{"battery_charge_ratio", func(b *batteryState) (float64, bool) { return b.Charge, true }},
+	{"battery_charging", func(b *batteryState) (float64, bool) { return boolToFloat(b.Charging), true }},
+	{"battery_time_remaining_seconds", func(b *batteryState) (float64, bool) {
+		return b.TimeRemaining.Seconds(), b.TimeRemaining >= 0
+	}},
+}
+
+// BatteryCollector reports battery charge and AC power presence on laptops
+// and battery backed edge devices.
+type BatteryCollector struct {
+	metrics.BaseCollector
+
+	ps PowerPS
+}
+
+func NewBatteryCollector() *BatteryCollector {
+	return &BatteryCollector{ps: newSystemPS()}
+}
+
+func (c *BatteryCollector) Name() string {
+	return "battery"
+}
+
+func (c *BatteryCollector) Collect() ([]metrics.DataPoint, error) {
+	all, err := c.CollectAll()
+	if err != nil {
+		return nil, err
+	}
+	var included []metrics.DataPoint
+	for _, dp := range all {
+		if c.IsIncluded(dp.Name, dp.Labels) {
+			included = append(included, dp)
+		}
+	}
+	return included, nil
+}
+
+func (c *BatteryCollector) CollectAll() ([]metrics.DataPoint, error) {
+	status, err := c.ps.PowerStatus()
+	if err != nil {
+		logger.Log.Debug("Failed to collect metrics", "collector", c.Name(), "error", err)
+		return nil, nil
+	}
+	return buildDataPoints(status, time.Now().UnixMilli()), nil
+}
+
+func buildDataPoints(status *powerStatus, ts int64) []metrics.DataPoint {
+	var results []metrics.DataPoint
+	// Servers have neither a battery nor a reported AC adapter, the AC state
+	// alone is not worth a series there
+	if len(status.Batteries) == 0 {
+		return nil
+	}
+	for i := range status.Batteries {
+		b := &status.Batteries[i]
+		for _, m := range batteryMetrics {
+			val, ok := m.getVal(b)
+			if !ok {
+				continue
+			}
+			results = append(results, metrics.DataPoint{
+				Name:      m.name,
+				Timestamp: ts,
+				Value:     val,
+				Labels:    map[string]string{"battery": b.Name},
+			})
+		}
+	}
+	if status.ACOnline != nil {
+		results = append(results, metrics.DataPoint{
+			Name:      "battery_ac_online",
+			Timestamp: ts,
+			Value:     boolToFloat(*status.ACOnline),
+			Labels:    map[string]string{},
+		})
+	}
+	return results
+}
+
+func (c *BatteryCollector) Discover() ([]collection.Metric, error) {
+	status, err := c.ps.PowerStatus()
+	if err != nil {
+		return []collection.Metric{}, nil
+	}
+	discovered := []collection.Metric{}
+	for _, dp := range buildDataPoints(status, 0) {
+		discovered = append(discovered, collection.Metric{
+			Name:   dp.Name,
+			Type:   "gauge",
+			Labels: dp.Labels,
+		})
+	}
+	return discovered, nil
+}
+
+func boolToFloat(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,123 @@
+package battery
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"agent/internal/logger"
+	"agent/internal/metrics"
+)
+
+func init() {
+	logger.Log = slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+type mockPS struct {
+	mock.Mock
+}
+
+func (m *mockPS) PowerStatus() (*powerStatus, error) {
+	args := m.Called()
+	status, _ := args.Get(0).(*powerStatus)
+	return status, args.Error(1)
+}
+
+func writeSupply(t *testing.T, root, name string, files map[string]string) {
+	t.Helper()
+	dir := filepath.Join(root, name)
+	require.NoError(t, os.MkdirAll(dir, 0o755))
+	for file, content := range files {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, file), []byte(content+"\n"), 0o644))
+	}
+}
+
+func findPoint(t *testing.T, dps []metrics.DataPoint, name string) metrics.DataPoint {
+	t.Helper()
+	for _, dp := range dps {
+		if dp.Name == name {
+			return dp
+		}
+	}
+	t.Fatalf("data point %s not found", name)
+	return metrics.DataPoint{}
+}
+
+func TestReadPowerSupplies(t *testing.T) {
+	root := t.TempDir()
+	writeSupply(t, root, "AC", map[string]string{"type": "Mains", "online": "0"})
+	writeSupply(t, root, "BAT0", map[string]string{
+		"type":        "Battery",
+		"status":      "Discharging",
+		"capacity":    "80",
+		"energy_now":  "40000000",
+		"energy_full": "50000000",
+		"power_now":   "10000000",
+	})
+	writeSupply(t, root, "BAT1", map[string]string{
+		"type":        "Battery",
+		"status":      "Charging",
+		"charge_now":  "1000000",
+		"charge_full": "4000000",
+		"current_now": "-1500000",
+	})
+	writeSupply(t, root, "hidpp_battery_0", map[string]string{"type": "Battery", "scope": "Device", "capacity": "10"})
+
+	status, err := readPowerSupplies(root)
+	require.NoError(t, err)
+	require.NotNil(t, status.ACOnline)
+	assert.False(t, *status.ACOnline)
+	require.Len(t, status.Batteries, 2)
+
+	assert.Equal(t, batteryState{Name: "BAT0", Charge: 0.8, TimeRemaining: 4 * time.Hour}, status.Batteries[0])
+	assert.Equal(t, batteryState{Name: "BAT1", Charge: 0.25, Charging: true, TimeRemaining: 2 * time.Hour}, status.Batteries[1])
+}
+
+func TestReadPowerSuppliesMissing(t *testing.T) {
+	_, err := readPowerSupplies(filepath.Join(t.TempDir(), "power_supply"))
+	assert.Error(t, err)
+}
+
+func TestBatteryCollector(t *testing.T) {
+	online := true
+	var mps mockPS
+	mps.On("PowerStatus").Return(&powerStatus{
+		Batteries: []batteryState{{Name: "BAT0", Charge: 0.5, Charging: true, TimeRemaining: -1}},
+		ACOnline:  &online,
+	}, nil)
+
+	c := &BatteryCollector{ps: &mps}
+	dps, err := c.CollectAll()
+	require.NoError(t, err)
+	assert.Equal(t, 0.5, findPoint(t, dps, "battery_charge_ratio").Value)
+	assert.Equal(t, "BAT0", findPoint(t, dps, "battery_charge_ratio").Labels["battery"])
+	assert.Equal(t, 1.0, findPoint(t, dps, "battery_charging").Value)
+	assert.Equal(t, 1.0, findPoint(t, dps, "battery_ac_online").Value)
+	for _, dp := range dps {
+		assert.NotEqual(t, "battery_time_remaining_seconds", dp.Name, "unknown estimates are skipped")
+	}
+}
+
+func TestBatteryCollectorNoBattery(t *testing.T) {
+	online := true
+	var mps mockPS
+	mps.On("PowerStatus").Return(&powerStatus{ACOnline: &online}, nil).Once()
+	mps.On("PowerStatus").Return(nil, errors.New("not supported")).Once()
+
+	c := &BatteryCollector{ps: &mps}
+	dps, err := c.CollectAll()
+	require.NoError(t, err)
+	assert.Empty(t, dps)
+
+	discovered, err := c.Discover()
+	require.NoError(t, err)
+	assert.Empty(t, discovered)
+}
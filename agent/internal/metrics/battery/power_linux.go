@@ -0,0 +1,17 @@
+//go:build linux
+
+package battery
+
+import "agent/internal/common"
+
+type systemPS struct {
+	root string
+}
+
+func newSystemPS() PowerPS {
+	return &systemPS{root: common.HostPath("/sys/class/power_supply")}
+}
+
+func (s *systemPS) PowerStatus() (*powerStatus, error) {
+	return readPowerSupplies(s.root)
+}
@@ -0,0 +1,16 @@
+//go:build !linux && !windows
+// +build !linux,!windows
+
+package battery
+
+import "errors"
+
+type systemPS struct{}
+
+func newSystemPS() PowerPS {
+	return &systemPS{}
+}
+
+func (s *systemPS) PowerStatus() (*powerStatus, error) {
+	return nil, errors.New("battery status is not supported on this platform")
+}
@@ -0,0 +1,71 @@
+//go:build windows
+
+package battery
+
+import (
+	"fmt"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+var (
+	modkernel32              = windows.NewLazySystemDLL("kernel32.dll")
+	procGetSystemPowerStatus = modkernel32.NewProc("GetSystemPowerStatus")
+)
+
+const (
+	acLineOnline     = 1
+	batteryCharging  = 8
+	batteryNoBattery = 128
+	unknownPercent   = 255
+	unknownLifeTime  = 0xFFFFFFFF
+)
+
+// systemPowerStatus is the SYSTEM_POWER_STATUS structure
+type systemPowerStatus struct {
+	ACLineStatus        byte
+	BatteryFlag         byte
+	BatteryLifePercent  byte
+	SystemStatusFlag    byte
+	BatteryLifeTime     uint32
+	BatteryFullLifeTime uint32
+}
+
+type systemPS struct{}
+
+func newSystemPS() PowerPS {
+	return &systemPS{}
+}
+
+func (s *systemPS) PowerStatus() (*powerStatus, error) {
+	var sps systemPowerStatus
+	if r, _, err := procGetSystemPowerStatus.Call(uintptr(unsafe.Pointer(&sps))); r == 0 {
+		return nil, fmt.Errorf("GetSystemPowerStatus failed: %w", err)
+	}
+
+	status := &powerStatus{}
+	// 255 means the AC line status is unknown
+	if sps.ACLineStatus <= 1 {
+		online := sps.ACLineStatus == acLineOnline
+		status.ACOnline = &online
+	}
+	if sps.BatteryFlag&batteryNoBattery != 0 || sps.BatteryFlag == unknownPercent || sps.BatteryLifePercent == unknownPercent {
+		return status, nil
+	}
+
+	// Windows aggregates all batteries into a single status
+	b := batteryState{
+		Name:          "system",
+		Charge:        float64(sps.BatteryLifePercent) / 100,
+		Charging:      sps.BatteryFlag&batteryCharging != 0,
+		TimeRemaining: -1,
+	}
+	// The remaining time is only estimated when running on battery
+	if sps.BatteryLifeTime != unknownLifeTime {
+		b.TimeRemaining = time.Duration(sps.BatteryLifeTime) * time.Second
+	}
+	status.Batteries = append(status.Batteries, b)
+	return status, nil
+}
@@ -0,0 +1,94 @@
+package battery
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// readPowerSupplies reads the Linux power supply class, usually mounted at
+// /sys/class/power_supply. Energy values are in µWh and µW, charge values
+// (reported by some batteries instead) in µAh and µA.
+func readPowerSupplies(root string) (*powerStatus, error) {
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		return nil, err
+	}
+	status := &powerStatus{}
+	for _, entry := range entries {
+		dir := filepath.Join(root, entry.Name())
+		switch readString(dir, "type") {
+		case "Battery":
+			// Peripheral batteries (mice, keyboards) are out of scope
+			if readString(dir, "scope") == "Device" {
+				continue
+			}
+			status.Batteries = append(status.Batteries, readBattery(entry.Name(), dir))
+		case "Mains", "USB", "USB_C":
+			online := readString(dir, "online") == "1"
+			// Any connected external supply powers the host
+			if status.ACOnline == nil || online {
+				status.ACOnline = &online
+			}
+		}
+	}
+	return status, nil
+}
+
+func readBattery(name, dir string) batteryState {
+	b := batteryState{Name: name, TimeRemaining: -1}
+	state := readString(dir, "status")
+	b.Charging = state == "Charging"
+
+	now, full, rate, ok := readLevels(dir)
+	if capacity, err := strconv.ParseFloat(readString(dir, "capacity"), 64); err == nil {
+		b.Charge = capacity / 100
+	} else if ok && full > 0 {
+		b.Charge = now / full
+	}
+
+	if ok && rate > 0 {
+		switch state {
+		case "Discharging":
+			b.TimeRemaining = time.Duration(now / rate * float64(time.Hour))
+		case "Charging":
+			b.TimeRemaining = time.Duration((full - now) / rate * float64(time.Hour))
+		}
+	}
+	if state == "Full" {
+		b.TimeRemaining = 0
+	}
+	return b
+}
+
+// readLevels returns the current and full levels and the flow rate, either
+// as energy or as charge depending on what the battery reports.
+func readLevels(dir string) (now, full, rate float64, ok bool) {
+	for _, prefix := range [][3]string{
+		{"energy_now", "energy_full", "power_now"},
+		{"charge_now", "charge_full", "current_now"},
+	} {
+		n, err1 := strconv.ParseFloat(readString(dir, prefix[0]), 64)
+		f, err2 := strconv.ParseFloat(readString(dir, prefix[1]), 64)
+		if err1 != nil || err2 != nil {
+			continue
+		}
+		r, _ := strconv.ParseFloat(readString(dir, prefix[2]), 64)
+		// Some drivers report a negative current while discharging
+		if r < 0 {
+			r = -r
+		}
+		return n, f, r, true
+	}
+	return 0, 0, 0, false
+}
+
+func readString(dir, name string) string {
+	raw, err := os.ReadFile(filepath.Join(dir, name))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(raw))
+}
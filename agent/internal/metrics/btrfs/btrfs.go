@@ -0,0 +1,274 @@
+package btrfs
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shirou/gopsutil/v4/disk"
+
+	"agent/internal/collection"
+	"agent/internal/logger"
+	"agent/internal/metrics"
+)
+
+const commandTimeout = 10 * time.Second
+
+type BtrfsPS interface {
+	Partitions(all bool) ([]disk.PartitionStat, error)
+	// Usage returns "btrfs filesystem usage -b" output of a mount point.
+	Usage(mountpoint string) ([]byte, error)
+	// DeviceStats returns "btrfs device stats" output of a mount point.
+	DeviceStats(mountpoint string) ([]byte, error)
+	// ScrubStatus returns "btrfs scrub status" output of a mount point.
+	ScrubStatus(mountpoint string) ([]byte, error)
+}
+
+type systemPS struct{}
+
+func (s *systemPS) Partitions(all bool) ([]disk.PartitionStat, error) {
+	return disk.Partitions(all)
+}
+
+func (s *systemPS) Usage(mountpoint string) ([]byte, error) {
+	return run("btrfs", "filesystem", "usage", "-b", mountpoint)
+}
+
+func (s *systemPS) DeviceStats(mountpoint string) ([]byte, error) {
+	return run("btrfs", "device", "stats", mountpoint)
+}
+
+func (s *systemPS) ScrubStatus(mountpoint string) ([]byte, error) {
+	return run("btrfs", "scrub", "status", mountpoint)
+}
+
+func run(name string, args ...string) ([]byte, error) {
+	if _, err := exec.LookPath(name); err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), commandTimeout)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, name, args...).Output()
+	if err != nil {
+		return nil, fmt.Errorf("%s failed: %w", name, err)
+	}
+	return out, nil
+}
+
+// BtrfsCollector reports Btrfs capacity, device error counters and scrub
+// results. Unlike statfs, "btrfs filesystem usage" accounts for the RAID
+// profile and the unallocated space.
+type BtrfsCollector struct {
+	metrics.BaseCollector
+
+	ps BtrfsPS
+}
+
+func NewBtrfsCollector() *BtrfsCollector {
+	return &BtrfsCollector{ps: &systemPS{}}
+}
+
+func (c *BtrfsCollector) Name() string {
+	return "btrfs"
+}
+
+func (c *BtrfsCollector) Collect() ([]metrics.DataPoint, error) {
+	all, err := c.CollectAll()
+	if err != nil {
+		return nil, err
+	}
+	var included []metrics.DataPoint
+	for _, dp := range all {
+		if c.IsIncluded(dp.Name, dp.Labels) {
+			included = append(included, dp)
+		}
+	}
+	return included, nil
+}
+
+func (c *BtrfsCollector) CollectAll() ([]metrics.DataPoint, error) {
+	timestamp := time.Now().UnixMilli()
+	mountpoints, err := c.mountpoints()
+	if err != nil {
+		logger.Log.Debug("Failed to collect metrics", "collector", c.Name(), "error", err)
+		return nil, nil
+	}
+
+	var results []metrics.DataPoint
+	for _, mnt := range mountpoints {
+		labels := map[string]string{"mountpoint": mnt}
+		if out, err := c.ps.Usage(mnt); err == nil {
+			results = append(results, usageDataPoints(out, labels, timestamp)...)
+		} else {
+			logger.Log.Debug("Failed to read btrfs usage", "collector", c.Name(), "mountpoint", mnt, "error", err)
+			continue
+		}
+		if out, err := c.ps.DeviceStats(mnt); err == nil {
+			results = append(results, deviceStatsDataPoints(out, mnt, timestamp)...)
+		}
+		if out, err := c.ps.ScrubStatus(mnt); err == nil {
+			results = append(results, scrubDataPoints(out, labels, timestamp)...)
+		}
+	}
+	return results, nil
+}
+
+func (c *BtrfsCollector) Discover() ([]collection.Metric, error) {
+	all, err := c.CollectAll()
+	if err != nil {
+		return nil, err
+	}
+	discovered := []collection.Metric{}
+	for _, dp := range all {
+		discovered = append(discovered, collection.Metric{
+			Name:   dp.Name,
+			Type:   "gauge",
+			Labels: dp.Labels,
+		})
+	}
+	return discovered, nil
+}
+
+// mountpoints returns a single mount point per btrfs filesystem, subvolumes
+// of the same device share their counters.
+func (c *BtrfsCollector) mountpoints() ([]string, error) {
+	partitions, err := c.ps.Partitions(false)
+	if err != nil {
+		return nil, err
+	}
+	var mountpoints []string
+	seen := make(map[string]struct{})
+	for _, p := range partitions {
+		if p.Fstype != "btrfs" {
+			continue
+		}
+		if _, ok := seen[p.Device]; ok {
+			continue
+		}
+		seen[p.Device] = struct{}{}
+		mountpoints = append(mountpoints, p.Mountpoint)
+	}
+	return mountpoints, nil
+}
+
+// btrfsUsageMetrics maps "btrfs filesystem usage" overall fields to metrics
+var btrfsUsageMetrics = []struct {
+	name  string
+	field string
+}{
+	{"btrfs_size_bytes", "Device size"},
+	{"btrfs_allocated_bytes", "Device allocated"},
+	{"btrfs_unallocated_bytes", "Device unallocated"},
+	{"btrfs_used_bytes", "Used"},
+	{"btrfs_free_bytes", "Free (estimated)"},
+}
+
+// usageDataPoints parses the "Overall" section of "btrfs filesystem usage -b":
+//
+//	Overall:
+//	    Device size:                  21474836480
+//	    Free (estimated):             15837691904      (min: 10468982784)
+func usageDataPoints(out []byte, labels map[string]string, ts int64) []metrics.DataPoint {
+	fields := make(map[string]float64)
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		line := scanner.Text()
+		// Only the indented lines of the first section, the per profile
+		// sections ("Data,single: ...") follow an empty line
+		if strings.TrimSpace(line) == "" && len(fields) > 0 {
+			break
+		}
+		key, value, ok := strings.Cut(strings.TrimSpace(line), ":")
+		if !ok {
+			continue
+		}
+		valueFields := strings.Fields(value)
+		if len(valueFields) == 0 {
+			continue
+		}
+		if v, err := strconv.ParseFloat(valueFields[0], 64); err == nil {
+			fields[key] = v
+		}
+	}
+
+	var results []metrics.DataPoint
+	for _, m := range btrfsUsageMetrics {
+		if v, ok := fields[m.field]; ok {
+			results = append(results, metrics.DataPoint{Name: m.name, Timestamp: ts, Value: v, Labels: labels})
+		}
+	}
+	if size, used := fields["Device size"], fields["Used"]; size > 0 {
+		results = append(results, metrics.DataPoint{Name: "btrfs_used_ratio", Timestamp: ts, Value: used / size, Labels: labels})
+	}
+	return results
+}
+
+var deviceStatRe = regexp.MustCompile(`^\[(.+)\]\.(\w+)_errs\s+(\d+)$`)
+
+// deviceStatsDataPoints parses "btrfs device stats" lines such as
+// "[/dev/sdb].corruption_errs   0".
+func deviceStatsDataPoints(out []byte, mountpoint string, ts int64) []metrics.DataPoint {
+	var results []metrics.DataPoint
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		m := deviceStatRe.FindStringSubmatch(strings.TrimSpace(scanner.Text()))
+		if m == nil {
+			continue
+		}
+		v, _ := strconv.ParseFloat(m[3], 64)
+		results = append(results, metrics.DataPoint{
+			Name:      "btrfs_device_errors_total",
+			Timestamp: ts,
+			Value:     v,
+			Labels:    map[string]string{"mountpoint": mountpoint, "device": m[1], "type": m[2]},
+		})
+	}
+	return results
+}
+
+var scrubErrorRe = regexp.MustCompile(`(\w+)=(\d+)`)
+
+// scrubDataPoints parses "btrfs scrub status", which reports the running or
+// last scrub:
+//
+//	Status:           finished
+//	Error summary:    csum=2 verify=1
+func scrubDataPoints(out []byte, labels map[string]string, ts int64) []metrics.DataPoint {
+	var status string
+	var errors float64
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), ":")
+		if !ok {
+			continue
+		}
+		switch strings.TrimSpace(key) {
+		case "Status":
+			status = strings.TrimSpace(value)
+		case "Error summary":
+			for _, m := range scrubErrorRe.FindAllStringSubmatch(value, -1) {
+				n, _ := strconv.ParseFloat(m[2], 64)
+				errors += n
+			}
+		}
+	}
+	// No scrub ever ran on this filesystem
+	if status == "" {
+		return nil
+	}
+
+	running := 0.0
+	if status == "running" {
+		running = 1
+	}
+	return []metrics.DataPoint{
+		{Name: "btrfs_scrub_in_progress", Timestamp: ts, Value: running, Labels: labels},
+		{Name: "btrfs_scrub_errors_total", Timestamp: ts, Value: errors, Labels: labels},
+	}
+}
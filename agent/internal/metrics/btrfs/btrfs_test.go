@@ -0,0 +1,147 @@
+package btrfs
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+
+	"github.com/shirou/gopsutil/v4/disk"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"agent/internal/logger"
+	"agent/internal/metrics"
+)
+
+func init() {
+	logger.Log = slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+type mockPS struct {
+	mock.Mock
+}
+
+func (m *mockPS) Partitions(all bool) ([]disk.PartitionStat, error) {
+	args := m.Called(all)
+	partitions, _ := args.Get(0).([]disk.PartitionStat)
+	return partitions, args.Error(1)
+}
+
+func (m *mockPS) Usage(mountpoint string) ([]byte, error) {
+	args := m.Called(mountpoint)
+	out, _ := args.Get(0).([]byte)
+	return out, args.Error(1)
+}
+
+func (m *mockPS) DeviceStats(mountpoint string) ([]byte, error) {
+	args := m.Called(mountpoint)
+	out, _ := args.Get(0).([]byte)
+	return out, args.Error(1)
+}
+
+func (m *mockPS) ScrubStatus(mountpoint string) ([]byte, error) {
+	args := m.Called(mountpoint)
+	out, _ := args.Get(0).([]byte)
+	return out, args.Error(1)
+}
+
+const usage = `Overall:
+    Device size:                  21474836480
+    Device allocated:              5402263552
+    Device unallocated:           16072572928
+    Device missing:                         0
+    Used:                          4294967296
+    Free (estimated):             16106127360      (min: 8069840896)
+    Data ratio:                          1.00
+
+Data,single: Size:4303355904, Used:4261412864 (99.03%)
+   /dev/sdb    4303355904
+`
+
+const deviceStats = `[/dev/sdb].write_io_errs    0
+[/dev/sdb].read_io_errs     0
+[/dev/sdb].flush_io_errs    0
+[/dev/sdb].corruption_errs  4
+[/dev/sdb].generation_errs  0
+`
+
+const scrubStatus = `UUID:             1f5e2a1c-8c3b-4f56-9a55-2b7b8f8f7c2e
+Scrub started:    Sun Oct 12 00:00:01 2025
+Status:           finished
+Duration:         0:01:12
+Total to scrub:   4.00GiB
+Rate:             56.89MiB/s
+Error summary:    csum=3 verify=1
+  Corrected:      4
+  Uncorrectable:  0
+  Unverified:     0
+`
+
+func findPoint(t *testing.T, dps []metrics.DataPoint, name string, labels map[string]string) metrics.DataPoint {
+	t.Helper()
+	for _, dp := range dps {
+		if dp.Name != name {
+			continue
+		}
+		match := true
+		for k, v := range labels {
+			if dp.Labels[k] != v {
+				match = false
+			}
+		}
+		if match {
+			return dp
+		}
+	}
+	t.Fatalf("data point %s %v not found", name, labels)
+	return metrics.DataPoint{}
+}
+
+func TestBtrfsCollector(t *testing.T) {
+	var mps mockPS
+	defer mps.AssertExpectations(t)
+	mps.On("Partitions", false).Return([]disk.PartitionStat{
+		{Device: "/dev/sda1", Mountpoint: "/", Fstype: "ext4"},
+		{Device: "/dev/sdb", Mountpoint: "/srv", Fstype: "btrfs"},
+		{Device: "/dev/sdb", Mountpoint: "/srv/snapshots", Fstype: "btrfs"},
+	}, nil)
+	mps.On("Usage", "/srv").Return([]byte(usage), nil).Once()
+	mps.On("DeviceStats", "/srv").Return([]byte(deviceStats), nil).Once()
+	mps.On("ScrubStatus", "/srv").Return([]byte(scrubStatus), nil).Once()
+
+	c := &BtrfsCollector{ps: &mps}
+	dps, err := c.CollectAll()
+	require.NoError(t, err)
+
+	srv := map[string]string{"mountpoint": "/srv"}
+	assert.Equal(t, 21474836480.0, findPoint(t, dps, "btrfs_size_bytes", srv).Value)
+	assert.Equal(t, 16106127360.0, findPoint(t, dps, "btrfs_free_bytes", srv).Value)
+	assert.InDelta(t, 0.2, findPoint(t, dps, "btrfs_used_ratio", srv).Value, 0.0001)
+	assert.Equal(t, 4.0, findPoint(t, dps, "btrfs_device_errors_total", map[string]string{"device": "/dev/sdb", "type": "corruption"}).Value)
+	assert.Equal(t, 0.0, findPoint(t, dps, "btrfs_scrub_in_progress", srv).Value)
+	assert.Equal(t, 4.0, findPoint(t, dps, "btrfs_scrub_errors_total", srv).Value)
+
+	for _, dp := range dps {
+		assert.Equal(t, "/srv", dp.Labels["mountpoint"])
+	}
+}
+
+func TestBtrfsCollectorUsageFailure(t *testing.T) {
+	var mps mockPS
+	defer mps.AssertExpectations(t)
+	mps.On("Partitions", false).Return([]disk.PartitionStat{{Device: "/dev/sdb", Mountpoint: "/srv", Fstype: "btrfs"}}, nil)
+	mps.On("Usage", "/srv").Return(nil, errors.New("permission denied"))
+
+	c := &BtrfsCollector{ps: &mps}
+	dps, err := c.CollectAll()
+	assert.NoError(t, err)
+	assert.Empty(t, dps)
+	mps.AssertNotCalled(t, "DeviceStats", "/srv")
+}
+
+func TestScrubNeverRan(t *testing.T) {
+	out := []byte("UUID:             1f5e2a1c\n\tno stats available\n")
+	assert.Empty(t, scrubDataPoints(out, nil, 0))
+}
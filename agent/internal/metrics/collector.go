@@ -2,11 +2,15 @@ package metrics
 
 import (
 	"context"
+	"maps"
+	"slices"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
 	"agent/internal/collection"
+	"agent/internal/common"
 	"agent/internal/exporter"
 	"agent/internal/logger"
 )
@@ -35,15 +39,27 @@ type MetricCollector interface {
 
 	SetIncludedMetrics(metrics []collection.Metric)
 
+	IncludedMetrics() []collection.Metric
+
 	IsIncluded(name string, labels map[string]string) bool
 }
 
 // StartCollection initialize a background metrics collection loop that gatherns metrics from a list
-// of provided collectors at the specified interval. The loop runs until the provided context is cancelled.
+// of provided collectors at the specified interval. The first collection happens after offset, which
+// spreads collection of a fleet over the interval. When sampler is not nil, unchanged gauges are
+// exported less often. Selected series that stop being reported are sent as config drift events.
+// Collectors failing errorBudget consecutive collections are disabled and retried with a backoff.
+// When fastPath is not nil, its metrics are also collected in between.
+// The loop runs until the provided context is cancelled.
 // After exiting, it signal completion to the wait group.
 func StartCollection(
 	collectors []MetricCollector,
 	interval time.Duration,
+	offset time.Duration,
+	deriver *Deriver,
+	transformer *Transformer,
+	sampler *AdaptiveSampler,
+	fastPath *FastPath,
 	ctx context.Context,
 	wg *sync.WaitGroup,
 	exporter *exporter.Exporter,
@@ -51,8 +67,26 @@ func StartCollection(
 	// Signal completion on exit
 	defer wg.Done()
 
+	drift := NewDriftDetector()
+	budget := NewErrorBudget()
+	for _, c := range collectors {
+		sampler.SetMetricTypes(c.IncludedMetrics())
+	}
 	collectAndExport := func() {
-		metrics := performCollection(collectors)
+		collected, drifts, budgetEvents := performCollection(collectors, drift, budget, fastPath)
+		if len(drifts) > 0 {
+			if err := exporter.ExportLog(reportDrifts(drifts)); err != nil {
+				logger.Log.Error("failed to export config drift events", "error", err)
+			}
+		}
+		if len(budgetEvents) > 0 {
+			if err := exporter.ExportLog(reportBudgetEvents(budgetEvents)); err != nil {
+				logger.Log.Error("failed to export collector events", "error", err)
+			}
+		}
+		transformed := transformer.Apply(deriver.Apply(collected))
+		aggregates := fastPath.Aggregates(transformed)
+		metrics := append(sampler.Filter(transformed), aggregates...)
 		payload := convertDataPointsToPayloads(metrics)
 		err := exporter.ExportMetric(payload)
 		if err != nil {
@@ -62,19 +96,48 @@ func StartCollection(
 		}
 	}
 
-	// Perform initial collection immediately
+	// Fast path metrics are exported on their own, the adaptive sampler
+	// would defeat the purpose and drifts are only checked on full
+	// collections. When aggregated, they're only exported with the full
+	// collections.
+	collectFastPath := func() {
+		metrics := transformer.Apply(deriver.Apply(fastPath.Collect(collectors)))
+		if len(metrics) == 0 {
+			return
+		}
+		if fastPath.Aggregating() {
+			fastPath.Accumulate(metrics)
+			return
+		}
+		if err := exporter.ExportMetric(convertDataPointsToPayloads(metrics)); err != nil {
+			logger.Log.Error("failed to export fast path metrics payload", "error", err)
+		}
+	}
+
+	// Perform initial collection once the phase offset elapsed
+	if offset > 0 {
+		logger.Log.Debug("Delaying metrics collection", "offset", offset)
+	}
+	if !common.SleepContext(ctx, offset) {
+		logger.Log.Info("Metrics collection received stop signal.")
+		return
+	}
 	collectAndExport()
 
 	// Create ticker and ensure is stopped when function exits
-	ticker := time.NewTicker(interval)
+	ticker := time.NewTicker(fastPath.Interval(interval))
 	defer ticker.Stop()
 
 	// Infinite loop
-	for {
+	for n := 1; ; n++ {
 		select {
 		// Perform collection when the ticker fires
 		case <-ticker.C:
-			collectAndExport()
+			if fastPath.IsFull(n) {
+				collectAndExport()
+			} else {
+				collectFastPath()
+			}
 		// Exit loop when stop signal fires
 		case <-ctx.Done():
 			logger.Log.Info("Metrics collection received stop signal.")
@@ -98,19 +161,81 @@ func DiscoverAvailableMetrics(collectors []MetricCollector) []collection.Metric
 	return results
 }
 
+// TemplateMetrics groups the discovered metrics having labels by name and
+// label keys, and returns one template per group instead of one metric per
+// disk, interface or container. Selecting a template includes all its label
+// sets, current and future, so a new disk doesn't need to be registered. At
+// most maxLabelValues label sets are enumerated per template, a negative
+// maxLabelValues disables templates. The order of first occurrences is kept.
+func TemplateMetrics(discovered []collection.Metric, maxLabelValues int) []collection.Metric {
+	if maxLabelValues < 0 {
+		return discovered
+	}
+	templated := make([]collection.Metric, 0, len(discovered))
+	templates := make(map[string]int)
+	for _, m := range discovered {
+		if len(m.Labels) == 0 || len(m.LabelKeys) > 0 {
+			templated = append(templated, m)
+			continue
+		}
+		key := templateKey(m)
+		i, ok := templates[key]
+		if !ok {
+			keys := slices.Sorted(maps.Keys(m.Labels))
+			labels := make(map[string]string, len(keys))
+			for _, k := range keys {
+				labels[k] = WildcardLabelValue
+			}
+			i = len(templated)
+			templates[key] = i
+			templated = append(templated, collection.Metric{Name: m.Name, Type: m.Type, Labels: labels, LabelKeys: keys})
+		}
+		if len(templated[i].LabelValues) < maxLabelValues {
+			templated[i].LabelValues = append(templated[i].LabelValues, m.Labels)
+		}
+	}
+	return templated
+}
+
+// templateKey identifies a metric by its name and label keys
+func templateKey(m collection.Metric) string {
+	keys := slices.Sorted(maps.Keys(m.Labels))
+	return m.Name + "\x00" + strings.Join(keys, "\x00")
+}
+
 // performCollection executes collection across all provided collectors and aggregates results.
-func performCollection(collectors []MetricCollector) []DataPoint {
+// It also returns the selected series that the collectors stopped reporting and
+// the collectors disabled or re-enabled by the error budget, and records the
+// collectors reporting fast path metrics.
+func performCollection(collectors []MetricCollector, drift *DriftDetector, budget *ErrorBudget, fastPath *FastPath) ([]DataPoint, []Drift, []BudgetEvent) {
 	var collectedMetrics []DataPoint
+	var drifts []Drift
+	var budgetEvents []BudgetEvent
 	for _, c := range collectors {
+		if !budget.Allow(c.Name()) {
+			// Not run on the fast path either
+			fastPath.observe(c.Name(), nil)
+			continue
+		}
 		datapoint, err := c.Collect()
+		if event := budget.Observe(c.Name(), err); event != nil {
+			budgetEvents = append(budgetEvents, *event)
+		}
 		if err != nil {
-			// Log error and try with next collector
-			logger.Log.Error("failed to collect metrics", "collector", c.Name(), "error", err)
+			// Log error and try with next collector, the failed retries
+			// of a disabled collector are only logged in debug
+			if budget.Disabled(c.Name()) {
+				logger.Log.Debug("failed to collect metrics", "collector", c.Name(), "error", err)
+			} else {
+				logger.Log.Error("failed to collect metrics", "collector", c.Name(), "error", err)
+			}
 			continue
 		}
 		collectedMetrics = append(collectedMetrics, datapoint...)
+		drifts = append(drifts, drift.Observe(c.Name(), c.IncludedMetrics(), datapoint)...)
+		fastPath.observe(c.Name(), datapoint)
 	}
-	return collectedMetrics
+	return collectedMetrics, drifts, budgetEvents
 }
 
 func convertDataPointsToPayloads(dps []DataPoint) []exporter.MetricPayload {
@@ -0,0 +1,48 @@
+package metrics
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"agent/internal/collection"
+)
+
+func TestTemplateMetrics(t *testing.T) {
+	var discovered []collection.Metric
+	for _, device := range []string{"sda", "sdb", "sdc"} {
+		discovered = append(discovered,
+			collection.Metric{Name: "disk_read_bytes_total", Type: "counter", Value: 1, Labels: map[string]string{"device": device}},
+			collection.Metric{Name: "disk_used_ratio", Type: "gauge", Labels: map[string]string{"device": device, "mountpoint": "/" + device}},
+		)
+	}
+	discovered = append(discovered,
+		collection.Metric{Name: "mem_used_bytes", Type: "gauge", Labels: map[string]string{}},
+		// Same name, other label keys
+		collection.Metric{Name: "disk_used_ratio", Type: "gauge", Labels: map[string]string{"mountpoint": "/"}},
+	)
+
+	assert.Equal(t, []collection.Metric{
+		{
+			Name: "disk_read_bytes_total", Type: "counter",
+			Labels:      map[string]string{"device": "*"},
+			LabelKeys:   []string{"device"},
+			LabelValues: []map[string]string{{"device": "sda"}, {"device": "sdb"}},
+		},
+		{
+			Name: "disk_used_ratio", Type: "gauge",
+			Labels:      map[string]string{"device": "*", "mountpoint": "*"},
+			LabelKeys:   []string{"device", "mountpoint"},
+			LabelValues: []map[string]string{{"device": "sda", "mountpoint": "/sda"}, {"device": "sdb", "mountpoint": "/sdb"}},
+		},
+		{Name: "mem_used_bytes", Type: "gauge", Labels: map[string]string{}},
+		{
+			Name: "disk_used_ratio", Type: "gauge",
+			Labels:      map[string]string{"mountpoint": "*"},
+			LabelKeys:   []string{"mountpoint"},
+			LabelValues: []map[string]string{{"mountpoint": "/"}},
+		},
+	}, TemplateMetrics(discovered, 2))
+
+	assert.Equal(t, discovered, TemplateMetrics(discovered, -1))
+}
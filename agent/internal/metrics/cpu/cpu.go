@@ -2,16 +2,20 @@ package cpu
 
 import (
 	"fmt"
+	"runtime"
 	"time"
 
 	"github.com/shirou/gopsutil/v4/cpu"
 
 	"agent/internal/collection"
+	"agent/internal/common"
+	"agent/internal/logger"
 	"agent/internal/metrics"
 )
 
 type PS interface {
 	CPUTimes(perCPU bool) ([]cpu.TimesStat, error)
+	CoreInfo() ([]coreInfo, error)
 }
 
 type systemPS struct{}
@@ -20,6 +24,15 @@ func (s *systemPS) CPUTimes(perCPU bool) ([]cpu.TimesStat, error) {
 	return cpu.Times(perCPU)
 }
 
+// CoreInfo returns the frequency scaling state of the cores, only available
+// on Linux.
+func (s *systemPS) CoreInfo() ([]coreInfo, error) {
+	if runtime.GOOS != "linux" {
+		return nil, nil
+	}
+	return readCoreInfo(common.HostPath("/sys/devices/system/cpu"))
+}
+
 type CPUCollector struct {
 	metrics.BaseCollector
 
@@ -202,9 +215,56 @@ func (c *CPUCollector) CollectAll() ([]metrics.DataPoint, error) {
 	// Save stats
 	c.lastStats = currStats
 
+	results = append(results, metrics.DataPoint{
+		Name:      "cpu_count",
+		Timestamp: timestamp,
+		Value:     float64(len(currStats)),
+		Labels:    map[string]string{},
+	})
+
+	// Frequency scaling is optional, VMs and containers often don't expose it
+	cores, err := c.ps.CoreInfo()
+	if err != nil {
+		logger.Log.Debug("CPU frequency scaling not available", "error", err)
+	}
+	for _, core := range cores {
+		results = append(results, coreInfoPoints(core, timestamp)...)
+	}
+
 	return results, nil
 }
 
+// coreInfoPoints returns the frequency, governor and throttling metrics of a
+// core. The governor is reported as an info metric, always 1.
+func coreInfoPoints(core coreInfo, timestamp int64) []metrics.DataPoint {
+	var dps []metrics.DataPoint
+	if core.FrequencyHz > 0 {
+		dps = append(dps, metrics.DataPoint{
+			Name:      "cpu_frequency_hertz",
+			Timestamp: timestamp,
+			Value:     core.FrequencyHz,
+			Labels:    map[string]string{"cpu": core.CPU},
+		})
+	}
+	if core.Governor != "" {
+		dps = append(dps, metrics.DataPoint{
+			Name:      "cpu_scaling_governor_info",
+			Timestamp: timestamp,
+			Value:     1,
+			Labels:    map[string]string{"cpu": core.CPU, "governor": core.Governor},
+		})
+	}
+	if core.HasThrottleCount {
+		dps = append(dps, metrics.DataPoint{
+			Name:      "cpu_throttle_events_total",
+			Timestamp: timestamp,
+			Value:     float64(core.ThrottleCount),
+			Labels:    map[string]string{"cpu": core.CPU},
+		})
+	}
+	return dps
+}
+
 func (c *CPUCollector) Discover() ([]collection.Metric, error) {
 	currStats, err := c.ps.CPUTimes(true)
 	if err != nil {
@@ -235,6 +295,29 @@ func (c *CPUCollector) Discover() ([]collection.Metric, error) {
 			Labels: map[string]string{"cpu": "total"},
 		})
 	}
+	discovered = append(discovered, collection.Metric{
+		Name:   "cpu_count",
+		Type:   "gauge",
+		Labels: map[string]string{},
+	})
+
+	cores, err := c.ps.CoreInfo()
+	if err != nil {
+		logger.Log.Debug("CPU frequency scaling not available", "error", err)
+	}
+	for _, core := range cores {
+		for _, dp := range coreInfoPoints(core, 0) {
+			metricType := "gauge"
+			if dp.Name == "cpu_throttle_events_total" {
+				metricType = "counter"
+			}
+			discovered = append(discovered, collection.Metric{
+				Name:   dp.Name,
+				Type:   metricType,
+				Labels: dp.Labels,
+			})
+		}
+	}
 
 	return discovered, nil
 }
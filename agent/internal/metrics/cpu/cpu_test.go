@@ -2,6 +2,8 @@ package cpu
 
 import (
 	"fmt"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/shirou/gopsutil/v4/cpu"
@@ -25,6 +27,12 @@ func (m *mockPS) CPUTimes(perCPU bool) ([]cpu.TimesStat, error) {
 	return args.Get(0).([]cpu.TimesStat), args.Error(1)
 }
 
+func (m *mockPS) CoreInfo() ([]coreInfo, error) {
+	args := m.Called()
+	cores, _ := args.Get(0).([]coreInfo)
+	return cores, args.Error(1)
+}
+
 func TestCPUCollector(t *testing.T) {
 	var mps mockPS
 	defer mps.AssertExpectations(t)
@@ -47,6 +55,7 @@ func TestCPUCollector(t *testing.T) {
 	mps.On("CPUTimes", true).Return([]cpu.TimesStat{cts1}, nil).Once()
 	// Second call in CollectAll (after sleep)
 	mps.On("CPUTimes", true).Return([]cpu.TimesStat{cts2}, nil).Once()
+	mps.On("CoreInfo").Return(nil, nil)
 
 	c := &CPUCollector{
 		ps: &mps,
@@ -104,6 +113,7 @@ func TestCPUCollector_GuestAdjustment(t *testing.T) {
 	// Total = 15 + 8 + 110 + 5 + 2 = 140
 
 	mps.On("CPUTimes", true).Return([]cpu.TimesStat{cts2}, nil).Once()
+	mps.On("CoreInfo").Return(nil, nil)
 	c.lastStats = []cpu.TimesStat{cts1}
 
 	dps, err := c.CollectAll()
@@ -134,12 +144,69 @@ func TestCPUCollector_Discover(t *testing.T) {
 
 	cts := []cpu.TimesStat{{CPU: "cpu0"}, {CPU: "cpu1"}}
 	mps.On("CPUTimes", true).Return(cts, nil).Once()
+	mps.On("CoreInfo").Return([]coreInfo{
+		{CPU: "cpu0", FrequencyHz: 2.4e9, Governor: "powersave"},
+		{CPU: "cpu1", FrequencyHz: 2.4e9, Governor: "powersave"},
+	}, nil)
 
 	discovered, err := c.Discover()
 	require.NoError(t, err)
 
-	// 10 fields per core (2 cores) + 10 fields for "total" = 30 metrics
-	assert.Equal(t, 30, len(discovered))
+	// 10 fields per core (2 cores) + 10 fields for "total" + cpu_count
+	// + frequency and governor per core = 35 metrics
+	assert.Equal(t, 35, len(discovered))
+}
+
+func TestCPUCollector_CoreInfo(t *testing.T) {
+	var mps mockPS
+	c := &CPUCollector{ps: &mps}
+
+	cts1 := cpu.TimesStat{CPU: "cpu0", User: 100.0, Idle: 500.0}
+	cts2 := cpu.TimesStat{CPU: "cpu0", User: 110.0, Idle: 590.0}
+	c.lastStats = []cpu.TimesStat{cts1, cts1}
+	mps.On("CPUTimes", true).Return([]cpu.TimesStat{cts2, cts2}, nil).Once()
+	mps.On("CoreInfo").Return([]coreInfo{
+		{CPU: "cpu0", FrequencyHz: 3.2e9, Governor: "performance", ThrottleCount: 7, HasThrottleCount: true},
+		{CPU: "cpu1"},
+	}, nil)
+
+	dps, err := c.CollectAll()
+	require.NoError(t, err)
+
+	cpu0 := map[string]string{"cpu": "cpu0"}
+	assertContainsMetric(t, dps, "cpu_count", 2, map[string]string{})
+	assertContainsMetric(t, dps, "cpu_frequency_hertz", 3.2e9, cpu0)
+	assertContainsMetric(t, dps, "cpu_scaling_governor_info", 1, map[string]string{"cpu": "cpu0", "governor": "performance"})
+	assertContainsMetric(t, dps, "cpu_throttle_events_total", 7, cpu0)
+	for _, dp := range dps {
+		if dp.Labels["cpu"] == "cpu1" {
+			assert.Contains(t, dp.Name, "_ratio", "cpu1 has no frequency scaling")
+		}
+	}
+}
+
+func TestReadCoreInfo(t *testing.T) {
+	root := t.TempDir()
+	write := func(path, content string) {
+		t.Helper()
+		full := filepath.Join(root, path)
+		require.NoError(t, os.MkdirAll(filepath.Dir(full), 0o755))
+		require.NoError(t, os.WriteFile(full, []byte(content+"\n"), 0o644))
+	}
+	write("cpu0/cpufreq/scaling_cur_freq", "2400000")
+	write("cpu0/cpufreq/scaling_governor", "schedutil")
+	write("cpu0/thermal_throttle/core_throttle_count", "3")
+	write("cpu10/cpufreq/scaling_cur_freq", "800000")
+	write("cpu2/online", "1")
+	write("cpufreq/boost", "1")
+
+	cores, err := readCoreInfo(root)
+	require.NoError(t, err)
+	assert.Equal(t, []coreInfo{
+		{CPU: "cpu0", FrequencyHz: 2.4e9, Governor: "schedutil", ThrottleCount: 3, HasThrottleCount: true},
+		{CPU: "cpu2"},
+		{CPU: "cpu10", FrequencyHz: 8e8},
+	}, cores)
 }
 
 func TestCPUCollector_CollectFiltering(t *testing.T) {
@@ -151,6 +218,7 @@ func TestCPUCollector_CollectFiltering(t *testing.T) {
 
 	c.lastStats = []cpu.TimesStat{cts1}
 	mps.On("CPUTimes", true).Return([]cpu.TimesStat{cts2}, nil).Once()
+	mps.On("CoreInfo").Return(nil, nil)
 
 	// Filter to only include cpu_user_ratio for total
 	c.SetIncludedMetrics([]collection.Metric{
@@ -0,0 +1,71 @@
+package cpu
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// coreInfo is the frequency scaling state of a logical CPU
+type coreInfo struct {
+	// CPU is the core name, as reported by gopsutil (e.g. "cpu0")
+	CPU string
+	// FrequencyHz is the current frequency, zero when unknown
+	FrequencyHz float64
+	// Governor is the cpufreq scaling governor, empty when unknown
+	Governor string
+	// ThrottleCount is the number of thermal throttling events, only set
+	// on Intel CPUs
+	ThrottleCount    uint64
+	HasThrottleCount bool
+}
+
+var cpuDirPattern = regexp.MustCompile(`^cpu[0-9]+$`)
+
+// readCoreInfo reads the cpufreq and thermal_throttle attributes of every
+// CPU under root, usually /sys/devices/system/cpu.
+func readCoreInfo(root string) ([]coreInfo, error) {
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		return nil, err
+	}
+
+	var cores []coreInfo
+	for _, entry := range entries {
+		if !cpuDirPattern.MatchString(entry.Name()) {
+			continue
+		}
+		dir := filepath.Join(root, entry.Name())
+		core := coreInfo{CPU: entry.Name()}
+		// Frequencies are in kHz
+		if khz, err := readUint(filepath.Join(dir, "cpufreq", "scaling_cur_freq")); err == nil {
+			core.FrequencyHz = float64(khz) * 1000
+		}
+		if governor, err := os.ReadFile(filepath.Join(dir, "cpufreq", "scaling_governor")); err == nil {
+			core.Governor = strings.TrimSpace(string(governor))
+		}
+		if count, err := readUint(filepath.Join(dir, "thermal_throttle", "core_throttle_count")); err == nil {
+			core.ThrottleCount = count
+			core.HasThrottleCount = true
+		}
+		cores = append(cores, core)
+	}
+
+	sort.Slice(cores, func(i, j int) bool {
+		a, _ := strconv.Atoi(strings.TrimPrefix(cores[i].CPU, "cpu"))
+		b, _ := strconv.Atoi(strings.TrimPrefix(cores[j].CPU, "cpu"))
+		return a < b
+	})
+	return cores, nil
+}
+
+func readUint(path string) (uint64, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+}
@@ -0,0 +1,397 @@
+package cron
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"agent/internal/collection"
+	"agent/internal/common"
+	"agent/internal/logger"
+	"agent/internal/metrics"
+)
+
+// maxInitialRead bounds how much of an existing log file is replayed the first
+// time it is opened, so a huge syslog does not stall the collection cycle.
+const maxInitialRead = 1024 * 1024 // 1MB
+
+// CronLogReader returns the log lines appended since the previous call.
+type CronLogReader interface {
+	ReadNewLines() ([]string, error)
+}
+
+// fileReader incrementally reads the first existing file out of a list of
+// candidates (the cron log location differs between distributions).
+type fileReader struct {
+	candidates []string
+	path       string
+	offset     int64
+}
+
+func (r *fileReader) ReadNewLines() ([]string, error) {
+	if r.path == "" {
+		for _, candidate := range r.candidates {
+			if _, err := os.Stat(candidate); err == nil {
+				r.path = candidate
+				r.offset = -1
+				break
+			}
+		}
+		if r.path == "" {
+			return nil, fmt.Errorf("no cron log file found in %v", r.candidates)
+		}
+	}
+
+	f, err := os.Open(r.path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open cron log: %w", err)
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat cron log: %w", err)
+	}
+	switch {
+	case r.offset < 0:
+		// First read: only replay the end of the file
+		r.offset = max(0, info.Size()-maxInitialRead)
+	case info.Size() < r.offset:
+		// File was truncated or rotated
+		r.offset = 0
+	}
+	if _, err := f.Seek(r.offset, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("failed to seek cron log: %w", err)
+	}
+
+	var lines []string
+	reader := bufio.NewReader(f)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			// Keep incomplete trailing lines for the next read
+			break
+		}
+		r.offset += int64(len(line))
+		lines = append(lines, strings.TrimRight(line, "\r\n"))
+	}
+	return lines, nil
+}
+
+type CronCollector struct {
+	metrics.BaseCollector
+
+	reader  CronLogReader
+	tracker *jobTracker
+	now     func() time.Time
+}
+
+func NewCronCollector() *CronCollector {
+	return &CronCollector{
+		reader: &fileReader{
+			candidates: []string{
+				common.HostPath("/var/log/cron"),
+				common.HostPath("/var/log/cron.log"),
+				common.HostPath("/var/log/syslog"),
+			},
+		},
+		tracker: newJobTracker(),
+		now:     time.Now,
+	}
+}
+
+func (c *CronCollector) Name() string {
+	return "cron"
+}
+
+var cronMetrics = []struct {
+	name   string
+	kind   string
+	getVal func(stats *jobStats) (float64, bool)
+}{
+	{
+		"cron_job_last_success_timestamp",
+		"gauge",
+		func(stats *jobStats) (float64, bool) {
+			if stats.lastSuccess.IsZero() {
+				return 0, false
+			}
+			return float64(stats.lastSuccess.Unix()), true
+		},
+	},
+	{
+		"cron_job_failures_total",
+		"counter",
+		func(stats *jobStats) (float64, bool) { return float64(stats.failures), true },
+	},
+}
+
+func (c *CronCollector) Collect() ([]metrics.DataPoint, error) {
+	all, err := c.CollectAll()
+	if err != nil {
+		return nil, err
+	}
+	var included []metrics.DataPoint
+	for _, dp := range all {
+		if c.IsIncluded(dp.Name, dp.Labels) {
+			included = append(included, dp)
+		}
+	}
+	return included, nil
+}
+
+func (c *CronCollector) CollectAll() ([]metrics.DataPoint, error) {
+	timestamp := c.now().UnixMilli()
+
+	lines, err := c.reader.ReadNewLines()
+	if err != nil {
+		logger.Log.Debug("Failed to collect metrics", "collector", c.Name(), "error", err)
+		return nil, nil
+	}
+	for _, line := range lines {
+		c.tracker.process(line, c.now())
+	}
+	c.tracker.expire(c.now())
+
+	var results []metrics.DataPoint
+	for key, stats := range c.tracker.jobs {
+		for _, m := range cronMetrics {
+			val, ok := m.getVal(stats)
+			if !ok {
+				continue
+			}
+			results = append(results, metrics.DataPoint{
+				Name:      m.name,
+				Timestamp: timestamp,
+				Value:     val,
+				Labels:    map[string]string{"job": key.command, "user": key.user},
+			})
+		}
+	}
+	return results, nil
+}
+
+func (c *CronCollector) Discover() ([]collection.Metric, error) {
+	if _, err := c.CollectAll(); err != nil {
+		return nil, nil
+	}
+
+	var discovered []collection.Metric
+	for key := range c.tracker.jobs {
+		for _, m := range cronMetrics {
+			discovered = append(discovered, collection.Metric{
+				Name:   m.name,
+				Type:   m.kind,
+				Labels: map[string]string{"job": key.command, "user": key.user},
+			})
+		}
+	}
+	return discovered, nil
+}
+
+// ------------------------ Job tracking ------------------------
+
+var (
+	// cmdRe matches a job start: "CRON[2345]: (root) CMD (/usr/local/bin/backup.sh)"
+	cmdRe = regexp.MustCompile(`CROND?\[(\d+)\]: \(([^)]+)\) CMD \((.*)\)$`)
+	// endRe matches a job end logged by cronie or by cron running with -L 2:
+	// "CROND[2344]: (root) CMDEND (/usr/local/bin/backup.sh)"
+	endRe = regexp.MustCompile(`CROND?\[(\d+)\]: \(([^)]+)\) (?:CMD)?END \((.*)\)$`)
+	// failRe matches a failure reported by Debian cron:
+	// "CRON[2344]: (CRON) error (grandchild #2345 failed with exit status 1)"
+	failRe = regexp.MustCompile(`CROND?\[(\d+)\]: \(CRON\) error \(grandchild #(\d+) failed with exit status \d+\)`)
+	// sessionOpenRe and sessionCloseRe match the PAM session of the cron
+	// process that spawns the job, used to detect its end on Debian cron.
+	sessionOpenRe  = regexp.MustCompile(`CROND?\[(\d+)\]: pam_unix\(crond?:session\): session opened`)
+	sessionCloseRe = regexp.MustCompile(`CROND?\[(\d+)\]: pam_unix\(crond?:session\): session closed`)
+)
+
+// Bounds of the runs and sessions waiting for their end. Lines can be lost or
+// rotated away, what's left unmatched must not pile up.
+const (
+	maxPendingAge = 24 * time.Hour
+	maxPending    = 1000
+)
+
+type jobKey struct {
+	user    string
+	command string
+}
+
+type jobStats struct {
+	lastSuccess time.Time
+	failures    uint64
+}
+
+// runningJob is a job started but not yet finished. Cron forks twice: the
+// session is handled by the parent while the command runs in a grandchild, so
+// both pids are needed to correlate all the log lines of a run.
+type runningJob struct {
+	key     jobKey
+	parent  string
+	failed  bool
+	started time.Time
+}
+
+type jobTracker struct {
+	jobs         map[jobKey]*jobStats
+	running      map[string]*runningJob // by command pid
+	openSessions map[string]time.Time   // parent pids waiting for their command
+}
+
+func newJobTracker() *jobTracker {
+	return &jobTracker{
+		jobs:         make(map[jobKey]*jobStats),
+		running:      make(map[string]*runningJob),
+		openSessions: make(map[string]time.Time),
+	}
+}
+
+func (t *jobTracker) process(line string, now time.Time) {
+	if !strings.Contains(line, "CRON") {
+		return
+	}
+
+	if m := sessionOpenRe.FindStringSubmatch(line); m != nil {
+		if len(t.openSessions) >= maxPending {
+			delete(t.openSessions, oldest(t.openSessions, func(opened time.Time) time.Time { return opened }))
+		}
+		t.openSessions[m[1]] = parseTimestamp(line, now)
+		return
+	}
+
+	if m := cmdRe.FindStringSubmatch(line); m != nil {
+		key := jobKey{user: m[2], command: m[3]}
+		if _, ok := t.jobs[key]; !ok {
+			t.jobs[key] = &jobStats{}
+		}
+		job := &runningJob{key: key, started: parseTimestamp(line, now)}
+		if parent := t.sessionOf(m[1]); parent != "" {
+			job.parent = parent
+			delete(t.openSessions, parent)
+		}
+		if len(t.running) >= maxPending {
+			delete(t.running, oldest(t.running, func(job *runningJob) time.Time { return job.started }))
+		}
+		t.running[m[1]] = job
+		return
+	}
+
+	if m := failRe.FindStringSubmatch(line); m != nil {
+		if job, ok := t.running[m[2]]; ok {
+			// The failure names both pids, it fixes a wrong guess of the
+			// session
+			job.parent = m[1]
+			job.failed = true
+			t.jobs[job.key].failures++
+		}
+		return
+	}
+
+	if m := endRe.FindStringSubmatch(line); m != nil {
+		key := jobKey{user: m[2], command: m[3]}
+		var pid string
+		for candidate, job := range t.running {
+			if job.key == key && (pid == "" || job.started.Before(t.running[pid].started)) {
+				pid = candidate
+			}
+		}
+		if pid != "" {
+			t.finish(pid, t.running[pid], parseTimestamp(line, now))
+		}
+		return
+	}
+
+	if m := sessionCloseRe.FindStringSubmatch(line); m != nil {
+		delete(t.openSessions, m[1])
+		for pid, job := range t.running {
+			if job.parent == m[1] {
+				t.finish(pid, job, parseTimestamp(line, now))
+				return
+			}
+		}
+	}
+}
+
+// sessionOf returns the open session of the command run by pid. The session
+// is held by the parent of the command, forked just before it: the open
+// session with the closest lower pid. Pids wrap around, the oldest session is
+// used when none is lower.
+func (t *jobTracker) sessionOf(pid string) string {
+	cmdPid, err := strconv.Atoi(pid)
+	if err != nil {
+		return ""
+	}
+	best, bestPid := "", -1
+	for session := range t.openSessions {
+		sessionPid, err := strconv.Atoi(session)
+		if err == nil && sessionPid < cmdPid && sessionPid > bestPid {
+			best, bestPid = session, sessionPid
+		}
+	}
+	if best == "" {
+		best = oldest(t.openSessions, func(opened time.Time) time.Time { return opened })
+	}
+	return best
+}
+
+// expire forgets the runs and sessions pending for longer than maxPendingAge
+func (t *jobTracker) expire(now time.Time) {
+	cutoff := now.Add(-maxPendingAge)
+	for pid, job := range t.running {
+		if job.started.Before(cutoff) {
+			delete(t.running, pid)
+		}
+	}
+	for pid, opened := range t.openSessions {
+		if opened.Before(cutoff) {
+			delete(t.openSessions, pid)
+		}
+	}
+}
+
+func (t *jobTracker) finish(pid string, job *runningJob, at time.Time) {
+	delete(t.running, pid)
+	if !job.failed {
+		t.jobs[job.key].lastSuccess = at
+	}
+}
+
+// oldest returns the key of the oldest entry of m, "" when empty
+func oldest[V any](m map[string]V, startedAt func(V) time.Time) string {
+	var key string
+	var at time.Time
+	for k, v := range m {
+		if t := startedAt(v); key == "" || t.Before(at) {
+			key, at = k, t
+		}
+	}
+	return key
+}
+
+// parseTimestamp reads the syslog timestamp at the start of the line, either
+// RFC3339 (rsyslog high precision format) or the traditional "Jan  2 15:04:05"
+// which lacks a year. It falls back to now when the line can't be parsed.
+func parseTimestamp(line string, now time.Time) time.Time {
+	if field, _, ok := strings.Cut(line, " "); ok {
+		if ts, err := time.Parse(time.RFC3339Nano, field); err == nil {
+			return ts
+		}
+	}
+	if len(line) >= len(time.Stamp) {
+		if ts, err := time.ParseInLocation(time.Stamp, line[:len(time.Stamp)], now.Location()); err == nil {
+			ts = ts.AddDate(now.Year(), 0, 0)
+			// Lines from December read in January belong to the previous year
+			if ts.After(now.Add(24 * time.Hour)) {
+				ts = ts.AddDate(-1, 0, 0)
+			}
+			return ts
+		}
+	}
+	return now
+}
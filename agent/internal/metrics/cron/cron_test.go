@@ -0,0 +1,185 @@
+package cron
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"agent/internal/collection"
+	"agent/internal/logger"
+	"agent/internal/metrics"
+)
+
+func init() {
+	logger.Log = slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+type mockReader struct {
+	mock.Mock
+}
+
+func (m *mockReader) ReadNewLines() ([]string, error) {
+	args := m.Called()
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]string), args.Error(1)
+}
+
+var debianLines = []string{
+	"Mar 28 10:46:01 host CRON[31305]: pam_unix(cron:session): session opened for user root(uid=0) by (uid=0)",
+	"Mar 28 10:46:01 host CRON[31306]: (root) CMD (/root/backup.sh)",
+	"Mar 28 10:46:05 host CRON[31305]: (CRON) error (grandchild #31306 failed with exit status 1)",
+	"Mar 28 10:46:05 host CRON[31305]: pam_unix(cron:session): session closed for user root",
+	"Mar 28 10:47:01 host CRON[31310]: pam_unix(cron:session): session opened for user www(uid=33) by (uid=0)",
+	"Mar 28 10:47:01 host CRON[31311]: (www) CMD (php /var/www/cron.php)",
+	"Mar 28 10:47:02 host CRON[31310]: pam_unix(cron:session): session closed for user www",
+}
+
+var cronieLines = []string{
+	"2026-03-28T10:46:01.000000+00:00 host CROND[500]: (root) CMD (/usr/bin/run-parts /etc/cron.hourly)",
+	"2026-03-28T10:46:03.000000+00:00 host CROND[499]: (root) CMDEND (/usr/bin/run-parts /etc/cron.hourly)",
+}
+
+func TestCronCollector_Debian(t *testing.T) {
+	var reader mockReader
+	defer reader.AssertExpectations(t)
+	reader.On("ReadNewLines").Return(debianLines, nil).Once()
+
+	now := time.Date(2026, 3, 28, 11, 0, 0, 0, time.UTC)
+	c := &CronCollector{reader: &reader, tracker: newJobTracker(), now: func() time.Time { return now }}
+
+	dps, err := c.CollectAll()
+	require.NoError(t, err)
+
+	backup := map[string]string{"job": "/root/backup.sh", "user": "root"}
+	assertMetric(t, dps, "cron_job_failures_total", backup, 1)
+	assertNoMetric(t, dps, "cron_job_last_success_timestamp", backup)
+
+	php := map[string]string{"job": "php /var/www/cron.php", "user": "www"}
+	assertMetric(t, dps, "cron_job_failures_total", php, 0)
+	expected := time.Date(2026, 3, 28, 10, 47, 2, 0, time.UTC)
+	assertMetric(t, dps, "cron_job_last_success_timestamp", php, float64(expected.Unix()))
+}
+
+func TestCronCollector_Cronie(t *testing.T) {
+	var reader mockReader
+	reader.On("ReadNewLines").Return(cronieLines, nil).Once()
+
+	c := &CronCollector{reader: &reader, tracker: newJobTracker(), now: time.Now}
+	dps, err := c.CollectAll()
+	require.NoError(t, err)
+
+	labels := map[string]string{"job": "/usr/bin/run-parts /etc/cron.hourly", "user": "root"}
+	expected := time.Date(2026, 3, 28, 10, 46, 3, 0, time.UTC)
+	assertMetric(t, dps, "cron_job_last_success_timestamp", labels, float64(expected.Unix()))
+	assertMetric(t, dps, "cron_job_failures_total", labels, 0)
+}
+
+func TestCronCollector_DiscoverAndFilter(t *testing.T) {
+	var reader mockReader
+	reader.On("ReadNewLines").Return(debianLines, nil).Once()
+	reader.On("ReadNewLines").Return([]string{}, nil)
+
+	c := &CronCollector{reader: &reader, tracker: newJobTracker(), now: time.Now}
+	discovered, err := c.Discover()
+	require.NoError(t, err)
+	assert.Len(t, discovered, 4)
+
+	c.SetIncludedMetrics([]collection.Metric{
+		{Name: "cron_job_failures_total", Labels: map[string]string{"job": "/root/backup.sh", "user": "root"}},
+	})
+	dps, err := c.Collect()
+	require.NoError(t, err)
+	require.Len(t, dps, 1)
+	assert.Equal(t, 1.0, dps[0].Value)
+}
+
+func TestJobTracker_PairsSessionsByPid(t *testing.T) {
+	now := time.Date(2026, 3, 28, 11, 0, 0, 0, time.UTC)
+	tracker := newJobTracker()
+	for _, line := range []string{
+		// A session whose command line was lost
+		"Mar 28 10:45:01 host CRON[31200]: pam_unix(cron:session): session opened for user root(uid=0) by (uid=0)",
+		"Mar 28 10:46:01 host CRON[31305]: pam_unix(cron:session): session opened for user root(uid=0) by (uid=0)",
+		"Mar 28 10:46:01 host CRON[31306]: (root) CMD (/root/backup.sh)",
+		"Mar 28 10:46:05 host CRON[31305]: pam_unix(cron:session): session closed for user root",
+	} {
+		tracker.process(line, now)
+	}
+
+	stats := tracker.jobs[jobKey{user: "root", command: "/root/backup.sh"}]
+	require.NotNil(t, stats)
+	assert.Equal(t, time.Date(2026, 3, 28, 10, 46, 5, 0, time.UTC), stats.lastSuccess)
+	assert.Empty(t, tracker.running)
+}
+
+func TestJobTracker_ExpiresAndCaps(t *testing.T) {
+	now := time.Date(2026, 3, 28, 11, 0, 0, 0, time.UTC)
+	tracker := newJobTracker()
+	tracker.process("Mar 27 10:46:01 host CRON[100]: pam_unix(cron:session): session opened for user root(uid=0) by (uid=0)", now)
+	tracker.process("Mar 27 10:46:01 host CRON[101]: (root) CMD (/root/backup.sh)", now)
+	tracker.process("Mar 28 10:46:01 host CRON[200]: pam_unix(cron:session): session opened for user root(uid=0) by (uid=0)", now)
+
+	// Unfinished for more than a day
+	tracker.expire(now)
+	assert.Empty(t, tracker.running)
+	assert.Len(t, tracker.openSessions, 1)
+
+	for pid := 1000; pid < 1000+2*maxPending; pid++ {
+		tracker.process(fmt.Sprintf("Mar 28 10:50:01 host CROND[%d]: (root) CMD (/bin/true)", pid), now)
+	}
+	assert.Len(t, tracker.running, maxPending)
+}
+
+func TestFileReader(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "syslog")
+	require.NoError(t, os.WriteFile(path, []byte("line1\nline2\npartial"), 0o600))
+
+	r := &fileReader{candidates: []string{"/nonexistent", path}}
+	lines, err := r.ReadNewLines()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"line1", "line2"}, lines)
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o600)
+	require.NoError(t, err)
+	_, err = f.WriteString(" done\nline4\n")
+	require.NoError(t, err)
+	f.Close()
+
+	lines, err = r.ReadNewLines()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"partial done", "line4"}, lines)
+
+	// Rotation: the file is replaced by a smaller one
+	require.NoError(t, os.WriteFile(path, []byte("new\n"), 0o600))
+	lines, err = r.ReadNewLines()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"new"}, lines)
+}
+
+func assertMetric(t *testing.T, dps []metrics.DataPoint, name string, labels map[string]string, value float64) {
+	for _, dp := range dps {
+		if dp.Name == name && assert.ObjectsAreEqual(labels, dp.Labels) {
+			assert.Equal(t, value, dp.Value, "Metric %s", name)
+			return
+		}
+	}
+	assert.Failf(t, "Metric not found", "Could not find metric %q with labels %v", name, labels)
+}
+
+func assertNoMetric(t *testing.T, dps []metrics.DataPoint, name string, labels map[string]string) {
+	for _, dp := range dps {
+		if dp.Name == name && assert.ObjectsAreEqual(labels, dp.Labels) {
+			assert.Failf(t, "Unexpected metric", "Found metric %q with labels %v", name, labels)
+		}
+	}
+}
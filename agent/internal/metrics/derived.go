@@ -0,0 +1,342 @@
+package metrics
+
+import (
+	"fmt"
+	"maps"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+
+	"agent/internal/config"
+)
+
+// Deriver computes the derived metrics defined in the configuration from the
+// data points of a collection cycle.
+type Deriver struct {
+	metrics []derivedMetric
+}
+
+type derivedMetric struct {
+	name string
+	expr expr
+	// refs are the metric names used by the expression
+	refs []string
+}
+
+// NewDeriver parses the expressions of the derived metrics and returns a
+// deriver, or nil when there is nothing to compute.
+func NewDeriver(defs []config.DerivedMetric) (*Deriver, error) {
+	if len(defs) == 0 {
+		return nil, nil
+	}
+	d := &Deriver{}
+	for _, def := range defs {
+		if def.Name == "" {
+			return nil, fmt.Errorf("derived metric %q: empty name", def.Expression)
+		}
+		e, err := parseExpr(def.Expression)
+		if err != nil {
+			return nil, fmt.Errorf("derived metric %s: %w", def.Name, err)
+		}
+		refs := map[string]bool{}
+		e.refs(refs)
+		d.metrics = append(d.metrics, derivedMetric{
+			name: def.Name,
+			expr: e,
+			refs: slices.Sorted(maps.Keys(refs)),
+		})
+	}
+	return d, nil
+}
+
+// Apply returns the data points with the derived metrics appended. A derived
+// metric is skipped for the label sets where an operand is missing or the
+// result isn't a finite number (e.g. a division by zero). Derived metrics can
+// use the ones defined before them.
+func (d *Deriver) Apply(dps []DataPoint) []DataPoint {
+	if d == nil {
+		return dps
+	}
+
+	// Series by metric name, then by label set
+	index := make(map[string]map[string]DataPoint)
+	add := func(dp DataPoint) {
+		series, ok := index[dp.Name]
+		if !ok {
+			series = make(map[string]DataPoint)
+			index[dp.Name] = series
+		}
+		series[labelsKey(dp.Labels)] = dp
+	}
+	for _, dp := range dps {
+		add(dp)
+	}
+
+	for _, m := range d.metrics {
+		for _, dp := range m.evaluate(index) {
+			dps = append(dps, dp)
+			add(dp)
+		}
+	}
+	return dps
+}
+
+func (m derivedMetric) evaluate(index map[string]map[string]DataPoint) []DataPoint {
+	// The label sets to compute are the ones of the labelled operands, or the
+	// empty set when none of them has labels
+	groups := make(map[string]map[string]string)
+	for _, ref := range m.refs {
+		for key, dp := range index[ref] {
+			if key != "" {
+				groups[key] = dp.Labels
+			}
+		}
+	}
+	if len(groups) == 0 {
+		groups[""] = nil
+	}
+
+	var out []DataPoint
+	for _, key := range slices.Sorted(maps.Keys(groups)) {
+		var timestamp int64
+		lookup := func(name string) (float64, bool) {
+			series := index[name]
+			dp, ok := series[key]
+			if !ok {
+				// Metrics without labels apply to every label set
+				dp, ok = series[""]
+				if !ok || len(series) != 1 {
+					return 0, false
+				}
+			}
+			timestamp = max(timestamp, dp.Timestamp)
+			return dp.Value, true
+		}
+		value, ok := m.expr.eval(lookup)
+		if !ok || math.IsNaN(value) || math.IsInf(value, 0) {
+			continue
+		}
+		out = append(out, DataPoint{
+			Name:      m.name,
+			Timestamp: timestamp,
+			Value:     value,
+			Labels:    maps.Clone(groups[key]),
+		})
+	}
+	return out
+}
+
+func labelsKey(labels map[string]string) string {
+	var b strings.Builder
+	for _, k := range slices.Sorted(maps.Keys(labels)) {
+		b.WriteString(k)
+		b.WriteByte('=')
+		b.WriteString(labels[k])
+		b.WriteByte(0)
+	}
+	return b.String()
+}
+
+// expr is a node of a parsed arithmetic expression
+type expr interface {
+	eval(lookup func(name string) (float64, bool)) (float64, bool)
+	refs(names map[string]bool)
+}
+
+type numberExpr float64
+
+func (n numberExpr) eval(func(string) (float64, bool)) (float64, bool) { return float64(n), true }
+func (n numberExpr) refs(map[string]bool)                              {}
+
+type metricExpr string
+
+func (m metricExpr) eval(lookup func(string) (float64, bool)) (float64, bool) {
+	return lookup(string(m))
+}
+func (m metricExpr) refs(names map[string]bool) { names[string(m)] = true }
+
+type negExpr struct{ x expr }
+
+func (n negExpr) eval(lookup func(string) (float64, bool)) (float64, bool) {
+	v, ok := n.x.eval(lookup)
+	return -v, ok
+}
+func (n negExpr) refs(names map[string]bool) { n.x.refs(names) }
+
+type binaryExpr struct {
+	op          byte
+	left, right expr
+}
+
+func (b binaryExpr) eval(lookup func(string) (float64, bool)) (float64, bool) {
+	l, ok := b.left.eval(lookup)
+	if !ok {
+		return 0, false
+	}
+	r, ok := b.right.eval(lookup)
+	if !ok {
+		return 0, false
+	}
+	switch b.op {
+	case '+':
+		return l + r, true
+	case '-':
+		return l - r, true
+	case '*':
+		return l * r, true
+	default:
+		return l / r, true
+	}
+}
+
+func (b binaryExpr) refs(names map[string]bool) {
+	b.left.refs(names)
+	b.right.refs(names)
+}
+
+// exprParser is a recursive descent parser for the grammar:
+//
+//	expr   = term { ("+" | "-") term }
+//	term   = factor { ("*" | "/") factor }
+//	factor = number | name | "(" expr ")" | "-" factor
+type exprParser struct {
+	input string
+	pos   int
+}
+
+func parseExpr(input string) (expr, error) {
+	p := &exprParser{input: input}
+	e, err := p.expr()
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpaces()
+	if p.pos < len(p.input) {
+		return nil, fmt.Errorf("unexpected %q at position %d", p.input[p.pos], p.pos)
+	}
+	return e, nil
+}
+
+func (p *exprParser) expr() (expr, error) {
+	left, err := p.term()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op := p.peek()
+		if op != '+' && op != '-' {
+			return left, nil
+		}
+		p.pos++
+		right, err := p.term()
+		if err != nil {
+			return nil, err
+		}
+		left = binaryExpr{op: op, left: left, right: right}
+	}
+}
+
+func (p *exprParser) term() (expr, error) {
+	left, err := p.factor()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op := p.peek()
+		if op != '*' && op != '/' {
+			return left, nil
+		}
+		p.pos++
+		right, err := p.factor()
+		if err != nil {
+			return nil, err
+		}
+		left = binaryExpr{op: op, left: left, right: right}
+	}
+}
+
+func (p *exprParser) factor() (expr, error) {
+	c := p.peek()
+	switch {
+	case c == 0:
+		return nil, fmt.Errorf("unexpected end of expression")
+	case c == '(':
+		p.pos++
+		e, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() != ')' {
+			return nil, fmt.Errorf("missing closing parenthesis at position %d", p.pos)
+		}
+		p.pos++
+		return e, nil
+	case c == '-':
+		p.pos++
+		x, err := p.factor()
+		if err != nil {
+			return nil, err
+		}
+		return negExpr{x: x}, nil
+	case isDigit(c) || c == '.':
+		return p.number()
+	case isNameStart(c):
+		start := p.pos
+		for p.pos < len(p.input) && isNameChar(p.input[p.pos]) {
+			p.pos++
+		}
+		return metricExpr(p.input[start:p.pos]), nil
+	default:
+		return nil, fmt.Errorf("unexpected %q at position %d", c, p.pos)
+	}
+}
+
+func (p *exprParser) number() (expr, error) {
+	start := p.pos
+	for p.pos < len(p.input) && (isDigit(p.input[p.pos]) || p.input[p.pos] == '.') {
+		p.pos++
+	}
+	// Exponent, e.g. 1e-9
+	if p.pos < len(p.input) && (p.input[p.pos] == 'e' || p.input[p.pos] == 'E') {
+		p.pos++
+		if p.pos < len(p.input) && (p.input[p.pos] == '+' || p.input[p.pos] == '-') {
+			p.pos++
+		}
+		for p.pos < len(p.input) && isDigit(p.input[p.pos]) {
+			p.pos++
+		}
+	}
+	v, err := strconv.ParseFloat(p.input[start:p.pos], 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid number %q", p.input[start:p.pos])
+	}
+	return numberExpr(v), nil
+}
+
+// peek skips spaces and returns the next character, or 0 at the end
+func (p *exprParser) peek() byte {
+	p.skipSpaces()
+	if p.pos >= len(p.input) {
+		return 0
+	}
+	return p.input[p.pos]
+}
+
+func (p *exprParser) skipSpaces() {
+	for p.pos < len(p.input) && (p.input[p.pos] == ' ' || p.input[p.pos] == '\t') {
+		p.pos++
+	}
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isNameStart(c byte) bool {
+	return c == '_' || c == ':' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isNameChar(c byte) bool {
+	return isNameStart(c) || isDigit(c)
+}
@@ -0,0 +1,77 @@
+package metrics
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"agent/internal/config"
+)
+
+func TestParseExpr(t *testing.T) {
+	values := map[string]float64{"a": 6, "b": 2, "c": 4}
+	lookup := func(name string) (float64, bool) {
+		v, ok := values[name]
+		return v, ok
+	}
+
+	tests := map[string]float64{
+		"a + b * c":     14,
+		"(a + b) * c":   32,
+		"a / b - c":     -1,
+		"-a + 10":       4,
+		"a * 1e-1":      0.6,
+		"(a-b)/c * 100": 100,
+	}
+	for input, expected := range tests {
+		e, err := parseExpr(input)
+		require.NoError(t, err, input)
+		v, ok := e.eval(lookup)
+		require.True(t, ok, input)
+		assert.InDelta(t, expected, v, 1e-9, input)
+	}
+
+	for _, input := range []string{"", "a +", "(a + b", "a b", "a % b", "1..2"} {
+		_, err := parseExpr(input)
+		assert.Error(t, err, input)
+	}
+}
+
+func TestDeriverApply(t *testing.T) {
+	d, err := NewDeriver([]config.DerivedMetric{
+		{Name: "mem_used_ratio_excl_cache", Expression: "(mem_used_bytes - mem_cached_bytes) / mem_total_bytes"},
+		{Name: "disk_free_ratio", Expression: "disk_free_bytes / disk_total_bytes"},
+		{Name: "disk_free_percent", Expression: "disk_free_ratio * 100"},
+		{Name: "missing_ratio", Expression: "mem_used_bytes / nope_bytes"},
+	})
+	require.NoError(t, err)
+
+	root := map[string]string{"mountpoint": "/"}
+	home := map[string]string{"mountpoint": "/home"}
+	out := d.Apply([]DataPoint{
+		{Name: "mem_used_bytes", Value: 600, Timestamp: 1},
+		{Name: "mem_cached_bytes", Value: 200, Timestamp: 2},
+		{Name: "mem_total_bytes", Value: 1000, Timestamp: 1},
+		{Name: "disk_free_bytes", Value: 25, Labels: root},
+		{Name: "disk_total_bytes", Value: 100, Labels: root},
+		{Name: "disk_free_bytes", Value: 10, Labels: home},
+		{Name: "disk_total_bytes", Value: 0, Labels: home},
+	})
+
+	derived := out[7:]
+	require.Len(t, derived, 3)
+	assert.Equal(t, DataPoint{Name: "mem_used_ratio_excl_cache", Value: 0.4, Timestamp: 2}, derived[0])
+	// The division by zero of /home is skipped
+	assert.Equal(t, DataPoint{Name: "disk_free_ratio", Value: 0.25, Labels: root}, derived[1])
+	assert.Equal(t, DataPoint{Name: "disk_free_percent", Value: 25, Labels: root}, derived[2])
+}
+
+func TestDeriverInvalid(t *testing.T) {
+	_, err := NewDeriver([]config.DerivedMetric{{Name: "x", Expression: "a +"}})
+	assert.Error(t, err)
+
+	d, err := NewDeriver(nil)
+	require.NoError(t, err)
+	assert.Nil(t, d)
+}
@@ -10,8 +10,10 @@ import (
 	"github.com/shirou/gopsutil/v4/disk"
 
 	"agent/internal/collection"
+	"agent/internal/common"
 	"agent/internal/logger"
 	"agent/internal/metrics"
+	"agent/internal/metrics/mount"
 )
 
 type DiskPS interface {
@@ -69,7 +71,11 @@ func normalizeDeviceName(devicePath string) string {
 
 // getUniquePrimaryPartitions fetches all partitions, then filters them to ensure:
 // 1. Bind mounts are skipped (via "bind" option).
-// 2. Only the first encountered partition for a given underlying block device is included.
+// 2. Network filesystems are skipped, a stale NFS server would block statfs
+// forever. They are covered by the mount collector.
+// 3. The volumes and root filesystems of the containers are skipped, they're
+// seen in the mount table of a Kubernetes node.
+// 4. Only the first encountered partition for a given underlying block device is included.
 func (c *DiskCollector) getUniquePrimaryPartitions() ([]disk.PartitionStat, error) {
 	partitions, err := c.ps.Partitions(false)
 	if err != nil {
@@ -84,7 +90,17 @@ func (c *DiskCollector) getUniquePrimaryPartitions() ([]disk.PartitionStat, erro
 			continue
 		}
 
-		// 2. Enforce uniqueness of the underlying block device
+		// 2. Skip network filesystems
+		if mount.IsNetworkFilesystem(p.Fstype) {
+			continue
+		}
+
+		// 3. Skip the container mounts
+		if isContainerMount(p.Mountpoint) {
+			continue
+		}
+
+		// 4. Enforce uniqueness of the underlying block device
 		deviceName := normalizeDeviceName(p.Device)
 		if _, exists := processedDevices[deviceName]; exists {
 			continue
@@ -97,6 +113,25 @@ func (c *DiskCollector) getUniquePrimaryPartitions() ([]disk.PartitionStat, erro
 	return uniquePartitions, nil
 }
 
+// containerMountDirs hold the mounts of the container runtimes and the kubelet
+var containerMountDirs = []string{
+	"/var/lib/kubelet/",
+	"/var/lib/docker/",
+	"/var/lib/containerd/",
+	"/run/containerd/",
+	"/run/k3s/containerd/",
+	"/var/lib/containers/storage/",
+}
+
+func isContainerMount(mountpoint string) bool {
+	for _, dir := range containerMountDirs {
+		if strings.HasPrefix(mountpoint, dir) {
+			return true
+		}
+	}
+	return false
+}
+
 var diskMetrics = []struct {
 	name     string
 	getValue func(*disk.UsageStat) float64
@@ -205,7 +240,7 @@ func (c *DiskCollector) CollectAll() ([]metrics.DataPoint, error) {
 	var datapoints []metrics.DataPoint
 	for _, p := range partitions {
 		// Collect usage metrics
-		usage, err := c.ps.Usage(p.Mountpoint)
+		usage, err := c.ps.Usage(common.HostPath(p.Mountpoint))
 		if err != nil {
 			logger.Log.Error("failed to get usage stats", "mountpoint", p.Mountpoint)
 			continue
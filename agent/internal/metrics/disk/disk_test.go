@@ -127,9 +127,11 @@ func TestDiskCollector_UniquePartitions(t *testing.T) {
 	var mps mockPS
 	partitions := []disk.PartitionStat{
 		{Device: "/dev/sda1", Mountpoint: "/", Opts: []string{"rw"}},
-		{Device: "/dev/sda1", Mountpoint: "/mnt/bind", Opts: []string{"rw", "bind"}}, // Bind mount, skip
-		{Device: "/dev/sda1", Mountpoint: "/other", Opts: []string{"rw"}},            // Same device, skip
-		{Device: "/dev/sdb1", Mountpoint: "/data", Opts: []string{"rw"}},             // New device, keep
+		{Device: "/dev/sda1", Mountpoint: "/mnt/bind", Opts: []string{"rw", "bind"}},                                           // Bind mount, skip
+		{Device: "/dev/sda1", Mountpoint: "/other", Opts: []string{"rw"}},                                                      // Same device, skip
+		{Device: "/dev/sdb1", Mountpoint: "/data", Opts: []string{"rw"}},                                                       // New device, keep
+		{Device: "/dev/sdc1", Mountpoint: "/var/lib/kubelet/pods/1/volumes/pvc", Opts: []string{"rw"}},                         // Pod volume, skip
+		{Device: "overlay", Mountpoint: "/run/containerd/io.containerd.runtime.v2.task/k8s.io/1/rootfs", Opts: []string{"rw"}}, // Container root, skip
 	}
 
 	mps.On("Partitions", false).Return(partitions, nil).Once()
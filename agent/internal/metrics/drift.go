@@ -0,0 +1,129 @@
+package metrics
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"agent/internal/collection"
+	"agent/internal/exporter"
+	"agent/internal/logger"
+	"agent/internal/selfstats"
+)
+
+// driftThreshold is the number of consecutive collections a selected series
+// must be missing before it's reported, so that series skipped once in a
+// while (first sample of a rate, transient errors) are not.
+const driftThreshold = 3
+
+// Drift is a series selected in the collection config that a collector
+// stopped reporting, e.g. because a disk was removed or an interface renamed.
+type Drift struct {
+	Collector string
+	Metric    collection.Metric
+}
+
+// DriftDetector compares the series reported by the collectors with the ones
+// selected in the collection config. Each missing series is reported once,
+// and again if it comes back then disappears.
+type DriftDetector struct {
+	// misses is the number of consecutive collections each series was
+	// missing, by collector and series
+	misses map[string]int
+}
+
+func NewDriftDetector() *DriftDetector {
+	return &DriftDetector{misses: make(map[string]int)}
+}
+
+// Observe records the data points reported by a collector and returns the
+// selected series that just crossed the drift threshold.
+func (d *DriftDetector) Observe(collector string, selected []collection.Metric, collected []DataPoint) []Drift {
+	if d == nil {
+		return nil
+	}
+	reported := make(map[string]bool, len(collected))
+	for _, dp := range collected {
+		reported[seriesKey(dp)] = true
+	}
+
+	var drifts []Drift
+	for _, m := range selected {
+		key := seriesKey(DataPoint{Name: m.Name, Labels: m.Labels})
+		missesKey := collector + "\x00" + key
+		if reported[key] || matchesAny(m, collected) {
+			if d.misses[missesKey] >= driftThreshold {
+				logger.Log.Info("Selected metric is reported again", "collector", collector, "metric", m.Name, "labels", m.Labels)
+			}
+			delete(d.misses, missesKey)
+			continue
+		}
+		d.misses[missesKey]++
+		if d.misses[missesKey] == driftThreshold {
+			drifts = append(drifts, Drift{Collector: collector, Metric: m})
+		}
+	}
+	return drifts
+}
+
+// matchesAny reports whether a selected template, with wildcard label values,
+// matches any of the collected data points
+func matchesAny(m collection.Metric, collected []DataPoint) bool {
+	pattern := labelPattern(m)
+	if !isTemplate(pattern) {
+		return false
+	}
+	for _, dp := range collected {
+		if dp.Name == m.Name && labelsMatch(dp.Labels, pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+// reportDrifts logs the drifts, counts them in the self-metrics and returns the
+// events sent to the backend so that it can prompt for a new selection.
+func reportDrifts(drifts []Drift) []exporter.LogPayload {
+	timestamp := strconv.FormatInt(time.Now().UnixMilli(), 10)
+	events := make([]exporter.LogPayload, 0, len(drifts))
+	for _, drift := range drifts {
+		logger.Log.Warn("Selected metric is no longer reported", "collector", drift.Collector, "metric", drift.Metric.Name, "labels", drift.Metric.Labels)
+		selfstats.NewCounter("metrics_config_drift_total", map[string]string{"collector": drift.Collector}).Inc()
+		events = append(events, exporter.LogPayload{
+			Timestamp: timestamp,
+			Labels: map[string]string{
+				"source":    "agent",
+				"event":     "config_drift",
+				"collector": drift.Collector,
+			},
+			Metadata: map[string]string{
+				"metric":        drift.Metric.Name,
+				"metric_labels": formatLabels(drift.Metric.Labels),
+			},
+			Message: fmt.Sprintf(
+				"Metric %s%s selected in the collection config is no longer reported by the %s collector",
+				drift.Metric.Name, braced(drift.Metric.Labels), drift.Collector,
+			),
+		})
+	}
+	return events
+}
+
+// formatLabels returns the labels as sorted k=v pairs separated by commas
+func formatLabels(labels map[string]string) string {
+	pairs := make([]string, 0, len(labels))
+	for _, k := range slices.Sorted(maps.Keys(labels)) {
+		pairs = append(pairs, k+"="+labels[k])
+	}
+	return strings.Join(pairs, ",")
+}
+
+func braced(labels map[string]string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	return "{" + formatLabels(labels) + "}"
+}
@@ -0,0 +1,78 @@
+package metrics
+
+import (
+	"io"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"agent/internal/collection"
+	"agent/internal/logger"
+	"agent/internal/selfstats"
+)
+
+func init() {
+	logger.Log = slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+func TestDriftDetector(t *testing.T) {
+	d := NewDriftDetector()
+	selected := []collection.Metric{
+		{Name: "disk_used_bytes", Labels: map[string]string{"mountpoint": "/"}},
+		{Name: "disk_used_bytes", Labels: map[string]string{"mountpoint": "/mnt/usb"}},
+	}
+	root := DataPoint{Name: "disk_used_bytes", Labels: map[string]string{"mountpoint": "/"}}
+	usb := DataPoint{Name: "disk_used_bytes", Labels: map[string]string{"mountpoint": "/mnt/usb"}}
+
+	// A series missing once is not a drift
+	assert.Empty(t, d.Observe("disk", selected, []DataPoint{root}))
+	assert.Empty(t, d.Observe("disk", selected, []DataPoint{root, usb}))
+
+	for i := 1; i < driftThreshold; i++ {
+		assert.Empty(t, d.Observe("disk", selected, []DataPoint{root}))
+	}
+	drifts := d.Observe("disk", selected, []DataPoint{root})
+	require.Len(t, drifts, 1)
+	assert.Equal(t, Drift{Collector: "disk", Metric: selected[1]}, drifts[0])
+
+	// Reported once, then again after coming back
+	assert.Empty(t, d.Observe("disk", selected, []DataPoint{root}))
+	assert.Empty(t, d.Observe("disk", selected, []DataPoint{root, usb}))
+	for i := 1; i < driftThreshold; i++ {
+		d.Observe("disk", selected, []DataPoint{root})
+	}
+	assert.Len(t, d.Observe("disk", selected, []DataPoint{root}), 1)
+}
+
+func TestDriftDetectorTemplate(t *testing.T) {
+	d := NewDriftDetector()
+	selected := []collection.Metric{
+		{Name: "disk_used_bytes", Labels: map[string]string{"mountpoint": WildcardLabelValue}},
+	}
+	usb := DataPoint{Name: "disk_used_bytes", Labels: map[string]string{"mountpoint": "/mnt/usb"}}
+
+	// Any series matching the template is enough
+	for i := 0; i < driftThreshold; i++ {
+		assert.Empty(t, d.Observe("disk", selected, []DataPoint{usb}))
+	}
+	for i := 1; i < driftThreshold; i++ {
+		assert.Empty(t, d.Observe("disk", selected, nil))
+	}
+	assert.Len(t, d.Observe("disk", selected, nil), 1)
+}
+
+func TestReportDrifts(t *testing.T) {
+	selfstats.Reset()
+	events := reportDrifts([]Drift{{
+		Collector: "net",
+		Metric:    collection.Metric{Name: "net_bytes_recv_total", Labels: map[string]string{"interface": "eth0"}},
+	}})
+
+	require.Len(t, events, 1)
+	assert.Equal(t, map[string]string{"source": "agent", "event": "config_drift", "collector": "net"}, events[0].Labels)
+	assert.Equal(t, "interface=eth0", events[0].Metadata["metric_labels"])
+	assert.Contains(t, events[0].Message, "net_bytes_recv_total{interface=eth0}")
+	assert.Equal(t, 1.0, selfstats.NewCounter("metrics_config_drift_total", map[string]string{"collector": "net"}).Value())
+}
@@ -0,0 +1,324 @@
+package elasticsearch
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"agent/internal/collection"
+	"agent/internal/config"
+	"agent/internal/logger"
+	"agent/internal/metrics"
+)
+
+const defaultURL = "http://localhost:9200"
+
+type ElasticsearchPS interface {
+	// Get decodes the JSON response of an API path into v.
+	Get(path string, v any) error
+}
+
+type systemPS struct {
+	endpoint config.ElasticsearchEndpoint
+	client   *http.Client
+}
+
+func (s *systemPS) Get(path string, v any) error {
+	req, err := http.NewRequest("GET", strings.TrimRight(s.endpoint.URL, "/")+path, nil)
+	if err != nil {
+		return err
+	}
+	switch {
+	case s.endpoint.APIKey != "":
+		req.Header.Set("Authorization", "ApiKey "+s.endpoint.APIKey)
+	case s.endpoint.Username != "":
+		req.SetBasicAuth(s.endpoint.Username, s.endpoint.Password)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to query elasticsearch: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("elasticsearch returned status %d for %s", resp.StatusCode, path)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("failed to decode %s: %w", path, err)
+	}
+	return nil
+}
+
+type clusterHealth struct {
+	ClusterName        string  `json:"cluster_name"`
+	Status             string  `json:"status"`
+	Nodes              float64 `json:"number_of_nodes"`
+	ActiveShards       float64 `json:"active_shards"`
+	RelocatingShards   float64 `json:"relocating_shards"`
+	InitializingShards float64 `json:"initializing_shards"`
+	UnassignedShards   float64 `json:"unassigned_shards"`
+	PendingTasks       float64 `json:"number_of_pending_tasks"`
+}
+
+type threadPool struct {
+	Queue    float64 `json:"queue"`
+	Rejected float64 `json:"rejected"`
+}
+
+type nodeStats struct {
+	Name string `json:"name"`
+	JVM  struct {
+		Mem struct {
+			HeapUsed float64 `json:"heap_used_in_bytes"`
+			HeapMax  float64 `json:"heap_max_in_bytes"`
+		} `json:"mem"`
+	} `json:"jvm"`
+	Indices struct {
+		Docs struct {
+			Count float64 `json:"count"`
+		} `json:"docs"`
+		Store struct {
+			Size float64 `json:"size_in_bytes"`
+		} `json:"store"`
+		Indexing struct {
+			Total  float64 `json:"index_total"`
+			TimeMs float64 `json:"index_time_in_millis"`
+		} `json:"indexing"`
+		Search struct {
+			Total  float64 `json:"query_total"`
+			TimeMs float64 `json:"query_time_in_millis"`
+		} `json:"search"`
+	} `json:"indices"`
+	ThreadPool map[string]threadPool `json:"thread_pool"`
+}
+
+// esStats is an internal type used to store the state of the local node
+type esStats struct {
+	Ts      int64
+	Cluster clusterHealth
+	Node    nodeStats
+}
+
+// monitoredPools are the thread pools whose queues and rejections are reported
+var monitoredPools = []string{"write", "search", "get"}
+
+// esMetrics list the available metrics inside the elasticsearch package
+var esMetrics = []struct {
+	name   string
+	getVal func(current, previous *esStats) float64
+}{
+	{"elasticsearch_cluster_status", func(c, p *esStats) float64 {
+		// 0 is green, 1 yellow, 2 red
+		switch c.Cluster.Status {
+		case "green":
+			return 0
+		case "yellow":
+			return 1
+		default:
+			return 2
+		}
+	}},
+	{"elasticsearch_cluster_nodes_total", func(c, p *esStats) float64 { return c.Cluster.Nodes }},
+	{"elasticsearch_shards_active_total", func(c, p *esStats) float64 { return c.Cluster.ActiveShards }},
+	{"elasticsearch_shards_relocating_total", func(c, p *esStats) float64 { return c.Cluster.RelocatingShards }},
+	{"elasticsearch_shards_initializing_total", func(c, p *esStats) float64 { return c.Cluster.InitializingShards }},
+	{"elasticsearch_shards_unassigned_total", func(c, p *esStats) float64 { return c.Cluster.UnassignedShards }},
+	{"elasticsearch_pending_tasks_total", func(c, p *esStats) float64 { return c.Cluster.PendingTasks }},
+	{"elasticsearch_heap_used_bytes", func(c, p *esStats) float64 { return c.Node.JVM.Mem.HeapUsed }},
+	{"elasticsearch_heap_max_bytes", func(c, p *esStats) float64 { return c.Node.JVM.Mem.HeapMax }},
+	{"elasticsearch_heap_used_ratio", func(c, p *esStats) float64 {
+		if c.Node.JVM.Mem.HeapMax <= 0 {
+			return 0
+		}
+		return c.Node.JVM.Mem.HeapUsed / c.Node.JVM.Mem.HeapMax
+	}},
+	{"elasticsearch_docs_total", func(c, p *esStats) float64 { return c.Node.Indices.Docs.Count }},
+	{"elasticsearch_store_bytes", func(c, p *esStats) float64 { return c.Node.Indices.Store.Size }},
+	{"elasticsearch_indexing_rate", func(c, p *esStats) float64 {
+		return rate(c, p, func(s *esStats) float64 { return s.Node.Indices.Indexing.Total })
+	}},
+	{"elasticsearch_indexing_latency_ms", func(c, p *esStats) float64 {
+		return latency(c, p, func(s *esStats) (float64, float64) {
+			return s.Node.Indices.Indexing.Total, s.Node.Indices.Indexing.TimeMs
+		})
+	}},
+	{"elasticsearch_search_rate", func(c, p *esStats) float64 {
+		return rate(c, p, func(s *esStats) float64 { return s.Node.Indices.Search.Total })
+	}},
+	{"elasticsearch_search_latency_ms", func(c, p *esStats) float64 {
+		return latency(c, p, func(s *esStats) (float64, float64) {
+			return s.Node.Indices.Search.Total, s.Node.Indices.Search.TimeMs
+		})
+	}},
+}
+
+// esPoolMetrics list the metrics reported for each thread pool
+var esPoolMetrics = []struct {
+	name   string
+	getVal func(current, previous *threadPool, deltaMs float64) float64
+}{
+	{"elasticsearch_thread_pool_queue_total", func(c, p *threadPool, _ float64) float64 { return c.Queue }},
+	{"elasticsearch_thread_pool_rejected_rate", func(c, p *threadPool, deltaMs float64) float64 {
+		if p == nil || deltaMs <= 0 || c.Rejected < p.Rejected {
+			return 0
+		}
+		return (c.Rejected - p.Rejected) / deltaMs * 1000
+	}},
+}
+
+// rate returns the per second rate of a counter, 0 on the first collection
+// and after a node restart.
+func rate(c, p *esStats, counter func(*esStats) float64) float64 {
+	if p == nil || c.Ts <= p.Ts || counter(c) < counter(p) {
+		return 0
+	}
+	return (counter(c) - counter(p)) / float64(c.Ts-p.Ts) * 1000
+}
+
+// latency returns the average time spent per operation since the previous
+// collection.
+func latency(c, p *esStats, counters func(*esStats) (total, timeMs float64)) float64 {
+	if p == nil {
+		return 0
+	}
+	total, timeMs := counters(c)
+	prevTotal, prevTimeMs := counters(p)
+	if total <= prevTotal || timeMs < prevTimeMs {
+		return 0
+	}
+	return (timeMs - prevTimeMs) / (total - prevTotal)
+}
+
+// ElasticsearchCollector reads cluster health and local node statistics of
+// an Elasticsearch or OpenSearch node.
+type ElasticsearchCollector struct {
+	metrics.BaseCollector
+
+	ps        ElasticsearchPS
+	lastStats *esStats
+}
+
+func NewElasticsearchCollector(cfg *config.Config) *ElasticsearchCollector {
+	endpoint := config.ElasticsearchEndpoint{URL: defaultURL}
+	if cfg.Elasticsearch != nil {
+		endpoint = *cfg.Elasticsearch
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if endpoint.InsecureSkipVerify {
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+	return &ElasticsearchCollector{
+		ps: &systemPS{
+			endpoint: endpoint,
+			client:   &http.Client{Timeout: 5 * time.Second, Transport: transport},
+		},
+	}
+}
+
+func (c *ElasticsearchCollector) Name() string {
+	return "elasticsearch"
+}
+
+func (c *ElasticsearchCollector) Collect() ([]metrics.DataPoint, error) {
+	all, err := c.CollectAll()
+	if err != nil {
+		return nil, err
+	}
+	var included []metrics.DataPoint
+	for _, dp := range all {
+		if c.IsIncluded(dp.Name, dp.Labels) {
+			included = append(included, dp)
+		}
+	}
+	return included, nil
+}
+
+func (c *ElasticsearchCollector) CollectAll() ([]metrics.DataPoint, error) {
+	stats, err := c.getStats()
+	if err != nil {
+		logger.Log.Debug("Failed to collect metrics", "collector", c.Name(), "error", err)
+		return nil, nil
+	}
+	results := buildDataPoints(stats, c.lastStats)
+	c.lastStats = stats
+	return results, nil
+}
+
+func buildDataPoints(stats, previous *esStats) []metrics.DataPoint {
+	labels := map[string]string{"cluster": stats.Cluster.ClusterName, "node": stats.Node.Name}
+	var results []metrics.DataPoint
+	for _, m := range esMetrics {
+		results = append(results, metrics.DataPoint{
+			Name:      m.name,
+			Timestamp: stats.Ts,
+			Value:     m.getVal(stats, previous),
+			Labels:    labels,
+		})
+	}
+
+	var deltaMs float64
+	if previous != nil {
+		deltaMs = float64(stats.Ts - previous.Ts)
+	}
+	for _, pool := range monitoredPools {
+		current, ok := stats.Node.ThreadPool[pool]
+		if !ok {
+			continue
+		}
+		var last *threadPool
+		if previous != nil {
+			if p, ok := previous.Node.ThreadPool[pool]; ok {
+				last = &p
+			}
+		}
+		poolLabels := map[string]string{"cluster": stats.Cluster.ClusterName, "node": stats.Node.Name, "pool": pool}
+		for _, m := range esPoolMetrics {
+			results = append(results, metrics.DataPoint{
+				Name:      m.name,
+				Timestamp: stats.Ts,
+				Value:     m.getVal(&current, last, deltaMs),
+				Labels:    poolLabels,
+			})
+		}
+	}
+	return results
+}
+
+func (c *ElasticsearchCollector) Discover() ([]collection.Metric, error) {
+	stats, err := c.getStats()
+	if err != nil {
+		return []collection.Metric{}, nil
+	}
+	var discovered []collection.Metric
+	for _, dp := range buildDataPoints(stats, nil) {
+		discovered = append(discovered, collection.Metric{
+			Name:   dp.Name,
+			Type:   "gauge",
+			Labels: dp.Labels,
+		})
+	}
+	return discovered, nil
+}
+
+func (c *ElasticsearchCollector) getStats() (*esStats, error) {
+	stats := &esStats{Ts: time.Now().UnixMilli()}
+	if err := c.ps.Get("/_cluster/health", &stats.Cluster); err != nil {
+		return nil, err
+	}
+
+	var nodes struct {
+		Nodes map[string]nodeStats `json:"nodes"`
+	}
+	if err := c.ps.Get("/_nodes/_local/stats/jvm,indices,thread_pool", &nodes); err != nil {
+		return nil, err
+	}
+	if len(nodes.Nodes) != 1 {
+		return nil, fmt.Errorf("expected the local node stats, got %d nodes", len(nodes.Nodes))
+	}
+	for _, node := range nodes.Nodes {
+		stats.Node = node
+	}
+	return stats, nil
+}
@@ -0,0 +1,117 @@
+package elasticsearch
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"agent/internal/config"
+	"agent/internal/logger"
+	"agent/internal/metrics"
+)
+
+func init() {
+	logger.Log = slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+const healthBody = `{"cluster_name":"search","status":"yellow","number_of_nodes":3,
+"active_shards":20,"relocating_shards":0,"initializing_shards":1,"unassigned_shards":2,"number_of_pending_tasks":0}`
+
+const nodesBody = `{"nodes":{"aBcD":{"name":"es-1",
+  "jvm":{"mem":{"heap_used_in_bytes":512,"heap_max_in_bytes":2048}},
+  "indices":{"docs":{"count":1000},"store":{"size_in_bytes":4096},
+    "indexing":{"index_total":%d,"index_time_in_millis":%d},
+    "search":{"query_total":50,"query_time_in_millis":500}},
+  "thread_pool":{"write":{"queue":3,"rejected":%d},"search":{"queue":0,"rejected":0},"snapshot":{"queue":0,"rejected":0}}}}}`
+
+func findPoint(t *testing.T, dps []metrics.DataPoint, name string, labels map[string]string) metrics.DataPoint {
+	t.Helper()
+	for _, dp := range dps {
+		if dp.Name != name {
+			continue
+		}
+		match := true
+		for k, v := range labels {
+			if dp.Labels[k] != v {
+				match = false
+			}
+		}
+		if match {
+			return dp
+		}
+	}
+	t.Fatalf("data point %s %v not found", name, labels)
+	return metrics.DataPoint{}
+}
+
+func TestElasticsearchCollector(t *testing.T) {
+	indexTotal, indexTime, rejected := 100, 200, 5
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "ApiKey secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/_cluster/health":
+			fmt.Fprint(w, healthBody)
+		case "/_nodes/_local/stats/jvm,indices,thread_pool":
+			fmt.Fprintf(w, nodesBody, indexTotal, indexTime, rejected)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	c := &ElasticsearchCollector{ps: &systemPS{
+		endpoint: config.ElasticsearchEndpoint{URL: server.URL, APIKey: "secret"},
+		client:   server.Client(),
+	}}
+	dps, err := c.CollectAll()
+	require.NoError(t, err)
+
+	node := map[string]string{"cluster": "search", "node": "es-1"}
+	assert.Equal(t, 1.0, findPoint(t, dps, "elasticsearch_cluster_status", node).Value)
+	assert.Equal(t, 2.0, findPoint(t, dps, "elasticsearch_shards_unassigned_total", node).Value)
+	assert.Equal(t, 0.25, findPoint(t, dps, "elasticsearch_heap_used_ratio", node).Value)
+	assert.Equal(t, 0.0, findPoint(t, dps, "elasticsearch_indexing_rate", node).Value)
+	assert.Equal(t, 3.0, findPoint(t, dps, "elasticsearch_thread_pool_queue_total", map[string]string{"pool": "write"}).Value)
+	for _, dp := range dps {
+		assert.NotEqual(t, "snapshot", dp.Labels["pool"], "only monitored pools are reported")
+	}
+
+	// Second collection reports rates and latencies since the first one
+	c.lastStats.Ts -= 2000
+	indexTotal, indexTime, rejected = 300, 600, 9
+	dps, err = c.CollectAll()
+	require.NoError(t, err)
+	assert.InDelta(t, 100, findPoint(t, dps, "elasticsearch_indexing_rate", node).Value, 1)
+	assert.InDelta(t, 2, findPoint(t, dps, "elasticsearch_indexing_latency_ms", node).Value, 0.001)
+	assert.Equal(t, 0.0, findPoint(t, dps, "elasticsearch_search_latency_ms", node).Value)
+	assert.InDelta(t, 2, findPoint(t, dps, "elasticsearch_thread_pool_rejected_rate", map[string]string{"pool": "write"}).Value, 0.01)
+}
+
+func TestElasticsearchCollectorUnavailable(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	c := &ElasticsearchCollector{ps: &systemPS{
+		endpoint: config.ElasticsearchEndpoint{URL: server.URL, Username: "elastic", Password: "wrong"},
+		client:   &http.Client{Timeout: time.Second},
+	}}
+	dps, err := c.CollectAll()
+	assert.NoError(t, err)
+	assert.Empty(t, dps)
+
+	discovered, err := c.Discover()
+	assert.NoError(t, err)
+	assert.Empty(t, discovered)
+}
@@ -0,0 +1,129 @@
+package metrics
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"agent/internal/exporter"
+	"agent/internal/logger"
+	"agent/internal/selfstats"
+)
+
+// errorBudget is the number of consecutive failed collections after which a
+// collector is disabled, e.g. nginx once its status page was removed
+const errorBudget = 5
+
+// A disabled collector is retried after disabledRetry, then twice as late
+// after each failed retry, up to maxDisabledRetry
+const (
+	disabledRetry    = 30 * time.Minute
+	maxDisabledRetry = 6 * time.Hour
+)
+
+// BudgetEvent is a collector disabled because it exhausted its error budget,
+// or re-enabled because a retry succeeded.
+type BudgetEvent struct {
+	Collector string
+	Disabled  bool
+	// Failures is the number of consecutive failed collections
+	Failures int
+	Err      error
+	// Retry is the delay before the next attempt of a disabled collector
+	Retry time.Duration
+}
+
+// ErrorBudget stops running the collectors failing on every collection, so
+// that they don't log the same error every interval forever. They're retried
+// with a long backoff and re-enabled on the first success.
+type ErrorBudget struct {
+	failures map[string]int
+	disabled map[string]*disabledCollector
+	now      func() time.Time
+}
+
+type disabledCollector struct {
+	retryAt time.Time
+	backoff time.Duration
+}
+
+func NewErrorBudget() *ErrorBudget {
+	return &ErrorBudget{
+		failures: make(map[string]int),
+		disabled: make(map[string]*disabledCollector),
+		now:      time.Now,
+	}
+}
+
+// Allow reports whether a collector runs on this collection: always when
+// it's enabled, once its retry is due when it's disabled
+func (b *ErrorBudget) Allow(collector string) bool {
+	if b == nil {
+		return true
+	}
+	d, ok := b.disabled[collector]
+	return !ok || !b.now().Before(d.retryAt)
+}
+
+// Disabled reports whether a collector is disabled
+func (b *ErrorBudget) Disabled(collector string) bool {
+	if b == nil {
+		return false
+	}
+	_, ok := b.disabled[collector]
+	return ok
+}
+
+// Observe records the outcome of a collection and returns the event of a
+// collector just disabled or re-enabled, nil otherwise
+func (b *ErrorBudget) Observe(collector string, err error) *BudgetEvent {
+	if b == nil {
+		return nil
+	}
+	if err == nil {
+		failures := b.failures[collector]
+		delete(b.failures, collector)
+		if _, ok := b.disabled[collector]; !ok {
+			return nil
+		}
+		delete(b.disabled, collector)
+		return &BudgetEvent{Collector: collector, Failures: failures}
+	}
+
+	b.failures[collector]++
+	if d, ok := b.disabled[collector]; ok {
+		d.backoff = min(2*d.backoff, maxDisabledRetry)
+		d.retryAt = b.now().Add(d.backoff)
+		return nil
+	}
+	if b.failures[collector] < errorBudget {
+		return nil
+	}
+	b.disabled[collector] = &disabledCollector{retryAt: b.now().Add(disabledRetry), backoff: disabledRetry}
+	return &BudgetEvent{Collector: collector, Disabled: true, Failures: b.failures[collector], Err: err, Retry: disabledRetry}
+}
+
+// reportBudgetEvents logs the disabled and re-enabled collectors, tracks
+// them in the self-metrics and returns the events sent to the backend so that
+// the collector can be shown as failing.
+func reportBudgetEvents(events []BudgetEvent) []exporter.LogPayload {
+	payloads := make([]exporter.LogPayload, 0, len(events))
+	for _, e := range events {
+		disabled := selfstats.NewGauge("metrics_collector_disabled", map[string]string{"collector": e.Collector})
+		metadata := map[string]string{"collector": e.Collector, "failures": strconv.Itoa(e.Failures)}
+		if !e.Disabled {
+			logger.Log.Info("Collector re-enabled", "collector", e.Collector, "failures", e.Failures)
+			disabled.Set(0)
+			payloads = append(payloads, exporter.AgentEvent("collector_enabled",
+				fmt.Sprintf("The %s collector works again after %d failed collections", e.Collector, e.Failures), metadata))
+			continue
+		}
+		logger.Log.Warn("Collector disabled", "collector", e.Collector, "failures", e.Failures, "retry", e.Retry, "error", e.Err)
+		disabled.Set(1)
+		metadata["error"] = e.Err.Error()
+		metadata["retry_seconds"] = strconv.Itoa(int(e.Retry.Seconds()))
+		payloads = append(payloads, exporter.AgentEvent("collector_disabled",
+			fmt.Sprintf("The %s collector failed %d consecutive collections and is disabled, it's retried in %s: %v", e.Collector, e.Failures, e.Retry, e.Err), metadata))
+	}
+	return payloads
+}
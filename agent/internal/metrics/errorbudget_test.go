@@ -0,0 +1,94 @@
+package metrics
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"agent/internal/selfstats"
+)
+
+func TestErrorBudget(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	b := NewErrorBudget()
+	b.now = func() time.Time { return now }
+	errStatus := errors.New("stub_status returned 404")
+
+	// Failures below the budget, a success resets them
+	for i := 1; i < errorBudget; i++ {
+		assert.Nil(t, b.Observe("nginx", errStatus))
+	}
+	assert.Nil(t, b.Observe("nginx", nil))
+	for i := 1; i < errorBudget; i++ {
+		assert.Nil(t, b.Observe("nginx", errStatus))
+	}
+	assert.True(t, b.Allow("nginx"))
+
+	event := b.Observe("nginx", errStatus)
+	require.NotNil(t, event)
+	assert.Equal(t, BudgetEvent{Collector: "nginx", Disabled: true, Failures: errorBudget, Err: errStatus, Retry: disabledRetry}, *event)
+	assert.True(t, b.Disabled("nginx"))
+	assert.False(t, b.Allow("nginx"))
+	assert.True(t, b.Allow("cpu"))
+
+	// A failed retry doubles the backoff
+	now = now.Add(disabledRetry)
+	assert.True(t, b.Allow("nginx"))
+	assert.Nil(t, b.Observe("nginx", errStatus))
+	now = now.Add(disabledRetry)
+	assert.False(t, b.Allow("nginx"))
+	now = now.Add(disabledRetry)
+	assert.True(t, b.Allow("nginx"))
+
+	// A successful retry re-enables it
+	event = b.Observe("nginx", nil)
+	require.NotNil(t, event)
+	assert.Equal(t, BudgetEvent{Collector: "nginx", Failures: errorBudget + 1}, *event)
+	assert.False(t, b.Disabled("nginx"))
+	assert.True(t, b.Allow("nginx"))
+
+	var disabled *ErrorBudget
+	assert.True(t, disabled.Allow("nginx"))
+	assert.Nil(t, disabled.Observe("nginx", errStatus))
+}
+
+func TestErrorBudgetBackoffCap(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	b := NewErrorBudget()
+	b.now = func() time.Time { return now }
+	for i := 0; i < errorBudget+10; i++ {
+		b.Observe("nginx", errors.New("connection refused"))
+	}
+	assert.Equal(t, maxDisabledRetry, b.disabled["nginx"].backoff)
+}
+
+func TestPerformCollectionErrorBudget(t *testing.T) {
+	nginx := &countingCollector{name: "nginx", err: errors.New("connection refused")}
+	cpu := &countingCollector{name: "cpu", dps: []DataPoint{{Name: "cpu_usage_ratio", Value: 0.5}}}
+	collectors := []MetricCollector{nginx, cpu}
+	b := NewErrorBudget()
+
+	var events []BudgetEvent
+	for i := 0; i < errorBudget+3; i++ {
+		collected, _, budgetEvents := performCollection(collectors, nil, b, nil)
+		assert.Len(t, collected, 1)
+		events = append(events, budgetEvents...)
+	}
+	assert.Equal(t, errorBudget, nginx.calls, "a disabled collector isn't run until its retry")
+	assert.Equal(t, errorBudget+3, cpu.calls)
+	require.Len(t, events, 1)
+
+	payloads := reportBudgetEvents(events)
+	require.Len(t, payloads, 1)
+	assert.Equal(t, "collector_disabled", payloads[0].Labels["event"])
+	assert.Equal(t, "nginx", payloads[0].Metadata["collector"])
+	assert.Equal(t, "connection refused", payloads[0].Metadata["error"])
+	assert.Equal(t, 1.0, selfstats.NewGauge("metrics_collector_disabled", map[string]string{"collector": "nginx"}).Value())
+
+	payloads = reportBudgetEvents([]BudgetEvent{{Collector: "nginx", Failures: 6}})
+	assert.Equal(t, "collector_enabled", payloads[0].Labels["event"])
+	assert.Equal(t, 0.0, selfstats.NewGauge("metrics_collector_disabled", map[string]string{"collector": "nginx"}).Value())
+}
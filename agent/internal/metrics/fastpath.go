@@ -0,0 +1,194 @@
+package metrics
+
+import (
+	"slices"
+	"time"
+
+	"agent/internal/config"
+	"agent/internal/logger"
+)
+
+const defaultFastPathInterval = 15 * time.Second
+
+// FastPath collects a few critical metrics (heartbeat, load, request rates)
+// several times per collection interval, so that incidents can be
+// investigated with a finer granularity without collecting everything as
+// often. Fast collections only run the collectors that reported one of the
+// metrics during the last full collection, and are exported in their own
+// batches.
+type FastPath struct {
+	names map[string]bool
+	// interval between two collections, full or fast
+	interval time.Duration
+	// every is the number of collections per collection interval, one of
+	// them is a full collection
+	every int
+	// collectors reporting a fast path metric, by name
+	collectors map[string]bool
+	// aggregations are the functions applied over the collection interval,
+	// the fast collections are exported when empty
+	aggregations []string
+	// window holds the values of each series since the last full
+	// collection, by series key
+	window map[string]*windowStats
+}
+
+// windowStats are the values of a series over the collection interval
+type windowStats struct {
+	min, max, sum float64
+	count         int
+}
+
+// aggregations supported by the fast path
+var fastPathAggregations = map[string]bool{"min": true, "max": true, "avg": true}
+
+// NewFastPath returns the fast path of the given collection interval, or nil
+// when no metric is selected or the fast interval isn't shorter.
+func NewFastPath(cfg config.FastPathConfig, interval time.Duration) *FastPath {
+	if len(cfg.Metrics) == 0 || interval <= 0 {
+		return nil
+	}
+	fast := time.Duration(cfg.IntervalSeconds) * time.Second
+	if fast <= 0 {
+		fast = defaultFastPathInterval
+	}
+	every := int(interval / max(fast, time.Second))
+	if every < 2 {
+		logger.Log.Warn("Ignoring fast path, its interval isn't shorter than the collection interval", "interval", fast)
+		return nil
+	}
+	names := make(map[string]bool, len(cfg.Metrics))
+	for _, name := range cfg.Metrics {
+		names[name] = true
+	}
+	var aggregations []string
+	for _, aggregation := range cfg.Aggregations {
+		if !fastPathAggregations[aggregation] {
+			logger.Log.Warn("Ignoring unknown fast path aggregation", "aggregation", aggregation)
+			continue
+		}
+		if !slices.Contains(aggregations, aggregation) {
+			aggregations = append(aggregations, aggregation)
+		}
+	}
+	return &FastPath{
+		names:        names,
+		interval:     interval / time.Duration(every),
+		every:        every,
+		collectors:   make(map[string]bool),
+		aggregations: aggregations,
+		window:       make(map[string]*windowStats),
+	}
+}
+
+// Interval returns the time between two collections
+func (f *FastPath) Interval(interval time.Duration) time.Duration {
+	if f == nil {
+		return interval
+	}
+	return f.interval
+}
+
+// IsFull reports whether the nth collection, starting at 0, must collect
+// everything
+func (f *FastPath) IsFull(n int) bool {
+	return f == nil || n%f.every == 0
+}
+
+// observe records whether a collector reported fast path metrics during a
+// full collection
+func (f *FastPath) observe(collector string, dps []DataPoint) {
+	if f == nil {
+		return
+	}
+	delete(f.collectors, collector)
+	for _, dp := range dps {
+		if f.names[dp.Name] {
+			f.collectors[collector] = true
+			return
+		}
+	}
+}
+
+// Collect runs the collectors reporting fast path metrics and returns these
+// metrics only
+func (f *FastPath) Collect(collectors []MetricCollector) []DataPoint {
+	if f == nil {
+		return nil
+	}
+	var collected []DataPoint
+	for _, c := range collectors {
+		if !f.collectors[c.Name()] {
+			continue
+		}
+		dps, err := c.Collect()
+		if err != nil {
+			logger.Log.Debug("failed to collect fast path metrics", "collector", c.Name(), "error", err)
+			continue
+		}
+		for _, dp := range dps {
+			if f.names[dp.Name] {
+				collected = append(collected, dp)
+			}
+		}
+	}
+	return collected
+}
+
+// Aggregating reports whether the fast collections are aggregated instead
+// of exported
+func (f *FastPath) Aggregating() bool {
+	return f != nil && len(f.aggregations) > 0
+}
+
+// Accumulate adds the fast path metrics to the window of the collection
+// interval
+func (f *FastPath) Accumulate(dps []DataPoint) {
+	if !f.Aggregating() {
+		return
+	}
+	for _, dp := range dps {
+		if !f.names[dp.Name] {
+			continue
+		}
+		key := seriesKey(dp)
+		w := f.window[key]
+		if w == nil {
+			w = &windowStats{min: dp.Value, max: dp.Value}
+			f.window[key] = w
+		}
+		w.min = min(w.min, dp.Value)
+		w.max = max(w.max, dp.Value)
+		w.sum += dp.Value
+		w.count++
+	}
+}
+
+// Aggregates closes the window with the metrics of a full collection, and
+// returns the aggregates of each fast path series reported by it. Series
+// that weren't reported by the full collection are dropped.
+func (f *FastPath) Aggregates(full []DataPoint) []DataPoint {
+	if !f.Aggregating() {
+		return nil
+	}
+	f.Accumulate(full)
+	var out []DataPoint
+	for _, dp := range full {
+		w := f.window[seriesKey(dp)]
+		if !f.names[dp.Name] || w == nil {
+			continue
+		}
+		for _, aggregation := range f.aggregations {
+			value := w.sum / float64(w.count)
+			switch aggregation {
+			case "min":
+				value = w.min
+			case "max":
+				value = w.max
+			}
+			out = append(out, DataPoint{Name: dp.Name + "_" + aggregation, Timestamp: dp.Timestamp, Value: value, Labels: dp.Labels})
+		}
+	}
+	clear(f.window)
+	return out
+}
@@ -0,0 +1,94 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"agent/internal/collection"
+	"agent/internal/config"
+)
+
+type countingCollector struct {
+	BaseCollector
+	name  string
+	dps   []DataPoint
+	err   error
+	calls int
+}
+
+func (c *countingCollector) Name() string                           { return c.name }
+func (c *countingCollector) Discover() ([]collection.Metric, error) { return nil, nil }
+func (c *countingCollector) CollectAll() ([]DataPoint, error)       { return c.dps, nil }
+func (c *countingCollector) Collect() ([]DataPoint, error)          { c.calls++; return c.dps, c.err }
+
+func TestNewFastPath(t *testing.T) {
+	assert.Nil(t, NewFastPath(config.FastPathConfig{}, time.Minute))
+	assert.Nil(t, NewFastPath(config.FastPathConfig{Metrics: []string{"heartbeat"}, IntervalSeconds: 60}, time.Minute))
+
+	f := NewFastPath(config.FastPathConfig{Metrics: []string{"heartbeat"}}, time.Minute)
+	require.NotNil(t, f)
+	assert.Equal(t, 15*time.Second, f.Interval(time.Minute))
+	assert.True(t, f.IsFull(0))
+	assert.False(t, f.IsFull(3))
+	assert.True(t, f.IsFull(4))
+
+	// Rounded to divide the collection interval
+	f = NewFastPath(config.FastPathConfig{Metrics: []string{"heartbeat"}, IntervalSeconds: 25}, time.Minute)
+	assert.Equal(t, 30*time.Second, f.Interval(time.Minute))
+
+	var disabled *FastPath
+	assert.Equal(t, time.Minute, disabled.Interval(time.Minute))
+	assert.True(t, disabled.IsFull(3))
+}
+
+func TestFastPathCollect(t *testing.T) {
+	status := &countingCollector{name: "status", dps: []DataPoint{{Name: "heartbeat", Value: 1}}}
+	nginx := &countingCollector{name: "nginx", dps: []DataPoint{
+		{Name: "nginx_requests_total", Value: 10},
+		{Name: "nginx_connections_active_total", Value: 2},
+	}}
+	disk := &countingCollector{name: "disk", dps: []DataPoint{{Name: "disk_used_ratio", Value: 0.5}}}
+	collectors := []MetricCollector{status, nginx, disk}
+
+	f := NewFastPath(config.FastPathConfig{Metrics: []string{"heartbeat", "nginx_requests_total"}}, time.Minute)
+	require.NotNil(t, f)
+
+	// Nothing known before the first full collection
+	assert.Empty(t, f.Collect(collectors))
+
+	performCollection(collectors, nil, nil, f)
+	assert.Equal(t, []DataPoint{
+		{Name: "heartbeat", Value: 1},
+		{Name: "nginx_requests_total", Value: 10},
+	}, f.Collect(collectors))
+	assert.Equal(t, 1, disk.calls, "collectors without fast path metrics only run on full collections")
+}
+
+func TestFastPathAggregates(t *testing.T) {
+	f := NewFastPath(config.FastPathConfig{Metrics: []string{"load1"}, Aggregations: []string{"min", "max", "avg", "p99"}}, time.Minute)
+	require.NotNil(t, f)
+	require.True(t, f.Aggregating())
+
+	labels := map[string]string{"host": "web-1"}
+	f.Accumulate([]DataPoint{{Name: "load1", Value: 1, Labels: labels}, {Name: "disk_used_ratio", Value: 0.5}})
+	f.Accumulate([]DataPoint{{Name: "load1", Value: 5, Labels: labels}})
+
+	aggregates := f.Aggregates([]DataPoint{{Name: "load1", Timestamp: 1000, Value: 3, Labels: labels}, {Name: "disk_used_ratio", Value: 0.5}})
+	assert.Equal(t, []DataPoint{
+		{Name: "load1_min", Timestamp: 1000, Value: 1, Labels: labels},
+		{Name: "load1_max", Timestamp: 1000, Value: 5, Labels: labels},
+		{Name: "load1_avg", Timestamp: 1000, Value: 3, Labels: labels},
+	}, aggregates)
+
+	// A new window starts
+	aggregates = f.Aggregates([]DataPoint{{Name: "load1", Timestamp: 2000, Value: 2, Labels: labels}})
+	assert.Equal(t, 2.0, aggregates[0].Value)
+	assert.Equal(t, 2.0, aggregates[1].Value)
+
+	var disabled *FastPath
+	assert.False(t, disabled.Aggregating())
+	assert.Nil(t, disabled.Aggregates([]DataPoint{{Name: "load1", Value: 1}}))
+}
@@ -0,0 +1,198 @@
+package fd
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"os"
+	"slices"
+	"time"
+
+	psutil "github.com/shirou/gopsutil/v4/common"
+	"github.com/shirou/gopsutil/v4/process"
+
+	"agent/internal/collection"
+	"agent/internal/metrics"
+)
+
+// topProcesses is the number of process names reported, the ones closest to
+// their limit
+const topProcesses = 5
+
+// unlimited is above any real open files limit, "unlimited" is reported as
+// the largest integer
+const unlimited = 1 << 40
+
+// usage is the open files of a process and its soft limit, zero when the
+// process isn't limited
+type usage struct {
+	Name  string
+	Open  float64
+	Limit float64
+}
+
+func (u usage) ratio() (float64, bool) {
+	if u.Limit <= 0 {
+		return 0, false
+	}
+	return u.Open / u.Limit, true
+}
+
+type FDPS interface {
+	// Agent returns the usage of the agent process
+	Agent() (usage, error)
+	// Processes returns the usage of the processes the agent can inspect
+	Processes() ([]usage, error)
+}
+
+type systemPS struct{}
+
+func (s *systemPS) Agent() (usage, error) {
+	// The PID of the agent is the one of its own /proc, not of the host root
+	ctx := context.WithValue(context.Background(), psutil.EnvKey, psutil.EnvMap{psutil.HostProcEnvKey: "/proc"})
+	p, err := process.NewProcessWithContext(ctx, int32(os.Getpid()))
+	if err != nil {
+		return usage{}, err
+	}
+	return processUsage(ctx, p)
+}
+
+func (s *systemPS) Processes() ([]usage, error) {
+	procs, err := process.Processes()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list processes: %w", err)
+	}
+	var usages []usage
+	for _, p := range procs {
+		// The processes of other users can't be inspected without
+		// CAP_DAC_READ_SEARCH
+		if u, err := processUsage(context.Background(), p); err == nil {
+			usages = append(usages, u)
+		}
+	}
+	return usages, nil
+}
+
+func processUsage(ctx context.Context, p *process.Process) (usage, error) {
+	name, err := p.NameWithContext(ctx)
+	if err != nil {
+		return usage{}, err
+	}
+	open, err := p.NumFDsWithContext(ctx)
+	if err != nil {
+		return usage{}, err
+	}
+	u := usage{Name: name, Open: float64(open)}
+	limits, err := p.RlimitWithContext(ctx)
+	if err != nil {
+		return usage{}, err
+	}
+	for _, l := range limits {
+		if l.Resource == process.RLIMIT_NOFILE && l.Soft < unlimited {
+			u.Limit = float64(l.Soft)
+		}
+	}
+	return u, nil
+}
+
+// FDCollector reports the open files of the agent and of the processes
+// closest to their open files limit, e.g. a web server leaking sockets, before
+// they fail to accept connections. The open files of the whole system are
+// reported by the kernel collector.
+type FDCollector struct {
+	metrics.BaseCollector
+
+	ps FDPS
+}
+
+func NewFDCollector() *FDCollector {
+	return &FDCollector{ps: &systemPS{}}
+}
+
+func (c *FDCollector) Name() string {
+	return "fd"
+}
+
+func (c *FDCollector) Collect() ([]metrics.DataPoint, error) {
+	all, err := c.CollectAll()
+	if err != nil {
+		return nil, err
+	}
+	var included []metrics.DataPoint
+	for _, dp := range all {
+		if c.IsIncluded(dp.Name, dp.Labels) {
+			included = append(included, dp)
+		}
+	}
+	return included, nil
+}
+
+func (c *FDCollector) CollectAll() ([]metrics.DataPoint, error) {
+	agent, err := c.ps.Agent()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the open files of the agent: %w", err)
+	}
+	// The agent is reported on its own when the processes can't be listed
+	procs, _ := c.ps.Processes()
+	return buildDataPoints(agent, procs, time.Now().UnixMilli()), nil
+}
+
+func (c *FDCollector) Discover() ([]collection.Metric, error) {
+	agent, err := c.ps.Agent()
+	if err != nil {
+		return []collection.Metric{}, nil
+	}
+	procs, _ := c.ps.Processes()
+	discovered := []collection.Metric{}
+	for _, dp := range buildDataPoints(agent, procs, 0) {
+		discovered = append(discovered, collection.Metric{Name: dp.Name, Type: "gauge", Labels: dp.Labels})
+	}
+	return discovered, nil
+}
+
+func buildDataPoints(agent usage, procs []usage, ts int64) []metrics.DataPoint {
+	results := usageDataPoints("fd_agent", agent, map[string]string{}, ts)
+	for _, u := range top(procs) {
+		results = append(results, usageDataPoints("fd_process", u, map[string]string{"name": u.Name}, ts)...)
+	}
+	return results
+}
+
+func usageDataPoints(prefix string, u usage, labels map[string]string, ts int64) []metrics.DataPoint {
+	results := []metrics.DataPoint{{Name: prefix + "_open", Timestamp: ts, Value: u.Open, Labels: labels}}
+	if ratio, ok := u.ratio(); ok {
+		results = append(results,
+			metrics.DataPoint{Name: prefix + "_limit", Timestamp: ts, Value: u.Limit, Labels: labels},
+			metrics.DataPoint{Name: prefix + "_used_ratio", Timestamp: ts, Value: ratio, Labels: labels},
+		)
+	}
+	return results
+}
+
+// top returns the limited processes closest to their limit, one per name so
+// that the workers of a server count once
+func top(procs []usage) []usage {
+	byName := make(map[string]usage)
+	for _, u := range procs {
+		ratio, ok := u.ratio()
+		if !ok {
+			continue
+		}
+		if current, seen := byName[u.Name]; seen {
+			if currentRatio, _ := current.ratio(); currentRatio >= ratio {
+				continue
+			}
+		}
+		byName[u.Name] = u
+	}
+	busiest := make([]usage, 0, len(byName))
+	for _, u := range byName {
+		busiest = append(busiest, u)
+	}
+	slices.SortFunc(busiest, func(a, b usage) int {
+		ra, _ := a.ratio()
+		rb, _ := b.ratio()
+		return cmp.Or(cmp.Compare(rb, ra), cmp.Compare(a.Name, b.Name))
+	})
+	return busiest[:min(topProcesses, len(busiest))]
+}
@@ -0,0 +1,78 @@
+package fd
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"agent/internal/metrics"
+)
+
+type mockPS struct {
+	mock.Mock
+}
+
+func (m *mockPS) Agent() (usage, error) {
+	args := m.Called()
+	return args.Get(0).(usage), args.Error(1)
+}
+
+func (m *mockPS) Processes() ([]usage, error) {
+	args := m.Called()
+	procs, _ := args.Get(0).([]usage)
+	return procs, args.Error(1)
+}
+
+func values(dps []metrics.DataPoint) map[string]float64 {
+	out := make(map[string]float64)
+	for _, dp := range dps {
+		out[dp.Name+"/"+dp.Labels["name"]] = dp.Value
+	}
+	return out
+}
+
+func TestFDCollector(t *testing.T) {
+	var mps mockPS
+	mps.On("Agent").Return(usage{Name: "simob", Open: 64, Limit: 1024}, nil)
+	mps.On("Processes").Return([]usage{
+		{Name: "nginx", Open: 100, Limit: 1024},
+		{Name: "nginx", Open: 900, Limit: 1024},
+		{Name: "postgres", Open: 50, Limit: 100},
+		{Name: "init", Open: 80, Limit: 0},
+		{Name: "a", Open: 1, Limit: 1000},
+		{Name: "b", Open: 1, Limit: 1000},
+		{Name: "c", Open: 1, Limit: 1000},
+		{Name: "d", Open: 1, Limit: 1000},
+	}, nil)
+
+	c := &FDCollector{ps: &mps}
+	dps, err := c.CollectAll()
+	require.NoError(t, err)
+
+	got := values(dps)
+	assert.Equal(t, 64.0, got["fd_agent_open/"])
+	assert.Equal(t, 1024.0, got["fd_agent_limit/"])
+	assert.Equal(t, 0.0625, got["fd_agent_used_ratio/"])
+
+	// The busiest nginx worker is reported
+	assert.InDelta(t, 900.0/1024, got["fd_process_used_ratio/nginx"], 1e-9)
+	assert.Equal(t, 0.5, got["fd_process_used_ratio/postgres"])
+	assert.Contains(t, got, "fd_process_open/c")
+	// Unlimited processes and the ones beyond the top are left out
+	assert.NotContains(t, got, "fd_process_open/init")
+	assert.NotContains(t, got, "fd_process_open/d")
+}
+
+func TestFDCollector_ProcessesUnavailable(t *testing.T) {
+	var mps mockPS
+	mps.On("Agent").Return(usage{Name: "simob", Open: 10}, nil)
+	mps.On("Processes").Return(nil, errors.New("permission denied"))
+
+	c := &FDCollector{ps: &mps}
+	dps, err := c.CollectAll()
+	require.NoError(t, err)
+	assert.Equal(t, map[string]float64{"fd_agent_open/": 10}, values(dps))
+}
@@ -0,0 +1,245 @@
+package firewall
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"agent/internal/collection"
+	"agent/internal/common"
+	"agent/internal/logger"
+	"agent/internal/metrics"
+)
+
+// commandTimeout bounds a ruleset dump, large rulesets take a while
+const commandTimeout = 10 * time.Second
+
+type FirewallPS interface {
+	// Conntrack returns the connection tracking usage, an error when the
+	// nf_conntrack module isn't loaded
+	Conntrack() (*conntrackStats, error)
+	// Drops returns the traffic dropped by each firewall chain
+	Drops() ([]chainDrops, error)
+}
+
+type systemPS struct {
+	procRoot string
+}
+
+func (s *systemPS) Conntrack() (*conntrackStats, error) {
+	stats := &conntrackStats{}
+	var err error
+	if stats.Entries, err = readValue(filepath.Join(s.procRoot, "sys/net/netfilter/nf_conntrack_count")); err != nil {
+		return nil, err
+	}
+	if stats.MaxEntries, err = readValue(filepath.Join(s.procRoot, "sys/net/netfilter/nf_conntrack_max")); err != nil {
+		return nil, err
+	}
+	// The per CPU counters are optional
+	if f, err := os.Open(filepath.Join(s.procRoot, "net/stat/nf_conntrack")); err == nil {
+		defer f.Close()
+		if err := parseConntrackStat(f, stats); err != nil {
+			logger.Log.Debug("Failed to read conntrack counters", "error", err)
+			stats.HasCounters = false
+		}
+	}
+	return stats, nil
+}
+
+// Drops reads the counters of iptables (legacy or nft based) and ip6tables,
+// or of nftables when iptables isn't installed.
+func (s *systemPS) Drops() ([]chainDrops, error) {
+	if _, err := exec.LookPath("iptables-save"); err == nil {
+		var drops []chainDrops
+		var errs []error
+		for _, cmd := range []struct{ name, family string }{
+			{"iptables-save", "ip"},
+			{"ip6tables-save", "ip6"},
+		} {
+			out, err := run(cmd.name, "-c")
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			parsed, err := parseIptablesSave(bytes.NewReader(out), cmd.family)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			drops = append(drops, parsed...)
+		}
+		if len(drops) == 0 && len(errs) > 0 {
+			return nil, errors.Join(errs...)
+		}
+		return drops, nil
+	}
+	if _, err := exec.LookPath("nft"); err == nil {
+		out, err := run("nft", "-j", "list", "ruleset")
+		if err != nil {
+			return nil, err
+		}
+		return parseNftRuleset(bytes.NewReader(out))
+	}
+	return nil, fmt.Errorf("neither iptables-save nor nft found")
+}
+
+func run(name string, args ...string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), commandTimeout)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, name, args...).Output()
+	if err != nil {
+		return nil, fmt.Errorf("%s failed: %w", name, err)
+	}
+	return out, nil
+}
+
+func readValue(path string) (float64, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseFloat(strings.TrimSpace(string(data)), 64)
+}
+
+// FirewallCollector reports the usage of the connection tracking table, whose
+// exhaustion silently drops new connections, and the traffic dropped by the
+// host firewall per chain.
+type FirewallCollector struct {
+	metrics.BaseCollector
+	ps FirewallPS
+}
+
+func NewFirewallCollector() *FirewallCollector {
+	return &FirewallCollector{
+		ps: &systemPS{procRoot: common.HostPath("/proc")},
+	}
+}
+
+func (c *FirewallCollector) Name() string {
+	return "firewall"
+}
+
+// conntrackMetrics list the metrics of the connection tracking table
+var conntrackMetrics = []struct {
+	name     string
+	counter  bool
+	getValue func(*conntrackStats) float64
+}{
+	{"firewall_conntrack_entries", false, func(s *conntrackStats) float64 { return s.Entries }},
+	{"firewall_conntrack_max_entries", false, func(s *conntrackStats) float64 { return s.MaxEntries }},
+	{"firewall_conntrack_used_ratio", false, func(s *conntrackStats) float64 {
+		if s.MaxEntries <= 0 {
+			return 0
+		}
+		return s.Entries / s.MaxEntries
+	}},
+	{"firewall_conntrack_dropped_total", true, func(s *conntrackStats) float64 { return s.Dropped }},
+	{"firewall_conntrack_early_dropped_total", true, func(s *conntrackStats) float64 { return s.EarlyDropped }},
+	{"firewall_conntrack_insert_failed_total", true, func(s *conntrackStats) float64 { return s.InsertFailed }},
+}
+
+// dropMetrics list the per chain drop counters
+var dropMetrics = []struct {
+	name     string
+	getValue func(chainDrops) float64
+}{
+	{"firewall_dropped_packets_total", func(d chainDrops) float64 { return d.Packets }},
+	{"firewall_dropped_bytes_total", func(d chainDrops) float64 { return d.Bytes }},
+}
+
+func (c *FirewallCollector) Collect() ([]metrics.DataPoint, error) {
+	all, err := c.CollectAll()
+	if err != nil {
+		return nil, err
+	}
+	var included []metrics.DataPoint
+	for _, dp := range all {
+		if c.IsIncluded(dp.Name, dp.Labels) {
+			included = append(included, dp)
+		}
+	}
+	return included, nil
+}
+
+func (c *FirewallCollector) CollectAll() ([]metrics.DataPoint, error) {
+	timestamp := time.Now().UnixMilli()
+	var results []metrics.DataPoint
+
+	conntrack, conntrackErr := c.ps.Conntrack()
+	if conntrackErr == nil {
+		for _, m := range conntrackMetrics {
+			if m.counter && !conntrack.HasCounters {
+				continue
+			}
+			results = append(results, metrics.DataPoint{
+				Name:      m.name,
+				Timestamp: timestamp,
+				Value:     m.getValue(conntrack),
+				Labels:    map[string]string{},
+			})
+		}
+	}
+
+	drops, dropsErr := c.ps.Drops()
+	if dropsErr != nil {
+		logger.Log.Debug("Failed to read firewall counters", "error", dropsErr)
+	}
+	for _, d := range drops {
+		for _, m := range dropMetrics {
+			results = append(results, metrics.DataPoint{
+				Name:      m.name,
+				Timestamp: timestamp,
+				Value:     m.getValue(d),
+				Labels:    dropLabels(d),
+			})
+		}
+	}
+
+	if conntrackErr != nil && dropsErr != nil {
+		return nil, fmt.Errorf("failed to read firewall stats: %w", errors.Join(conntrackErr, dropsErr))
+	}
+	return results, nil
+}
+
+func (c *FirewallCollector) Discover() ([]collection.Metric, error) {
+	discovered := []collection.Metric{}
+	if conntrack, err := c.ps.Conntrack(); err == nil {
+		for _, m := range conntrackMetrics {
+			if m.counter && !conntrack.HasCounters {
+				continue
+			}
+			metricType := "gauge"
+			if m.counter {
+				metricType = "counter"
+			}
+			discovered = append(discovered, collection.Metric{
+				Name:   m.name,
+				Type:   metricType,
+				Labels: map[string]string{},
+			})
+		}
+	}
+	if drops, err := c.ps.Drops(); err == nil {
+		for _, d := range drops {
+			for _, m := range dropMetrics {
+				discovered = append(discovered, collection.Metric{
+					Name:   m.name,
+					Type:   "counter",
+					Labels: dropLabels(d),
+				})
+			}
+		}
+	}
+	return discovered, nil
+}
+
+func dropLabels(d chainDrops) map[string]string {
+	return map[string]string{"family": d.Family, "table": d.Table, "chain": d.Chain}
+}
@@ -0,0 +1,150 @@
+package firewall
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"agent/internal/logger"
+	"agent/internal/metrics"
+)
+
+func init() {
+	logger.Log = slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+type mockPS struct {
+	mock.Mock
+}
+
+func (m *mockPS) Conntrack() (*conntrackStats, error) {
+	args := m.Called()
+	stats, _ := args.Get(0).(*conntrackStats)
+	return stats, args.Error(1)
+}
+
+func (m *mockPS) Drops() ([]chainDrops, error) {
+	args := m.Called()
+	drops, _ := args.Get(0).([]chainDrops)
+	return drops, args.Error(1)
+}
+
+func findPoint(t *testing.T, dps []metrics.DataPoint, name string) metrics.DataPoint {
+	t.Helper()
+	for _, dp := range dps {
+		if dp.Name == name {
+			return dp
+		}
+	}
+	t.Fatalf("data point %s not found", name)
+	return metrics.DataPoint{}
+}
+
+const conntrackStatFile = `entries  clashres found new invalid ignore delete chainlength insert insert_failed drop early_drop icmp_error  expect_new expect_create expect_delete search_restart
+000000ed  00000000 00000000 00000000 00000005 0000001a 00000000 00000000 00000000 00000001 00000002 00000003 00000000  00000000 00000000 00000000 00000000
+000000ed  00000000 00000000 00000000 00000000 00000010 00000000 00000000 00000000 00000000 00000010 00000000 00000000  00000000 00000000 00000000 00000000
+`
+
+const iptablesSave = `# Generated by iptables-save v1.8.7 on Mon Jan  1 00:00:00 2024
+*nat
+:PREROUTING ACCEPT [10:600]
+[3:180] -A PREROUTING -p tcp --dport 80 -j REDIRECT --to-ports 8080
+COMMIT
+*filter
+:INPUT DROP [120:7200]
+:FORWARD ACCEPT [0:0]
+:OUTPUT ACCEPT [500:30000]
+:f2b-sshd - [0:0]
+[1000:60000] -A INPUT -m state --state ESTABLISHED,RELATED -j ACCEPT
+[5:300] -A INPUT -s 192.0.2.1/32 -j DROP
+[2:120] -A INPUT -p tcp -j REJECT --reject-with tcp-reset
+[7:420] -A f2b-sshd -s 198.51.100.7/32 -j REJECT --reject-with icmp-port-unreachable
+COMMIT
+`
+
+const nftRulesetJSON = `{"nftables": [
+  {"metainfo": {"version": "1.0.2", "json_schema_version": 1}},
+  {"table": {"family": "inet", "name": "filter", "handle": 1}},
+  {"chain": {"family": "inet", "table": "filter", "name": "input", "handle": 1, "type": "filter", "hook": "input", "prio": 0, "policy": "accept"}},
+  {"rule": {"family": "inet", "table": "filter", "chain": "input", "handle": 3, "expr": [
+    {"match": {"op": "==", "left": {"payload": {"protocol": "ip", "field": "saddr"}}, "right": "192.0.2.1"}},
+    {"counter": {"packets": 4, "bytes": 240}},
+    {"drop": null}
+  ]}},
+  {"rule": {"family": "inet", "table": "filter", "chain": "input", "handle": 4, "expr": [
+    {"counter": {"packets": 1, "bytes": 60}},
+    {"reject": {"type": "tcp reset"}}
+  ]}},
+  {"rule": {"family": "inet", "table": "filter", "chain": "input", "handle": 5, "expr": [
+    {"drop": null}
+  ]}},
+  {"rule": {"family": "inet", "table": "filter", "chain": "input", "handle": 6, "expr": [
+    {"counter": {"packets": 100, "bytes": 6000}},
+    {"accept": null}
+  ]}}
+]}`
+
+func TestParseConntrackStat(t *testing.T) {
+	stats := &conntrackStats{}
+	require.NoError(t, parseConntrackStat(strings.NewReader(conntrackStatFile), stats))
+	assert.Equal(t, &conntrackStats{Dropped: 18, EarlyDropped: 3, InsertFailed: 1, HasCounters: true}, stats)
+}
+
+func TestParseIptablesSave(t *testing.T) {
+	drops, err := parseIptablesSave(strings.NewReader(iptablesSave), "ip")
+	require.NoError(t, err)
+	assert.Equal(t, []chainDrops{
+		{Family: "ip", Table: "filter", Chain: "INPUT", Packets: 127, Bytes: 7620},
+		{Family: "ip", Table: "filter", Chain: "f2b-sshd", Packets: 7, Bytes: 420},
+	}, drops)
+
+	_, err = parseIptablesSave(strings.NewReader("*filter\n:INPUT DROP [x:0]\n"), "ip")
+	assert.Error(t, err)
+}
+
+func TestParseNftRuleset(t *testing.T) {
+	drops, err := parseNftRuleset(strings.NewReader(nftRulesetJSON))
+	require.NoError(t, err)
+	assert.Equal(t, []chainDrops{
+		{Family: "inet", Table: "filter", Chain: "input", Packets: 5, Bytes: 300},
+	}, drops)
+}
+
+func TestFirewallCollector(t *testing.T) {
+	var mps mockPS
+	mps.On("Conntrack").Return(&conntrackStats{Entries: 65000, MaxEntries: 65536, Dropped: 42, HasCounters: true}, nil)
+	mps.On("Drops").Return([]chainDrops{{Family: "ip", Table: "filter", Chain: "INPUT", Packets: 10, Bytes: 600}}, nil)
+
+	c := &FirewallCollector{ps: &mps}
+	dps, err := c.CollectAll()
+	require.NoError(t, err)
+	assert.InDelta(t, 65000.0/65536, findPoint(t, dps, "firewall_conntrack_used_ratio").Value, 1e-9)
+	assert.Equal(t, 42.0, findPoint(t, dps, "firewall_conntrack_dropped_total").Value)
+	dropped := findPoint(t, dps, "firewall_dropped_packets_total")
+	assert.Equal(t, 10.0, dropped.Value)
+	assert.Equal(t, map[string]string{"family": "ip", "table": "filter", "chain": "INPUT"}, dropped.Labels)
+
+	discovered, err := c.Discover()
+	require.NoError(t, err)
+	assert.Len(t, discovered, len(conntrackMetrics)+len(dropMetrics))
+}
+
+func TestFirewallCollectorUnavailable(t *testing.T) {
+	var mps mockPS
+	mps.On("Conntrack").Return(nil, errors.New("no such file"))
+	mps.On("Drops").Return(nil, errors.New("neither iptables-save nor nft found"))
+
+	c := &FirewallCollector{ps: &mps}
+	_, err := c.CollectAll()
+	assert.Error(t, err)
+
+	discovered, err := c.Discover()
+	require.NoError(t, err)
+	assert.Empty(t, discovered)
+}
@@ -0,0 +1,230 @@
+package firewall
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// conntrackStats is the usage of the connection tracking table. The counters
+// are summed over all CPUs.
+type conntrackStats struct {
+	Entries    float64
+	MaxEntries float64
+	// Dropped counts the packets dropped because a new connection could
+	// not be tracked, usually because the table is full
+	Dropped float64
+	// EarlyDropped counts the connections evicted to make room for new ones
+	EarlyDropped float64
+	InsertFailed float64
+	HasCounters  bool
+}
+
+// chainDrops is the traffic dropped or rejected by a firewall chain, through
+// its rules or its policy
+type chainDrops struct {
+	Family  string
+	Table   string
+	Chain   string
+	Packets float64
+	Bytes   float64
+}
+
+// parseConntrackStat sums the per CPU counters of /proc/net/stat/nf_conntrack.
+// The first line names the columns, values are hexadecimal.
+func parseConntrackStat(r io.Reader, stats *conntrackStats) error {
+	scanner := bufio.NewScanner(r)
+	if !scanner.Scan() {
+		return fmt.Errorf("empty conntrack stat file")
+	}
+	columns := strings.Fields(scanner.Text())
+	targets := map[string]*float64{
+		"drop":          &stats.Dropped,
+		"early_drop":    &stats.EarlyDropped,
+		"insert_failed": &stats.InsertFailed,
+	}
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		for i, column := range columns {
+			target, ok := targets[column]
+			if !ok || i >= len(fields) {
+				continue
+			}
+			v, err := strconv.ParseUint(fields[i], 16, 64)
+			if err != nil {
+				return fmt.Errorf("invalid conntrack stat value %q: %w", fields[i], err)
+			}
+			*target += float64(v)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	stats.HasCounters = true
+	return nil
+}
+
+// isDropTarget reports whether a rule target or chain policy discards traffic
+func isDropTarget(target string) bool {
+	return target == "DROP" || target == "REJECT"
+}
+
+// parseIptablesSave parses the output of "iptables-save -c" and returns the
+// chains that drop traffic, sorted by table and chain.
+//
+//	*filter
+//	:INPUT DROP [120:7200]
+//	[5:300] -A INPUT -s 192.0.2.1/32 -j DROP
+//	COMMIT
+func parseIptablesSave(r io.Reader, family string) ([]chainDrops, error) {
+	drops := make(map[[2]string]*chainDrops)
+	add := func(table, chain, counters string) error {
+		packets, bytes, err := parseCounters(counters)
+		if err != nil {
+			return err
+		}
+		key := [2]string{table, chain}
+		d, ok := drops[key]
+		if !ok {
+			d = &chainDrops{Family: family, Table: table, Chain: chain}
+			drops[key] = d
+		}
+		d.Packets += packets
+		d.Bytes += bytes
+		return nil
+	}
+
+	var table string
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case strings.HasPrefix(line, "*"):
+			table = line[1:]
+		case strings.HasPrefix(line, ":"):
+			// Chain declaration, ":INPUT DROP [120:7200]"
+			fields := strings.Fields(line[1:])
+			if len(fields) == 3 && isDropTarget(fields[1]) {
+				if err := add(table, fields[0], fields[2]); err != nil {
+					return nil, err
+				}
+			}
+		case strings.HasPrefix(line, "["):
+			// Rule with counters, "[5:300] -A INPUT ... -j DROP"
+			fields := strings.Fields(line)
+			if len(fields) < 3 || fields[1] != "-A" {
+				continue
+			}
+			for i := 2; i+1 < len(fields); i++ {
+				if fields[i] == "-j" && isDropTarget(fields[i+1]) {
+					if err := add(table, fields[2], fields[0]); err != nil {
+						return nil, err
+					}
+					break
+				}
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return sortedDrops(drops), nil
+}
+
+// parseCounters parses "[packets:bytes]"
+func parseCounters(s string) (float64, float64, error) {
+	inner := strings.TrimSuffix(strings.TrimPrefix(s, "["), "]")
+	packets, bytes, ok := strings.Cut(inner, ":")
+	if !ok {
+		return 0, 0, fmt.Errorf("invalid counters %q", s)
+	}
+	p, err := strconv.ParseFloat(packets, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid counters %q: %w", s, err)
+	}
+	b, err := strconv.ParseFloat(bytes, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid counters %q: %w", s, err)
+	}
+	return p, b, nil
+}
+
+// nftRuleset is the subset of "nft -j list ruleset" needed to count drops
+type nftRuleset struct {
+	Nftables []struct {
+		Rule *struct {
+			Family string                       `json:"family"`
+			Table  string                       `json:"table"`
+			Chain  string                       `json:"chain"`
+			Expr   []map[string]json.RawMessage `json:"expr"`
+		} `json:"rule"`
+	} `json:"nftables"`
+}
+
+// parseNftRuleset parses the output of "nft -j list ruleset" and returns the
+// chains having rules that drop or reject traffic. Only the rules with a
+// counter statement are counted, nftables doesn't count policies.
+func parseNftRuleset(r io.Reader) ([]chainDrops, error) {
+	var ruleset nftRuleset
+	if err := json.NewDecoder(r).Decode(&ruleset); err != nil {
+		return nil, fmt.Errorf("invalid nft ruleset: %w", err)
+	}
+
+	drops := make(map[[2]string]*chainDrops)
+	for _, item := range ruleset.Nftables {
+		rule := item.Rule
+		if rule == nil {
+			continue
+		}
+		var counter struct {
+			Packets float64 `json:"packets"`
+			Bytes   float64 `json:"bytes"`
+		}
+		hasCounter, discards := false, false
+		for _, expr := range rule.Expr {
+			if raw, ok := expr["counter"]; ok && json.Unmarshal(raw, &counter) == nil {
+				hasCounter = true
+			}
+			if _, ok := expr["drop"]; ok {
+				discards = true
+			}
+			if _, ok := expr["reject"]; ok {
+				discards = true
+			}
+		}
+		if !hasCounter || !discards {
+			continue
+		}
+		key := [2]string{rule.Family + " " + rule.Table, rule.Chain}
+		d, ok := drops[key]
+		if !ok {
+			d = &chainDrops{Family: rule.Family, Table: rule.Table, Chain: rule.Chain}
+			drops[key] = d
+		}
+		d.Packets += counter.Packets
+		d.Bytes += counter.Bytes
+	}
+	return sortedDrops(drops), nil
+}
+
+func sortedDrops(drops map[[2]string]*chainDrops) []chainDrops {
+	out := make([]chainDrops, 0, len(drops))
+	for _, d := range drops {
+		out = append(out, *d)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Family != out[j].Family {
+			return out[i].Family < out[j].Family
+		}
+		if out[i].Table != out[j].Table {
+			return out[i].Table < out[j].Table
+		}
+		return out[i].Chain < out[j].Chain
+	})
+	return out
+}
@@ -0,0 +1,211 @@
+package ipmi
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"agent/internal/collection"
+	"agent/internal/logger"
+	"agent/internal/metrics"
+)
+
+// devicePaths are the character devices exposed by the Linux IPMI drivers,
+// ipmitool needs read/write access to one of them to talk to the local BMC.
+var devicePaths = []string{"/dev/ipmi0", "/dev/ipmi/0", "/dev/ipmidev/0"}
+
+// commandTimeout bounds an ipmitool run, slow BMCs can take several seconds
+// to dump their repository.
+const commandTimeout = 15 * time.Second
+
+type IPMIPS interface {
+	// Available reports whether the local BMC can be queried.
+	Available() error
+	// SensorList returns the output of "ipmitool sdr elist full".
+	SensorList() ([]byte, error)
+}
+
+type systemPS struct{}
+
+func (s *systemPS) Available() error {
+	if _, err := exec.LookPath("ipmitool"); err != nil {
+		return fmt.Errorf("ipmitool not found: %w", err)
+	}
+	var errs []error
+	for _, path := range devicePaths {
+		f, err := os.OpenFile(path, os.O_RDWR, 0)
+		if err == nil {
+			f.Close()
+			return nil
+		}
+		errs = append(errs, err)
+	}
+	return fmt.Errorf("no accessible ipmi device: %w", errors.Join(errs...))
+}
+
+func (s *systemPS) SensorList() ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), commandTimeout)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, "ipmitool", "sdr", "elist", "full").Output()
+	if err != nil {
+		return nil, fmt.Errorf("ipmitool failed: %w", err)
+	}
+	return out, nil
+}
+
+// reading is a single line of the sensor data repository, e.g.
+// "FAN1 | 41h | ok | 29.1 | 3400 RPM".
+type reading struct {
+	Sensor string
+	Status string
+	Entity string
+	Value  float64
+	Unit   string
+}
+
+// powerSupplyEntity is the IPMI entity ID of power supplies
+const powerSupplyEntity = "10"
+
+// ipmiMetrics maps sensor units to metrics
+var ipmiMetrics = []struct {
+	name string
+	unit string
+}{
+	{"ipmi_fan_speed_rpm", "RPM"},
+	{"ipmi_temperature_celsius", "degrees C"},
+	{"ipmi_voltage_volts", "Volts"},
+	{"ipmi_current_amperes", "Amps"},
+	{"ipmi_power_watts", "Watts"},
+}
+
+// IPMICollector reads the hardware sensors (fans, temperatures, power
+// supplies...) of the local BMC through ipmitool.
+type IPMICollector struct {
+	metrics.BaseCollector
+
+	ps IPMIPS
+}
+
+func NewIPMICollector() *IPMICollector {
+	return &IPMICollector{ps: &systemPS{}}
+}
+
+func (c *IPMICollector) Name() string {
+	return "ipmi"
+}
+
+func (c *IPMICollector) Collect() ([]metrics.DataPoint, error) {
+	all, err := c.CollectAll()
+	if err != nil {
+		return nil, err
+	}
+	var included []metrics.DataPoint
+	for _, dp := range all {
+		if c.IsIncluded(dp.Name, dp.Labels) {
+			included = append(included, dp)
+		}
+	}
+	return included, nil
+}
+
+func (c *IPMICollector) CollectAll() ([]metrics.DataPoint, error) {
+	readings, err := c.getReadings()
+	if err != nil {
+		logger.Log.Debug("Failed to collect metrics", "collector", c.Name(), "error", err)
+		return nil, nil
+	}
+	return buildDataPoints(readings, time.Now().UnixMilli()), nil
+}
+
+func (c *IPMICollector) Discover() ([]collection.Metric, error) {
+	readings, err := c.getReadings()
+	if err != nil {
+		// Virtual machines and hosts without a BMC
+		return []collection.Metric{}, nil
+	}
+	var discovered []collection.Metric
+	for _, dp := range buildDataPoints(readings, 0) {
+		discovered = append(discovered, collection.Metric{
+			Name:   dp.Name,
+			Type:   "gauge",
+			Labels: dp.Labels,
+		})
+	}
+	return discovered, nil
+}
+
+func (c *IPMICollector) getReadings() ([]reading, error) {
+	if err := c.ps.Available(); err != nil {
+		return nil, err
+	}
+	out, err := c.ps.SensorList()
+	if err != nil {
+		return nil, err
+	}
+	return parseSensorList(out), nil
+}
+
+func buildDataPoints(readings []reading, ts int64) []metrics.DataPoint {
+	var results []metrics.DataPoint
+	for _, r := range readings {
+		// "ns" means no reading, the sensor is disabled or the device absent
+		if r.Status == "ns" {
+			continue
+		}
+		labels := map[string]string{"sensor": r.Sensor}
+		for _, m := range ipmiMetrics {
+			if r.Unit == m.unit {
+				results = append(results, metrics.DataPoint{Name: m.name, Timestamp: ts, Value: r.Value, Labels: labels})
+			}
+		}
+
+		ok := 0.0
+		if r.Status == "ok" {
+			ok = 1
+		}
+		results = append(results, metrics.DataPoint{Name: "ipmi_sensor_ok", Timestamp: ts, Value: ok, Labels: labels})
+		if r.Entity == powerSupplyEntity {
+			results = append(results, metrics.DataPoint{Name: "ipmi_psu_ok", Timestamp: ts, Value: ok, Labels: labels})
+		}
+	}
+	sort.SliceStable(results, func(i, j int) bool { return results[i].Name < results[j].Name })
+	return results
+}
+
+// parseSensorList parses "ipmitool sdr elist" output. Each line holds the
+// sensor name, its record ID, status, entity ID.instance and reading:
+//
+//	CPU Temp         | 01h | ok  |  3.1 | 45 degrees C
+//	PS1 Status       | C8h | ok  | 10.1 | Presence detected
+func parseSensorList(out []byte) []reading {
+	var readings []reading
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), "|")
+		if len(fields) != 5 {
+			continue
+		}
+		r := reading{
+			Sensor: strings.TrimSpace(fields[0]),
+			Status: strings.TrimSpace(fields[2]),
+		}
+		r.Entity, _, _ = strings.Cut(strings.TrimSpace(fields[3]), ".")
+
+		// Analog readings are "<value> <unit>", discrete ones are free text
+		value, unit, _ := strings.Cut(strings.TrimSpace(fields[4]), " ")
+		if v, err := strconv.ParseFloat(value, 64); err == nil {
+			r.Value = v
+			r.Unit = unit
+		}
+		readings = append(readings, r)
+	}
+	return readings
+}
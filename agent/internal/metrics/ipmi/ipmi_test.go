@@ -0,0 +1,100 @@
+package ipmi
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"agent/internal/logger"
+	"agent/internal/metrics"
+)
+
+func init() {
+	logger.Log = slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+type mockPS struct {
+	mock.Mock
+}
+
+func (m *mockPS) Available() error {
+	return m.Called().Error(0)
+}
+
+func (m *mockPS) SensorList() ([]byte, error) {
+	args := m.Called()
+	out, _ := args.Get(0).([]byte)
+	return out, args.Error(1)
+}
+
+const sensorList = `Inlet Temp       | 04h | ok  |  7.1 | 23 degrees C
+CPU1 Temp        | 0Eh | cr  |  3.1 | 97 degrees C
+Fan1A            | 30h | ok  |  7.1 | 5040 RPM
+Fan2A            | 31h | ns  |  7.1 | No Reading
+PS1 Status       | 62h | ok  | 10.1 | Presence detected
+PS2 Status       | 63h | cr  | 10.2 | Presence detected, Failure detected
+Pwr Consumption  | 77h | ok  |  7.1 | 182 Watts
+Voltage 1        | 6Ch | ok  | 10.1 | 230 Volts
+`
+
+func findPoint(t *testing.T, dps []metrics.DataPoint, name, sensor string) metrics.DataPoint {
+	t.Helper()
+	for _, dp := range dps {
+		if dp.Name == name && dp.Labels["sensor"] == sensor {
+			return dp
+		}
+	}
+	t.Fatalf("data point %s{sensor=%s} not found", name, sensor)
+	return metrics.DataPoint{}
+}
+
+func TestIPMICollector(t *testing.T) {
+	var mps mockPS
+	defer mps.AssertExpectations(t)
+	mps.On("Available").Return(nil)
+	mps.On("SensorList").Return([]byte(sensorList), nil)
+
+	c := &IPMICollector{ps: &mps}
+	dps, err := c.CollectAll()
+	require.NoError(t, err)
+
+	assert.Equal(t, 23.0, findPoint(t, dps, "ipmi_temperature_celsius", "Inlet Temp").Value)
+	assert.Equal(t, 5040.0, findPoint(t, dps, "ipmi_fan_speed_rpm", "Fan1A").Value)
+	assert.Equal(t, 182.0, findPoint(t, dps, "ipmi_power_watts", "Pwr Consumption").Value)
+	assert.Equal(t, 230.0, findPoint(t, dps, "ipmi_voltage_volts", "Voltage 1").Value)
+	assert.Equal(t, 0.0, findPoint(t, dps, "ipmi_sensor_ok", "CPU1 Temp").Value)
+	assert.Equal(t, 1.0, findPoint(t, dps, "ipmi_psu_ok", "PS1 Status").Value)
+	assert.Equal(t, 0.0, findPoint(t, dps, "ipmi_psu_ok", "PS2 Status").Value)
+
+	for _, dp := range dps {
+		assert.NotEqual(t, "Fan2A", dp.Labels["sensor"], "sensors without reading are skipped")
+	}
+}
+
+func TestIPMICollectorUnavailable(t *testing.T) {
+	var mps mockPS
+	defer mps.AssertExpectations(t)
+	mps.On("Available").Return(errors.New("no accessible ipmi device"))
+
+	c := &IPMICollector{ps: &mps}
+	dps, err := c.CollectAll()
+	assert.NoError(t, err)
+	assert.Empty(t, dps)
+
+	discovered, err := c.Discover()
+	assert.NoError(t, err)
+	assert.Empty(t, discovered)
+	mps.AssertNotCalled(t, "SensorList")
+}
+
+func TestParseSensorList(t *testing.T) {
+	readings := parseSensorList([]byte(sensorList + "garbage line\n"))
+	require.Len(t, readings, 8)
+	assert.Equal(t, reading{Sensor: "PS2 Status", Status: "cr", Entity: "10"}, readings[5])
+	assert.Equal(t, reading{Sensor: "Fan1A", Status: "ok", Entity: "7", Value: 5040, Unit: "RPM"}, readings[2])
+}
@@ -0,0 +1,298 @@
+package jvm
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"agent/internal/collection"
+	"agent/internal/config"
+	"agent/internal/logger"
+	"agent/internal/metrics"
+)
+
+// jolokiaRequest is a single read operation of a Jolokia bulk request.
+type jolokiaRequest struct {
+	Type      string   `json:"type"`
+	MBean     string   `json:"mbean"`
+	Attribute []string `json:"attribute"`
+}
+
+// jolokiaResponse is the response to a single read operation.
+type jolokiaResponse struct {
+	Status int             `json:"status"`
+	Error  string          `json:"error,omitempty"`
+	Value  json.RawMessage `json:"value"`
+}
+
+var readRequests = []jolokiaRequest{
+	{Type: "read", MBean: "java.lang:type=Memory", Attribute: []string{"HeapMemoryUsage", "NonHeapMemoryUsage"}},
+	{Type: "read", MBean: "java.lang:type=GarbageCollector,name=*", Attribute: []string{"CollectionCount", "CollectionTime"}},
+	{Type: "read", MBean: "java.lang:type=Threading", Attribute: []string{"ThreadCount", "DaemonThreadCount", "PeakThreadCount"}},
+}
+
+type JolokiaPS interface {
+	Read(target config.JolokiaTarget, requests []jolokiaRequest) ([]jolokiaResponse, error)
+}
+
+type systemPS struct {
+	client *http.Client
+}
+
+func (s *systemPS) Read(target config.JolokiaTarget, requests []jolokiaRequest) ([]jolokiaResponse, error) {
+	body, err := json.Marshal(requests)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest("POST", strings.TrimRight(target.URL, "/")+"/", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if target.Username != "" {
+		req.SetBasicAuth(target.Username, target.Password)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query jolokia: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("jolokia returned status %d", resp.StatusCode)
+	}
+
+	var responses []jolokiaResponse
+	if err := json.NewDecoder(resp.Body).Decode(&responses); err != nil {
+		return nil, fmt.Errorf("failed to decode jolokia response: %w", err)
+	}
+	return responses, nil
+}
+
+type memoryUsage struct {
+	Used      float64 `json:"used"`
+	Committed float64 `json:"committed"`
+	Max       float64 `json:"max"`
+}
+
+type gcStats struct {
+	Count float64 `json:"CollectionCount"`
+	Time  float64 `json:"CollectionTime"` // Cumulated pause time in milliseconds
+}
+
+// jvmStats is an internal type used to store the beans read from a target
+type jvmStats struct {
+	Ts      int64
+	Heap    memoryUsage `json:"HeapMemoryUsage"`
+	NonHeap memoryUsage `json:"NonHeapMemoryUsage"`
+	Threads struct {
+		Count  float64 `json:"ThreadCount"`
+		Daemon float64 `json:"DaemonThreadCount"`
+		Peak   float64 `json:"PeakThreadCount"`
+	}
+	// GC maps garbage collector names (e.g. "G1 Young Generation") to their stats
+	GC map[string]gcStats
+}
+
+// jvmMetrics list the available metrics inside the jvm package
+var jvmMetrics = []struct {
+	name   string
+	getVal func(s *jvmStats) float64
+}{
+	{"jvm_heap_used_bytes", func(s *jvmStats) float64 { return s.Heap.Used }},
+	{"jvm_heap_committed_bytes", func(s *jvmStats) float64 { return s.Heap.Committed }},
+	{"jvm_heap_max_bytes", func(s *jvmStats) float64 { return s.Heap.Max }},
+	{"jvm_heap_used_ratio", func(s *jvmStats) float64 {
+		if s.Heap.Max <= 0 {
+			return 0
+		}
+		return s.Heap.Used / s.Heap.Max
+	}},
+	{"jvm_nonheap_used_bytes", func(s *jvmStats) float64 { return s.NonHeap.Used }},
+	{"jvm_nonheap_committed_bytes", func(s *jvmStats) float64 { return s.NonHeap.Committed }},
+	{"jvm_threads_total", func(s *jvmStats) float64 { return s.Threads.Count }},
+	{"jvm_threads_daemon_total", func(s *jvmStats) float64 { return s.Threads.Daemon }},
+	{"jvm_threads_peak_total", func(s *jvmStats) float64 { return s.Threads.Peak }},
+}
+
+// jvmGCMetrics list the metrics reported for each garbage collector
+var jvmGCMetrics = []struct {
+	name   string
+	getVal func(current, previous *gcStats, deltaMs float64) float64
+}{
+	{"jvm_gc_collections_total", func(c, p *gcStats, _ float64) float64 { return c.Count }},
+	{"jvm_gc_pause_ms_total", func(c, p *gcStats, _ float64) float64 { return c.Time }},
+	{"jvm_gc_collections_rate", func(c, p *gcStats, deltaMs float64) float64 {
+		if p == nil || deltaMs <= 0 || c.Count < p.Count {
+			return 0
+		}
+		return (c.Count - p.Count) / deltaMs * 1000
+	}},
+	{"jvm_gc_pause_ratio", func(c, p *gcStats, deltaMs float64) float64 {
+		if p == nil || deltaMs <= 0 || c.Time < p.Time {
+			return 0
+		}
+		return (c.Time - p.Time) / deltaMs
+	}},
+}
+
+// JVMCollector reads JMX metrics of Java applications through Jolokia.
+type JVMCollector struct {
+	metrics.BaseCollector
+
+	ps        JolokiaPS
+	targets   []config.JolokiaTarget
+	lastStats map[string]*jvmStats
+}
+
+func NewJVMCollector(cfg *config.Config) *JVMCollector {
+	return &JVMCollector{
+		ps:        &systemPS{client: &http.Client{Timeout: 5 * time.Second}},
+		targets:   cfg.JolokiaTargets,
+		lastStats: make(map[string]*jvmStats),
+	}
+}
+
+func (c *JVMCollector) Name() string {
+	return "jvm"
+}
+
+func (c *JVMCollector) Collect() ([]metrics.DataPoint, error) {
+	all, err := c.CollectAll()
+	if err != nil {
+		return nil, err
+	}
+	var included []metrics.DataPoint
+	for _, dp := range all {
+		if c.IsIncluded(dp.Name, dp.Labels) {
+			included = append(included, dp)
+		}
+	}
+	return included, nil
+}
+
+func (c *JVMCollector) CollectAll() ([]metrics.DataPoint, error) {
+	var results []metrics.DataPoint
+	for _, target := range c.targets {
+		stats, err := c.getStats(target)
+		if err != nil {
+			logger.Log.Debug("Failed to collect metrics", "collector", c.Name(), "app", target.Name, "error", err)
+			continue
+		}
+		previous := c.lastStats[target.Name]
+		results = append(results, buildDataPoints(target.Name, stats, previous)...)
+		c.lastStats[target.Name] = stats
+	}
+	return results, nil
+}
+
+func buildDataPoints(app string, stats, previous *jvmStats) []metrics.DataPoint {
+	var results []metrics.DataPoint
+	for _, m := range jvmMetrics {
+		results = append(results, metrics.DataPoint{
+			Name:      m.name,
+			Timestamp: stats.Ts,
+			Value:     m.getVal(stats),
+			Labels:    map[string]string{"app": app},
+		})
+	}
+
+	var deltaMs float64
+	if previous != nil {
+		deltaMs = float64(stats.Ts - previous.Ts)
+	}
+	for _, gc := range sortedKeys(stats.GC) {
+		current := stats.GC[gc]
+		var last *gcStats
+		if previous != nil {
+			if p, ok := previous.GC[gc]; ok {
+				last = &p
+			}
+		}
+		for _, m := range jvmGCMetrics {
+			results = append(results, metrics.DataPoint{
+				Name:      m.name,
+				Timestamp: stats.Ts,
+				Value:     m.getVal(&current, last, deltaMs),
+				Labels:    map[string]string{"app": app, "gc": gc},
+			})
+		}
+	}
+	return results
+}
+
+func (c *JVMCollector) Discover() ([]collection.Metric, error) {
+	var discovered []collection.Metric
+	for _, target := range c.targets {
+		stats, err := c.getStats(target)
+		if err != nil {
+			continue
+		}
+		for _, dp := range buildDataPoints(target.Name, stats, nil) {
+			discovered = append(discovered, collection.Metric{
+				Name:   dp.Name,
+				Type:   "gauge",
+				Labels: dp.Labels,
+			})
+		}
+	}
+	return discovered, nil
+}
+
+func (c *JVMCollector) getStats(target config.JolokiaTarget) (*jvmStats, error) {
+	timestamp := time.Now().UnixMilli()
+	responses, err := c.ps.Read(target, readRequests)
+	if err != nil {
+		return nil, err
+	}
+	if len(responses) != len(readRequests) {
+		return nil, fmt.Errorf("expected %d responses, got %d", len(readRequests), len(responses))
+	}
+	for _, r := range responses {
+		if r.Status != http.StatusOK {
+			return nil, fmt.Errorf("jolokia read failed (status %d): %s", r.Status, r.Error)
+		}
+	}
+
+	stats := &jvmStats{Ts: timestamp, GC: make(map[string]gcStats)}
+	if err := json.Unmarshal(responses[0].Value, stats); err != nil {
+		return nil, fmt.Errorf("failed to parse memory bean: %w", err)
+	}
+	if err := json.Unmarshal(responses[2].Value, &stats.Threads); err != nil {
+		return nil, fmt.Errorf("failed to parse threading bean: %w", err)
+	}
+
+	// Wildcard reads return a map keyed by the full bean name
+	var collectors map[string]gcStats
+	if err := json.Unmarshal(responses[1].Value, &collectors); err != nil {
+		return nil, fmt.Errorf("failed to parse garbage collector beans: %w", err)
+	}
+	for bean, gc := range collectors {
+		stats.GC[beanProperty(bean, "name")] = gc
+	}
+	return stats, nil
+}
+
+// beanProperty extracts a key property from an MBean object name, e.g. "name"
+// from "java.lang:name=G1 Young Generation,type=GarbageCollector".
+func beanProperty(objectName, key string) string {
+	_, props, _ := strings.Cut(objectName, ":")
+	for _, prop := range strings.Split(props, ",") {
+		if k, v, ok := strings.Cut(prop, "="); ok && k == key {
+			return v
+		}
+	}
+	return objectName
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
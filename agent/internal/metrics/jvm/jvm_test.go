@@ -0,0 +1,147 @@
+package jvm
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"agent/internal/config"
+	"agent/internal/logger"
+	"agent/internal/metrics"
+)
+
+func init() {
+	logger.Log = slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+type mockPS struct {
+	mock.Mock
+}
+
+func (m *mockPS) Read(target config.JolokiaTarget, requests []jolokiaRequest) ([]jolokiaResponse, error) {
+	args := m.Called(target, requests)
+	responses, _ := args.Get(0).([]jolokiaResponse)
+	return responses, args.Error(1)
+}
+
+const jolokiaBody = `[
+  {"status":200,"value":{
+    "HeapMemoryUsage":{"init":1000,"used":256,"committed":512,"max":1024},
+    "NonHeapMemoryUsage":{"init":100,"used":64,"committed":80,"max":-1}}},
+  {"status":200,"value":{
+    "java.lang:name=G1 Young Generation,type=GarbageCollector":{"CollectionCount":%d,"CollectionTime":%d},
+    "java.lang:name=G1 Old Generation,type=GarbageCollector":{"CollectionCount":1,"CollectionTime":40}}},
+  {"status":200,"value":{"ThreadCount":42,"DaemonThreadCount":30,"PeakThreadCount":50}}
+]`
+
+func responses(t *testing.T, youngCount, youngTime int) []jolokiaResponse {
+	var r []jolokiaResponse
+	body := []byte(fmt.Sprintf(jolokiaBody, youngCount, youngTime))
+	require.NoError(t, json.Unmarshal(body, &r))
+	return r
+}
+
+func findPoint(t *testing.T, dps []metrics.DataPoint, name string, labels map[string]string) metrics.DataPoint {
+	t.Helper()
+	for _, dp := range dps {
+		if dp.Name != name {
+			continue
+		}
+		match := true
+		for k, v := range labels {
+			if dp.Labels[k] != v {
+				match = false
+			}
+		}
+		if match {
+			return dp
+		}
+	}
+	t.Fatalf("data point %s %v not found", name, labels)
+	return metrics.DataPoint{}
+}
+
+func TestJVMCollector(t *testing.T) {
+	target := config.JolokiaTarget{Name: "orders", URL: "http://localhost:8778/jolokia"}
+	var mps mockPS
+	defer mps.AssertExpectations(t)
+	mps.On("Read", target, readRequests).Return(responses(t, 10, 100), nil).Once()
+
+	c := &JVMCollector{ps: &mps, targets: []config.JolokiaTarget{target}, lastStats: map[string]*jvmStats{}}
+
+	dps, err := c.CollectAll()
+	require.NoError(t, err)
+
+	app := map[string]string{"app": "orders"}
+	assert.Equal(t, 256.0, findPoint(t, dps, "jvm_heap_used_bytes", app).Value)
+	assert.Equal(t, 1024.0, findPoint(t, dps, "jvm_heap_max_bytes", app).Value)
+	assert.Equal(t, 0.25, findPoint(t, dps, "jvm_heap_used_ratio", app).Value)
+	assert.Equal(t, 64.0, findPoint(t, dps, "jvm_nonheap_used_bytes", app).Value)
+	assert.Equal(t, 42.0, findPoint(t, dps, "jvm_threads_total", app).Value)
+	assert.Equal(t, 30.0, findPoint(t, dps, "jvm_threads_daemon_total", app).Value)
+
+	young := map[string]string{"app": "orders", "gc": "G1 Young Generation"}
+	assert.Equal(t, 10.0, findPoint(t, dps, "jvm_gc_collections_total", young).Value)
+	assert.Equal(t, 100.0, findPoint(t, dps, "jvm_gc_pause_ms_total", young).Value)
+	assert.Equal(t, 0.0, findPoint(t, dps, "jvm_gc_pause_ratio", young).Value) // No previous stats
+	assert.Equal(t, 40.0, findPoint(t, dps, "jvm_gc_pause_ms_total", map[string]string{"gc": "G1 Old Generation"}).Value)
+
+	// Second collection for rate calculation
+	mps.On("Read", target, readRequests).Return(responses(t, 30, 600), nil).Once()
+	c.lastStats["orders"].Ts -= 10000
+
+	dps, err = c.CollectAll()
+	require.NoError(t, err)
+	assert.InDelta(t, 2.0, findPoint(t, dps, "jvm_gc_collections_rate", young).Value, 0.01)
+	assert.InDelta(t, 0.05, findPoint(t, dps, "jvm_gc_pause_ratio", young).Value, 0.001)
+}
+
+func TestJVMCollector_TargetError(t *testing.T) {
+	var mps mockPS
+	mps.On("Read", mock.Anything, mock.Anything).Return(nil, errors.New("connection refused")).Once()
+	mps.On("Read", mock.Anything, mock.Anything).Return([]jolokiaResponse{{Status: 404, Error: "not found"}, {Status: 200}, {Status: 200}}, nil).Once()
+
+	c := &JVMCollector{ps: &mps, targets: []config.JolokiaTarget{{Name: "a"}, {Name: "b"}}, lastStats: map[string]*jvmStats{}}
+	dps, err := c.CollectAll()
+	require.NoError(t, err)
+	assert.Empty(t, dps)
+}
+
+func TestJVMCollector_Discover(t *testing.T) {
+	var mps mockPS
+	mps.On("Read", mock.Anything, mock.Anything).Return(responses(t, 1, 1), nil)
+
+	c := &JVMCollector{ps: &mps, targets: []config.JolokiaTarget{{Name: "orders"}}, lastStats: map[string]*jvmStats{}}
+	discovered, err := c.Discover()
+	require.NoError(t, err)
+	assert.Len(t, discovered, len(jvmMetrics)+2*len(jvmGCMetrics))
+}
+
+func TestSystemPS_Read(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, pass, ok := r.BasicAuth()
+		assert.True(t, ok)
+		assert.Equal(t, "monitor", user)
+		assert.Equal(t, "secret", pass)
+
+		var requests []jolokiaRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&requests))
+		assert.Equal(t, readRequests, requests)
+		w.Write([]byte(fmt.Sprintf(jolokiaBody, 1, 2)))
+	}))
+	defer ts.Close()
+
+	ps := &systemPS{client: ts.Client()}
+	r, err := ps.Read(config.JolokiaTarget{URL: ts.URL + "/jolokia", Username: "monitor", Password: "secret"}, readRequests)
+	require.NoError(t, err)
+	assert.Len(t, r, 3)
+}
@@ -0,0 +1,107 @@
+package kafka
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kadm"
+	"github.com/twmb/franz-go/pkg/kgo"
+	"github.com/twmb/franz-go/pkg/sasl/plain"
+	"github.com/twmb/franz-go/pkg/sasl/scram"
+
+	"agent/internal/config"
+)
+
+const requestTimeout = 10 * time.Second
+
+// systemPS reads clusters through the Kafka admin API. Clients are kept
+// between collections to reuse the broker connections.
+type systemPS struct {
+	clients map[string]*kadm.Client
+}
+
+func (s *systemPS) Read(cluster config.KafkaCluster) (*clusterState, error) {
+	client, err := s.client(cluster)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+
+	metadata, err := client.Metadata(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cluster metadata: %w", err)
+	}
+	state := &clusterState{Brokers: len(metadata.Brokers)}
+	for _, topic := range metadata.Topics {
+		if topic.IsInternal || topic.Err != nil {
+			continue
+		}
+		for _, p := range topic.Partitions {
+			state.Partitions = append(state.Partitions, partitionState{
+				Topic:    p.Topic,
+				Leader:   p.Leader,
+				Replicas: len(p.Replicas),
+				ISR:      len(p.ISR),
+			})
+		}
+	}
+
+	if len(cluster.ConsumerGroups) == 0 {
+		return state, nil
+	}
+	lags, err := client.Lag(ctx, cluster.ConsumerGroups...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read consumer lag: %w", err)
+	}
+	for _, described := range lags.Sorted() {
+		if described.Error() != nil {
+			continue
+		}
+		group := groupState{Name: described.Group, State: described.State, Members: len(described.Members)}
+		for _, l := range described.Lag.Sorted() {
+			// Partitions with a commit or offset error report a lag of -1
+			if l.Err != nil || l.Lag < 0 {
+				continue
+			}
+			group.Lags = append(group.Lags, partitionLag{Topic: l.Topic, Partition: l.Partition, Lag: l.Lag})
+		}
+		state.Groups = append(state.Groups, group)
+	}
+	return state, nil
+}
+
+func (s *systemPS) client(cluster config.KafkaCluster) (*kadm.Client, error) {
+	if client, ok := s.clients[cluster.Name]; ok {
+		return client, nil
+	}
+	opts := []kgo.Opt{
+		kgo.SeedBrokers(cluster.Brokers...),
+		kgo.DialTimeout(5 * time.Second),
+	}
+	if cluster.TLS {
+		opts = append(opts, kgo.DialTLSConfig(&tls.Config{}))
+	}
+	switch strings.ToUpper(cluster.SASLMechanism) {
+	case "":
+	case "PLAIN":
+		opts = append(opts, kgo.SASL(plain.Auth{User: cluster.Username, Pass: cluster.Password}.AsMechanism()))
+	case "SCRAM-SHA-256":
+		opts = append(opts, kgo.SASL(scram.Auth{User: cluster.Username, Pass: cluster.Password}.AsSha256Mechanism()))
+	case "SCRAM-SHA-512":
+		opts = append(opts, kgo.SASL(scram.Auth{User: cluster.Username, Pass: cluster.Password}.AsSha512Mechanism()))
+	default:
+		return nil, fmt.Errorf("unsupported sasl mechanism %q", cluster.SASLMechanism)
+	}
+
+	cl, err := kgo.NewClient(opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create kafka client: %w", err)
+	}
+	client := kadm.NewClient(cl)
+	s.clients[cluster.Name] = client
+	return client, nil
+}
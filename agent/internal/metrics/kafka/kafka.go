@@ -0,0 +1,201 @@
+package kafka
+
+import (
+	"sort"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kadm"
+
+	"agent/internal/collection"
+	"agent/internal/config"
+	"agent/internal/logger"
+	"agent/internal/metrics"
+)
+
+type partitionState struct {
+	Topic    string
+	Leader   int32 // -1 when the partition has no leader
+	Replicas int
+	ISR      int
+}
+
+type partitionLag struct {
+	Topic     string
+	Partition int32
+	Lag       int64
+}
+
+type groupState struct {
+	Name    string
+	State   string // Stable, Empty, PreparingRebalance, Dead...
+	Members int
+	Lags    []partitionLag
+}
+
+// clusterState is an internal type used to store what was read from a cluster
+type clusterState struct {
+	Brokers    int
+	Partitions []partitionState
+	Groups     []groupState
+}
+
+type KafkaPS interface {
+	Read(cluster config.KafkaCluster) (*clusterState, error)
+}
+
+// kafkaMetrics list the cluster wide metrics
+var kafkaMetrics = []struct {
+	name   string
+	getVal func(s *clusterState) float64
+}{
+	{"kafka_brokers_total", func(s *clusterState) float64 { return float64(s.Brokers) }},
+	{"kafka_topics_total", func(s *clusterState) float64 {
+		topics := make(map[string]struct{})
+		for _, p := range s.Partitions {
+			topics[p.Topic] = struct{}{}
+		}
+		return float64(len(topics))
+	}},
+	{"kafka_partitions_total", func(s *clusterState) float64 { return float64(len(s.Partitions)) }},
+	{"kafka_partitions_under_replicated_total", func(s *clusterState) float64 {
+		return countPartitions(s, func(p partitionState) bool { return p.ISR < p.Replicas })
+	}},
+	{"kafka_partitions_offline_total", func(s *clusterState) float64 {
+		return countPartitions(s, func(p partitionState) bool { return p.Leader < 0 })
+	}},
+}
+
+// kafkaGroupMetrics list the metrics reported for each consumer group
+var kafkaGroupMetrics = []struct {
+	name   string
+	getVal func(g *groupState) float64
+}{
+	{"kafka_consumergroup_members_total", func(g *groupState) float64 { return float64(g.Members) }},
+	{"kafka_consumergroup_stable", func(g *groupState) float64 {
+		if g.State == "Stable" {
+			return 1
+		}
+		return 0
+	}},
+}
+
+func countPartitions(s *clusterState, match func(partitionState) bool) float64 {
+	var n float64
+	for _, p := range s.Partitions {
+		if match(p) {
+			n++
+		}
+	}
+	return n
+}
+
+// KafkaCollector reports the state of Kafka clusters and the lag of their
+// consumer groups.
+type KafkaCollector struct {
+	metrics.BaseCollector
+
+	ps       KafkaPS
+	clusters []config.KafkaCluster
+}
+
+func NewKafkaCollector(cfg *config.Config) *KafkaCollector {
+	return &KafkaCollector{
+		ps:       &systemPS{clients: make(map[string]*kadm.Client)},
+		clusters: cfg.KafkaClusters,
+	}
+}
+
+func (c *KafkaCollector) Name() string {
+	return "kafka"
+}
+
+func (c *KafkaCollector) Collect() ([]metrics.DataPoint, error) {
+	all, err := c.CollectAll()
+	if err != nil {
+		return nil, err
+	}
+	var included []metrics.DataPoint
+	for _, dp := range all {
+		if c.IsIncluded(dp.Name, dp.Labels) {
+			included = append(included, dp)
+		}
+	}
+	return included, nil
+}
+
+func (c *KafkaCollector) CollectAll() ([]metrics.DataPoint, error) {
+	timestamp := time.Now().UnixMilli()
+	var results []metrics.DataPoint
+	for _, cluster := range c.clusters {
+		state, err := c.ps.Read(cluster)
+		if err != nil {
+			logger.Log.Debug("Failed to collect metrics", "collector", c.Name(), "cluster", cluster.Name, "error", err)
+			continue
+		}
+		results = append(results, buildDataPoints(cluster.Name, state, timestamp)...)
+	}
+	return results, nil
+}
+
+func buildDataPoints(cluster string, state *clusterState, ts int64) []metrics.DataPoint {
+	var results []metrics.DataPoint
+	for _, m := range kafkaMetrics {
+		results = append(results, metrics.DataPoint{
+			Name:      m.name,
+			Timestamp: ts,
+			Value:     m.getVal(state),
+			Labels:    map[string]string{"cluster": cluster},
+		})
+	}
+
+	for i := range state.Groups {
+		group := &state.Groups[i]
+		for _, m := range kafkaGroupMetrics {
+			results = append(results, metrics.DataPoint{
+				Name:      m.name,
+				Timestamp: ts,
+				Value:     m.getVal(group),
+				Labels:    map[string]string{"cluster": cluster, "group": group.Name},
+			})
+		}
+
+		// Lag is summed per topic, per partition series would explode the
+		// cardinality on large topics
+		lagByTopic := make(map[string]int64)
+		for _, l := range group.Lags {
+			lagByTopic[l.Topic] += l.Lag
+		}
+		topics := make([]string, 0, len(lagByTopic))
+		for topic := range lagByTopic {
+			topics = append(topics, topic)
+		}
+		sort.Strings(topics)
+		for _, topic := range topics {
+			results = append(results, metrics.DataPoint{
+				Name:      "kafka_consumergroup_lag_total",
+				Timestamp: ts,
+				Value:     float64(lagByTopic[topic]),
+				Labels:    map[string]string{"cluster": cluster, "group": group.Name, "topic": topic},
+			})
+		}
+	}
+	return results
+}
+
+func (c *KafkaCollector) Discover() ([]collection.Metric, error) {
+	var discovered []collection.Metric
+	for _, cluster := range c.clusters {
+		state, err := c.ps.Read(cluster)
+		if err != nil {
+			continue
+		}
+		for _, dp := range buildDataPoints(cluster.Name, state, 0) {
+			discovered = append(discovered, collection.Metric{
+				Name:   dp.Name,
+				Type:   "gauge",
+				Labels: dp.Labels,
+			})
+		}
+	}
+	return discovered, nil
+}
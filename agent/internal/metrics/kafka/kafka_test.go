@@ -0,0 +1,105 @@
+package kafka
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"agent/internal/config"
+	"agent/internal/logger"
+	"agent/internal/metrics"
+)
+
+func init() {
+	logger.Log = slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+type mockPS struct {
+	mock.Mock
+}
+
+func (m *mockPS) Read(cluster config.KafkaCluster) (*clusterState, error) {
+	args := m.Called(cluster.Name)
+	state, _ := args.Get(0).(*clusterState)
+	return state, args.Error(1)
+}
+
+func findPoint(t *testing.T, dps []metrics.DataPoint, name string, labels map[string]string) metrics.DataPoint {
+	t.Helper()
+	for _, dp := range dps {
+		if dp.Name != name {
+			continue
+		}
+		match := true
+		for k, v := range labels {
+			if dp.Labels[k] != v {
+				match = false
+			}
+		}
+		if match {
+			return dp
+		}
+	}
+	t.Fatalf("data point %s %v not found", name, labels)
+	return metrics.DataPoint{}
+}
+
+func TestKafkaCollector(t *testing.T) {
+	state := &clusterState{
+		Brokers: 3,
+		Partitions: []partitionState{
+			{Topic: "orders", Leader: 1, Replicas: 3, ISR: 3},
+			{Topic: "orders", Leader: 2, Replicas: 3, ISR: 2},
+			{Topic: "payments", Leader: -1, Replicas: 3, ISR: 0},
+		},
+		Groups: []groupState{
+			{Name: "billing", State: "Stable", Members: 2, Lags: []partitionLag{
+				{Topic: "orders", Partition: 0, Lag: 10},
+				{Topic: "orders", Partition: 1, Lag: 5},
+				{Topic: "payments", Partition: 0, Lag: 0},
+			}},
+			{Name: "audit", State: "Empty"},
+		},
+	}
+	var mps mockPS
+	defer mps.AssertExpectations(t)
+	mps.On("Read", "main").Return(state, nil)
+	mps.On("Read", "legacy").Return(nil, errors.New("dial tcp: connection refused"))
+
+	c := &KafkaCollector{ps: &mps, clusters: []config.KafkaCluster{
+		{Name: "main", Brokers: []string{"localhost:9092"}, ConsumerGroups: []string{"billing", "audit"}},
+		{Name: "legacy", Brokers: []string{"localhost:9093"}},
+	}}
+	dps, err := c.CollectAll()
+	require.NoError(t, err)
+
+	cluster := map[string]string{"cluster": "main"}
+	assert.Equal(t, 3.0, findPoint(t, dps, "kafka_brokers_total", cluster).Value)
+	assert.Equal(t, 2.0, findPoint(t, dps, "kafka_topics_total", cluster).Value)
+	assert.Equal(t, 2.0, findPoint(t, dps, "kafka_partitions_under_replicated_total", cluster).Value)
+	assert.Equal(t, 1.0, findPoint(t, dps, "kafka_partitions_offline_total", cluster).Value)
+
+	assert.Equal(t, 15.0, findPoint(t, dps, "kafka_consumergroup_lag_total", map[string]string{"group": "billing", "topic": "orders"}).Value)
+	assert.Equal(t, 0.0, findPoint(t, dps, "kafka_consumergroup_lag_total", map[string]string{"group": "billing", "topic": "payments"}).Value)
+	assert.Equal(t, 1.0, findPoint(t, dps, "kafka_consumergroup_stable", map[string]string{"group": "billing"}).Value)
+	assert.Equal(t, 0.0, findPoint(t, dps, "kafka_consumergroup_stable", map[string]string{"group": "audit"}).Value)
+
+	for _, dp := range dps {
+		assert.Equal(t, "main", dp.Labels["cluster"])
+	}
+}
+
+func TestKafkaCollectorDiscover(t *testing.T) {
+	var mps mockPS
+	mps.On("Read", "main").Return(&clusterState{Brokers: 1}, nil)
+
+	c := &KafkaCollector{ps: &mps, clusters: []config.KafkaCluster{{Name: "main"}}}
+	discovered, err := c.Discover()
+	require.NoError(t, err)
+	assert.Len(t, discovered, len(kafkaMetrics))
+}
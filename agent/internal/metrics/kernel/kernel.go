@@ -0,0 +1,265 @@
+package kernel
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"agent/internal/collection"
+	"agent/internal/common"
+	"agent/internal/metrics"
+)
+
+type KernelPS interface {
+	SoftnetStat() ([]softnetStat, error)
+	// Interrupts returns the device interrupts handled by each CPU since boot
+	Interrupts() (map[string]uint64, error)
+	// Misc returns the kernel limits and usages by metric name
+	Misc() (map[string]float64, error)
+}
+
+type systemPS struct {
+	procRoot string
+}
+
+func (s *systemPS) SoftnetStat() ([]softnetStat, error) {
+	f, err := os.Open(filepath.Join(s.procRoot, "net", "softnet_stat"))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return parseSoftnetStat(f)
+}
+
+func (s *systemPS) Interrupts() (map[string]uint64, error) {
+	f, err := os.Open(filepath.Join(s.procRoot, "interrupts"))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return parseInterrupts(f)
+}
+
+func (s *systemPS) Misc() (map[string]float64, error) {
+	return readMisc(s.procRoot)
+}
+
+// KernelCollector reports kernel level counters that explain packet loss
+// before it reaches the network stack: backlog drops and budget squeezes of
+// the per CPU receive queues, and how interrupts are spread across CPUs.
+//
+// It also reports the kernel resources whose exhaustion causes failures that
+// are hard to relate to their cause: entropy (blocked crypto), file handles,
+// pseudo terminals and PIDs.
+type KernelCollector struct {
+	metrics.BaseCollector
+
+	ps KernelPS
+	mu sync.Mutex
+	// lastInterrupts is the per CPU interrupt count of the previous
+	// collection, to compute the imbalance over the interval
+	lastInterrupts map[string]uint64
+}
+
+func NewKernelCollector() *KernelCollector {
+	return &KernelCollector{
+		ps: &systemPS{procRoot: common.HostPath("/proc")},
+	}
+}
+
+func (c *KernelCollector) Name() string {
+	return "kernel"
+}
+
+// usageRatios list the ratios computed from a usage and its limit
+var usageRatios = []struct {
+	name  string
+	used  string
+	limit string
+}{
+	{"kernel_file_handles_used_ratio", "kernel_file_handles_allocated", "kernel_file_handles_max"},
+	{"kernel_pty_used_ratio", "kernel_pty_allocated", "kernel_pty_max"},
+	{"kernel_pid_used_ratio", "kernel_tasks", "kernel_pid_max"},
+}
+
+// softnetMetrics list the counters of /proc/net/softnet_stat
+var softnetMetrics = []struct {
+	name     string
+	getValue func(softnetStat) uint64
+}{
+	{"kernel_softnet_processed_total", func(s softnetStat) uint64 { return s.Processed }},
+	{"kernel_softnet_dropped_total", func(s softnetStat) uint64 { return s.Dropped }},
+	{"kernel_softnet_squeezed_total", func(s softnetStat) uint64 { return s.Squeezed }},
+}
+
+func (c *KernelCollector) Collect() ([]metrics.DataPoint, error) {
+	all, err := c.CollectAll()
+	if err != nil {
+		return nil, err
+	}
+	var included []metrics.DataPoint
+	for _, dp := range all {
+		if c.IsIncluded(dp.Name, dp.Labels) {
+			included = append(included, dp)
+		}
+	}
+	return included, nil
+}
+
+func (c *KernelCollector) CollectAll() ([]metrics.DataPoint, error) {
+	timestamp := time.Now().UnixMilli()
+	var results []metrics.DataPoint
+
+	softnet, softnetErr := c.ps.SoftnetStat()
+	for _, stat := range softnet {
+		labels := map[string]string{"cpu": "cpu" + strconv.Itoa(stat.CPU)}
+		for _, m := range softnetMetrics {
+			results = append(results, metrics.DataPoint{
+				Name:      m.name,
+				Timestamp: timestamp,
+				Value:     float64(m.getValue(stat)),
+				Labels:    labels,
+			})
+		}
+	}
+
+	interrupts, interruptsErr := c.ps.Interrupts()
+	misc, miscErr := c.ps.Misc()
+	if softnetErr != nil && interruptsErr != nil && miscErr != nil {
+		return nil, fmt.Errorf("failed to read kernel stats: %w", softnetErr)
+	}
+	for _, cpu := range sortedCPUs(interrupts) {
+		results = append(results, metrics.DataPoint{
+			Name:      "kernel_interrupts_total",
+			Timestamp: timestamp,
+			Value:     float64(interrupts[cpu]),
+			Labels:    map[string]string{"cpu": cpu},
+		})
+	}
+	if ratio, ok := c.imbalance(interrupts); ok {
+		results = append(results, metrics.DataPoint{
+			Name:      "kernel_interrupts_imbalance_ratio",
+			Timestamp: timestamp,
+			Value:     ratio,
+			Labels:    map[string]string{},
+		})
+	}
+
+	for _, name := range miscMetricNames(misc) {
+		results = append(results, metrics.DataPoint{
+			Name:      name,
+			Timestamp: timestamp,
+			Value:     misc[name],
+			Labels:    map[string]string{},
+		})
+	}
+	return results, nil
+}
+
+// miscMetricNames returns the names of the available misc gauges, with the
+// usage ratios computed into misc.
+func miscMetricNames(misc map[string]float64) []string {
+	for _, r := range usageRatios {
+		used, okUsed := misc[r.used]
+		limit, okLimit := misc[r.limit]
+		if okUsed && okLimit && limit > 0 {
+			misc[r.name] = used / limit
+		}
+	}
+	names := make([]string, 0, len(misc))
+	for name := range misc {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// imbalance returns the busiest CPU's share of the device interrupts handled
+// since the previous collection, relative to an even spread: 1 when all CPUs
+// handled as many interrupts, the number of CPUs when a single one handled
+// them all.
+func (c *KernelCollector) imbalance(current map[string]uint64) (float64, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	previous := c.lastInterrupts
+	c.lastInterrupts = current
+	if previous == nil || len(current) < 2 {
+		return 0, false
+	}
+
+	var total, busiest uint64
+	for cpu, count := range current {
+		before, ok := previous[cpu]
+		if !ok || count < before {
+			// CPU hotplug or counter reset, wait for the next interval
+			return 0, false
+		}
+		delta := count - before
+		total += delta
+		busiest = max(busiest, delta)
+	}
+	if total == 0 {
+		return 0, false
+	}
+	return float64(busiest) / (float64(total) / float64(len(current))), true
+}
+
+func (c *KernelCollector) Discover() ([]collection.Metric, error) {
+	discovered := []collection.Metric{}
+	if softnet, err := c.ps.SoftnetStat(); err == nil {
+		for _, stat := range softnet {
+			for _, m := range softnetMetrics {
+				discovered = append(discovered, collection.Metric{
+					Name:   m.name,
+					Type:   "counter",
+					Labels: map[string]string{"cpu": "cpu" + strconv.Itoa(stat.CPU)},
+				})
+			}
+		}
+	}
+	if interrupts, err := c.ps.Interrupts(); err == nil {
+		for _, cpu := range sortedCPUs(interrupts) {
+			discovered = append(discovered, collection.Metric{
+				Name:   "kernel_interrupts_total",
+				Type:   "counter",
+				Labels: map[string]string{"cpu": cpu},
+			})
+		}
+		if len(interrupts) > 1 {
+			discovered = append(discovered, collection.Metric{
+				Name:   "kernel_interrupts_imbalance_ratio",
+				Type:   "gauge",
+				Labels: map[string]string{},
+			})
+		}
+	}
+	if misc, err := c.ps.Misc(); err == nil {
+		for _, name := range miscMetricNames(misc) {
+			discovered = append(discovered, collection.Metric{
+				Name:   name,
+				Type:   "gauge",
+				Labels: map[string]string{},
+			})
+		}
+	}
+	return discovered, nil
+}
+
+// sortedCPUs returns the CPU names in numeric order
+func sortedCPUs(counts map[string]uint64) []string {
+	cpus := make([]string, 0, len(counts))
+	for cpu := range counts {
+		cpus = append(cpus, cpu)
+	}
+	sort.Slice(cpus, func(i, j int) bool {
+		a, _ := strconv.Atoi(strings.TrimPrefix(cpus[i], "cpu"))
+		b, _ := strconv.Atoi(strings.TrimPrefix(cpus[j], "cpu"))
+		return a < b
+	})
+	return cpus
+}
@@ -0,0 +1,168 @@
+package kernel
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"agent/internal/metrics"
+)
+
+type mockPS struct {
+	mock.Mock
+}
+
+func (m *mockPS) SoftnetStat() ([]softnetStat, error) {
+	args := m.Called()
+	stats, _ := args.Get(0).([]softnetStat)
+	return stats, args.Error(1)
+}
+
+func (m *mockPS) Interrupts() (map[string]uint64, error) {
+	args := m.Called()
+	counts, _ := args.Get(0).(map[string]uint64)
+	return counts, args.Error(1)
+}
+
+func (m *mockPS) Misc() (map[string]float64, error) {
+	args := m.Called()
+	values, _ := args.Get(0).(map[string]float64)
+	return values, args.Error(1)
+}
+
+func findPoint(t *testing.T, dps []metrics.DataPoint, name string, labels map[string]string) metrics.DataPoint {
+	t.Helper()
+	for _, dp := range dps {
+		if dp.Name == name && assert.ObjectsAreEqual(labels, dp.Labels) {
+			return dp
+		}
+	}
+	t.Fatalf("data point %s %v not found", name, labels)
+	return metrics.DataPoint{}
+}
+
+const softnetStatFile = `0001e0b4 00000002 0000000a 00000000 00000000 00000000 00000000 00000000 00000000 00000000 00000000 00000000 00000000 00000000
+00000f10 00000000 00000001 00000000 00000000 00000000 00000000 00000000 00000000 00000000 00000000 00000000 00000002 00000000
+`
+
+const interruptsFile = `           CPU0       CPU1       CPU2
+  0:         44          0          0   IO-APIC   2-edge      timer
+  8:          0          0          1   IO-APIC   8-edge      rtc0
+ 24:     100000         10         20   PCI-MSI 65536-edge      eth0-rx-0
+NMI:          5          5          5   Non-maskable interrupts
+LOC:    9000000    8000000    7000000   Local timer interrupts
+ERR:          0
+`
+
+func TestParseSoftnetStat(t *testing.T) {
+	stats, err := parseSoftnetStat(strings.NewReader(softnetStatFile))
+	require.NoError(t, err)
+	assert.Equal(t, []softnetStat{
+		{CPU: 0, Processed: 0x1e0b4, Dropped: 2, Squeezed: 10},
+		// CPU1 is offline, the CPU id column says so
+		{CPU: 2, Processed: 0xf10, Squeezed: 1},
+	}, stats)
+
+	_, err = parseSoftnetStat(strings.NewReader("zz 00 00\n"))
+	assert.Error(t, err)
+}
+
+func TestParseInterrupts(t *testing.T) {
+	counts, err := parseInterrupts(strings.NewReader(interruptsFile))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]uint64{"cpu0": 100044, "cpu1": 10, "cpu2": 21}, counts)
+}
+
+func TestKernelCollector(t *testing.T) {
+	var mps mockPS
+	mps.On("SoftnetStat").Return([]softnetStat{{CPU: 0, Processed: 100, Dropped: 2, Squeezed: 5}}, nil)
+	mps.On("Interrupts").Return(map[string]uint64{"cpu0": 1000, "cpu1": 1000}, nil).Once()
+	mps.On("Interrupts").Return(map[string]uint64{"cpu0": 1900, "cpu1": 1100}, nil).Once()
+	mps.On("Misc").Return(nil, errors.New("no such file"))
+
+	c := &KernelCollector{ps: &mps}
+	dps, err := c.CollectAll()
+	require.NoError(t, err)
+	cpu0 := map[string]string{"cpu": "cpu0"}
+	assert.Equal(t, 2.0, findPoint(t, dps, "kernel_softnet_dropped_total", cpu0).Value)
+	assert.Equal(t, 5.0, findPoint(t, dps, "kernel_softnet_squeezed_total", cpu0).Value)
+	assert.Equal(t, 1000.0, findPoint(t, dps, "kernel_interrupts_total", map[string]string{"cpu": "cpu1"}).Value)
+	for _, dp := range dps {
+		assert.NotEqual(t, "kernel_interrupts_imbalance_ratio", dp.Name, "the imbalance needs two collections")
+	}
+
+	// 900 and 100 interrupts, against 500 each when evenly spread
+	dps, err = c.CollectAll()
+	require.NoError(t, err)
+	assert.InDelta(t, 1.8, findPoint(t, dps, "kernel_interrupts_imbalance_ratio", map[string]string{}).Value, 1e-9)
+}
+
+func TestKernelCollectorUnavailable(t *testing.T) {
+	var mps mockPS
+	mps.On("SoftnetStat").Return(nil, errors.New("no such file"))
+	mps.On("Interrupts").Return(nil, errors.New("no such file"))
+	mps.On("Misc").Return(nil, errors.New("no such file"))
+
+	c := &KernelCollector{ps: &mps}
+	_, err := c.CollectAll()
+	assert.Error(t, err)
+
+	discovered, err := c.Discover()
+	require.NoError(t, err)
+	assert.Empty(t, discovered)
+}
+
+func TestReadMisc(t *testing.T) {
+	root := t.TempDir()
+	files := map[string]string{
+		"sys/kernel/random/entropy_avail": "256",
+		"sys/kernel/random/poolsize":      "256",
+		"sys/fs/file-nr":                  "9344\t0\t9223372036854775807",
+		"sys/kernel/pty/nr":               "3",
+		"sys/kernel/pty/max":              "4096",
+		"sys/kernel/pid_max":              "4194304",
+		"loadavg":                         "0.52 0.58 0.59 2/1048 12345",
+	}
+	for path, content := range files {
+		full := filepath.Join(root, path)
+		require.NoError(t, os.MkdirAll(filepath.Dir(full), 0o755))
+		require.NoError(t, os.WriteFile(full, []byte(content+"\n"), 0o644))
+	}
+
+	values, err := readMisc(root)
+	require.NoError(t, err)
+	assert.Equal(t, 256.0, values["kernel_entropy_available_bits"])
+	assert.Equal(t, 9344.0, values["kernel_file_handles_allocated"])
+	assert.Equal(t, 1048.0, values["kernel_tasks"])
+	assert.NotContains(t, values, "kernel_threads_max")
+
+	_, err = readMisc(filepath.Join(root, "missing"))
+	assert.Error(t, err)
+}
+
+func TestKernelCollectorMisc(t *testing.T) {
+	var mps mockPS
+	mps.On("SoftnetStat").Return(nil, errors.New("no such file"))
+	mps.On("Interrupts").Return(nil, errors.New("no such file"))
+	mps.On("Misc").Return(map[string]float64{
+		"kernel_pty_allocated": 1024,
+		"kernel_pty_max":       4096,
+		"kernel_tasks":         1000,
+		"kernel_pid_max":       0,
+	}, nil)
+
+	c := &KernelCollector{ps: &mps}
+	dps, err := c.CollectAll()
+	require.NoError(t, err)
+	assert.Equal(t, 0.25, findPoint(t, dps, "kernel_pty_used_ratio", map[string]string{}).Value)
+	assert.Equal(t, 1000.0, findPoint(t, dps, "kernel_tasks", map[string]string{}).Value)
+	for _, dp := range dps {
+		assert.NotEqual(t, "kernel_pid_used_ratio", dp.Name, "no ratio without a limit")
+	}
+}
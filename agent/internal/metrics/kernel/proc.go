@@ -0,0 +1,158 @@
+package kernel
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// miscFiles list the single value gauges read from /proc. field is the index
+// of the value in files holding several ones.
+var miscFiles = []struct {
+	name  string
+	path  string
+	field int
+}{
+	{"kernel_entropy_available_bits", "sys/kernel/random/entropy_avail", 0},
+	{"kernel_entropy_pool_size_bits", "sys/kernel/random/poolsize", 0},
+	// file-nr is "allocated unused max", unused is always 0 since 2.6
+	{"kernel_file_handles_allocated", "sys/fs/file-nr", 0},
+	{"kernel_file_handles_max", "sys/fs/file-nr", 2},
+	{"kernel_pty_allocated", "sys/kernel/pty/nr", 0},
+	{"kernel_pty_max", "sys/kernel/pty/max", 0},
+	{"kernel_pid_max", "sys/kernel/pid_max", 0},
+	{"kernel_threads_max", "sys/kernel/threads-max", 0},
+}
+
+// readMisc reads the gauges of miscFiles and the number of tasks (processes
+// and threads, each one holds a PID) from loadavg. Missing files are skipped.
+func readMisc(procRoot string) (map[string]float64, error) {
+	values := make(map[string]float64)
+	var lastErr error
+	for _, f := range miscFiles {
+		data, err := os.ReadFile(filepath.Join(procRoot, f.path))
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		fields := strings.Fields(string(data))
+		if f.field >= len(fields) {
+			lastErr = fmt.Errorf("unexpected content in %s", f.path)
+			continue
+		}
+		v, err := strconv.ParseFloat(fields[f.field], 64)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		values[f.name] = v
+	}
+
+	// loadavg is "0.00 0.01 0.05 running/total lastpid"
+	if data, err := os.ReadFile(filepath.Join(procRoot, "loadavg")); err == nil {
+		fields := strings.Fields(string(data))
+		if len(fields) >= 4 {
+			if _, total, ok := strings.Cut(fields[3], "/"); ok {
+				if v, err := strconv.ParseFloat(total, 64); err == nil {
+					values["kernel_tasks"] = v
+				}
+			}
+		}
+	}
+
+	if len(values) == 0 {
+		return nil, lastErr
+	}
+	return values, nil
+}
+
+// softnetStat is a line of /proc/net/softnet_stat, the network receive
+// counters of a CPU
+type softnetStat struct {
+	CPU       int
+	Processed uint64
+	// Dropped counts the packets dropped because the backlog queue was full
+	Dropped uint64
+	// Squeezed counts the times the receive processing ran out of budget
+	// or time with work remaining
+	Squeezed uint64
+}
+
+// parseSoftnetStat parses /proc/net/softnet_stat. Values are hexadecimal,
+// there is one line per online CPU and the CPU id is the 13th column on
+// kernels 5.10 and newer, the line number before.
+func parseSoftnetStat(r io.Reader) ([]softnetStat, error) {
+	var stats []softnetStat
+	scanner := bufio.NewScanner(r)
+	for line := 0; scanner.Scan(); line++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 3 {
+			return nil, fmt.Errorf("unexpected softnet_stat line: %q", scanner.Text())
+		}
+		values := make([]uint64, len(fields))
+		for i, field := range fields {
+			v, err := strconv.ParseUint(field, 16, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid softnet_stat value %q: %w", field, err)
+			}
+			values[i] = v
+		}
+		stat := softnetStat{CPU: line, Processed: values[0], Dropped: values[1], Squeezed: values[2]}
+		if len(values) >= 13 {
+			stat.CPU = int(values[12])
+		}
+		stats = append(stats, stat)
+	}
+	return stats, scanner.Err()
+}
+
+// parseInterrupts parses /proc/interrupts and returns the number of device
+// interrupts handled by each CPU, indexed like the CPUs of the header (e.g.
+// "cpu0"). The architecture specific lines (LOC, RES, NMI...) are ignored,
+// they are per CPU by design and say nothing about IRQ affinity.
+func parseInterrupts(r io.Reader) (map[string]uint64, error) {
+	scanner := bufio.NewScanner(r)
+	// Lines can be long on hosts with many CPUs
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	if !scanner.Scan() {
+		return nil, fmt.Errorf("empty interrupts file")
+	}
+	var cpus []string
+	for _, name := range strings.Fields(scanner.Text()) {
+		cpus = append(cpus, strings.ToLower(name))
+	}
+	if len(cpus) == 0 {
+		return nil, fmt.Errorf("no CPU in interrupts header")
+	}
+
+	totals := make(map[string]uint64, len(cpus))
+	for _, cpu := range cpus {
+		totals[cpu] = 0
+	}
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		irq := strings.TrimSuffix(fields[0], ":")
+		if _, err := strconv.Atoi(irq); err != nil {
+			continue
+		}
+		for i, cpu := range cpus {
+			if i+1 >= len(fields) {
+				break
+			}
+			count, err := strconv.ParseUint(fields[i+1], 10, 64)
+			if err != nil {
+				// The counts are followed by the controller and device names
+				break
+			}
+			totals[cpu] += count
+		}
+	}
+	return totals, scanner.Err()
+}
@@ -0,0 +1,100 @@
+package load
+
+import (
+	"fmt"
+	"runtime"
+	"time"
+
+	"github.com/shirou/gopsutil/v4/load"
+
+	"agent/internal/collection"
+	"agent/internal/metrics"
+)
+
+type LoadPS interface {
+	Avg() (*load.AvgStat, error)
+	NumCPU() int
+}
+
+type systemPS struct{}
+
+func (s *systemPS) Avg() (*load.AvgStat, error) {
+	return load.Avg()
+}
+
+func (s *systemPS) NumCPU() int {
+	return runtime.NumCPU()
+}
+
+// loadMetrics are reported as is and divided by the number of cores, a
+// per core load above 1 means that tasks wait for a CPU
+var loadMetrics = []struct {
+	name     string
+	getValue func(*load.AvgStat) float64
+}{
+	{"load_1m", func(l *load.AvgStat) float64 { return l.Load1 }},
+	{"load_5m", func(l *load.AvgStat) float64 { return l.Load5 }},
+	{"load_15m", func(l *load.AvgStat) float64 { return l.Load15 }},
+}
+
+// LoadCollector reports the load averages of the system. On Windows, which
+// has none, gopsutil computes them from the processor queue length.
+type LoadCollector struct {
+	metrics.BaseCollector
+
+	ps LoadPS
+}
+
+func NewLoadCollector() *LoadCollector {
+	return &LoadCollector{ps: &systemPS{}}
+}
+
+func (c *LoadCollector) Name() string {
+	return "load"
+}
+
+func (c *LoadCollector) Collect() ([]metrics.DataPoint, error) {
+	all, err := c.CollectAll()
+	if err != nil {
+		return nil, err
+	}
+	var included []metrics.DataPoint
+	for _, dp := range all {
+		if c.IsIncluded(dp.Name, dp.Labels) {
+			included = append(included, dp)
+		}
+	}
+	return included, nil
+}
+
+func (c *LoadCollector) CollectAll() ([]metrics.DataPoint, error) {
+	avg, err := c.ps.Avg()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get load average: %w", err)
+	}
+	return buildDataPoints(avg, c.ps.NumCPU(), time.Now().UnixMilli()), nil
+}
+
+func (c *LoadCollector) Discover() ([]collection.Metric, error) {
+	avg, err := c.ps.Avg()
+	if err != nil {
+		return []collection.Metric{}, nil
+	}
+	discovered := []collection.Metric{}
+	for _, dp := range buildDataPoints(avg, c.ps.NumCPU(), 0) {
+		discovered = append(discovered, collection.Metric{Name: dp.Name, Type: "gauge", Labels: dp.Labels})
+	}
+	return discovered, nil
+}
+
+func buildDataPoints(avg *load.AvgStat, cpus int, ts int64) []metrics.DataPoint {
+	var results []metrics.DataPoint
+	for _, m := range loadMetrics {
+		value := m.getValue(avg)
+		results = append(results, metrics.DataPoint{Name: m.name, Timestamp: ts, Value: value, Labels: map[string]string{}})
+		if cpus > 0 {
+			results = append(results, metrics.DataPoint{Name: m.name + "_per_core", Timestamp: ts, Value: value / float64(cpus), Labels: map[string]string{}})
+		}
+	}
+	return results
+}
@@ -0,0 +1,61 @@
+package load
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/shirou/gopsutil/v4/load"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+type mockPS struct {
+	mock.Mock
+}
+
+func (m *mockPS) Avg() (*load.AvgStat, error) {
+	args := m.Called()
+	avg, _ := args.Get(0).(*load.AvgStat)
+	return avg, args.Error(1)
+}
+
+func (m *mockPS) NumCPU() int {
+	return m.Called().Int(0)
+}
+
+func TestLoadCollector(t *testing.T) {
+	var mps mockPS
+	mps.On("Avg").Return(&load.AvgStat{Load1: 6, Load5: 4, Load15: 2}, nil)
+	mps.On("NumCPU").Return(4)
+
+	c := &LoadCollector{ps: &mps}
+	dps, err := c.CollectAll()
+	require.NoError(t, err)
+
+	values := make(map[string]float64)
+	for _, dp := range dps {
+		values[dp.Name] = dp.Value
+	}
+	assert.Equal(t, map[string]float64{
+		"load_1m":           6,
+		"load_1m_per_core":  1.5,
+		"load_5m":           4,
+		"load_5m_per_core":  1,
+		"load_15m":          2,
+		"load_15m_per_core": 0.5,
+	}, values)
+}
+
+func TestLoadCollector_Unavailable(t *testing.T) {
+	var mps mockPS
+	mps.On("Avg").Return(nil, errors.New("not implemented"))
+
+	c := &LoadCollector{ps: &mps}
+	_, err := c.CollectAll()
+	assert.Error(t, err)
+
+	discovered, err := c.Discover()
+	require.NoError(t, err)
+	assert.Empty(t, discovered)
+}
@@ -96,6 +96,19 @@ func getRate(key string) func(current, previous *memcachedStats) float64 {
 	}
 }
 
+// getHitRatio returns the share of hits among hits and misses since the
+// previous collection.
+func getHitRatio(hitsKey, missesKey string) func(current, previous *memcachedStats) float64 {
+	hits, misses := getRate(hitsKey), getRate(missesKey)
+	return func(current, previous *memcachedStats) float64 {
+		h, m := hits(current, previous), misses(current, previous)
+		if h+m == 0 {
+			return 0
+		}
+		return h / (h + m)
+	}
+}
+
 func getGauge(key string) func(current, previous *memcachedStats) float64 {
 	return func(current, previous *memcachedStats) float64 {
 		return current.Stats[key]
@@ -108,12 +121,14 @@ var memcachedMetrics = []struct {
 }{
 	{"memcached_connections_current_total", getGauge("curr_connections")},
 	{"memcached_connections_rate", getRate("total_connections")},
+	{"memcached_connections_rejected_rate", getRate("rejected_connections")},
 	{"memcached_items_current_total", getGauge("curr_items")},
 	{"memcached_items_rate", getRate("total_items")},
 	{"memcached_get_rate", getRate("cmd_get")},
 	{"memcached_set_rate", getRate("cmd_set")},
 	{"memcached_get_hits_rate", getRate("get_hits")},
 	{"memcached_get_misses_rate", getRate("get_misses")},
+	{"memcached_get_hits_ratio", getHitRatio("get_hits", "get_misses")},
 	{"memcached_delete_hits_rate", getRate("delete_hits")},
 	{"memcached_delete_misses_rate", getRate("delete_misses")},
 	{"memcached_incr_hits_rate", getRate("incr_hits")},
@@ -124,6 +139,13 @@ var memcachedMetrics = []struct {
 	{"memcached_written_bps", getRate("bytes_written")},
 	{"memcached_limit_bytes", getGauge("limit_maxbytes")},
 	{"memcached_used_bytes", getGauge("bytes")},
+	{"memcached_used_ratio", func(current, previous *memcachedStats) float64 {
+		if current.Stats["limit_maxbytes"] <= 0 {
+			return 0
+		}
+		return current.Stats["bytes"] / current.Stats["limit_maxbytes"]
+	}},
+	{"memcached_evictions_rate", getRate("evictions")},
 }
 
 func (c *MemcachedCollector) Collect() ([]metrics.DataPoint, error) {
@@ -188,15 +188,19 @@ func TestMemcachedCollector_CollectAll(t *testing.T) {
 	// Manually set lastStats Ts to 1 second ago for deterministic rate
 	mc.lastStats.Ts = dps1[0].Timestamp - 1000
 
+	assertContainsMetric(t, dps1, "memcached_get_hits_ratio", 0.0)
+
 	// Second collection
-	body2 := "STAT uptime 101\nSTAT cmd_get 60\nSTAT curr_items 50\nEND\n"
+	body2 := "STAT uptime 101\nSTAT cmd_get 60\nSTAT curr_items 50\nSTAT get_hits 8\nSTAT get_misses 2\nSTAT evictions 3\nEND\n"
 	mps.On("GetStats", mock.Anything).Return(body2, nil).Once()
 
 	dps2, err := mc.CollectAll()
 	require.NoError(t, err)
 
-	// Rate should be (60-50) / 1s = 10
-	assertContainsMetric(t, dps2, "memcached_get_rate", 10.0)
+	// Rate should be (60-50) / 1s = 10, a bit less as the clock ran since
+	assertRateMetric(t, dps2, "memcached_get_rate", 10.0)
+	assertContainsMetric(t, dps2, "memcached_get_hits_ratio", 0.8)
+	assertRateMetric(t, dps2, "memcached_evictions_rate", 3.0)
 	// total is no longer reported
 	for _, dp := range dps2 {
 		assert.NotEqual(t, "memcached_get_total", dp.Name)
@@ -223,3 +227,15 @@ func assertContainsMetric(t *testing.T, dps []metrics.DataPoint, name string, va
 	}
 	assert.Failf(t, "Metric not found", "Could not find metric %q", name)
 }
+
+// assertRateMetric checks a rate computed over the wall time elapsed between
+// two collections
+func assertRateMetric(t *testing.T, dps []metrics.DataPoint, name string, value float64) {
+	for _, dp := range dps {
+		if dp.Name == name {
+			assert.InEpsilon(t, value, dp.Value, 0.05, "Metric %s", name)
+			return
+		}
+	}
+	assert.Failf(t, "Metric not found", "Could not find metric %q", name)
+}
@@ -2,6 +2,7 @@ package memory
 
 import (
 	"fmt"
+	"runtime"
 	"time"
 
 	"github.com/shirou/gopsutil/v4/mem"
@@ -28,11 +29,23 @@ func (s *systemPS) SwapMemory() (*mem.SwapMemoryStat, error) {
 type MemoryCollector struct {
 	metrics.BaseCollector
 	ps MemoryPS
+	// linux enables the metrics only filled in from /proc/meminfo and
+	// /proc/vmstat, they would always be zero elsewhere
+	linux      bool
+	lastFaults *faultSample
+}
+
+// faultSample is the page fault counters at a point in time
+type faultSample struct {
+	ts    int64
+	minor uint64
+	major uint64
 }
 
 func NewMemoryCollector() *MemoryCollector {
 	return &MemoryCollector{
-		ps: &systemPS{},
+		ps:    &systemPS{},
+		linux: runtime.GOOS == "linux",
 	}
 }
 
@@ -52,6 +65,43 @@ var memMetrics = []struct {
 	{"mem_used_ratio", func(vm *mem.VirtualMemoryStat) float64 { return vm.UsedPercent / 100 }},
 }
 
+// linuxMemMetrics list the virtual memory metrics only available on Linux.
+// They tell the memory really used by processes apart from the caches the
+// kernel gives back under pressure.
+var linuxMemMetrics = []struct {
+	name     string
+	getValue func(*mem.VirtualMemoryStat) float64
+}{
+	{"mem_cached_bytes", func(vm *mem.VirtualMemoryStat) float64 { return float64(vm.Cached) }},
+	{"mem_buffers_bytes", func(vm *mem.VirtualMemoryStat) float64 { return float64(vm.Buffers) }},
+	{"mem_shared_bytes", func(vm *mem.VirtualMemoryStat) float64 { return float64(vm.Shared) }},
+	{"mem_dirty_bytes", func(vm *mem.VirtualMemoryStat) float64 { return float64(vm.Dirty) }},
+	{"mem_writeback_bytes", func(vm *mem.VirtualMemoryStat) float64 { return float64(vm.WriteBack) }},
+	{"mem_slab_bytes", func(vm *mem.VirtualMemoryStat) float64 { return float64(vm.Slab) }},
+	{"mem_slab_reclaimable_bytes", func(vm *mem.VirtualMemoryStat) float64 { return float64(vm.Sreclaimable) }},
+	{"mem_slab_unreclaimable_bytes", func(vm *mem.VirtualMemoryStat) float64 { return float64(vm.Sunreclaim) }},
+	{"mem_hugepages_total", func(vm *mem.VirtualMemoryStat) float64 { return float64(vm.HugePagesTotal) }},
+	{"mem_hugepages_free", func(vm *mem.VirtualMemoryStat) float64 { return float64(vm.HugePagesFree) }},
+	{"mem_hugepages_reserved", func(vm *mem.VirtualMemoryStat) float64 { return float64(vm.HugePagesRsvd) }},
+	{"mem_hugepage_size_bytes", func(vm *mem.VirtualMemoryStat) float64 { return float64(vm.HugePageSize) }},
+	{"mem_hugepages_used_bytes", func(vm *mem.VirtualMemoryStat) float64 {
+		if vm.HugePagesFree > vm.HugePagesTotal {
+			return 0
+		}
+		return float64((vm.HugePagesTotal - vm.HugePagesFree) * vm.HugePageSize)
+	}},
+}
+
+// faultMetrics list the page fault rates, computed between two collections.
+// Major faults are the ones that had to read from disk.
+var faultMetrics = []struct {
+	name     string
+	getValue func(*faultSample) uint64
+}{
+	{"mem_page_faults_rate", func(s *faultSample) uint64 { return s.minor }},
+	{"mem_major_page_faults_rate", func(s *faultSample) uint64 { return s.major }},
+}
+
 // swapMetrics list the available metrics inside the memory package (swap)
 var swapMetrics = []struct {
 	name     string
@@ -106,6 +156,40 @@ func (c *MemoryCollector) CollectAll() ([]metrics.DataPoint, error) {
 			Labels:    map[string]string{},
 		})
 	}
+	if !c.linux {
+		return results, nil
+	}
+
+	for _, m := range linuxMemMetrics {
+		results = append(results, metrics.DataPoint{
+			Name:      m.name,
+			Timestamp: timestamp,
+			Value:     m.getValue(vm),
+			Labels:    map[string]string{},
+		})
+	}
+
+	// Rates need two samples, none are reported on the first collection
+	current := &faultSample{ts: timestamp, minor: sm.PgFault, major: sm.PgMajFault}
+	previous := c.lastFaults
+	c.lastFaults = current
+	if previous == nil || current.ts <= previous.ts {
+		return results, nil
+	}
+	elapsed := float64(current.ts-previous.ts) / 1000
+	for _, m := range faultMetrics {
+		now, before := m.getValue(current), m.getValue(previous)
+		if now < before {
+			// Counter reset
+			before = 0
+		}
+		results = append(results, metrics.DataPoint{
+			Name:      m.name,
+			Timestamp: timestamp,
+			Value:     float64(now-before) / elapsed,
+			Labels:    map[string]string{},
+		})
+	}
 	return results, nil
 }
 
@@ -133,6 +217,24 @@ func (c *MemoryCollector) Discover() ([]collection.Metric, error) {
 			Labels: map[string]string{},
 		})
 	}
+	if !c.linux {
+		return discovered, nil
+	}
+
+	for _, m := range linuxMemMetrics {
+		discovered = append(discovered, collection.Metric{
+			Name:   m.name,
+			Type:   "gauge",
+			Labels: map[string]string{},
+		})
+	}
+	for _, m := range faultMetrics {
+		discovered = append(discovered, collection.Metric{
+			Name:   m.name,
+			Type:   "gauge",
+			Labels: map[string]string{},
+		})
+	}
 
 	return discovered, nil
 }
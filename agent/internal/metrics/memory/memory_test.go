@@ -74,6 +74,46 @@ func TestMemoryCollector(t *testing.T) {
 	assertContainsMetric(t, dps, "mem_swap_used_ratio", 0.25)
 }
 
+func TestMemoryCollector_Linux(t *testing.T) {
+	var mps mockPS
+	vm := &mem.VirtualMemoryStat{
+		Total:          16000000000,
+		Cached:         6000000000,
+		Buffers:        500000000,
+		Dirty:          1000000,
+		Slab:           300000000,
+		Sreclaimable:   200000000,
+		Sunreclaim:     100000000,
+		HugePagesTotal: 512,
+		HugePagesFree:  256,
+		HugePageSize:   2097152,
+	}
+	mps.On("VirtualMemory").Return(vm, nil)
+	mps.On("SwapMemory").Return(&mem.SwapMemoryStat{PgFault: 1000, PgMajFault: 10}, nil).Once()
+	mps.On("SwapMemory").Return(&mem.SwapMemoryStat{PgFault: 3000, PgMajFault: 30}, nil).Once()
+
+	c := &MemoryCollector{ps: &mps, linux: true}
+	dps, err := c.CollectAll()
+	require.NoError(t, err)
+
+	assertContainsMetric(t, dps, "mem_cached_bytes", 6000000000.0)
+	assertContainsMetric(t, dps, "mem_buffers_bytes", 500000000.0)
+	assertContainsMetric(t, dps, "mem_dirty_bytes", 1000000.0)
+	assertContainsMetric(t, dps, "mem_slab_reclaimable_bytes", 200000000.0)
+	assertContainsMetric(t, dps, "mem_slab_unreclaimable_bytes", 100000000.0)
+	assertContainsMetric(t, dps, "mem_hugepages_used_bytes", 256*2097152.0)
+	for _, dp := range dps {
+		assert.NotEqual(t, "mem_page_faults_rate", dp.Name, "rates need two collections")
+	}
+
+	// Pretend the first collection happened 10s ago
+	c.lastFaults.ts -= 10000
+	dps, err = c.CollectAll()
+	require.NoError(t, err)
+	assertContainsMetric(t, dps, "mem_page_faults_rate", 200.0)
+	assertContainsMetric(t, dps, "mem_major_page_faults_rate", 2.0)
+}
+
 func TestMemoryCollector_Errors(t *testing.T) {
 	t.Run("VirtualMemoryError", func(t *testing.T) {
 		var mps mockPS
@@ -109,6 +149,13 @@ func TestMemoryCollector_Discover(t *testing.T) {
 
 	// 5 mem metrics + 4 swap metrics = 9 metrics
 	assert.Equal(t, 9, len(discovered))
+
+	mps.On("VirtualMemory").Return(vm, nil).Once()
+	mps.On("SwapMemory").Return(sm, nil).Once()
+	c.linux = true
+	discovered, err = c.Discover()
+	require.NoError(t, err)
+	assert.Equal(t, 9+len(linuxMemMetrics)+len(faultMetrics), len(discovered))
 }
 
 func TestMemoryCollector_CollectFiltering(t *testing.T) {
@@ -0,0 +1,223 @@
+package mount
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shirou/gopsutil/v4/disk"
+
+	"agent/internal/collection"
+	"agent/internal/common"
+	"agent/internal/logger"
+	"agent/internal/metrics"
+)
+
+// probeTimeout bounds how long a mount is given to answer before it is
+// reported unreachable.
+const probeTimeout = 2 * time.Second
+
+// errProbeHung is returned while a previous probe of the mount is still
+// blocked in the kernel.
+var errProbeHung = errors.New("previous probe still pending")
+
+var networkFilesystems = map[string]struct{}{
+	"nfs":        {},
+	"nfs4":       {},
+	"cifs":       {},
+	"smb3":       {},
+	"smbfs":      {},
+	"9p":         {},
+	"afs":        {},
+	"ceph":       {},
+	"glusterfs":  {},
+	"lustre":     {},
+	"fuse.sshfs": {},
+	"fuse.s3fs":  {},
+}
+
+// IsNetworkFilesystem reports whether fstype is served over the network.
+// Calls on such mounts can block indefinitely when the server goes away.
+func IsNetworkFilesystem(fstype string) bool {
+	_, ok := networkFilesystems[strings.ToLower(fstype)]
+	return ok
+}
+
+type MountPS interface {
+	Partitions(all bool) ([]disk.PartitionStat, error)
+	// Probe performs a filesystem operation that requires the server to
+	// answer. It may block forever on a hard NFS mount.
+	Probe(path string) error
+}
+
+type systemPS struct{}
+
+func (s *systemPS) Partitions(all bool) ([]disk.PartitionStat, error) {
+	return disk.Partitions(all)
+}
+
+func (s *systemPS) Probe(path string) error {
+	_, err := disk.Usage(path)
+	return err
+}
+
+// MountCollector checks that network filesystem mounts (NFS, CIFS...) still
+// answer. Each probe runs in its own goroutine so a stale mount never blocks
+// the collection cycle.
+type MountCollector struct {
+	metrics.BaseCollector
+
+	ps      MountPS
+	timeout time.Duration
+
+	mu sync.Mutex
+	// pending tracks the mounts with a probe still blocked, no new probe is
+	// started on them until it returns.
+	pending map[string]struct{}
+}
+
+func NewMountCollector() *MountCollector {
+	return &MountCollector{
+		ps:      &systemPS{},
+		timeout: probeTimeout,
+		pending: make(map[string]struct{}),
+	}
+}
+
+func (c *MountCollector) Name() string {
+	return "mount"
+}
+
+func (c *MountCollector) Collect() ([]metrics.DataPoint, error) {
+	all, err := c.CollectAll()
+	if err != nil {
+		return nil, err
+	}
+	var included []metrics.DataPoint
+	for _, dp := range all {
+		if c.IsIncluded(dp.Name, dp.Labels) {
+			included = append(included, dp)
+		}
+	}
+	return included, nil
+}
+
+func (c *MountCollector) CollectAll() ([]metrics.DataPoint, error) {
+	timestamp := time.Now().UnixMilli()
+	mounts, err := c.networkMounts()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list mounts: %w", err)
+	}
+
+	type result struct {
+		mount   disk.PartitionStat
+		latency time.Duration
+		err     error
+	}
+	results := make([]result, len(mounts))
+	var wg sync.WaitGroup
+	for i, m := range mounts {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			latency, err := c.probe(common.HostPath(m.Mountpoint))
+			results[i] = result{mount: m, latency: latency, err: err}
+		}()
+	}
+	wg.Wait()
+
+	var datapoints []metrics.DataPoint
+	for _, r := range results {
+		labels := map[string]string{
+			"device":     r.mount.Device,
+			"mountpoint": r.mount.Mountpoint,
+			"fstype":     r.mount.Fstype,
+		}
+		reachable := 1.0
+		if r.err != nil {
+			logger.Log.Debug("Mount is not responding", "collector", c.Name(), "mountpoint", r.mount.Mountpoint, "error", r.err)
+			reachable = 0
+		}
+		datapoints = append(datapoints, metrics.DataPoint{
+			Name:      "mount_reachable",
+			Timestamp: timestamp,
+			Value:     reachable,
+			Labels:    labels,
+		})
+		if r.err == nil {
+			datapoints = append(datapoints, metrics.DataPoint{
+				Name:      "mount_stat_latency_ms",
+				Timestamp: timestamp,
+				Value:     float64(r.latency.Microseconds()) / 1000,
+				Labels:    labels,
+			})
+		}
+	}
+	return datapoints, nil
+}
+
+func (c *MountCollector) Discover() ([]collection.Metric, error) {
+	mounts, err := c.networkMounts()
+	if err != nil {
+		return nil, err
+	}
+	discovered := []collection.Metric{}
+	for _, m := range mounts {
+		labels := map[string]string{
+			"device":     m.Device,
+			"mountpoint": m.Mountpoint,
+			"fstype":     m.Fstype,
+		}
+		for _, name := range []string{"mount_reachable", "mount_stat_latency_ms"} {
+			discovered = append(discovered, collection.Metric{Name: name, Type: "gauge", Labels: labels})
+		}
+	}
+	return discovered, nil
+}
+
+func (c *MountCollector) networkMounts() ([]disk.PartitionStat, error) {
+	// Network filesystems are "nodev" and only listed with all=true
+	partitions, err := c.ps.Partitions(true)
+	if err != nil {
+		return nil, err
+	}
+	var mounts []disk.PartitionStat
+	for _, p := range partitions {
+		if IsNetworkFilesystem(p.Fstype) {
+			mounts = append(mounts, p)
+		}
+	}
+	return mounts, nil
+}
+
+// probe times a Probe call on path, giving up after the collector timeout.
+// The call itself cannot be interrupted, a timed out probe keeps its
+// goroutine until the kernel returns.
+func (c *MountCollector) probe(path string) (time.Duration, error) {
+	c.mu.Lock()
+	if _, ok := c.pending[path]; ok {
+		c.mu.Unlock()
+		return 0, errProbeHung
+	}
+	c.pending[path] = struct{}{}
+	c.mu.Unlock()
+
+	done := make(chan error, 1)
+	start := time.Now()
+	go func() {
+		err := c.ps.Probe(path)
+		c.mu.Lock()
+		delete(c.pending, path)
+		c.mu.Unlock()
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		return time.Since(start), err
+	case <-time.After(c.timeout):
+		return 0, fmt.Errorf("no answer after %s", c.timeout)
+	}
+}
@@ -0,0 +1,114 @@
+package mount
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/shirou/gopsutil/v4/disk"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"agent/internal/logger"
+	"agent/internal/metrics"
+)
+
+func init() {
+	logger.Log = slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+type mockPS struct {
+	mock.Mock
+}
+
+func (m *mockPS) Partitions(all bool) ([]disk.PartitionStat, error) {
+	args := m.Called(all)
+	partitions, _ := args.Get(0).([]disk.PartitionStat)
+	return partitions, args.Error(1)
+}
+
+func (m *mockPS) Probe(path string) error {
+	return m.Called(path).Error(0)
+}
+
+var partitions = []disk.PartitionStat{
+	{Device: "/dev/sda1", Mountpoint: "/", Fstype: "ext4"},
+	{Device: "nas:/export/home", Mountpoint: "/home", Fstype: "nfs4"},
+	{Device: "nas:/export/stale", Mountpoint: "/mnt/stale", Fstype: "nfs"},
+	{Device: "//fs/share", Mountpoint: "/mnt/share", Fstype: "cifs"},
+}
+
+func findPoint(dps []metrics.DataPoint, name, mountpoint string) (metrics.DataPoint, bool) {
+	for _, dp := range dps {
+		if dp.Name == name && dp.Labels["mountpoint"] == mountpoint {
+			return dp, true
+		}
+	}
+	return metrics.DataPoint{}, false
+}
+
+func TestMountCollector(t *testing.T) {
+	block := make(chan time.Time)
+	defer close(block)
+
+	var mps mockPS
+	mps.On("Partitions", true).Return(partitions, nil)
+	mps.On("Probe", "/home").Return(nil)
+	mps.On("Probe", "/mnt/stale").WaitUntil(block).Return(nil)
+	mps.On("Probe", "/mnt/share").Return(errors.New("stale file handle"))
+
+	c := NewMountCollector()
+	c.ps = &mps
+	c.timeout = 50 * time.Millisecond
+
+	start := time.Now()
+	dps, err := c.CollectAll()
+	require.NoError(t, err)
+	assert.Less(t, time.Since(start), time.Second, "a hung mount must not block the collection")
+
+	home, ok := findPoint(dps, "mount_reachable", "/home")
+	require.True(t, ok)
+	assert.Equal(t, 1.0, home.Value)
+	assert.Equal(t, "nfs4", home.Labels["fstype"])
+	_, ok = findPoint(dps, "mount_stat_latency_ms", "/home")
+	assert.True(t, ok)
+
+	for _, mnt := range []string{"/mnt/stale", "/mnt/share"} {
+		dp, ok := findPoint(dps, "mount_reachable", mnt)
+		require.True(t, ok)
+		assert.Equal(t, 0.0, dp.Value)
+		_, ok = findPoint(dps, "mount_stat_latency_ms", mnt)
+		assert.False(t, ok)
+	}
+	_, ok = findPoint(dps, "mount_reachable", "/")
+	assert.False(t, ok, "local filesystems are skipped")
+
+	// The hung probe is not started again while it is pending
+	dps, err = c.CollectAll()
+	require.NoError(t, err)
+	dp, _ := findPoint(dps, "mount_reachable", "/mnt/stale")
+	assert.Equal(t, 0.0, dp.Value)
+	mps.AssertNumberOfCalls(t, "Probe", 5)
+}
+
+func TestMountCollectorDiscover(t *testing.T) {
+	var mps mockPS
+	mps.On("Partitions", true).Return(partitions, nil)
+
+	c := NewMountCollector()
+	c.ps = &mps
+	discovered, err := c.Discover()
+	require.NoError(t, err)
+	assert.Len(t, discovered, 6)
+	mps.AssertNotCalled(t, "Probe", mock.Anything)
+}
+
+func TestIsNetworkFilesystem(t *testing.T) {
+	assert.True(t, IsNetworkFilesystem("NFS4"))
+	assert.True(t, IsNetworkFilesystem("fuse.sshfs"))
+	assert.False(t, IsNetworkFilesystem("ext4"))
+	assert.False(t, IsNetworkFilesystem("tmpfs"))
+}
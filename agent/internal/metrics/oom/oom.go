@@ -0,0 +1,163 @@
+package oom
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"agent/internal/collection"
+	"agent/internal/common"
+	"agent/internal/metrics"
+	"agent/internal/oomkill"
+)
+
+type OOMPS interface {
+	// HostKills returns the number of OOM kills since boot
+	HostKills() (float64, error)
+	// Kills returns the kills observed since the previous call
+	Kills() []oomkill.Kill
+}
+
+type systemPS struct {
+	mu  sync.Mutex
+	sub *oomkill.Subscription
+}
+
+func (s *systemPS) HostKills() (float64, error) {
+	f, err := os.Open(common.HostPath("/proc/vmstat"))
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if value, ok := strings.CutPrefix(scanner.Text(), "oom_kill "); ok {
+			return strconv.ParseFloat(value, 64)
+		}
+	}
+	return 0, fmt.Errorf("oom_kill not found in /proc/vmstat")
+}
+
+func (s *systemPS) Kills() []oomkill.Kill {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// The kernel log is followed from the first call on
+	if s.sub == nil {
+		if !oomkill.Available() {
+			return nil
+		}
+		s.sub = oomkill.Subscribe()
+	}
+	var kills []oomkill.Kill
+	for {
+		select {
+		case kill := <-s.sub.C:
+			kills = append(kills, kill)
+		default:
+			return kills
+		}
+	}
+}
+
+// victim identifies the processes killed by the OOM killer
+type victim struct {
+	process string
+	cgroup  string
+}
+
+// OOMCollector counts the OOM kills, for the whole host and per victim
+// process and cgroup so that memory related restarts are visible.
+type OOMCollector struct {
+	metrics.BaseCollector
+
+	ps      OOMPS
+	mu      sync.Mutex
+	victims map[victim]float64
+}
+
+func NewOOMCollector() *OOMCollector {
+	return &OOMCollector{
+		ps:      &systemPS{},
+		victims: make(map[victim]float64),
+	}
+}
+
+func (c *OOMCollector) Name() string {
+	return "oom"
+}
+
+func (c *OOMCollector) Collect() ([]metrics.DataPoint, error) {
+	all, err := c.CollectAll()
+	if err != nil {
+		return nil, err
+	}
+	var included []metrics.DataPoint
+	for _, dp := range all {
+		if c.IsIncluded(dp.Name, dp.Labels) {
+			included = append(included, dp)
+		}
+	}
+	return included, nil
+}
+
+func (c *OOMCollector) CollectAll() ([]metrics.DataPoint, error) {
+	timestamp := time.Now().UnixMilli()
+	var results []metrics.DataPoint
+	if total, err := c.ps.HostKills(); err == nil {
+		results = append(results, metrics.DataPoint{
+			Name:      "oom_kills_total",
+			Timestamp: timestamp,
+			Value:     total,
+			Labels:    map[string]string{},
+		})
+	}
+	for v, count := range c.updateVictims() {
+		results = append(results, metrics.DataPoint{
+			Name:      "oom_victim_kills_total",
+			Timestamp: timestamp,
+			Value:     count,
+			Labels:    map[string]string{"process": v.process, "cgroup": v.cgroup},
+		})
+	}
+	return results, nil
+}
+
+// Discover reports the host counter and the victims seen so far, the
+// following ones are reported by the next discovery.
+func (c *OOMCollector) Discover() ([]collection.Metric, error) {
+	discovered := []collection.Metric{}
+	if _, err := c.ps.HostKills(); err != nil {
+		return discovered, nil
+	}
+	discovered = append(discovered, collection.Metric{
+		Name:   "oom_kills_total",
+		Type:   "gauge",
+		Labels: map[string]string{},
+	})
+	for v := range c.updateVictims() {
+		discovered = append(discovered, collection.Metric{
+			Name:   "oom_victim_kills_total",
+			Type:   "gauge",
+			Labels: map[string]string{"process": v.process, "cgroup": v.cgroup},
+		})
+	}
+	return discovered, nil
+}
+
+// updateVictims counts the new kills and returns a copy of the counters
+func (c *OOMCollector) updateVictims() map[victim]float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, kill := range c.ps.Kills() {
+		c.victims[victim{process: kill.Process, cgroup: kill.CgroupLabel()}]++
+	}
+	counts := make(map[victim]float64, len(c.victims))
+	for v, count := range c.victims {
+		counts[v] = count
+	}
+	return counts
+}
@@ -0,0 +1,93 @@
+package oom
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"agent/internal/metrics"
+	"agent/internal/oomkill"
+)
+
+type mockPS struct {
+	mock.Mock
+}
+
+func (m *mockPS) HostKills() (float64, error) {
+	args := m.Called()
+	return args.Get(0).(float64), args.Error(1)
+}
+
+func (m *mockPS) Kills() []oomkill.Kill {
+	args := m.Called()
+	kills, _ := args.Get(0).([]oomkill.Kill)
+	return kills
+}
+
+func findPoint(dps []metrics.DataPoint, name string, labels map[string]string) (metrics.DataPoint, bool) {
+	for _, dp := range dps {
+		if dp.Name == name && assert.ObjectsAreEqual(labels, dp.Labels) {
+			return dp, true
+		}
+	}
+	return metrics.DataPoint{}, false
+}
+
+func TestOOMCollector(t *testing.T) {
+	var mps mockPS
+	mps.On("HostKills").Return(3.0, nil)
+	mps.On("Kills").Return([]oomkill.Kill{
+		{Process: "java", Cgroup: "/system.slice/app.service"},
+		{Process: "java", Cgroup: "/system.slice/app.service"},
+		{Process: "node"},
+	}).Once()
+	mps.On("Kills").Return(nil)
+
+	c := NewOOMCollector()
+	c.ps = &mps
+
+	dps, err := c.CollectAll()
+	require.NoError(t, err)
+	require.Len(t, dps, 3)
+
+	dp, ok := findPoint(dps, "oom_kills_total", map[string]string{})
+	require.True(t, ok)
+	assert.Equal(t, 3.0, dp.Value)
+	dp, ok = findPoint(dps, "oom_victim_kills_total", map[string]string{"process": "java", "cgroup": "/system.slice/app.service"})
+	require.True(t, ok)
+	assert.Equal(t, 2.0, dp.Value)
+	dp, ok = findPoint(dps, "oom_victim_kills_total", map[string]string{"process": "node", "cgroup": "unknown"})
+	require.True(t, ok)
+	assert.Equal(t, 1.0, dp.Value)
+
+	// Counters are kept between collections
+	dps, err = c.CollectAll()
+	require.NoError(t, err)
+	dp, ok = findPoint(dps, "oom_victim_kills_total", map[string]string{"process": "java", "cgroup": "/system.slice/app.service"})
+	require.True(t, ok)
+	assert.Equal(t, 2.0, dp.Value)
+
+	discovered, err := c.Discover()
+	require.NoError(t, err)
+	assert.Len(t, discovered, 3)
+}
+
+func TestOOMCollectorUnsupported(t *testing.T) {
+	var mps mockPS
+	mps.On("HostKills").Return(0.0, errors.New("no vmstat"))
+	mps.On("Kills").Return(nil)
+
+	c := NewOOMCollector()
+	c.ps = &mps
+
+	dps, err := c.CollectAll()
+	require.NoError(t, err)
+	assert.Empty(t, dps)
+
+	discovered, err := c.Discover()
+	require.NoError(t, err)
+	assert.Empty(t, discovered)
+}
@@ -0,0 +1,16 @@
+//go:build !windows
+// +build !windows
+
+package perfmon
+
+import "errors"
+
+type systemReader struct{}
+
+func newSystemReader() CounterReader {
+	return &systemReader{}
+}
+
+func (r *systemReader) Read(paths []string) (map[string][]counterValue, error) {
+	return nil, errors.New("performance counters are only available on Windows")
+}
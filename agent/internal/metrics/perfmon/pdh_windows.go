@@ -0,0 +1,147 @@
+//go:build windows
+
+package perfmon
+
+import (
+	"fmt"
+	"sync"
+	"time"
+	"unsafe"
+
+	"agent/internal/logger"
+
+	"golang.org/x/sys/windows"
+)
+
+const (
+	pdhFmtDouble    = 0x00000200
+	pdhFmtNoCap100  = 0x00008000
+	pdhMoreData     = 0x800007D2
+	pdhCStatusValid = 0x00000000
+	pdhCStatusNew   = 0x00000001
+)
+
+var (
+	modpdh                          = windows.NewLazySystemDLL("pdh.dll")
+	procPdhOpenQueryW               = modpdh.NewProc("PdhOpenQueryW")
+	procPdhAddEnglishCounterW       = modpdh.NewProc("PdhAddEnglishCounterW")
+	procPdhCollectQueryData         = modpdh.NewProc("PdhCollectQueryData")
+	procPdhGetFormattedCounterArray = modpdh.NewProc("PdhGetFormattedCounterArrayW")
+)
+
+type pdhFmtCounterValueDouble struct {
+	CStatus     uint32
+	DoubleValue float64
+}
+
+type pdhFmtCounterValueItemDouble struct {
+	SzName   *uint16
+	FmtValue pdhFmtCounterValueDouble
+}
+
+// systemReader keeps a PDH query open between collections. Rate counters
+// (e.g. % Processor Time) are computed by PDH from two consecutive samples.
+type systemReader struct {
+	mu       sync.Mutex
+	query    uintptr
+	counters map[string]uintptr
+	primedAt time.Time
+}
+
+func newSystemReader() CounterReader {
+	return &systemReader{counters: make(map[string]uintptr)}
+}
+
+func (r *systemReader) Read(paths []string) (map[string][]counterValue, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.query == 0 {
+		var query uintptr
+		if ret, _, _ := procPdhOpenQueryW.Call(0, 0, uintptr(unsafe.Pointer(&query))); ret != 0 {
+			return nil, fmt.Errorf("PdhOpenQuery failed: 0x%x", ret)
+		}
+		r.query = query
+	}
+
+	added := false
+	for _, path := range paths {
+		if _, ok := r.counters[path]; ok {
+			continue
+		}
+		pathPtr, err := windows.UTF16PtrFromString(path)
+		if err != nil {
+			continue
+		}
+		var handle uintptr
+		ret, _, _ := procPdhAddEnglishCounterW.Call(r.query, uintptr(unsafe.Pointer(pathPtr)), 0, uintptr(unsafe.Pointer(&handle)))
+		if ret != 0 {
+			logger.Log.Warn("Failed to add perfmon counter", "path", path, "status", fmt.Sprintf("0x%x", ret))
+			// Remember the failure to avoid retrying on every collection
+			r.counters[path] = 0
+			continue
+		}
+		r.counters[path] = handle
+		added = true
+	}
+
+	// New counters need a first sample before rates can be computed
+	if added {
+		procPdhCollectQueryData.Call(r.query)
+		r.primedAt = time.Now()
+	}
+	if wait := time.Second - time.Since(r.primedAt); wait > 0 {
+		time.Sleep(wait)
+	}
+
+	if ret, _, _ := procPdhCollectQueryData.Call(r.query); ret != 0 {
+		return nil, fmt.Errorf("PdhCollectQueryData failed: 0x%x", ret)
+	}
+
+	results := make(map[string][]counterValue, len(paths))
+	for _, path := range paths {
+		handle := r.counters[path]
+		if handle == 0 {
+			continue
+		}
+		values, err := formattedValues(handle)
+		if err != nil {
+			logger.Log.Debug("Failed to read perfmon counter", "path", path, "error", err)
+			continue
+		}
+		results[path] = values
+	}
+	return results, nil
+}
+
+func formattedValues(handle uintptr) ([]counterValue, error) {
+	var size, count uint32
+	ret, _, _ := procPdhGetFormattedCounterArray.Call(handle, pdhFmtDouble|pdhFmtNoCap100,
+		uintptr(unsafe.Pointer(&size)), uintptr(unsafe.Pointer(&count)), 0)
+	if ret != pdhMoreData {
+		return nil, fmt.Errorf("PdhGetFormattedCounterArray failed: 0x%x", ret)
+	}
+	if size == 0 || count == 0 {
+		return nil, nil
+	}
+
+	buf := make([]byte, size)
+	ret, _, _ = procPdhGetFormattedCounterArray.Call(handle, pdhFmtDouble|pdhFmtNoCap100,
+		uintptr(unsafe.Pointer(&size)), uintptr(unsafe.Pointer(&count)), uintptr(unsafe.Pointer(&buf[0])))
+	if ret != 0 {
+		return nil, fmt.Errorf("PdhGetFormattedCounterArray failed: 0x%x", ret)
+	}
+
+	items := unsafe.Slice((*pdhFmtCounterValueItemDouble)(unsafe.Pointer(&buf[0])), count)
+	values := make([]counterValue, 0, count)
+	for _, item := range items {
+		if item.FmtValue.CStatus != pdhCStatusValid && item.FmtValue.CStatus != pdhCStatusNew {
+			continue
+		}
+		values = append(values, counterValue{
+			Instance: windows.UTF16PtrToString(item.SzName),
+			Value:    item.FmtValue.DoubleValue,
+		})
+	}
+	return values, nil
+}
@@ -0,0 +1,177 @@
+package perfmon
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"agent/internal/collection"
+	"agent/internal/config"
+	"agent/internal/logger"
+	"agent/internal/metrics"
+)
+
+// counterValue is the value of a counter for one instance. Instance is empty
+// for single instance objects (e.g. \Memory\Available Bytes).
+type counterValue struct {
+	Instance string
+	Value    float64
+}
+
+type CounterReader interface {
+	// Read samples the counters and returns the values of each path.
+	// Paths that can't be read are missing from the result.
+	Read(paths []string) (map[string][]counterValue, error)
+}
+
+type counter struct {
+	path string
+	name string
+}
+
+// PerfmonCollector reads arbitrary Windows performance counters listed in the
+// agent config, so anything visible in PerfMon can be captured without a
+// dedicated collector.
+type PerfmonCollector struct {
+	metrics.BaseCollector
+
+	reader   CounterReader
+	counters []counter
+}
+
+func NewPerfmonCollector(cfg *config.Config) *PerfmonCollector {
+	return newPerfmonCollector(newSystemReader(), cfg.PerfmonCounters)
+}
+
+func newPerfmonCollector(reader CounterReader, configured []config.PerfmonCounter) *PerfmonCollector {
+	c := &PerfmonCollector{reader: reader}
+	for _, pc := range configured {
+		name := pc.Name
+		if name == "" {
+			object, _, counterName, err := parsePath(pc.Path)
+			if err != nil {
+				logger.Log.Warn("Skipping invalid perfmon counter", "path", pc.Path, "error", err)
+				continue
+			}
+			name = object + "_" + counterName
+		}
+		c.counters = append(c.counters, counter{path: pc.Path, name: "perfmon_" + sanitize(name)})
+	}
+	return c
+}
+
+func (c *PerfmonCollector) Name() string {
+	return "perfmon"
+}
+
+func (c *PerfmonCollector) Collect() ([]metrics.DataPoint, error) {
+	all, err := c.CollectAll()
+	if err != nil {
+		return nil, err
+	}
+	var included []metrics.DataPoint
+	for _, dp := range all {
+		if c.IsIncluded(dp.Name, dp.Labels) {
+			included = append(included, dp)
+		}
+	}
+	return included, nil
+}
+
+func (c *PerfmonCollector) CollectAll() ([]metrics.DataPoint, error) {
+	if len(c.counters) == 0 {
+		return nil, nil
+	}
+	timestamp := time.Now().UnixMilli()
+
+	paths := make([]string, 0, len(c.counters))
+	for _, ctr := range c.counters {
+		paths = append(paths, ctr.path)
+	}
+	values, err := c.reader.Read(paths)
+	if err != nil {
+		logger.Log.Debug("Failed to collect metrics", "collector", c.Name(), "error", err)
+		return nil, nil
+	}
+
+	var results []metrics.DataPoint
+	for _, ctr := range c.counters {
+		for _, v := range values[ctr.path] {
+			labels := map[string]string{}
+			if v.Instance != "" {
+				labels["instance"] = v.Instance
+			}
+			results = append(results, metrics.DataPoint{
+				Name:      ctr.name,
+				Timestamp: timestamp,
+				Value:     v.Value,
+				Labels:    labels,
+			})
+		}
+	}
+	return results, nil
+}
+
+func (c *PerfmonCollector) Discover() ([]collection.Metric, error) {
+	dps, err := c.CollectAll()
+	if err != nil {
+		return nil, nil
+	}
+	var discovered []collection.Metric
+	for _, dp := range dps {
+		discovered = append(discovered, collection.Metric{
+			Name:   dp.Name,
+			Type:   "gauge",
+			Labels: dp.Labels,
+		})
+	}
+	return discovered, nil
+}
+
+// parsePath splits a counter path (\\machine\Object(Instance)\Counter) into
+// its components. The machine and the instance are optional.
+func parsePath(path string) (object, instance, counterName string, err error) {
+	p := path
+	if strings.HasPrefix(p, `\\`) {
+		// Remote machine, skip it
+		rest := p[2:]
+		i := strings.IndexByte(rest, '\\')
+		if i < 0 {
+			return "", "", "", fmt.Errorf("invalid counter path %q", path)
+		}
+		p = rest[i:]
+	}
+	if !strings.HasPrefix(p, `\`) {
+		return "", "", "", fmt.Errorf("counter path must start with a backslash: %q", path)
+	}
+	p = p[1:]
+
+	i := strings.LastIndexByte(p, '\\')
+	if i <= 0 || i == len(p)-1 {
+		return "", "", "", fmt.Errorf("invalid counter path %q", path)
+	}
+	object, counterName = p[:i], p[i+1:]
+	if open := strings.IndexByte(object, '('); open >= 0 && strings.HasSuffix(object, ")") {
+		instance = object[open+1 : len(object)-1]
+		object = object[:open]
+	}
+	return object, instance, counterName, nil
+}
+
+// sanitize converts a counter name to the agent metric naming, e.g.
+// "Processor_% Processor Time" to "processor_percent_processor_time".
+func sanitize(name string) string {
+	name = strings.NewReplacer("%", " percent ", "/", " per ", "#", " number ").Replace(strings.ToLower(name))
+	var b strings.Builder
+	lastUnderscore := true
+	for _, r := range name {
+		if r >= 'a' && r <= 'z' || r >= '0' && r <= '9' {
+			b.WriteRune(r)
+			lastUnderscore = false
+		} else if !lastUnderscore {
+			b.WriteByte('_')
+			lastUnderscore = true
+		}
+	}
+	return strings.TrimSuffix(b.String(), "_")
+}
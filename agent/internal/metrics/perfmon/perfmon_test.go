@@ -0,0 +1,128 @@
+package perfmon
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"agent/internal/collection"
+	"agent/internal/config"
+	"agent/internal/logger"
+	"agent/internal/metrics"
+)
+
+func init() {
+	logger.Log = slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+type mockReader struct {
+	mock.Mock
+}
+
+func (m *mockReader) Read(paths []string) (map[string][]counterValue, error) {
+	args := m.Called(paths)
+	values, _ := args.Get(0).(map[string][]counterValue)
+	return values, args.Error(1)
+}
+
+func TestParsePath(t *testing.T) {
+	tests := []struct {
+		path                        string
+		object, instance, counterNm string
+		wantErr                     bool
+	}{
+		{path: `\Processor(_Total)\% Processor Time`, object: "Processor", instance: "_Total", counterNm: "% Processor Time"},
+		{path: `\Memory\Available Bytes`, object: "Memory", counterNm: "Available Bytes"},
+		{path: `\\SQL01\SQLServer:Buffer Manager\Page life expectancy`, object: "SQLServer:Buffer Manager", counterNm: "Page life expectancy"},
+		{path: `\Network Interface(*)\Bytes Received/sec`, object: "Network Interface", instance: "*", counterNm: "Bytes Received/sec"},
+		{path: `Memory\Available Bytes`, wantErr: true},
+		{path: `\Memory`, wantErr: true},
+	}
+	for _, tt := range tests {
+		object, instance, counterName, err := parsePath(tt.path)
+		if tt.wantErr {
+			assert.Error(t, err, tt.path)
+			continue
+		}
+		require.NoError(t, err, tt.path)
+		assert.Equal(t, tt.object, object)
+		assert.Equal(t, tt.instance, instance)
+		assert.Equal(t, tt.counterNm, counterName)
+	}
+}
+
+func TestSanitize(t *testing.T) {
+	assert.Equal(t, "processor_percent_processor_time", sanitize("Processor_% Processor Time"))
+	assert.Equal(t, "network_interface_bytes_received_per_sec", sanitize("Network Interface_Bytes Received/sec"))
+	assert.Equal(t, "sqlserver_buffer_manager_page_life_expectancy", sanitize("SQLServer:Buffer Manager_Page life expectancy"))
+}
+
+func TestPerfmonCollector(t *testing.T) {
+	cpuPath := `\Processor(*)\% Processor Time`
+	memPath := `\Memory\Available Bytes`
+	plePath := `\SQLServer:Buffer Manager\Page life expectancy`
+
+	var reader mockReader
+	defer reader.AssertExpectations(t)
+	reader.On("Read", []string{cpuPath, memPath, plePath}).Return(map[string][]counterValue{
+		cpuPath: {{Instance: "0", Value: 12.5}, {Instance: "_Total", Value: 10}},
+		memPath: {{Value: 2048}},
+	}, nil)
+
+	c := newPerfmonCollector(&reader, []config.PerfmonCounter{
+		{Path: cpuPath},
+		{Path: memPath, Name: "mem_available_bytes"},
+		{Path: plePath},
+		{Path: "invalid"},
+	})
+
+	dps, err := c.CollectAll()
+	require.NoError(t, err)
+	require.Len(t, dps, 3)
+
+	assertPoint(t, dps, "perfmon_processor_percent_processor_time", map[string]string{"instance": "0"}, 12.5)
+	assertPoint(t, dps, "perfmon_processor_percent_processor_time", map[string]string{"instance": "_Total"}, 10)
+	assertPoint(t, dps, "perfmon_mem_available_bytes", map[string]string{}, 2048)
+}
+
+func TestPerfmonCollector_ReadError(t *testing.T) {
+	var reader mockReader
+	reader.On("Read", mock.Anything).Return(nil, errors.New("unavailable"))
+
+	c := newPerfmonCollector(&reader, []config.PerfmonCounter{{Path: `\Memory\Available Bytes`}})
+	dps, err := c.CollectAll()
+	require.NoError(t, err)
+	assert.Empty(t, dps)
+}
+
+func TestPerfmonCollector_Discover(t *testing.T) {
+	var reader mockReader
+	reader.On("Read", mock.Anything).Return(map[string][]counterValue{
+		`\Memory\Available Bytes`: {{Value: 2048}},
+	}, nil)
+
+	c := newPerfmonCollector(&reader, []config.PerfmonCounter{{Path: `\Memory\Available Bytes`}})
+	discovered, err := c.Discover()
+	require.NoError(t, err)
+	assert.Equal(t, []collection.Metric{{
+		Name:   "perfmon_memory_available_bytes",
+		Type:   "gauge",
+		Labels: map[string]string{},
+	}}, discovered)
+}
+
+func assertPoint(t *testing.T, dps []metrics.DataPoint, name string, labels map[string]string, value float64) {
+	t.Helper()
+	for _, dp := range dps {
+		if dp.Name == name && assert.ObjectsAreEqual(labels, dp.Labels) {
+			assert.Equal(t, value, dp.Value)
+			return
+		}
+	}
+	t.Errorf("data point %s %v not found", name, labels)
+}
@@ -0,0 +1,285 @@
+package process
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"regexp"
+	"runtime"
+	"slices"
+	"time"
+
+	"github.com/shirou/gopsutil/v4/process"
+
+	"agent/internal/collection"
+	"agent/internal/config"
+	"agent/internal/logger"
+	"agent/internal/metrics"
+)
+
+// defaultTopN is the number of processes reported by CPU and by memory
+const defaultTopN = 5
+
+// sample is the state of a process at a collection
+type sample struct {
+	PID  int32
+	Name string
+	// Cmdline tells apart the processes with the same name, e.g. two Java
+	// applications
+	Cmdline    string
+	CreateTime int64
+	// CPUSeconds is the user and system time used since the start
+	CPUSeconds float64
+	RSS        float64
+	// FDs is -1 when the open files can't be counted, e.g. for the
+	// processes of other users
+	FDs     float64
+	Threads float64
+}
+
+type ProcessPS interface {
+	Processes() ([]sample, error)
+}
+
+type systemPS struct{}
+
+func (s *systemPS) Processes() ([]sample, error) {
+	procs, err := process.Processes()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list processes: %w", err)
+	}
+	samples := make([]sample, 0, len(procs))
+	for _, p := range procs {
+		name, err := p.Name()
+		if err != nil {
+			// The process exited meanwhile
+			continue
+		}
+		smp := sample{PID: p.Pid, Name: name, FDs: -1}
+		smp.Cmdline, _ = p.Cmdline()
+		smp.CreateTime, _ = p.CreateTime()
+		if times, err := p.Times(); err == nil {
+			smp.CPUSeconds = times.User + times.System
+		}
+		if mem, err := p.MemoryInfo(); err == nil {
+			smp.RSS = float64(mem.RSS)
+		}
+		if fds, err := p.NumFDs(); err == nil {
+			smp.FDs = float64(fds)
+		}
+		if threads, err := p.NumThreads(); err == nil {
+			smp.Threads = float64(threads)
+		}
+		samples = append(samples, smp)
+	}
+	return samples, nil
+}
+
+// usage is a process with its CPU usage over the last interval
+type usage struct {
+	sample
+	cpuRatio float64
+}
+
+// processMetrics are reported for the top processes, labelled with the name
+// and id of the process, and summed for the tracked groups
+var processMetrics = []struct {
+	name     string
+	getValue func(usage) (float64, bool)
+}{
+	{"cpu_ratio", func(u usage) (float64, bool) { return u.cpuRatio, true }},
+	{"memory_rss_bytes", func(u usage) (float64, bool) { return u.RSS, true }},
+	{"open_fds", func(u usage) (float64, bool) { return u.FDs, u.FDs >= 0 }},
+	{"threads", func(u usage) (float64, bool) { return u.Threads, true }},
+}
+
+// ProcessCollector reports the processes using the most CPU and memory, and
+// the processes tracked by name. The top processes are labelled with an id
+// derived from their command line rather than their PID, so that a restarted
+// process keeps its series. Of the processes sharing a command line, e.g.
+// workers, the busiest is reported. The tracked processes are summed by
+// pattern, e.g. all the postgres backends.
+type ProcessCollector struct {
+	metrics.BaseCollector
+
+	ps    ProcessPS
+	topN  int
+	track []*regexp.Regexp
+	cpus  float64
+
+	// lastCPU is the CPU time of each process at the previous collection,
+	// by PID and start time
+	lastCPU  map[processKey]float64
+	lastTime time.Time
+}
+
+type processKey struct {
+	pid        int32
+	createTime int64
+}
+
+func NewProcessCollector(cfg *config.Config) *ProcessCollector {
+	return newProcessCollector(&systemPS{}, cfg.Processes)
+}
+
+func newProcessCollector(ps ProcessPS, cfg config.ProcessesConfig) *ProcessCollector {
+	c := &ProcessCollector{
+		ps:      ps,
+		topN:    cfg.TopN,
+		cpus:    float64(runtime.NumCPU()),
+		lastCPU: make(map[processKey]float64),
+	}
+	if c.topN == 0 {
+		c.topN = defaultTopN
+	}
+	for _, pattern := range cfg.Track {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			logger.Log.Warn("Skipping invalid tracked process pattern", "pattern", pattern, "error", err)
+			continue
+		}
+		c.track = append(c.track, re)
+	}
+	return c
+}
+
+func (c *ProcessCollector) Name() string {
+	return "process"
+}
+
+func (c *ProcessCollector) Collect() ([]metrics.DataPoint, error) {
+	all, err := c.CollectAll()
+	if err != nil {
+		return nil, err
+	}
+	var included []metrics.DataPoint
+	for _, dp := range all {
+		if c.IsIncluded(dp.Name, dp.Labels) {
+			included = append(included, dp)
+		}
+	}
+	return included, nil
+}
+
+func (c *ProcessCollector) CollectAll() ([]metrics.DataPoint, error) {
+	now := time.Now()
+	samples, err := c.ps.Processes()
+	if err != nil {
+		return nil, err
+	}
+	usages := c.usages(samples, now)
+	return c.buildDataPoints(usages, now.UnixMilli()), nil
+}
+
+func (c *ProcessCollector) Discover() ([]collection.Metric, error) {
+	samples, err := c.ps.Processes()
+	if err != nil {
+		return nil, err
+	}
+	discovered := []collection.Metric{}
+	usages := make([]usage, len(samples))
+	for i, s := range samples {
+		usages[i] = usage{sample: s}
+	}
+	for _, dp := range c.buildDataPoints(usages, 0) {
+		discovered = append(discovered, collection.Metric{Name: dp.Name, Type: "gauge", Labels: dp.Labels})
+	}
+	return discovered, nil
+}
+
+// usages computes the CPU usage of the processes since the previous
+// collection. It's zero on the first collection and for new processes.
+func (c *ProcessCollector) usages(samples []sample, now time.Time) []usage {
+	elapsed := now.Sub(c.lastTime).Seconds()
+	current := make(map[processKey]float64, len(samples))
+	usages := make([]usage, len(samples))
+	for i, s := range samples {
+		key := processKey{pid: s.PID, createTime: s.CreateTime}
+		current[key] = s.CPUSeconds
+		usages[i] = usage{sample: s}
+		if last, ok := c.lastCPU[key]; ok && elapsed > 0 && s.CPUSeconds >= last {
+			usages[i].cpuRatio = (s.CPUSeconds - last) / elapsed / c.cpus
+		}
+	}
+	c.lastCPU, c.lastTime = current, now
+	return usages
+}
+
+// buildDataPoints reports the top processes by CPU and by memory, and the
+// tracked groups
+func (c *ProcessCollector) buildDataPoints(usages []usage, ts int64) []metrics.DataPoint {
+	var results []metrics.DataPoint
+	for _, u := range c.top(usages) {
+		labels := map[string]string{"name": u.Name, "id": processID(u.sample)}
+		for _, m := range processMetrics {
+			if v, ok := m.getValue(u); ok {
+				results = append(results, metrics.DataPoint{Name: "process_" + m.name, Timestamp: ts, Value: v, Labels: labels})
+			}
+		}
+	}
+
+	for _, re := range c.track {
+		var group usage
+		var count float64
+		for _, u := range usages {
+			if !re.MatchString(u.Name) {
+				continue
+			}
+			count++
+			group.cpuRatio += u.cpuRatio
+			group.RSS += u.RSS
+			group.Threads += u.Threads
+			if u.FDs >= 0 {
+				group.FDs += u.FDs
+			}
+		}
+		labels := map[string]string{"group": re.String()}
+		results = append(results, metrics.DataPoint{Name: "process_group_count", Timestamp: ts, Value: count, Labels: labels})
+		for _, m := range processMetrics {
+			if v, ok := m.getValue(group); ok {
+				results = append(results, metrics.DataPoint{Name: "process_group_" + m.name, Timestamp: ts, Value: v, Labels: labels})
+			}
+		}
+	}
+	return results
+}
+
+// top returns the topN processes by CPU and the topN by memory, without
+// duplicates
+func (c *ProcessCollector) top(usages []usage) []usage {
+	if c.topN < 0 {
+		return nil
+	}
+	byCPU := slices.Clone(usages)
+	slices.SortStableFunc(byCPU, func(a, b usage) int { return compareDesc(a.cpuRatio, b.cpuRatio) })
+	byMemory := slices.Clone(usages)
+	slices.SortStableFunc(byMemory, func(a, b usage) int { return compareDesc(a.RSS, b.RSS) })
+
+	var top []usage
+	seen := make(map[string]bool)
+	for _, u := range slices.Concat(byCPU[:min(c.topN, len(byCPU))], byMemory[:min(c.topN, len(byMemory))]) {
+		id := processID(u.sample)
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		top = append(top, u)
+	}
+	return top
+}
+
+func compareDesc(a, b float64) int {
+	switch {
+	case a > b:
+		return -1
+	case a < b:
+		return 1
+	}
+	return 0
+}
+
+// processID identifies a process by its name and command line, it's the
+// same after a restart
+func processID(s sample) string {
+	sum := sha256.Sum256([]byte(s.Name + "\x00" + s.Cmdline))
+	return fmt.Sprintf("%x", sum[:4])
+}
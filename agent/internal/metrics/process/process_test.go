@@ -0,0 +1,99 @@
+package process
+
+import (
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"agent/internal/config"
+	"agent/internal/logger"
+	"agent/internal/metrics"
+)
+
+func init() {
+	logger.Log = slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+type mockPS struct {
+	mock.Mock
+}
+
+func (m *mockPS) Processes() ([]sample, error) {
+	args := m.Called()
+	samples, _ := args.Get(0).([]sample)
+	return samples, args.Error(1)
+}
+
+func findPoint(t *testing.T, dps []metrics.DataPoint, name string, labels map[string]string) metrics.DataPoint {
+	t.Helper()
+	for _, dp := range dps {
+		if dp.Name == name && assert.ObjectsAreEqual(labels, dp.Labels) {
+			return dp
+		}
+	}
+	t.Fatalf("data point %s %v not found", name, labels)
+	return metrics.DataPoint{}
+}
+
+func TestProcessCollector_TopAndTracked(t *testing.T) {
+	postgres := sample{PID: 10, Name: "postgres", Cmdline: "postgres -D /data", CreateTime: 1, CPUSeconds: 100, RSS: 400 << 20, FDs: 50, Threads: 1}
+	backend := sample{PID: 11, Name: "postgres", Cmdline: "postgres: app db", CreateTime: 1, CPUSeconds: 10, RSS: 20 << 20, FDs: -1, Threads: 1}
+	java := sample{PID: 20, Name: "java", Cmdline: "java -jar app.jar", CreateTime: 2, CPUSeconds: 1000, RSS: 2 << 30, FDs: 300, Threads: 80}
+	idle := sample{PID: 30, Name: "sshd", Cmdline: "sshd", CreateTime: 3, CPUSeconds: 1, RSS: 1 << 20, FDs: 5, Threads: 1}
+
+	ps := &mockPS{}
+	ps.On("Processes").Return([]sample{postgres, backend, java, idle}, nil).Once()
+	c := newProcessCollector(ps, config.ProcessesConfig{TopN: 1, Track: []string{"^postgres$", "("}})
+	c.cpus = 2
+	_, err := c.CollectAll()
+	require.NoError(t, err)
+
+	// 10s later, java used 5s of CPU and postgres 2s
+	c.lastTime = c.lastTime.Add(-10 * time.Second)
+	java.CPUSeconds += 5
+	postgres.CPUSeconds += 2
+	ps.On("Processes").Return([]sample{postgres, backend, java, idle}, nil).Once()
+	dps, err := c.CollectAll()
+	require.NoError(t, err)
+
+	// java is both the top CPU and memory process
+	javaLabels := map[string]string{"name": "java", "id": processID(java)}
+	assert.InDelta(t, 0.25, findPoint(t, dps, "process_cpu_ratio", javaLabels).Value, 0.01)
+	assert.Equal(t, float64(2<<30), findPoint(t, dps, "process_memory_rss_bytes", javaLabels).Value)
+	assert.Equal(t, 80.0, findPoint(t, dps, "process_threads", javaLabels).Value)
+	for _, dp := range dps {
+		assert.NotEqual(t, "sshd", dp.Labels["name"])
+	}
+
+	// The invalid pattern is skipped
+	group := map[string]string{"group": "^postgres$"}
+	assert.Equal(t, 2.0, findPoint(t, dps, "process_group_count", group).Value)
+	assert.InDelta(t, 0.1, findPoint(t, dps, "process_group_cpu_ratio", group).Value, 0.01)
+	assert.Equal(t, float64(420<<20), findPoint(t, dps, "process_group_memory_rss_bytes", group).Value)
+	assert.Equal(t, 50.0, findPoint(t, dps, "process_group_open_fds", group).Value)
+}
+
+func TestProcessID_StableAcrossRestarts(t *testing.T) {
+	before := sample{PID: 10, Name: "nginx", Cmdline: "nginx: master process", CreateTime: 1}
+	after := sample{PID: 99, Name: "nginx", Cmdline: "nginx: master process", CreateTime: 500}
+	assert.Equal(t, processID(before), processID(after))
+	assert.NotEqual(t, processID(before), processID(sample{Name: "nginx", Cmdline: "nginx: worker process"}))
+}
+
+func TestProcessCollector_TrackedOnly(t *testing.T) {
+	ps := &mockPS{}
+	ps.On("Processes").Return([]sample{{PID: 1, Name: "init"}}, nil)
+	c := newProcessCollector(ps, config.ProcessesConfig{TopN: -1, Track: []string{"nginx"}})
+
+	discovered, err := c.Discover()
+	require.NoError(t, err)
+	for _, m := range discovered {
+		assert.Contains(t, m.Name, "process_group_")
+	}
+	assert.NotEmpty(t, discovered)
+}
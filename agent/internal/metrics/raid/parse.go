@@ -0,0 +1,208 @@
+package raid
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"agent/internal/metrics"
+)
+
+// mdArray is a software RAID array read from /proc/mdstat
+type mdArray struct {
+	Name        string
+	Level       string
+	Active      bool
+	DisksTotal  float64
+	DisksActive float64
+	DisksFailed float64
+	// SyncProgress is the completion of a running resync, recovery, reshape
+	// or check, 1 when the array is idle.
+	SyncProgress float64
+	SyncAction   string
+}
+
+var (
+	mdHeaderRe   = regexp.MustCompile(`^(md\S+)\s*:\s*(\S+)\s*(.*)$`)
+	mdDisksRe    = regexp.MustCompile(`\[(\d+)/(\d+)\]`)
+	mdProgressRe = regexp.MustCompile(`(resync|recovery|reshape|check)\s*=\s*([\d.]+)%`)
+)
+
+// parseMDStat parses /proc/mdstat:
+//
+//	md1 : active raid5 sdc1[2] sdb2[1] sda2[0](F)
+//	      2095104 blocks super 1.2 level 5, 512k chunk [3/2] [UU_]
+//	      [=>...................]  recovery =  8.4% (88832/1047552) finish=0.8min
+func parseMDStat(out []byte) []mdArray {
+	var arrays []mdArray
+	var current *mdArray
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if m := mdHeaderRe.FindStringSubmatch(line); m != nil {
+			arrays = append(arrays, mdArray{Name: m[1], Active: m[2] == "active", SyncProgress: 1})
+			current = &arrays[len(arrays)-1]
+			for _, field := range strings.Fields(m[3]) {
+				switch {
+				case current.Level == "" && !strings.Contains(field, "[") && field != "(auto-read-only)" && field != "(read-only)":
+					current.Level = field
+				case strings.HasSuffix(field, "(F)"):
+					current.DisksFailed++
+				}
+			}
+			continue
+		}
+		if current == nil || !strings.HasPrefix(line, " ") {
+			current = nil
+			continue
+		}
+		if m := mdDisksRe.FindStringSubmatch(line); m != nil {
+			current.DisksTotal, _ = strconv.ParseFloat(m[1], 64)
+			current.DisksActive, _ = strconv.ParseFloat(m[2], 64)
+		}
+		if m := mdProgressRe.FindStringSubmatch(line); m != nil {
+			current.SyncAction = m[1]
+			if p, err := strconv.ParseFloat(m[2], 64); err == nil {
+				current.SyncProgress = p / 100
+			}
+		}
+	}
+	return arrays
+}
+
+// mdMetrics list the metrics reported for each md array
+var mdMetrics = []struct {
+	name   string
+	getVal func(a *mdArray) float64
+}{
+	{"raid_md_active", func(a *mdArray) float64 { return boolToFloat(a.Active) }},
+	{"raid_md_degraded", func(a *mdArray) float64 { return boolToFloat(a.DisksActive < a.DisksTotal) }},
+	{"raid_md_disks_total", func(a *mdArray) float64 { return a.DisksTotal }},
+	{"raid_md_disks_active_total", func(a *mdArray) float64 { return a.DisksActive }},
+	{"raid_md_disks_failed_total", func(a *mdArray) float64 { return a.DisksFailed }},
+	{"raid_md_sync_progress_ratio", func(a *mdArray) float64 { return a.SyncProgress }},
+}
+
+func mdDataPoints(arrays []mdArray, ts int64) []metrics.DataPoint {
+	var results []metrics.DataPoint
+	for i := range arrays {
+		a := &arrays[i]
+		for _, m := range mdMetrics {
+			results = append(results, metrics.DataPoint{
+				Name:      m.name,
+				Timestamp: ts,
+				Value:     m.getVal(a),
+				Labels:    map[string]string{"array": a.Name, "level": a.Level},
+			})
+		}
+	}
+	return results
+}
+
+// thinPool is an LVM thin pool usage
+type thinPool struct {
+	VG           string
+	LV           string
+	DataUsed     float64 // Percent
+	MetadataUsed float64 // Percent
+}
+
+// parseLVS parses the output of lvs called with lvsArgs and keeps thin pools.
+func parseLVS(out []byte) []thinPool {
+	var pools []thinPool
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		fields := strings.Split(strings.TrimSpace(scanner.Text()), "|")
+		if len(fields) != 5 || fields[2] != "thin-pool" {
+			continue
+		}
+		pool := thinPool{VG: fields[0], LV: fields[1]}
+		pool.DataUsed, _ = strconv.ParseFloat(strings.TrimSpace(fields[3]), 64)
+		pool.MetadataUsed, _ = strconv.ParseFloat(strings.TrimSpace(fields[4]), 64)
+		pools = append(pools, pool)
+	}
+	return pools
+}
+
+func thinPoolDataPoints(pools []thinPool, ts int64) []metrics.DataPoint {
+	var results []metrics.DataPoint
+	for _, p := range pools {
+		labels := map[string]string{"vg": p.VG, "lv": p.LV}
+		results = append(results,
+			metrics.DataPoint{Name: "raid_lvm_thin_data_used_ratio", Timestamp: ts, Value: p.DataUsed / 100, Labels: labels},
+			metrics.DataPoint{Name: "raid_lvm_thin_metadata_used_ratio", Timestamp: ts, Value: p.MetadataUsed / 100, Labels: labels},
+		)
+	}
+	return results
+}
+
+// virtualDrive is a hardware RAID logical drive
+type virtualDrive struct {
+	Controller string
+	ID         string // "<drive group>/<virtual drive>"
+	Level      string
+	State      string
+}
+
+type storcliOutput struct {
+	Controllers []struct {
+		CommandStatus struct {
+			Controller json.Number `json:"Controller"`
+			Status     string      `json:"Status"`
+		} `json:"Command Status"`
+		ResponseData struct {
+			VirtualDrives []struct {
+				ID    string `json:"DG/VD"`
+				Type  string `json:"TYPE"`
+				State string `json:"State"`
+			} `json:"Virtual Drives"`
+		} `json:"Response Data"`
+	} `json:"Controllers"`
+}
+
+// parseStorCLI parses the JSON output of "storcli /call/vall show J".
+func parseStorCLI(out []byte) ([]virtualDrive, error) {
+	var parsed storcliOutput
+	if err := json.Unmarshal(out, &parsed); err != nil {
+		return nil, err
+	}
+	var drives []virtualDrive
+	for _, ctrl := range parsed.Controllers {
+		if ctrl.CommandStatus.Status != "Success" {
+			continue
+		}
+		for _, vd := range ctrl.ResponseData.VirtualDrives {
+			drives = append(drives, virtualDrive{
+				Controller: ctrl.CommandStatus.Controller.String(),
+				ID:         vd.ID,
+				Level:      strings.ToLower(vd.Type),
+				State:      vd.State,
+			})
+		}
+	}
+	return drives, nil
+}
+
+func virtualDriveDataPoints(drives []virtualDrive, ts int64) []metrics.DataPoint {
+	var results []metrics.DataPoint
+	for _, d := range drives {
+		results = append(results, metrics.DataPoint{
+			Name:      "raid_hw_optimal",
+			Timestamp: ts,
+			// "Optl" is optimal, anything else (Dgrd, Pdgd, OfLn, Rec) needs attention
+			Value:  boolToFloat(d.State == "Optl"),
+			Labels: map[string]string{"controller": d.Controller, "drive": d.ID, "level": d.Level},
+		})
+	}
+	return results
+}
+
+func boolToFloat(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,134 @@
+package raid
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"time"
+
+	"agent/internal/collection"
+	"agent/internal/common"
+	"agent/internal/logger"
+	"agent/internal/metrics"
+)
+
+const commandTimeout = 10 * time.Second
+
+// RaidPS reads the raw status of the supported RAID layers. Each source is
+// optional, an error means it is not present on the host.
+type RaidPS interface {
+	MDStat() ([]byte, error)
+	// LVS returns the logical volumes as reported by lvs, see lvsArgs.
+	LVS() ([]byte, error)
+	// StorCLI returns the virtual drives of Broadcom/LSI MegaRAID controllers.
+	StorCLI() ([]byte, error)
+}
+
+var lvsArgs = []string{"--noheadings", "--nosuffix", "--separator", "|", "-o", "vg_name,lv_name,segtype,data_percent,metadata_percent"}
+
+type systemPS struct {
+	mdstatPath string
+}
+
+func (s *systemPS) MDStat() ([]byte, error) {
+	return os.ReadFile(s.mdstatPath)
+}
+
+func (s *systemPS) LVS() ([]byte, error) {
+	return run("lvs", lvsArgs...)
+}
+
+func (s *systemPS) StorCLI() ([]byte, error) {
+	for _, name := range []string{"storcli64", "storcli"} {
+		if _, err := exec.LookPath(name); err == nil {
+			return run(name, "/call/vall", "show", "J")
+		}
+	}
+	return nil, fmt.Errorf("storcli not found")
+}
+
+func run(name string, args ...string) ([]byte, error) {
+	if _, err := exec.LookPath(name); err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), commandTimeout)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, name, args...).Output()
+	if err != nil {
+		return nil, fmt.Errorf("%s failed: %w", name, err)
+	}
+	return out, nil
+}
+
+// RaidCollector reports the health of software RAID arrays (md), LVM thin
+// pools and hardware RAID virtual drives.
+type RaidCollector struct {
+	metrics.BaseCollector
+
+	ps RaidPS
+}
+
+func NewRaidCollector() *RaidCollector {
+	return &RaidCollector{ps: &systemPS{mdstatPath: common.HostPath("/proc/mdstat")}}
+}
+
+func (c *RaidCollector) Name() string {
+	return "raid"
+}
+
+func (c *RaidCollector) Collect() ([]metrics.DataPoint, error) {
+	all, err := c.CollectAll()
+	if err != nil {
+		return nil, err
+	}
+	var included []metrics.DataPoint
+	for _, dp := range all {
+		if c.IsIncluded(dp.Name, dp.Labels) {
+			included = append(included, dp)
+		}
+	}
+	return included, nil
+}
+
+func (c *RaidCollector) CollectAll() ([]metrics.DataPoint, error) {
+	timestamp := time.Now().UnixMilli()
+	var results []metrics.DataPoint
+
+	if out, err := c.ps.MDStat(); err == nil {
+		results = append(results, mdDataPoints(parseMDStat(out), timestamp)...)
+	} else {
+		logger.Log.Debug("Skipping md arrays", "collector", c.Name(), "error", err)
+	}
+
+	if out, err := c.ps.LVS(); err == nil {
+		results = append(results, thinPoolDataPoints(parseLVS(out), timestamp)...)
+	} else {
+		logger.Log.Debug("Skipping lvm thin pools", "collector", c.Name(), "error", err)
+	}
+
+	if out, err := c.ps.StorCLI(); err == nil {
+		drives, err := parseStorCLI(out)
+		if err != nil {
+			logger.Log.Debug("Failed to parse storcli output", "collector", c.Name(), "error", err)
+		}
+		results = append(results, virtualDriveDataPoints(drives, timestamp)...)
+	}
+	return results, nil
+}
+
+func (c *RaidCollector) Discover() ([]collection.Metric, error) {
+	all, err := c.CollectAll()
+	if err != nil {
+		return nil, err
+	}
+	discovered := []collection.Metric{}
+	for _, dp := range all {
+		discovered = append(discovered, collection.Metric{
+			Name:   dp.Name,
+			Type:   "gauge",
+			Labels: dp.Labels,
+		})
+	}
+	return discovered, nil
+}
@@ -0,0 +1,147 @@
+package raid
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"agent/internal/logger"
+	"agent/internal/metrics"
+)
+
+func init() {
+	logger.Log = slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+type mockPS struct {
+	mock.Mock
+}
+
+func (m *mockPS) MDStat() ([]byte, error) {
+	args := m.Called()
+	out, _ := args.Get(0).([]byte)
+	return out, args.Error(1)
+}
+
+func (m *mockPS) LVS() ([]byte, error) {
+	args := m.Called()
+	out, _ := args.Get(0).([]byte)
+	return out, args.Error(1)
+}
+
+func (m *mockPS) StorCLI() ([]byte, error) {
+	args := m.Called()
+	out, _ := args.Get(0).([]byte)
+	return out, args.Error(1)
+}
+
+const mdstat = `Personalities : [raid1] [raid6] [raid5] [raid4]
+md0 : active raid1 sdb1[1] sda1[0]
+      1048512 blocks super 1.2 [2/2] [UU]
+
+md1 : active raid5 sdc1[2] sdb2[1] sda2[0](F)
+      2095104 blocks super 1.2 level 5, 512k chunk, algorithm 2 [3/2] [_UU]
+      [=>...................]  recovery =  8.4% (88832/1047552) finish=0.8min speed=19738K/sec
+
+md127 : inactive sdd[0](S)
+      976630488 blocks super 1.2
+
+unused devices: <none>
+`
+
+const lvs = `  vg0|root|linear||
+  vg0|pool0|thin-pool|42.50|7.25
+  vg0|data|thin|80.00|
+`
+
+const storcli = `{"Controllers":[
+  {"Command Status":{"Controller":0,"Status":"Success"},
+   "Response Data":{"Virtual Drives":[
+     {"DG/VD":"0/0","TYPE":"RAID1","State":"Optl"},
+     {"DG/VD":"1/1","TYPE":"RAID5","State":"Dgrd"}]}},
+  {"Command Status":{"Controller":1,"Status":"Failure"}}]}`
+
+func findPoint(t *testing.T, dps []metrics.DataPoint, name string, labels map[string]string) metrics.DataPoint {
+	t.Helper()
+	for _, dp := range dps {
+		if dp.Name != name {
+			continue
+		}
+		match := true
+		for k, v := range labels {
+			if dp.Labels[k] != v {
+				match = false
+			}
+		}
+		if match {
+			return dp
+		}
+	}
+	t.Fatalf("data point %s %v not found", name, labels)
+	return metrics.DataPoint{}
+}
+
+func TestRaidCollector(t *testing.T) {
+	var mps mockPS
+	defer mps.AssertExpectations(t)
+	mps.On("MDStat").Return([]byte(mdstat), nil)
+	mps.On("LVS").Return([]byte(lvs), nil)
+	mps.On("StorCLI").Return([]byte(storcli), nil)
+
+	c := &RaidCollector{ps: &mps}
+	dps, err := c.CollectAll()
+	require.NoError(t, err)
+
+	md0 := map[string]string{"array": "md0", "level": "raid1"}
+	assert.Equal(t, 0.0, findPoint(t, dps, "raid_md_degraded", md0).Value)
+	assert.Equal(t, 1.0, findPoint(t, dps, "raid_md_sync_progress_ratio", md0).Value)
+
+	md1 := map[string]string{"array": "md1", "level": "raid5"}
+	assert.Equal(t, 1.0, findPoint(t, dps, "raid_md_degraded", md1).Value)
+	assert.Equal(t, 1.0, findPoint(t, dps, "raid_md_disks_failed_total", md1).Value)
+	assert.InDelta(t, 0.084, findPoint(t, dps, "raid_md_sync_progress_ratio", md1).Value, 0.0001)
+
+	assert.Equal(t, 0.0, findPoint(t, dps, "raid_md_active", map[string]string{"array": "md127"}).Value)
+
+	pool := map[string]string{"vg": "vg0", "lv": "pool0"}
+	assert.InDelta(t, 0.425, findPoint(t, dps, "raid_lvm_thin_data_used_ratio", pool).Value, 0.0001)
+	assert.InDelta(t, 0.0725, findPoint(t, dps, "raid_lvm_thin_metadata_used_ratio", pool).Value, 0.0001)
+
+	assert.Equal(t, 1.0, findPoint(t, dps, "raid_hw_optimal", map[string]string{"drive": "0/0", "level": "raid1"}).Value)
+	assert.Equal(t, 0.0, findPoint(t, dps, "raid_hw_optimal", map[string]string{"drive": "1/1", "controller": "0"}).Value)
+	for _, dp := range dps {
+		assert.NotEqual(t, "1", dp.Labels["controller"], "failed controller commands are skipped")
+	}
+}
+
+func TestRaidCollectorNothingAvailable(t *testing.T) {
+	var mps mockPS
+	mps.On("MDStat").Return(nil, errors.New("no such file"))
+	mps.On("LVS").Return(nil, errors.New("lvs not found"))
+	mps.On("StorCLI").Return(nil, errors.New("storcli not found"))
+
+	c := &RaidCollector{ps: &mps}
+	dps, err := c.CollectAll()
+	assert.NoError(t, err)
+	assert.Empty(t, dps)
+
+	discovered, err := c.Discover()
+	assert.NoError(t, err)
+	assert.Empty(t, discovered)
+}
+
+func TestParseMDStat(t *testing.T) {
+	arrays := parseMDStat([]byte(`md0 : active (auto-read-only) raid1 sdb1[1] sda1[0]
+      1048512 blocks super 1.2 [2/2] [UU]
+      [====>................]  resync = 22.0% (230912/1048512) finish=1.2min
+`))
+	require.Len(t, arrays, 1)
+	assert.Equal(t, "raid1", arrays[0].Level)
+	assert.Equal(t, "resync", arrays[0].SyncAction)
+	assert.InDelta(t, 0.22, arrays[0].SyncProgress, 0.0001)
+}
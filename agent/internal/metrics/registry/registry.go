@@ -4,29 +4,85 @@ import (
 	"strings"
 
 	"agent/internal/collection"
+	"agent/internal/config"
 	"agent/internal/logger"
 	"agent/internal/metrics"
 	"agent/internal/metrics/apache"
+	"agent/internal/metrics/battery"
+	"agent/internal/metrics/btrfs"
 	"agent/internal/metrics/cpu"
+	"agent/internal/metrics/cron"
 	"agent/internal/metrics/disk"
+	"agent/internal/metrics/elasticsearch"
+	"agent/internal/metrics/fd"
+	"agent/internal/metrics/firewall"
+	"agent/internal/metrics/ipmi"
+	"agent/internal/metrics/jvm"
+	"agent/internal/metrics/kafka"
+	"agent/internal/metrics/kernel"
+	"agent/internal/metrics/load"
 	"agent/internal/metrics/memcached"
 	"agent/internal/metrics/memory"
+	"agent/internal/metrics/mount"
 	"agent/internal/metrics/network"
 	"agent/internal/metrics/nginx"
+	"agent/internal/metrics/oom"
+	"agent/internal/metrics/perfmon"
 	"agent/internal/metrics/phpfpm"
+	"agent/internal/metrics/process"
+	"agent/internal/metrics/raid"
+	"agent/internal/metrics/scrape"
+	"agent/internal/metrics/smart"
+	"agent/internal/metrics/snmp"
 	"agent/internal/metrics/status"
+	"agent/internal/metrics/supervisor"
+	"agent/internal/metrics/systemd"
+	"agent/internal/metrics/tcp"
+	"agent/internal/metrics/temperature"
+	"agent/internal/metrics/tlscert"
+	"agent/internal/metrics/varnish"
+	"agent/internal/metrics/zfs"
 )
 
-func BuildCollectors(cfg *collection.CollectionConfig) []metrics.MetricCollector {
+// BuildCollectors returns the collectors selected by the collection config,
+// all of them when it's nil. The collectors reading targets from the agent
+// config are set up with agentConfig.
+func BuildCollectors(cfg *collection.CollectionConfig, agentConfig *config.Config) []metrics.MetricCollector {
 	collectorMap := map[string]metrics.MetricCollector{
-		"apache":    apache.NewApacheCollector(),
-		"cpu":       cpu.NewCPUCollector(),
-		"disk":      disk.NewDiskCollector(),
-		"mem":       memory.NewMemoryCollector(),
-		"memcached": memcached.NewMemcachedCollector(),
-		"net":       network.NewNetworkCollector(),
-		"nginx":     nginx.NewNginxCollector(),
-		"phpfpm":    phpfpm.NewPHPFPMCollector(),
+		"apache":        apache.NewApacheCollector(),
+		"battery":       battery.NewBatteryCollector(),
+		"btrfs":         btrfs.NewBtrfsCollector(),
+		"cpu":           cpu.NewCPUCollector(),
+		"cron":          cron.NewCronCollector(),
+		"disk":          disk.NewDiskCollector(),
+		"elasticsearch": elasticsearch.NewElasticsearchCollector(agentConfig),
+		"fd":            fd.NewFDCollector(),
+		"firewall":      firewall.NewFirewallCollector(),
+		"ipmi":          ipmi.NewIPMICollector(),
+		"jvm":           jvm.NewJVMCollector(agentConfig),
+		"kafka":         kafka.NewKafkaCollector(agentConfig),
+		"kernel":        kernel.NewKernelCollector(),
+		"load":          load.NewLoadCollector(),
+		"mem":           memory.NewMemoryCollector(),
+		"memcached":     memcached.NewMemcachedCollector(),
+		"mount":         mount.NewMountCollector(),
+		"net":           network.NewNetworkCollector(),
+		"nginx":         nginx.NewNginxCollector(),
+		"oom":           oom.NewOOMCollector(),
+		"perfmon":       perfmon.NewPerfmonCollector(agentConfig),
+		"phpfpm":        phpfpm.NewPHPFPMCollector(),
+		"process":       process.NewProcessCollector(agentConfig),
+		"raid":          raid.NewRaidCollector(),
+		"scrape":        scrape.NewScrapeCollector(agentConfig),
+		"smart":         smart.NewSmartCollector(),
+		"snmp":          snmp.NewSNMPCollector(agentConfig),
+		"supervisor":    supervisor.NewSupervisorCollector(agentConfig),
+		"systemd":       systemd.NewSystemdCollector(agentConfig),
+		"tcp":           tcp.NewTCPCollector(),
+		"temperature":   temperature.NewTemperatureCollector(),
+		"tls":           tlscert.NewTLSCertCollector(agentConfig),
+		"varnish":       varnish.NewVarnishCollector(),
+		"zfs":           zfs.NewZFSCollector(),
 	}
 
 	var allCollectors []metrics.MetricCollector
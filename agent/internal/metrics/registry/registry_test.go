@@ -8,6 +8,7 @@ import (
 	"github.com/stretchr/testify/assert"
 
 	"agent/internal/collection"
+	"agent/internal/config"
 	"agent/internal/logger"
 )
 
@@ -23,7 +24,7 @@ func TestBuildCollectors_FilteredConfig(t *testing.T) {
 		},
 	}
 
-	collectors := BuildCollectors(cfg)
+	collectors := BuildCollectors(cfg, &config.Config{})
 
 	// Status + cpu + mem = 3
 	assert.Len(t, collectors, 3)
@@ -48,7 +49,7 @@ func TestBuildCollectors_NoMatch(t *testing.T) {
 		},
 	}
 
-	collectors := BuildCollectors(cfg)
+	collectors := BuildCollectors(cfg, &config.Config{})
 
 	// Only status collector should remain
 	assert.Len(t, collectors, 1)
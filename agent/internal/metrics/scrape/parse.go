@@ -0,0 +1,147 @@
+package scrape
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// sample is a single sample of the Prometheus text exposition format.
+type sample struct {
+	name   string
+	labels map[string]string
+	value  float64
+}
+
+// exposition is the parsed content of a /metrics page.
+type exposition struct {
+	samples []sample
+	// types maps metric family names to their declared type
+	types map[string]string
+}
+
+// parseExposition parses the Prometheus text format (version 0.0.4). Invalid
+// lines are skipped so one broken series doesn't hide the whole target.
+func parseExposition(r io.Reader) (*exposition, error) {
+	exp := &exposition{types: make(map[string]string)}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "#") {
+			fields := strings.Fields(line)
+			if len(fields) >= 4 && fields[1] == "TYPE" {
+				exp.types[fields[2]] = fields[3]
+			}
+			continue
+		}
+		s, err := parseSample(line)
+		if err != nil {
+			continue
+		}
+		exp.samples = append(exp.samples, s)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read exposition: %w", err)
+	}
+	return exp, nil
+}
+
+// typeOf returns the declared type of a sample, resolving the suffixes of
+// histograms and summaries to their family.
+func (e *exposition) typeOf(name string) string {
+	if t, ok := e.types[name]; ok {
+		return t
+	}
+	for _, suffix := range []string{"_bucket", "_count", "_sum"} {
+		if family, ok := strings.CutSuffix(name, suffix); ok {
+			if t, ok := e.types[family]; ok {
+				return t
+			}
+		}
+	}
+	return "untyped"
+}
+
+func parseSample(line string) (sample, error) {
+	s := sample{labels: make(map[string]string)}
+
+	nameEnd := strings.IndexAny(line, "{ \t")
+	if nameEnd <= 0 {
+		return s, fmt.Errorf("missing value")
+	}
+	s.name = line[:nameEnd]
+	rest := line[nameEnd:]
+
+	if rest[0] == '{' {
+		end, err := parseLabels(rest, s.labels)
+		if err != nil {
+			return s, err
+		}
+		rest = rest[end:]
+	}
+
+	fields := strings.Fields(rest)
+	if len(fields) == 0 {
+		return s, fmt.Errorf("missing value")
+	}
+	value, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return s, fmt.Errorf("invalid value %q: %w", fields[0], err)
+	}
+	s.value = value
+	return s, nil
+}
+
+// parseLabels parses a label set starting at '{' and returns the index right
+// after the closing '}'.
+func parseLabels(text string, labels map[string]string) (int, error) {
+	i := 1
+	for {
+		for i < len(text) && (text[i] == ' ' || text[i] == ',') {
+			i++
+		}
+		if i >= len(text) {
+			return 0, fmt.Errorf("unterminated label set")
+		}
+		if text[i] == '}' {
+			return i + 1, nil
+		}
+
+		eq := strings.IndexByte(text[i:], '=')
+		if eq < 0 {
+			return 0, fmt.Errorf("invalid label")
+		}
+		name := strings.TrimSpace(text[i : i+eq])
+		i += eq + 1
+		if i >= len(text) || text[i] != '"' {
+			return 0, fmt.Errorf("label value must be quoted")
+		}
+		i++
+
+		var value strings.Builder
+		for ; i < len(text) && text[i] != '"'; i++ {
+			if text[i] == '\\' && i+1 < len(text) {
+				i++
+				switch text[i] {
+				case 'n':
+					value.WriteByte('\n')
+				default:
+					value.WriteByte(text[i])
+				}
+				continue
+			}
+			value.WriteByte(text[i])
+		}
+		if i >= len(text) {
+			return 0, fmt.Errorf("unterminated label value")
+		}
+		i++ // closing quote
+		labels[name] = value.String()
+	}
+}
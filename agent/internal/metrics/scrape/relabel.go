@@ -0,0 +1,101 @@
+package scrape
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"agent/internal/config"
+)
+
+const nameLabel = "__name__"
+
+// relabeler applies relabel rules to the labels of a sample. The metric name
+// is exposed to the rules as the "__name__" label.
+type relabeler struct {
+	rules []compiledRule
+}
+
+type compiledRule struct {
+	config.RelabelRule
+	regex *regexp.Regexp
+}
+
+func newRelabeler(rules []config.RelabelRule) (*relabeler, error) {
+	r := &relabeler{}
+	for _, rule := range rules {
+		if rule.Separator == "" {
+			rule.Separator = ";"
+		}
+		if rule.Regex == "" {
+			rule.Regex = "(.*)"
+		}
+		if rule.Replacement == "" {
+			rule.Replacement = "$1"
+		}
+		if rule.Action == "" {
+			rule.Action = "replace"
+		}
+		switch rule.Action {
+		case "replace":
+			if rule.TargetLabel == "" {
+				return nil, fmt.Errorf("relabel rule with action replace needs a target_label")
+			}
+		case "keep", "drop", "labeldrop":
+		default:
+			return nil, fmt.Errorf("unsupported relabel action %q", rule.Action)
+		}
+		// Like Prometheus, regexes are fully anchored
+		re, err := regexp.Compile("^(?:" + rule.Regex + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("invalid relabel regex %q: %w", rule.Regex, err)
+		}
+		r.rules = append(r.rules, compiledRule{RelabelRule: rule, regex: re})
+	}
+	return r, nil
+}
+
+// apply rewrites labels in place and returns false when the sample must be
+// dropped.
+func (r *relabeler) apply(labels map[string]string) bool {
+	for _, rule := range r.rules {
+		switch rule.Action {
+		case "labeldrop":
+			for name := range labels {
+				if name != nameLabel && rule.regex.MatchString(name) {
+					delete(labels, name)
+				}
+			}
+			continue
+		}
+
+		values := make([]string, 0, len(rule.SourceLabels))
+		for _, name := range rule.SourceLabels {
+			values = append(values, labels[name])
+		}
+		value := strings.Join(values, rule.Separator)
+
+		switch rule.Action {
+		case "keep":
+			if !rule.regex.MatchString(value) {
+				return false
+			}
+		case "drop":
+			if rule.regex.MatchString(value) {
+				return false
+			}
+		case "replace":
+			match := rule.regex.FindStringSubmatchIndex(value)
+			if match == nil {
+				continue
+			}
+			result := string(rule.regex.ExpandString(nil, rule.Replacement, value, match))
+			if result == "" {
+				delete(labels, rule.TargetLabel)
+			} else {
+				labels[rule.TargetLabel] = result
+			}
+		}
+	}
+	return labels[nameLabel] != ""
+}
@@ -0,0 +1,212 @@
+package scrape
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"path"
+	"time"
+
+	"agent/internal/collection"
+	"agent/internal/config"
+	"agent/internal/logger"
+	"agent/internal/metrics"
+)
+
+const (
+	// metricPrefix is prepended to scraped metric names so they can't collide
+	// with the agent's own metrics.
+	metricPrefix   = "scrape_"
+	defaultTimeout = 5 * time.Second
+	maxBodySize    = 10 * 1024 * 1024
+)
+
+type ScrapePS interface {
+	Fetch(url string, timeout time.Duration) (io.ReadCloser, error)
+}
+
+type systemPS struct{}
+
+func (s *systemPS) Fetch(url string, timeout time.Duration) (io.ReadCloser, error) {
+	client := &http.Client{Timeout: timeout}
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "text/plain;version=0.0.4")
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to scrape %s: %w", url, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("failed to scrape %s: status %d", url, resp.StatusCode)
+	}
+	return resp.Body, nil
+}
+
+type target struct {
+	config.ScrapeTarget
+	instance  string
+	timeout   time.Duration
+	relabeler *relabeler
+}
+
+// ScrapeCollector pulls local Prometheus endpoints (exporters, instrumented
+// applications) listed in the agent config, so they can be ingested without
+// code changes.
+type ScrapeCollector struct {
+	metrics.BaseCollector
+
+	ps      ScrapePS
+	targets []target
+}
+
+func NewScrapeCollector(cfg *config.Config) *ScrapeCollector {
+	return newScrapeCollector(&systemPS{}, cfg.ScrapeTargets)
+}
+
+func newScrapeCollector(ps ScrapePS, targets []config.ScrapeTarget) *ScrapeCollector {
+	c := &ScrapeCollector{ps: ps}
+	for _, t := range targets {
+		u, err := url.Parse(t.URL)
+		if err != nil || u.Host == "" {
+			logger.Log.Warn("Skipping scrape target with invalid url", "name", t.Name, "url", t.URL)
+			continue
+		}
+		relabeler, err := newRelabeler(t.Relabel)
+		if err != nil {
+			logger.Log.Warn("Skipping scrape target with invalid relabel rules", "name", t.Name, "error", err)
+			continue
+		}
+		timeout := time.Duration(t.TimeoutSeconds) * time.Second
+		if timeout <= 0 {
+			timeout = defaultTimeout
+		}
+		c.targets = append(c.targets, target{
+			ScrapeTarget: t,
+			instance:     u.Host,
+			timeout:      timeout,
+			relabeler:    relabeler,
+		})
+	}
+	return c
+}
+
+func (c *ScrapeCollector) Name() string {
+	return "scrape"
+}
+
+func (c *ScrapeCollector) Collect() ([]metrics.DataPoint, error) {
+	all, err := c.CollectAll()
+	if err != nil {
+		return nil, err
+	}
+	var included []metrics.DataPoint
+	for _, dp := range all {
+		if c.IsIncluded(dp.Name, dp.Labels) {
+			included = append(included, dp)
+		}
+	}
+	return included, nil
+}
+
+func (c *ScrapeCollector) CollectAll() ([]metrics.DataPoint, error) {
+	var results []metrics.DataPoint
+	for _, t := range c.targets {
+		dps, _, err := c.scrape(t)
+		if err != nil {
+			logger.Log.Debug("Failed to collect metrics", "collector", c.Name(), "target", t.Name, "error", err)
+			continue
+		}
+		results = append(results, dps...)
+	}
+	return results, nil
+}
+
+func (c *ScrapeCollector) Discover() ([]collection.Metric, error) {
+	var discovered []collection.Metric
+	for _, t := range c.targets {
+		dps, types, err := c.scrape(t)
+		if err != nil {
+			continue
+		}
+		for i, dp := range dps {
+			discovered = append(discovered, collection.Metric{
+				Name:   dp.Name,
+				Type:   types[i],
+				Labels: dp.Labels,
+			})
+		}
+	}
+	return discovered, nil
+}
+
+// scrape pulls a target and returns its data points along with their type.
+func (c *ScrapeCollector) scrape(t target) ([]metrics.DataPoint, []string, error) {
+	timestamp := time.Now().UnixMilli()
+	body, err := c.ps.Fetch(t.URL, t.timeout)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer body.Close()
+
+	exp, err := parseExposition(io.LimitReader(body, maxBodySize))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var dps []metrics.DataPoint
+	var types []string
+	for _, s := range exp.samples {
+		if math.IsNaN(s.value) || math.IsInf(s.value, 0) {
+			continue
+		}
+		if !t.matches(s.name) {
+			continue
+		}
+
+		labels := s.labels
+		labels[nameLabel] = s.name
+		labels["job"] = t.Name
+		labels["instance"] = t.instance
+		if !t.relabeler.apply(labels) {
+			continue
+		}
+		name := labels[nameLabel]
+		delete(labels, nameLabel)
+
+		dps = append(dps, metrics.DataPoint{
+			Name:      metricPrefix + name,
+			Timestamp: timestamp,
+			Value:     s.value,
+			Labels:    labels,
+		})
+		metricType := "gauge"
+		if exp.typeOf(s.name) == "counter" {
+			metricType = "counter"
+		}
+		types = append(types, metricType)
+	}
+	return dps, types, nil
+}
+
+// matches applies the include and exclude patterns to a metric name.
+func (t target) matches(name string) bool {
+	for _, pattern := range t.Exclude {
+		if ok, _ := path.Match(pattern, name); ok {
+			return false
+		}
+	}
+	if len(t.Include) == 0 {
+		return true
+	}
+	for _, pattern := range t.Include {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
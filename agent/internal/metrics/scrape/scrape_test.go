@@ -0,0 +1,201 @@
+package scrape
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"agent/internal/collection"
+	"agent/internal/config"
+	"agent/internal/logger"
+	"agent/internal/metrics"
+)
+
+func init() {
+	logger.Log = slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+type mockPS struct {
+	mock.Mock
+}
+
+func (m *mockPS) Fetch(url string, timeout time.Duration) (io.ReadCloser, error) {
+	args := m.Called(url, timeout)
+	if body := args.String(0); body != "" {
+		return io.NopCloser(strings.NewReader(body)), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+const metricsPage = `# HELP http_requests_total Total requests.
+# TYPE http_requests_total counter
+http_requests_total{method="get",code="200"} 1027 1395066363000
+http_requests_total{method="post",code="500"} 3
+# TYPE queue_depth gauge
+queue_depth{queue="emails",path="C:\\DIR\\",msg="say \"hi\""} 12.5
+# TYPE request_duration_seconds histogram
+request_duration_seconds_bucket{le="0.1"} 5
+request_duration_seconds_bucket{le="+Inf"} 8
+request_duration_seconds_count 8
+go_gc_duration_seconds NaN
+process_open_fds 31
+broken_line{unterminated="x 1
+`
+
+func findPoint(t *testing.T, dps []metrics.DataPoint, name string, labels map[string]string) metrics.DataPoint {
+	t.Helper()
+	for _, dp := range dps {
+		if dp.Name != name {
+			continue
+		}
+		match := true
+		for k, v := range labels {
+			if dp.Labels[k] != v {
+				match = false
+			}
+		}
+		if match {
+			return dp
+		}
+	}
+	t.Fatalf("data point %s %v not found", name, labels)
+	return metrics.DataPoint{}
+}
+
+func TestParseExposition(t *testing.T) {
+	exp, err := parseExposition(strings.NewReader(metricsPage))
+	require.NoError(t, err)
+
+	assert.Len(t, exp.samples, 8)
+	assert.Equal(t, sample{
+		name:   "queue_depth",
+		labels: map[string]string{"queue": "emails", "path": `C:\DIR\`, "msg": `say "hi"`},
+		value:  12.5,
+	}, exp.samples[2])
+	assert.Equal(t, "counter", exp.typeOf("http_requests_total"))
+	assert.Equal(t, "histogram", exp.typeOf("request_duration_seconds_bucket"))
+	assert.Equal(t, "untyped", exp.typeOf("process_open_fds"))
+}
+
+func TestScrapeCollector(t *testing.T) {
+	var mps mockPS
+	defer mps.AssertExpectations(t)
+	mps.On("Fetch", "http://localhost:9100/metrics", defaultTimeout).Return(metricsPage, nil)
+
+	c := newScrapeCollector(&mps, []config.ScrapeTarget{{
+		Name:    "app",
+		URL:     "http://localhost:9100/metrics",
+		Exclude: []string{"go_*"},
+	}})
+
+	dps, err := c.CollectAll()
+	require.NoError(t, err)
+	assert.Len(t, dps, 7)
+
+	dp := findPoint(t, dps, "scrape_http_requests_total", map[string]string{"method": "get"})
+	assert.Equal(t, 1027.0, dp.Value)
+	assert.Equal(t, map[string]string{
+		"method":   "get",
+		"code":     "200",
+		"job":      "app",
+		"instance": "localhost:9100",
+	}, dp.Labels)
+
+	assert.Equal(t, 8.0, findPoint(t, dps, "scrape_request_duration_seconds_bucket", map[string]string{"le": "+Inf"}).Value)
+}
+
+func TestScrapeCollector_IncludeAndRelabel(t *testing.T) {
+	var mps mockPS
+	mps.On("Fetch", mock.Anything, 2*time.Second).Return(metricsPage, nil)
+
+	c := newScrapeCollector(&mps, []config.ScrapeTarget{{
+		Name:           "app",
+		URL:            "http://127.0.0.1:8080/metrics",
+		Include:        []string{"http_*", "queue_*"},
+		TimeoutSeconds: 2,
+		Relabel: []config.RelabelRule{
+			{SourceLabels: []string{"code"}, Regex: "5..", Action: "drop"},
+			{SourceLabels: []string{"__name__"}, Regex: "queue_(.*)", TargetLabel: "__name__", Replacement: "jobs_${1}"},
+			{Regex: "path|msg", Action: "labeldrop"},
+			{SourceLabels: []string{"method"}, TargetLabel: "verb"},
+		},
+	}})
+
+	dps, err := c.CollectAll()
+	require.NoError(t, err)
+	require.Len(t, dps, 2)
+
+	requests := findPoint(t, dps, "scrape_http_requests_total", nil)
+	assert.Equal(t, "get", requests.Labels["verb"])
+
+	queue := findPoint(t, dps, "scrape_jobs_depth", nil)
+	assert.Equal(t, map[string]string{"queue": "emails", "job": "app", "instance": "127.0.0.1:8080"}, queue.Labels)
+}
+
+func TestScrapeCollector_TargetDown(t *testing.T) {
+	var mps mockPS
+	mps.On("Fetch", "http://localhost:9100/metrics", defaultTimeout).Return("", errors.New("connection refused"))
+	mps.On("Fetch", "http://localhost:9200/metrics", defaultTimeout).Return("up 1\n", nil)
+
+	c := newScrapeCollector(&mps, []config.ScrapeTarget{
+		{Name: "down", URL: "http://localhost:9100/metrics"},
+		{Name: "up", URL: "http://localhost:9200/metrics"},
+	})
+
+	dps, err := c.CollectAll()
+	require.NoError(t, err)
+	require.Len(t, dps, 1)
+	assert.Equal(t, "scrape_up", dps[0].Name)
+}
+
+func TestScrapeCollector_InvalidTargets(t *testing.T) {
+	c := newScrapeCollector(&mockPS{}, []config.ScrapeTarget{
+		{Name: "no-host", URL: "/metrics"},
+		{Name: "bad-regex", URL: "http://localhost/metrics", Relabel: []config.RelabelRule{{Regex: "(", TargetLabel: "x"}}},
+		{Name: "bad-action", URL: "http://localhost/metrics", Relabel: []config.RelabelRule{{Action: "hashmod"}}},
+	})
+	assert.Empty(t, c.targets)
+}
+
+func TestScrapeCollector_Discover(t *testing.T) {
+	var mps mockPS
+	mps.On("Fetch", mock.Anything, mock.Anything).Return(metricsPage, nil)
+
+	c := newScrapeCollector(&mps, []config.ScrapeTarget{{Name: "app", URL: "http://localhost:9100/metrics"}})
+	discovered, err := c.Discover()
+	require.NoError(t, err)
+
+	assert.Contains(t, discovered, collection.Metric{
+		Name:   "scrape_http_requests_total",
+		Type:   "counter",
+		Labels: map[string]string{"method": "post", "code": "500", "job": "app", "instance": "localhost:9100"},
+	})
+	assert.Contains(t, discovered, collection.Metric{
+		Name:   "scrape_process_open_fds",
+		Type:   "gauge",
+		Labels: map[string]string{"job": "app", "instance": "localhost:9100"},
+	})
+}
+
+func TestScrapeCollector_Collect(t *testing.T) {
+	var mps mockPS
+	mps.On("Fetch", mock.Anything, mock.Anything).Return(metricsPage, nil)
+
+	c := newScrapeCollector(&mps, []config.ScrapeTarget{{Name: "app", URL: "http://localhost:9100/metrics"}})
+	c.SetIncludedMetrics([]collection.Metric{{
+		Name:   "scrape_process_open_fds",
+		Labels: map[string]string{"job": "app", "instance": "localhost:9100"},
+	}})
+
+	dps, err := c.Collect()
+	require.NoError(t, err)
+	require.Len(t, dps, 1)
+	assert.Equal(t, 31.0, dps[0].Value)
+}
@@ -0,0 +1,246 @@
+package smart
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"sort"
+	"time"
+
+	"agent/internal/collection"
+	"agent/internal/logger"
+	"agent/internal/metrics"
+)
+
+// commandTimeout bounds a smartctl run, a busy drive can take a few seconds
+// to answer
+const commandTimeout = 10 * time.Second
+
+type SmartPS interface {
+	// Available reports whether smartctl can be run.
+	Available() error
+	// Scan returns the output of "smartctl --scan --json".
+	Scan() ([]byte, error)
+	// Device returns the output of "smartctl --json --all" for a device.
+	Device(name, deviceType string) ([]byte, error)
+}
+
+type systemPS struct{}
+
+func (s *systemPS) Available() error {
+	if _, err := exec.LookPath("smartctl"); err != nil {
+		return fmt.Errorf("smartctl not found, smartmontools isn't installed: %w", err)
+	}
+	return nil
+}
+
+func (s *systemPS) Scan() ([]byte, error) {
+	return smartctl("--scan", "--json")
+}
+
+func (s *systemPS) Device(name, deviceType string) ([]byte, error) {
+	// Drives in standby aren't spun up, they're skipped until they wake up
+	return smartctl("--json", "--all", "--nocheck", "standby,0", "--device", deviceType, name)
+}
+
+// smartctl runs smartctl and returns its output. Its exit status is a bit
+// mask, only the first two bits tell that the command failed: the others
+// report the health of the drive, which is read from the output.
+func smartctl(args ...string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), commandTimeout)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, "smartctl", args...).Output()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode()&0b11 == 0 {
+		err = nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("smartctl failed: %w", err)
+	}
+	return out, nil
+}
+
+// scanResult is the output of smartctl --scan
+type scanResult struct {
+	Devices []struct {
+		Name string `json:"name"`
+		Type string `json:"type"`
+	} `json:"devices"`
+}
+
+// attribute IDs of the ATA SMART table
+const (
+	reallocatedSectors = 5
+	// Normalized values of the remaining life of SSDs, depending on the
+	// vendor
+	wearLevelingCount     = 177
+	ssdLifeLeft           = 231
+	mediaWearoutIndicator = 233
+)
+
+// deviceInfo is the part of the smartctl --all output read by the collector
+type deviceInfo struct {
+	Device struct {
+		Name string `json:"name"`
+	} `json:"device"`
+	ModelName   string `json:"model_name"`
+	SmartStatus *struct {
+		Passed bool `json:"passed"`
+	} `json:"smart_status"`
+	Temperature *struct {
+		Current float64 `json:"current"`
+	} `json:"temperature"`
+	ATAAttributes *struct {
+		Table []struct {
+			ID    int `json:"id"`
+			Value int `json:"value"`
+			Raw   struct {
+				Value float64 `json:"value"`
+			} `json:"raw"`
+		} `json:"table"`
+	} `json:"ata_smart_attributes"`
+	NVMeHealth *struct {
+		PercentageUsed float64 `json:"percentage_used"`
+	} `json:"nvme_smart_health_information_log"`
+	SCSIGrownDefects *float64 `json:"scsi_grown_defect_list"`
+}
+
+// SmartCollector reports the health of the drives read by smartctl: the
+// overall assessment, temperature, reallocated sectors and wear of SSDs.
+type SmartCollector struct {
+	metrics.BaseCollector
+
+	ps SmartPS
+}
+
+func NewSmartCollector() *SmartCollector {
+	return &SmartCollector{ps: &systemPS{}}
+}
+
+func (c *SmartCollector) Name() string {
+	return "smart"
+}
+
+func (c *SmartCollector) Collect() ([]metrics.DataPoint, error) {
+	all, err := c.CollectAll()
+	if err != nil {
+		return nil, err
+	}
+	var included []metrics.DataPoint
+	for _, dp := range all {
+		if c.IsIncluded(dp.Name, dp.Labels) {
+			included = append(included, dp)
+		}
+	}
+	return included, nil
+}
+
+func (c *SmartCollector) CollectAll() ([]metrics.DataPoint, error) {
+	devices, err := c.getDevices()
+	if err != nil {
+		logger.Log.Debug("Failed to collect metrics", "collector", c.Name(), "error", err)
+		return nil, nil
+	}
+	return buildDataPoints(devices, time.Now().UnixMilli()), nil
+}
+
+func (c *SmartCollector) Discover() ([]collection.Metric, error) {
+	devices, err := c.getDevices()
+	if err != nil {
+		// smartmontools isn't installed, or the agent isn't root
+		return []collection.Metric{}, nil
+	}
+	var discovered []collection.Metric
+	for _, dp := range buildDataPoints(devices, 0) {
+		discovered = append(discovered, collection.Metric{
+			Name:   dp.Name,
+			Type:   "gauge",
+			Labels: dp.Labels,
+		})
+	}
+	return discovered, nil
+}
+
+func (c *SmartCollector) getDevices() ([]deviceInfo, error) {
+	if err := c.ps.Available(); err != nil {
+		return nil, err
+	}
+	out, err := c.ps.Scan()
+	if err != nil {
+		return nil, err
+	}
+	var scan scanResult
+	if err := json.Unmarshal(out, &scan); err != nil {
+		return nil, fmt.Errorf("failed to parse smartctl --scan: %w", err)
+	}
+	var devices []deviceInfo
+	for _, d := range scan.Devices {
+		out, err := c.ps.Device(d.Name, d.Type)
+		if err != nil {
+			// E.g. a USB bridge without SMART support
+			logger.Log.Debug("Failed to read a drive", "collector", c.Name(), "device", d.Name, "error", err)
+			continue
+		}
+		var info deviceInfo
+		if err := json.Unmarshal(out, &info); err != nil {
+			logger.Log.Debug("Failed to parse smartctl output", "collector", c.Name(), "device", d.Name, "error", err)
+			continue
+		}
+		if info.Device.Name == "" {
+			info.Device.Name = d.Name
+		}
+		devices = append(devices, info)
+	}
+	return devices, nil
+}
+
+func buildDataPoints(devices []deviceInfo, ts int64) []metrics.DataPoint {
+	var results []metrics.DataPoint
+	for _, d := range devices {
+		labels := map[string]string{"device": d.Device.Name}
+		if d.ModelName != "" {
+			labels["model"] = d.ModelName
+		}
+		add := func(name string, value float64) {
+			results = append(results, metrics.DataPoint{Name: name, Timestamp: ts, Value: value, Labels: labels})
+		}
+
+		// Missing for drives in standby
+		if d.SmartStatus != nil {
+			passed := 0.0
+			if d.SmartStatus.Passed {
+				passed = 1
+			}
+			add("smart_health_ok", passed)
+		}
+		if d.Temperature != nil {
+			add("smart_temperature_celsius", d.Temperature.Current)
+		}
+		if d.SCSIGrownDefects != nil {
+			add("smart_reallocated_sectors", *d.SCSIGrownDefects)
+		}
+		if d.NVMeHealth != nil {
+			add("smart_wear_ratio", d.NVMeHealth.PercentageUsed/100)
+		}
+		if d.ATAAttributes == nil {
+			continue
+		}
+		wear := false
+		for _, attr := range d.ATAAttributes.Table {
+			switch attr.ID {
+			case reallocatedSectors:
+				add("smart_reallocated_sectors", attr.Raw.Value)
+			case wearLevelingCount, ssdLifeLeft, mediaWearoutIndicator:
+				// The normalized value is the remaining life in percent
+				if !wear {
+					wear = true
+					add("smart_wear_ratio", float64(100-attr.Value)/100)
+				}
+			}
+		}
+	}
+	sort.SliceStable(results, func(i, j int) bool { return results[i].Name < results[j].Name })
+	return results
+}
@@ -0,0 +1,123 @@
+package smart
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"agent/internal/logger"
+	"agent/internal/metrics"
+)
+
+func init() {
+	logger.Log = slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+type mockPS struct {
+	mock.Mock
+}
+
+func (m *mockPS) Available() error {
+	return m.Called().Error(0)
+}
+
+func (m *mockPS) Scan() ([]byte, error) {
+	args := m.Called()
+	out, _ := args.Get(0).([]byte)
+	return out, args.Error(1)
+}
+
+func (m *mockPS) Device(name, deviceType string) ([]byte, error) {
+	args := m.Called(name, deviceType)
+	out, _ := args.Get(0).([]byte)
+	return out, args.Error(1)
+}
+
+const scan = `{
+  "devices": [
+    {"name": "/dev/sda", "info_name": "/dev/sda [SAT]", "type": "sat", "protocol": "ATA"},
+    {"name": "/dev/nvme0", "info_name": "/dev/nvme0", "type": "nvme", "protocol": "NVMe"},
+    {"name": "/dev/sdb", "info_name": "/dev/sdb", "type": "sat", "protocol": "ATA"}
+  ]
+}`
+
+const ataDevice = `{
+  "device": {"name": "/dev/sda", "type": "sat"},
+  "model_name": "Samsung SSD 860 EVO 500GB",
+  "smart_status": {"passed": false},
+  "temperature": {"current": 34},
+  "ata_smart_attributes": {
+    "table": [
+      {"id": 5, "name": "Reallocated_Sector_Ct", "value": 100, "raw": {"value": 12}},
+      {"id": 9, "name": "Power_On_Hours", "value": 95, "raw": {"value": 21000}},
+      {"id": 177, "name": "Wear_Leveling_Count", "value": 91, "raw": {"value": 120}}
+    ]
+  }
+}`
+
+const nvmeDevice = `{
+  "device": {"name": "/dev/nvme0", "type": "nvme"},
+  "model_name": "WD Blue SN570 1TB",
+  "smart_status": {"passed": true},
+  "temperature": {"current": 41},
+  "nvme_smart_health_information_log": {"percentage_used": 3, "media_errors": 0}
+}`
+
+func findPoint(t *testing.T, dps []metrics.DataPoint, name, device string) metrics.DataPoint {
+	t.Helper()
+	for _, dp := range dps {
+		if dp.Name == name && dp.Labels["device"] == device {
+			return dp
+		}
+	}
+	t.Fatalf("data point %s{device=%s} not found", name, device)
+	return metrics.DataPoint{}
+}
+
+func TestSmartCollector(t *testing.T) {
+	var mps mockPS
+	defer mps.AssertExpectations(t)
+	mps.On("Available").Return(nil)
+	mps.On("Scan").Return([]byte(scan), nil)
+	mps.On("Device", "/dev/sda", "sat").Return([]byte(ataDevice), nil)
+	mps.On("Device", "/dev/nvme0", "nvme").Return([]byte(nvmeDevice), nil)
+	mps.On("Device", "/dev/sdb", "sat").Return(nil, errors.New("smartctl failed: exit status 2"))
+
+	c := &SmartCollector{ps: &mps}
+	dps, err := c.CollectAll()
+	require.NoError(t, err)
+
+	assert.Equal(t, 0.0, findPoint(t, dps, "smart_health_ok", "/dev/sda").Value)
+	assert.Equal(t, 34.0, findPoint(t, dps, "smart_temperature_celsius", "/dev/sda").Value)
+	assert.Equal(t, 12.0, findPoint(t, dps, "smart_reallocated_sectors", "/dev/sda").Value)
+	assert.InDelta(t, 0.09, findPoint(t, dps, "smart_wear_ratio", "/dev/sda").Value, 1e-9)
+	assert.Equal(t, "Samsung SSD 860 EVO 500GB", findPoint(t, dps, "smart_health_ok", "/dev/sda").Labels["model"])
+
+	assert.Equal(t, 1.0, findPoint(t, dps, "smart_health_ok", "/dev/nvme0").Value)
+	assert.Equal(t, 41.0, findPoint(t, dps, "smart_temperature_celsius", "/dev/nvme0").Value)
+	assert.InDelta(t, 0.03, findPoint(t, dps, "smart_wear_ratio", "/dev/nvme0").Value, 1e-9)
+
+	for _, dp := range dps {
+		assert.NotEqual(t, "/dev/sdb", dp.Labels["device"], "drives that can't be read are skipped")
+	}
+}
+
+func TestSmartCollectorUnavailable(t *testing.T) {
+	var mps mockPS
+	defer mps.AssertExpectations(t)
+	mps.On("Available").Return(errors.New("smartctl not found, smartmontools isn't installed"))
+
+	c := &SmartCollector{ps: &mps}
+	dps, err := c.CollectAll()
+	assert.NoError(t, err)
+	assert.Empty(t, dps)
+
+	discovered, err := c.Discover()
+	assert.NoError(t, err)
+	assert.Empty(t, discovered)
+}
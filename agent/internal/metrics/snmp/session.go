@@ -0,0 +1,166 @@
+package snmp
+
+import (
+	"fmt"
+	"math/big"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gosnmp/gosnmp"
+
+	"agent/internal/config"
+)
+
+var authProtocols = map[string]gosnmp.SnmpV3AuthProtocol{
+	"MD5":    gosnmp.MD5,
+	"SHA":    gosnmp.SHA,
+	"SHA224": gosnmp.SHA224,
+	"SHA256": gosnmp.SHA256,
+	"SHA384": gosnmp.SHA384,
+	"SHA512": gosnmp.SHA512,
+}
+
+var privProtocols = map[string]gosnmp.SnmpV3PrivProtocol{
+	"DES":    gosnmp.DES,
+	"AES":    gosnmp.AES,
+	"AES192": gosnmp.AES192,
+	"AES256": gosnmp.AES256,
+}
+
+type systemPS struct {
+	timeout time.Duration
+}
+
+func (s *systemPS) Open(target config.SNMPTarget) (Session, error) {
+	host, port := target.Address, uint16(161)
+	if h, p, err := net.SplitHostPort(target.Address); err == nil {
+		n, err := strconv.ParseUint(p, 10, 16)
+		if err != nil {
+			return nil, fmt.Errorf("invalid snmp port %q", p)
+		}
+		host, port = h, uint16(n)
+	}
+
+	client := &gosnmp.GoSNMP{
+		Target:    host,
+		Port:      port,
+		Transport: "udp",
+		Timeout:   s.timeout,
+		Retries:   1,
+		MaxOids:   gosnmp.MaxOids,
+	}
+	switch target.Version {
+	case "", "2c":
+		client.Version = gosnmp.Version2c
+		client.Community = target.Community
+		if client.Community == "" {
+			client.Community = "public"
+		}
+	case "3":
+		params, flags, err := usmParameters(target)
+		if err != nil {
+			return nil, err
+		}
+		client.Version = gosnmp.Version3
+		client.SecurityModel = gosnmp.UserSecurityModel
+		client.MsgFlags = flags
+		client.SecurityParameters = params
+	default:
+		return nil, fmt.Errorf("unsupported snmp version %q", target.Version)
+	}
+
+	if err := client.Connect(); err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", target.Address, err)
+	}
+	return &session{client: client}, nil
+}
+
+// usmParameters builds the SNMP v3 security parameters of a target. The
+// security level follows the protocols that are set.
+func usmParameters(target config.SNMPTarget) (*gosnmp.UsmSecurityParameters, gosnmp.SnmpV3MsgFlags, error) {
+	params := &gosnmp.UsmSecurityParameters{UserName: target.Username}
+	flags := gosnmp.NoAuthNoPriv
+	if target.AuthProtocol != "" {
+		auth, ok := authProtocols[strings.ToUpper(target.AuthProtocol)]
+		if !ok {
+			return nil, 0, fmt.Errorf("unsupported snmp auth protocol %q", target.AuthProtocol)
+		}
+		params.AuthenticationProtocol = auth
+		params.AuthenticationPassphrase = target.AuthPassword
+		flags = gosnmp.AuthNoPriv
+	}
+	if target.PrivProtocol != "" {
+		if flags == gosnmp.NoAuthNoPriv {
+			return nil, 0, fmt.Errorf("snmp privacy requires an auth protocol")
+		}
+		priv, ok := privProtocols[strings.ToUpper(target.PrivProtocol)]
+		if !ok {
+			return nil, 0, fmt.Errorf("unsupported snmp privacy protocol %q", target.PrivProtocol)
+		}
+		params.PrivacyProtocol = priv
+		params.PrivacyPassphrase = target.PrivPassword
+		flags = gosnmp.AuthPriv
+	}
+	return params, flags, nil
+}
+
+type session struct {
+	client *gosnmp.GoSNMP
+}
+
+func (s *session) Get(oids []string) (map[string]value, error) {
+	values := make(map[string]value, len(oids))
+	// Devices reject requests with too many variables, split them
+	for start := 0; start < len(oids); start += s.client.MaxOids {
+		end := min(start+s.client.MaxOids, len(oids))
+		packet, err := s.client.Get(oids[start:end])
+		if err != nil {
+			return nil, err
+		}
+		for _, pdu := range packet.Variables {
+			if v, ok := pduValue(pdu); ok {
+				values[strings.TrimPrefix(pdu.Name, ".")] = v
+			}
+		}
+	}
+	return values, nil
+}
+
+func (s *session) Walk(root string) (map[string]value, error) {
+	pdus, err := s.client.BulkWalkAll(root)
+	if err != nil {
+		return nil, err
+	}
+	rows := make(map[string]value, len(pdus))
+	for _, pdu := range pdus {
+		index, ok := strings.CutPrefix(strings.TrimPrefix(pdu.Name, "."), root+".")
+		if !ok {
+			continue
+		}
+		if v, ok := pduValue(pdu); ok {
+			rows[index] = v
+		}
+	}
+	return rows, nil
+}
+
+func (s *session) Close() error {
+	return s.client.Conn.Close()
+}
+
+// pduValue converts a variable, it returns false for missing objects and
+// unsupported types.
+func pduValue(pdu gosnmp.SnmpPDU) (value, bool) {
+	switch pdu.Type {
+	case gosnmp.OctetString:
+		b, _ := pdu.Value.([]byte)
+		return value{Text: string(b)}, true
+	case gosnmp.Integer, gosnmp.Counter32, gosnmp.Gauge32, gosnmp.TimeTicks, gosnmp.Counter64, gosnmp.Uinteger32:
+		n, _ := new(big.Float).SetInt(gosnmp.ToBigInt(pdu.Value)).Float64()
+		return value{Number: n, Numeric: true}, true
+	default:
+		return value{}, false
+	}
+}
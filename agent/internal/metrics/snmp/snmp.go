@@ -0,0 +1,383 @@
+package snmp
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"agent/internal/collection"
+	"agent/internal/config"
+	"agent/internal/logger"
+	"agent/internal/metrics"
+)
+
+// value is a single variable read from a device. Numeric types (integers,
+// counters, gauges, timeticks) are stored in Number, octet strings in Text.
+type value struct {
+	Number  float64
+	Text    string
+	Numeric bool
+}
+
+// label returns the value as a label string.
+func (v value) label() string {
+	if v.Numeric {
+		return strconv.FormatFloat(v.Number, 'f', -1, 64)
+	}
+	return v.Text
+}
+
+// Session is an open connection to a device.
+type Session interface {
+	// Get reads scalar OIDs, missing objects are left out of the result.
+	Get(oids []string) (map[string]value, error)
+	// Walk reads an OID table. The result is keyed by the row index, that is
+	// the OID suffix following root.
+	Walk(root string) (map[string]value, error)
+	Close() error
+}
+
+type SNMPPS interface {
+	Open(target config.SNMPTarget) (Session, error)
+}
+
+// metricDef maps an OID, or an OID table, to a metric.
+type metricDef struct {
+	name     string
+	oid      string
+	table    bool
+	labelOID string // Value used for the row label, the row index when empty
+	label    string
+	scale    float64
+	rate     bool // Report the per second rate of a counter
+	getVal   func(v float64) float64
+}
+
+const (
+	oidIfName            = "1.3.6.1.2.1.31.1.1.1.1"
+	oidEntPhySensorType  = "1.3.6.1.2.1.99.1.1.1.1"
+	oidEntPhySensorScale = "1.3.6.1.2.1.99.1.1.1.3"
+	oidEntPhySensorValue = "1.3.6.1.2.1.99.1.1.1.4"
+	oidEntPhysicalName   = "1.3.6.1.2.1.47.1.1.1.1.7"
+
+	sensorTypeCelsius = 8
+)
+
+// modules list the built-in metric sets, polled on every target unless the
+// target selects a subset. The sensors module is read by collectSensors.
+var modules = map[string][]metricDef{
+	"system": {
+		{name: "snmp_uptime_seconds", oid: "1.3.6.1.2.1.1.3.0", scale: 0.01}, // sysUpTime, in hundredths of seconds
+	},
+	"interfaces": {
+		{name: "snmp_if_in_bytes_bps", oid: "1.3.6.1.2.1.31.1.1.1.6", table: true, labelOID: oidIfName, label: "interface", rate: true},   // ifHCInOctets
+		{name: "snmp_if_out_bytes_bps", oid: "1.3.6.1.2.1.31.1.1.1.10", table: true, labelOID: oidIfName, label: "interface", rate: true}, // ifHCOutOctets
+		{name: "snmp_if_in_errors_rate", oid: "1.3.6.1.2.1.2.2.1.14", table: true, labelOID: oidIfName, label: "interface", rate: true},   // ifInErrors
+		{name: "snmp_if_out_errors_rate", oid: "1.3.6.1.2.1.2.2.1.20", table: true, labelOID: oidIfName, label: "interface", rate: true},  // ifOutErrors
+		{name: "snmp_if_oper_up", oid: "1.3.6.1.2.1.2.2.1.8", table: true, labelOID: oidIfName, label: "interface", getVal: func(v float64) float64 {
+			// ifOperStatus: 1 is up, everything else (down, testing, dormant...) is not
+			if v == 1 {
+				return 1
+			}
+			return 0
+		}},
+	},
+	"cpu": {
+		{name: "snmp_cpu_load_ratio", oid: "1.3.6.1.2.1.25.3.3.1.2", table: true, label: "cpu", scale: 0.01}, // hrProcessorLoad, in percent
+	},
+	"sensors": nil,
+}
+
+type sample struct {
+	value float64
+	ts    int64
+}
+
+// SNMPCollector polls network devices (switches, routers...) over SNMP.
+type SNMPCollector struct {
+	metrics.BaseCollector
+
+	ps      SNMPPS
+	targets []config.SNMPTarget
+	// last stores the previous counter values used to compute rates, keyed
+	// by series.
+	last map[string]sample
+}
+
+func NewSNMPCollector(cfg *config.Config) *SNMPCollector {
+	return newSNMPCollector(&systemPS{timeout: 5 * time.Second}, cfg.SNMPTargets)
+}
+
+func newSNMPCollector(ps SNMPPS, targets []config.SNMPTarget) *SNMPCollector {
+	return &SNMPCollector{
+		ps:      ps,
+		targets: targets,
+		last:    make(map[string]sample),
+	}
+}
+
+func (c *SNMPCollector) Name() string {
+	return "snmp"
+}
+
+func (c *SNMPCollector) Collect() ([]metrics.DataPoint, error) {
+	all, err := c.CollectAll()
+	if err != nil {
+		return nil, err
+	}
+	var included []metrics.DataPoint
+	for _, dp := range all {
+		if c.IsIncluded(dp.Name, dp.Labels) {
+			included = append(included, dp)
+		}
+	}
+	return included, nil
+}
+
+func (c *SNMPCollector) CollectAll() ([]metrics.DataPoint, error) {
+	var results []metrics.DataPoint
+	for _, target := range c.targets {
+		dps, err := c.collectTarget(target)
+		if err != nil {
+			logger.Log.Debug("Failed to collect metrics", "collector", c.Name(), "device", target.Name, "error", err)
+			continue
+		}
+		results = append(results, dps...)
+	}
+	return results, nil
+}
+
+func (c *SNMPCollector) Discover() ([]collection.Metric, error) {
+	var discovered []collection.Metric
+	for _, target := range c.targets {
+		dps, err := c.collectTarget(target)
+		if err != nil {
+			continue
+		}
+		for _, dp := range dps {
+			discovered = append(discovered, collection.Metric{
+				Name:   dp.Name,
+				Type:   "gauge",
+				Labels: dp.Labels,
+			})
+		}
+	}
+	return discovered, nil
+}
+
+func (c *SNMPCollector) collectTarget(target config.SNMPTarget) ([]metrics.DataPoint, error) {
+	session, err := c.ps.Open(target)
+	if err != nil {
+		return nil, err
+	}
+	defer session.Close()
+
+	timestamp := time.Now().UnixMilli()
+	defs, sensors, err := targetMetrics(target)
+	if err != nil {
+		return nil, err
+	}
+
+	var scalars []string
+	for _, def := range defs {
+		if !def.table {
+			scalars = append(scalars, def.oid)
+		}
+	}
+	var scalarValues map[string]value
+	if len(scalars) > 0 {
+		if scalarValues, err = session.Get(scalars); err != nil {
+			return nil, err
+		}
+	}
+
+	// Label tables (e.g. ifName) are shared by several metrics, walk each once
+	walks := make(map[string]map[string]value)
+	walk := func(oid string) (map[string]value, error) {
+		if rows, ok := walks[oid]; ok {
+			return rows, nil
+		}
+		rows, err := session.Walk(oid)
+		if err != nil {
+			return nil, err
+		}
+		walks[oid] = rows
+		return rows, nil
+	}
+
+	var results []metrics.DataPoint
+	for _, def := range defs {
+		if !def.table {
+			v, ok := scalarValues[def.oid]
+			if !ok || !v.Numeric {
+				continue
+			}
+			labels := map[string]string{"device": target.Name}
+			results = append(results, c.dataPoint(def, v.Number, labels, timestamp))
+			continue
+		}
+
+		rows, err := walk(def.oid)
+		if err != nil {
+			return nil, err
+		}
+		var names map[string]value
+		if def.labelOID != "" {
+			if names, err = walk(def.labelOID); err != nil {
+				return nil, err
+			}
+		}
+		for _, index := range sortedKeys(rows) {
+			v := rows[index]
+			if !v.Numeric {
+				continue
+			}
+			rowLabel := index
+			if n, ok := names[index]; ok && n.label() != "" {
+				rowLabel = n.label()
+			}
+			labels := map[string]string{"device": target.Name, def.label: rowLabel}
+			results = append(results, c.dataPoint(def, v.Number, labels, timestamp))
+		}
+	}
+
+	if sensors {
+		dps, err := collectSensors(target.Name, walk, timestamp)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, dps...)
+	}
+	return results, nil
+}
+
+// dataPoint applies the scale and rate of def to a raw value.
+func (c *SNMPCollector) dataPoint(def metricDef, raw float64, labels map[string]string, ts int64) metrics.DataPoint {
+	val := raw
+	if def.rate {
+		key := seriesKey(def.name, labels)
+		previous, ok := c.last[key]
+		c.last[key] = sample{value: raw, ts: ts}
+		// A counter going backwards wrapped or the device rebooted
+		if !ok || ts <= previous.ts || raw < previous.value {
+			val = 0
+		} else {
+			val = (raw - previous.value) / float64(ts-previous.ts) * 1000
+		}
+	}
+	if def.getVal != nil {
+		val = def.getVal(val)
+	}
+	if def.scale != 0 {
+		val *= def.scale
+	}
+	return metrics.DataPoint{Name: def.name, Timestamp: ts, Value: val, Labels: labels}
+}
+
+// collectSensors reports the temperature sensors of the ENTITY-SENSOR-MIB.
+func collectSensors(device string, walk func(string) (map[string]value, error), ts int64) ([]metrics.DataPoint, error) {
+	types, err := walk(oidEntPhySensorType)
+	if err != nil {
+		return nil, err
+	}
+	var values, precisions, names map[string]value
+	for oid, dst := range map[string]*map[string]value{
+		oidEntPhySensorValue: &values,
+		oidEntPhySensorScale: &precisions,
+		oidEntPhysicalName:   &names,
+	} {
+		if *dst, err = walk(oid); err != nil {
+			return nil, err
+		}
+	}
+
+	var results []metrics.DataPoint
+	for _, index := range sortedKeys(types) {
+		if t := types[index]; !t.Numeric || t.Number != sensorTypeCelsius {
+			continue
+		}
+		v, ok := values[index]
+		if !ok || !v.Numeric {
+			continue
+		}
+		// entPhySensorPrecision is the number of decimal places of the value
+		val := v.Number
+		if p, ok := precisions[index]; ok && p.Numeric {
+			val /= math.Pow10(int(p.Number))
+		}
+		sensor := index
+		if n, ok := names[index]; ok && n.label() != "" {
+			sensor = n.label()
+		}
+		results = append(results, metrics.DataPoint{
+			Name:      "snmp_sensor_temperature_celsius",
+			Timestamp: ts,
+			Value:     val,
+			Labels:    map[string]string{"device": device, "sensor": sensor},
+		})
+	}
+	return results, nil
+}
+
+// targetMetrics returns the metric definitions polled on a target and
+// whether its temperature sensors are read.
+func targetMetrics(target config.SNMPTarget) ([]metricDef, bool, error) {
+	selected := target.Modules
+	if len(selected) == 0 {
+		selected = sortedKeys(modules)
+	}
+
+	var defs []metricDef
+	sensors := false
+	for _, name := range selected {
+		module, ok := modules[name]
+		if !ok {
+			return nil, false, fmt.Errorf("unknown snmp module %q", name)
+		}
+		if name == "sensors" {
+			sensors = true
+		}
+		defs = append(defs, module...)
+	}
+
+	for _, m := range target.Metrics {
+		if m.Name == "" || m.OID == "" {
+			return nil, false, fmt.Errorf("snmp metric requires a name and an oid")
+		}
+		label := m.Label
+		if label == "" {
+			label = "index"
+		}
+		defs = append(defs, metricDef{
+			name:     "snmp_" + m.Name,
+			oid:      strings.TrimPrefix(m.OID, "."),
+			table:    m.Table,
+			labelOID: strings.TrimPrefix(m.LabelOID, "."),
+			label:    label,
+			scale:    m.Scale,
+			rate:     m.Rate,
+		})
+	}
+	return defs, sensors, nil
+}
+
+func seriesKey(name string, labels map[string]string) string {
+	var b strings.Builder
+	b.WriteString(name)
+	for _, k := range sortedKeys(labels) {
+		b.WriteString("|" + k + "=" + labels[k])
+	}
+	return b.String()
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,239 @@
+package snmp
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+
+	"github.com/gosnmp/gosnmp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"agent/internal/config"
+	"agent/internal/logger"
+	"agent/internal/metrics"
+)
+
+func init() {
+	logger.Log = slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+type mockPS struct {
+	mock.Mock
+}
+
+func (m *mockPS) Open(target config.SNMPTarget) (Session, error) {
+	args := m.Called(target)
+	s, _ := args.Get(0).(Session)
+	return s, args.Error(1)
+}
+
+type mockSession struct {
+	mock.Mock
+}
+
+func (m *mockSession) Get(oids []string) (map[string]value, error) {
+	args := m.Called(oids)
+	v, _ := args.Get(0).(map[string]value)
+	return v, args.Error(1)
+}
+
+func (m *mockSession) Walk(root string) (map[string]value, error) {
+	args := m.Called(root)
+	v, _ := args.Get(0).(map[string]value)
+	return v, args.Error(1)
+}
+
+func (m *mockSession) Close() error {
+	return m.Called().Error(0)
+}
+
+func num(v float64) value {
+	return value{Number: v, Numeric: true}
+}
+
+func text(v string) value {
+	return value{Text: v}
+}
+
+func findPoint(t *testing.T, dps []metrics.DataPoint, name string, labels map[string]string) metrics.DataPoint {
+	t.Helper()
+	for _, dp := range dps {
+		if dp.Name != name {
+			continue
+		}
+		match := true
+		for k, v := range labels {
+			if dp.Labels[k] != v {
+				match = false
+			}
+		}
+		if match {
+			return dp
+		}
+	}
+	t.Fatalf("data point %s %v not found", name, labels)
+	return metrics.DataPoint{}
+}
+
+func TestSNMPCollectorModules(t *testing.T) {
+	target := config.SNMPTarget{Name: "core-sw", Address: "10.0.0.2"}
+	var sess mockSession
+	defer sess.AssertExpectations(t)
+	sess.On("Get", []string{"1.3.6.1.2.1.1.3.0"}).Return(map[string]value{"1.3.6.1.2.1.1.3.0": num(12345)}, nil)
+	sess.On("Walk", oidIfName).Return(map[string]value{"1": text("eth0"), "2": text("eth1")}, nil).Once()
+	sess.On("Walk", "1.3.6.1.2.1.31.1.1.1.6").Return(map[string]value{"1": num(1000), "2": num(0)}, nil).Once()
+	sess.On("Walk", "1.3.6.1.2.1.31.1.1.1.10").Return(map[string]value{"1": num(2000), "2": num(0)}, nil).Once()
+	sess.On("Walk", "1.3.6.1.2.1.2.2.1.14").Return(map[string]value{"1": num(0)}, nil).Once()
+	sess.On("Walk", "1.3.6.1.2.1.2.2.1.20").Return(map[string]value{"1": num(0)}, nil).Once()
+	sess.On("Walk", "1.3.6.1.2.1.2.2.1.8").Return(map[string]value{"1": num(1), "2": num(2)}, nil).Once()
+	sess.On("Walk", "1.3.6.1.2.1.25.3.3.1.2").Return(map[string]value{"196608": num(37)}, nil).Once()
+	sess.On("Walk", oidEntPhySensorType).Return(map[string]value{"10": num(8), "11": num(10)}, nil).Once()
+	sess.On("Walk", oidEntPhySensorValue).Return(map[string]value{"10": num(415), "11": num(3000)}, nil).Once()
+	sess.On("Walk", oidEntPhySensorScale).Return(map[string]value{"10": num(1), "11": num(0)}, nil).Once()
+	sess.On("Walk", oidEntPhysicalName).Return(map[string]value{"10": text("CPU temp")}, nil).Once()
+	sess.On("Close").Return(nil)
+
+	var mps mockPS
+	defer mps.AssertExpectations(t)
+	mps.On("Open", target).Return(&sess, nil)
+
+	c := newSNMPCollector(&mps, []config.SNMPTarget{target})
+	dps, err := c.CollectAll()
+	require.NoError(t, err)
+
+	assert.InDelta(t, 123.45, findPoint(t, dps, "snmp_uptime_seconds", map[string]string{"device": "core-sw"}).Value, 0.001)
+	assert.Equal(t, 0.0, findPoint(t, dps, "snmp_if_in_bytes_bps", map[string]string{"interface": "eth0"}).Value)
+	assert.Equal(t, 1.0, findPoint(t, dps, "snmp_if_oper_up", map[string]string{"interface": "eth0"}).Value)
+	assert.Equal(t, 0.0, findPoint(t, dps, "snmp_if_oper_up", map[string]string{"interface": "eth1"}).Value)
+	assert.InDelta(t, 0.37, findPoint(t, dps, "snmp_cpu_load_ratio", map[string]string{"cpu": "196608"}).Value, 0.001)
+	assert.InDelta(t, 41.5, findPoint(t, dps, "snmp_sensor_temperature_celsius", map[string]string{"sensor": "CPU temp"}).Value, 0.001)
+
+	for _, dp := range dps {
+		assert.Equal(t, "core-sw", dp.Labels["device"])
+		assert.NotEqual(t, "11", dp.Labels["sensor"], "only celsius sensors are reported")
+	}
+}
+
+func TestSNMPCollectorRates(t *testing.T) {
+	target := config.SNMPTarget{
+		Name:    "edge",
+		Address: "10.0.0.1",
+		Modules: []string{"interfaces"},
+	}
+	var sess mockSession
+	sess.On("Walk", oidIfName).Return(map[string]value{"1": text("ge-0/0/0")}, nil)
+	sess.On("Walk", "1.3.6.1.2.1.31.1.1.1.6").Return(map[string]value{"1": num(5000)}, nil)
+	sess.On("Walk", "1.3.6.1.2.1.31.1.1.1.10").Return(map[string]value{"1": num(0)}, nil)
+	sess.On("Walk", "1.3.6.1.2.1.2.2.1.14").Return(map[string]value{}, nil)
+	sess.On("Walk", "1.3.6.1.2.1.2.2.1.20").Return(map[string]value{}, nil)
+	sess.On("Walk", "1.3.6.1.2.1.2.2.1.8").Return(map[string]value{"1": num(1)}, nil)
+	sess.On("Close").Return(nil)
+
+	var mps mockPS
+	mps.On("Open", target).Return(&sess, nil)
+
+	c := newSNMPCollector(&mps, []config.SNMPTarget{target})
+	labels := map[string]string{"device": "edge", "interface": "ge-0/0/0"}
+	// Previous reading taken two seconds ago
+	c.last[seriesKey("snmp_if_in_bytes_bps", labels)] = sample{value: 1000, ts: 0}
+
+	dps, err := c.CollectAll()
+	require.NoError(t, err)
+	dp := findPoint(t, dps, "snmp_if_in_bytes_bps", labels)
+	assert.Greater(t, dp.Value, 0.0)
+	assert.InDelta(t, 4000.0/float64(dp.Timestamp)*1000, dp.Value, 0.001)
+
+	// A counter going backwards (wrap or reboot) reports no rate
+	c.last[seriesKey("snmp_if_in_bytes_bps", labels)] = sample{value: 9000, ts: 0}
+	dps, err = c.CollectAll()
+	require.NoError(t, err)
+	assert.Equal(t, 0.0, findPoint(t, dps, "snmp_if_in_bytes_bps", labels).Value)
+}
+
+func TestSNMPCollectorCustomMetrics(t *testing.T) {
+	target := config.SNMPTarget{
+		Name:    "ups",
+		Address: "10.0.0.9",
+		Modules: []string{"system"},
+		Metrics: []config.SNMPMetric{
+			{Name: "battery_charge_ratio", OID: ".1.3.6.1.2.1.33.1.2.4.0", Scale: 0.01},
+			{Name: "input_voltage", OID: "1.3.6.1.2.1.33.1.3.3.1.3", Table: true, Label: "line"},
+		},
+	}
+	var sess mockSession
+	sess.On("Get", []string{"1.3.6.1.2.1.1.3.0", "1.3.6.1.2.1.33.1.2.4.0"}).Return(map[string]value{
+		"1.3.6.1.2.1.33.1.2.4.0": num(87),
+	}, nil)
+	sess.On("Walk", "1.3.6.1.2.1.33.1.3.3.1.3").Return(map[string]value{"1": num(230), "2": text("n/a")}, nil)
+	sess.On("Close").Return(nil)
+
+	var mps mockPS
+	mps.On("Open", target).Return(&sess, nil)
+
+	c := newSNMPCollector(&mps, []config.SNMPTarget{target})
+	dps, err := c.CollectAll()
+	require.NoError(t, err)
+	require.Len(t, dps, 2, "missing and non numeric values are skipped")
+	assert.InDelta(t, 0.87, findPoint(t, dps, "snmp_battery_charge_ratio", nil).Value, 0.001)
+	assert.Equal(t, 230.0, findPoint(t, dps, "snmp_input_voltage", map[string]string{"line": "1"}).Value)
+}
+
+func TestSNMPCollectorTargetFailure(t *testing.T) {
+	down := config.SNMPTarget{Name: "down", Address: "10.0.0.3"}
+	unknown := config.SNMPTarget{Name: "bad", Address: "10.0.0.4", Modules: []string{"bgp"}}
+	var sess mockSession
+	sess.On("Close").Return(nil)
+
+	var mps mockPS
+	mps.On("Open", down).Return(nil, errors.New("timeout"))
+	mps.On("Open", unknown).Return(&sess, nil)
+
+	c := newSNMPCollector(&mps, []config.SNMPTarget{down, unknown})
+	dps, err := c.CollectAll()
+	assert.NoError(t, err)
+	assert.Empty(t, dps)
+
+	discovered, err := c.Discover()
+	assert.NoError(t, err)
+	assert.Empty(t, discovered)
+}
+
+func TestUSMParameters(t *testing.T) {
+	params, flags, err := usmParameters(config.SNMPTarget{
+		Username:     "monitor",
+		AuthProtocol: "sha256",
+		AuthPassword: "authpass",
+		PrivProtocol: "AES",
+		PrivPassword: "privpass",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, gosnmp.AuthPriv, flags)
+	assert.Equal(t, gosnmp.SHA256, params.AuthenticationProtocol)
+	assert.Equal(t, gosnmp.AES, params.PrivacyProtocol)
+
+	_, flags, err = usmParameters(config.SNMPTarget{Username: "monitor"})
+	require.NoError(t, err)
+	assert.Equal(t, gosnmp.NoAuthNoPriv, flags)
+
+	_, _, err = usmParameters(config.SNMPTarget{Username: "monitor", PrivProtocol: "AES"})
+	assert.Error(t, err)
+
+	_, _, err = usmParameters(config.SNMPTarget{Username: "monitor", AuthProtocol: "CRC"})
+	assert.Error(t, err)
+}
+
+func TestPDUValue(t *testing.T) {
+	v, ok := pduValue(gosnmp.SnmpPDU{Type: gosnmp.Counter64, Value: uint64(1 << 40)})
+	assert.True(t, ok)
+	assert.Equal(t, float64(1<<40), v.Number)
+
+	v, ok = pduValue(gosnmp.SnmpPDU{Type: gosnmp.OctetString, Value: []byte("Gi0/1")})
+	assert.True(t, ok)
+	assert.Equal(t, "Gi0/1", v.label())
+
+	_, ok = pduValue(gosnmp.SnmpPDU{Type: gosnmp.NoSuchInstance})
+	assert.False(t, ok)
+}
@@ -1,12 +1,31 @@
 package status
 
 import (
+	"sync/atomic"
 	"time"
 
 	"agent/internal/collection"
 	"agent/internal/metrics"
+	"agent/internal/selfstats"
+	"agent/internal/version"
 )
 
+// started is when the agent process started, the status collector is built
+// again on every reload
+var started = time.Now()
+
+// configHash is the hash of the collection config in use, empty without one
+var configHash atomic.Value
+
+// SetConfigHash sets the hash of the collection config reported with the
+// heartbeat.
+func SetConfigHash(hash string) {
+	configHash.Store(hash)
+}
+
+// StatusCollector reports the heartbeat, labelled with the agent version and
+// the hash of its collection config, the uptime and the self-metrics, so that
+// an agent that runs but doesn't work properly can be told from the backend.
 type StatusCollector struct {
 	metrics.BaseCollector
 }
@@ -26,14 +45,34 @@ func (c *StatusCollector) Collect() ([]metrics.DataPoint, error) {
 func (c *StatusCollector) CollectAll() ([]metrics.DataPoint, error) {
 	timestamp := time.Now().UnixMilli()
 
-	return []metrics.DataPoint{
+	heartbeatLabels := map[string]string{"version": version.Version}
+	if hash, _ := configHash.Load().(string); hash != "" {
+		heartbeatLabels["config_hash"] = hash
+	}
+	results := []metrics.DataPoint{
 		{
 			Name:      "heartbeat",
 			Timestamp: timestamp,
 			Value:     1,
+			Labels:    heartbeatLabels,
+		},
+		{
+			Name:      "agent_uptime_seconds",
+			Timestamp: timestamp,
+			Value:     time.Since(started).Seconds(),
 			Labels:    map[string]string{},
 		},
-	}, nil
+	}
+	// Self-metrics kept by the other components of the agent
+	for _, s := range selfstats.Snapshot() {
+		results = append(results, metrics.DataPoint{
+			Name:      s.Name,
+			Timestamp: timestamp,
+			Value:     s.Value,
+			Labels:    s.Labels,
+		})
+	}
+	return results, nil
 }
 
 func (c *StatusCollector) Discover() ([]collection.Metric, error) {
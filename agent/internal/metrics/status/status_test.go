@@ -5,21 +5,52 @@ import (
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+
+	"agent/internal/selfstats"
+	"agent/internal/version"
 )
 
 func TestStatusCollector(t *testing.T) {
+	selfstats.Reset()
 	c := NewStatusCollector()
 	assert.Equal(t, "status", c.Name())
 
 	dps, err := c.CollectAll()
 	require.NoError(t, err)
-	require.Len(t, dps, 1)
+	require.Len(t, dps, 2)
 
 	dp := dps[0]
 	assert.Equal(t, "heartbeat", dp.Name)
 	assert.Equal(t, 1.0, dp.Value)
 	assert.NotZero(t, dp.Timestamp)
-	assert.Empty(t, dp.Labels)
+	assert.Equal(t, map[string]string{"version": version.Version}, dp.Labels)
+
+	assert.Equal(t, "agent_uptime_seconds", dps[1].Name)
+	assert.Positive(t, dps[1].Value)
+}
+
+func TestStatusCollector_ConfigHash(t *testing.T) {
+	SetConfigHash("abc123")
+	defer SetConfigHash("")
+
+	dps, err := NewStatusCollector().CollectAll()
+	require.NoError(t, err)
+	assert.Equal(t, "abc123", dps[0].Labels["config_hash"])
+}
+
+func TestStatusCollector_SelfStats(t *testing.T) {
+	selfstats.Reset()
+	defer selfstats.Reset()
+	selfstats.NewCounter("logs_lines_read_total", map[string]string{"source": "nginx"}).Add(42)
+
+	dps, err := NewStatusCollector().CollectAll()
+	require.NoError(t, err)
+	require.Len(t, dps, 3)
+	assert.Equal(t, "heartbeat", dps[0].Name)
+	assert.Equal(t, "logs_lines_read_total", dps[2].Name)
+	assert.Equal(t, 42.0, dps[2].Value)
+	assert.Equal(t, map[string]string{"source": "nginx"}, dps[2].Labels)
+	assert.Equal(t, dps[0].Timestamp, dps[2].Timestamp)
 }
 
 func TestStatusCollector_Discover(t *testing.T) {
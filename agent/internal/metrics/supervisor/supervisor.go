@@ -0,0 +1,258 @@
+package supervisor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"time"
+
+	"agent/internal/collection"
+	"agent/internal/config"
+	"agent/internal/logger"
+	"agent/internal/metrics"
+)
+
+// defaultSockets are the supervisord socket locations used by the distribution
+// packages, tried in order when no URL is configured.
+var defaultSockets = []string{"/var/run/supervisor.sock", "/run/supervisor.sock", "/tmp/supervisor.sock"}
+
+const commandTimeout = 10 * time.Second
+
+// program is a process managed by supervisord or pm2
+type program struct {
+	Manager string
+	Name    string
+	Up      bool
+	// Uptime in seconds, 0 when the program is not running
+	Uptime float64
+	// Start is the last start time, used to count supervisord restarts
+	Start    int64
+	Restarts float64
+	// Memory is the resident memory in bytes, only reported by pm2
+	Memory float64
+}
+
+type SupervisorPS interface {
+	Supervisord() ([]program, error)
+	PM2() ([]program, error)
+}
+
+type systemPS struct {
+	url string
+}
+
+func (s *systemPS) Supervisord() ([]program, error) {
+	target := s.url
+	if target == "" {
+		for _, socket := range defaultSockets {
+			if _, err := os.Stat(socket); err == nil {
+				target = "unix://" + socket
+				break
+			}
+		}
+		if target == "" {
+			return nil, fmt.Errorf("no supervisord socket found in %v", defaultSockets)
+		}
+	}
+	client, err := newXMLRPCClient(target, 5*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	result, err := client.call("supervisor.getAllProcessInfo")
+	if err != nil {
+		return nil, err
+	}
+	return parseSupervisordInfo(result), nil
+}
+
+func (s *systemPS) PM2() ([]program, error) {
+	if _, err := exec.LookPath("pm2"); err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), commandTimeout)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, "pm2", "jlist").Output()
+	if err != nil {
+		return nil, fmt.Errorf("pm2 jlist failed: %w", err)
+	}
+	return parsePM2List(out)
+}
+
+// parseSupervisordInfo reads the result of supervisor.getAllProcessInfo.
+// Programs of a group are named "group:name" like supervisorctl does.
+func parseSupervisordInfo(result xmlrpcValue) []program {
+	if result.Array == nil {
+		return nil
+	}
+	var programs []program
+	for _, v := range result.Array.Values {
+		info := v.fields()
+		name, group := info["name"].str(), info["group"].str()
+		if group != "" && group != name {
+			name = group + ":" + name
+		}
+		p := program{
+			Manager: "supervisord",
+			Name:    name,
+			Up:      info["statename"].str() == "RUNNING",
+			Start:   info["start"].int(),
+		}
+		if p.Up {
+			p.Uptime = float64(info["now"].int() - p.Start)
+		}
+		programs = append(programs, p)
+	}
+	return programs
+}
+
+type pm2Process struct {
+	Name string `json:"name"`
+	Env  struct {
+		Status      string  `json:"status"`
+		RestartTime float64 `json:"restart_time"`
+		Uptime      int64   `json:"pm_uptime"` // Start time in milliseconds
+	} `json:"pm2_env"`
+	Monit struct {
+		Memory float64 `json:"memory"`
+	} `json:"monit"`
+}
+
+// parsePM2List reads the output of "pm2 jlist".
+func parsePM2List(out []byte) ([]program, error) {
+	var processes []pm2Process
+	if err := json.Unmarshal(out, &processes); err != nil {
+		return nil, fmt.Errorf("failed to parse pm2 output: %w", err)
+	}
+	now := time.Now().UnixMilli()
+	var programs []program
+	for _, proc := range processes {
+		p := program{
+			Manager:  "pm2",
+			Name:     proc.Name,
+			Up:       proc.Env.Status == "online",
+			Restarts: proc.Env.RestartTime,
+			Memory:   proc.Monit.Memory,
+		}
+		if p.Up && proc.Env.Uptime > 0 {
+			p.Uptime = float64(now-proc.Env.Uptime) / 1000
+		}
+		programs = append(programs, p)
+	}
+	return programs, nil
+}
+
+// supervisorMetrics list the metrics reported for each managed program
+var supervisorMetrics = []struct {
+	name   string
+	getVal func(p *program) (float64, bool)
+}{
+	{"supervisor_program_up", func(p *program) (float64, bool) {
+		if p.Up {
+			return 1, true
+		}
+		return 0, true
+	}},
+	{"supervisor_program_uptime_seconds", func(p *program) (float64, bool) { return p.Uptime, true }},
+	{"supervisor_program_restarts_total", func(p *program) (float64, bool) { return p.Restarts, true }},
+	{"supervisor_program_memory_bytes", func(p *program) (float64, bool) { return p.Memory, p.Manager == "pm2" }},
+}
+
+// SupervisorCollector reports the programs managed by supervisord and pm2.
+type SupervisorCollector struct {
+	metrics.BaseCollector
+
+	ps SupervisorPS
+	// supervisord only exposes the last start time of a program, restarts
+	// are counted by the agent from start time changes.
+	lastStart map[string]int64
+	restarts  map[string]float64
+}
+
+func NewSupervisorCollector(cfg *config.Config) *SupervisorCollector {
+	return &SupervisorCollector{
+		ps:        &systemPS{url: cfg.SupervisordURL},
+		lastStart: make(map[string]int64),
+		restarts:  make(map[string]float64),
+	}
+}
+
+func (c *SupervisorCollector) Name() string {
+	return "supervisor"
+}
+
+func (c *SupervisorCollector) Collect() ([]metrics.DataPoint, error) {
+	all, err := c.CollectAll()
+	if err != nil {
+		return nil, err
+	}
+	var included []metrics.DataPoint
+	for _, dp := range all {
+		if c.IsIncluded(dp.Name, dp.Labels) {
+			included = append(included, dp)
+		}
+	}
+	return included, nil
+}
+
+func (c *SupervisorCollector) CollectAll() ([]metrics.DataPoint, error) {
+	timestamp := time.Now().UnixMilli()
+	programs := c.getPrograms()
+	for i := range programs {
+		p := &programs[i]
+		if p.Manager != "supervisord" {
+			continue
+		}
+		if last, ok := c.lastStart[p.Name]; ok && p.Start != last && p.Start != 0 {
+			c.restarts[p.Name]++
+		}
+		c.lastStart[p.Name] = p.Start
+		p.Restarts = c.restarts[p.Name]
+	}
+	return buildDataPoints(programs, timestamp), nil
+}
+
+func (c *SupervisorCollector) Discover() ([]collection.Metric, error) {
+	discovered := []collection.Metric{}
+	for _, dp := range buildDataPoints(c.getPrograms(), 0) {
+		discovered = append(discovered, collection.Metric{
+			Name:   dp.Name,
+			Type:   "gauge",
+			Labels: dp.Labels,
+		})
+	}
+	return discovered, nil
+}
+
+// getPrograms returns the programs of every reachable process manager.
+func (c *SupervisorCollector) getPrograms() []program {
+	var programs []program
+	if p, err := c.ps.Supervisord(); err == nil {
+		programs = append(programs, p...)
+	} else {
+		logger.Log.Debug("Skipping supervisord", "collector", c.Name(), "error", err)
+	}
+	if p, err := c.ps.PM2(); err == nil {
+		programs = append(programs, p...)
+	} else {
+		logger.Log.Debug("Skipping pm2", "collector", c.Name(), "error", err)
+	}
+	return programs
+}
+
+func buildDataPoints(programs []program, ts int64) []metrics.DataPoint {
+	var results []metrics.DataPoint
+	for i := range programs {
+		p := &programs[i]
+		labels := map[string]string{"manager": p.Manager, "program": p.Name}
+		for _, m := range supervisorMetrics {
+			val, ok := m.getVal(p)
+			if !ok {
+				continue
+			}
+			results = append(results, metrics.DataPoint{Name: m.name, Timestamp: ts, Value: val, Labels: labels})
+		}
+	}
+	return results
+}
@@ -0,0 +1,150 @@
+package supervisor
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"agent/internal/logger"
+	"agent/internal/metrics"
+)
+
+func init() {
+	logger.Log = slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+type mockPS struct {
+	mock.Mock
+}
+
+func (m *mockPS) Supervisord() ([]program, error) {
+	args := m.Called()
+	programs, _ := args.Get(0).([]program)
+	return programs, args.Error(1)
+}
+
+func (m *mockPS) PM2() ([]program, error) {
+	args := m.Called()
+	programs, _ := args.Get(0).([]program)
+	return programs, args.Error(1)
+}
+
+const processInfo = `<?xml version='1.0'?>
+<methodResponse><params><param><value><array><data>
+<value><struct>
+<member><name>name</name><value><string>web</string></value></member>
+<member><name>group</name><value><string>web</string></value></member>
+<member><name>statename</name><value><string>RUNNING</string></value></member>
+<member><name>start</name><value><int>%d</int></value></member>
+<member><name>now</name><value><int>1760000100</int></value></member>
+</struct></value>
+<value><struct>
+<member><name>name</name><value><string>worker_00</string></value></member>
+<member><name>group</name><value><string>worker</string></value></member>
+<member><name>statename</name><value>FATAL</value></member>
+<member><name>start</name><value><i4>0</i4></value></member>
+<member><name>now</name><value><int>1760000100</int></value></member>
+</struct></value>
+</data></array></value></param></params></methodResponse>`
+
+const pm2List = `[{"name":"api","pm2_env":{"status":"online","restart_time":4,"pm_uptime":%d},"monit":{"memory":52428800,"cpu":1}},
+{"name":"cron","pm2_env":{"status":"stopped","restart_time":0,"pm_uptime":0},"monit":{"memory":0,"cpu":0}}]`
+
+func findPoint(t *testing.T, dps []metrics.DataPoint, name, program string) metrics.DataPoint {
+	t.Helper()
+	for _, dp := range dps {
+		if dp.Name == name && dp.Labels["program"] == program {
+			return dp
+		}
+	}
+	t.Fatalf("data point %s{program=%s} not found", name, program)
+	return metrics.DataPoint{}
+}
+
+func TestSupervisordXMLRPC(t *testing.T) {
+	start := 1760000000
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		assert.Contains(t, string(body), "<methodName>supervisor.getAllProcessInfo</methodName>")
+		fmt.Fprintf(w, processInfo, start)
+	}))
+	defer server.Close()
+
+	ps := &systemPS{url: server.URL + "/RPC2"}
+	programs, err := ps.Supervisord()
+	require.NoError(t, err)
+	require.Len(t, programs, 2)
+	assert.Equal(t, program{Manager: "supervisord", Name: "web", Up: true, Uptime: 100, Start: 1760000000}, programs[0])
+	assert.Equal(t, "worker:worker_00", programs[1].Name)
+	assert.False(t, programs[1].Up)
+}
+
+func TestXMLRPCFault(t *testing.T) {
+	_, err := decodeResponse(strings.NewReader(`<methodResponse><fault><value><struct>
+<member><name>faultCode</name><value><int>1</int></value></member>
+<member><name>faultString</name><value><string>UNKNOWN_METHOD</string></value></member>
+</struct></value></fault></methodResponse>`))
+	assert.EqualError(t, err, "xml-rpc fault 1: UNKNOWN_METHOD")
+}
+
+func TestParsePM2List(t *testing.T) {
+	startedAt := time.Now().Add(-time.Minute).UnixMilli()
+	programs, err := parsePM2List([]byte(fmt.Sprintf(pm2List, startedAt)))
+	require.NoError(t, err)
+	require.Len(t, programs, 2)
+	assert.True(t, programs[0].Up)
+	assert.Equal(t, 4.0, programs[0].Restarts)
+	assert.InDelta(t, 60, programs[0].Uptime, 1)
+	assert.False(t, programs[1].Up)
+	assert.Zero(t, programs[1].Uptime)
+}
+
+func TestSupervisorCollector(t *testing.T) {
+	var mps mockPS
+	mps.On("Supervisord").Return([]program{{Manager: "supervisord", Name: "web", Up: true, Start: 100}}, nil).Once()
+	mps.On("PM2").Return([]program{{Manager: "pm2", Name: "api", Up: true, Restarts: 2, Memory: 1024}}, nil)
+
+	c := &SupervisorCollector{ps: &mps, lastStart: map[string]int64{}, restarts: map[string]float64{}}
+	dps, err := c.CollectAll()
+	require.NoError(t, err)
+	assert.Equal(t, 1.0, findPoint(t, dps, "supervisor_program_up", "web").Value)
+	assert.Equal(t, 0.0, findPoint(t, dps, "supervisor_program_restarts_total", "web").Value)
+	assert.Equal(t, 2.0, findPoint(t, dps, "supervisor_program_restarts_total", "api").Value)
+	assert.Equal(t, 1024.0, findPoint(t, dps, "supervisor_program_memory_bytes", "api").Value)
+	for _, dp := range dps {
+		if dp.Labels["manager"] == "supervisord" {
+			assert.NotEqual(t, "supervisor_program_memory_bytes", dp.Name)
+		}
+	}
+
+	// The program was restarted by supervisord between two collections
+	mps.On("Supervisord").Return([]program{{Manager: "supervisord", Name: "web", Up: true, Start: 160}}, nil).Once()
+	dps, err = c.CollectAll()
+	require.NoError(t, err)
+	assert.Equal(t, 1.0, findPoint(t, dps, "supervisor_program_restarts_total", "web").Value)
+}
+
+func TestSupervisorCollectorNoManager(t *testing.T) {
+	var mps mockPS
+	mps.On("Supervisord").Return(nil, errors.New("no supervisord socket found"))
+	mps.On("PM2").Return(nil, errors.New("pm2 not found"))
+
+	c := &SupervisorCollector{ps: &mps, lastStart: map[string]int64{}, restarts: map[string]float64{}}
+	dps, err := c.CollectAll()
+	assert.NoError(t, err)
+	assert.Empty(t, dps)
+
+	discovered, err := c.Discover()
+	assert.NoError(t, err)
+	assert.Empty(t, discovered)
+}
@@ -0,0 +1,138 @@
+package supervisor
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// xmlrpcValue is an XML-RPC value. Only the types returned by supervisord
+// are decoded.
+type xmlrpcValue struct {
+	Int     *int64        `xml:"int"`
+	I4      *int64        `xml:"i4"`
+	Boolean *int          `xml:"boolean"`
+	String  *string       `xml:"string"`
+	Struct  *xmlrpcStruct `xml:"struct"`
+	Array   *xmlrpcArray  `xml:"array"`
+	// Text holds untyped values, which are strings per the specification
+	Text string `xml:",chardata"`
+}
+
+type xmlrpcStruct struct {
+	Members []struct {
+		Name  string      `xml:"name"`
+		Value xmlrpcValue `xml:"value"`
+	} `xml:"member"`
+}
+
+type xmlrpcArray struct {
+	Values []xmlrpcValue `xml:"data>value"`
+}
+
+type methodResponse struct {
+	Params []xmlrpcValue `xml:"params>param>value"`
+	Fault  *xmlrpcValue  `xml:"fault>value"`
+}
+
+func (v xmlrpcValue) str() string {
+	if v.String != nil {
+		return *v.String
+	}
+	return strings.TrimSpace(v.Text)
+}
+
+func (v xmlrpcValue) int() int64 {
+	switch {
+	case v.Int != nil:
+		return *v.Int
+	case v.I4 != nil:
+		return *v.I4
+	case v.Boolean != nil:
+		return int64(*v.Boolean)
+	}
+	return 0
+}
+
+// fields flattens a struct value into its members.
+func (v xmlrpcValue) fields() map[string]xmlrpcValue {
+	fields := make(map[string]xmlrpcValue)
+	if v.Struct != nil {
+		for _, m := range v.Struct.Members {
+			fields[m.Name] = m.Value
+		}
+	}
+	return fields
+}
+
+// xmlrpcClient calls XML-RPC methods over HTTP, or HTTP over a unix socket
+// for the default supervisord setup.
+type xmlrpcClient struct {
+	endpoint string
+	client   *http.Client
+}
+
+func newXMLRPCClient(rawURL string, timeout time.Duration) (*xmlrpcClient, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid supervisord url: %w", err)
+	}
+	switch u.Scheme {
+	case "unix":
+		socket := u.Path
+		transport := &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", socket)
+			},
+		}
+		return &xmlrpcClient{
+			endpoint: "http://localhost/RPC2",
+			client:   &http.Client{Timeout: timeout, Transport: transport},
+		}, nil
+	case "http", "https":
+		return &xmlrpcClient{endpoint: rawURL, client: &http.Client{Timeout: timeout}}, nil
+	default:
+		return nil, fmt.Errorf("unsupported supervisord url scheme %q", u.Scheme)
+	}
+}
+
+func (c *xmlrpcClient) call(method string) (xmlrpcValue, error) {
+	var body bytes.Buffer
+	body.WriteString(`<?xml version="1.0"?><methodCall><methodName>`)
+	xml.EscapeText(&body, []byte(method))
+	body.WriteString(`</methodName><params/></methodCall>`)
+
+	resp, err := c.client.Post(c.endpoint, "text/xml", &body)
+	if err != nil {
+		return xmlrpcValue{}, fmt.Errorf("failed to call %s: %w", method, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return xmlrpcValue{}, fmt.Errorf("%s returned status %d", method, resp.StatusCode)
+	}
+	return decodeResponse(resp.Body)
+}
+
+func decodeResponse(r io.Reader) (xmlrpcValue, error) {
+	var response methodResponse
+	if err := xml.NewDecoder(r).Decode(&response); err != nil {
+		return xmlrpcValue{}, fmt.Errorf("failed to decode xml-rpc response: %w", err)
+	}
+	if response.Fault != nil {
+		fault := response.Fault.fields()
+		return xmlrpcValue{}, fmt.Errorf("xml-rpc fault %s: %s", strconv.FormatInt(fault["faultCode"].int(), 10), fault["faultString"].str())
+	}
+	if len(response.Params) != 1 {
+		return xmlrpcValue{}, fmt.Errorf("expected one xml-rpc result, got %d", len(response.Params))
+	}
+	return response.Params[0], nil
+}
@@ -0,0 +1,245 @@
+package systemd
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"path"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"agent/internal/collection"
+	"agent/internal/config"
+	"agent/internal/logger"
+	"agent/internal/metrics"
+)
+
+// defaultUnits are reported when no pattern is configured
+var defaultUnits = []string{"*.service"}
+
+// commandTimeout bounds a systemctl run, it waits on D-Bus when systemd is
+// busy, e.g. during a boot
+const commandTimeout = 10 * time.Second
+
+// unitProperties are read with "systemctl show"
+const unitProperties = "Id,ActiveState,NRestarts"
+
+type SystemdPS interface {
+	// ListUnits returns the output of "systemctl list-units"
+	ListUnits() ([]byte, error)
+	// ShowUnits returns the output of "systemctl show" for the units
+	ShowUnits(units []string) ([]byte, error)
+}
+
+type systemPS struct{}
+
+func (s *systemPS) ListUnits() ([]byte, error) {
+	return systemctl("list-units", "--all", "--plain", "--full", "--no-legend", "--no-pager")
+}
+
+func (s *systemPS) ShowUnits(units []string) ([]byte, error) {
+	return systemctl(append([]string{"show", "--no-pager", "--property=" + unitProperties, "--"}, units...)...)
+}
+
+func systemctl(args ...string) ([]byte, error) {
+	if runtime.GOOS != "linux" {
+		return nil, fmt.Errorf("systemd is only available on Linux")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), commandTimeout)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, "systemctl", args...).Output()
+	if err != nil {
+		return nil, fmt.Errorf("systemctl %s failed: %w", args[0], err)
+	}
+	return out, nil
+}
+
+// unit is the state of a systemd unit
+type unit struct {
+	ID          string
+	ActiveState string
+	// Restarts is the number of automatic restarts, -1 for the units which
+	// aren't services
+	Restarts float64
+}
+
+// SystemdCollector reports the state of the units matching the configured
+// patterns, so that a crashed or restart looping service can be alerted on.
+type SystemdCollector struct {
+	metrics.BaseCollector
+
+	ps       SystemdPS
+	patterns []string
+}
+
+func NewSystemdCollector(cfg *config.Config) *SystemdCollector {
+	return newSystemdCollector(&systemPS{}, cfg.SystemdUnits)
+}
+
+func newSystemdCollector(ps SystemdPS, patterns []string) *SystemdCollector {
+	if len(patterns) == 0 {
+		patterns = defaultUnits
+	}
+	return &SystemdCollector{ps: ps, patterns: patterns}
+}
+
+func (c *SystemdCollector) Name() string {
+	return "systemd"
+}
+
+func (c *SystemdCollector) Collect() ([]metrics.DataPoint, error) {
+	all, err := c.CollectAll()
+	if err != nil {
+		return nil, err
+	}
+	var included []metrics.DataPoint
+	for _, dp := range all {
+		if c.IsIncluded(dp.Name, dp.Labels) {
+			included = append(included, dp)
+		}
+	}
+	return included, nil
+}
+
+func (c *SystemdCollector) CollectAll() ([]metrics.DataPoint, error) {
+	units, err := c.getUnits()
+	if err != nil {
+		logger.Log.Debug("Failed to collect metrics", "collector", c.Name(), "error", err)
+		return nil, nil
+	}
+	return buildDataPoints(units, time.Now().UnixMilli()), nil
+}
+
+func (c *SystemdCollector) Discover() ([]collection.Metric, error) {
+	units, err := c.getUnits()
+	if err != nil {
+		// Hosts without systemd, e.g. containers
+		return []collection.Metric{}, nil
+	}
+	discovered := []collection.Metric{}
+	for _, dp := range buildDataPoints(units, 0) {
+		discovered = append(discovered, collection.Metric{
+			Name:   dp.Name,
+			Type:   "gauge",
+			Labels: dp.Labels,
+		})
+	}
+	return discovered, nil
+}
+
+func (c *SystemdCollector) getUnits() ([]unit, error) {
+	out, err := c.ps.ListUnits()
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, name := range parseUnitList(out) {
+		if c.matches(name) {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return nil, nil
+	}
+	out, err = c.ps.ShowUnits(names)
+	if err != nil {
+		return nil, err
+	}
+	return parseShow(out), nil
+}
+
+func (c *SystemdCollector) matches(name string) bool {
+	for _, pattern := range c.patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func buildDataPoints(units []unit, ts int64) []metrics.DataPoint {
+	var results []metrics.DataPoint
+	for _, u := range units {
+		labels := map[string]string{"unit": u.ID}
+		active, failed := 0.0, 0.0
+		switch u.ActiveState {
+		case "active", "reloading":
+			active = 1
+		case "failed":
+			failed = 1
+		}
+		results = append(results,
+			metrics.DataPoint{Name: "systemd_unit_active", Timestamp: ts, Value: active, Labels: labels},
+			metrics.DataPoint{Name: "systemd_unit_failed", Timestamp: ts, Value: failed, Labels: labels},
+		)
+		if u.Restarts >= 0 {
+			results = append(results, metrics.DataPoint{Name: "systemd_unit_restarts_total", Timestamp: ts, Value: u.Restarts, Labels: labels})
+		}
+	}
+	sort.SliceStable(results, func(i, j int) bool { return results[i].Name < results[j].Name })
+	return results
+}
+
+// parseUnitList returns the unit names of "systemctl list-units --plain",
+// the first column:
+//
+//	nginx.service  loaded active running A high performance web server
+//	backup.timer   loaded active waiting Daily backup
+func parseUnitList(out []byte) []string {
+	var names []string
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		names = append(names, fields[0])
+	}
+	return names
+}
+
+// parseShow parses "systemctl show", one block of properties per unit
+// separated by an empty line:
+//
+//	Id=nginx.service
+//	ActiveState=active
+//	NRestarts=0
+func parseShow(out []byte) []unit {
+	var units []unit
+	current := unit{Restarts: -1}
+	flush := func() {
+		if current.ID != "" {
+			units = append(units, current)
+		}
+		current = unit{Restarts: -1}
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			flush()
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "Id":
+			current.ID = value
+		case "ActiveState":
+			current.ActiveState = value
+		case "NRestarts":
+			if n, err := strconv.ParseFloat(value, 64); err == nil {
+				current.Restarts = n
+			}
+		}
+	}
+	flush()
+	return units
+}
@@ -0,0 +1,106 @@
+package systemd
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"agent/internal/logger"
+	"agent/internal/metrics"
+)
+
+func init() {
+	logger.Log = slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+type mockPS struct {
+	mock.Mock
+}
+
+func (m *mockPS) ListUnits() ([]byte, error) {
+	args := m.Called()
+	out, _ := args.Get(0).([]byte)
+	return out, args.Error(1)
+}
+
+func (m *mockPS) ShowUnits(units []string) ([]byte, error) {
+	args := m.Called(units)
+	out, _ := args.Get(0).([]byte)
+	return out, args.Error(1)
+}
+
+const unitList = `nginx.service      loaded active   running A high performance web server
+postgresql.service loaded failed   failed  PostgreSQL database server
+backup.timer       loaded active   waiting Daily backup
+sshd.service       loaded active   running OpenSSH server daemon
+`
+
+const unitShow = `Id=nginx.service
+ActiveState=active
+NRestarts=0
+
+Id=postgresql.service
+ActiveState=failed
+NRestarts=4
+
+Id=backup.timer
+ActiveState=active
+`
+
+func findPoint(t *testing.T, dps []metrics.DataPoint, name, unit string) metrics.DataPoint {
+	t.Helper()
+	for _, dp := range dps {
+		if dp.Name == name && dp.Labels["unit"] == unit {
+			return dp
+		}
+	}
+	t.Fatalf("data point %s{unit=%s} not found", name, unit)
+	return metrics.DataPoint{}
+}
+
+func TestSystemdCollector(t *testing.T) {
+	var mps mockPS
+	defer mps.AssertExpectations(t)
+	mps.On("ListUnits").Return([]byte(unitList), nil)
+	mps.On("ShowUnits", []string{"nginx.service", "postgresql.service", "backup.timer"}).Return([]byte(unitShow), nil)
+
+	c := newSystemdCollector(&mps, []string{"nginx.service", "postgres*", "*.timer"})
+	dps, err := c.CollectAll()
+	require.NoError(t, err)
+
+	assert.Equal(t, 1.0, findPoint(t, dps, "systemd_unit_active", "nginx.service").Value)
+	assert.Equal(t, 0.0, findPoint(t, dps, "systemd_unit_failed", "nginx.service").Value)
+	assert.Equal(t, 0.0, findPoint(t, dps, "systemd_unit_active", "postgresql.service").Value)
+	assert.Equal(t, 1.0, findPoint(t, dps, "systemd_unit_failed", "postgresql.service").Value)
+	assert.Equal(t, 4.0, findPoint(t, dps, "systemd_unit_restarts_total", "postgresql.service").Value)
+	assert.Equal(t, 1.0, findPoint(t, dps, "systemd_unit_active", "backup.timer").Value)
+	for _, dp := range dps {
+		assert.False(t, dp.Name == "systemd_unit_restarts_total" && dp.Labels["unit"] == "backup.timer", "timers have no restart count")
+		assert.NotEqual(t, "sshd.service", dp.Labels["unit"])
+	}
+}
+
+func TestSystemdCollector_DefaultPatterns(t *testing.T) {
+	c := newSystemdCollector(&mockPS{}, nil)
+	assert.True(t, c.matches("nginx.service"))
+	assert.False(t, c.matches("backup.timer"))
+}
+
+func TestSystemdCollector_Unavailable(t *testing.T) {
+	var mps mockPS
+	mps.On("ListUnits").Return(nil, errors.New("systemctl not found"))
+
+	c := newSystemdCollector(&mps, nil)
+	dps, err := c.CollectAll()
+	require.NoError(t, err)
+	assert.Empty(t, dps)
+
+	discovered, err := c.Discover()
+	require.NoError(t, err)
+	assert.Empty(t, discovered)
+}
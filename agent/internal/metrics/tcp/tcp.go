@@ -0,0 +1,133 @@
+package tcp
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shirou/gopsutil/v4/net"
+
+	"agent/internal/collection"
+	"agent/internal/metrics"
+)
+
+type TCPPS interface {
+	Connections() ([]net.ConnectionStat, error)
+}
+
+type systemPS struct{}
+
+func (s *systemPS) Connections() ([]net.ConnectionStat, error) {
+	// The owners of the sockets aren't needed, reading them is slow on
+	// hosts with many processes
+	return net.ConnectionsWithoutUidsWithContext(context.Background(), "tcp")
+}
+
+// states are the TCP states always reported, so that a state without
+// connections reports 0 rather than no series
+var states = []string{
+	"established", "syn_sent", "syn_recv", "fin_wait1", "fin_wait2", "time_wait",
+	"close", "close_wait", "last_ack", "listen", "closing",
+}
+
+// stateAliases maps the Windows spellings to the Linux ones
+var stateAliases = map[string]string{
+	"syn_received": "syn_recv",
+	"fin_wait_1":   "fin_wait1",
+	"fin_wait_2":   "fin_wait2",
+	"closed":       "close",
+}
+
+// TCPCollector reports the TCP connections by state, e.g. the TIME_WAIT or
+// CLOSE_WAIT piling up before the ephemeral ports or the file descriptors run
+// out, and the listening sockets by port.
+type TCPCollector struct {
+	metrics.BaseCollector
+
+	ps TCPPS
+}
+
+func NewTCPCollector() *TCPCollector {
+	return &TCPCollector{ps: &systemPS{}}
+}
+
+func (c *TCPCollector) Name() string {
+	return "tcp"
+}
+
+func (c *TCPCollector) Collect() ([]metrics.DataPoint, error) {
+	all, err := c.CollectAll()
+	if err != nil {
+		return nil, err
+	}
+	var included []metrics.DataPoint
+	for _, dp := range all {
+		if c.IsIncluded(dp.Name, dp.Labels) {
+			included = append(included, dp)
+		}
+	}
+	return included, nil
+}
+
+func (c *TCPCollector) CollectAll() ([]metrics.DataPoint, error) {
+	conns, err := c.ps.Connections()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list TCP connections: %w", err)
+	}
+	return buildDataPoints(conns, time.Now().UnixMilli()), nil
+}
+
+func (c *TCPCollector) Discover() ([]collection.Metric, error) {
+	conns, err := c.ps.Connections()
+	if err != nil {
+		return []collection.Metric{}, nil
+	}
+	discovered := []collection.Metric{}
+	for _, dp := range buildDataPoints(conns, 0) {
+		discovered = append(discovered, collection.Metric{Name: dp.Name, Type: "gauge", Labels: dp.Labels})
+	}
+	return discovered, nil
+}
+
+func buildDataPoints(conns []net.ConnectionStat, ts int64) []metrics.DataPoint {
+	byState := make(map[string]float64, len(states))
+	for _, state := range states {
+		byState[state] = 0
+	}
+	byPort := make(map[uint32]float64)
+	for _, conn := range conns {
+		state := normalizeState(conn.Status)
+		if state == "" {
+			continue
+		}
+		byState[state]++
+		if state == "listen" {
+			// An IPv4 and an IPv6 socket on the same port count as two
+			byPort[conn.Laddr.Port]++
+		}
+	}
+
+	var results []metrics.DataPoint
+	for state, count := range byState {
+		results = append(results, metrics.DataPoint{Name: "tcp_connections", Timestamp: ts, Value: count, Labels: map[string]string{"state": state}})
+	}
+	for port, count := range byPort {
+		results = append(results, metrics.DataPoint{Name: "tcp_listen_sockets", Timestamp: ts, Value: count, Labels: map[string]string{"port": strconv.FormatUint(uint64(port), 10)}})
+	}
+	return results
+}
+
+// normalizeState returns the lowercase Linux name of a state, empty for the
+// sockets without one
+func normalizeState(status string) string {
+	state := strings.ToLower(status)
+	if alias, ok := stateAliases[state]; ok {
+		return alias
+	}
+	if state == "none" || state == "delete" {
+		return ""
+	}
+	return state
+}
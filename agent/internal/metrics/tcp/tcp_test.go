@@ -0,0 +1,80 @@
+package tcp
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/shirou/gopsutil/v4/net"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"agent/internal/metrics"
+)
+
+type mockPS struct {
+	mock.Mock
+}
+
+func (m *mockPS) Connections() ([]net.ConnectionStat, error) {
+	args := m.Called()
+	conns, _ := args.Get(0).([]net.ConnectionStat)
+	return conns, args.Error(1)
+}
+
+func findPoint(dps []metrics.DataPoint, name string, labels map[string]string) (metrics.DataPoint, bool) {
+	for _, dp := range dps {
+		if dp.Name == name && assert.ObjectsAreEqual(labels, dp.Labels) {
+			return dp, true
+		}
+	}
+	return metrics.DataPoint{}, false
+}
+
+func TestTCPCollector(t *testing.T) {
+	var mps mockPS
+	mps.On("Connections").Return([]net.ConnectionStat{
+		{Status: "LISTEN", Laddr: net.Addr{IP: "0.0.0.0", Port: 443}},
+		{Status: "LISTEN", Laddr: net.Addr{IP: "::", Port: 443}},
+		{Status: "LISTEN", Laddr: net.Addr{IP: "127.0.0.1", Port: 5432}},
+		{Status: "ESTABLISHED", Laddr: net.Addr{Port: 443}, Raddr: net.Addr{Port: 51000}},
+		{Status: "TIME_WAIT", Laddr: net.Addr{Port: 443}, Raddr: net.Addr{Port: 51001}},
+		{Status: "TIME_WAIT", Laddr: net.Addr{Port: 443}, Raddr: net.Addr{Port: 51002}},
+		// Windows spelling
+		{Status: "SYN_RECEIVED", Laddr: net.Addr{Port: 443}},
+		{Status: "NONE"},
+	}, nil)
+
+	c := &TCPCollector{ps: &mps}
+	dps, err := c.CollectAll()
+	require.NoError(t, err)
+
+	for state, want := range map[string]float64{"listen": 3, "established": 1, "time_wait": 2, "syn_recv": 1, "close_wait": 0} {
+		dp, ok := findPoint(dps, "tcp_connections", map[string]string{"state": state})
+		require.True(t, ok, state)
+		assert.Equal(t, want, dp.Value, state)
+	}
+	_, ok := findPoint(dps, "tcp_connections", map[string]string{"state": "none"})
+	assert.False(t, ok)
+
+	dp, ok := findPoint(dps, "tcp_listen_sockets", map[string]string{"port": "443"})
+	require.True(t, ok)
+	assert.Equal(t, 2.0, dp.Value)
+	dp, ok = findPoint(dps, "tcp_listen_sockets", map[string]string{"port": "5432"})
+	require.True(t, ok)
+	assert.Equal(t, 1.0, dp.Value)
+	assert.Len(t, dps, len(states)+2)
+}
+
+func TestTCPCollector_Unavailable(t *testing.T) {
+	var mps mockPS
+	mps.On("Connections").Return(nil, errors.New("permission denied"))
+
+	c := &TCPCollector{ps: &mps}
+	_, err := c.CollectAll()
+	assert.Error(t, err)
+
+	discovered, err := c.Discover()
+	require.NoError(t, err)
+	assert.Empty(t, discovered)
+}
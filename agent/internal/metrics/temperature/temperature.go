@@ -0,0 +1,206 @@
+package temperature
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"agent/internal/collection"
+	"agent/internal/common"
+	"agent/internal/logger"
+	"agent/internal/metrics"
+)
+
+// zone is a kernel thermal zone, e.g. /sys/class/thermal/thermal_zone0
+type zone struct {
+	Name    string
+	Type    string
+	Celsius float64
+}
+
+type TemperaturePS interface {
+	ThermalZones() ([]zone, error)
+	// Throttled returns the Raspberry Pi firmware throttling flags, see
+	// throttleFlags.
+	Throttled() (uint64, error)
+	// CPUFrequency returns the current frequency of the first CPU in Hz.
+	CPUFrequency() (float64, error)
+}
+
+type systemPS struct {
+	sysPath string
+}
+
+func (s *systemPS) ThermalZones() ([]zone, error) {
+	paths, err := filepath.Glob(filepath.Join(s.sysPath, "class/thermal/thermal_zone*"))
+	if err != nil {
+		return nil, err
+	}
+	var zones []zone
+	for _, path := range paths {
+		raw, err := os.ReadFile(filepath.Join(path, "temp"))
+		if err != nil {
+			// Disabled zones fail to read
+			continue
+		}
+		milli, err := strconv.ParseFloat(strings.TrimSpace(string(raw)), 64)
+		if err != nil {
+			continue
+		}
+		typ, _ := os.ReadFile(filepath.Join(path, "type"))
+		zones = append(zones, zone{
+			Name:    filepath.Base(path),
+			Type:    strings.TrimSpace(string(typ)),
+			Celsius: milli / 1000,
+		})
+	}
+	return zones, nil
+}
+
+func (s *systemPS) Throttled() (uint64, error) {
+	// Exposed by the raspberrypi-hwmon driver on recent kernels, no need to
+	// fork vcgencmd (which also requires the video group)
+	if raw, err := os.ReadFile(filepath.Join(s.sysPath, "devices/platform/soc/soc:firmware/get_throttled")); err == nil {
+		return strconv.ParseUint(strings.TrimSpace(string(raw)), 16, 64)
+	}
+
+	if _, err := exec.LookPath("vcgencmd"); err != nil {
+		return 0, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, "vcgencmd", "get_throttled").Output()
+	if err != nil {
+		return 0, fmt.Errorf("vcgencmd failed: %w", err)
+	}
+	return parseThrottled(string(out))
+}
+
+func (s *systemPS) CPUFrequency() (float64, error) {
+	raw, err := os.ReadFile(filepath.Join(s.sysPath, "devices/system/cpu/cpu0/cpufreq/scaling_cur_freq"))
+	if err != nil {
+		return 0, err
+	}
+	khz, err := strconv.ParseFloat(strings.TrimSpace(string(raw)), 64)
+	if err != nil {
+		return 0, err
+	}
+	return khz * 1000, nil
+}
+
+// parseThrottled parses vcgencmd output such as "throttled=0x50005".
+func parseThrottled(out string) (uint64, error) {
+	value, ok := strings.CutPrefix(strings.TrimSpace(out), "throttled=")
+	if !ok {
+		return 0, fmt.Errorf("unexpected vcgencmd output %q", out)
+	}
+	return strconv.ParseUint(strings.TrimPrefix(value, "0x"), 16, 64)
+}
+
+// throttleFlags maps the bits of the firmware get_throttled value. The
+// current state is in the low bits, bits 16 and up are sticky and record
+// that the condition occurred since boot.
+var throttleFlags = []struct {
+	name string
+	bit  uint
+}{
+	{"temperature_undervoltage", 0},
+	{"temperature_freq_capped", 1},
+	{"temperature_throttled", 2},
+	{"temperature_soft_limit_active", 3},
+	{"temperature_undervoltage_occurred", 16},
+	{"temperature_freq_capped_occurred", 17},
+	{"temperature_throttled_occurred", 18},
+	{"temperature_soft_limit_occurred", 19},
+}
+
+// TemperatureCollector reports thermal zone temperatures, and on Raspberry
+// Pi boards the firmware throttling and undervoltage flags.
+type TemperatureCollector struct {
+	metrics.BaseCollector
+
+	ps TemperaturePS
+}
+
+func NewTemperatureCollector() *TemperatureCollector {
+	return &TemperatureCollector{ps: &systemPS{sysPath: common.HostPath("/sys")}}
+}
+
+func (c *TemperatureCollector) Name() string {
+	return "temperature"
+}
+
+func (c *TemperatureCollector) Collect() ([]metrics.DataPoint, error) {
+	all, err := c.CollectAll()
+	if err != nil {
+		return nil, err
+	}
+	var included []metrics.DataPoint
+	for _, dp := range all {
+		if c.IsIncluded(dp.Name, dp.Labels) {
+			included = append(included, dp)
+		}
+	}
+	return included, nil
+}
+
+func (c *TemperatureCollector) CollectAll() ([]metrics.DataPoint, error) {
+	timestamp := time.Now().UnixMilli()
+	var results []metrics.DataPoint
+
+	zones, err := c.ps.ThermalZones()
+	if err != nil {
+		logger.Log.Debug("Failed to read thermal zones", "collector", c.Name(), "error", err)
+	}
+	for _, z := range zones {
+		results = append(results, metrics.DataPoint{
+			Name:      "temperature_celsius",
+			Timestamp: timestamp,
+			Value:     z.Celsius,
+			Labels:    map[string]string{"zone": z.Name, "type": z.Type},
+		})
+	}
+
+	// Only Raspberry Pi firmware reports throttling, skip silently elsewhere
+	if flags, err := c.ps.Throttled(); err == nil {
+		for _, f := range throttleFlags {
+			results = append(results, metrics.DataPoint{
+				Name:      f.name,
+				Timestamp: timestamp,
+				Value:     float64(flags >> f.bit & 1),
+				Labels:    map[string]string{},
+			})
+		}
+	}
+
+	if hz, err := c.ps.CPUFrequency(); err == nil {
+		results = append(results, metrics.DataPoint{
+			Name:      "temperature_cpu_frequency_hz",
+			Timestamp: timestamp,
+			Value:     hz,
+			Labels:    map[string]string{},
+		})
+	}
+	return results, nil
+}
+
+func (c *TemperatureCollector) Discover() ([]collection.Metric, error) {
+	all, err := c.CollectAll()
+	if err != nil {
+		return nil, err
+	}
+	discovered := []collection.Metric{}
+	for _, dp := range all {
+		discovered = append(discovered, collection.Metric{
+			Name:   dp.Name,
+			Type:   "gauge",
+			Labels: dp.Labels,
+		})
+	}
+	return discovered, nil
+}
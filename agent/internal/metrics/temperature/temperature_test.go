@@ -0,0 +1,86 @@
+package temperature
+
+import (
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"agent/internal/logger"
+	"agent/internal/metrics"
+)
+
+func init() {
+	logger.Log = slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+func writeFile(t *testing.T, root, path, content string) {
+	t.Helper()
+	full := filepath.Join(root, path)
+	require.NoError(t, os.MkdirAll(filepath.Dir(full), 0o755))
+	require.NoError(t, os.WriteFile(full, []byte(content), 0o644))
+}
+
+func findPoint(t *testing.T, dps []metrics.DataPoint, name string) metrics.DataPoint {
+	t.Helper()
+	for _, dp := range dps {
+		if dp.Name == name {
+			return dp
+		}
+	}
+	t.Fatalf("data point %s not found", name)
+	return metrics.DataPoint{}
+}
+
+func TestTemperatureCollectorRaspberryPi(t *testing.T) {
+	sys := t.TempDir()
+	writeFile(t, sys, "class/thermal/thermal_zone0/temp", "61835\n")
+	writeFile(t, sys, "class/thermal/thermal_zone0/type", "cpu-thermal\n")
+	// Under-voltage now, throttled and under-voltage since boot
+	writeFile(t, sys, "devices/platform/soc/soc:firmware/get_throttled", "50005\n")
+	writeFile(t, sys, "devices/system/cpu/cpu0/cpufreq/scaling_cur_freq", "600000\n")
+
+	c := &TemperatureCollector{ps: &systemPS{sysPath: sys}}
+	dps, err := c.CollectAll()
+	require.NoError(t, err)
+
+	temp := findPoint(t, dps, "temperature_celsius")
+	assert.InDelta(t, 61.835, temp.Value, 0.0001)
+	assert.Equal(t, map[string]string{"zone": "thermal_zone0", "type": "cpu-thermal"}, temp.Labels)
+
+	assert.Equal(t, 1.0, findPoint(t, dps, "temperature_undervoltage").Value)
+	assert.Equal(t, 0.0, findPoint(t, dps, "temperature_freq_capped").Value)
+	assert.Equal(t, 1.0, findPoint(t, dps, "temperature_throttled").Value)
+	assert.Equal(t, 1.0, findPoint(t, dps, "temperature_undervoltage_occurred").Value)
+	assert.Equal(t, 1.0, findPoint(t, dps, "temperature_throttled_occurred").Value)
+	assert.Equal(t, 0.0, findPoint(t, dps, "temperature_soft_limit_occurred").Value)
+	assert.Equal(t, 600e6, findPoint(t, dps, "temperature_cpu_frequency_hz").Value)
+}
+
+func TestTemperatureCollectorGenericHost(t *testing.T) {
+	sys := t.TempDir()
+	writeFile(t, sys, "class/thermal/thermal_zone0/temp", "45000\n")
+	writeFile(t, sys, "class/thermal/thermal_zone0/type", "x86_pkg_temp\n")
+	// Zones of disabled sensors cannot be read
+	require.NoError(t, os.MkdirAll(filepath.Join(sys, "class/thermal/thermal_zone1"), 0o755))
+
+	t.Setenv("PATH", t.TempDir())
+	c := &TemperatureCollector{ps: &systemPS{sysPath: sys}}
+	dps, err := c.CollectAll()
+	require.NoError(t, err)
+	require.Len(t, dps, 1)
+	assert.Equal(t, 45.0, dps[0].Value)
+}
+
+func TestParseThrottled(t *testing.T) {
+	flags, err := parseThrottled("throttled=0x50005\n")
+	require.NoError(t, err)
+	assert.Equal(t, uint64(0x50005), flags)
+
+	_, err = parseThrottled("VCHI initialization failed")
+	assert.Error(t, err)
+}
@@ -0,0 +1,205 @@
+package tlscert
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"agent/internal/collection"
+	"agent/internal/common"
+	"agent/internal/config"
+	"agent/internal/logger"
+	"agent/internal/metrics"
+)
+
+// defaultPaths are read when no path is configured, the certificates issued
+// by certbot
+var defaultPaths = []string{"/etc/letsencrypt/live/*/cert.pem"}
+
+type CertPS interface {
+	// Glob returns the files matching a pattern, and the files of the
+	// matching directories
+	Glob(pattern string) ([]string, error)
+	ReadFile(path string) ([]byte, error)
+}
+
+type systemPS struct{}
+
+// Glob returns the paths on the host, the same whether the agent runs in a
+// container or not
+func (s *systemPS) Glob(pattern string) ([]string, error) {
+	matches, err := filepath.Glob(common.HostPath(pattern))
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, match := range matches {
+		info, err := os.Stat(match)
+		if err != nil {
+			continue
+		}
+		if !info.IsDir() {
+			files = append(files, strings.TrimPrefix(match, common.HostRoot()))
+			continue
+		}
+		// E.g. /etc/letsencrypt/live/*, the files of each domain
+		entries, _ := os.ReadDir(match)
+		for _, entry := range entries {
+			if !entry.IsDir() {
+				files = append(files, strings.TrimPrefix(filepath.Join(match, entry.Name()), common.HostRoot()))
+			}
+		}
+	}
+	return files, nil
+}
+
+func (s *systemPS) ReadFile(path string) ([]byte, error) {
+	return os.ReadFile(common.HostPath(path))
+}
+
+// certificate is a certificate read from a file
+type certificate struct {
+	Path     string
+	CN       string
+	NotAfter time.Time
+}
+
+// TLSCertCollector reports the time left before the certificates of the
+// configured files expire, so that an expiry can be alerted on without a
+// separate tool. Every certificate of a file is reported, e.g. the
+// intermediate of a full chain.
+type TLSCertCollector struct {
+	metrics.BaseCollector
+
+	ps    CertPS
+	paths []string
+	now   func() time.Time
+}
+
+func NewTLSCertCollector(cfg *config.Config) *TLSCertCollector {
+	return newTLSCertCollector(&systemPS{}, cfg.TLSCertificates)
+}
+
+func newTLSCertCollector(ps CertPS, paths []string) *TLSCertCollector {
+	if len(paths) == 0 {
+		paths = defaultPaths
+	}
+	return &TLSCertCollector{ps: ps, paths: paths, now: time.Now}
+}
+
+func (c *TLSCertCollector) Name() string {
+	return "tls"
+}
+
+func (c *TLSCertCollector) Collect() ([]metrics.DataPoint, error) {
+	all, err := c.CollectAll()
+	if err != nil {
+		return nil, err
+	}
+	var included []metrics.DataPoint
+	for _, dp := range all {
+		if c.IsIncluded(dp.Name, dp.Labels) {
+			included = append(included, dp)
+		}
+	}
+	return included, nil
+}
+
+func (c *TLSCertCollector) CollectAll() ([]metrics.DataPoint, error) {
+	now := c.now()
+	return buildDataPoints(c.certificates(), now, now.UnixMilli()), nil
+}
+
+func (c *TLSCertCollector) Discover() ([]collection.Metric, error) {
+	discovered := []collection.Metric{}
+	for _, dp := range buildDataPoints(c.certificates(), c.now(), 0) {
+		discovered = append(discovered, collection.Metric{Name: dp.Name, Type: "gauge", Labels: dp.Labels})
+	}
+	return discovered, nil
+}
+
+// certificates reads the certificates of the files matching the configured
+// patterns. The files that can't be read or parsed are skipped.
+func (c *TLSCertCollector) certificates() []certificate {
+	var certs []certificate
+	seen := make(map[string]bool)
+	for _, pattern := range c.paths {
+		files, err := c.ps.Glob(pattern)
+		if err != nil {
+			logger.Log.Warn("Skipping invalid certificate path", "pattern", pattern, "error", err)
+			continue
+		}
+		for _, file := range files {
+			if seen[file] {
+				continue
+			}
+			seen[file] = true
+			data, err := c.ps.ReadFile(file)
+			if err != nil {
+				logger.Log.Debug("Failed to read certificate", "path", file, "error", err)
+				continue
+			}
+			parsed, err := parseCertificates(data)
+			if err != nil {
+				logger.Log.Debug("Failed to parse certificate", "path", file, "error", err)
+				continue
+			}
+			for _, cert := range parsed {
+				certs = append(certs, certificate{Path: file, CN: commonName(cert), NotAfter: cert.NotAfter})
+			}
+		}
+	}
+	return certs
+}
+
+// parseCertificates returns the certificates of a PEM file, or of a DER one
+func parseCertificates(data []byte) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	for rest := data; ; {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			// E.g. the private key of a combined file
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) > 0 {
+		return certs, nil
+	}
+	cert, err := x509.ParseCertificate(data)
+	if err != nil {
+		return nil, fmt.Errorf("no certificate found: %w", err)
+	}
+	return []*x509.Certificate{cert}, nil
+}
+
+// commonName returns the CN of a certificate, its first DNS name when it has
+// none
+func commonName(cert *x509.Certificate) string {
+	if cert.Subject.CommonName != "" || len(cert.DNSNames) == 0 {
+		return cert.Subject.CommonName
+	}
+	return cert.DNSNames[0]
+}
+
+func buildDataPoints(certs []certificate, now time.Time, ts int64) []metrics.DataPoint {
+	var results []metrics.DataPoint
+	for _, cert := range certs {
+		labels := map[string]string{"cn": cert.CN, "path": cert.Path}
+		// Negative once expired
+		results = append(results, metrics.DataPoint{Name: "tls_cert_expiry_seconds", Timestamp: ts, Value: cert.NotAfter.Sub(now).Seconds(), Labels: labels})
+	}
+	return results
+}
@@ -0,0 +1,125 @@
+package tlscert
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"io"
+	"log/slog"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"agent/internal/logger"
+	"agent/internal/metrics"
+)
+
+func init() {
+	logger.Log = slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+type mockPS struct {
+	mock.Mock
+}
+
+func (m *mockPS) Glob(pattern string) ([]string, error) {
+	args := m.Called(pattern)
+	files, _ := args.Get(0).([]string)
+	return files, args.Error(1)
+}
+
+func (m *mockPS) ReadFile(path string) ([]byte, error) {
+	args := m.Called(path)
+	data, _ := args.Get(0).([]byte)
+	return data, args.Error(1)
+}
+
+// newCert returns a self-signed certificate in DER
+func newCert(t *testing.T, cn string, dnsNames []string, notAfter time.Time) []byte {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: cn},
+		DNSNames:     dnsNames,
+		NotBefore:    notAfter.Add(-90 * 24 * time.Hour),
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	return der
+}
+
+func toPEM(der ...[]byte) []byte {
+	var out []byte
+	for _, d := range der {
+		out = append(out, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: d})...)
+	}
+	return out
+}
+
+func findPoint(t *testing.T, dps []metrics.DataPoint, cn, path string) metrics.DataPoint {
+	t.Helper()
+	for _, dp := range dps {
+		if dp.Labels["cn"] == cn && dp.Labels["path"] == path {
+			return dp
+		}
+	}
+	t.Fatalf("certificate %s of %s not found", cn, path)
+	return metrics.DataPoint{}
+}
+
+func TestTLSCertCollector(t *testing.T) {
+	now := time.Date(2026, 10, 17, 0, 0, 0, 0, time.UTC)
+	leaf := newCert(t, "example.com", nil, now.Add(30*24*time.Hour))
+	intermediate := newCert(t, "R11", nil, now.Add(365*24*time.Hour))
+	expired := newCert(t, "", []string{"old.example.com"}, now.Add(-time.Hour))
+	key := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: []byte("key")})
+
+	var mps mockPS
+	mps.On("Glob", "/etc/letsencrypt/live/*/fullchain.pem").Return([]string{"/etc/letsencrypt/live/example.com/fullchain.pem"}, nil)
+	mps.On("Glob", "/etc/nginx/certs/*").Return([]string{"/etc/nginx/certs/old.der", "/etc/nginx/certs/combined.pem", "/etc/nginx/certs/broken.pem", "/etc/nginx/certs/secret.pem"}, nil)
+	mps.On("ReadFile", "/etc/letsencrypt/live/example.com/fullchain.pem").Return(toPEM(leaf, intermediate), nil)
+	mps.On("ReadFile", "/etc/nginx/certs/old.der").Return(expired, nil)
+	mps.On("ReadFile", "/etc/nginx/certs/combined.pem").Return(append(key, toPEM(leaf)...), nil)
+	mps.On("ReadFile", "/etc/nginx/certs/broken.pem").Return([]byte("not a certificate"), nil)
+	mps.On("ReadFile", "/etc/nginx/certs/secret.pem").Return(nil, errors.New("permission denied"))
+
+	c := newTLSCertCollector(&mps, []string{"/etc/letsencrypt/live/*/fullchain.pem", "/etc/nginx/certs/*"})
+	c.now = func() time.Time { return now }
+	dps, err := c.CollectAll()
+	require.NoError(t, err)
+	require.Len(t, dps, 4)
+	for _, dp := range dps {
+		assert.Equal(t, "tls_cert_expiry_seconds", dp.Name)
+	}
+
+	assert.Equal(t, (30 * 24 * time.Hour).Seconds(), findPoint(t, dps, "example.com", "/etc/letsencrypt/live/example.com/fullchain.pem").Value)
+	assert.Equal(t, (365 * 24 * time.Hour).Seconds(), findPoint(t, dps, "R11", "/etc/letsencrypt/live/example.com/fullchain.pem").Value)
+	// Without CN, the first DNS name
+	assert.Equal(t, -time.Hour.Seconds(), findPoint(t, dps, "old.example.com", "/etc/nginx/certs/old.der").Value)
+	findPoint(t, dps, "example.com", "/etc/nginx/certs/combined.pem")
+}
+
+func TestTLSCertCollector_NoCertificates(t *testing.T) {
+	var mps mockPS
+	mps.On("Glob", defaultPaths[0]).Return(nil, nil)
+
+	c := newTLSCertCollector(&mps, nil)
+	dps, err := c.CollectAll()
+	require.NoError(t, err)
+	assert.Empty(t, dps)
+
+	discovered, err := c.Discover()
+	require.NoError(t, err)
+	assert.Empty(t, discovered)
+}
@@ -0,0 +1,92 @@
+package metrics
+
+import (
+	"fmt"
+	"maps"
+	"path"
+
+	"agent/internal/config"
+)
+
+// Transformer applies the user defined metric transforms to the collected
+// data points, between collection and export.
+type Transformer struct {
+	rules []config.MetricTransform
+}
+
+// NewTransformer validates the transforms and returns a transformer, or nil
+// when there is nothing to apply.
+func NewTransformer(rules []config.MetricTransform) (*Transformer, error) {
+	if len(rules) == 0 {
+		return nil, nil
+	}
+	for i, rule := range rules {
+		if rule.Match == "" {
+			return nil, fmt.Errorf("metric transform %d: empty match pattern", i)
+		}
+		if _, err := path.Match(rule.Match, ""); err != nil {
+			return nil, fmt.Errorf("metric transform %d: invalid match pattern %q: %w", i, rule.Match, err)
+		}
+	}
+	return &Transformer{rules: rules}, nil
+}
+
+// Apply returns the transformed data points. The labels of the input are
+// never modified, since collectors may share them between data points.
+func (t *Transformer) Apply(dps []DataPoint) []DataPoint {
+	if t == nil {
+		return dps
+	}
+	out := make([]DataPoint, 0, len(dps))
+	for _, dp := range dps {
+		if dp, keep := t.apply(dp); keep {
+			out = append(out, dp)
+		}
+	}
+	return out
+}
+
+func (t *Transformer) apply(dp DataPoint) (DataPoint, bool) {
+	copied := false
+	for _, rule := range t.rules {
+		if !matchTransform(rule, dp) {
+			continue
+		}
+		if rule.Drop {
+			return dp, false
+		}
+		if rule.Rename != "" {
+			dp.Name = rule.Rename
+		}
+		if rule.Scale != 0 {
+			dp.Value *= rule.Scale
+		}
+		if len(rule.AddLabels) == 0 && len(rule.RemoveLabels) == 0 {
+			continue
+		}
+		if !copied {
+			dp.Labels = maps.Clone(dp.Labels)
+			if dp.Labels == nil {
+				dp.Labels = make(map[string]string)
+			}
+			copied = true
+		}
+		maps.Copy(dp.Labels, rule.AddLabels)
+		for _, key := range rule.RemoveLabels {
+			delete(dp.Labels, key)
+		}
+	}
+	return dp, true
+}
+
+func matchTransform(rule config.MetricTransform, dp DataPoint) bool {
+	if ok, _ := path.Match(rule.Match, dp.Name); !ok {
+		return false
+	}
+	for key, value := range rule.MatchLabels {
+		if dp.Labels[key] != value {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,49 @@
+package metrics
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"agent/internal/config"
+)
+
+func TestTransformerDisabled(t *testing.T) {
+	tr, err := NewTransformer(nil)
+	require.NoError(t, err)
+	assert.Nil(t, tr)
+
+	dps := []DataPoint{{Name: "mem_used_bytes", Value: 1}}
+	assert.Equal(t, dps, tr.Apply(dps))
+}
+
+func TestTransformerInvalidPattern(t *testing.T) {
+	_, err := NewTransformer([]config.MetricTransform{{Match: "disk_["}})
+	assert.Error(t, err)
+
+	_, err = NewTransformer([]config.MetricTransform{{Rename: "x"}})
+	assert.Error(t, err)
+}
+
+func TestTransformerApply(t *testing.T) {
+	tr, err := NewTransformer([]config.MetricTransform{
+		{Match: "*_bytes", MatchLabels: map[string]string{"mountpoint": "/"}, Rename: "root_used_gib", Scale: 1.0 / (1 << 30)},
+		{Match: "root_used_gib", AddLabels: map[string]string{"team": "infra"}, RemoveLabels: []string{"mountpoint"}},
+		{Match: "cpu_*", Drop: true},
+	})
+	require.NoError(t, err)
+
+	shared := map[string]string{"mountpoint": "/"}
+	out := tr.Apply([]DataPoint{
+		{Name: "disk_used_bytes", Value: 2 << 30, Labels: shared},
+		{Name: "disk_used_bytes", Value: 1 << 30, Labels: map[string]string{"mountpoint": "/home"}},
+		{Name: "cpu_usage_ratio", Value: 0.5},
+	})
+
+	require.Len(t, out, 2)
+	assert.Equal(t, DataPoint{Name: "root_used_gib", Value: 2, Labels: map[string]string{"team": "infra"}}, out[0])
+	assert.Equal(t, DataPoint{Name: "disk_used_bytes", Value: 1 << 30, Labels: map[string]string{"mountpoint": "/home"}}, out[1])
+	// The labels of the collected data points are left untouched
+	assert.Equal(t, map[string]string{"mountpoint": "/"}, shared)
+}
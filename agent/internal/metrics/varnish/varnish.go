@@ -0,0 +1,211 @@
+package varnish
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"time"
+
+	"agent/internal/collection"
+	"agent/internal/logger"
+	"agent/internal/metrics"
+)
+
+type VarnishPS interface {
+	// Stats returns the JSON output of "varnishstat -1 -j".
+	Stats() ([]byte, error)
+}
+
+type systemPS struct {
+	timeout time.Duration
+}
+
+func (s *systemPS) Stats() ([]byte, error) {
+	if _, err := exec.LookPath("varnishstat"); err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, "varnishstat", "-1", "-j").Output()
+	if err != nil {
+		return nil, fmt.Errorf("varnishstat failed: %w", err)
+	}
+	return out, nil
+}
+
+type VarnishCollector struct {
+	metrics.BaseCollector
+
+	ps        VarnishPS
+	lastStats *varnishStats
+}
+
+func NewVarnishCollector() *VarnishCollector {
+	return &VarnishCollector{
+		ps: &systemPS{timeout: 5 * time.Second},
+	}
+}
+
+func (c *VarnishCollector) Name() string {
+	return "varnish"
+}
+
+type varnishStats struct {
+	Ts    int64
+	Stats map[string]float64
+}
+
+func getRate(key string) func(current, previous *varnishStats) float64 {
+	return func(current, previous *varnishStats) float64 {
+		if previous == nil {
+			return 0
+		}
+		deltaT := float64(current.Ts-previous.Ts) / 1000.0
+		if deltaT <= 0 {
+			return 0
+		}
+		val := current.Stats[key]
+		prevVal := previous.Stats[key]
+		delta := val - prevVal
+		if val < prevVal {
+			// Counter reset detected (varnishd restart)
+			delta = val
+		}
+		return delta / deltaT
+	}
+}
+
+func getGauge(key string) func(current, previous *varnishStats) float64 {
+	return func(current, previous *varnishStats) float64 {
+		return current.Stats[key]
+	}
+}
+
+var varnishMetrics = []struct {
+	name   string
+	getVal func(current, previous *varnishStats) float64
+}{
+	{"varnish_requests_rate", getRate("MAIN.client_req")},
+	{"varnish_cache_hit_rate", getRate("MAIN.cache_hit")},
+	{"varnish_cache_miss_rate", getRate("MAIN.cache_miss")},
+	{"varnish_cache_hit_ratio", func(current, previous *varnishStats) float64 {
+		hits := getRate("MAIN.cache_hit")(current, previous)
+		misses := getRate("MAIN.cache_miss")(current, previous)
+		if hits+misses == 0 {
+			return 0
+		}
+		return hits / (hits + misses)
+	}},
+	{"varnish_backend_requests_rate", getRate("MAIN.backend_req")},
+	{"varnish_backend_failures_rate", getRate("MAIN.backend_fail")},
+	{"varnish_backend_unhealthy_rate", getRate("MAIN.backend_unhealthy")},
+	{"varnish_fetch_failed_rate", getRate("MAIN.fetch_failed")},
+	{"varnish_threads_total", getGauge("MAIN.threads")},
+	{"varnish_threads_limited_rate", getRate("MAIN.threads_limited")},
+	{"varnish_threads_failed_rate", getRate("MAIN.threads_failed")},
+	{"varnish_sessions_dropped_rate", getRate("MAIN.sess_dropped")},
+	{"varnish_objects_total", getGauge("MAIN.n_object")},
+	{"varnish_lru_nuked_rate", getRate("MAIN.n_lru_nuked")},
+}
+
+func (c *VarnishCollector) Collect() ([]metrics.DataPoint, error) {
+	all, err := c.CollectAll()
+	if err != nil {
+		return nil, err
+	}
+	var included []metrics.DataPoint
+	for _, dp := range all {
+		if c.IsIncluded(dp.Name, dp.Labels) {
+			included = append(included, dp)
+		}
+	}
+	return included, nil
+}
+
+func (c *VarnishCollector) CollectAll() ([]metrics.DataPoint, error) {
+	stats, err := c.getStats()
+	if err != nil {
+		logger.Log.Debug("Failed to collect metrics", "collector", c.Name(), "error", err)
+		return nil, nil
+	}
+
+	var results []metrics.DataPoint
+	for _, m := range varnishMetrics {
+		results = append(results, metrics.DataPoint{
+			Name:      m.name,
+			Timestamp: stats.Ts,
+			Value:     m.getVal(stats, c.lastStats),
+			Labels:    map[string]string{},
+		})
+	}
+
+	c.lastStats = stats
+
+	return results, nil
+}
+
+func (c *VarnishCollector) Discover() ([]collection.Metric, error) {
+	_, err := c.ps.Stats()
+	if err != nil {
+		return nil, nil
+	}
+
+	var discovered []collection.Metric
+	for _, m := range varnishMetrics {
+		discovered = append(discovered, collection.Metric{
+			Name:   m.name,
+			Type:   "gauge",
+			Labels: map[string]string{},
+		})
+	}
+	return discovered, nil
+}
+
+func (c *VarnishCollector) getStats() (*varnishStats, error) {
+	timestamp := time.Now().UnixMilli()
+	out, err := c.ps.Stats()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get stats: %w", err)
+	}
+
+	statsMap, err := parseVarnishStats(out)
+	if err != nil {
+		return nil, err
+	}
+	return &varnishStats{
+		Ts:    timestamp,
+		Stats: statsMap,
+	}, nil
+}
+
+type varnishCounter struct {
+	Value float64 `json:"value"`
+}
+
+// parseVarnishStats reads the counters of "varnishstat -j". Varnish 6.5 and
+// later nest them in a "counters" object, older versions list them at the
+// top level next to "timestamp".
+func parseVarnishStats(out []byte) (map[string]float64, error) {
+	var doc map[string]json.RawMessage
+	if err := json.Unmarshal(out, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse varnishstat output: %w", err)
+	}
+	if counters, ok := doc["counters"]; ok {
+		doc = nil
+		if err := json.Unmarshal(counters, &doc); err != nil {
+			return nil, fmt.Errorf("failed to parse varnishstat counters: %w", err)
+		}
+	}
+
+	stats := make(map[string]float64)
+	for name, raw := range doc {
+		var counter varnishCounter
+		// Skip non counter fields (version, timestamp)
+		if err := json.Unmarshal(raw, &counter); err != nil {
+			continue
+		}
+		stats[name] = counter.Value
+	}
+	return stats, nil
+}
@@ -0,0 +1,112 @@
+package varnish
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"agent/internal/logger"
+	"agent/internal/metrics"
+)
+
+func init() {
+	logger.Log = slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+type mockPS struct {
+	mock.Mock
+}
+
+func (m *mockPS) Stats() ([]byte, error) {
+	args := m.Called()
+	out, _ := args.Get(0).([]byte)
+	return out, args.Error(1)
+}
+
+const statsV1 = `{"version":1,"timestamp":"2025-10-12T10:00:00","counters":{
+  "MAIN.client_req":{"description":"Good client requests received","flag":"c","format":"i","value":%d},
+  "MAIN.cache_hit":{"description":"Cache hits","flag":"c","format":"i","value":%d},
+  "MAIN.cache_miss":{"description":"Cache misses","flag":"c","format":"i","value":%d},
+  "MAIN.backend_fail":{"description":"Backend conn. failures","flag":"c","format":"i","value":%d},
+  "MAIN.threads":{"description":"Total number of threads","flag":"g","format":"i","value":200}}}`
+
+func TestParseVarnishStats(t *testing.T) {
+	stats, err := parseVarnishStats([]byte(fmt.Sprintf(statsV1, 10, 8, 2, 0)))
+	require.NoError(t, err)
+	assert.Equal(t, 8.0, stats["MAIN.cache_hit"])
+	assert.Equal(t, 200.0, stats["MAIN.threads"])
+	assert.NotContains(t, stats, "counters")
+
+	// Varnish before 6.5 has no counters object
+	stats, err = parseVarnishStats([]byte(`{"timestamp":"2020-01-01T00:00:00",
+		"MAIN.cache_hit":{"description":"Cache hits","flag":"c","format":"i","value":42}}`))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]float64{"MAIN.cache_hit": 42}, stats)
+
+	_, err = parseVarnishStats([]byte("varnishstat: could not open shared memory"))
+	assert.Error(t, err)
+}
+
+func TestVarnishCollector_CollectAll(t *testing.T) {
+	var mps mockPS
+	defer mps.AssertExpectations(t)
+	mps.On("Stats").Return([]byte(fmt.Sprintf(statsV1, 100, 80, 20, 1)), nil).Once()
+
+	vc := &VarnishCollector{ps: &mps}
+	dps1, err := vc.CollectAll()
+	require.NoError(t, err)
+	assertContainsMetric(t, dps1, "varnish_threads_total", 200.0)
+	assertContainsMetric(t, dps1, "varnish_cache_hit_rate", 0.0)
+
+	// Manually set lastStats Ts to 1 second ago for deterministic rate
+	vc.lastStats.Ts = dps1[0].Timestamp - 1000
+
+	mps.On("Stats").Return([]byte(fmt.Sprintf(statsV1, 150, 120, 30, 4)), nil).Once()
+	dps2, err := vc.CollectAll()
+	require.NoError(t, err)
+	assertMetricInDelta(t, dps2, "varnish_requests_rate", 50.0)
+	assertMetricInDelta(t, dps2, "varnish_cache_hit_rate", 40.0)
+	assertMetricInDelta(t, dps2, "varnish_cache_hit_ratio", 0.8)
+	assertMetricInDelta(t, dps2, "varnish_backend_failures_rate", 3.0)
+}
+
+func TestVarnishCollector_Errors(t *testing.T) {
+	var mps mockPS
+	mps.On("Stats").Return(nil, fmt.Errorf("varnishstat not found"))
+	vc := &VarnishCollector{ps: &mps}
+
+	dps, err := vc.CollectAll()
+	require.NoError(t, err)
+	assert.Nil(t, dps)
+
+	discovered, err := vc.Discover()
+	require.NoError(t, err)
+	assert.Nil(t, discovered)
+}
+
+func assertContainsMetric(t *testing.T, dps []metrics.DataPoint, name string, value float64) {
+	for _, dp := range dps {
+		if dp.Name == name {
+			assert.Equal(t, value, dp.Value, "Metric %s", name)
+			return
+		}
+	}
+	assert.Failf(t, "Metric not found", "Could not find metric %q", name)
+}
+
+// assertMetricInDelta allows for the few milliseconds elapsed between two
+// collections in rate computations.
+func assertMetricInDelta(t *testing.T, dps []metrics.DataPoint, name string, value float64) {
+	for _, dp := range dps {
+		if dp.Name == name {
+			assert.InEpsilon(t, value, dp.Value, 0.05, "Metric %s", name)
+			return
+		}
+	}
+	assert.Failf(t, "Metric not found", "Could not find metric %q", name)
+}
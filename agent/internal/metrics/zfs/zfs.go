@@ -0,0 +1,275 @@
+package zfs
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"agent/internal/collection"
+	"agent/internal/logger"
+	"agent/internal/metrics"
+)
+
+const commandTimeout = 10 * time.Second
+
+type ZFSPS interface {
+	// PoolList returns "zpool list -Hp" output, see poolListArgs.
+	PoolList() ([]byte, error)
+	// PoolStatus returns "zpool status" output of a pool.
+	PoolStatus(pool string) ([]byte, error)
+	// DatasetList returns "zfs list -Hp" output, see datasetListArgs.
+	DatasetList() ([]byte, error)
+}
+
+var (
+	poolListArgs    = []string{"list", "-Hp", "-o", "name,size,alloc,free,frag,cap,health"}
+	datasetListArgs = []string{"list", "-Hp", "-t", "filesystem", "-o", "name,used,avail"}
+)
+
+type systemPS struct{}
+
+func (s *systemPS) PoolList() ([]byte, error) {
+	return run("zpool", poolListArgs...)
+}
+
+func (s *systemPS) PoolStatus(pool string) ([]byte, error) {
+	return run("zpool", "status", "-p", pool)
+}
+
+func (s *systemPS) DatasetList() ([]byte, error) {
+	return run("zfs", datasetListArgs...)
+}
+
+func run(name string, args ...string) ([]byte, error) {
+	if _, err := exec.LookPath(name); err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), commandTimeout)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, name, args...).Output()
+	if err != nil {
+		return nil, fmt.Errorf("%s failed: %w", name, err)
+	}
+	return out, nil
+}
+
+// poolStats is an internal type used to store the state of a pool
+type poolStats struct {
+	Name          string
+	Health        string
+	Size          float64
+	Alloc         float64
+	Free          float64
+	Fragmentation float64 // Percent, -1 when unknown
+	Capacity      float64 // Percent
+	// Fields read from zpool status
+	ScrubRunning   bool
+	LastScrub      time.Time
+	ScrubErrors    float64
+	ReadErrors     float64
+	WriteErrors    float64
+	ChecksumErrors float64
+}
+
+// zfsPoolMetrics list the metrics reported for each pool
+var zfsPoolMetrics = []struct {
+	name   string
+	getVal func(p *poolStats) (float64, bool)
+}{
+	{"zfs_pool_healthy", func(p *poolStats) (float64, bool) { return boolToFloat(p.Health == "ONLINE"), true }},
+	{"zfs_pool_size_bytes", func(p *poolStats) (float64, bool) { return p.Size, true }},
+	{"zfs_pool_allocated_bytes", func(p *poolStats) (float64, bool) { return p.Alloc, true }},
+	{"zfs_pool_free_bytes", func(p *poolStats) (float64, bool) { return p.Free, true }},
+	{"zfs_pool_used_ratio", func(p *poolStats) (float64, bool) { return p.Capacity / 100, true }},
+	{"zfs_pool_fragmentation_ratio", func(p *poolStats) (float64, bool) {
+		return p.Fragmentation / 100, p.Fragmentation >= 0
+	}},
+	{"zfs_pool_scrub_in_progress", func(p *poolStats) (float64, bool) { return boolToFloat(p.ScrubRunning), true }},
+	{"zfs_pool_last_scrub_timestamp", func(p *poolStats) (float64, bool) {
+		return float64(p.LastScrub.Unix()), !p.LastScrub.IsZero()
+	}},
+	{"zfs_pool_scrub_errors_total", func(p *poolStats) (float64, bool) { return p.ScrubErrors, true }},
+	{"zfs_pool_read_errors_total", func(p *poolStats) (float64, bool) { return p.ReadErrors, true }},
+	{"zfs_pool_write_errors_total", func(p *poolStats) (float64, bool) { return p.WriteErrors, true }},
+	{"zfs_pool_checksum_errors_total", func(p *poolStats) (float64, bool) { return p.ChecksumErrors, true }},
+}
+
+// ZFSCollector reports ZFS pool health, capacity, scrubs and dataset usage.
+type ZFSCollector struct {
+	metrics.BaseCollector
+
+	ps ZFSPS
+}
+
+func NewZFSCollector() *ZFSCollector {
+	return &ZFSCollector{ps: &systemPS{}}
+}
+
+func (c *ZFSCollector) Name() string {
+	return "zfs"
+}
+
+func (c *ZFSCollector) Collect() ([]metrics.DataPoint, error) {
+	all, err := c.CollectAll()
+	if err != nil {
+		return nil, err
+	}
+	var included []metrics.DataPoint
+	for _, dp := range all {
+		if c.IsIncluded(dp.Name, dp.Labels) {
+			included = append(included, dp)
+		}
+	}
+	return included, nil
+}
+
+func (c *ZFSCollector) CollectAll() ([]metrics.DataPoint, error) {
+	timestamp := time.Now().UnixMilli()
+	out, err := c.ps.PoolList()
+	if err != nil {
+		logger.Log.Debug("Failed to collect metrics", "collector", c.Name(), "error", err)
+		return nil, nil
+	}
+
+	var results []metrics.DataPoint
+	for _, pool := range parsePoolList(out) {
+		if status, err := c.ps.PoolStatus(pool.Name); err == nil {
+			parsePoolStatus(status, pool)
+		} else {
+			logger.Log.Debug("Failed to read pool status", "collector", c.Name(), "pool", pool.Name, "error", err)
+		}
+		for _, m := range zfsPoolMetrics {
+			val, ok := m.getVal(pool)
+			if !ok {
+				continue
+			}
+			results = append(results, metrics.DataPoint{
+				Name:      m.name,
+				Timestamp: timestamp,
+				Value:     val,
+				Labels:    map[string]string{"pool": pool.Name},
+			})
+		}
+	}
+
+	if out, err := c.ps.DatasetList(); err == nil {
+		results = append(results, datasetDataPoints(out, timestamp)...)
+	}
+	return results, nil
+}
+
+func (c *ZFSCollector) Discover() ([]collection.Metric, error) {
+	all, err := c.CollectAll()
+	if err != nil {
+		return nil, err
+	}
+	discovered := []collection.Metric{}
+	for _, dp := range all {
+		discovered = append(discovered, collection.Metric{
+			Name:   dp.Name,
+			Type:   "gauge",
+			Labels: dp.Labels,
+		})
+	}
+	return discovered, nil
+}
+
+// parsePoolList parses tab separated "zpool list -Hp" output.
+func parsePoolList(out []byte) []*poolStats {
+	var pools []*poolStats
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), "\t")
+		if len(fields) != 7 {
+			continue
+		}
+		pool := &poolStats{Name: fields[0], Health: fields[6], Fragmentation: -1}
+		pool.Size = parseNumber(fields[1])
+		pool.Alloc = parseNumber(fields[2])
+		pool.Free = parseNumber(fields[3])
+		// Fragmentation is "-" for pools without space maps
+		if frag, err := strconv.ParseFloat(strings.TrimSuffix(fields[4], "%"), 64); err == nil {
+			pool.Fragmentation = frag
+		}
+		pool.Capacity = parseNumber(strings.TrimSuffix(fields[5], "%"))
+		pools = append(pools, pool)
+	}
+	return pools
+}
+
+var (
+	scrubDoneRe = regexp.MustCompile(`scrub repaired \S+ in \S+ with (\d+) errors on (.+)$`)
+	// Layout of the dates printed by zpool status, e.g. "Sun Oct 12 00:25:03 2025"
+	scrubDateLayout = "Mon Jan 2 15:04:05 2006"
+)
+
+// parsePoolStatus reads the last scrub and the pool error counters from
+// "zpool status" output:
+//
+//	  scan: scrub repaired 0B in 00:01:02 with 0 errors on Sun Oct 12 00:25:03 2025
+//	config:
+//
+//		NAME        STATE     READ WRITE CKSUM
+//		tank        ONLINE       0     0     0
+func parsePoolStatus(out []byte, pool *poolStats) {
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if scan, ok := strings.CutPrefix(line, "scan:"); ok {
+			scan = strings.TrimSpace(scan)
+			pool.ScrubRunning = strings.HasPrefix(scan, "scrub in progress")
+			if m := scrubDoneRe.FindStringSubmatch(scan); m != nil {
+				pool.ScrubErrors = parseNumber(m[1])
+				date := strings.Join(strings.Fields(m[2]), " ")
+				if t, err := time.ParseInLocation(scrubDateLayout, date, time.Local); err == nil {
+					pool.LastScrub = t
+				}
+			}
+			continue
+		}
+
+		// The first row named after the pool holds the pool wide counters
+		fields := strings.Fields(line)
+		if len(fields) == 5 && fields[0] == pool.Name {
+			pool.ReadErrors = parseNumber(fields[2])
+			pool.WriteErrors = parseNumber(fields[3])
+			pool.ChecksumErrors = parseNumber(fields[4])
+		}
+	}
+}
+
+// datasetDataPoints parses "zfs list -Hp" output.
+func datasetDataPoints(out []byte, ts int64) []metrics.DataPoint {
+	var results []metrics.DataPoint
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), "\t")
+		if len(fields) != 3 {
+			continue
+		}
+		labels := map[string]string{"dataset": fields[0]}
+		results = append(results,
+			metrics.DataPoint{Name: "zfs_dataset_used_bytes", Timestamp: ts, Value: parseNumber(fields[1]), Labels: labels},
+			metrics.DataPoint{Name: "zfs_dataset_available_bytes", Timestamp: ts, Value: parseNumber(fields[2]), Labels: labels},
+		)
+	}
+	return results
+}
+
+func parseNumber(s string) float64 {
+	v, _ := strconv.ParseFloat(s, 64)
+	return v
+}
+
+func boolToFloat(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,131 @@
+package zfs
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"agent/internal/logger"
+	"agent/internal/metrics"
+)
+
+func init() {
+	logger.Log = slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+type mockPS struct {
+	mock.Mock
+}
+
+func (m *mockPS) PoolList() ([]byte, error) {
+	args := m.Called()
+	out, _ := args.Get(0).([]byte)
+	return out, args.Error(1)
+}
+
+func (m *mockPS) PoolStatus(pool string) ([]byte, error) {
+	args := m.Called(pool)
+	out, _ := args.Get(0).([]byte)
+	return out, args.Error(1)
+}
+
+func (m *mockPS) DatasetList() ([]byte, error) {
+	args := m.Called()
+	out, _ := args.Get(0).([]byte)
+	return out, args.Error(1)
+}
+
+const poolList = "tank\t3985729650688\t1993001312256\t1992728338432\t12\t50\tONLINE\n" +
+	"backup\t1000204886016\t900184397414\t100020488602\t-\t90\tDEGRADED\n"
+
+const tankStatus = `  pool: tank
+ state: ONLINE
+  scan: scrub repaired 0B in 01:02:03 with 0 errors on Sun Oct  5 00:25:03 2025
+config:
+
+	NAME        STATE     READ WRITE CKSUM
+	tank        ONLINE       0     0     0
+	  mirror-0  ONLINE       0     0     0
+	    sda     ONLINE       0     0     0
+	    sdb     ONLINE       0     0     0
+
+errors: No known data errors
+`
+
+const backupStatus = `  pool: backup
+ state: DEGRADED
+  scan: scrub in progress since Mon Oct 13 10:00:00 2025
+config:
+
+	NAME        STATE     READ WRITE CKSUM
+	backup      DEGRADED     0     0     3
+	  mirror-0  DEGRADED     0     0     6
+	    sdc     FAULTED      2     0     6  too many errors
+	    sdd     ONLINE       0     0     0
+`
+
+func findPoint(t *testing.T, dps []metrics.DataPoint, name, key, value string) metrics.DataPoint {
+	t.Helper()
+	for _, dp := range dps {
+		if dp.Name == name && dp.Labels[key] == value {
+			return dp
+		}
+	}
+	t.Fatalf("data point %s{%s=%s} not found", name, key, value)
+	return metrics.DataPoint{}
+}
+
+func TestZFSCollector(t *testing.T) {
+	var mps mockPS
+	defer mps.AssertExpectations(t)
+	mps.On("PoolList").Return([]byte(poolList), nil)
+	mps.On("PoolStatus", "tank").Return([]byte(tankStatus), nil)
+	mps.On("PoolStatus", "backup").Return([]byte(backupStatus), nil)
+	mps.On("DatasetList").Return([]byte("tank\t1993001312256\t1870000000000\ntank/home\t500\t1870000000000\n"), nil)
+
+	c := &ZFSCollector{ps: &mps}
+	dps, err := c.CollectAll()
+	require.NoError(t, err)
+
+	assert.Equal(t, 1.0, findPoint(t, dps, "zfs_pool_healthy", "pool", "tank").Value)
+	assert.Equal(t, 3985729650688.0, findPoint(t, dps, "zfs_pool_size_bytes", "pool", "tank").Value)
+	assert.InDelta(t, 0.12, findPoint(t, dps, "zfs_pool_fragmentation_ratio", "pool", "tank").Value, 0.0001)
+	assert.Equal(t, 0.0, findPoint(t, dps, "zfs_pool_scrub_in_progress", "pool", "tank").Value)
+	scrub := time.Date(2025, time.October, 5, 0, 25, 3, 0, time.Local)
+	assert.Equal(t, float64(scrub.Unix()), findPoint(t, dps, "zfs_pool_last_scrub_timestamp", "pool", "tank").Value)
+
+	assert.Equal(t, 0.0, findPoint(t, dps, "zfs_pool_healthy", "pool", "backup").Value)
+	assert.InDelta(t, 0.9, findPoint(t, dps, "zfs_pool_used_ratio", "pool", "backup").Value, 0.0001)
+	assert.Equal(t, 1.0, findPoint(t, dps, "zfs_pool_scrub_in_progress", "pool", "backup").Value)
+	assert.Equal(t, 3.0, findPoint(t, dps, "zfs_pool_checksum_errors_total", "pool", "backup").Value)
+
+	assert.Equal(t, 500.0, findPoint(t, dps, "zfs_dataset_used_bytes", "dataset", "tank/home").Value)
+
+	for _, dp := range dps {
+		if dp.Labels["pool"] == "backup" {
+			assert.NotEqual(t, "zfs_pool_fragmentation_ratio", dp.Name, "unknown fragmentation is skipped")
+			assert.NotEqual(t, "zfs_pool_last_scrub_timestamp", dp.Name, "no completed scrub")
+		}
+	}
+}
+
+func TestZFSCollectorNotInstalled(t *testing.T) {
+	var mps mockPS
+	defer mps.AssertExpectations(t)
+	mps.On("PoolList").Return(nil, errors.New("zpool not found"))
+
+	c := &ZFSCollector{ps: &mps}
+	dps, err := c.CollectAll()
+	assert.NoError(t, err)
+	assert.Empty(t, dps)
+
+	discovered, err := c.Discover()
+	assert.NoError(t, err)
+	assert.Empty(t, discovered)
+}
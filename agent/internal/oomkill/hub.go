@@ -0,0 +1,98 @@
+package oomkill
+
+import (
+	"context"
+	"sync"
+
+	"agent/internal/logger"
+)
+
+// subscriptionBuffer is the number of kills kept for a slow subscriber
+// before they are dropped
+const subscriptionBuffer = 100
+
+// Subscription receives the OOM kills happening after it was created
+type Subscription struct {
+	C <-chan Kill
+	c chan Kill
+}
+
+var (
+	mu          sync.Mutex
+	subscribers = make(map[*Subscription]struct{})
+	cancel      context.CancelFunc
+	done        chan struct{}
+	// follow is replaced in tests
+	follow = followKernelLog
+)
+
+// Subscribe returns a subscription to the OOM kills. The kernel log is
+// followed as long as there is at least one subscription.
+func Subscribe() *Subscription {
+	mu.Lock()
+	defer mu.Unlock()
+
+	c := make(chan Kill, subscriptionBuffer)
+	s := &Subscription{C: c, c: c}
+	subscribers[s] = struct{}{}
+
+	if cancel == nil {
+		var ctx context.Context
+		ctx, cancel = context.WithCancel(context.Background())
+		done = make(chan struct{})
+		go run(ctx, done)
+	}
+	return s
+}
+
+// Close ends the subscription and closes its channel.
+func (s *Subscription) Close() {
+	mu.Lock()
+	if _, ok := subscribers[s]; !ok {
+		mu.Unlock()
+		return
+	}
+	delete(subscribers, s)
+	close(s.c)
+
+	var wait chan struct{}
+	if len(subscribers) == 0 && cancel != nil {
+		cancel()
+		cancel = nil
+		wait = done
+	}
+	mu.Unlock()
+
+	if wait != nil {
+		<-wait
+	}
+}
+
+func run(ctx context.Context, done chan struct{}) {
+	defer close(done)
+
+	var parser Parser
+	err := follow(ctx, func(message string) {
+		kill, ok := parser.Parse(message)
+		if !ok {
+			return
+		}
+		logger.Log.Debug("OOM kill detected", "process", kill.Process, "pid", kill.PID, "cgroup", kill.Cgroup)
+		publish(kill)
+	})
+	if err != nil && ctx.Err() == nil {
+		logger.Log.Warn("Stopped following the kernel log for OOM kills", "error", err)
+	}
+}
+
+func publish(kill Kill) {
+	mu.Lock()
+	defer mu.Unlock()
+	for s := range subscribers {
+		select {
+		case s.c <- kill:
+		default:
+			logger.Log.Debug("Dropping OOM kill for a slow subscriber", "process", kill.Process)
+		}
+	}
+}
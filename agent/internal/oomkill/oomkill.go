@@ -0,0 +1,108 @@
+// Package oomkill follows the kernel log and reports the processes killed by
+// the OOM killer. It is shared by the oom log and metric collectors, the
+// kernel log is only read once whatever the number of subscribers.
+package oomkill
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Kill describes a process killed by the OOM killer
+type Kill struct {
+	Timestamp  int64 // Unix timestamp in milliseconds
+	Process    string
+	PID        int
+	UID        string
+	Cgroup     string // Memory cgroup of the victim, empty on kernels older than 4.19
+	OOMCgroup  string // Memory cgroup that ran out of memory, empty for a global OOM
+	Constraint string // e.g. CONSTRAINT_NONE, CONSTRAINT_MEMCG
+	AnonRSS    int64  // Bytes
+	TotalVM    int64  // Bytes
+}
+
+var (
+	// Out of memory: Killed process 1234 (java) total-vm:4000kB, anon-rss:2000kB, file-rss:0kB, shmem-rss:0kB, UID:1000 pgtables:100kB oom_score_adj:0
+	killedRe = regexp.MustCompile(`Killed process (\d+) \((.*?)\)`)
+	sizeRe   = regexp.MustCompile(`([a-z-]+):(\d+)kB`)
+	uidRe    = regexp.MustCompile(`UID:(\d+)`)
+)
+
+// Parser assembles the kernel messages describing an OOM kill. Kernels since
+// 4.19 log a summary line before the kill:
+//
+//	oom-kill:constraint=CONSTRAINT_MEMCG,nodemask=(null),cpuset=/,mems_allowed=0,oom_memcg=/system.slice/app.service,task_memcg=/system.slice/app.service,task=app,pid=1234,uid=0
+//
+// Its details are merged into the kill reported by the "Killed process" line.
+type Parser struct {
+	pending map[string]string
+}
+
+// Parse consumes a kernel message and returns the kill it completes, if any.
+func (p *Parser) Parse(message string) (Kill, bool) {
+	if i := strings.Index(message, "oom-kill:"); i >= 0 {
+		p.pending = parseSummary(message[i+len("oom-kill:"):])
+		return Kill{}, false
+	}
+
+	m := killedRe.FindStringSubmatch(message)
+	if m == nil {
+		return Kill{}, false
+	}
+	pid, _ := strconv.Atoi(m[1])
+	kill := Kill{
+		Timestamp: time.Now().UnixMilli(),
+		Process:   m[2],
+		PID:       pid,
+	}
+	if strings.Contains(message, "Memory cgroup out of memory") {
+		kill.Constraint = "CONSTRAINT_MEMCG"
+	}
+	for _, size := range sizeRe.FindAllStringSubmatch(message, -1) {
+		kb, _ := strconv.ParseInt(size[2], 10, 64)
+		switch size[1] {
+		case "anon-rss":
+			kill.AnonRSS = kb * 1024
+		case "total-vm":
+			kill.TotalVM = kb * 1024
+		}
+	}
+	if uid := uidRe.FindStringSubmatch(message); uid != nil {
+		kill.UID = uid[1]
+	}
+
+	// The summary only describes the kill that follows it
+	summary := p.pending
+	p.pending = nil
+	if summary != nil && summary["pid"] == m[1] {
+		kill.Cgroup = summary["task_memcg"]
+		kill.OOMCgroup = summary["oom_memcg"]
+		if c := summary["constraint"]; c != "" {
+			kill.Constraint = c
+		}
+		if kill.UID == "" {
+			kill.UID = summary["uid"]
+		}
+	}
+	return kill, true
+}
+
+// CgroupLabel returns the cgroup of the victim to use as a label value
+func (k Kill) CgroupLabel() string {
+	if k.Cgroup == "" {
+		return "unknown"
+	}
+	return k.Cgroup
+}
+
+func parseSummary(summary string) map[string]string {
+	fields := make(map[string]string)
+	for _, pair := range strings.Split(strings.TrimSpace(summary), ",") {
+		if k, v, ok := strings.Cut(pair, "="); ok {
+			fields[k] = v
+		}
+	}
+	return fields
+}
@@ -0,0 +1,93 @@
+package oomkill
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"agent/internal/logger"
+)
+
+func init() {
+	logger.Log = slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+func TestParser(t *testing.T) {
+	var p Parser
+
+	_, ok := p.Parse("oom-kill:constraint=CONSTRAINT_MEMCG,nodemask=(null),cpuset=/,mems_allowed=0,oom_memcg=/system.slice/app.service,task_memcg=/system.slice/app.service,task=java,pid=1234,uid=1000")
+	assert.False(t, ok)
+
+	kill, ok := p.Parse("Memory cgroup out of memory: Killed process 1234 (java) total-vm:4000kB, anon-rss:2000kB, file-rss:0kB, shmem-rss:0kB, UID:1000 pgtables:100kB oom_score_adj:0")
+	require.True(t, ok)
+	assert.NotZero(t, kill.Timestamp)
+	kill.Timestamp = 0
+	assert.Equal(t, Kill{
+		Process:    "java",
+		PID:        1234,
+		UID:        "1000",
+		Cgroup:     "/system.slice/app.service",
+		OOMCgroup:  "/system.slice/app.service",
+		Constraint: "CONSTRAINT_MEMCG",
+		AnonRSS:    2000 * 1024,
+		TotalVM:    4000 * 1024,
+	}, kill)
+
+	// Older kernels don't log the summary
+	kill, ok = p.Parse("Out of memory: Kill process 99 (worker) score 900 or sacrifice child")
+	assert.False(t, ok)
+	kill, ok = p.Parse("Killed process 99 (worker) total-vm:100kB, anon-rss:50kB, file-rss:0kB")
+	require.True(t, ok)
+	assert.Equal(t, "worker", kill.Process)
+	assert.Equal(t, 99, kill.PID)
+	assert.Empty(t, kill.Cgroup)
+	assert.Equal(t, "unknown", kill.CgroupLabel())
+
+	_, ok = p.Parse("eth0: link up")
+	assert.False(t, ok)
+}
+
+func TestSubscribe(t *testing.T) {
+	messages := make(chan string)
+	stopped := make(chan struct{})
+	follow = func(ctx context.Context, handle func(string)) error {
+		defer close(stopped)
+		for {
+			select {
+			case <-ctx.Done():
+				return nil
+			case m := <-messages:
+				handle(m)
+			}
+		}
+	}
+	defer func() { follow = followKernelLog }()
+
+	first, second := Subscribe(), Subscribe()
+	messages <- "Out of memory: Killed process 7 (stress) total-vm:10kB"
+
+	for _, s := range []*Subscription{first, second} {
+		select {
+		case kill := <-s.C:
+			assert.Equal(t, "stress", kill.Process)
+		case <-time.After(time.Second):
+			t.Fatal("kill not received")
+		}
+	}
+
+	// The kernel log is followed until the last subscription is closed
+	first.Close()
+	select {
+	case <-stopped:
+		t.Fatal("stopped with a remaining subscriber")
+	default:
+	}
+	second.Close()
+	<-stopped
+	second.Close()
+}
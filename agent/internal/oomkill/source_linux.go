@@ -0,0 +1,89 @@
+//go:build linux
+
+package oomkill
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+)
+
+const kmsgPath = "/dev/kmsg"
+
+// Available reports whether the kernel log can be followed, either from
+// /dev/kmsg (requires CAP_SYSLOG when dmesg_restrict is set) or through
+// journald.
+func Available() bool {
+	if f, err := os.Open(kmsgPath); err == nil {
+		f.Close()
+		return true
+	}
+	if _, err := exec.LookPath("journalctl"); err == nil {
+		return exec.Command("journalctl", "-k", "-n", "0").Run() == nil
+	}
+	return false
+}
+
+// followKernelLog calls handle with every kernel message logged until ctx is
+// cancelled. Messages logged before the call are skipped.
+func followKernelLog(ctx context.Context, handle func(message string)) error {
+	f, err := os.Open(kmsgPath)
+	if err != nil {
+		return followJournal(ctx, handle)
+	}
+	go func() {
+		<-ctx.Done()
+		f.Close()
+	}()
+
+	if _, err := f.Seek(0, io.SeekEnd); err != nil {
+		f.Close()
+		return err
+	}
+	// Each read returns a single record: "<prio>,<seq>,<usec>,<flags>;<message>"
+	// followed by indented dictionary lines.
+	buf := make([]byte, 8192)
+	for {
+		n, err := f.Read(buf)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			// EPIPE: records were overwritten before being read
+			if errors.Is(err, syscall.EPIPE) {
+				continue
+			}
+			return err
+		}
+		record, _, _ := strings.Cut(string(buf[:n]), "\n")
+		if _, message, ok := strings.Cut(record, ";"); ok {
+			handle(message)
+		}
+	}
+}
+
+// followJournal reads the kernel messages from journald when /dev/kmsg is
+// not readable.
+func followJournal(ctx context.Context, handle func(message string)) error {
+	cmd := exec.CommandContext(ctx, "journalctl", "-k", "-f", "-n", "0", "-o", "cat")
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	scanner := bufio.NewScanner(stdout)
+	for scanner.Scan() {
+		handle(scanner.Text())
+	}
+	if err := cmd.Wait(); err != nil && ctx.Err() == nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,18 @@
+//go:build !linux
+// +build !linux
+
+package oomkill
+
+import (
+	"context"
+	"errors"
+)
+
+// Available reports whether the kernel log can be followed
+func Available() bool {
+	return false
+}
+
+func followKernelLog(ctx context.Context, handle func(message string)) error {
+	return errors.New("OOM kill detection is only supported on Linux")
+}
@@ -0,0 +1,229 @@
+package otlp
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	"agent/internal/exporter"
+
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+)
+
+// resourceLabels lists the resource attributes kept as labels. Other resource
+// attributes are high cardinality or not useful for grouping.
+var resourceLabels = map[string]bool{
+	"service.name":           true,
+	"service.namespace":      true,
+	"service.version":        true,
+	"deployment.environment": true,
+}
+
+// convertMetrics flattens an OTLP metrics request into payloads. Histograms
+// and summaries are split into _count, _sum, _bucket and quantile series,
+// following the Prometheus conventions.
+func convertMetrics(req *colmetricspb.ExportMetricsServiceRequest) []exporter.MetricPayload {
+	var out []exporter.MetricPayload
+	for _, rm := range req.GetResourceMetrics() {
+		base := attributesToLabels(rm.GetResource().GetAttributes(), resourceLabels)
+		for _, sm := range rm.GetScopeMetrics() {
+			for _, m := range sm.GetMetrics() {
+				out = append(out, convertMetric(m, base)...)
+			}
+		}
+	}
+	return out
+}
+
+func convertMetric(m *metricspb.Metric, base map[string]string) []exporter.MetricPayload {
+	name := sanitizeName(m.GetName())
+	var out []exporter.MetricPayload
+	add := func(name string, ts uint64, attrs []*commonpb.KeyValue, value float64, extra ...string) {
+		labels := attributesToLabels(attrs, nil)
+		for k, v := range base {
+			labels[k] = v
+		}
+		for i := 0; i+1 < len(extra); i += 2 {
+			labels[extra[i]] = extra[i+1]
+		}
+		out = append(out, exporter.MetricPayload{
+			Timestamp: timestamp(ts),
+			Labels:    labels,
+			Name:      name,
+			Value:     value,
+		})
+	}
+
+	switch data := m.GetData().(type) {
+	case *metricspb.Metric_Gauge:
+		for _, dp := range data.Gauge.GetDataPoints() {
+			add(name, dp.GetTimeUnixNano(), dp.GetAttributes(), numberValue(dp))
+		}
+	case *metricspb.Metric_Sum:
+		sumName := name
+		if data.Sum.GetIsMonotonic() && !strings.HasSuffix(sumName, "_total") {
+			sumName += "_total"
+		}
+		for _, dp := range data.Sum.GetDataPoints() {
+			add(sumName, dp.GetTimeUnixNano(), dp.GetAttributes(), numberValue(dp))
+		}
+	case *metricspb.Metric_Histogram:
+		for _, dp := range data.Histogram.GetDataPoints() {
+			ts, attrs := dp.GetTimeUnixNano(), dp.GetAttributes()
+			add(name+"_count", ts, attrs, float64(dp.GetCount()))
+			add(name+"_sum", ts, attrs, dp.GetSum())
+			var cumulative uint64
+			bounds := dp.GetExplicitBounds()
+			for i, count := range dp.GetBucketCounts() {
+				cumulative += count
+				le := "+Inf"
+				if i < len(bounds) {
+					le = strconv.FormatFloat(bounds[i], 'g', -1, 64)
+				}
+				add(name+"_bucket", ts, attrs, float64(cumulative), "le", le)
+			}
+		}
+	case *metricspb.Metric_Summary:
+		for _, dp := range data.Summary.GetDataPoints() {
+			ts, attrs := dp.GetTimeUnixNano(), dp.GetAttributes()
+			add(name+"_count", ts, attrs, float64(dp.GetCount()))
+			add(name+"_sum", ts, attrs, dp.GetSum())
+			for _, q := range dp.GetQuantileValues() {
+				add(name, ts, attrs, q.GetValue(), "quantile", strconv.FormatFloat(q.GetQuantile(), 'g', -1, 64))
+			}
+		}
+	case *metricspb.Metric_ExponentialHistogram:
+		for _, dp := range data.ExponentialHistogram.GetDataPoints() {
+			ts, attrs := dp.GetTimeUnixNano(), dp.GetAttributes()
+			add(name+"_count", ts, attrs, float64(dp.GetCount()))
+			add(name+"_sum", ts, attrs, dp.GetSum())
+		}
+	}
+	return out
+}
+
+// convertLogs flattens an OTLP logs request into payloads. Severity and the
+// service resource attributes become labels, everything else is metadata.
+func convertLogs(req *collogspb.ExportLogsServiceRequest) []exporter.LogPayload {
+	var out []exporter.LogPayload
+	for _, rl := range req.GetResourceLogs() {
+		resourceAttrs := rl.GetResource().GetAttributes()
+		base := attributesToLabels(resourceAttrs, resourceLabels)
+		for _, sl := range rl.GetScopeLogs() {
+			for _, lr := range sl.GetLogRecords() {
+				labels := map[string]string{"source": "otlp"}
+				for k, v := range base {
+					labels[k] = v
+				}
+				if severity := lr.GetSeverityText(); severity != "" {
+					labels["level"] = strings.ToLower(severity)
+				}
+
+				metadata := attributesToLabels(lr.GetAttributes(), nil)
+				if traceID := lr.GetTraceId(); len(traceID) > 0 {
+					metadata["trace_id"] = hex.EncodeToString(traceID)
+				}
+				if spanID := lr.GetSpanId(); len(spanID) > 0 {
+					metadata["span_id"] = hex.EncodeToString(spanID)
+				}
+				if scope := sl.GetScope().GetName(); scope != "" {
+					metadata["scope"] = scope
+				}
+
+				ts := lr.GetTimeUnixNano()
+				if ts == 0 {
+					ts = lr.GetObservedTimeUnixNano()
+				}
+				out = append(out, exporter.LogPayload{
+					Timestamp: timestamp(ts),
+					Labels:    labels,
+					Metadata:  metadata,
+					Message:   anyValueString(lr.GetBody()),
+				})
+			}
+		}
+	}
+	return out
+}
+
+// attributesToLabels converts attributes to a flat map. When keep is not nil,
+// only the listed keys are converted.
+func attributesToLabels(attrs []*commonpb.KeyValue, keep map[string]bool) map[string]string {
+	labels := make(map[string]string, len(attrs))
+	for _, kv := range attrs {
+		if keep != nil && !keep[kv.GetKey()] {
+			continue
+		}
+		labels[sanitizeName(kv.GetKey())] = anyValueString(kv.GetValue())
+	}
+	return labels
+}
+
+func anyValueString(v *commonpb.AnyValue) string {
+	switch val := v.GetValue().(type) {
+	case *commonpb.AnyValue_StringValue:
+		return val.StringValue
+	case *commonpb.AnyValue_BoolValue:
+		return strconv.FormatBool(val.BoolValue)
+	case *commonpb.AnyValue_IntValue:
+		return strconv.FormatInt(val.IntValue, 10)
+	case *commonpb.AnyValue_DoubleValue:
+		return strconv.FormatFloat(val.DoubleValue, 'g', -1, 64)
+	case *commonpb.AnyValue_BytesValue:
+		return hex.EncodeToString(val.BytesValue)
+	case *commonpb.AnyValue_ArrayValue, *commonpb.AnyValue_KvlistValue:
+		b, _ := json.Marshal(anyValueInterface(v))
+		return string(b)
+	}
+	return ""
+}
+
+func anyValueInterface(v *commonpb.AnyValue) any {
+	switch val := v.GetValue().(type) {
+	case *commonpb.AnyValue_ArrayValue:
+		items := make([]any, 0, len(val.ArrayValue.GetValues()))
+		for _, item := range val.ArrayValue.GetValues() {
+			items = append(items, anyValueInterface(item))
+		}
+		return items
+	case *commonpb.AnyValue_KvlistValue:
+		obj := make(map[string]any, len(val.KvlistValue.GetValues()))
+		for _, kv := range val.KvlistValue.GetValues() {
+			obj[kv.GetKey()] = anyValueInterface(kv.GetValue())
+		}
+		return obj
+	}
+	return anyValueString(v)
+}
+
+func numberValue(dp *metricspb.NumberDataPoint) float64 {
+	if v, ok := dp.GetValue().(*metricspb.NumberDataPoint_AsInt); ok {
+		return float64(v.AsInt)
+	}
+	return dp.GetAsDouble()
+}
+
+// sanitizeName converts OTel names (e.g. "http.server.duration") to the
+// agent naming ("http_server_duration").
+func sanitizeName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' {
+			return r
+		}
+		return '_'
+	}, name)
+}
+
+// timestamp converts nanoseconds to the payload format (milliseconds). A zero
+// timestamp falls back to the current time.
+func timestamp(unixNano uint64) string {
+	if unixNano == 0 {
+		return strconv.FormatInt(time.Now().UnixMilli(), 10)
+	}
+	return strconv.FormatInt(int64(unixNano/uint64(time.Millisecond)), 10)
+}
@@ -0,0 +1,238 @@
+package otlp
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/protobuf/proto"
+
+	"agent/internal/config"
+	"agent/internal/exporter"
+	"agent/internal/logger"
+)
+
+func init() {
+	logger.Log = slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+type fakeSink struct {
+	mu      sync.Mutex
+	metrics []exporter.MetricPayload
+	logs    []exporter.LogPayload
+}
+
+func (s *fakeSink) ExportMetric(m []exporter.MetricPayload) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.metrics = append(s.metrics, m...)
+	return nil
+}
+
+func (s *fakeSink) ExportLog(l []exporter.LogPayload) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.logs = append(s.logs, l...)
+	return nil
+}
+
+func strAttr(k, v string) *commonpb.KeyValue {
+	return &commonpb.KeyValue{Key: k, Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: v}}}
+}
+
+func resource() *resourcepb.Resource {
+	return &resourcepb.Resource{Attributes: []*commonpb.KeyValue{
+		strAttr("service.name", "checkout"),
+		strAttr("process.pid", "1234"),
+	}}
+}
+
+func metricsRequest() *colmetricspb.ExportMetricsServiceRequest {
+	return &colmetricspb.ExportMetricsServiceRequest{ResourceMetrics: []*metricspb.ResourceMetrics{{
+		Resource: resource(),
+		ScopeMetrics: []*metricspb.ScopeMetrics{{Metrics: []*metricspb.Metric{
+			{
+				Name: "queue.size",
+				Data: &metricspb.Metric_Gauge{Gauge: &metricspb.Gauge{DataPoints: []*metricspb.NumberDataPoint{{
+					TimeUnixNano: 1_700_000_000_000_000_000,
+					Attributes:   []*commonpb.KeyValue{strAttr("queue", "orders")},
+					Value:        &metricspb.NumberDataPoint_AsInt{AsInt: 7},
+				}}}},
+			},
+			{
+				Name: "http.server.requests",
+				Data: &metricspb.Metric_Sum{Sum: &metricspb.Sum{IsMonotonic: true, DataPoints: []*metricspb.NumberDataPoint{{
+					TimeUnixNano: 1_700_000_000_000_000_000,
+					Value:        &metricspb.NumberDataPoint_AsDouble{AsDouble: 42},
+				}}}},
+			},
+			{
+				Name: "http.server.duration",
+				Data: &metricspb.Metric_Histogram{Histogram: &metricspb.Histogram{DataPoints: []*metricspb.HistogramDataPoint{{
+					TimeUnixNano:   1_700_000_000_000_000_000,
+					Count:          6,
+					Sum:            proto.Float64(1.5),
+					ExplicitBounds: []float64{0.1, 0.5},
+					BucketCounts:   []uint64{3, 2, 1},
+				}}}},
+			},
+		}}},
+	}}}
+}
+
+func logsRequest() *collogspb.ExportLogsServiceRequest {
+	return &collogspb.ExportLogsServiceRequest{ResourceLogs: []*logspb.ResourceLogs{{
+		Resource: resource(),
+		ScopeLogs: []*logspb.ScopeLogs{{
+			Scope: &commonpb.InstrumentationScope{Name: "checkout.handler"},
+			LogRecords: []*logspb.LogRecord{{
+				TimeUnixNano: 1_700_000_000_123_000_000,
+				SeverityText: "ERROR",
+				Body:         &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: "payment failed"}},
+				Attributes:   []*commonpb.KeyValue{strAttr("order.id", "42")},
+				TraceId:      []byte{0x01, 0x02},
+				SpanId:       []byte{0x03},
+			}},
+		}},
+	}}}
+}
+
+func findMetric(t *testing.T, metrics []exporter.MetricPayload, name string, labels map[string]string) exporter.MetricPayload {
+	t.Helper()
+	for _, m := range metrics {
+		if m.Name != name {
+			continue
+		}
+		match := true
+		for k, v := range labels {
+			if m.Labels[k] != v {
+				match = false
+			}
+		}
+		if match {
+			return m
+		}
+	}
+	t.Fatalf("metric %s %v not found", name, labels)
+	return exporter.MetricPayload{}
+}
+
+func TestConvertMetrics(t *testing.T) {
+	metrics := convertMetrics(metricsRequest())
+
+	gauge := findMetric(t, metrics, "queue_size", nil)
+	assert.Equal(t, 7.0, gauge.Value)
+	assert.Equal(t, "1700000000000", gauge.Timestamp)
+	assert.Equal(t, map[string]string{"queue": "orders", "service_name": "checkout"}, gauge.Labels)
+
+	assert.Equal(t, 42.0, findMetric(t, metrics, "http_server_requests_total", nil).Value)
+
+	assert.Equal(t, 6.0, findMetric(t, metrics, "http_server_duration_count", nil).Value)
+	assert.Equal(t, 1.5, findMetric(t, metrics, "http_server_duration_sum", nil).Value)
+	assert.Equal(t, 3.0, findMetric(t, metrics, "http_server_duration_bucket", map[string]string{"le": "0.1"}).Value)
+	assert.Equal(t, 5.0, findMetric(t, metrics, "http_server_duration_bucket", map[string]string{"le": "0.5"}).Value)
+	assert.Equal(t, 6.0, findMetric(t, metrics, "http_server_duration_bucket", map[string]string{"le": "+Inf"}).Value)
+}
+
+func TestConvertLogs(t *testing.T) {
+	logs := convertLogs(logsRequest())
+	require.Len(t, logs, 1)
+
+	assert.Equal(t, "payment failed", logs[0].Message)
+	assert.Equal(t, "1700000000123", logs[0].Timestamp)
+	assert.Equal(t, map[string]string{"source": "otlp", "service_name": "checkout", "level": "error"}, logs[0].Labels)
+	assert.Equal(t, map[string]string{
+		"order_id": "42",
+		"trace_id": "0102",
+		"span_id":  "03",
+		"scope":    "checkout.handler",
+	}, logs[0].Metadata)
+}
+
+func freeAddress(t *testing.T) string {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer lis.Close()
+	return lis.Addr().String()
+}
+
+func startReceiver(t *testing.T, sink Sink) (httpAddr, grpcAddr string) {
+	httpAddr, grpcAddr = freeAddress(t), freeAddress(t)
+	r := NewReceiver(config.OTLPReceiverConfig{Enabled: true, HTTPAddress: httpAddr, GRPCAddress: grpcAddr}, sink)
+	require.NoError(t, r.Start())
+	t.Cleanup(r.Stop)
+	return httpAddr, grpcAddr
+}
+
+func TestReceiver_HTTPProtobuf(t *testing.T) {
+	sink := &fakeSink{}
+	httpAddr, _ := startReceiver(t, sink)
+
+	body, err := proto.Marshal(metricsRequest())
+	require.NoError(t, err)
+	resp, err := http.Post("http://"+httpAddr+"/v1/metrics", "application/x-protobuf", bytes.NewReader(body))
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "application/x-protobuf", resp.Header.Get("Content-Type"))
+	assert.Len(t, sink.metrics, 7)
+}
+
+func TestReceiver_HTTPJSON(t *testing.T) {
+	sink := &fakeSink{}
+	httpAddr, _ := startReceiver(t, sink)
+
+	body := `{"resourceLogs":[{"scopeLogs":[{"logRecords":[{"severityText":"INFO","body":{"stringValue":"hello"}}]}]}]}`
+	resp, err := http.Post("http://"+httpAddr+"/v1/logs", "application/json", bytes.NewBufferString(body))
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Len(t, sink.logs, 1)
+	assert.Equal(t, "hello", sink.logs[0].Message)
+	assert.Equal(t, "info", sink.logs[0].Labels["level"])
+}
+
+func TestReceiver_HTTPInvalidBody(t *testing.T) {
+	httpAddr, _ := startReceiver(t, &fakeSink{})
+
+	resp, err := http.Post("http://"+httpAddr+"/v1/logs", "application/json", bytes.NewBufferString("{not json"))
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestReceiver_GRPC(t *testing.T) {
+	sink := &fakeSink{}
+	_, grpcAddr := startReceiver(t, sink)
+
+	conn, err := grpc.NewClient(grpcAddr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	defer conn.Close()
+
+	_, err = collogspb.NewLogsServiceClient(conn).Export(context.Background(), logsRequest())
+	require.NoError(t, err)
+	_, err = colmetricspb.NewMetricsServiceClient(conn).Export(context.Background(), metricsRequest())
+	require.NoError(t, err)
+
+	sink.mu.Lock()
+	defer sink.mu.Unlock()
+	assert.Len(t, sink.logs, 1)
+	assert.Len(t, sink.metrics, 7)
+}
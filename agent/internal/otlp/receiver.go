@@ -0,0 +1,230 @@
+// Package otlp implements a local OpenTelemetry (OTLP) receiver. Applications
+// instrumented with OpenTelemetry SDKs send their metrics and logs to the
+// agent, which forwards them through the export pipeline with the host labels
+// attached.
+package otlp
+
+import (
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"agent/internal/config"
+	"agent/internal/exporter"
+	"agent/internal/logger"
+
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	DefaultHTTPAddress = "127.0.0.1:4318"
+	DefaultGRPCAddress = "127.0.0.1:4317"
+
+	// maxRequestSize limits the size of a decompressed request body.
+	maxRequestSize = 16 * 1024 * 1024
+)
+
+// Sink receives the converted payloads. It's implemented by the exporter.
+type Sink interface {
+	ExportMetric(metrics []exporter.MetricPayload) error
+	ExportLog(logs []exporter.LogPayload) error
+}
+
+// Receiver serves OTLP/HTTP and OTLP/gRPC.
+type Receiver struct {
+	httpAddress string
+	grpcAddress string
+	sink        Sink
+
+	httpServer *http.Server
+	grpcServer *grpc.Server
+	wg         sync.WaitGroup
+}
+
+func NewReceiver(cfg config.OTLPReceiverConfig, sink Sink) *Receiver {
+	r := &Receiver{
+		httpAddress: cfg.HTTPAddress,
+		grpcAddress: cfg.GRPCAddress,
+		sink:        sink,
+	}
+	if r.httpAddress == "" {
+		r.httpAddress = DefaultHTTPAddress
+	}
+	if r.grpcAddress == "" {
+		r.grpcAddress = DefaultGRPCAddress
+	}
+	return r
+}
+
+// Start binds the listeners and serves requests in the background. An address
+// set to "off" disables the matching protocol.
+func (r *Receiver) Start() error {
+	if r.httpAddress != "off" {
+		lis, err := net.Listen("tcp", r.httpAddress)
+		if err != nil {
+			return fmt.Errorf("failed to listen for OTLP/HTTP on %s: %w", r.httpAddress, err)
+		}
+		mux := http.NewServeMux()
+		mux.HandleFunc("POST /v1/metrics", r.handleMetrics)
+		mux.HandleFunc("POST /v1/logs", r.handleLogs)
+		r.httpServer = &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+		r.serve("http", lis, r.httpServer.Serve)
+	}
+
+	if r.grpcAddress != "off" {
+		lis, err := net.Listen("tcp", r.grpcAddress)
+		if err != nil {
+			r.Stop()
+			return fmt.Errorf("failed to listen for OTLP/gRPC on %s: %w", r.grpcAddress, err)
+		}
+		r.grpcServer = grpc.NewServer(grpc.MaxRecvMsgSize(maxRequestSize))
+		colmetricspb.RegisterMetricsServiceServer(r.grpcServer, &metricsService{sink: r.sink})
+		collogspb.RegisterLogsServiceServer(r.grpcServer, &logsService{sink: r.sink})
+		r.serve("grpc", lis, r.grpcServer.Serve)
+	}
+	return nil
+}
+
+func (r *Receiver) serve(protocol string, lis net.Listener, serve func(net.Listener) error) {
+	logger.Log.Info("OTLP receiver listening", "protocol", protocol, "address", lis.Addr().String())
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		if err := serve(lis); err != nil && !errors.Is(err, http.ErrServerClosed) && !errors.Is(err, grpc.ErrServerStopped) {
+			logger.Log.Error("OTLP receiver stopped", "protocol", protocol, "error", err)
+		}
+	}()
+}
+
+// Stop shuts down both servers and waits for in-flight requests.
+func (r *Receiver) Stop() {
+	if r.httpServer != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		_ = r.httpServer.Shutdown(ctx)
+		cancel()
+	}
+	if r.grpcServer != nil {
+		r.grpcServer.GracefulStop()
+	}
+	r.wg.Wait()
+}
+
+func (r *Receiver) handleMetrics(w http.ResponseWriter, req *http.Request) {
+	msg := &colmetricspb.ExportMetricsServiceRequest{}
+	if !decodeRequest(w, req, msg) {
+		return
+	}
+	if err := r.sink.ExportMetric(convertMetrics(msg)); err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	encodeResponse(w, req, &colmetricspb.ExportMetricsServiceResponse{})
+}
+
+func (r *Receiver) handleLogs(w http.ResponseWriter, req *http.Request) {
+	msg := &collogspb.ExportLogsServiceRequest{}
+	if !decodeRequest(w, req, msg) {
+		return
+	}
+	if err := r.sink.ExportLog(convertLogs(msg)); err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	encodeResponse(w, req, &collogspb.ExportLogsServiceResponse{})
+}
+
+func isJSON(req *http.Request) bool {
+	return strings.HasPrefix(req.Header.Get("Content-Type"), "application/json")
+}
+
+// decodeRequest reads a protobuf or JSON encoded body, optionally gzipped.
+// It writes the error response and returns false on failure.
+func decodeRequest(w http.ResponseWriter, req *http.Request, msg proto.Message) bool {
+	var body io.Reader = req.Body
+	if req.Header.Get("Content-Encoding") == "gzip" {
+		gz, err := gzip.NewReader(req.Body)
+		if err != nil {
+			http.Error(w, "invalid gzip body", http.StatusBadRequest)
+			return false
+		}
+		defer gz.Close()
+		body = gz
+	}
+	data, err := io.ReadAll(io.LimitReader(body, maxRequestSize+1))
+	if err != nil {
+		http.Error(w, "failed to read body", http.StatusBadRequest)
+		return false
+	}
+	if len(data) > maxRequestSize {
+		http.Error(w, "request too large", http.StatusRequestEntityTooLarge)
+		return false
+	}
+
+	if isJSON(req) {
+		err = protojson.Unmarshal(data, msg)
+	} else {
+		err = proto.Unmarshal(data, msg)
+	}
+	if err != nil {
+		http.Error(w, "failed to decode request: "+err.Error(), http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+func encodeResponse(w http.ResponseWriter, req *http.Request, msg proto.Message) {
+	var (
+		data []byte
+		err  error
+	)
+	if isJSON(req) {
+		w.Header().Set("Content-Type", "application/json")
+		data, err = protojson.Marshal(msg)
+	} else {
+		w.Header().Set("Content-Type", "application/x-protobuf")
+		data, err = proto.Marshal(msg)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(data)
+}
+
+type metricsService struct {
+	colmetricspb.UnimplementedMetricsServiceServer
+	sink Sink
+}
+
+func (s *metricsService) Export(_ context.Context, req *colmetricspb.ExportMetricsServiceRequest) (*colmetricspb.ExportMetricsServiceResponse, error) {
+	if err := s.sink.ExportMetric(convertMetrics(req)); err != nil {
+		return nil, status.Error(codes.Unavailable, err.Error())
+	}
+	return &colmetricspb.ExportMetricsServiceResponse{}, nil
+}
+
+type logsService struct {
+	collogspb.UnimplementedLogsServiceServer
+	sink Sink
+}
+
+func (s *logsService) Export(_ context.Context, req *collogspb.ExportLogsServiceRequest) (*collogspb.ExportLogsServiceResponse, error) {
+	if err := s.sink.ExportLog(convertLogs(req)); err != nil {
+		return nil, status.Error(codes.Unavailable, err.Error())
+	}
+	return &collogspb.ExportLogsServiceResponse{}, nil
+}
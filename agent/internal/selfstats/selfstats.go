@@ -0,0 +1,141 @@
+// Package selfstats holds the counters and gauges the agent keeps about
+// itself (lines read, payloads dropped...). They are reported as metrics by the status
+// collector, alongside the heartbeat.
+package selfstats
+
+import (
+	"maps"
+	"math"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Counter is a monotonically increasing value, safe for concurrent use.
+type Counter struct {
+	name   string
+	labels map[string]string
+	bits   atomic.Uint64
+}
+
+// Add increases the counter by delta
+func (c *Counter) Add(delta float64) {
+	for {
+		old := c.bits.Load()
+		updated := math.Float64bits(math.Float64frombits(old) + delta)
+		if c.bits.CompareAndSwap(old, updated) {
+			return
+		}
+	}
+}
+
+// Inc increases the counter by one
+func (c *Counter) Inc() {
+	c.Add(1)
+}
+
+// Value returns the current value of the counter
+func (c *Counter) Value() float64 {
+	return math.Float64frombits(c.bits.Load())
+}
+
+// Gauge is a value that can go up and down, safe for concurrent use.
+type Gauge struct {
+	Counter
+}
+
+// Set replaces the value of the gauge
+func (g *Gauge) Set(value float64) {
+	g.bits.Store(math.Float64bits(value))
+}
+
+// Sample is the value of a counter or gauge at the time of a snapshot
+type Sample struct {
+	Name   string
+	Labels map[string]string
+	Value  float64
+}
+
+var (
+	mu       sync.Mutex
+	counters = make(map[string]*Counter)
+	gauges   = make(map[string]*Gauge)
+)
+
+// NewCounter returns the counter with the given name and labels, creating it
+// on the first call. Callers on hot paths should keep the returned counter
+// rather than looking it up for each increment.
+func NewCounter(name string, labels map[string]string) *Counter {
+	key := counterKey(name, labels)
+	mu.Lock()
+	defer mu.Unlock()
+	if c, ok := counters[key]; ok {
+		return c
+	}
+	c := &Counter{name: name, labels: maps.Clone(labels)}
+	if c.labels == nil {
+		c.labels = map[string]string{}
+	}
+	counters[key] = c
+	return c
+}
+
+// NewGauge returns the gauge with the given name and labels, creating it on
+// the first call.
+func NewGauge(name string, labels map[string]string) *Gauge {
+	key := counterKey(name, labels)
+	mu.Lock()
+	defer mu.Unlock()
+	if g, ok := gauges[key]; ok {
+		return g
+	}
+	g := &Gauge{Counter: Counter{name: name, labels: maps.Clone(labels)}}
+	if g.labels == nil {
+		g.labels = map[string]string{}
+	}
+	gauges[key] = g
+	return g
+}
+
+// Snapshot returns the current value of every counter and gauge, sorted by
+// name.
+func Snapshot() []Sample {
+	mu.Lock()
+	all := maps.Clone(counters)
+	for key, g := range gauges {
+		all[key] = &g.Counter
+	}
+	keys := slices.Collect(maps.Keys(all))
+	sort.Strings(keys)
+	samples := make([]Sample, 0, len(keys))
+	for _, key := range keys {
+		c := all[key]
+		samples = append(samples, Sample{Name: c.name, Labels: maps.Clone(c.labels), Value: c.Value()})
+	}
+	mu.Unlock()
+	return samples
+}
+
+// Reset removes every counter and gauge, it is meant for tests.
+func Reset() {
+	mu.Lock()
+	defer mu.Unlock()
+	counters = make(map[string]*Counter)
+	gauges = make(map[string]*Gauge)
+}
+
+func counterKey(name string, labels map[string]string) string {
+	var b strings.Builder
+	b.WriteString(name)
+	keys := slices.Collect(maps.Keys(labels))
+	sort.Strings(keys)
+	for _, k := range keys {
+		b.WriteString("\x00")
+		b.WriteString(k)
+		b.WriteString("=")
+		b.WriteString(labels[k])
+	}
+	return b.String()
+}
@@ -0,0 +1,58 @@
+package selfstats
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCounters(t *testing.T) {
+	Reset()
+	defer Reset()
+
+	a := NewCounter("logs_lines_read_total", map[string]string{"source": "nginx"})
+	assert.Same(t, a, NewCounter("logs_lines_read_total", map[string]string{"source": "nginx"}))
+	b := NewCounter("logs_bytes_read_total", map[string]string{"source": "nginx"})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				a.Inc()
+			}
+		}()
+	}
+	wg.Wait()
+	b.Add(2.5)
+
+	samples := Snapshot()
+	require.Len(t, samples, 2)
+	assert.Equal(t, Sample{Name: "logs_bytes_read_total", Labels: map[string]string{"source": "nginx"}, Value: 2.5}, samples[0])
+	assert.Equal(t, Sample{Name: "logs_lines_read_total", Labels: map[string]string{"source": "nginx"}, Value: 1000}, samples[1])
+
+	// Unlabeled counters are reported with empty labels
+	NewCounter("heartbeat_skipped_total", nil)
+	assert.Equal(t, map[string]string{}, Snapshot()[0].Labels)
+}
+
+func TestGauges(t *testing.T) {
+	Reset()
+	defer Reset()
+
+	g := NewGauge("agent_hibernating", nil)
+	assert.Same(t, g, NewGauge("agent_hibernating", nil))
+	g.Set(1)
+	NewCounter("agent_auth_errors_total", nil).Inc()
+
+	assert.Equal(t, []Sample{
+		{Name: "agent_auth_errors_total", Labels: map[string]string{}, Value: 1},
+		{Name: "agent_hibernating", Labels: map[string]string{}, Value: 1},
+	}, Snapshot())
+
+	g.Set(0)
+	assert.Equal(t, 0.0, Snapshot()[1].Value)
+}
@@ -0,0 +1,116 @@
+package tags
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// awsMetadataURL is the base URL of the EC2 instance metadata service.
+var awsMetadataURL = "http://169.254.169.254"
+
+// AWSProvider reads the instance placement and the instance tags from the EC2
+// instance metadata service (IMDSv2). Instance tags are only exposed when
+// "Allow tags in instance metadata" is enabled on the instance.
+type AWSProvider struct {
+	baseURL string
+	client  *http.Client
+}
+
+func NewAWSProvider() *AWSProvider {
+	return &AWSProvider{
+		baseURL: awsMetadataURL,
+		// Keep it short, outside of EC2 the endpoint is unreachable and this
+		// delays the agent startup.
+		client: &http.Client{Timeout: 500 * time.Millisecond},
+	}
+}
+
+func (p *AWSProvider) Name() string {
+	return "aws"
+}
+
+func (p *AWSProvider) Tags() (map[string]string, error) {
+	token, err := p.token()
+	if err != nil {
+		return nil, err
+	}
+
+	result := map[string]string{"cloud_provider": "aws"}
+	placement := map[string]string{
+		"cloud_instance_id":       "/latest/meta-data/instance-id",
+		"cloud_instance_type":     "/latest/meta-data/instance-type",
+		"cloud_region":            "/latest/meta-data/placement/region",
+		"cloud_availability_zone": "/latest/meta-data/placement/availability-zone",
+	}
+	for key, path := range placement {
+		if value, err := p.get(token, path); err == nil {
+			result[key] = value
+		}
+	}
+
+	// Instance tags are optional
+	keys, err := p.get(token, "/latest/meta-data/tags/instance")
+	if err != nil {
+		return result, nil
+	}
+	scanner := bufio.NewScanner(strings.NewReader(keys))
+	for scanner.Scan() {
+		key := strings.TrimSpace(scanner.Text())
+		if key == "" {
+			continue
+		}
+		value, err := p.get(token, "/latest/meta-data/tags/instance/"+key)
+		if err != nil {
+			continue
+		}
+		result[key] = value
+	}
+	return result, nil
+}
+
+// token requests an IMDSv2 session token.
+func (p *AWSProvider) token() (string, error) {
+	req, err := http.NewRequest("PUT", p.baseURL+"/latest/api/token", nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-aws-ec2-metadata-token-ttl-seconds", "60")
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("instance metadata service unreachable: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to get metadata token (status %d)", resp.StatusCode)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("failed to read metadata token: %w", err)
+	}
+	return string(body), nil
+}
+
+func (p *AWSProvider) get(token, path string) (string, error) {
+	req, err := http.NewRequest("GET", p.baseURL+path, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-aws-ec2-metadata-token", token)
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("GET %s failed (status %d)", path, resp.StatusCode)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(body)), nil
+}
@@ -0,0 +1,63 @@
+package tags
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"gopkg.in/yaml.v3"
+)
+
+// FactsProvider reads flat key/value YAML files from a directory, typically
+// dropped by configuration management tools (Chef, Puppet, Ansible):
+//
+//	# /etc/simob/tags.d/puppet.yaml
+//	role: webserver
+//	env: production
+//
+// Files are read in lexical order, later files override earlier ones.
+type FactsProvider struct {
+	directory string
+}
+
+func NewFactsProvider(directory string) *FactsProvider {
+	return &FactsProvider{directory: directory}
+}
+
+func (p *FactsProvider) Name() string {
+	return "facts"
+}
+
+func (p *FactsProvider) Tags() (map[string]string, error) {
+	var files []string
+	for _, pattern := range []string{"*.yaml", "*.yml"} {
+		matches, err := filepath.Glob(filepath.Join(p.directory, pattern))
+		if err != nil {
+			return nil, fmt.Errorf("failed to list fact files: %w", err)
+		}
+		files = append(files, matches...)
+	}
+	sort.Strings(files)
+
+	result := make(map[string]string)
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read fact file %s: %w", file, err)
+		}
+		var facts map[string]any
+		if err := yaml.Unmarshal(data, &facts); err != nil {
+			return nil, fmt.Errorf("failed to parse fact file %s: %w", file, err)
+		}
+		for k, v := range facts {
+			switch v.(type) {
+			case map[string]any, []any, nil:
+				// Only scalar facts can be used as labels
+				continue
+			}
+			result[k] = fmt.Sprint(v)
+		}
+	}
+	return result, nil
+}
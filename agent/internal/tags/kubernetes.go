@@ -0,0 +1,47 @@
+package tags
+
+import (
+	"errors"
+	"os"
+)
+
+// kubernetesEnv maps the variables set from the downward API in the agent
+// DaemonSet to their tag, named after the OpenTelemetry conventions:
+//
+//	env:
+//	  - name: NODE_NAME
+//	    valueFrom:
+//	      fieldRef:
+//	        fieldPath: spec.nodeName
+var kubernetesEnv = map[string]string{
+	"NODE_NAME":     "k8s.node.name",
+	"POD_NAME":      "k8s.pod.name",
+	"POD_NAMESPACE": "k8s.namespace.name",
+}
+
+// KubernetesProvider tags the data of an agent running as a DaemonSet with the
+// node and pod it runs on.
+type KubernetesProvider struct {
+	getenv func(string) string
+}
+
+func NewKubernetesProvider() *KubernetesProvider {
+	return &KubernetesProvider{getenv: os.Getenv}
+}
+
+func (p *KubernetesProvider) Name() string {
+	return "kubernetes"
+}
+
+func (p *KubernetesProvider) Tags() (map[string]string, error) {
+	if p.getenv("KUBERNETES_SERVICE_HOST") == "" {
+		return nil, errors.New("not running in Kubernetes")
+	}
+	result := make(map[string]string)
+	for name, key := range kubernetesEnv {
+		if value := p.getenv(name); value != "" {
+			result[key] = value
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,91 @@
+// Package tags gathers host level tags that are attached to every exported
+// metric and log as labels, so fleets can be grouped without editing the
+// configuration of each host.
+package tags
+
+import (
+	"maps"
+	"runtime"
+	"strings"
+	"unicode"
+
+	"agent/internal/config"
+	"agent/internal/logger"
+)
+
+// Provider is a source of host tags.
+type Provider interface {
+	// Name returns the provider's identifier (e.g., "aws", "facts").
+	Name() string
+
+	// Tags returns the tags found by the provider.
+	Tags() (map[string]string, error)
+}
+
+// DefaultFactsDirectory returns the directory scanned for local fact files.
+func DefaultFactsDirectory() string {
+	if runtime.GOOS == "windows" {
+		return `C:\ProgramData\simob\tags.d`
+	}
+	return "/etc/simob/tags.d"
+}
+
+// BuildProviders returns the enabled providers ordered from the lowest to the
+// highest precedence.
+func BuildProviders(cfg *config.Config) []Provider {
+	var providers []Provider
+	if !cfg.DisableCloudTags {
+		providers = append(providers, NewAWSProvider())
+	}
+	providers = append(providers, NewKubernetesProvider())
+	providers = append(providers, NewFactsProvider(DefaultFactsDirectory()))
+	return providers
+}
+
+// Collect resolves the host tags. Tags from later providers override earlier
+// ones, and tags set explicitly in the agent config override all providers.
+func Collect(cfg *config.Config) map[string]string {
+	return merge(BuildProviders(cfg), cfg.Tags)
+}
+
+func merge(providers []Provider, static map[string]string) map[string]string {
+	result := make(map[string]string)
+	for _, p := range providers {
+		found, err := p.Tags()
+		if err != nil {
+			logger.Log.Debug("Tag provider unavailable", "provider", p.Name(), "error", err)
+			continue
+		}
+		logger.Log.Debug("Tags loaded", "provider", p.Name(), "count", len(found))
+		for k, v := range found {
+			result[NormalizeKey(k)] = v
+		}
+	}
+	for k, v := range static {
+		result[NormalizeKey(k)] = v
+	}
+	return result
+}
+
+// NormalizeKey turns an arbitrary tag key (e.g. "aws:autoscaling:groupName")
+// into a label friendly key ("aws_autoscaling_groupname").
+func NormalizeKey(key string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToLower(r)
+		}
+		return '_'
+	}, strings.TrimSpace(key))
+}
+
+// Apply adds the host tags to labels. Labels set by collectors always take
+// precedence over host tags. The returned map is a copy when tags are added.
+func Apply(labels map[string]string, hostTags map[string]string) map[string]string {
+	if len(hostTags) == 0 {
+		return labels
+	}
+	result := make(map[string]string, len(labels)+len(hostTags))
+	maps.Copy(result, hostTags)
+	maps.Copy(result, labels)
+	return result
+}
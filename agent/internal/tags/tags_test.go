@@ -0,0 +1,152 @@
+package tags
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"agent/internal/logger"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func init() {
+	logger.Log = slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+type staticProvider struct {
+	name string
+	tags map[string]string
+	err  error
+}
+
+func (p staticProvider) Name() string                     { return p.name }
+func (p staticProvider) Tags() (map[string]string, error) { return p.tags, p.err }
+
+func TestMergePrecedence(t *testing.T) {
+	providers := []Provider{
+		staticProvider{name: "aws", tags: map[string]string{"env": "cloud", "Team": "infra"}},
+		staticProvider{name: "broken", err: errors.New("unavailable")},
+		staticProvider{name: "facts", tags: map[string]string{"env": "facts", "role": "web"}},
+	}
+	static := map[string]string{"role": "db"}
+
+	result := merge(providers, static)
+
+	assert.Equal(t, map[string]string{
+		"env":  "facts",
+		"team": "infra",
+		"role": "db",
+	}, result)
+}
+
+func TestApplyKeepsPayloadLabels(t *testing.T) {
+	labels := map[string]string{"env": "payload"}
+	result := Apply(labels, map[string]string{"env": "host", "role": "web"})
+
+	assert.Equal(t, map[string]string{"env": "payload", "role": "web"}, result)
+	assert.Equal(t, map[string]string{"env": "payload"}, labels, "input must not be modified")
+	assert.Nil(t, Apply(nil, nil))
+}
+
+func TestNormalizeKey(t *testing.T) {
+	assert.Equal(t, "aws_autoscaling_groupname", NormalizeKey("aws:autoscaling:groupName"))
+	assert.Equal(t, "cost_center", NormalizeKey(" Cost Center "))
+}
+
+func TestFactsProvider(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "10-base.yaml"), []byte("env: staging\nrole: web\nreplicas: 3\n"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "20-override.yml"), []byte("env: production\nnested:\n  a: b\n"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "ignored.txt"), []byte("env: ignored\n"), 0o644))
+
+	result, err := NewFactsProvider(dir).Tags()
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"env": "production", "role": "web", "replicas": "3"}, result)
+}
+
+func TestFactsProviderInvalidFile(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "bad.yaml"), []byte("- not\n- a map\n"), 0o644))
+
+	_, err := NewFactsProvider(dir).Tags()
+	assert.Error(t, err)
+}
+
+func TestAWSProvider(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/latest/api/token" {
+			assert.Equal(t, "PUT", r.Method)
+			w.Write([]byte("token"))
+			return
+		}
+		if r.Header.Get("X-aws-ec2-metadata-token") != "token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		responses := map[string]string{
+			"/latest/meta-data/instance-id":                 "i-123",
+			"/latest/meta-data/placement/region":            "eu-west-1",
+			"/latest/meta-data/tags/instance":               "Name\nteam",
+			"/latest/meta-data/tags/instance/Name":          "web-1",
+			"/latest/meta-data/tags/instance/team":          "infra",
+			"/latest/meta-data/placement/availability-zone": "eu-west-1a",
+		}
+		body, ok := responses[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(body))
+	}))
+	defer server.Close()
+
+	p := NewAWSProvider()
+	p.baseURL = server.URL
+	result, err := p.Tags()
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"cloud_provider":          "aws",
+		"cloud_instance_id":       "i-123",
+		"cloud_region":            "eu-west-1",
+		"cloud_availability_zone": "eu-west-1a",
+		"Name":                    "web-1",
+		"team":                    "infra",
+	}, result)
+}
+
+func TestAWSProviderUnreachable(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer server.Close()
+
+	p := NewAWSProvider()
+	p.baseURL = server.URL
+	_, err := p.Tags()
+	assert.Error(t, err)
+}
+
+func TestKubernetesProvider(t *testing.T) {
+	env := map[string]string{
+		"KUBERNETES_SERVICE_HOST": "10.0.0.1",
+		"NODE_NAME":               "node-1",
+		"POD_NAMESPACE":           "monitoring",
+	}
+	p := &KubernetesProvider{getenv: func(name string) string { return env[name] }}
+
+	found, err := p.Tags()
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"k8s_node_name": "node-1", "k8s_namespace_name": "monitoring"},
+		merge([]Provider{staticProvider{name: "kubernetes", tags: found}}, nil))
+
+	delete(env, "KUBERNETES_SERVICE_HOST")
+	_, err = p.Tags()
+	assert.Error(t, err)
+}
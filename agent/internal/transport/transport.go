@@ -0,0 +1,263 @@
+// Package transport provides the HTTP transport shared by the connections to
+// the backend. It caches name resolutions and races the address families
+// itself, so that hosts with a slow resolver or a broken IPv6 route don't
+// spend the request timeout connecting.
+package transport
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"agent/internal/config"
+	"agent/internal/logger"
+)
+
+const (
+	defaultDNSCacheTTL   = time.Minute
+	defaultDialTimeout   = 5 * time.Second
+	defaultFallbackDelay = 300 * time.Millisecond
+	// maxCachedHosts bounds the cache, only a few backend hosts are resolved
+	maxCachedHosts = 256
+)
+
+var current atomic.Pointer[http.Transport]
+
+// Configure replaces the shared transport by one using the network settings.
+// The idle connections of the previous one are closed.
+func Configure(cfg config.NetworkConfig) {
+	if previous := current.Swap(newTransport(cfg)); previous != nil {
+		previous.CloseIdleConnections()
+	}
+}
+
+// Shared returns a round tripper sending the requests through the shared
+// transport, configured with the defaults until Configure is called.
+func Shared() http.RoundTripper {
+	return sharedTransport{}
+}
+
+type sharedTransport struct{}
+
+func (sharedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t := current.Load()
+	if t == nil {
+		current.CompareAndSwap(nil, newTransport(config.NetworkConfig{}))
+		t = current.Load()
+	}
+	return t.RoundTrip(req)
+}
+
+func newTransport(cfg config.NetworkConfig) *http.Transport {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.DialContext = newDialer(cfg).DialContext
+	return t
+}
+
+// dialer resolves the host names through its cache and dials the addresses of
+// the preferred family first. The other family is dialed in parallel when the
+// first one didn't connect within fallbackDelay (RFC 8305).
+type dialer struct {
+	dialer        net.Dialer
+	cache         *resolverCache
+	preferIPv4    bool
+	fallbackDelay time.Duration
+}
+
+func newDialer(cfg config.NetworkConfig) *dialer {
+	ttl := defaultDNSCacheTTL
+	if cfg.DNSCacheSeconds != 0 {
+		ttl = time.Duration(cfg.DNSCacheSeconds) * time.Second
+	}
+	timeout := defaultDialTimeout
+	if cfg.DialTimeoutSeconds > 0 {
+		timeout = time.Duration(cfg.DialTimeoutSeconds) * time.Second
+	}
+	fallbackDelay := defaultFallbackDelay
+	if cfg.FallbackDelayMillis != 0 {
+		fallbackDelay = time.Duration(cfg.FallbackDelayMillis) * time.Millisecond
+	}
+	return &dialer{
+		dialer:        net.Dialer{Timeout: timeout, KeepAlive: 30 * time.Second},
+		cache:         newResolverCache(ttl),
+		preferIPv4:    cfg.PreferIPv4,
+		fallbackDelay: fallbackDelay,
+	}
+}
+
+func (d *dialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil || net.ParseIP(host) != nil {
+		return d.dialer.DialContext(ctx, network, addr)
+	}
+	ips, err := d.cache.lookup(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	primary, fallback := d.partition(ips)
+	if d.fallbackDelay < 0 {
+		return d.dialSerial(ctx, network, port, append(primary, fallback...))
+	}
+	return d.dialParallel(ctx, network, port, primary, fallback)
+}
+
+// partition splits the addresses by family, the preferred family first. It's
+// IPv4 when preferIPv4 is set, the family of the first address otherwise.
+func (d *dialer) partition(ips []net.IP) (primary, fallback []net.IP) {
+	if len(ips) == 0 {
+		return nil, nil
+	}
+	primaryIsIPv4 := d.preferIPv4 || ips[0].To4() != nil
+	for _, ip := range ips {
+		if (ip.To4() != nil) == primaryIsIPv4 {
+			primary = append(primary, ip)
+		} else {
+			fallback = append(fallback, ip)
+		}
+	}
+	if len(primary) == 0 {
+		return fallback, nil
+	}
+	return primary, fallback
+}
+
+// dialParallel dials the primary addresses, and the fallback ones once the
+// primary ones failed or didn't connect within fallbackDelay. The first
+// connection established is returned, the other one is closed.
+func (d *dialer) dialParallel(ctx context.Context, network, port string, primary, fallback []net.IP) (net.Conn, error) {
+	if len(fallback) == 0 {
+		return d.dialSerial(ctx, network, port, primary)
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type result struct {
+		conn net.Conn
+		err  error
+	}
+	results := make(chan result, 2)
+	dial := func(ips []net.IP) {
+		conn, err := d.dialSerial(ctx, network, port, ips)
+		results <- result{conn, err}
+	}
+
+	go dial(primary)
+	pending := 1
+	fallbackTimer := time.NewTimer(d.fallbackDelay)
+	defer fallbackTimer.Stop()
+	startFallback := func() {
+		fallbackTimer.Stop()
+		go dial(fallback)
+		pending++
+		fallback = nil
+	}
+
+	var firstErr error
+	for {
+		select {
+		case <-fallbackTimer.C:
+			startFallback()
+		case r := <-results:
+			pending--
+			if r.err == nil {
+				// Close the connection of the other family if it completes
+				go func(pending int) {
+					for range pending {
+						if late := <-results; late.conn != nil {
+							late.conn.Close()
+						}
+					}
+				}(pending)
+				return r.conn, nil
+			}
+			if firstErr == nil {
+				firstErr = r.err
+			}
+			if fallback != nil {
+				startFallback()
+				continue
+			}
+			if pending == 0 {
+				return nil, firstErr
+			}
+		}
+	}
+}
+
+// dialSerial dials the addresses in order until one connects
+func (d *dialer) dialSerial(ctx context.Context, network, port string, ips []net.IP) (net.Conn, error) {
+	var firstErr error
+	for _, ip := range ips {
+		conn, err := d.dialer.DialContext(ctx, network, net.JoinHostPort(ip.String(), port))
+		if err == nil {
+			return conn, nil
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return nil, firstErr
+}
+
+// resolverCache keeps the addresses of the hosts resolved for ttl. When the
+// resolver fails, the expired addresses are used rather than failing the
+// request, a backend rarely changes its addresses.
+type resolverCache struct {
+	ttl      time.Duration
+	lookupIP func(ctx context.Context, network, host string) ([]net.IP, error)
+	now      func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]cacheEntry
+}
+
+type cacheEntry struct {
+	ips     []net.IP
+	expires time.Time
+}
+
+// newResolverCache returns a cache keeping the addresses for ttl, a negative
+// ttl disables the cache.
+func newResolverCache(ttl time.Duration) *resolverCache {
+	return &resolverCache{
+		ttl:      ttl,
+		lookupIP: net.DefaultResolver.LookupIP,
+		now:      time.Now,
+		entries:  make(map[string]cacheEntry),
+	}
+}
+
+func (c *resolverCache) lookup(ctx context.Context, host string) ([]net.IP, error) {
+	c.mu.Lock()
+	entry, cached := c.entries[host]
+	c.mu.Unlock()
+	if cached && c.now().Before(entry.expires) {
+		return entry.ips, nil
+	}
+
+	ips, err := c.lookupIP(ctx, "ip", host)
+	if err != nil {
+		if cached {
+			logger.Log.Debug("Name resolution failed, using the expired addresses", "host", host, "error", err)
+			return entry.ips, nil
+		}
+		return nil, err
+	}
+	if c.ttl <= 0 {
+		return ips, nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.entries) >= maxCachedHosts {
+		clear(c.entries)
+	}
+	c.entries[host] = cacheEntry{ips: ips, expires: c.now().Add(c.ttl)}
+	return ips, nil
+}
@@ -0,0 +1,91 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"agent/internal/config"
+	"agent/internal/logger"
+)
+
+func TestResolverCache(t *testing.T) {
+	logger.Init(false)
+	now := time.Now()
+	var lookups int
+	var lookupErr error
+	c := newResolverCache(time.Minute)
+	c.now = func() time.Time { return now }
+	c.lookupIP = func(ctx context.Context, network, host string) ([]net.IP, error) {
+		lookups++
+		return []net.IP{net.ParseIP("192.0.2.1")}, lookupErr
+	}
+
+	for range 3 {
+		ips, err := c.lookup(context.Background(), "metrics.example.com")
+		require.NoError(t, err)
+		assert.Equal(t, []net.IP{net.ParseIP("192.0.2.1")}, ips)
+	}
+	assert.Equal(t, 1, lookups)
+
+	// Expired addresses are used while the resolver fails
+	now = now.Add(2 * time.Minute)
+	lookupErr = errors.New("i/o timeout")
+	ips, err := c.lookup(context.Background(), "metrics.example.com")
+	require.NoError(t, err)
+	assert.Equal(t, []net.IP{net.ParseIP("192.0.2.1")}, ips)
+	assert.Equal(t, 2, lookups)
+
+	_, err = c.lookup(context.Background(), "logs.example.com")
+	assert.Error(t, err)
+}
+
+func TestPartition(t *testing.T) {
+	v4, v6 := net.ParseIP("192.0.2.1"), net.ParseIP("2001:db8::1")
+
+	d := newDialer(config.NetworkConfig{})
+	primary, fallback := d.partition([]net.IP{v6, v4})
+	assert.Equal(t, []net.IP{v6}, primary)
+	assert.Equal(t, []net.IP{v4}, fallback)
+
+	d = newDialer(config.NetworkConfig{PreferIPv4: true})
+	primary, fallback = d.partition([]net.IP{v6, v4})
+	assert.Equal(t, []net.IP{v4}, primary)
+	assert.Equal(t, []net.IP{v6}, fallback)
+
+	primary, fallback = d.partition([]net.IP{v6})
+	assert.Equal(t, []net.IP{v6}, primary)
+	assert.Empty(t, fallback)
+}
+
+func TestDialFallsBackToOtherFamily(t *testing.T) {
+	listener, err := net.Listen("tcp4", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+	_, port, err := net.SplitHostPort(listener.Addr().String())
+	require.NoError(t, err)
+
+	// Nothing listens on the IPv6 address, resolved first
+	d := newDialer(config.NetworkConfig{})
+	d.cache.lookupIP = func(ctx context.Context, network, host string) ([]net.IP, error) {
+		return []net.IP{net.ParseIP("::1"), net.ParseIP("127.0.0.1")}, nil
+	}
+	conn, err := d.DialContext(context.Background(), "tcp", net.JoinHostPort("backend.example.com", port))
+	require.NoError(t, err)
+	assert.Equal(t, listener.Addr().String(), conn.RemoteAddr().String())
+	conn.Close()
+}
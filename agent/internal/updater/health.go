@@ -0,0 +1,59 @@
+package updater
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// healthCheckFlag makes the binary check that it runs and print a HealthReport
+const healthCheckFlag = "--health-check"
+
+// healthCheckTimeout bounds the run of a new binary with healthCheckFlag
+const healthCheckTimeout = 30 * time.Second
+
+// HealthReport is printed as JSON by a binary run with --health-check
+type HealthReport struct {
+	Version string `json:"version"`
+}
+
+// checkHealth runs the binary at execPath with healthCheckFlag and checks that
+// it succeeds and reports the expected version.
+func checkHealth(execPath, expectedVersion string) error {
+	version, err := binaryVersion(execPath)
+	if err != nil {
+		return err
+	}
+	if strings.TrimPrefix(version, "v") != strings.TrimPrefix(expectedVersion, "v") {
+		return fmt.Errorf("new binary reports version %q, expected %q", version, expectedVersion)
+	}
+	return nil
+}
+
+// binaryVersion runs the binary at execPath with healthCheckFlag and returns
+// the version it reports
+func binaryVersion(execPath string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), healthCheckTimeout)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, execPath, healthCheckFlag)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("%w: %s", err, msg)
+		}
+		return "", err
+	}
+
+	var report HealthReport
+	if err := json.Unmarshal(stdout.Bytes(), &report); err != nil {
+		return "", fmt.Errorf("invalid health report %q: %w", strings.TrimSpace(stdout.String()), err)
+	}
+	return report.Version, nil
+}
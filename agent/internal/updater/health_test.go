@@ -0,0 +1,34 @@
+package updater
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckHealth(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake binaries are shell scripts")
+	}
+	dir := t.TempDir()
+	binary := func(name, script string) string {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(path, []byte("#!/bin/sh\n"+script+"\n"), 0o755))
+		return path
+	}
+
+	healthy := binary("healthy", `[ "$1" = "--health-check" ] && echo '{"version":"1.2.0"}'`)
+	assert.NoError(t, checkHealth(healthy, "1.2.0"))
+	assert.NoError(t, checkHealth(healthy, "v1.2.0"))
+	assert.ErrorContains(t, checkHealth(healthy, "1.3.0"), `reports version "1.2.0"`)
+
+	failing := binary("failing", `echo "failed to load config" >&2; exit 1`)
+	assert.ErrorContains(t, checkHealth(failing, "1.2.0"), "failed to load config")
+
+	garbage := binary("garbage", `echo "Usage: simob"`)
+	assert.ErrorContains(t, checkHealth(garbage, "1.2.0"), "invalid health report")
+}
@@ -0,0 +1,101 @@
+package updater
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"agent/internal/common"
+)
+
+// checksumFileName is the file, in the program directory, recording the
+// SHA256 of the binary installed by the installer or the updater
+const checksumFileName = "binary.sha256"
+
+// Integrity is the result of a check of the agent binary
+type Integrity struct {
+	Path string
+	// Recorded is the checksum recorded at install or update
+	Recorded string
+	// Current is the checksum of the binary on disk
+	Current string
+}
+
+// Modified reports whether the binary changed since it was installed
+func (i Integrity) Modified() bool {
+	return i.Recorded != "" && i.Recorded != i.Current
+}
+
+// RecordChecksum records the checksum of the installed binary, so that an
+// update can be told from a change made outside the updater.
+func RecordChecksum(checksum string) error {
+	path, err := checksumPath()
+	if err != nil {
+		return err
+	}
+	return recordChecksum(path, checksum)
+}
+
+// CheckIntegrity compares the checksum of the agent binary with the recorded
+// one. When none is recorded, e.g. on the first run after an install, the
+// current checksum is recorded.
+func CheckIntegrity() (Integrity, error) {
+	execPath, err := executablePath()
+	if err != nil {
+		return Integrity{}, err
+	}
+	path, err := checksumPath()
+	if err != nil {
+		return Integrity{}, err
+	}
+	return checkIntegrity(execPath, path)
+}
+
+func checkIntegrity(execPath, recordPath string) (Integrity, error) {
+	current, err := calculateFileSHA256(execPath)
+	if err != nil {
+		return Integrity{}, err
+	}
+	integrity := Integrity{Path: execPath, Current: current}
+
+	data, err := os.ReadFile(recordPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return integrity, recordChecksum(recordPath, current)
+	}
+	if err != nil {
+		return integrity, fmt.Errorf("failed to read recorded checksum: %w", err)
+	}
+	integrity.Recorded = strings.TrimSpace(string(data))
+	return integrity, nil
+}
+
+func recordChecksum(path, checksum string) error {
+	if err := os.WriteFile(path, []byte(checksum+"\n"), 0o640); err != nil {
+		return fmt.Errorf("failed to record binary checksum: %w", err)
+	}
+	return nil
+}
+
+func checksumPath() (string, error) {
+	programDir, err := common.GetProgramDirectory()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(programDir, checksumFileName), nil
+}
+
+// executablePath returns the path of the running binary, symlinks resolved
+func executablePath() (string, error) {
+	execPath, err := os.Executable()
+	if err != nil {
+		return "", fmt.Errorf("failed to get executable path: %w", err)
+	}
+	execPath, err = filepath.EvalSymlinks(execPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve symlinks for executable path: %w", err)
+	}
+	return execPath, nil
+}
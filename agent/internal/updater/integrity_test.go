@@ -0,0 +1,40 @@
+package updater
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckIntegrity(t *testing.T) {
+	dir := t.TempDir()
+	binary := filepath.Join(dir, "simob")
+	record := filepath.Join(dir, checksumFileName)
+	require.NoError(t, os.WriteFile(binary, []byte("v1"), 0o755))
+
+	// The first check records the checksum
+	integrity, err := checkIntegrity(binary, record)
+	require.NoError(t, err)
+	assert.False(t, integrity.Modified())
+	assert.FileExists(t, record)
+
+	integrity, err = checkIntegrity(binary, record)
+	require.NoError(t, err)
+	assert.Equal(t, integrity.Current, integrity.Recorded)
+	assert.False(t, integrity.Modified())
+
+	// Copied over outside the updater
+	require.NoError(t, os.WriteFile(binary, []byte("v2"), 0o755))
+	integrity, err = checkIntegrity(binary, record)
+	require.NoError(t, err)
+	assert.True(t, integrity.Modified())
+
+	// Recorded by the updater
+	require.NoError(t, recordChecksum(record, integrity.Current))
+	integrity, err = checkIntegrity(binary, record)
+	require.NoError(t, err)
+	assert.False(t, integrity.Modified())
+}
@@ -0,0 +1,91 @@
+package updater
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"runtime"
+)
+
+// failedSuffix is appended, on Windows, to the binary replaced by a rollback.
+// It's still running and can only be moved aside.
+const failedSuffix = ".failed"
+
+// Rollback restores the binary replaced by the last update, e.g. when the new
+// version fails to start, and restarts the running agent on it.
+func Rollback() error {
+	execPath, err := executablePath()
+	if err != nil {
+		return err
+	}
+	oldPath := execPath + oldSuffix
+	if _, err := os.Stat(oldPath); errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("no previous binary to roll back to, %s not found", oldPath)
+	}
+
+	fmt.Fprintf(out, "Restoring the previous binary from '%s'...\n", oldPath)
+	if err := restoreBinary(oldPath, execPath); err != nil {
+		return fmt.Errorf("failed to restore the previous binary: %v", err)
+	}
+
+	// The restored binary isn't the one recorded by the update anymore
+	checksum, err := calculateFileSHA256(execPath)
+	if err == nil {
+		err = RecordChecksum(checksum)
+	}
+	if err != nil {
+		fmt.Fprintf(out, "Warning: %v\n", err)
+	}
+
+	running, err := restartAgent(execPath)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(out, "Rollback completed successfully.")
+	if !running {
+		fmt.Fprintln(out, "\tThe agent isn't running, the previous version is used when it starts.")
+	}
+	return nil
+}
+
+// restoreBinary moves the binary kept by applyUpdate back to targetPath
+func restoreBinary(oldPath, targetPath string) error {
+	if runtime.GOOS == "windows" {
+		failedPath := targetPath + failedSuffix
+		_ = os.Remove(failedPath)
+		if err := os.Rename(targetPath, failedPath); err != nil {
+			return fmt.Errorf("failed to move current binary aside: %w", err)
+		}
+	}
+	return os.Rename(oldPath, targetPath)
+}
+
+// keepBinary makes a copy of the binary at path, as a hard link when the
+// filesystem supports it
+func keepBinary(path, keptPath string) error {
+	if err := os.Link(path, keptPath); err == nil {
+		return nil
+	}
+
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	info, err := src.Stat()
+	if err != nil {
+		return err
+	}
+	dst, err := os.OpenFile(keptPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		os.Remove(keptPath)
+		return err
+	}
+	return dst.Close()
+}
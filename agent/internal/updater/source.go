@@ -0,0 +1,140 @@
+package updater
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"agent/internal/config"
+)
+
+// Options selects where an update comes from
+type Options struct {
+	// Force updates without draining the running agent
+	Force bool
+	// FromFile installs a binary copied to the host instead of downloading
+	// one, for hosts without access to the releases
+	FromFile string
+	// Checksum is the expected SHA256 of FromFile. The checksums manifest
+	// next to the file is used when it's empty.
+	Checksum string
+}
+
+// mirrorVersionFile is the file of a mirror holding the version of its
+// binaries
+const mirrorVersionFile = "version"
+
+// findUpdate returns the update to install: the given file, the latest
+// release of the configured mirror, or the latest release of the API. The
+// version of a file is read from the binary once it's verified.
+func findUpdate(opts Options) (*UpdateInfo, error) {
+	if opts.FromFile != "" {
+		return fileUpdate(opts.FromFile, opts.Checksum)
+	}
+	if cfg, err := config.Load(); err == nil && cfg.UpdateURL != "" {
+		fmt.Fprintf(out, "Checking the mirror %s for updates...\n", cfg.UpdateURL)
+		return checkMirror(cfg.UpdateURL)
+	}
+	return checkForUpdate()
+}
+
+// checkMirror reads the latest release of a mirror, a directory served over
+// HTTP with the layout of the releases:
+//
+//	<update_url>/version            1.4.2
+//	<update_url>/checksums          <sha256> simob-linux-amd64
+//	<update_url>/simob-linux-amd64
+func checkMirror(baseURL string) (*UpdateInfo, error) {
+	baseURL = strings.TrimRight(baseURL, "/")
+	resp, err := httpClient.Get(baseURL + "/" + mirrorVersionFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check the mirror for updates: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code from the mirror: %d", resp.StatusCode)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 256))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the mirror version: %w", err)
+	}
+	latest := strings.TrimPrefix(strings.TrimSpace(string(data)), "v")
+	if latest == "" {
+		return nil, fmt.Errorf("empty version file on the mirror")
+	}
+
+	// The checksum is mandatory, a mirror can't serve unverified binaries
+	checksum, err := downloadChecksum(baseURL, binaryName())
+	if err != nil {
+		return nil, err
+	}
+	return &UpdateInfo{
+		Version:     latest,
+		DownloadURL: baseURL + "/" + binaryName(),
+		Checksum:    checksum,
+	}, nil
+}
+
+// fileUpdate returns the update of a local binary. Without an explicit
+// checksum, the file must be listed in the checksums manifest shipped with it.
+func fileUpdate(path, checksum string) (*UpdateInfo, error) {
+	if _, err := os.Stat(path); err != nil {
+		return nil, fmt.Errorf("update file: %w", err)
+	}
+	checksum = strings.ToLower(strings.TrimSpace(checksum))
+	if checksum == "" {
+		var err error
+		checksum, err = readChecksum(filepath.Join(filepath.Dir(path), "checksums"), filepath.Base(path))
+		if err != nil {
+			return nil, fmt.Errorf("%w. Pass the SHA256 of the binary with --checksum", err)
+		}
+	}
+	return &UpdateInfo{DownloadURL: path, Checksum: checksum}, nil
+}
+
+// readChecksum returns the checksum of a binary in a local checksums manifest
+func readChecksum(manifestPath, name string) (string, error) {
+	f, err := os.Open(manifestPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to open checksums manifest: %w", err)
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		parts := strings.Fields(scanner.Text())
+		if len(parts) == 2 && parts[1] == name {
+			return parts[0], nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", fmt.Errorf("error scanning checksums manifest: %w", err)
+	}
+	return "", fmt.Errorf("binary %q not listed in %s", name, manifestPath)
+}
+
+// copyBinary copies a local binary to destPath, as downloadBinary does for
+// a download
+func copyBinary(srcPath, destPath string) error {
+	src, err := os.Open(srcPath)
+	if err != nil {
+		return fmt.Errorf("failed to open '%s': %w", srcPath, err)
+	}
+	defer src.Close()
+	dest, err := os.OpenFile(destPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o755)
+	if err != nil {
+		return fmt.Errorf("failed to create destination file '%s': %w", destPath, err)
+	}
+	defer dest.Close()
+	if _, err := io.Copy(dest, src); err != nil {
+		return fmt.Errorf("failed to copy '%s' to '%s': %w", srcPath, destPath, err)
+	}
+	// The mode isn't applied to an existing file
+	if err := os.Chmod(destPath, 0o755); err != nil {
+		return fmt.Errorf("failed to set executable permission on new binary '%s': %w", destPath, err)
+	}
+	return nil
+}
@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"crypto/sha256"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -14,26 +15,60 @@ import (
 	"strings"
 	"time"
 
+	"agent/internal/admin"
+	"agent/internal/common"
+	"agent/internal/transport"
 	"agent/internal/version"
 )
 
-// Some missing stuff:
-// - Rollback mechanism: Keep the old binary as .old
-// - Post install: Run some kind of post install health check
-
 // tempSuffix is appended to the downloaded binary before it's installed
 const tempSuffix = ".new"
 
+// oldSuffix is appended to the binary replaced by an update, kept for a
+// rollback
+const oldSuffix = ".old"
+
 // restartFileName is the name of the file created to signal a restart is needed
 const restartFileName = "restart"
 
+const (
+	// drainTimeout bounds the wait for a running agent to flush its spool
+	drainTimeout = 2 * time.Minute
+	// adminTimeout bounds the other commands sent to the agent
+	adminTimeout = 10 * time.Second
+	// maxUpdateBacklog is the spool size left after a drain above which the
+	// update is refused, the backend didn't accept it
+	maxUpdateBacklog = 64 << 20
+)
+
 // httpClient is a shared HTTP client
-var httpClient = &http.Client{Timeout: 10 * time.Second}
+var httpClient = &http.Client{Timeout: 10 * time.Second, Transport: transport.Shared()}
 
 // remoteApiUrl is the URL of the remote API that is called to get
 // info about the latest updates.
 var remoteApiUrl = "https://api.simpleobservability.com"
 
+// out receives the progress of the update and rollback, stdout unless set
+// with SetOutput
+var out io.Writer = os.Stdout
+
+// SetOutput sets where the progress of the update and rollback is written
+func SetOutput(w io.Writer) {
+	out = w
+}
+
+// ErrUnavailable is returned when no update could be found or downloaded,
+// the installed binary is left as it is
+var ErrUnavailable = errors.New("update unavailable")
+
+// Result is the outcome of an update
+type Result struct {
+	Previous string `json:"previous_version"`
+	Version  string `json:"version"`
+	// Updated is false when the installed version is the latest
+	Updated bool `json:"updated"`
+}
+
 // UpdateInfo holds information about an available update.
 type UpdateInfo struct {
 	Version     string // The new version string, e.g., "1.1.0"
@@ -41,88 +76,215 @@ type UpdateInfo struct {
 	Checksum    string // The expected SHA256 checksum of the new binary
 }
 
-// Update orchestrates the update process
-func Update() error {
-	fmt.Println("Starting update process ...")
-	fmt.Printf("Current simob version: %s\n", version.Version)
+// Update orchestrates the update process. A running agent is drained first,
+// unless forced, and the update is refused when it couldn't export its spool.
+// The checksum of the new binary is verified whatever its source.
+func Update(opts Options) (Result, error) {
+	fmt.Fprintln(out, "Starting update process ...")
+	fmt.Fprintf(out, "Current simob version: %s\n", version.Version)
 
 	// Check for updates
 	if envUrl := os.Getenv("API_URL"); envUrl != "" {
 		remoteApiUrl = envUrl
 	}
-	updateInfo, err := checkForUpdate()
+	result := Result{Previous: version.Version, Version: version.Version}
+	updateInfo, err := findUpdate(opts)
 	if err != nil {
-		return fmt.Errorf("error checking for updates: %v", err)
+		return result, fmt.Errorf("%w: error checking for updates: %v", ErrUnavailable, err)
 	}
 
-	// Check and compare versions
-	if !targetVersionIsNewer(version.Version, updateInfo.Version) {
-		return nil
+	// Check and compare versions, the version of a file is known once it's
+	// verified
+	if updateInfo.Version != "" {
+		if !targetVersionIsNewer(version.Version, updateInfo.Version) {
+			return result, nil
+		}
+		fmt.Fprintln(out, "Upgrading to version:", updateInfo.Version)
 	}
-	fmt.Println("Upgrading to version:", updateInfo.Version)
 
 	// Dynamically get current executable's path
 	execPath, err := os.Executable()
 	if err != nil {
-		return fmt.Errorf("failed to get executable path: %v", err)
+		return result, fmt.Errorf("failed to get executable path: %v", err)
 	}
 	// Resolve path to get the actual binary path if a symlink is used
 	execPath, err = filepath.EvalSymlinks(execPath)
 	if err != nil {
-		return fmt.Errorf("failed to resolve symlinks for executable path: %v", err)
+		return result, fmt.Errorf("failed to resolve symlinks for executable path: %v", err)
 	}
 
 	// Define path for the downloaded new binary
 	// Using a temporary directory for the download.
 	newBinaryPath := filepath.Join(execPath + tempSuffix)
-	fmt.Printf("New binary will be temporarily stored at: %s\n", newBinaryPath)
+	fmt.Fprintf(out, "New binary will be temporarily stored at: %s\n", newBinaryPath)
 
 	// Ensure cleanup of the temporary file
 	defer func() {
 		if _, err := os.Stat(newBinaryPath); err == nil {
-			fmt.Printf("Cleaning up temporary file: %s\n", newBinaryPath)
+			fmt.Fprintf(out, "Cleaning up temporary file: %s\n", newBinaryPath)
 			_ = os.Remove(newBinaryPath)
 		}
 	}()
 
-	// Download the new binary
-	fmt.Printf("Downloading update from %s...\n", updateInfo.DownloadURL)
-	err = downloadBinary(updateInfo.DownloadURL, newBinaryPath)
-	if err != nil {
-		return fmt.Errorf("failed to download update: %v", err)
+	if opts.FromFile != "" {
+		fmt.Fprintf(out, "Copying update from %s...\n", opts.FromFile)
+		if err := copyBinary(opts.FromFile, newBinaryPath); err != nil {
+			return result, fmt.Errorf("%w: failed to copy update: %v", ErrUnavailable, err)
+		}
+	} else {
+		// Download the new binary
+		fmt.Fprintf(out, "Downloading update from %s...\n", updateInfo.DownloadURL)
+		err = downloadBinary(updateInfo.DownloadURL, newBinaryPath)
+		if err != nil {
+			return result, fmt.Errorf("%w: failed to download update: %v", ErrUnavailable, err)
+		}
+		fmt.Fprintln(out, "Download complete.")
 	}
-	fmt.Println("Download complete.")
 
 	// Verify the downloaded binary's integrity
-	fmt.Println("Verifying checksum of the downloaded binary...")
+	fmt.Fprintln(out, "Verifying checksum of the downloaded binary...")
 	verified, err := verifySHA256(newBinaryPath, updateInfo.Checksum)
 	if err != nil {
-		return fmt.Errorf("error during checksum verification: %v", err)
+		return result, fmt.Errorf("error during checksum verification: %v", err)
 	}
 	if !verified {
 		// It's crucial to abort if the checksum doesn't match.
-		return fmt.Errorf("checksum verification FAILED. Expected: %s. The downloaded file may be corrupted or tampered with. Update aborted", updateInfo.Checksum)
+		return result, fmt.Errorf("checksum verification FAILED. Expected: %s. The downloaded file may be corrupted or tampered with. Update aborted", updateInfo.Checksum)
+	}
+	fmt.Fprintln(out, "Checksum verified successfully.")
+
+	if updateInfo.Version == "" {
+		updateInfo.Version, err = binaryVersion(newBinaryPath)
+		if err != nil {
+			return result, fmt.Errorf("failed to read the version of %s: %v", opts.FromFile, err)
+		}
+		if !targetVersionIsNewer(version.Version, updateInfo.Version) {
+			return result, nil
+		}
+		fmt.Fprintln(out, "Upgrading to version:", updateInfo.Version)
+	}
+
+	drained, err := drainAgent(opts.Force)
+	if err != nil {
+		return result, err
 	}
-	fmt.Println("Checksum verified successfully.")
+	applied := false
+	defer func() {
+		if drained && !applied {
+			resumeAgent()
+		}
+	}()
 
 	// Apply the update (replace the old binary with the new one)
-	fmt.Println("Applying update (replacing old binary)...")
+	fmt.Fprintln(out, "Applying update (replacing old binary)...")
 	err = applyUpdate(newBinaryPath, execPath)
 	if err != nil {
-		return fmt.Errorf("failed to apply update: %v", err)
+		return result, fmt.Errorf("failed to apply update: %v", err)
+	}
+
+	// Run the new binary before restarting the agent on it, a release that
+	// doesn't start on this host is replaced by the previous binary
+	fmt.Fprintln(out, "Checking the new binary...")
+	if err := checkHealth(execPath, updateInfo.Version); err != nil {
+		fmt.Fprintf(out, "Health check of the new binary failed: %v\n", err)
+		fmt.Fprintln(out, "Restoring the previous binary...")
+		if restoreErr := restoreBinary(execPath+oldSuffix, execPath); restoreErr != nil {
+			return result, fmt.Errorf("health check of the new binary failed (%v) and restoring the previous binary failed: %v", err, restoreErr)
+		}
+		return result, fmt.Errorf("health check of the new binary failed, previous binary restored: %v", err)
+	}
+	fmt.Fprintln(out, "New binary healthy.")
+
+	// Record the checksum of the new binary, the agent reports a binary that
+	// doesn't match it
+	if err := RecordChecksum(updateInfo.Checksum); err != nil {
+		fmt.Fprintf(out, "Warning: %v\n", err)
+	}
+
+	applied = true
+	result.Version, result.Updated = updateInfo.Version, true
+
+	running, err := restartAgent(execPath)
+	if err != nil {
+		return result, err
+	}
+	fmt.Fprintf(out, "Update completed successfully from version '%s' to version '%s'.\n", version.Version, updateInfo.Version)
+	if !running {
+		fmt.Fprintln(out, "\tThe agent isn't running, the new version is used when it starts.")
+		return result, nil
+	}
+	fmt.Fprintln(out, "\tIf the agent is running with systemd, it will auto-restart shortly.")
+	fmt.Fprintln(out, "\tIf it's running without systemd, the agent will stop and needs manual restart.")
+	fmt.Fprintln(out, "\tIf the new version fails to start, run 'simob update --rollback'.")
+	return result, nil
+}
+
+// restartAgent restarts the running agent through the admin socket, or the
+// restart file for agents older than it, so that it runs the binary now
+// installed. It returns whether an agent was running, one that isn't uses the
+// new binary when it starts.
+func restartAgent(execPath string) (bool, error) {
+	running, err := common.IsLockAcquired()
+	if err != nil {
+		fmt.Fprintf(out, "Warning: could not check whether the agent is running: %v\n", err)
+		running = true
+	}
+	if !running {
+		return false, nil
+	}
+	if _, err := admin.Send(admin.Request{Command: admin.Restart}, adminTimeout); err != nil {
+		if !errors.Is(err, admin.ErrNotRunning) {
+			fmt.Fprintf(out, "Warning: failed to restart the agent: %v\n", err)
+		}
+		fmt.Fprintln(out, "Creating restart signal file...")
+		if err := createRestartSignal(execPath); err != nil {
+			return true, fmt.Errorf("failed to create restart signal: %v", err)
+		}
+	}
+	return true, nil
+}
+
+// drainAgent asks the running agent, if any, to stop collecting and flush its
+// spool before its binary is replaced. It returns whether the agent was
+// drained, and an error when the backlog left is too large to update safely.
+func drainAgent(force bool) (bool, error) {
+	if force {
+		fmt.Fprintln(out, "Forced update, not draining the running agent.")
+		return false, nil
+	}
+	running, err := common.IsLockAcquired()
+	if err != nil {
+		fmt.Fprintf(out, "Warning: could not check whether the agent is running: %v\n", err)
+		return false, nil
+	}
+	if !running {
+		return false, nil
 	}
 
-	// Create restart signal file
-	fmt.Println("Creating restart signal file...")
-	err = createRestartSignal(execPath)
+	fmt.Fprintln(out, "Agent running, waiting for it to flush its spool...")
+	resp, err := admin.Send(admin.Request{Command: admin.Drain}, drainTimeout)
+	if errors.Is(err, admin.ErrNotRunning) {
+		// Agents older than the admin socket
+		fmt.Fprintln(out, "Warning: the running agent can't be drained, its pending data is kept in the spool.")
+		return false, nil
+	}
 	if err != nil {
-		return fmt.Errorf("failed to create restart signal: %v", err)
+		return false, fmt.Errorf("failed to drain the running agent: %w. Use --force to update anyway", err)
 	}
+	if resp.BacklogBytes > maxUpdateBacklog {
+		resumeAgent()
+		return false, fmt.Errorf("the running agent still has %d MB waiting to be exported, update refused. Use --force to update anyway", resp.BacklogBytes>>20)
+	}
+	fmt.Fprintf(out, "Agent drained, %d bytes left in the spool.\n", resp.BacklogBytes)
+	return true, nil
+}
 
-	fmt.Printf("Update completed successfully from version '%s' to version '%s'.\n", version.Version, updateInfo.Version)
-	fmt.Println("\tIf the agent is running with systemd, it will auto-restart shortly.")
-	fmt.Println("\tIf it's running without systemd, the agent will stop and needs manual restart.")
-	return nil
+// resumeAgent restarts the collection of an agent drained for an update that
+// didn't happen
+func resumeAgent() {
+	if _, err := admin.Send(admin.Request{Command: admin.Resume}, adminTimeout); err != nil {
+		fmt.Fprintf(out, "Warning: failed to resume the agent, it resumes on its own within minutes: %v\n", err)
+	}
 }
 
 // binaryName returns the name of the binary in the format "simob-<os>-<arch>".
@@ -164,7 +326,7 @@ func checkForUpdate() (*UpdateInfo, error) {
 	// Prefer manifest approach: try to download checksums
 	manifestChecksum, err := downloadChecksum(apiResp.URL, binaryName())
 	if err != nil {
-		fmt.Printf("Warning: could not fetch manifest checksum: %v\n", err)
+		fmt.Fprintf(out, "Warning: could not fetch manifest checksum: %v\n", err)
 	}
 	if manifestChecksum != "" {
 		expectedChecksum = manifestChecksum
@@ -224,7 +386,7 @@ func targetVersionIsNewer(currentVersion, targetVersion string) bool {
 	splitCurrent := strings.Split(currentVersion, ".")
 	splitTarget := strings.Split(targetVersion, ".")
 	if len(splitCurrent) != 3 || len(splitTarget) != 3 {
-		fmt.Printf("Version format error: current=%q target=%q (expected 3 segments)\n", currentVersion, targetVersion)
+		fmt.Fprintf(out, "Version format error: current=%q target=%q (expected 3 segments)\n", currentVersion, targetVersion)
 		return false
 	}
 	for i := range 3 {
@@ -239,13 +401,13 @@ func targetVersionIsNewer(currentVersion, targetVersion string) bool {
 			return false
 		}
 	}
-	fmt.Println("Agent is already running the latest version.")
+	fmt.Fprintln(out, "Agent is already running the latest version.")
 	return false // versions are equal
 }
 
 // downloadBinary downloads a binary from a URL to a destination path.
 func downloadBinary(url string, destPath string) error {
-	fmt.Printf("Attempting to download from URL: %s to %s\n", url, destPath)
+	fmt.Fprintf(out, "Attempting to download from URL: %s to %s\n", url, destPath)
 
 	// Make the HTTP GET request
 	resp, err := http.Get(url)
@@ -272,14 +434,14 @@ func downloadBinary(url string, destPath string) error {
 	if err != nil {
 		return fmt.Errorf("failed to copy downloaded content to '%s': %w", destPath, err)
 	}
-	fmt.Printf("Successfully downloaded %d bytes to %s\n", bytesCopied, destPath)
+	fmt.Fprintf(out, "Successfully downloaded %d bytes to %s\n", bytesCopied, destPath)
 
 	// Make the downloaded binary executable. This is crucial.
 	err = os.Chmod(destPath, 0755) // rwxr-xr-x permissions
 	if err != nil {
 		return fmt.Errorf("failed to set executable permission on new binary '%s': %w", destPath, err)
 	}
-	fmt.Printf("Binary saved to %s and set as executable.\n", destPath)
+	fmt.Fprintf(out, "Binary saved to %s and set as executable.\n", destPath)
 	return nil
 }
 
@@ -290,8 +452,8 @@ func verifySHA256(filePath string, expectedSHA256 string) (bool, error) {
 		return false, fmt.Errorf("could not calculate SHA256 for '%s': %w", filePath, err)
 	}
 
-	fmt.Printf("Calculated SHA256: %s\n", calculatedSHA256)
-	fmt.Printf("Expected SHA256  : %s\n", expectedSHA256)
+	fmt.Fprintf(out, "Calculated SHA256: %s\n", calculatedSHA256)
+	fmt.Fprintf(out, "Expected SHA256  : %s\n", expectedSHA256)
 
 	return calculatedSHA256 == expectedSHA256, nil
 }
@@ -312,21 +474,28 @@ func calculateFileSHA256(filePath string) (string, error) {
 	return fmt.Sprintf("%x", hasher.Sum(nil)), nil
 }
 
-// applyUpdate replaces the current executable file with the new one.
-// On Unix-like systems, os.Rename is atomic if src and dst are on the same filesystem.
+// applyUpdate replaces the current executable file with the new one, keeping
+// the current one as <target>.old for a rollback.
+// On Unix-like systems, os.Rename is atomic if src and dst are on the same filesystem,
+// and the current executable is linked aside so that the target path always exists.
 // On Windows, a running executable cannot be overwritten, so we move it aside first.
 func applyUpdate(newExecPath string, targetPath string) error {
-	fmt.Printf("Attempting to replace running executable '%s' with new binary '%s'\n", targetPath, newExecPath)
+	fmt.Fprintf(out, "Attempting to replace running executable '%s' with new binary '%s'\n", targetPath, newExecPath)
 
+	oldPath := targetPath + oldSuffix
+	// Remove existing .old file if it exists
+	_ = os.Remove(oldPath)
 	if runtime.GOOS == "windows" {
-		oldPath := targetPath + ".old"
-		// Remove existing .old file if it exists
-		_ = os.Remove(oldPath)
-		fmt.Printf("Windows detected: moving current binary to '%s' first\n", oldPath)
+		fmt.Fprintf(out, "Windows detected: moving current binary to '%s' first\n", oldPath)
 		err := os.Rename(targetPath, oldPath)
 		if err != nil {
 			return fmt.Errorf("failed to move current binary aside: %w", err)
 		}
+	} else {
+		fmt.Fprintf(out, "Keeping current binary as '%s'\n", oldPath)
+		if err := keepBinary(targetPath, oldPath); err != nil {
+			return fmt.Errorf("failed to keep current binary: %w", err)
+		}
 	}
 
 	// Attempt to rename the new binary to the location of the current executable.
@@ -335,7 +504,7 @@ func applyUpdate(newExecPath string, targetPath string) error {
 		return fmt.Errorf("failed to rename '%s' to '%s': %w", newExecPath, targetPath, err)
 	}
 
-	fmt.Printf("Successfully replaced '%s' with the new version from '%s'.\n", targetPath, newExecPath)
+	fmt.Fprintf(out, "Successfully replaced '%s' with the new version from '%s'.\n", targetPath, newExecPath)
 	return nil
 }
 
@@ -346,7 +515,7 @@ func createRestartSignal(execPath string) error {
 	execDir := filepath.Dir(execPath)
 	restartFilePath := filepath.Join(execDir, restartFileName)
 
-	fmt.Printf("Creating restart signal file at: %s\n", restartFilePath)
+	fmt.Fprintf(out, "Creating restart signal file at: %s\n", restartFilePath)
 
 	// Create an empty file
 	file, err := os.Create(restartFilePath)
@@ -355,6 +524,6 @@ func createRestartSignal(execPath string) error {
 	}
 	defer file.Close()
 
-	fmt.Printf("Successfully created restart signal file: %s\n", restartFilePath)
+	fmt.Fprintf(out, "Successfully created restart signal file: %s\n", restartFilePath)
 	return nil
 }
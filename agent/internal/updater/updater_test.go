@@ -124,6 +124,18 @@ func TestApplyUpdate_Logic(t *testing.T) {
 
 	_, err = os.Stat(newPath)
 	assert.True(t, os.IsNotExist(err), "new file should be gone")
+
+	// The replaced binary is kept for a rollback
+	content, err = os.ReadFile(oldPath + oldSuffix)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("old"), content)
+
+	require.NoError(t, restoreBinary(oldPath+oldSuffix, oldPath))
+	content, err = os.ReadFile(oldPath)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("old"), content)
+	_, err = os.Stat(oldPath + oldSuffix)
+	assert.True(t, os.IsNotExist(err), "old file should be gone")
 }
 
 func TestCreateRestartSignal_Logic(t *testing.T) {
@@ -138,3 +150,55 @@ func TestCreateRestartSignal_Logic(t *testing.T) {
 	_, err = os.Stat(filepath.Join(tmpDir, "restart"))
 	assert.NoError(t, err, "restart signal file should exist")
 }
+
+func TestCheckMirror(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/simob/version":
+			w.Write([]byte("v1.2.0\n"))
+		case "/simob/checksums":
+			w.Write([]byte(fmt.Sprintf("mirror-checksum %s\n", binaryName())))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	info, err := checkMirror(server.URL + "/simob/")
+	require.NoError(t, err)
+	assert.Equal(t, "1.2.0", info.Version)
+	assert.Equal(t, "mirror-checksum", info.Checksum)
+	assert.Equal(t, server.URL+"/simob/"+binaryName(), info.DownloadURL)
+
+	// No checksum, no update
+	_, err = checkMirror(server.URL + "/other")
+	assert.Error(t, err)
+}
+
+func TestFileUpdate(t *testing.T) {
+	dir := t.TempDir()
+	binary := filepath.Join(dir, "simob-linux-amd64")
+	require.NoError(t, os.WriteFile(binary, []byte("binary data"), 0o644))
+
+	_, err := fileUpdate(binary, "")
+	assert.ErrorContains(t, err, "--checksum")
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "checksums"), []byte("abc simob-linux-amd64\ndef simob-linux-arm64\n"), 0o644))
+	info, err := fileUpdate(binary, "")
+	require.NoError(t, err)
+	assert.Equal(t, "abc", info.Checksum)
+	assert.Empty(t, info.Version)
+
+	info, err = fileUpdate(binary, " ABC123 ")
+	require.NoError(t, err)
+	assert.Equal(t, "abc123", info.Checksum)
+
+	_, err = fileUpdate(filepath.Join(dir, "missing"), "abc")
+	assert.Error(t, err)
+
+	dest := filepath.Join(dir, "simob.new")
+	require.NoError(t, copyBinary(binary, dest))
+	stat, err := os.Stat(dest)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o755), stat.Mode().Perm())
+}